@@ -78,6 +78,11 @@ var (
 		Name:  "newpath",
 		Usage: "New absolute file path",
 	}
+
+	renewalPolicyFlag = cli.StringFlag{
+		Name:  "policy",
+		Usage: "Renewal policy of the file, one of always, never and ifhealthy",
+	}
 )
 
 var storageClientCommand = cli.Command{
@@ -313,6 +318,23 @@ with this command`,
 
 will delete the file uploaded by the storage client. This filepath flag must be used along
 with this command to specify which file will be deleted`,
+		},
+		{
+			Name:      "renewpolicy",
+			Usage:     "Set the renewal policy of the file uploaded by the storage client",
+			ArgsUsage: "",
+			Action:    utils.MigrateFlags(fileRenewalPolicy),
+			Flags: []cli.Flag{
+				filePathFlag,
+				renewalPolicyFlag,
+			},
+			Description: `
+			gdx sclient renewpolicy [--filepath arg] [--policy arg]
+
+will set the renewal policy of the file uploaded by the storage client. The policy always renews
+the contracts storing the file, never allows the contracts to lapse, and ifhealthy renews the
+contracts only when the file is healthy. Both filepath and policy flags must be used along
+with this command`,
 		},
 		{
 			Name:      "periodCost",
@@ -352,9 +374,11 @@ func getConfig(ctx *cli.Context) error {
 	Max Upload Speed:               %s
 	Max Download Speed:             %s
 	IP Violation Check Status:      %s
+	Repair Download Threshold:      %s
 `, config.RentPayment.Fund, config.RentPayment.Period, config.RentPayment.StorageHosts,
 		config.RentPayment.ExpectedRedundancy, config.RentPayment.ExpectedStorage, config.RentPayment.ExpectedUpload,
-		config.RentPayment.ExpectedDownload, config.MaxUploadSpeed, config.MaxDownloadSpeed, config.EnableIPViolation)
+		config.RentPayment.ExpectedDownload, config.MaxUploadSpeed, config.MaxDownloadSpeed, config.EnableIPViolation,
+		config.RepairDownloadThreshold)
 
 	return nil
 }
@@ -731,8 +755,9 @@ func getFile(ctx *cli.Context) error {
 	Redundancy:        %v    
 	StorageOnDisk:     %v
 	UploadProgress:    %v
+	RenewalPolicy:     %s
 `, fileInfo.DxPath, fileInfo.Status, fileInfo.SourcePath, fileInfo.FileSize, fileInfo.Redundancy,
-		fileInfo.StoredOnDisk, fileInfo.UploadProgress)
+		fileInfo.StoredOnDisk, fileInfo.UploadProgress, fileInfo.RenewalPolicy)
 
 	return nil
 }
@@ -787,6 +812,34 @@ func fileDelete(ctx *cli.Context) error {
 	return nil
 }
 
+func fileRenewalPolicy(ctx *cli.Context) error {
+	client, err := gdxAttach(ctx)
+	if err != nil {
+		utils.Fatalf("unable to connect to remote gdx, please start the gdx first: %s", err.Error())
+	}
+
+	var filePath, policy string
+	if !ctx.IsSet(filePathFlag.Name) {
+		utils.Fatalf("must specify the file path used for uploading in order to set the renewal policy")
+	} else {
+		filePath = ctx.String(filePathFlag.Name)
+	}
+
+	if !ctx.IsSet(renewalPolicyFlag.Name) {
+		utils.Fatalf("must specify the renewal policy")
+	} else {
+		policy = ctx.String(renewalPolicyFlag.Name)
+	}
+
+	var resp string
+	if err = client.Call(&resp, "clientfiles_setRenewalPolicy", filePath, policy); err != nil {
+		utils.Fatalf("%s", err.Error())
+	}
+
+	fmt.Println(resp)
+	return nil
+}
+
 func periodCost(ctx *cli.Context) error {
 	// attaching to the remote gdx
 	client, err := gdxAttach(ctx)
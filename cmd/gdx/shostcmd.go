@@ -262,6 +262,10 @@ func getHostConfig(ctx *cli.Context) error {
 	MaxReviseBatchSize:            %v
 	WindowSize:                    %v
 	PaymentAddress:                %s 
+	RevisionBatchWindow:           %v
+	ProofSubmissionMargin:         %v
+	ReadVerificationRate:          %v
+	FolderSelection:               %v
 	Deposit:                       %v
 	DepositBudget:                 %v
 	MaxDeposit:                    %v
@@ -273,7 +277,7 @@ func getHostConfig(ctx *cli.Context) error {
 	UploadBandwidthPrice:          %v
 `, config.AcceptingContracts, config.MaxDownloadBatchSize, config.MaxDuration,
 		config.MaxReviseBatchSize, config.WindowSize, config.PaymentAddress,
-		config.Deposit, config.DepositBudget, config.MaxDeposit, config.BaseRPCPrice,
+		config.RevisionBatchWindow, config.ProofSubmissionMargin, config.ReadVerificationRate, config.FolderSelection, config.Deposit, config.DepositBudget, config.MaxDeposit, config.BaseRPCPrice,
 		config.ContractPrice, config.DownloadBandwidthPrice, config.SectorAccessPrice,
 		config.StoragePrice, config.UploadBandwidthPrice)
 
@@ -395,7 +399,8 @@ func getHostFolders(ctx *cli.Context) error {
 	Folder Path:    %s
 	TotalSpace:     %v sectors
 	UsedSpace:      %v sectors
-`, i+1, folder.Path, folder.TotalSectors, folder.UsedSectors)
+	LostSpace:      %v sectors
+`, i+1, folder.Path, folder.TotalSectors, folder.UsedSectors, folder.LostSectors)
 	}
 
 	return nil
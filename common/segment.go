@@ -0,0 +1,54 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package common
+
+// The data of a file is divided into segments of the same size, where the final segment is
+// partial if the file size is not a multiple of the segment size. The helpers below are shared
+// by the upload, download and storage proof, so that the final segment is handled the same way.
+
+// NumSegments returns the number of segments a file of fileSize is divided into. The final
+// segment might be partial, and an empty file has a single empty segment
+func NumSegments(fileSize, segmentSize uint64) uint64 {
+	num := fileSize / segmentSize
+	if fileSize == 0 || fileSize%segmentSize != 0 {
+		num++
+	}
+	return num
+}
+
+// FinalSegmentLength returns the length of the file data in the final segment, which is the
+// segment size if the file size is a multiple of the segment size. The final segment of an
+// empty file has length 0
+func FinalSegmentLength(fileSize, segmentSize uint64) uint64 {
+	if fileSize == 0 {
+		return 0
+	}
+	if remainder := fileSize % segmentSize; remainder != 0 {
+		return remainder
+	}
+	return segmentSize
+}
+
+// FinalSegmentSectorData zero pads the logical sector data of the final segment beyond the file
+// data in place, and returns the sectors. The data read for the final segment of a partial file
+// is thus the same no matter whether it is read from the local file or downloaded from hosts
+func FinalSegmentSectorData(sectors [][]byte, fileSize, segmentSize uint64) [][]byte {
+	dataLength := FinalSegmentLength(fileSize, segmentSize)
+	var offset uint64
+	for _, sector := range sectors {
+		sectorLength := uint64(len(sector))
+		if offset+sectorLength > dataLength {
+			start := uint64(0)
+			if dataLength > offset {
+				start = dataLength - offset
+			}
+			for i := start; i < sectorLength; i++ {
+				sector[i] = 0
+			}
+		}
+		offset += sectorLength
+	}
+	return sectors
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNumSegmentsAndFinalSegmentLength(t *testing.T) {
+	tests := []struct {
+		fileSize    uint64
+		segmentSize uint64
+		numSegments uint64
+		finalLength uint64
+	}{
+		{0, 64, 1, 0},
+		{1, 64, 1, 1},
+		{63, 64, 1, 63},
+		{64, 64, 1, 64},
+		{65, 64, 2, 1},
+		{128, 64, 2, 64},
+		{130, 64, 3, 2},
+		{640, 64, 10, 64},
+	}
+	for _, test := range tests {
+		if num := NumSegments(test.fileSize, test.segmentSize); num != test.numSegments {
+			t.Errorf("file size %v: expect %v segments, got %v", test.fileSize, test.numSegments, num)
+		}
+		if length := FinalSegmentLength(test.fileSize, test.segmentSize); length != test.finalLength {
+			t.Errorf("file size %v: expect final segment length %v, got %v", test.fileSize, test.finalLength, length)
+		}
+		// the segments sum up to the file size
+		if sum := (test.numSegments-1)*test.segmentSize + test.finalLength; sum != test.fileSize {
+			t.Errorf("file size %v: segments sum up to %v", test.fileSize, sum)
+		}
+	}
+}
+
+func TestFinalSegmentSectorData(t *testing.T) {
+	sectorSize, numSectors := 16, 4
+	segmentSize := uint64(sectorSize * numSectors)
+	tests := []struct {
+		fileSize uint64
+	}{
+		{segmentSize * 3},
+		{segmentSize*3 + 1},
+		{segmentSize*3 + uint64(sectorSize)},
+		{segmentSize*3 + uint64(sectorSize) + 5},
+		{segmentSize*4 - 1},
+	}
+	for _, test := range tests {
+		sectors := make([][]byte, numSectors)
+		for i := range sectors {
+			sectors[i] = bytes.Repeat([]byte{0xff}, sectorSize)
+		}
+		sectors = FinalSegmentSectorData(sectors, test.fileSize, segmentSize)
+
+		dataLength := int(FinalSegmentLength(test.fileSize, segmentSize))
+		data := bytes.Join(sectors, nil)
+		if !bytes.Equal(data[:dataLength], bytes.Repeat([]byte{0xff}, dataLength)) {
+			t.Errorf("file size %v: file data of the final segment modified", test.fileSize)
+		}
+		if !bytes.Equal(data[dataLength:], make([]byte, len(data)-dataLength)) {
+			t.Errorf("file size %v: data beyond the end of file not zero padded", test.fileSize)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package writeaheadlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/DxChainNetwork/godx/crypto/twofishgcm"
+)
+
+// The encryption section follows the metadata in the first page of the log file:
+// encryption type (1 byte) | length of key check (1 byte) | key check
+// The key check is the metadata header sealed with the key, which is used to verify the key
+// before any transaction is recovered. Only the data of the operations is encrypted, and the
+// names of the operations are kept in plain text.
+
+const (
+	encryptionNone uint8 = iota
+	encryptionGCM
+)
+
+// rekeyTempSuffix is the suffix of the temporary log file written during rekey
+const rekeyTempSuffix = ".rekey"
+
+var (
+	// ErrWalEncrypted is the error that the wal is encrypted but no key is provided
+	ErrWalEncrypted = errors.New("wal is encrypted, key required")
+
+	// ErrWalNotEncrypted is the error that a key is provided but the wal is not encrypted
+	ErrWalNotEncrypted = errors.New("wal is not encrypted")
+
+	// ErrWrongWalKey is the error that the key provided is not the key the wal is encrypted with
+	ErrWrongWalKey = errors.New("wrong wal encryption key")
+)
+
+// NewEncrypted create a new Wal file with the path as logfile, where the data of the operations
+// is encrypted with the key. The key must be 32 bytes long. If the logfile exists, it must be
+// encrypted with the same key
+func NewEncrypted(path string, key []byte) (*Wal, []*Transaction, error) {
+	walKey, err := twofishgcm.NewGCMCipherKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newEncryptedWal(path, &utilsProd{}, walKey)
+}
+
+// Rekey rewrite the logfile under the new key, keeping all committed transactions not yet
+// released. A nil key means no encryption, so Rekey could also be used to encrypt or decrypt
+// an existing logfile. The wal must not be opened during rekey.
+func Rekey(path string, oldKey, newKey []byte) error {
+	return rekey(path, oldKey, newKey, &utilsProd{})
+}
+
+// rekey is the helper function of Rekey with the utils
+func rekey(path string, oldKey, newKey []byte, utils utilsSet) error {
+	oldWalKey, err := optionalWalKey(oldKey)
+	if err != nil {
+		return fmt.Errorf("invalid old key: %v", err)
+	}
+	newWalKey, err := optionalWalKey(newKey)
+	if err != nil {
+		return fmt.Errorf("invalid new key: %v", err)
+	}
+
+	// recover the committed transactions with the old key
+	oldWal, txns, err := newEncryptedWal(path, utils, oldWalKey)
+	if err != nil {
+		return err
+	}
+	if _, err = oldWal.CloseIncomplete(); err != nil {
+		return err
+	}
+
+	// write the transactions to a temporary logfile under the new key. The temporary logfile
+	// left by a previous failed rekey is removed
+	tempPath := path + rekeyTempSuffix
+	if err = utils.remove(tempPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	newWal, _, err := newEncryptedWal(tempPath, utils, newWalKey)
+	if err != nil {
+		return err
+	}
+	for _, txn := range txns {
+		newTxn, err := newWal.NewTransaction(txn.Operations)
+		if err == nil {
+			err = <-newTxn.Commit()
+		}
+		if err != nil {
+			_, closeErr := newWal.CloseIncomplete()
+			return composeError(fmt.Errorf("cannot rewrite transaction %d: %v", txn.ID, err), closeErr, utils.remove(tempPath))
+		}
+	}
+	if _, err = newWal.CloseIncomplete(); err != nil {
+		return err
+	}
+
+	// replace the logfile with the rewritten one
+	return os.Rename(tempPath, path)
+}
+
+// optionalWalKey returns the wal key from the input key. A nil key means no encryption
+func optionalWalKey(key []byte) (*twofishgcm.GCMCipherKey, error) {
+	if key == nil {
+		return nil, nil
+	}
+	return twofishgcm.NewGCMCipherKey(key)
+}
+
+// writeEncryption write the encryption section of the key to the logfile
+func writeEncryption(f file, key *twofishgcm.GCMCipherKey) error {
+	data := []byte{encryptionNone}
+	if key != nil {
+		check, err := key.Encrypt(metadataHeader[:])
+		if err != nil {
+			return err
+		}
+		data = append([]byte{encryptionGCM, byte(len(check))}, check...)
+	}
+	_, err := f.WriteAt(data, int64(metadataLength))
+	return err
+}
+
+// verifyEncryption verify the key against the encryption section of the logfile data.
+// The logfile written before the encryption is supported has no encryption section, which is
+// regarded as not encrypted
+func verifyEncryption(data []byte, key *twofishgcm.GCMCipherKey) error {
+	encryption := encryptionNone
+	if len(data) > metadataLength {
+		encryption = data[metadataLength]
+	}
+	switch encryption {
+	case encryptionNone:
+		if key != nil {
+			return ErrWalNotEncrypted
+		}
+		return nil
+	case encryptionGCM:
+		if key == nil {
+			return ErrWalEncrypted
+		}
+		if len(data) < metadataLength+2 || len(data) < metadataLength+2+int(data[metadataLength+1]) {
+			return errors.New("wal encryption section corrupted")
+		}
+		check := data[metadataLength+2 : metadataLength+2+int(data[metadataLength+1])]
+		header, err := key.Decrypt(check)
+		if err != nil || !bytes.Equal(header, metadataHeader[:]) {
+			return ErrWrongWalKey
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown wal encryption type %d", encryption)
+	}
+}
+
+// sealOps returns the operations with the data encrypted with the key of the wal.
+// If the wal is not encrypted, the input operations are returned
+func (w *Wal) sealOps(ops []Operation) ([]Operation, error) {
+	if w.key == nil {
+		return ops, nil
+	}
+	sealed := make([]Operation, 0, len(ops))
+	for _, op := range ops {
+		data, err := w.key.Encrypt(op.Data)
+		if err != nil {
+			return nil, err
+		}
+		sealed = append(sealed, Operation{Name: op.Name, Data: data})
+	}
+	return sealed, nil
+}
+
+// openOps decrypts the data of the operations in place with the key of the wal
+func (w *Wal) openOps(ops []Operation) error {
+	if w.key == nil {
+		return nil
+	}
+	for i := range ops {
+		data, err := w.key.Decrypt(ops[i].Data)
+		if err != nil {
+			return err
+		}
+		ops[i].Data = data
+	}
+	return nil
+}
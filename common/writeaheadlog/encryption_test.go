@@ -0,0 +1,103 @@
+package writeaheadlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/crypto/twofishgcm"
+)
+
+// TestEncryptedWalRekey test the encrypted transactions are recovered with the correct key after
+// rekey, and the recovery fails with the wrong key
+func TestEncryptedWalRekey(t *testing.T) {
+	testdir := tempDir(t.Name())
+	if err := os.MkdirAll(testdir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(testdir, "test.wal")
+	oldKey, newKey := randomWalKey(t), randomWalKey(t)
+
+	// write the committed transactions, one of which is released
+	wal, _, err := NewEncrypted(path, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("the secret data stored in the wal")
+	expect := []Operation{
+		{Name: "op1", Data: secret},
+		{Name: "op2", Data: bytes.Repeat([]byte{1}, PageSize*2)},
+	}
+	var txns []*Transaction
+	for _, op := range append(expect, Operation{Name: "released", Data: []byte("released")}) {
+		txn, err := wal.NewTransaction([]Operation{op})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = <-txn.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		txns = append(txns, txn)
+	}
+	if err = txns[2].Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = wal.CloseIncomplete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data is not written in plain text
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, secret) {
+		t.Fatal("operation data written in plain text")
+	}
+
+	// rekey with the wrong old key fails, and the logfile is kept
+	if err = Rekey(path, newKey, newKey); err == nil {
+		t.Fatal("rekey with the wrong key shall fail")
+	}
+	if err = Rekey(path, oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// the recovery fails clearly with the wrong key or without key
+	if _, _, err = NewEncrypted(path, oldKey); err == nil || !bytes.Contains([]byte(err.Error()), []byte(ErrWrongWalKey.Error())) {
+		t.Fatalf("expect error %v, got %v", ErrWrongWalKey, err)
+	}
+	if _, _, err = New(path); err == nil || !bytes.Contains([]byte(err.Error()), []byte(ErrWalEncrypted.Error())) {
+		t.Fatalf("expect error %v, got %v", ErrWalEncrypted, err)
+	}
+
+	// the unreleased transactions are recovered with the new key
+	wal, recovered, err := NewEncrypted(path, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered) != len(expect) {
+		t.Fatalf("expect %v recovered transactions, got %v", len(expect), len(recovered))
+	}
+	for i, txn := range recovered {
+		if len(txn.Operations) != 1 || txn.Operations[0].Name != expect[i].Name || !bytes.Equal(txn.Operations[0].Data, expect[i].Data) {
+			t.Errorf("recovered transaction %v not expected", i)
+		}
+		if err = txn.Release(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// randomWalKey generate a random key for the encrypted wal
+func randomWalKey(t *testing.T) []byte {
+	key, err := twofishgcm.GenerateGCMCipherKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Key()
+}
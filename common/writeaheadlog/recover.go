@@ -110,6 +110,10 @@ nextTxn:
 		if err != nil {
 			continue
 		}
+		// the checksum is valid, so the decryption fails only when the log file is tampered
+		if err = w.openOps(ops); err != nil {
+			return nil, fmt.Errorf("unable to decrypt transaction %d: %v", seq, err)
+		}
 		txn.Operations = ops
 
 		txns = append(txns, txn)
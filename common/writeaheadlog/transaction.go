@@ -83,7 +83,12 @@ func (w *Wal) NewTransaction(ops []Operation) (*Transaction, error) {
 func (t *Transaction) threadedInit() {
 	defer close(t.InitComplete)
 
-	data := marshalOps(t.Operations)
+	sealed, err := t.wal.sealOps(t.Operations)
+	if err != nil {
+		t.InitErr = fmt.Errorf("encrypting the operations failed: %v", err)
+		return
+	}
+	data := marshalOps(sealed)
 	if len(data) > maxHeadPagePayloadSize {
 		t.headPage = t.wal.requestPages(data[:maxHeadPagePayloadSize])
 		t.headPage.nextPage = t.wal.requestPages(data[maxHeadPagePayloadSize:])
@@ -140,11 +145,11 @@ func (t *Transaction) append(ops []Operation) (err error) {
 	}
 
 	// Marshal the data
-
-	data := marshalOps(ops)
+	sealed, err := t.wal.sealOps(ops)
 	if err != nil {
 		return err
 	}
+	data := marshalOps(sealed)
 
 	// Find last page, to which we will append
 	lastPage := t.headPage
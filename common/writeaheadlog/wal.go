@@ -8,6 +8,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"unsafe"
+
+	"github.com/DxChainNetwork/godx/crypto/twofishgcm"
 )
 
 var (
@@ -42,6 +44,9 @@ type (
 		logFile        file     // Log file
 		logPath        string   // path of the log file
 
+		// key is used to encrypt the data of the operations. nil means no encryption
+		key *twofishgcm.GCMCipherKey
+
 		// utils
 		utils utilsSet
 		wg    sync.WaitGroup // goroutine management
@@ -56,9 +61,16 @@ func New(path string) (*Wal, []*Transaction, error) {
 
 // newWal return a new Wal and committed transactions
 func newWal(path string, utils utilsSet) (w *Wal, txns []*Transaction, err error) {
+	return newEncryptedWal(path, utils, nil)
+}
+
+// newEncryptedWal return a new Wal encrypted with the key and committed transactions.
+// nil key means no encryption
+func newEncryptedWal(path string, utils utilsSet, key *twofishgcm.GCMCipherKey) (w *Wal, txns []*Transaction, err error) {
 	newWal := &Wal{
 		utils:   utils,
 		logPath: path,
+		key:     key,
 	}
 	ss := new(syncState)
 	ss.mu.Lock()
@@ -67,6 +79,9 @@ func newWal(path string, utils utilsSet) (w *Wal, txns []*Transaction, err error
 	// Read the log file
 	data, err := utils.readFile(path)
 	if err == nil {
+		if err = verifyEncryption(data, key); err != nil {
+			return nil, nil, fmt.Errorf("unable to open wal logFile: %v", err)
+		}
 		newWal.logFile, err = utils.openFile(path, os.O_RDWR, 0600)
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to open wal logFile: %v", err)
@@ -89,6 +104,9 @@ func newWal(path string, utils utilsSet) (w *Wal, txns []*Transaction, err error
 	if err = writeMetadata(newWal.logFile); err != nil {
 		return nil, nil, fmt.Errorf("cannot write metadata to logfile [%v]: %v", w.logPath, err)
 	}
+	if err = writeEncryption(newWal.logFile, key); err != nil {
+		return nil, nil, fmt.Errorf("cannot write encryption to logfile [%v]: %v", path, err)
+	}
 	return newWal, nil, nil
 }
 
@@ -115,6 +133,11 @@ func (w *Wal) CloseIncomplete() (int64, error) {
 	return atomic.LoadInt64(&w.numUnfinishedTxns), w.logFile.Close()
 }
 
+// NumUnfinishedTxns return the number of transactions created but not released yet
+func (w *Wal) NumUnfinishedTxns() int64 {
+	return atomic.LoadInt64(&w.numUnfinishedTxns)
+}
+
 // writeWALMetadata writes metadata with stateUnclean to the input file.
 func writeMetadata(f file) error {
 	// Create the metadata.
@@ -25,6 +25,7 @@ import (
 	"github.com/DxChainNetwork/godx/core/vm"
 	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/params"
+	"github.com/DxChainNetwork/godx/rlp"
 	"github.com/DxChainNetwork/godx/storage/coinchargemaintenance"
 )
 
@@ -66,6 +67,11 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
 	}
+	// Check the storage proofs of the block in batch
+	cfg.StorageProofResults = checkBlockStorageProofs(block, statedb)
+	// Check the storage contract revisions of the block in batch
+	cfg.RevisionResults = checkBlockRevisions(block, statedb)
+
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 		statedb.Prepare(tx.Hash(), block.Hash(), i)
@@ -87,6 +93,120 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	return receipts, allLogs, *usedGas, nil
 }
 
+// checkBlockStorageProofs checks the storage proofs in the block in batch against the state before
+// the transactions of the block are applied. The result is keyed by the hash of the transaction
+// data. A storage contract can be revised at the first height of its proof window, so the proofs
+// of the storage contracts revised in the same block are left to be checked when applied
+func checkBlockStorageProofs(block *types.Block, statedb *state.StateDB) vm.StorageProofResults {
+	var (
+		sps     []types.StorageProof
+		keys    []common.Hash
+		revised = make(map[common.Hash]struct{})
+	)
+	for _, tx := range block.Transactions() {
+		if tx.To() == nil {
+			continue
+		}
+		switch vm.PrecompiledStorageContracts[*tx.To()] {
+		case vm.CommitRevisionTransaction:
+			var scr types.StorageContractRevision
+			if err := rlp.DecodeBytes(tx.Data(), &scr); err == nil {
+				revised[scr.ParentID] = struct{}{}
+			}
+		case vm.StorageProofTransaction:
+			var sp types.StorageProof
+			if err := rlp.DecodeBytes(tx.Data(), &sp); err == nil {
+				sps = append(sps, sp)
+				keys = append(keys, crypto.Keccak256Hash(tx.Data()))
+			}
+		}
+	}
+	if len(sps) == 0 {
+		return nil
+	}
+	var (
+		batch     []types.StorageProof
+		batchKeys []common.Hash
+	)
+	for i, sp := range sps {
+		if _, exist := revised[sp.ParentID]; !exist {
+			batch, batchKeys = append(batch, sp), append(batchKeys, keys[i])
+		}
+	}
+	errs := vm.CheckStorageProofs(statedb, batch, block.NumberU64())
+	results := make(vm.StorageProofResults, len(batch))
+	for i, key := range batchKeys {
+		// the same proof submitted again is decided by the first one
+		if _, exist := results[key]; !exist {
+			results[key] = errs[i]
+		}
+	}
+	return results
+}
+
+// checkBlockRevisions checks the storage contract revisions in the block in batch against the state
+// before the transactions of the block are applied. The result is keyed by the hash of the transaction
+// data. The storage contracts created, proofed or revised more than once in the same block are left
+// to be checked when applied, since the state of the storage contract may be changed by the previous
+// transactions in the block
+func checkBlockRevisions(block *types.Block, statedb *state.StateDB) vm.RevisionResults {
+	var (
+		scrs    []types.StorageContractRevision
+		keys    []common.Hash
+		changed = make(map[common.Hash]struct{})
+		revised = make(map[common.Hash]struct{})
+	)
+	for _, tx := range block.Transactions() {
+		if tx.To() == nil {
+			continue
+		}
+		switch vm.PrecompiledStorageContracts[*tx.To()] {
+		case vm.ContractCreateTransaction:
+			var sc types.StorageContract
+			if err := rlp.DecodeBytes(tx.Data(), &sc); err == nil {
+				changed[sc.ID()] = struct{}{}
+			}
+		case vm.StorageProofTransaction:
+			var sp types.StorageProof
+			if err := rlp.DecodeBytes(tx.Data(), &sp); err == nil {
+				changed[sp.ParentID] = struct{}{}
+			}
+		case vm.CommitRevisionTransaction:
+			var scr types.StorageContractRevision
+			if err := rlp.DecodeBytes(tx.Data(), &scr); err != nil {
+				continue
+			}
+			// the storage contract revised more than once in the block is changed by the
+			// previous revision when the next one is applied
+			if _, exist := revised[scr.ParentID]; exist {
+				changed[scr.ParentID] = struct{}{}
+				continue
+			}
+			revised[scr.ParentID] = struct{}{}
+			scrs = append(scrs, scr)
+			keys = append(keys, crypto.Keccak256Hash(tx.Data()))
+		}
+	}
+	var (
+		batch     []types.StorageContractRevision
+		batchKeys []common.Hash
+	)
+	for i, scr := range scrs {
+		if _, exist := changed[scr.ParentID]; !exist {
+			batch, batchKeys = append(batch, scr), append(batchKeys, keys[i])
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	errs := vm.CheckRevisionContracts(statedb, batch, block.NumberU64())
+	results := make(vm.RevisionResults, len(batch))
+	for i, key := range batchKeys {
+		results[key] = errs[i]
+	}
+	return results
+}
+
 // ApplyTransaction attempts to apply a transaction to the given state database
 // and uses the input parameters for its environment. It returns the receipt
 // for the transaction, gas used and an error if the transaction failed,
@@ -5,11 +5,21 @@
 package types
 
 import (
+	"errors"
+	"io"
 	"math/big"
 
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/rlp"
 )
 
+// DefaultSegmentSize is the size of the merkle leaf of the file, which is the segment proved by
+// the storage proof, of the storage contract not declaring the segment size
+const DefaultSegmentSize = 64
+
+// errZeroSegmentSize is the error of decoding a storage contract declaring the zero segment size
+var errZeroSegmentSize = errors.New("rlp: storage contract declares zero segment size")
+
 type StorageContractRLPHash interface {
 	RLPHash() common.Hash
 }
@@ -41,6 +51,10 @@ type StorageContract struct {
 	WindowStart    uint64      `json:"windowstart"`
 	WindowEnd      uint64      `json:"windowend"`
 
+	// SegmentSize is the size of the merkle leaf of the file, which is the segment proved by
+	// the storage proof. Zero means DefaultSegmentSize
+	SegmentSize uint64 `json:"segmentsize"`
+
 	// money part
 	// original collateral
 	ClientCollateral DxcoinCollateral `json:"client_deposit"`
@@ -56,6 +70,24 @@ type StorageContract struct {
 	Signatures     [][]byte
 }
 
+// storageContractRLP is the RLP encoding of the StorageContract. The segment size is appended
+// only if it is not the default, so that the contracts using the default segment size are
+// encoded the same as before the segment size was introduced
+type storageContractRLP struct {
+	FileSize           uint64
+	FileMerkleRoot     common.Hash
+	WindowStart        uint64
+	WindowEnd          uint64
+	ClientCollateral   DxcoinCollateral
+	HostCollateral     DxcoinCollateral
+	ValidProofOutputs  []DxcoinCharge
+	MissedProofOutputs []DxcoinCharge
+	UnlockHash         common.Hash
+	RevisionNumber     uint64
+	Signatures         [][]byte
+	SegmentSize        []uint64 `rlp:"tail"`
+}
+
 type StorageContractRevision struct {
 	ParentID              common.Hash      `json:"parentid"`
 	UnlockConditions      UnlockConditions `json:"unlockconditions"`
@@ -72,7 +104,7 @@ type StorageContractRevision struct {
 
 type StorageProof struct {
 	ParentID  common.Hash   `json:"parentid"`
-	Segment   [64]byte      `json:"segment"`
+	Segment   []byte        `json:"segment"`
 	HashSet   []common.Hash `json:"hashset"`
 	Signature []byte
 }
@@ -84,9 +116,10 @@ func (ha HostAnnouncement) RLPHash() common.Hash {
 	})
 }
 
-// RLPHash calculate the hash of StorageContract
+// RLPHash calculate the hash of StorageContract. The segment size is hashed only if it is
+// not the default, so the hash of the contracts using the default segment size is unchanged
 func (sc StorageContract) RLPHash() common.Hash {
-	return rlpHash([]interface{}{
+	fields := []interface{}{
 		sc.FileSize,
 		sc.FileMerkleRoot,
 		sc.WindowStart,
@@ -96,7 +129,75 @@ func (sc StorageContract) RLPHash() common.Hash {
 		sc.ValidProofOutputs,
 		sc.MissedProofOutputs,
 		sc.RevisionNumber,
-	})
+	}
+	if sc.ProofSegmentSize() != DefaultSegmentSize {
+		fields = append(fields, sc.SegmentSize)
+	}
+	return rlpHash(fields)
+}
+
+// ProofSegmentSize returns the segment size declared by the storage contract, or the
+// DefaultSegmentSize if not declared
+func (sc StorageContract) ProofSegmentSize() uint64 {
+	if sc.SegmentSize == 0 {
+		return DefaultSegmentSize
+	}
+	return sc.SegmentSize
+}
+
+// EncodeRLP implements rlp.Encoder. The segment size is encoded only if it is not the default
+func (sc StorageContract) EncodeRLP(w io.Writer) error {
+	enc := storageContractRLP{
+		FileSize:           sc.FileSize,
+		FileMerkleRoot:     sc.FileMerkleRoot,
+		WindowStart:        sc.WindowStart,
+		WindowEnd:          sc.WindowEnd,
+		ClientCollateral:   sc.ClientCollateral,
+		HostCollateral:     sc.HostCollateral,
+		ValidProofOutputs:  sc.ValidProofOutputs,
+		MissedProofOutputs: sc.MissedProofOutputs,
+		UnlockHash:         sc.UnlockHash,
+		RevisionNumber:     sc.RevisionNumber,
+		Signatures:         sc.Signatures,
+	}
+	if sc.ProofSegmentSize() != DefaultSegmentSize {
+		enc.SegmentSize = []uint64{sc.SegmentSize}
+	}
+	return rlp.Encode(w, &enc)
+}
+
+// DecodeRLP implements rlp.Decoder. The contract encoded without the segment size uses the
+// default segment size, and the contract declaring the zero segment size is rejected
+func (sc *StorageContract) DecodeRLP(s *rlp.Stream) error {
+	var dec storageContractRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	var segmentSize uint64
+	switch len(dec.SegmentSize) {
+	case 0:
+	case 1:
+		if segmentSize = dec.SegmentSize[0]; segmentSize == 0 {
+			return errZeroSegmentSize
+		}
+	default:
+		return errors.New("rlp: input list has too many elements for types.StorageContract")
+	}
+	*sc = StorageContract{
+		FileSize:           dec.FileSize,
+		FileMerkleRoot:     dec.FileMerkleRoot,
+		WindowStart:        dec.WindowStart,
+		WindowEnd:          dec.WindowEnd,
+		SegmentSize:        segmentSize,
+		ClientCollateral:   dec.ClientCollateral,
+		HostCollateral:     dec.HostCollateral,
+		ValidProofOutputs:  dec.ValidProofOutputs,
+		MissedProofOutputs: dec.MissedProofOutputs,
+		UnlockHash:         dec.UnlockHash,
+		RevisionNumber:     dec.RevisionNumber,
+		Signatures:         dec.Signatures,
+	}
+	return nil
 }
 
 // ID calculate the ID of StorageContract
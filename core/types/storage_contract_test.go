@@ -0,0 +1,132 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/rlp"
+)
+
+// legacyStorageContract is the storage contract before the segment size was introduced
+type legacyStorageContract struct {
+	FileSize           uint64
+	FileMerkleRoot     common.Hash
+	WindowStart        uint64
+	WindowEnd          uint64
+	ClientCollateral   DxcoinCollateral
+	HostCollateral     DxcoinCollateral
+	ValidProofOutputs  []DxcoinCharge
+	MissedProofOutputs []DxcoinCharge
+	UnlockHash         common.Hash
+	RevisionNumber     uint64
+	Signatures         [][]byte
+}
+
+func mockStorageContract() StorageContract {
+	return StorageContract{
+		FileSize:           1 << 22,
+		FileMerkleRoot:     common.HexToHash("0x1234"),
+		WindowStart:        100,
+		WindowEnd:          200,
+		ClientCollateral:   DxcoinCollateral{DxcoinCharge{Address: common.HexToAddress("0x1"), Value: big.NewInt(10)}},
+		HostCollateral:     DxcoinCollateral{DxcoinCharge{Address: common.HexToAddress("0x2"), Value: big.NewInt(20)}},
+		ValidProofOutputs:  []DxcoinCharge{{Address: common.HexToAddress("0x1"), Value: big.NewInt(10)}},
+		MissedProofOutputs: []DxcoinCharge{{Address: common.HexToAddress("0x2"), Value: big.NewInt(20)}},
+		UnlockHash:         common.HexToHash("0x5678"),
+		RevisionNumber:     1,
+		Signatures:         [][]byte{{1, 2, 3}, {4, 5, 6}},
+	}
+}
+
+// TestStorageContract_DefaultSegmentSize test the contract using the default segment size is
+// encoded and hashed the same as before the segment size was introduced
+func TestStorageContract_DefaultSegmentSize(t *testing.T) {
+	for _, segmentSize := range []uint64{0, DefaultSegmentSize} {
+		sc := mockStorageContract()
+		sc.SegmentSize = segmentSize
+		legacy := legacyStorageContract{sc.FileSize, sc.FileMerkleRoot, sc.WindowStart, sc.WindowEnd,
+			sc.ClientCollateral, sc.HostCollateral, sc.ValidProofOutputs, sc.MissedProofOutputs,
+			sc.UnlockHash, sc.RevisionNumber, sc.Signatures}
+
+		enc, err := rlp.EncodeToBytes(sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacyEnc, err := rlp.EncodeToBytes(legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, legacyEnc) {
+			t.Errorf("segment size %v: encoding changed\n got %x\nwant %x", segmentSize, enc, legacyEnc)
+		}
+
+		legacyID := rlpHash([]interface{}{legacy.FileSize, legacy.FileMerkleRoot, legacy.WindowStart,
+			legacy.WindowEnd, legacy.ClientCollateral, legacy.HostCollateral, legacy.ValidProofOutputs,
+			legacy.MissedProofOutputs, legacy.RevisionNumber})
+		if sc.ID() != legacyID {
+			t.Errorf("segment size %v: id changed, got %x, want %x", segmentSize, sc.ID(), legacyID)
+		}
+
+		// the legacy encoding is decoded with the default segment size
+		var decoded StorageContract
+		if err := rlp.DecodeBytes(legacyEnc, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.SegmentSize != 0 || decoded.ProofSegmentSize() != DefaultSegmentSize {
+			t.Errorf("expect the default segment size decoded, got %v", decoded.SegmentSize)
+		}
+	}
+}
+
+// TestStorageContract_SegmentSizeRLP test the declared segment size is round tripped and
+// changes the contract id, and the zero segment size declared is rejected
+func TestStorageContract_SegmentSizeRLP(t *testing.T) {
+	sc := mockStorageContract()
+	sc.SegmentSize = 256
+	enc, err := rlp.EncodeToBytes(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded StorageContract
+	if err := rlp.DecodeBytes(enc, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, sc) {
+		t.Errorf("round trip mismatch\n got %+v\nwant %+v", decoded, sc)
+	}
+	if sc.ID() == mockStorageContract().ID() {
+		t.Errorf("the segment size is not covered by the contract id")
+	}
+
+	// the segment size declared as zero, and more than one segment size declared
+	for _, tail := range [][]uint64{{0}, {256, 256}} {
+		malformed := storageContractRLP{
+			FileSize:           sc.FileSize,
+			FileMerkleRoot:     sc.FileMerkleRoot,
+			WindowStart:        sc.WindowStart,
+			WindowEnd:          sc.WindowEnd,
+			ClientCollateral:   sc.ClientCollateral,
+			HostCollateral:     sc.HostCollateral,
+			ValidProofOutputs:  sc.ValidProofOutputs,
+			MissedProofOutputs: sc.MissedProofOutputs,
+			UnlockHash:         sc.UnlockHash,
+			RevisionNumber:     sc.RevisionNumber,
+			Signatures:         sc.Signatures,
+			SegmentSize:        tail,
+		}
+		enc, err := rlp.EncodeToBytes(&malformed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rlp.DecodeBytes(enc, new(StorageContract)); err == nil {
+			t.Errorf("segment size %v: expect the decoding to fail", tail)
+		}
+	}
+}
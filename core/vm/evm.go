@@ -567,6 +567,27 @@ func (evm *EVM) CreateContractTx(caller ContractRef, data []byte, gas uint64) ([
 		return nil, gasRemainDecode, errDecode
 	}
 
+	// the segment size is declared only after the storage segment size fork, since the nodes
+	// before the fork cannot decode the storage contract declaring it
+	if sc.SegmentSize != 0 && !evm.chainConfig.IsStorageSegmentSize(evm.BlockNumber) {
+		return nil, gasRemainDecode, errSegmentSizeNotActivated
+	}
+
+	// the host collateral floor is enforced only after the storage collateral fork, so that the
+	// storage contracts accepted before the fork are still valid when the chain is resynced
+	if minPercentage := evm.chainConfig.MinHostCollateral(evm.BlockNumber); minPercentage != 0 {
+		if err := CheckHostCollateral(sc.ClientCollateral.Value, sc.HostCollateral.Value, minPercentage); err != nil {
+			return nil, gasRemainDecode, err
+		}
+	}
+
+	// the window end is bounded only after the storage duration fork, as the host collateral floor
+	if maxDuration := evm.chainConfig.MaxContractDuration(evm.BlockNumber); maxDuration != 0 {
+		if err := CheckContractDuration(sc.WindowEnd, evm.BlockNumber.Uint64(), maxDuration); err != nil {
+			return nil, gasRemainDecode, err
+		}
+	}
+
 	// create the expired storage contract status address (e.g. "expired_storage_contract_1500")
 	windowEndStr := strconv.FormatUint(sc.WindowEnd, 10)
 	statusAddr := common.BytesToAddress([]byte(coinchargemaintenance.StrPrefixExpSC + windowEndStr))
@@ -627,6 +648,13 @@ func (evm *EVM) CreateContractTx(caller ContractRef, data []byte, gas uint64) ([
 	uintBytes := Uint64ToBytes(sc.FileSize)
 	stateDB.SetState(contractAddr, coinchargemaintenance.KeyFileSize, common.BytesToHash(uintBytes))
 
+	// the segment size is stored only if it is not the default, so that the state of the
+	// contracts using the default segment size is unchanged
+	if segmentSize := sc.ProofSegmentSize(); segmentSize != types.DefaultSegmentSize {
+		uintBytes = Uint64ToBytes(segmentSize)
+		stateDB.SetState(contractAddr, coinchargemaintenance.KeySegmentSize, common.BytesToHash(uintBytes))
+	}
+
 	stateDB.SetState(contractAddr, coinchargemaintenance.KeyUnlockHash, sc.UnlockHash)
 	stateDB.SetState(contractAddr, coinchargemaintenance.KeyFileMerkleRoot, sc.FileMerkleRoot)
 
@@ -670,10 +698,16 @@ func (evm *EVM) CommitRevisionTx(caller ContractRef, data []byte, gas uint64) ([
 		return nil, gasRemainDecode, errors.New("no this storage contract account")
 	}
 
-	// check storage contract reversion and calculate gas used
+	// check the window end of the revision is bounded after the storage duration fork
 	currentHeight := evm.BlockNumber.Uint64()
-	gasRemainCheck, resultCheck := RemainGas(gasRemainDecode, CheckRevisionContract, stateDB, scr, uint64(currentHeight), contractAddr)
-	errCheck, _ := resultCheck[0].(error)
+	if maxDuration := evm.chainConfig.MaxContractDuration(evm.BlockNumber); maxDuration != 0 {
+		if err := CheckContractDuration(scr.NewWindowEnd, currentHeight, maxDuration); err != nil {
+			return nil, gasRemainDecode, err
+		}
+	}
+
+	// check storage contract reversion and calculate gas used
+	gasRemainCheck, errCheck := evm.checkRevision(gasRemainDecode, data, scr, currentHeight, contractAddr)
 	if errCheck != nil {
 		log.Error("Failed to check storage contract revision", "err", errCheck)
 		return nil, gasRemainCheck, errCheck
@@ -731,8 +765,7 @@ func (evm *EVM) StorageProofTx(caller ContractRef, data []byte, gas uint64) ([]b
 	windowEndStr := strconv.FormatUint(windowEnd, 10)
 	statusAddr := common.BytesToAddress([]byte(coinchargemaintenance.StrPrefixExpSC + windowEndStr))
 
-	gasRemainCheck, resultCheck := RemainGas(gasRemainDec, CheckStorageProof, stateDB, sp, uint64(currentHeight), statusAddr, contractAddr)
-	errCheck, _ := resultCheck[0].(error)
+	gasRemainCheck, errCheck := evm.checkStorageProof(gasRemainDec, data, sp, currentHeight, statusAddr, contractAddr)
 	if errCheck != nil {
 		return nil, gasRemainCheck, errCheck
 	}
@@ -761,6 +794,43 @@ func (evm *EVM) StorageProofTx(caller ContractRef, data []byte, gas uint64) ([]b
 	return nil, gasRemainCheck, nil
 }
 
+// checkRevision checks the storage contract revision and calculates the gas used. The result
+// checked in batch before the transactions of the block are applied is used if there is one
+func (evm *EVM) checkRevision(gas uint64, data []byte, scr types.StorageContractRevision, currentHeight uint64, contractAddr common.Address) (uint64, error) {
+	result, exist := evm.vmConfig.RevisionResults[crypto.Keccak256Hash(data)]
+	if !exist {
+		gasRemain, resultCheck := RemainGas(gas, CheckRevisionContract, evm.StateDB, scr, currentHeight, contractAddr)
+		err, _ := resultCheck[0].(error)
+		return gasRemain, err
+	}
+	if gas < params.CheckFileGas {
+		return gas, errGasCalculationInsufficient
+	}
+	return gas - params.CheckFileGas, result
+}
+
+// checkStorageProof checks the storage proof and calculates the gas used. The result checked in
+// batch before the transactions of the block are applied is used if there is one. The proofs
+// rejected in batch as duplicated or for the storage contract not existing yet are checked again
+// against the current state, and whether the storage contract has been proofed by a previous
+// transaction in the block is always checked against the current state
+func (evm *EVM) checkStorageProof(gas uint64, data []byte, sp types.StorageProof, currentHeight uint64, statusAddr common.Address, contractAddr common.Address) (uint64, error) {
+	result, exist := evm.vmConfig.StorageProofResults[crypto.Keccak256Hash(data)]
+	if !exist || result == errDuplicateStorageProof || result == errNoStorageContract {
+		gasRemain, resultCheck := RemainGas(gas, CheckStorageProof, evm.StateDB, sp, currentHeight, statusAddr, contractAddr)
+		err, _ := resultCheck[0].(error)
+		return gasRemain, err
+	}
+	if gas < params.CheckFileGas {
+		return gas, errGasCalculationInsufficient
+	}
+	gas -= params.CheckFileGas
+	if err := checkStorageProofStatus(evm.StateDB, sp, statusAddr); err != nil {
+		return gas, err
+	}
+	return gas, result
+}
+
 // Uint64ToBytes convert uint64 to bytes
 func Uint64ToBytes(i uint64) []byte {
 	var buf = make([]byte, 8)
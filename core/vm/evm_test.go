@@ -468,6 +468,187 @@ func TestEVM_CreateContractTx(t *testing.T) {
 	}
 }
 
+// TestEVM_CreateContractTx_SegmentSizeFork test the storage contract declaring the segment
+// size is rejected before the storage segment size fork, and accepted after the fork
+func TestEVM_CreateContractTx_SegmentSizeFork(t *testing.T) {
+	evm, stateDB, prvAndAddresses, err := mockEvmAndState(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := mockStorageContract(prvAndAddresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.SegmentSize = 256
+	if err = resignStorageContract(sc, prvAndAddresses); err != nil {
+		t.Fatal(err)
+	}
+	rlpBytes, err := rlp.EncodeToBytes(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = evm.CreateContractTx(AccountRef{}, rlpBytes, gasOrigin); err != errSegmentSizeNotActivated {
+		t.Fatalf("expect error %v before the fork, got %v", errSegmentSizeNotActivated, err)
+	}
+
+	config := *params.MainnetChainConfig
+	config.StorageSegmentSizeBlock = big.NewInt(1000)
+	evm.chainConfig = &config
+	if _, _, err = evm.CreateContractTx(AccountRef{}, rlpBytes, gasOrigin); err != nil {
+		t.Fatalf("failed to execute storage contract tx after the fork: %v", err)
+	}
+	scID := sc.ID()
+	segmentSizeHash := stateDB.GetState(common.BytesToAddress(scID[12:]), coinchargemaintenance.KeySegmentSize)
+	if segmentSize := new(big.Int).SetBytes(segmentSizeHash.Bytes()).Uint64(); segmentSize != sc.SegmentSize {
+		t.Errorf("write wrong segment size into state, wanted %v, getted %v", sc.SegmentSize, segmentSize)
+	}
+}
+
+// TestEVM_CreateContractTx_StorageCollateralFork test the storage contract with a negligible
+// host collateral is accepted before the storage collateral fork, and rejected after the fork
+func TestEVM_CreateContractTx_StorageCollateralFork(t *testing.T) {
+	evm, _, prvAndAddresses, err := mockEvmAndState(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newContract := func() []byte {
+		sc, err := mockStorageContract(prvAndAddresses)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, host := sc.ClientCollateral.Value, big.NewInt(1)
+		sc.HostCollateral.Value = host
+		outputs := []types.DxcoinCharge{
+			{Address: sc.ClientCollateral.Address, Value: client},
+			{Address: sc.HostCollateral.Address, Value: host},
+		}
+		sc.ValidProofOutputs, sc.MissedProofOutputs = outputs, outputs
+		if err = resignStorageContract(sc, prvAndAddresses); err != nil {
+			t.Fatal(err)
+		}
+		rlpBytes, err := rlp.EncodeToBytes(sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rlpBytes
+	}
+
+	if _, _, err = evm.CreateContractTx(AccountRef{}, newContract(), gasOrigin); err != nil {
+		t.Fatalf("failed to execute storage contract tx before the fork: %v", err)
+	}
+
+	config := *params.MainnetChainConfig
+	config.StorageCollateralBlock = big.NewInt(1000)
+	evm.chainConfig = &config
+	if _, _, err = evm.CreateContractTx(AccountRef{}, newContract(), gasOrigin); err != errInsufficientHostCollateral {
+		t.Fatalf("expect error %v after the fork, got %v", errInsufficientHostCollateral, err)
+	}
+}
+
+// TestEVM_CommitRevisionTx_RevisionResults test the result of the revision checked in batch is
+// used by the revision transaction, and the revision not checked in batch is checked when applied
+func TestEVM_CommitRevisionTx_RevisionResults(t *testing.T) {
+	evm, stateDB, prvAndAddresses, err := mockEvmAndState(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := mockStorageContract(prvAndAddresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockWriteStorageContractIntoState(*sc, stateDB)
+	scr, err := mockStorageRevision(*sc, cost, prvAndAddresses[0].Privkey, prvAndAddresses[1].Privkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rlpBytes, err := rlp.EncodeToBytes(scr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evm.vmConfig.RevisionResults = RevisionResults{crypto.Keccak256Hash(rlpBytes): errLateRevision}
+	_, gasLeft, err := evm.CommitRevisionTx(AccountRef{}, rlpBytes, gasOrigin)
+	if err != errLateRevision {
+		t.Fatalf("expect the batch result %v, got %v", errLateRevision, err)
+	}
+	if gasLeft != gasOrigin-params.DecodeGas-params.CheckFileGas {
+		t.Errorf("gas left not expected. Got %v, Expect %v", gasLeft, gasOrigin-params.DecodeGas-params.CheckFileGas)
+	}
+
+	evm.vmConfig.RevisionResults = RevisionResults{}
+	if _, _, err = evm.CommitRevisionTx(AccountRef{}, rlpBytes, gasOrigin); err != nil {
+		t.Fatalf("failed to execute the revision not checked in batch: %v", err)
+	}
+}
+
+// TestEVM_StorageDurationFork test the storage contract and revision with the window end beyond the
+// max contract duration are accepted before the storage duration fork, and rejected after the fork
+func TestEVM_StorageDurationFork(t *testing.T) {
+	evm, stateDB, prvAndAddresses, err := mockEvmAndState(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preFork := evm.chainConfig
+	config := *params.MainnetChainConfig
+	config.StorageDurationBlock = big.NewInt(1000)
+	postFork := &config
+	windowEnd := 1000 + params.DefaultMaxContractDuration + 1
+
+	// the storage contract creation
+	sc, err := mockStorageContract(prvAndAddresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.WindowEnd = windowEnd
+	if err = resignStorageContract(sc, prvAndAddresses); err != nil {
+		t.Fatal(err)
+	}
+	rlpBytes, err := rlp.EncodeToBytes(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evm.chainConfig = postFork
+	if _, _, err = evm.CreateContractTx(AccountRef{}, rlpBytes, gasOrigin); err != errStorageContractDurationViolation {
+		t.Fatalf("expect error %v creating the storage contract after the fork, got %v", errStorageContractDurationViolation, err)
+	}
+	evm.chainConfig = preFork
+	if _, _, err = evm.CreateContractTx(AccountRef{}, rlpBytes, gasOrigin); err != nil {
+		t.Fatalf("failed to create the storage contract before the fork: %v", err)
+	}
+
+	// the storage contract revision extending the window end
+	sc, err = mockStorageContract(prvAndAddresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockWriteStorageContractIntoState(*sc, stateDB)
+	prvKeyClient, prvKeyHost := prvAndAddresses[0].Privkey, prvAndAddresses[1].Privkey
+	scr, err := mockStorageRevision(*sc, cost, prvKeyClient, prvKeyHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scr.NewWindowEnd = windowEnd
+	hash := scr.RLPHash().Bytes()
+	if scr.Signatures[0], err = crypto.Sign(hash, prvKeyClient); err != nil {
+		t.Fatal(err)
+	}
+	if scr.Signatures[1], err = crypto.Sign(hash, prvKeyHost); err != nil {
+		t.Fatal(err)
+	}
+	if rlpBytes, err = rlp.EncodeToBytes(scr); err != nil {
+		t.Fatal(err)
+	}
+	evm.chainConfig = postFork
+	if _, _, err = evm.CommitRevisionTx(AccountRef{}, rlpBytes, gasOrigin); err != errStorageContractDurationViolation {
+		t.Fatalf("expect error %v revising the storage contract after the fork, got %v", errStorageContractDurationViolation, err)
+	}
+	evm.chainConfig = preFork
+	if _, _, err = evm.CommitRevisionTx(AccountRef{}, rlpBytes, gasOrigin); err != nil {
+		t.Fatalf("failed to revise the storage contract before the fork: %v", err)
+	}
+}
+
 func TestEVM_CommitRevisionTx(t *testing.T) {
 
 	// mock evm, state, client and host address ...
@@ -824,6 +1005,11 @@ func mockWriteStorageContractIntoState(sc types.StorageContract, state *state.St
 	uintBytes := Uint64ToBytes(sc.FileSize)
 	state.SetState(contractAddr, coinchargemaintenance.KeyFileSize, common.BytesToHash(uintBytes))
 
+	if segmentSize := sc.ProofSegmentSize(); segmentSize != types.DefaultSegmentSize {
+		uintBytes = Uint64ToBytes(segmentSize)
+		state.SetState(contractAddr, coinchargemaintenance.KeySegmentSize, common.BytesToHash(uintBytes))
+	}
+
 	state.SetState(contractAddr, coinchargemaintenance.KeyUnlockHash, sc.UnlockHash)
 	state.SetState(contractAddr, coinchargemaintenance.KeyFileMerkleRoot, sc.FileMerkleRoot)
 
@@ -846,7 +1032,7 @@ func mockWriteStorageContractIntoState(sc types.StorageContract, state *state.St
 func mockStorageProof(prvKeyHost *ecdsa.PrivateKey, parentID common.Hash) (*types.StorageProof, error) {
 	sp := &types.StorageProof{
 		ParentID: parentID,
-		Segment:  [64]byte{},
+		Segment:  make([]byte, 64),
 	}
 
 	sig, err := crypto.Sign(sp.RLPHash().Bytes(), prvKeyHost)
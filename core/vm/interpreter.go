@@ -46,6 +46,14 @@ type Config struct {
 	EWASMInterpreter string
 	// Type of the EVM interpreter
 	EVMInterpreter string
+
+	// StorageProofResults is the results of the storage proofs in the block checked in
+	// batch before the transactions of the block are applied. It may be nil
+	StorageProofResults StorageProofResults
+
+	// RevisionResults is the results of the storage contract revisions in the block checked in
+	// batch before the transactions of the block are applied. It may be nil
+	RevisionResults RevisionResults
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -0,0 +1,38 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package vm
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// pubkeyCacheSize is the max number of the recovered public keys cached
+const pubkeyCacheSize = 4096
+
+// pubkeyCache memoizes the public keys recovered from the signatures of the storage contract
+// transactions, so that the same signed object validated multiple times, e.g. when the
+// transaction is added to the pool and then verified in the block, is recovered only once.
+// The lru cache is safe for concurrent use
+var pubkeyCache, _ = lru.New(pubkeyCacheSize)
+
+// recoverPubkey recovers the public key from the signature of the data hash. The public key
+// recovered is cached by the data hash and signature, and shall not be modified by the caller.
+// The signature failed to recover is not cached
+func recoverPubkey(dataHash common.Hash, sig []byte) (*ecdsa.PublicKey, error) {
+	key := string(dataHash[:]) + string(sig)
+	if pubkey, exist := pubkeyCache.Get(key); exist {
+		return pubkey.(*ecdsa.PublicKey), nil
+	}
+	pubkey, err := crypto.SigToPub(dataHash.Bytes(), sig)
+	if err != nil {
+		return nil, err
+	}
+	pubkeyCache.Add(key, pubkey)
+	return pubkey, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto"
+)
+
+// TestRecoverPubkey test the public key recovered is cached by the data hash and signature,
+// and the signature failed to recover is not cached
+func TestRecoverPubkey(t *testing.T) {
+	pubkeyCache.Purge()
+	prvKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := common.HexToHash("0x1234")
+	sig, err := crypto.Sign(hash.Bytes(), prvKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubkey, err := recoverPubkey(hash, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*pubkey, prvKey.PublicKey) {
+		t.Fatalf("public key recovered not expected")
+	}
+	cached, err := recoverPubkey(hash, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != pubkey || pubkeyCache.Len() != 1 {
+		t.Errorf("public key not recovered from the cache, %v keys cached", pubkeyCache.Len())
+	}
+
+	// the same signature of another hash recovers another public key
+	otherHash := common.HexToHash("0x5678")
+	other, err := recoverPubkey(otherHash, sig)
+	if err == nil && reflect.DeepEqual(*other, prvKey.PublicKey) {
+		t.Errorf("the public key cached is recovered for another hash")
+	}
+
+	// the malformed signature is not cached
+	numCached := pubkeyCache.Len()
+	if _, err := recoverPubkey(hash, sig[:10]); err == nil {
+		t.Errorf("malformed signature recovered")
+	}
+	if pubkeyCache.Len() != numCached {
+		t.Errorf("malformed signature cached")
+	}
+}
+
+// TestRecoverPubkey_Concurrent test the public keys are recovered correctly from the cache
+// shared by the goroutines
+func TestRecoverPubkey_Concurrent(t *testing.T) {
+	pubkeyCache.Purge()
+	prvKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []common.Hash
+	var sigs [][]byte
+	for i := 0; i != 16; i++ {
+		hash := common.BytesToHash([]byte{byte(i + 1)})
+		sig, err := crypto.Sign(hash.Bytes(), prvKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes, sigs = append(hashes, hash), append(sigs, sig)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*len(sigs))
+	for g := 0; g != 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range sigs {
+				pubkey, err := recoverPubkey(hashes[i], sigs[i])
+				if err == nil && !reflect.DeepEqual(*pubkey, prvKey.PublicKey) {
+					err = fmt.Errorf("public key of signature %d not expected", i)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("public key not recovered: %v", err)
+	}
+	if pubkeyCache.Len() != len(sigs) {
+		t.Errorf("expect %v public keys cached, got %v", len(sigs), pubkeyCache.Len())
+	}
+}
+
+// BenchmarkCheckRevisionContracts_NoPubkeyCache validates the same batch of revisions as
+// BenchmarkCheckRevisionContracts with the public key cache purged before each validation,
+// which is the cost of the validation without the cache
+func BenchmarkCheckRevisionContracts_NoPubkeyCache(b *testing.B) {
+	stateDB, scrs, err := mockRevisionBatch(10, 20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pubkeyCache.Purge()
+		CheckRevisionContracts(stateDB, scrs, 1000)
+	}
+}
@@ -38,10 +38,21 @@ var (
 	errLowRevisionNumber                       = errors.New("transaction has a storage contract with an outdated revision number")
 	errRevisionValidPayouts                    = errors.New("storage contract revision has altered valid payout")
 	errRevisionMissedPayouts                   = errors.New("storage contract revision has altered missed payout")
+	errRevisionOutputCount                     = errors.New("storage contract revision must have exactly 2 valid and missed proof outputs")
+	errRevisionClientPayout                    = errors.New("storage contract revision has increased client payout")
+	errRevisionHostPayout                      = errors.New("storage contract revision has decreased host valid payout or increased host missed payout")
+	errRevisionClientMissedPayout              = errors.New("storage contract revision has client missed payout not deducted by the amount paid")
 	errWrongUnlockCondition                    = errors.New("the unlock hash of storage contract not match unlock condition")
 	errNoStorageContractType                   = errors.New("no this storage contract type")
 	errInvalidStorageProof                     = errors.New("invalid storage proof")
 	errUnfinishedStorageContract               = errors.New("storage contract has not yet opened")
+	errNoStorageContract                       = errors.New("no this storage contract account")
+	errInvalidSegmentSize                      = errors.New("storage contract segment size must be a power of two no larger than the sector size")
+	errSegmentSizeNotActivated                 = errors.New("storage contract segment size declared before the storage segment size fork")
+	errDuplicateStorageProof                   = errors.New("duplicate storage proof of the storage contract in the batch")
+	errStorageProofSegmentLength               = errors.New("storage proof segment length does not match the segment size of the storage contract")
+	errInsufficientHostCollateral              = errors.New("storage contract host collateral is below the minimum fraction of the payout")
+	errStorageContractDurationViolation        = errors.New("storage contract window end is more than the max contract duration into the future")
 )
 
 // CheckCreateContract checks whether a new StorageContract is valid
@@ -61,6 +72,12 @@ func CheckCreateContract(state StateDB, sc types.StorageContract, currentHeight
 		return errStorageContractWindowEndViolation
 	}
 
+	// check that the segment size is a power of two, so that the segments are aligned to the
+	// sectors. The zero segment size is not declared, and the default is used
+	if segmentSize := sc.ProofSegmentSize(); segmentSize&(segmentSize-1) != 0 || segmentSize > merkle.SectorSize {
+		return errInvalidSegmentSize
+	}
+
 	// check that the proof outputs sum to the payout
 	validProofOutputSum := new(big.Int).SetInt64(0)
 	missedProofOutputSum := new(big.Int).SetInt64(0)
@@ -115,8 +132,89 @@ func CheckCreateContract(state StateDB, sc types.StorageContract, currentHeight
 	return nil
 }
 
+// CheckContractDuration checks that the window end of the storage contract or its revision is no
+// more than maxDuration blocks after the current height
+func CheckContractDuration(windowEnd, currentHeight, maxDuration uint64) error {
+	if windowEnd > currentHeight && windowEnd-currentHeight > maxDuration {
+		return errStorageContractDurationViolation
+	}
+	return nil
+}
+
+// CheckHostCollateral checks that the host collateral takes at least minPercentage percent of the
+// payout of the storage contract, which is the sum of the client and host collateral
+func CheckHostCollateral(clientCollateral, hostCollateral *big.Int, minPercentage uint64) error {
+	payout := new(big.Int).Add(clientCollateral, hostCollateral)
+	minHostCollateral := new(big.Int).Mul(payout, new(big.Int).SetUint64(minPercentage))
+	if new(big.Int).Mul(hostCollateral, big.NewInt(100)).Cmp(minHostCollateral) < 0 {
+		return errInsufficientHostCollateral
+	}
+	return nil
+}
+
+// revisionParent is the information of the parent storage contract stored in state, which
+// is needed to validate a StorageContractRevision
+type revisionParent struct {
+	windowStart    uint64
+	revisionNumber uint64
+	unlockHash     common.Hash
+	validPayout    *big.Int
+	missedPayout   *big.Int
+
+	// the individual payouts of the client and the host
+	clientValid  *big.Int
+	hostValid    *big.Int
+	clientMissed *big.Int
+	hostMissed   *big.Int
+}
+
 // CheckRevisionContract checks whether a new StorageContractRevision is valid
 func CheckRevisionContract(state StateDB, scr types.StorageContractRevision, currentHeight uint64, contractAddr common.Address) error {
+	validProofOutputSum, missedProofOutputSum, err := checkRevisionWithoutParent(state, scr, currentHeight)
+	if err != nil {
+		return err
+	}
+
+	// retrieve origin storage contract
+	parent := retrieveRevisionParent(state, contractAddr)
+	return checkRevisionWithParent(scr, parent, validProofOutputSum, missedProofOutputSum, currentHeight)
+}
+
+// RevisionResults maps the hash of the storage contract revision transaction data to the result
+// of checking the revision by CheckRevisionContracts
+type RevisionResults map[common.Hash]error
+
+// CheckRevisionContracts checks a batch of StorageContractRevisions against the same state.
+// The parent storage contract is retrieved from state only once for all revisions with the
+// same ParentID. The returned errors are in the same order as the revisions, and each of them
+// is the same as the result of CheckRevisionContract on the revision
+func CheckRevisionContracts(state StateDB, scrs []types.StorageContractRevision, currentHeight uint64) []error {
+	errs := make([]error, len(scrs))
+	parents := make(map[common.Hash]revisionParent)
+
+	for i, scr := range scrs {
+		validProofOutputSum, missedProofOutputSum, err := checkRevisionWithoutParent(state, scr, currentHeight)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		// retrieve origin storage contract from the cache first
+		parent, exist := parents[scr.ParentID]
+		if !exist {
+			contractAddr := common.BytesToAddress(scr.ParentID.Bytes()[12:])
+			parent = retrieveRevisionParent(state, contractAddr)
+			parents[scr.ParentID] = parent
+		}
+		errs[i] = checkRevisionWithParent(scr, parent, validProofOutputSum, missedProofOutputSum, currentHeight)
+	}
+	return errs
+}
+
+// checkRevisionWithoutParent checks the StorageContractRevision fields that do not depend on the
+// parent storage contract, including the signatures. The sum of the valid proof outputs and missed
+// proof outputs are returned
+func checkRevisionWithoutParent(state StateDB, scr types.StorageContractRevision, currentHeight uint64) (*big.Int, *big.Int, error) {
 
 	// check whether it has proofed
 	windowEndStr := strconv.FormatUint(scr.NewWindowEnd, 10)
@@ -125,15 +223,15 @@ func CheckRevisionContract(state StateDB, scr types.StorageContractRevision, cur
 	statusContent := state.GetState(statusAddr, scr.ParentID)
 	flag := statusContent.Bytes()[11:12]
 	if bytes.Equal(flag, coinchargemaintenance.ProofedStatus) {
-		return errors.New("can not do contract revision after storage proof")
+		return nil, nil, errors.New("can not do contract revision after storage proof")
 	}
 
 	// check that start and expiration are reasonable values.
 	if scr.NewWindowStart <= currentHeight {
-		return errStorageContractWindowStartViolation
+		return nil, nil, errStorageContractWindowStartViolation
 	}
 	if scr.NewWindowEnd <= scr.NewWindowStart {
-		return errStorageContractWindowEndViolation
+		return nil, nil, errStorageContractWindowEndViolation
 	}
 
 	// check that the valid outputs and missed outputs sum whether are the same
@@ -141,27 +239,30 @@ func CheckRevisionContract(state StateDB, scr types.StorageContractRevision, cur
 	missedProofOutputSum := new(big.Int).SetInt64(0)
 	for _, output := range scr.NewValidProofOutputs {
 		if output.Value.Sign() <= 0 {
-			return errZeroOutput
+			return nil, nil, errZeroOutput
 		}
 		validProofOutputSum = validProofOutputSum.Add(validProofOutputSum, output.Value)
 	}
 	for _, output := range scr.NewMissedProofOutputs {
 		if output.Value.Sign() <= 0 {
-			return errZeroOutput
+			return nil, nil, errZeroOutput
 		}
 		missedProofOutputSum = missedProofOutputSum.Add(missedProofOutputSum, output.Value)
 	}
 
 	// validProofOutputSum must be greater or equal to missedProofOutputSum
 	if validProofOutputSum.Cmp(missedProofOutputSum) < 0 {
-		return errRevisionOutputSumViolation
+		return nil, nil, errRevisionOutputSumViolation
 	}
 
 	if err := CheckMultiSignatures(scr, scr.Signatures); err != nil {
-		return err
+		return nil, nil, err
 	}
+	return validProofOutputSum, missedProofOutputSum, nil
+}
 
-	// retrieve origin storage contract
+// retrieveRevisionParent retrieves the parent storage contract information from state
+func retrieveRevisionParent(state StateDB, contractAddr common.Address) revisionParent {
 	windowStartHash := state.GetState(contractAddr, coinchargemaintenance.KeyWindowStart)
 	revisionNumHash := state.GetState(contractAddr, coinchargemaintenance.KeyRevisionNumber)
 	unHash := state.GetState(contractAddr, coinchargemaintenance.KeyUnlockHash)
@@ -170,53 +271,98 @@ func CheckRevisionContract(state StateDB, scr types.StorageContractRevision, cur
 	clientMpoHash := state.GetState(contractAddr, coinchargemaintenance.KeyClientMissedProofOutput)
 	hostMpoHash := state.GetState(contractAddr, coinchargemaintenance.KeyHostMissedProofOutput)
 
+	oldValidPayout := new(big.Int).SetInt64(0)
+	oldMissedPayout := new(big.Int).SetInt64(0)
+
+	clientVpo := new(big.Int).SetBytes(clientVpoHash.Bytes())
+	hostVpo := new(big.Int).SetBytes(hostVpoHash.Bytes())
+	oldValidPayout.Add(clientVpo, hostVpo)
+
+	clientMpo := new(big.Int).SetBytes(clientMpoHash.Bytes())
+	hostMpo := new(big.Int).SetBytes(hostMpoHash.Bytes())
+	oldMissedPayout.Add(clientMpo, hostMpo)
+
+	return revisionParent{
+		windowStart:    new(big.Int).SetBytes(windowStartHash.Bytes()).Uint64(),
+		revisionNumber: new(big.Int).SetBytes(revisionNumHash.Bytes()).Uint64(),
+		unlockHash:     unHash,
+		validPayout:    oldValidPayout,
+		missedPayout:   oldMissedPayout,
+		clientValid:    clientVpo,
+		hostValid:      hostVpo,
+		clientMissed:   clientMpo,
+		hostMissed:     hostMpo,
+	}
+}
+
+// checkRevisionWithParent checks the StorageContractRevision against its parent storage contract
+func checkRevisionWithParent(scr types.StorageContractRevision, parent revisionParent, validProofOutputSum, missedProofOutputSum *big.Int, currentHeight uint64) error {
 	// Check that the height is less than sc.WindowStart - revisions are
 	// not allowed to be submitted once the storage proof window has
 	// opened.  This reduces complexity for unconfirmed transactions.
-	wStart := new(big.Int).SetBytes(windowStartHash.Bytes()).Uint64()
-	if currentHeight > wStart {
+	if currentHeight > parent.windowStart {
 		return errLateRevision
 	}
 
 	// Check that the revision number of the revision is greater than the
 	// revision number of the existing storage contract.
-	reNum := new(big.Int).SetBytes(revisionNumHash.Bytes()).Uint64()
-	if reNum > scr.NewRevisionNumber {
+	if parent.revisionNumber > scr.NewRevisionNumber {
 		return errLowRevisionNumber
 	}
 
 	// Check that the unlock conditions match the unlock hash.
-	if scr.UnlockConditions.UnlockHash() != unHash {
+	if scr.UnlockConditions.UnlockHash() != parent.unlockHash {
 		return errWrongUnlockCondition
 	}
 
 	// Check that the payout of the revision matches the payout of the
 	// original, and that the payouts match each other.
-	oldValidPayout := new(big.Int).SetInt64(0)
-	oldMissedPayout := new(big.Int).SetInt64(0)
-
-	clientVpo := new(big.Int).SetBytes(clientVpoHash.Bytes())
-	hostVpo := new(big.Int).SetBytes(hostVpoHash.Bytes())
-	oldValidPayout.Add(clientVpo, hostVpo)
-
-	clientMpo := new(big.Int).SetBytes(clientMpoHash.Bytes())
-	hostMpo := new(big.Int).SetBytes(hostMpoHash.Bytes())
-	oldMissedPayout.Add(clientMpo, hostMpo)
-
-	if validProofOutputSum.Cmp(oldValidPayout) != 0 {
+	if validProofOutputSum.Cmp(parent.validPayout) != 0 {
 		return errRevisionValidPayouts
 	}
 
 	// For missed outputs only have 2 out: client and host, and client's deduction not add to host.
 	// So the sum of missed outputs is less than or equal to old payout.
-	if missedProofOutputSum.Cmp(oldMissedPayout) == 1 {
+	if missedProofOutputSum.Cmp(parent.missedPayout) == 1 {
 		return errRevisionMissedPayouts
 	}
 
+	return checkRevisionShares(scr, parent)
+}
+
+// checkRevisionShares checks the individual payouts of the client and the host in the revision,
+// so that the payouts cannot be shifted between the parties while keeping the sums unchanged.
+// The client can only pay the host: the client valid payout shrinks by the amount paid and the
+// host valid payout grows by the same amount, while the client missed payout is burnt by the
+// amount paid and the host missed payout can only shrink by the collateral locked
+func checkRevisionShares(scr types.StorageContractRevision, parent revisionParent) error {
+	if len(scr.NewValidProofOutputs) != 2 || len(scr.NewMissedProofOutputs) != 2 {
+		return errRevisionOutputCount
+	}
+	clientValid, hostValid := scr.NewValidProofOutputs[0].Value, scr.NewValidProofOutputs[1].Value
+	clientMissed, hostMissed := scr.NewMissedProofOutputs[0].Value, scr.NewMissedProofOutputs[1].Value
+
+	if clientValid.Cmp(parent.clientValid) > 0 || clientMissed.Cmp(parent.clientMissed) > 0 {
+		return errRevisionClientPayout
+	}
+	if hostValid.Cmp(parent.hostValid) < 0 || hostMissed.Cmp(parent.hostMissed) > 0 {
+		return errRevisionHostPayout
+	}
+
+	// the amount paid by the client must equal to both the amount received by the host and
+	// the amount deducted from the client missed payout
+	paid := new(big.Int).Sub(parent.clientValid, clientValid)
+	if new(big.Int).Sub(hostValid, parent.hostValid).Cmp(paid) != 0 {
+		return errRevisionHostPayout
+	}
+	if new(big.Int).Sub(parent.clientMissed, clientMissed).Cmp(paid) != 0 {
+		return errRevisionClientMissedPayout
+	}
 	return nil
 }
 
-// CheckMultiSignatures checks whether a new StorageContractRevision is valid
+// CheckMultiSignatures checks whether a new StorageContractRevision is valid. The public keys
+// recovered from the signatures are cached, so validating the same signed object again is cheap
 func CheckMultiSignatures(originalData types.StorageContractRLPHash, signatures [][]byte) error {
 	if len(signatures) == 0 {
 		return errors.New("no signatures for verification")
@@ -235,7 +381,7 @@ func CheckMultiSignatures(originalData types.StorageContractRLPHash, signatures
 		singleSig = signatures[0]
 
 		// if we can recover the public key, indicate that check sig is ok
-		recoverKey, err := crypto.SigToPub(dataHash.Bytes(), singleSig)
+		recoverKey, err := recoverPubkey(dataHash, singleSig)
 		if err != nil {
 			return err
 		}
@@ -255,11 +401,11 @@ func CheckMultiSignatures(originalData types.StorageContractRLPHash, signatures
 	} else if len(signatures) == 2 {
 		clientSig = signatures[0]
 		hostSig = signatures[1]
-		clientPubkey, err = crypto.SigToPub(dataHash.Bytes(), clientSig)
+		clientPubkey, err = recoverPubkey(dataHash, clientSig)
 		if err != nil {
 			return err
 		}
-		hostPubkey, err = crypto.SigToPub(dataHash.Bytes(), hostSig)
+		hostPubkey, err = recoverPubkey(dataHash, hostSig)
 		if err != nil {
 			return err
 		}
@@ -287,36 +433,135 @@ func CheckMultiSignatures(originalData types.StorageContractRLPHash, signatures
 	return nil
 }
 
+// proofParent is the information of the storage contract stored in state, which is needed to
+// validate a StorageProof
+type proofParent struct {
+	windowStart    uint64
+	windowEnd      uint64
+	fileSize       uint64
+	segmentSize    uint64
+	fileMerkleRoot common.Hash
+}
+
 // CheckStorageProof checks whether a new StorageProof is valid
 func CheckStorageProof(state StateDB, sp types.StorageProof, currentHeight uint64, statusAddr common.Address, contractAddr common.Address) error {
 
 	// check whether it proofed repeatedly
+	if err := checkStorageProofStatus(state, sp, statusAddr); err != nil {
+		return err
+	}
+
+	// retrieve the storage contract info
+	parent := retrieveProofParent(state, contractAddr)
+	return checkStorageProofWithParent(sp, parent, currentHeight, func(triggerHeight uint64) (common.Hash, error) {
+		return readTriggerBlockHash(state, triggerHeight)
+	})
+}
+
+// StorageProofResults maps the hash of the storage proof transaction data to the result of
+// checking the storage proof by CheckStorageProofs
+type StorageProofResults map[common.Hash]error
+
+// CheckStorageProofs checks a batch of StorageProofs against the same state. The block hash of
+// each trigger height is read from database only once. A storage contract can only be proofed
+// once, so the proofs with the ParentID of a previous proof in the batch are rejected with
+// errDuplicateStorageProof. The returned errors are in the same order as the proofs, and each
+// of the others is the same as the result of CheckStorageProof on the proof
+func CheckStorageProofs(state StateDB, sps []types.StorageProof, currentHeight uint64) []error {
+	var (
+		errs        = make([]error, len(sps))
+		checked     = make(map[common.Hash]struct{})
+		triggerHash = make(map[uint64]common.Hash)
+	)
+	readTriggerHash := func(triggerHeight uint64) (common.Hash, error) {
+		if blockHash, exist := triggerHash[triggerHeight]; exist {
+			return blockHash, nil
+		}
+		blockHash, err := readTriggerBlockHash(state, triggerHeight)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		triggerHash[triggerHeight] = blockHash
+		return blockHash, nil
+	}
+
+	for i, sp := range sps {
+		if _, exist := checked[sp.ParentID]; exist {
+			errs[i] = errDuplicateStorageProof
+			continue
+		}
+		checked[sp.ParentID] = struct{}{}
+
+		contractAddr := common.BytesToAddress(sp.ParentID[12:])
+		if !state.Exist(contractAddr) {
+			errs[i] = errNoStorageContract
+			continue
+		}
+		parent := retrieveProofParent(state, contractAddr)
+		if err := checkStorageProofStatus(state, sp, parent.statusAddr()); err != nil {
+			errs[i] = err
+			continue
+		}
+		errs[i] = checkStorageProofWithParent(sp, parent, currentHeight, readTriggerHash)
+	}
+	return errs
+}
+
+// checkStorageProofStatus checks whether the storage contract of the proof has been proofed
+func checkStorageProofStatus(state StateDB, sp types.StorageProof, statusAddr common.Address) error {
 	statusContent := state.GetState(statusAddr, sp.ParentID)
 	flag := statusContent.Bytes()[11:12]
 	if bytes.Equal(flag, coinchargemaintenance.ProofedStatus) {
 		return errors.New("can not submit storage proof repeatedly")
 	}
+	return nil
+}
 
-	// retrieve the storage contract info
+// retrieveProofParent retrieves the storage contract info needed by the storage proof from state
+func retrieveProofParent(state StateDB, contractAddr common.Address) proofParent {
 	windowStartHash := state.GetState(contractAddr, coinchargemaintenance.KeyWindowStart)
-	windowStart := new(big.Int).SetBytes(windowStartHash.Bytes()).Uint64()
-
 	windowEndHash := state.GetState(contractAddr, coinchargemaintenance.KeyWindowEnd)
-	windowEnd := new(big.Int).SetBytes(windowEndHash.Bytes()).Uint64()
+	fileSizeHash := state.GetState(contractAddr, coinchargemaintenance.KeyFileSize)
 
-	fileMerkleRoot := state.GetState(contractAddr, coinchargemaintenance.KeyFileMerkleRoot)
+	// the segment size is not stored for the contract using the default segment size
+	segmentSizeHash := state.GetState(contractAddr, coinchargemaintenance.KeySegmentSize)
+	segmentSize := new(big.Int).SetBytes(segmentSizeHash.Bytes()).Uint64()
+	if segmentSize == 0 {
+		segmentSize = types.DefaultSegmentSize
+	}
 
-	fileSizeHash := state.GetState(contractAddr, coinchargemaintenance.KeyFileSize)
-	fileSize := new(big.Int).SetBytes(fileSizeHash.Bytes()).Uint64()
+	return proofParent{
+		windowStart:    new(big.Int).SetBytes(windowStartHash.Bytes()).Uint64(),
+		windowEnd:      new(big.Int).SetBytes(windowEndHash.Bytes()).Uint64(),
+		fileSize:       new(big.Int).SetBytes(fileSizeHash.Bytes()).Uint64(),
+		segmentSize:    segmentSize,
+		fileMerkleRoot: state.GetState(contractAddr, coinchargemaintenance.KeyFileMerkleRoot),
+	}
+}
 
-	if windowStart > currentHeight {
+// statusAddr returns the address of the expired storage contract status of the window end
+func (parent proofParent) statusAddr() common.Address {
+	windowEndStr := strconv.FormatUint(parent.windowEnd, 10)
+	return common.BytesToAddress([]byte(coinchargemaintenance.StrPrefixExpSC + windowEndStr))
+}
+
+// checkStorageProofWithParent checks the StorageProof against the storage contract info. The
+// block hash of the trigger height is read by readTriggerHash
+func checkStorageProofWithParent(sp types.StorageProof, parent proofParent, currentHeight uint64, readTriggerHash func(uint64) (common.Hash, error)) error {
+	if parent.windowStart > currentHeight {
 		return errors.New("too early to submit storage proof")
 	}
 
-	if windowEnd < currentHeight {
+	if parent.windowEnd < currentHeight {
 		return errors.New("too late to submit storage proof")
 	}
 
+	// the segment is sent in full, and the final segment is padded. The segment of the contract
+	// not declaring the segment size is DefaultSegmentSize bytes as before the fork
+	if uint64(len(sp.Segment)) != parent.segmentSize {
+		return errStorageProofSegmentLength
+	}
+
 	// check signature
 	err := CheckMultiSignatures(sp, [][]byte{sp.Signature})
 	if err != nil {
@@ -326,53 +571,92 @@ func CheckStorageProof(state StateDB, sp types.StorageProof, currentHeight uint6
 
 	// check that the storage proof itself is valid.
 
-	segmentIndex, err := storageProofSegment(state, windowStart, fileSize, sp.ParentID, currentHeight)
+	segmentIndex, err := storageProofSegment(readTriggerHash, parent.windowStart, parent.fileSize, parent.segmentSize, sp.ParentID, currentHeight)
 	if err != nil {
 		return err
 	}
 
-	leaves := CalculateLeaves(fileSize)
+	if err := CheckStorageProofSegment(sp.Segment, sp.HashSet, parent.fileSize, parent.segmentSize, segmentIndex, parent.fileMerkleRoot); err != nil {
+		log.Debug("storage proof failed the verification", "id", sp.ParentID, "err", err)
+		if proofErr, ok := err.(*ProofError); ok {
+			return &StorageProofError{Proof: proofErr}
+		}
+		return fmt.Errorf("%v: %v", errInvalidStorageProof, err)
+	}
+
+	return nil
+}
+
+// VerifyStorageProof checks the segment and hash set of a storage proof against the merkle root
+// of the file without the chain state. The file merkle root is always taken with DefaultSegmentSize
+// leaves, and the segment of a larger segment size is proved by the root of its subtree, so the
+// hash set is shorter. The proof of an empty file is always valid
+func VerifyStorageProof(segment []byte, hashSet []common.Hash, fileSize, segmentSize, segmentIndex uint64, fileMerkleRoot common.Hash) bool {
+	return CheckStorageProofSegment(segment, hashSet, fileSize, segmentSize, segmentIndex, fileMerkleRoot) == nil
+}
+
+// CheckStorageProofSegment is the same as VerifyStorageProof, except that the *ProofError
+// telling why the proof fails is returned
+func CheckStorageProofSegment(segment []byte, hashSet []common.Hash, fileSize, segmentSize, segmentIndex uint64, fileMerkleRoot common.Hash) error {
+	if fileSize == 0 {
+		return nil
+	}
 
-	segmentLen := uint64(merkle.LeafSize)
+	leaves := CalculateLeaves(fileSize, segmentSize)
+
+	segmentLen := segmentSize
 
 	// if this segment chosen is the final segment, it should only be as
 	// long as necessary to complete the file size.
 	if segmentIndex == leaves-1 {
-		segmentLen = fileSize % merkle.LeafSize
+		segmentLen = common.FinalSegmentLength(fileSize, segmentSize)
 	}
 
-	if segmentLen == 0 {
-		segmentLen = uint64(merkle.LeafSize)
+	if uint64(len(segment)) < segmentLen {
+		return &ProofError{
+			Reason: ProofLengthMismatch,
+			Index:  segmentIndex,
+			Got:    len(segment),
+			Want:   int(segmentLen),
+		}
 	}
 
-	verified := VerifySegment(
-		sp.Segment[:segmentLen],
-		sp.HashSet,
-		leaves,
-		segmentIndex,
-		fileMerkleRoot,
-	)
-	if !verified && fileSize > 0 {
-		return errInvalidStorageProof
+	if segmentSize == types.DefaultSegmentSize {
+		return CheckSegment(
+			segment[:segmentLen],
+			hashSet,
+			leaves,
+			segmentIndex,
+			fileMerkleRoot,
+		)
 	}
-
-	return nil
+	return checkProof(fileMerkleRoot[:], toProofSet(segment[:segmentLen], hashSet), segmentIndex, leaves, segmentRoot)
 }
 
 // VerifySegment checks whether host has really stored the file
 func VerifySegment(segment []byte, hashSet []common.Hash, leaves, segmentIndex uint64, merkleRoot common.Hash) bool {
+	return CheckSegment(segment, hashSet, leaves, segmentIndex, merkleRoot) == nil
+}
+
+// CheckSegment is the same as VerifySegment, except that the *ProofError telling why the
+// proof fails is returned
+func CheckSegment(segment []byte, hashSet []common.Hash, leaves, segmentIndex uint64, merkleRoot common.Hash) error {
+
+	return CheckProof(merkleRoot[:], toProofSet(segment, hashSet), segmentIndex, leaves)
+}
 
-	// convert base and hashSet to proofSet
+// toProofSet converts the segment and the hash set to the proof set
+func toProofSet(segment []byte, hashSet []common.Hash) [][]byte {
 	proofSet := make([][]byte, len(hashSet)+1)
 	proofSet[0] = segment
 	for i := range hashSet {
 		proofSet[i+1] = hashSet[i][:]
 	}
-	return VerifyProof(merkleRoot[:], proofSet, segmentIndex, leaves)
+	return proofSet
 }
 
-// get segment index by random
-func storageProofSegment(state StateDB, windowStart, fileSize uint64, scID common.Hash, currentHeight uint64) (uint64, error) {
+// get segment index by random. The block hash of the trigger height is read by readTriggerHash
+func storageProofSegment(readTriggerHash func(uint64) (common.Hash, error), windowStart, fileSize, segmentSize uint64, scID common.Hash, currentHeight uint64) (uint64, error) {
 
 	// Get the trigger block id that parent of windowStart.
 	triggerHeight := windowStart - 1
@@ -380,14 +664,13 @@ func storageProofSegment(state StateDB, windowStart, fileSize uint64, scID commo
 		return 0, errUnfinishedStorageContract
 	}
 
-	db := state.Database().TrieDB().DiskDB().(ethdb.Database)
-	blockHash := rawdb.ReadCanonicalHash(db, uint64(triggerHeight))
-	if reflect.DeepEqual(blockHash, common.Hash{}) {
-		return 0, errors.New("can not read block hash of the trigger height for storage proof seed")
+	blockHash, err := readTriggerHash(triggerHeight)
+	if err != nil {
+		return 0, err
 	}
 
 	seed := crypto.Keccak256Hash(blockHash[:], scID[:])
-	numSegments := int64(CalculateLeaves(fileSize))
+	numSegments := int64(CalculateLeaves(fileSize, segmentSize))
 
 	// index = seedInt % numSegments，index in [0，numSegments]
 	seedInt := new(big.Int).SetBytes(seed[:])
@@ -395,34 +678,52 @@ func storageProofSegment(state StateDB, windowStart, fileSize uint64, scID commo
 	return index, nil
 }
 
-// CalculateLeaves calculates the num of leaves formed by the given file
-func CalculateLeaves(fileSize uint64) uint64 {
-	numSegments := fileSize / merkle.LeafSize
-	if fileSize == 0 || fileSize%merkle.LeafSize != 0 {
-		numSegments++
+// readTriggerBlockHash reads the canonical block hash of the trigger height from database
+func readTriggerBlockHash(state StateDB, triggerHeight uint64) (common.Hash, error) {
+	db := state.Database().TrieDB().DiskDB().(ethdb.Database)
+	blockHash := rawdb.ReadCanonicalHash(db, uint64(triggerHeight))
+	if reflect.DeepEqual(blockHash, common.Hash{}) {
+		return common.Hash{}, errors.New("can not read block hash of the trigger height for storage proof seed")
 	}
-	return numSegments
+	return blockHash, nil
+}
+
+// CalculateLeaves calculates the num of leaves of segmentSize formed by the given file
+func CalculateLeaves(fileSize, segmentSize uint64) uint64 {
+	return common.NumSegments(fileSize, segmentSize)
 }
 
 // VerifyProof verifys merkle root of given segment
 func VerifyProof(merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLeaves uint64) bool {
+	return CheckProof(merkleRoot, proofSet, proofIndex, numLeaves) == nil
+}
+
+// CheckProof is the same as VerifyProof, except that the *ProofError telling why the proof
+// fails is returned
+func CheckProof(merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLeaves uint64) error {
+	return checkProof(merkleRoot, proofSet, proofIndex, numLeaves, leafHash)
+}
+
+// checkProof checks the proof set against the merkle root, where the sum of the segment in
+// proofSet[0] is computed by leafSum
+func checkProof(merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLeaves uint64, leafSum func(hash.Hash, []byte) []byte) error {
 	hasher := sha256.New()
 
 	if merkleRoot == nil {
-		return false
+		return &ProofError{Reason: ProofNilRoot, Index: proofIndex}
 	}
 
 	if proofIndex >= numLeaves {
-		return false
+		return &ProofError{Reason: ProofIndexOutOfRange, Index: proofIndex, NumLeaves: numLeaves}
 	}
 
 	height := 0
 	if len(proofSet) <= height {
-		return false
+		return newProofLengthError(proofIndex, height, proofSet)
 	}
 
 	// proofSet[0] is the segment of the file
-	sum := leafHash(hasher, proofSet[height])
+	sum := leafSum(hasher, proofSet[height])
 	height++
 	stableEnd := proofIndex
 
@@ -436,7 +737,7 @@ func VerifyProof(merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLea
 		stableEnd = subTreeEndIndex
 
 		if len(proofSet) <= height {
-			return false
+			return newProofLengthError(proofIndex, height, proofSet)
 		}
 
 		if proofIndex-subTreeStartIndex < 1<<uint(height-1) {
@@ -449,7 +750,7 @@ func VerifyProof(merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLea
 
 	if stableEnd != numLeaves-1 {
 		if len(proofSet) <= height {
-			return false
+			return newProofLengthError(proofIndex, height, proofSet)
 		}
 
 		sum = nodeHash(hasher, sum, proofSet[height])
@@ -461,11 +762,17 @@ func VerifyProof(merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLea
 		height++
 	}
 
-	if bytes.Equal(sum, merkleRoot) {
-		return true
+	if !bytes.Equal(sum, merkleRoot) {
+		return &ProofError{
+			Reason:   ProofHashMismatch,
+			Index:    proofIndex,
+			Level:    height - 1,
+			Computed: sum,
+			Root:     merkleRoot,
+		}
 	}
 
-	return false
+	return nil
 }
 
 // HashSum returns the hash of the input data using the specified algorithm.
@@ -485,3 +792,10 @@ func leafHash(h hash.Hash, data []byte) []byte {
 func nodeHash(h hash.Hash, a, b []byte) []byte {
 	return HashSum(h, []byte{0x01}, a, b)
 }
+
+// segmentRoot returns the merkle root of the segment with DefaultSegmentSize leaves, which is
+// the subtree of the file merkle tree covering the segment
+func segmentRoot(h hash.Hash, segment []byte) []byte {
+	root := merkle.Sha256MerkleTreeRoot(segment)
+	return root[:]
+}
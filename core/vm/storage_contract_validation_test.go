@@ -1,14 +1,22 @@
 package vm
 
 import (
+	"crypto/rand"
+	"fmt"
 	"math/big"
 	"net"
+	"strconv"
 	"testing"
 
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/rawdb"
 	"github.com/DxChainNetwork/godx/core/types"
 	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/ethdb"
 	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/params"
+	"github.com/DxChainNetwork/godx/storage/coinchargemaintenance"
 	"github.com/magiconair/properties/assert"
 	"golang.org/x/crypto/sha3"
 )
@@ -123,3 +131,571 @@ func TestVerifySegment(t *testing.T) {
 	//assert.Equal(t, VerifySegment([]byte("jack"), hashSet, 4, 0, root), true, "incorrect verification merkle proof")
 	assert.Equal(t, VerifySegment([]byte("lucy"), hashSet, 4, 0, root), false, "incorrect verification merkle proof")
 }
+
+// TestCheckProof_FailureReason test the failed merkle proof reports the reason of the failure,
+// and the bool verifications agree with the detailed checks
+func TestCheckProof_FailureReason(t *testing.T) {
+	numLeaves := uint64(8)
+	data := make([]byte, numLeaves*merkle.LeafSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	root := merkle.Sha256MerkleTreeRoot(data)
+	segment, hashSet, _, err := merkle.Sha256MerkleTreeProof(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofSet := [][]byte{segment}
+	for _, h := range hashSet {
+		proofSet = append(proofSet, h.Bytes())
+	}
+	tampered := append([]byte{}, segment...)
+	tampered[0]++
+
+	tests := []struct {
+		name   string
+		err    error
+		reason ProofFailureReason
+		level  int
+	}{
+		{"valid", CheckProof(root[:], proofSet, 0, numLeaves), 0, 0},
+		{"nil root", CheckProof(nil, proofSet, 0, numLeaves), ProofNilRoot, 0},
+		{"index out of range", CheckProof(root[:], proofSet, numLeaves, numLeaves), ProofIndexOutOfRange, 0},
+		{"empty proof set", CheckProof(root[:], nil, 0, numLeaves), ProofLengthMismatch, 0},
+		{"truncated proof set", CheckProof(root[:], proofSet[:2], 0, numLeaves), ProofLengthMismatch, 2},
+		{"tampered segment", CheckSegment(tampered, hashSet, numLeaves, 0, root), ProofHashMismatch, 3},
+		{"short segment", CheckStorageProofSegment(segment[:10], hashSet, uint64(len(data)), types.DefaultSegmentSize, 0, root), ProofLengthMismatch, 0},
+	}
+	for _, test := range tests {
+		if test.reason == 0 {
+			if test.err != nil {
+				t.Errorf("%v: unexpected error %v", test.name, test.err)
+			}
+			continue
+		}
+		proofErr, ok := test.err.(*ProofError)
+		if !ok {
+			t.Errorf("%v: expect *ProofError, got %v", test.name, test.err)
+			continue
+		}
+		if proofErr.Reason != test.reason || proofErr.Level != test.level {
+			t.Errorf("%v: expect %v at level %v, got %v", test.name, test.reason, test.level, proofErr)
+		}
+	}
+
+	if !VerifyProof(root[:], proofSet, 0, numLeaves) || VerifyProof(root[:], proofSet[:2], 0, numLeaves) {
+		t.Errorf("VerifyProof does not agree with CheckProof")
+	}
+	if VerifySegment(tampered, hashSet, numLeaves, 0, root) {
+		t.Errorf("VerifySegment does not agree with CheckSegment")
+	}
+}
+
+func TestCheckCreateContract_SegmentSize(t *testing.T) {
+	_, stateDB, prvAndAddresses, err := mockEvmAndState(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		segmentSize uint64
+		expect      error
+	}{
+		{0, nil},
+		{types.DefaultSegmentSize, nil},
+		{1, nil},
+		{1024, nil},
+		{merkle.SectorSize, nil},
+		{100, errInvalidSegmentSize},
+		{types.DefaultSegmentSize + 1, errInvalidSegmentSize},
+		{merkle.SectorSize * 2, errInvalidSegmentSize},
+	}
+	for _, test := range tests {
+		sc, err := mockStorageContract(prvAndAddresses)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc.SegmentSize = test.segmentSize
+		if err := resignStorageContract(sc, prvAndAddresses); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckCreateContract(stateDB, *sc, 1000); err != test.expect {
+			t.Errorf("segment size %v: expect %v, got %v", test.segmentSize, test.expect, err)
+		}
+	}
+}
+
+func TestCheckHostCollateral(t *testing.T) {
+	// the host collateral at exactly the minimum percentage of the payout
+	unit := big.NewInt(1e8)
+	minHost := new(big.Int).Mul(unit, new(big.Int).SetUint64(params.DefaultMinHostCollateralPercentage))
+	minClient := new(big.Int).Sub(new(big.Int).Mul(unit, big.NewInt(100)), minHost)
+	one := big.NewInt(1)
+
+	tests := []struct {
+		name   string
+		client *big.Int
+		host   *big.Int
+		expect error
+	}{
+		{"at the limit", minClient, minHost, nil},
+		{"host collateral just above the limit", minClient, new(big.Int).Add(minHost, one), nil},
+		{"client collateral just below the limit", new(big.Int).Sub(minClient, one), minHost, nil},
+		{"host collateral just below the limit", minClient, new(big.Int).Sub(minHost, one), errInsufficientHostCollateral},
+		{"client collateral just above the limit", new(big.Int).Add(minClient, one), minHost, errInsufficientHostCollateral},
+		{"negligible host collateral", minClient, one, errInsufficientHostCollateral},
+	}
+	for _, test := range tests {
+		if err := CheckHostCollateral(test.client, test.host, params.DefaultMinHostCollateralPercentage); err != test.expect {
+			t.Errorf("%v: expect %v, got %v", test.name, test.expect, err)
+		}
+	}
+}
+
+func TestCheckContractDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		windowEnd uint64
+		expect    error
+	}{
+		{"short contract", 1101, nil},
+		{"at the limit", 1000 + params.DefaultMaxContractDuration, nil},
+		{"one over the limit", 1000 + params.DefaultMaxContractDuration + 1, errStorageContractDurationViolation},
+	}
+	for _, test := range tests {
+		if err := CheckContractDuration(test.windowEnd, 1000, params.DefaultMaxContractDuration); err != test.expect {
+			t.Errorf("%v: expect %v, got %v", test.name, test.expect, err)
+		}
+	}
+}
+
+// resignStorageContract signs the storage contract modified again by the client and host
+func resignStorageContract(sc *types.StorageContract, prvAndAddresses []PrivkeyAddress) error {
+	sc.Signatures = nil
+	for _, pa := range prvAndAddresses[:2] {
+		sign, err := crypto.Sign(sc.RLPHash().Bytes(), pa.Privkey)
+		if err != nil {
+			return err
+		}
+		sc.Signatures = append(sc.Signatures, sign)
+	}
+	return nil
+}
+
+// TestCheckStorageProof_SegmentSize test the storage proof is verified with the segment size
+// declared by the storage contract
+func TestCheckStorageProof_SegmentSize(t *testing.T) {
+	const segmentSize = 256
+	evm, stateDB, prvAndAddresses, err := mockEvmAndState(1050)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := stateDB.Database().TrieDB().DiskDB().(ethdb.Database)
+	rawdb.WriteCanonicalHash(db, common.HexToHash("0x877c3a381d5ad88ca76a7b3e33ab1611939de59c56c0506efb9021593618f6ab"), uint64(1000))
+	readTriggerHash := func(triggerHeight uint64) (common.Hash, error) {
+		return readTriggerBlockHash(stateDB, triggerHeight)
+	}
+
+	// the file of 256 bytes segments, where the final segment is not full. The file merkle root
+	// is taken with the default segment size
+	data := make([]byte, segmentSize*5+10)
+	rand.Read(data)
+	var segments [][]byte
+	for i := 0; i < len(data); i += segmentSize {
+		end := i + segmentSize
+		if end > len(data) {
+			end = len(data)
+		}
+		segments = append(segments, data[i:end])
+	}
+
+	sc, err := mockStorageContract(prvAndAddresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.FileSize = uint64(len(data))
+	sc.FileMerkleRoot = merkle.Sha256MerkleTreeRoot(data)
+	sc.SegmentSize = segmentSize
+	mockWriteStorageContractIntoState(*sc, stateDB)
+
+	segmentIndex, err := storageProofSegment(readTriggerHash, sc.WindowStart, sc.FileSize, segmentSize, sc.ID(), 1050)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the segment is proved by the root of its subtree, and the hash set above the subtree
+	proofTree := merkle.NewSha256CachedTree(0)
+	if err := proofTree.SetStorageProofIndex(segmentIndex); err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range segments {
+		proofTree.Push(merkle.Sha256MerkleTreeRoot(segment))
+	}
+	if proofTree.Root() != sc.FileMerkleRoot {
+		t.Fatalf("the merkle root of the segment roots does not match the file merkle root")
+	}
+	sp := types.StorageProof{
+		ParentID: sc.ID(),
+		Segment:  make([]byte, segmentSize),
+		HashSet:  proofTree.Prove(segments[segmentIndex], nil),
+	}
+	copy(sp.Segment, segments[segmentIndex])
+	if sp.Signature, err = crypto.Sign(sp.RLPHash().Bytes(), prvAndAddresses[1].Privkey); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkStorageProofTx(evm.StateDB, sp, 1050); err != nil {
+		t.Fatalf("valid storage proof of the segment size %v not verified: %v", segmentSize, err)
+	}
+
+	// the same proof is not valid with the default segment size
+	if err := CheckStorageProofSegment(sp.Segment, sp.HashSet, sc.FileSize, types.DefaultSegmentSize, segmentIndex, sc.FileMerkleRoot); err == nil {
+		t.Errorf("storage proof verified with the default segment size")
+	}
+
+	// the tampered segment is rejected with the reason the merkle proof fails
+	tampered := sp
+	tampered.Segment = make([]byte, segmentSize)
+	copy(tampered.Segment, sp.Segment)
+	tampered.Segment[0] ^= 0xff
+	if tampered.Signature, err = crypto.Sign(tampered.RLPHash().Bytes(), prvAndAddresses[1].Privkey); err != nil {
+		t.Fatal(err)
+	}
+	err = checkStorageProofTx(evm.StateDB, tampered, 1050)
+	if proofErr, ok := err.(*StorageProofError); !ok || proofErr.Proof.Reason != ProofHashMismatch {
+		t.Errorf("tampered segment: expect *StorageProofError of %v, got %v", ProofHashMismatch, err)
+	}
+
+	// the segment not of the segment size is rejected, even if its prefix is the segment proved
+	for _, length := range []int{types.DefaultSegmentSize, segmentSize + 1} {
+		invalid := sp
+		invalid.Segment = make([]byte, length)
+		copy(invalid.Segment, sp.Segment)
+		if err := checkStorageProofTx(evm.StateDB, invalid, 1050); err != errStorageProofSegmentLength {
+			t.Errorf("segment of length %v: expect error %v, got %v", length, errStorageProofSegmentLength, err)
+		}
+	}
+}
+
+// countingStateDB is the StateDB which counts the number of GetState calls
+type countingStateDB struct {
+	StateDB
+	numGetState int
+}
+
+// GetState counts the call and calls the underlying StateDB.GetState
+func (db *countingStateDB) GetState(addr common.Address, key common.Hash) common.Hash {
+	db.numGetState++
+	return db.StateDB.GetState(addr, key)
+}
+
+func TestCheckRevisionContracts(t *testing.T) {
+	stateDB, scrs, err := mockRevisionBatch(5, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numErr int
+	errs := CheckRevisionContracts(stateDB, scrs, 1000)
+	if len(errs) != len(scrs) {
+		t.Fatalf("number of errors not expected. Got %v, Expect %v", len(errs), len(scrs))
+	}
+	for i, scr := range scrs {
+		contractAddr := common.BytesToAddress(scr.ParentID.Bytes()[12:])
+		expect := CheckRevisionContract(stateDB, scr, 1000, contractAddr)
+		if errs[i] != expect {
+			t.Errorf("revision %d: batch validation result not expected. Got %v, Expect %v", i, errs[i], expect)
+		}
+		if expect != nil {
+			numErr++
+		}
+	}
+	if numErr == 0 || numErr == len(scrs) {
+		t.Errorf("batch shall contain both valid and invalid revisions. Got %v invalid out of %v", numErr, len(scrs))
+	}
+}
+
+func TestCheckRevisionContracts_ParentRetrievedOnce(t *testing.T) {
+	stateDB, scrs, err := mockRevisionBatch(3, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batchDB := &countingStateDB{StateDB: stateDB}
+	CheckRevisionContracts(batchDB, scrs, 1000)
+
+	singleDB := &countingStateDB{StateDB: stateDB}
+	for _, scr := range scrs {
+		CheckRevisionContract(singleDB, scr, 1000, common.BytesToAddress(scr.ParentID.Bytes()[12:]))
+	}
+	if batchDB.numGetState >= singleDB.numGetState {
+		t.Errorf("batch validation shall have less state reads. Got %v, single validation %v",
+			batchDB.numGetState, singleDB.numGetState)
+	}
+}
+
+func BenchmarkCheckRevisionContract(b *testing.B) {
+	stateDB, scrs, err := mockRevisionBatch(10, 20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, scr := range scrs {
+			CheckRevisionContract(stateDB, scr, 1000, common.BytesToAddress(scr.ParentID.Bytes()[12:]))
+		}
+	}
+}
+
+func BenchmarkCheckRevisionContracts(b *testing.B) {
+	stateDB, scrs, err := mockRevisionBatch(10, 20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CheckRevisionContracts(stateDB, scrs, 1000)
+	}
+}
+
+// mockRevisionBatch mock a state with numContracts storage contracts written, and numRevisions
+// revisions for each of the storage contract. Some of the revisions are invalid
+func mockRevisionBatch(numContracts, numRevisions int) (StateDB, []types.StorageContractRevision, error) {
+	_, stateDB, prvAndAddresses, err := mockEvmAndState(1000)
+	if err != nil {
+		return nil, nil, err
+	}
+	prvKeyClient := prvAndAddresses[0].Privkey
+	prvKeyHost := prvAndAddresses[1].Privkey
+
+	var scrs []types.StorageContractRevision
+	for i := 0; i != numContracts; i++ {
+		sc, err := mockStorageContract(prvAndAddresses)
+		if err != nil {
+			return nil, nil, err
+		}
+		sc.FileSize = uint64(i)
+		sc.RevisionNumber = uint64(i % 3)
+		mockWriteStorageContractIntoState(*sc, stateDB)
+
+		for j := 0; j != numRevisions; j++ {
+			scr, err := mockStorageRevision(*sc, cost, prvKeyClient, prvKeyHost)
+			if err != nil {
+				return nil, nil, err
+			}
+			scr.NewRevisionNumber = uint64(j)
+			switch j % 4 {
+			case 1:
+				// altered valid payout
+				scr.NewValidProofOutputs[1].Value = new(big.Int).Add(scr.NewValidProofOutputs[1].Value, cost)
+			case 2:
+				// wrong unlock conditions
+				scr.UnlockConditions.SignaturesRequired = 1
+			}
+			hash := scr.RLPHash().Bytes()
+			if scr.Signatures[0], err = crypto.Sign(hash, prvKeyClient); err != nil {
+				return nil, nil, err
+			}
+			if scr.Signatures[1], err = crypto.Sign(hash, prvKeyHost); err != nil {
+				return nil, nil, err
+			}
+			if j%4 == 3 {
+				// tampered after signing
+				scr.NewFileSize++
+			}
+			scrs = append(scrs, *scr)
+		}
+	}
+	return stateDB, scrs, nil
+}
+
+// TestCheckRevisionContract_ShareShifting test the revisions shifting the payouts between the
+// client and the host are rejected, even if the sums of the payouts are kept
+func TestCheckRevisionContract_ShareShifting(t *testing.T) {
+	_, stateDB, prvAndAddresses, err := mockEvmAndState(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prvKeyClient := prvAndAddresses[0].Privkey
+	prvKeyHost := prvAndAddresses[1].Privkey
+	sc, err := mockStorageContract(prvAndAddresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockWriteStorageContractIntoState(*sc, stateDB)
+	contractAddr := common.BytesToAddress(sc.ID().Bytes()[12:])
+
+	shift := big.NewInt(10)
+	tests := []struct {
+		name   string
+		tamper func(scr *types.StorageContractRevision)
+		err    error
+	}{
+		{"honest revision", func(scr *types.StorageContractRevision) {}, nil},
+		{"client valid payout shifted to host", func(scr *types.StorageContractRevision) {
+			scr.NewValidProofOutputs[0].Value = new(big.Int).Sub(scr.NewValidProofOutputs[0].Value, shift)
+			scr.NewValidProofOutputs[1].Value = new(big.Int).Add(scr.NewValidProofOutputs[1].Value, shift)
+		}, errRevisionClientMissedPayout},
+		{"host valid payout shifted to client", func(scr *types.StorageContractRevision) {
+			scr.NewValidProofOutputs[0].Value = new(big.Int).Add(scr.NewValidProofOutputs[0].Value, shift)
+			scr.NewValidProofOutputs[1].Value = new(big.Int).Sub(scr.NewValidProofOutputs[1].Value, shift)
+		}, errRevisionClientMissedPayout},
+		{"client missed payout shifted to host", func(scr *types.StorageContractRevision) {
+			scr.NewMissedProofOutputs[0].Value = new(big.Int).Sub(scr.NewMissedProofOutputs[0].Value, shift)
+			scr.NewMissedProofOutputs[1].Value = new(big.Int).Add(scr.NewMissedProofOutputs[1].Value, shift)
+		}, errRevisionHostPayout},
+		{"client valid payout increased", func(scr *types.StorageContractRevision) {
+			scr.NewValidProofOutputs[0].Value = new(big.Int).Add(scr.NewValidProofOutputs[0].Value, new(big.Int).Add(cost, shift))
+			scr.NewValidProofOutputs[1].Value = new(big.Int).Sub(scr.NewValidProofOutputs[1].Value, new(big.Int).Add(cost, shift))
+		}, errRevisionClientPayout},
+	}
+	for _, test := range tests {
+		scr, err := mockStorageRevision(*sc, cost, prvKeyClient, prvKeyHost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(scr)
+		hash := scr.RLPHash().Bytes()
+		if scr.Signatures[0], err = crypto.Sign(hash, prvKeyClient); err != nil {
+			t.Fatal(err)
+		}
+		if scr.Signatures[1], err = crypto.Sign(hash, prvKeyHost); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckRevisionContract(stateDB, *scr, 1000, contractAddr); err != test.err {
+			t.Errorf("%v: expect error %v, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestCheckStorageProofs(t *testing.T) {
+	evm, sps, err := mockStorageProofBatch(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numErr int
+	errs := CheckStorageProofs(evm.StateDB, sps, 1050)
+	if len(errs) != len(sps) {
+		t.Fatalf("number of errors not expected. Got %v, Expect %v", len(errs), len(sps))
+	}
+	for i, sp := range sps {
+		expect := checkStorageProofTx(evm.StateDB, sp, 1050)
+		if fmt.Sprint(errs[i]) != fmt.Sprint(expect) {
+			t.Errorf("proof %d: batch validation result not expected. Got %v, Expect %v", i, errs[i], expect)
+		}
+		if expect != nil {
+			numErr++
+		}
+	}
+	if numErr == 0 || numErr == len(sps) {
+		t.Errorf("batch shall contain both valid and invalid proofs. Got %v invalid out of %v", numErr, len(sps))
+	}
+}
+
+func TestCheckStorageProofs_DuplicateParentID(t *testing.T) {
+	evm, sps, err := mockStorageProofBatch(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// submit the valid proof of the first storage contract twice
+	sps = append(sps, sps[0])
+	errs := CheckStorageProofs(evm.StateDB, sps, 1050)
+	if errs[0] != nil {
+		t.Fatalf("first proof shall be valid: %v", errs[0])
+	}
+	if errs[len(errs)-1] != errDuplicateStorageProof {
+		t.Errorf("expect error %v, got %v", errDuplicateStorageProof, errs[len(errs)-1])
+	}
+}
+
+func BenchmarkCheckStorageProof(b *testing.B) {
+	evm, sps, err := mockStorageProofBatch(200)
+	if err != nil {
+		b.Fatal(err)
+	}
+	db := &countingStateDB{StateDB: evm.StateDB}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, sp := range sps {
+			checkStorageProofTx(db, sp, 1050)
+		}
+	}
+	b.Logf("%v state reads per batch of %v proofs", db.numGetState/b.N, len(sps))
+}
+
+func BenchmarkCheckStorageProofs(b *testing.B) {
+	evm, sps, err := mockStorageProofBatch(200)
+	if err != nil {
+		b.Fatal(err)
+	}
+	db := &countingStateDB{StateDB: evm.StateDB}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CheckStorageProofs(db, sps, 1050)
+	}
+	b.Logf("%v state reads per batch of %v proofs", db.numGetState/b.N, len(sps))
+}
+
+// checkStorageProofTx checks the storage proof the same way as StorageProofTx does
+func checkStorageProofTx(state StateDB, sp types.StorageProof, currentHeight uint64) error {
+	contractAddr := common.BytesToAddress(sp.ParentID[12:])
+	if !state.Exist(contractAddr) {
+		return errNoStorageContract
+	}
+	windowEndHash := state.GetState(contractAddr, coinchargemaintenance.KeyWindowEnd)
+	windowEnd := new(big.Int).SetBytes(windowEndHash.Bytes()).Uint64()
+	windowEndStr := strconv.FormatUint(windowEnd, 10)
+	statusAddr := common.BytesToAddress([]byte(coinchargemaintenance.StrPrefixExpSC + windowEndStr))
+	return CheckStorageProof(state, sp, currentHeight, statusAddr, contractAddr)
+}
+
+// mockStorageProofBatch mock an evm at height 1050 with numContracts storage contracts written
+// to its state, and a storage proof for each of the storage contract. The proofs of every third
+// storage contract are tampered, and the proof of a storage contract not existing is appended at last
+func mockStorageProofBatch(numContracts int) (*EVM, []types.StorageProof, error) {
+	evm, stateDB, prvAndAddresses, err := mockEvmAndState(1050)
+	if err != nil {
+		return nil, nil, err
+	}
+	prvKeyHost := prvAndAddresses[1].Privkey
+
+	// the storage contracts mocked all have the trigger height 1000
+	db := stateDB.Database().TrieDB().DiskDB().(ethdb.Database)
+	rawdb.WriteCanonicalHash(db, common.HexToHash("0x877c3a381d5ad88ca76a7b3e33ab1611939de59c56c0506efb9021593618f6ab"), uint64(1000))
+	readTriggerHash := func(triggerHeight uint64) (common.Hash, error) {
+		return readTriggerBlockHash(stateDB, triggerHeight)
+	}
+
+	var sps []types.StorageProof
+	for i := 0; i != numContracts; i++ {
+		sc, err := mockStorageContract(prvAndAddresses)
+		if err != nil {
+			return nil, nil, err
+		}
+		data := make([]byte, merkle.LeafSize*(i+1)+i)
+		rand.Read(data)
+		sc.FileSize = uint64(len(data))
+		sc.FileMerkleRoot = merkle.Sha256MerkleTreeRoot(data)
+		mockWriteStorageContractIntoState(*sc, stateDB)
+
+		segmentIndex, err := storageProofSegment(readTriggerHash, sc.WindowStart, sc.FileSize, types.DefaultSegmentSize, sc.ID(), 1050)
+		if err != nil {
+			return nil, nil, err
+		}
+		segment, hashSet, _, err := merkle.Sha256MerkleTreeProof(data, segmentIndex)
+		if err != nil {
+			return nil, nil, err
+		}
+		sp := types.StorageProof{
+			ParentID: sc.ID(),
+			Segment:  make([]byte, types.DefaultSegmentSize),
+			HashSet:  hashSet,
+		}
+		copy(sp.Segment, segment)
+		if i%3 == 1 {
+			// tampered segment
+			sp.Segment[0]++
+		}
+		if sp.Signature, err = crypto.Sign(sp.RLPHash().Bytes(), prvKeyHost); err != nil {
+			return nil, nil, err
+		}
+		sps = append(sps, sp)
+	}
+	sps = append(sps, types.StorageProof{ParentID: common.Hash{1}})
+	return evm, sps, nil
+}
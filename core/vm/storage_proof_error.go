@@ -0,0 +1,104 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package vm
+
+import (
+	"fmt"
+)
+
+// ProofFailureReason is the reason a merkle proof fails the verification
+type ProofFailureReason uint8
+
+const (
+	// ProofNilRoot means the merkle root the proof is verified against is nil
+	ProofNilRoot ProofFailureReason = iota + 1
+
+	// ProofIndexOutOfRange means the index of the proved leaf is beyond the number of leaves
+	ProofIndexOutOfRange
+
+	// ProofLengthMismatch means the proof set runs out of hashes before the root is reached,
+	// or the proved segment is shorter than expected
+	ProofLengthMismatch
+
+	// ProofHashMismatch means the root computed from the proof set differs from the merkle root
+	ProofHashMismatch
+)
+
+// String returns the string representation of the proof failure reason
+func (r ProofFailureReason) String() string {
+	switch r {
+	case ProofNilRoot:
+		return "nil root"
+	case ProofIndexOutOfRange:
+		return "index out of range"
+	case ProofLengthMismatch:
+		return "length mismatch"
+	case ProofHashMismatch:
+		return "hash mismatch"
+	default:
+		return fmt.Sprintf("unknown reason %d", uint8(r))
+	}
+}
+
+// ProofError is the detailed error telling why a merkle proof fails the verification. Only the
+// fields relevant to the Reason are set
+type ProofError struct {
+	Reason ProofFailureReason
+
+	// Index is the index of the proved leaf, and NumLeaves is the number of leaves of the tree
+	Index     uint64
+	NumLeaves uint64
+
+	// Level is the tree level the verification fails at, where the leaves are at level 0.
+	// The hash mismatch is detected at the root level, when the computed root is compared
+	Level int
+
+	// Got and Want are the lengths of the proof set, in elements, or of the segment, in bytes
+	Got  int
+	Want int
+
+	// Computed is the root computed from the proof set, and Root is the expected merkle root
+	Computed []byte
+	Root     []byte
+}
+
+// newProofLengthError creates the ProofError of the proof set running out of hashes when the
+// hash at level is required
+func newProofLengthError(index uint64, level int, proofSet [][]byte) *ProofError {
+	return &ProofError{
+		Reason: ProofLengthMismatch,
+		Index:  index,
+		Level:  level,
+		Got:    len(proofSet),
+		Want:   level + 1,
+	}
+}
+
+// Error implements the error interface
+func (e *ProofError) Error() string {
+	switch e.Reason {
+	case ProofNilRoot:
+		return fmt.Sprintf("merkle proof of leaf %v: nil root", e.Index)
+	case ProofIndexOutOfRange:
+		return fmt.Sprintf("merkle proof of leaf %v: index out of range of %v leaves", e.Index, e.NumLeaves)
+	case ProofLengthMismatch:
+		return fmt.Sprintf("merkle proof of leaf %v: length mismatch at level %v: got %v, want at least %v", e.Index, e.Level, e.Got, e.Want)
+	case ProofHashMismatch:
+		return fmt.Sprintf("merkle proof of leaf %v: hash mismatch at level %v: computed %x, want %x", e.Index, e.Level, e.Computed, e.Root)
+	default:
+		return fmt.Sprintf("merkle proof of leaf %v: %v", e.Index, e.Reason)
+	}
+}
+
+// StorageProofError is the error of the storage proof failing the merkle proof verification
+// against the storage contract, which keeps the *ProofError telling why the proof fails
+type StorageProofError struct {
+	Proof *ProofError
+}
+
+// Error implements the error interface
+func (e *StorageProofError) Error() string {
+	return fmt.Sprintf("%v: %v", errInvalidStorageProof, e.Proof)
+}
@@ -84,6 +84,20 @@ func GenerateCipherKey(cipherCode uint8) (CipherKey, error) {
 	}
 }
 
+// DeriveCipherKey derives a subkey of the same type as the master key with the nonce. The
+// derivation is deterministic, and the subkeys derived with different nonces are independent.
+// The plain cipher key derives itself
+func DeriveCipherKey(master CipherKey, nonce []byte) (CipherKey, error) {
+	switch code := CipherCodeByName(master.CodeName()); code {
+	case PlainCipherCode:
+		return master, nil
+	case GCMCipherCode:
+		return NewCipherKey(code, Keccak256(master.Key(), nonce))
+	default:
+		return nil, ErrInvalidCipherCode
+	}
+}
+
 // Overhead return the size of the overhead for a cipher type specified by cipherCode
 func Overhead(cipherCode uint8) uint8 {
 	switch cipherCode {
@@ -388,6 +388,15 @@ func (s *Ethereum) APIs() []rpc.API {
 			}
 			s.registeredAPIs = append(s.registeredAPIs, storageHostAPIs...)
 		}
+
+		if s.config.StorageClient || s.config.StorageHost {
+			s.registeredAPIs = append(s.registeredAPIs, rpc.API{
+				Namespace: "storage",
+				Version:   "1.0",
+				Service:   NewPrivateStorageAPI(s),
+				Public:    false,
+			})
+		}
 	}
 
 	s.apisOnce.Do(getAPI)
@@ -754,6 +763,19 @@ func (s *Ethereum) RevisionOrRenewingDone(hostID enode.ID) {
 	peer.RevisionOrRenewingDone()
 }
 
+// AbandonOperations abandons all in-flight storage operations with the host. False is
+// returned if the host is not connected
+func (s *Ethereum) AbandonOperations(hostID enode.ID) bool {
+	peerID := fmt.Sprintf("%x", hostID.Bytes()[:8])
+	peer := s.protocolManager.peers.Peer(peerID)
+	if peer == nil {
+		return false
+	}
+
+	peer.AbandonOperations(storage.ErrOperationsAbandoned)
+	return true
+}
+
 // SetupConnection will establish p2p static connection between storage client and storage host
 // only storage is able to initiate the set up connection operation
 func (s *Ethereum) SetupConnection(enodeURL string) (storagePeer storage.Peer, err error) {
@@ -835,9 +857,11 @@ func (s *Ethereum) GetStorageHostSetting(enodeID enode.ID, enodeURL string, conf
 		return fmt.Errorf("received error while waiting for retriving storage host config: %s", err.Error())
 	}
 
-	if err := msg.Decode(config); err != nil {
+	var configMsg storage.HostConfigMsg
+	if err := msg.Decode(&configMsg); err != nil {
 		return fmt.Errorf("error decoding the storage configuration: %s", err.Error())
 	}
+	*config = configMsg.Config
 
 	log.Info("Successfully get the storage host settings")
 
@@ -67,6 +67,23 @@ func (pm *ProtocolManager) clientMsgSchedule(msg p2p.Msg, p *peer) error {
 		}
 	}
 
+	// the pong is discarded similarly if the previous pong is not handled yet,
+	// the ping waiting for it will time out eventually
+	if msg.Code == storage.PongMsg {
+		select {
+		case p.clientPongMsg <- msg:
+			return nil
+		default:
+			return msg.Discard()
+		}
+	}
+
+	// the negotiation message shall be in order with the negotiation, otherwise only the
+	// negotiation is failed
+	if err := p.clientNegotiation.Transit(msg.Code); err != nil {
+		return p.failNegotiation(msg, err)
+	}
+
 	// otherwise, push the message into clientContractMsg channel
 	// similarly, if the channel is full, meaning the previous message
 	// handling was not complete, trigger the error directly because the
@@ -88,6 +105,11 @@ func (pm *ProtocolManager) hostMsgSchedule(msg p2p.Msg, p *peer) error {
 		return pm.hostConfigMsgHandler(p, msg)
 	}
 
+	// the liveness ping is responded right away
+	if msg.Code == storage.PingMsg {
+		return pm.pingMsgHandler(p, msg)
+	}
+
 	// gets the handler based on the message code,
 	// if the handler does not exists, meaning it is not request message
 	// handle it as a dialogue message
@@ -27,6 +27,7 @@ import (
 	"github.com/DxChainNetwork/godx/core/types"
 	"github.com/DxChainNetwork/godx/p2p"
 	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
 	"github.com/DxChainNetwork/godx/storage/coinchargemaintenance"
 	mapset "github.com/deckarep/golang-set"
 )
@@ -108,9 +109,27 @@ type peer struct {
 	contractRevisingOrRenewing chan struct{}
 	hostConfigRequesting       chan struct{}
 
+	// the state of the negotiations where the local node is the client, and where the local
+	// node is the host
+	clientNegotiation storage.NegotiationSession
+	hostNegotiation   storage.NegotiationSession
+
+	// the failure of the negotiation in progress caused by an out of order message received
+	clientNegotiationFailed chan error
+	hostNegotiationFailed   chan error
+
 	// error channel
 	errMsg chan error
 
+	// abandoned is closed when the in-flight storage operations are abandoned
+	abandoned   chan struct{}
+	abandonOnce sync.Once
+
+	// the pong of the liveness ping, and the nonce of the last ping
+	clientPongMsg chan p2p.Msg
+	pingNonce     uint64
+	pingLock      sync.Mutex
+
 	checkPeerStopHook func(*peer) error
 }
 
@@ -135,6 +154,10 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 		errMsg:                     make(chan error, 1),
 		contractRevisingOrRenewing: make(chan struct{}, 1),
 		hostConfigRequesting:       make(chan struct{}, 1),
+		abandoned:                  make(chan struct{}),
+		clientPongMsg:              make(chan p2p.Msg, 1),
+		clientNegotiationFailed:    make(chan error, 1),
+		hostNegotiationFailed:      make(chan error, 1),
 		checkPeerStopHook:          checkPeerStop,
 	}
 }
@@ -15,6 +15,11 @@ func (pm *ProtocolManager) hostConfigMsgHandler(p *peer, configMsg p2p.Msg) erro
 		return err
 	}
 
+	// decode the capabilities of the storage client. The client not advertising
+	// any capabilities is regarded as a legacy client
+	var capabilities storage.Capabilities
+	legacy := configMsg.Decode(&capabilities) != nil
+
 	// start the go routine, handle the host config request
 	// once done, release the channel
 	go func() {
@@ -22,6 +27,12 @@ func (pm *ProtocolManager) hostConfigMsgHandler(p *peer, configMsg p2p.Msg) erro
 		defer pm.wg.Done()
 		defer p.HostConfigProcessingDone()
 		config := pm.eth.storageHost.RetrieveExternalConfig()
+		// the legacy client cannot decode the capabilities, which are not sent
+		if legacy {
+			config.Capabilities = storage.Capabilities{}
+		} else {
+			config.Capabilities = config.Capabilities.Negotiate(capabilities)
+		}
 		if err := p.SendStorageHostConfig(config); err != nil {
 			p.TriggerError(err)
 		}
@@ -30,7 +41,23 @@ func (pm *ProtocolManager) hostConfigMsgHandler(p *peer, configMsg p2p.Msg) erro
 	return nil
 }
 
+// pingMsgHandler responds to the liveness ping with the pong carrying the same nonce. The pong
+// is sent in the read loop, so that a peer responding to the ping is actually handling messages
+func (pm *ProtocolManager) pingMsgHandler(p *peer, pingMsg p2p.Msg) error {
+	var nonce uint64
+	if err := pingMsg.Decode(&nonce); err != nil {
+		return err
+	}
+	return p.SendPong(nonce)
+}
+
 func (pm *ProtocolManager) contractMsgHandler(p *peer, msg p2p.Msg) error {
+	// the negotiation message shall be in order with the negotiation, otherwise only the
+	// negotiation is failed
+	if err := p.hostNegotiation.Transit(msg.Code); err != nil {
+		return p.failNegotiation(msg, err)
+	}
+
 	// send the message to the hostContractMsg channel if the handler
 	// does not exist
 	select {
@@ -53,6 +80,13 @@ func (pm *ProtocolManager) contractReqHandler(handler func(h *storagehost.Storag
 		return err
 	}
 
+	// the request starts the negotiation
+	if err := p.hostNegotiation.Transit(msg.Code); err != nil {
+		p.HostContractProcessingDone()
+		return p.failNegotiation(msg, err)
+	}
+	p.clearNegotiationFailure(msg.Code)
+
 	// start the go routine, handle the host contract request
 	// once done, release the channel
 	go func() {
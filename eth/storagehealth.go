@@ -0,0 +1,40 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package eth
+
+import (
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// StorageHealth returns the overall storage health of the node, combining the health of the
+// storage client and the storage host enabled. It only reads the in-memory state of the
+// subsystems, thus is safe to be called periodically for monitoring
+func (s *Ethereum) StorageHealth() storage.StorageHealth {
+	var health storage.StorageHealth
+	if s.config.StorageClient {
+		clientHealth := s.storageClient.Health()
+		health.Client = &clientHealth
+	}
+	if s.config.StorageHost {
+		hostHealth := s.storageHost.Health()
+		health.Host = &hostHealth
+	}
+	return health
+}
+
+// PrivateStorageAPI provides private RPC methods to monitor the storage subsystems
+type PrivateStorageAPI struct {
+	e *Ethereum
+}
+
+// NewPrivateStorageAPI create a new RPC service to monitor the storage subsystems
+func NewPrivateStorageAPI(e *Ethereum) *PrivateStorageAPI {
+	return &PrivateStorageAPI{e: e}
+}
+
+// Health returns the overall storage health of the storage client and the storage host
+func (api *PrivateStorageAPI) Health() storage.StorageHealth {
+	return api.e.StorageHealth()
+}
@@ -28,17 +28,18 @@ func (p *peer) TriggerError(err error) {
 func (p *peer) SendStorageHostConfig(config storage.HostExtConfig) error {
 	var err error
 	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.HostConfigRespMsg, config)
+		return p2p.Send(p.rw, storage.HostConfigRespMsg, storage.HostConfigMsg{Config: config})
 	}
 	return err
 }
 
 // RequestStorageHostConfig is used when the client is trying to request host's
-// configuration. The HostConfigReqMsg will be sent to the storage host
+// configuration. The HostConfigReqMsg carrying the client's capabilities will be
+// sent to the storage host
 func (p *peer) RequestStorageHostConfig() error {
 	var err error
 	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.HostConfigReqMsg, struct{}{})
+		return p2p.Send(p.rw, storage.HostConfigReqMsg, storage.LocalCapabilities())
 	}
 	return err
 }
@@ -47,108 +48,69 @@ func (p *peer) RequestStorageHostConfig() error {
 // the contract with desired storage host. ContractCreateReqMsg will be sent to the
 // storage host
 func (p *peer) RequestContractCreation(req storage.ContractCreateRequest) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractCreateReqMsg, req)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractCreateReqMsg, req)
 }
 
 // SendContractCreateClientRevisionSig will be used once the storage client drafted and
 // signed a contract revision and requesting the validation and signature from the storage host
 func (p *peer) SendContractCreateClientRevisionSign(revisionSign []byte) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractCreateClientRevisionSign, revisionSign)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractCreateClientRevisionSign, revisionSign)
 }
 
 // SendContractCreationHostSign will be used once the host received the ContractCreateReqMsg
 // message from the client. The host will validated the contract, sign it, and sent back to
 // the storage client
 func (p *peer) SendContractCreationHostSign(contractSign []byte) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractCreateHostSign, contractSign)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractCreateHostSign, contractSign)
 }
 
 // SendContractCreationHostRevisionSign will be used once the host received the revised
 // contract from the storage client. Host will validate it, sign it, and send it back
 func (p *peer) SendContractCreationHostRevisionSign(revisionSign []byte) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractCreateRevisionSign, revisionSign)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractCreateRevisionSign, revisionSign)
 }
 
 // RequestContractUpload is used when the client is trying to upload data
 // to the corresponded storage host. Upload request must be sent to the storage
 // host first
 func (p *peer) RequestContractUpload(req storage.UploadRequest) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractUploadReqMsg, req)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractUploadReqMsg, req)
 }
 
 // SendContractUploadClientRevisionSign will be sent by the storage client
 // once the client received the merkle proof sent by the storage host
 func (p *peer) SendContractUploadClientRevisionSign(revisionSign []byte) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractUploadClientRevisionSign, revisionSign)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractUploadClientRevisionSign, revisionSign)
 }
 
 // SendUploadMerkleProof is sent by the storage host to prove that it has the data
 // that storage client needed
 func (p *peer) SendUploadMerkleProof(merkleProof storage.UploadMerkleProof) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractUploadMerkleProofMsg, merkleProof)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractUploadMerkleProofMsg, merkleProof)
 }
 
 // SendUploadHostRevisionSign will be used once the storage host received the contract upload client
 // revision sign sent by the storage client. Host will validate the revised contract, sign it, and
 // send it back to the storage client
 func (p *peer) SendUploadHostRevisionSign(revisionSign []byte) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractUploadRevisionSign, revisionSign)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractUploadRevisionSign, revisionSign)
 }
 
 // RequestContractDownload will be used when the storage client wants to download
 // data pieces from the corresponded storage host
 func (p *peer) RequestContractDownload(req storage.DownloadRequest) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractDownloadReqMsg, req)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractDownloadReqMsg, req)
 }
 
 // SendContractDownloadData is sent by the client. Data piece requested by the
 // storage client will be included
 func (p *peer) SendContractDownloadData(resp storage.DownloadResponse) error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ContractDownloadDataMsg, resp)
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ContractDownloadDataMsg, resp)
 }
 
 // SendHostBusyHandleRequestErr will send a error message to client, stating that
-// the host is currently busy handling the previous error message
+// the host is currently busy handling the previous error message. The request refused
+// is not admitted to the host negotiation, so the message is sent out of the negotiation
 func (p *peer) SendHostBusyHandleRequestErr() error {
 	var err error
 	if err = p.checkPeerStopHook(p); err == nil {
@@ -157,69 +119,150 @@ func (p *peer) SendHostBusyHandleRequestErr() error {
 	return err
 }
 
-// SendClientNegotiateErrorMsg will send client negotiate error msg
-func (p *peer) SendClientNegotiateErrorMsg() error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ClientNegotiateErrorMsg, storage.ErrClientNegotiate.Error())
-	}
-	return err
+// SendClientNegotiateErrorMsg will send client negotiate error msg with the structured negotiation error
+func (p *peer) SendClientNegotiateErrorMsg(negotiateErr error) error {
+	return p.sendNegotiationMsg(storage.ClientNegotiateErrorMsg, storage.ToNegotiationError(negotiateErr, storage.ErrClientNegotiate))
 }
 
 // SendClientCommitFailedMsg will send a error msg to Host, indicating that client occurs exception
-// when executing 'Commit Action'
-func (p *peer) SendClientCommitFailedMsg() error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ClientCommitFailedMsg, storage.ErrClientCommit.Error())
-	}
-	return err
+// when executing 'Commit Action'. The error is sent as the structured negotiation error
+func (p *peer) SendClientCommitFailedMsg(negotiateErr error) error {
+	return p.sendNegotiationMsg(storage.ClientCommitFailedMsg, storage.ToNegotiationError(negotiateErr, storage.ErrClientCommit))
 }
 
 // SendClientCommitSuccessMsg will send a success msg to Host, indicating that client has no error after 'Commit Action'
 func (p *peer) SendClientCommitSuccessMsg() error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ClientCommitSuccessMsg, "commit success")
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ClientCommitSuccessMsg, "commit success")
 }
 
-// SendClientCommitSuccessMsg will send host commit failed msg to client
-func (p *peer) SendHostCommitFailedMsg() error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.HostCommitFailedMsg, storage.ErrHostCommit.Error())
-	}
-	return err
+// SendHostCommitFailedMsg will send host commit failed msg with the structured negotiation error to client
+func (p *peer) SendHostCommitFailedMsg(negotiateErr error) error {
+	return p.sendNegotiationMsg(storage.HostCommitFailedMsg, storage.ToNegotiationError(negotiateErr, storage.ErrHostCommit))
 }
 
 func (p *peer) SendClientAckMsg() error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.ClientAckMsg, "client ack")
-	}
-	return err
+	return p.sendNegotiationMsg(storage.ClientAckMsg, "client ack")
 }
 
 // SendHostAckMsg will send host ack msg to client as the last negotiate msg no matter what success or failed
 func (p *peer) SendHostAckMsg() error {
-	var err error
-	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.HostAckMsg, "host ack")
+	return p.sendNegotiationMsg(storage.HostAckMsg, "host ack")
+}
+
+// SendHostNegotiateErrorMsg will send host negotiate error msg with the structured negotiation error
+func (p *peer) SendHostNegotiateErrorMsg(negotiateErr error) error {
+	return p.sendNegotiationMsg(storage.HostNegotiateErrorMsg, storage.ToNegotiationError(negotiateErr, storage.ErrHostNegotiate))
+}
+
+// sendNegotiationMsg validates the negotiation message against the state of the negotiation
+// before sending it. The messages handled by the host are sent in the negotiations where the
+// local node is the client, and the messages handled by the client are sent in the negotiations
+// where the local node is the host
+func (p *peer) sendNegotiationMsg(code uint64, data interface{}) error {
+	if err := p.checkPeerStopHook(p); err != nil {
+		return err
 	}
-	return err
+	if err := p.negotiationSession(code, true).Transit(code); err != nil {
+		p.Log().Error("storage negotiation message sent out of order", "err", err)
+		return err
+	}
+	if _, isRequest := hostHandlers[code]; isRequest {
+		p.clearNegotiationFailure(code)
+	}
+	return p2p.Send(p.rw, code, data)
+}
+
+// negotiationSession returns the negotiation session the message belongs to. The messages
+// handled by the host (0x30 to 0x3f) are sent by the client and received by the host
+func (p *peer) negotiationSession(code uint64, send bool) *storage.NegotiationSession {
+	if handledByHost := code >= storage.HostConfigReqMsg; handledByHost == send {
+		return &p.clientNegotiation
+	}
+	return &p.hostNegotiation
 }
 
-// SendHostNegotiateErrorMsg will send host negotiate error msg
-func (p *peer) SendHostNegotiateErrorMsg() error {
+// negotiationFailed returns the channel of the negotiation failure, which is in the same
+// direction as the negotiation session the received message belongs to
+func (p *peer) negotiationFailed(code uint64) chan error {
+	if code >= storage.HostConfigReqMsg {
+		return p.hostNegotiationFailed
+	}
+	return p.clientNegotiationFailed
+}
+
+// failNegotiation handles the negotiation message received out of order. The message is
+// discarded, and only the negotiation in progress is failed: the session is reset, and the
+// operation waiting for the peer's response returns the error. The peer is kept connected
+func (p *peer) failNegotiation(msg p2p.Msg, err error) error {
+	p.Log().Warn("storage negotiation message received out of order", "err", err)
+	if session := p.negotiationSession(msg.Code, false); session.State() != storage.NegotiationIdle {
+		session.Reset()
+		select {
+		case p.negotiationFailed(msg.Code) <- err:
+		default:
+		}
+	}
+	return msg.Discard()
+}
+
+// clearNegotiationFailure clears the failure left by the previous negotiation, which is
+// called once the request starts a new negotiation
+func (p *peer) clearNegotiationFailure(code uint64) {
+	select {
+	case <-p.negotiationFailed(code):
+	default:
+	}
+}
+
+// SendPong responds to the liveness ping of the peer with the nonce of the ping
+func (p *peer) SendPong(nonce uint64) error {
 	var err error
 	if err = p.checkPeerStopHook(p); err == nil {
-		return p2p.Send(p.rw, storage.HostNegotiateErrorMsg, storage.ErrHostNegotiate.Error())
+		return p2p.Send(p.rw, storage.PongMsg, nonce)
 	}
 	return err
 }
 
+// Ping checks the liveness of the peer. The ping carrying a new nonce is sent, and the peer
+// is regarded as live if the pong with the same nonce is received within storage.PingTimeout.
+// The pings are sent one at a time, and the stale pongs of the previous pings are skipped
+func (p *peer) Ping() error {
+	if err := p.checkPeerStopHook(p); err != nil {
+		return err
+	}
+	p.pingLock.Lock()
+	defer p.pingLock.Unlock()
+
+	p.pingNonce++
+	nonce := p.pingNonce
+	timeout := time.After(storage.PingTimeout)
+
+	// send the ping asynchronously, so that the ping is timed out even if the write blocks
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- p2p.Send(p.rw, storage.PingMsg, nonce)
+	}()
+	for {
+		select {
+		case err := <-sendErr:
+			if err != nil {
+				return err
+			}
+		case msg := <-p.clientPongMsg:
+			var pong uint64
+			if err := msg.Decode(&pong); err == nil && pong == nonce {
+				return nil
+			}
+		case <-timeout:
+			return storage.ErrPingTimeout
+		case <-p.abandoned:
+			return storage.ErrOperationsAbandoned
+		case <-p.StopChan():
+			return coinchargemaintenance.ErrProgramExit
+		}
+	}
+}
+
 // WaitConfigResp is used by the storage client, waiting from the configuration
 // response from the storage host
 func (p *peer) WaitConfigResp() (msg p2p.Msg, err error) {
@@ -230,6 +273,9 @@ func (p *peer) WaitConfigResp() (msg p2p.Msg, err error) {
 	case <-timeout:
 		err = errors.New("timeout -> client waits too long for config response from the host")
 		return
+	case <-p.abandoned:
+		err = storage.ErrOperationsAbandoned
+		return
 	case <-p.StopChan():
 		err = coinchargemaintenance.ErrProgramExit
 		return
@@ -243,13 +289,18 @@ func (p *peer) ClientWaitContractResp() (msg p2p.Msg, err error) {
 	select {
 	case msg = <-p.clientContractMsg:
 		return
+	case err = <-p.clientNegotiationFailed:
 	case <-timeout:
 		err = errors.New("timeout -> client waits too long for contract response from the host")
-		return
+	case <-p.abandoned:
+		err = storage.ErrOperationsAbandoned
 	case <-p.StopChan():
 		err = coinchargemaintenance.ErrProgramExit
-		return
 	}
+
+	// the negotiation ends without the host's response, the late response is rejected
+	p.clientNegotiation.Reset()
+	return
 }
 
 // HostWaitContractResp is used by the storage host. The method will block the current
@@ -259,9 +310,14 @@ func (p *peer) HostWaitContractResp() (msg p2p.Msg, err error) {
 	select {
 	case msg = <-p.hostContractMsg:
 		return
+	case err = <-p.hostNegotiationFailed:
+		return
 	case <-timeout:
 		err = errors.New("timeout -> host waits too long for contract response from the host")
 		return
+	case <-p.abandoned:
+		err = storage.ErrOperationsAbandoned
+		return
 	case <-p.StopChan():
 		err = coinchargemaintenance.ErrProgramExit
 		return
@@ -306,6 +362,8 @@ func (p *peer) HostContractProcessing() error {
 // HostContractProcessingDone is used to indicate that storage host finished processing
 // the client's contract request, and is ready for the next request
 func (p *peer) HostContractProcessingDone() {
+	// the negotiation ends with the handling, whether or not the last message is sent
+	p.hostNegotiation.Reset()
 	select {
 	case <-p.hostContractProcessing:
 		return
@@ -354,6 +412,28 @@ func (p *peer) RequestHostConfigDone() {
 	}
 }
 
+// AbandonOperations abandons all in-flight storage operations with the peer. The error is
+// triggered to break the readLoop, the operations waiting for the peer's response return
+// immediately, and all negotiation gates are released. The peer is disconnected afterwards
+func (p *peer) AbandonOperations(err error) {
+	p.TriggerError(err)
+	p.abandonOnce.Do(func() {
+		close(p.abandoned)
+	})
+	p.clientNegotiation.Reset()
+	p.hostNegotiation.Reset()
+
+	// release the gates regardless of whether they are acquired
+	for _, gate := range []chan struct{}{p.contractRevisingOrRenewing, p.hostConfigRequesting,
+		p.hostConfigProcessing, p.hostContractProcessing} {
+		select {
+		case <-gate:
+		default:
+		}
+	}
+	p.Disconnect(p2p.DiscRequested)
+}
+
 // IsStaticConn checks if the connection is static connection
 func (p *peer) IsStaticConn() bool {
 	return p.Peer.Info().Network.Static
@@ -0,0 +1,202 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package eth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/p2p"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestPeer_AbandonOperations test abandoning the operations of a wedged peer returns the waiting
+// operation promptly, releases the negotiation gates and triggers the error to break the readLoop
+func TestPeer_AbandonOperations(t *testing.T) {
+	_, net := p2p.MsgPipe()
+	var id enode.ID
+	rand.Read(id[:])
+	p := newPeer(eth63, p2p.NewPeer(id, "wedged", nil), net)
+
+	// wedge the peer: the gates are held and the client waits for a response never sent
+	if !p.TryToRenewOrRevise() {
+		t.Fatal("failed to acquire the revising gate")
+	}
+	if err := p.TryRequestHostConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.HostContractProcessing(); err != nil {
+		t.Fatal(err)
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := p.ClientWaitContractResp()
+		waitErr <- err
+	}()
+
+	p.AbandonOperations(storage.ErrOperationsAbandoned)
+	select {
+	case err := <-waitErr:
+		if err != storage.ErrOperationsAbandoned {
+			t.Errorf("expect error %v, got %v", storage.ErrOperationsAbandoned, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the waiting operation is not abandoned promptly")
+	}
+
+	select {
+	case err := <-p.errMsg:
+		if err != storage.ErrOperationsAbandoned {
+			t.Errorf("expect triggered error %v, got %v", storage.ErrOperationsAbandoned, err)
+		}
+	default:
+		t.Error("the error is not triggered")
+	}
+	if !p.TryToRenewOrRevise() {
+		t.Error("the revising gate is not released")
+	}
+	if err := p.TryRequestHostConfig(); err != nil {
+		t.Errorf("the config requesting gate is not released: %v", err)
+	}
+	if err := p.HostContractProcessing(); err != nil {
+		t.Errorf("the contract processing gate is not released: %v", err)
+	}
+
+	// abandoning again shall not panic
+	p.AbandonOperations(storage.ErrOperationsAbandoned)
+}
+
+// TestPeer_Ping test pinging a live peer receives the pong promptly, and pinging a dead peer
+// which never reads the messages is detected by the timeout
+func TestPeer_Ping(t *testing.T) {
+	defer func(timeout time.Duration) { storage.PingTimeout = timeout }(storage.PingTimeout)
+	storage.PingTimeout = 200 * time.Millisecond
+
+	pm := &ProtocolManager{}
+	clientRW, hostRW := p2p.MsgPipe()
+	defer clientRW.Close()
+	client, host := newTestStoragePeer("client", clientRW), newTestStoragePeer("host", hostRW)
+
+	// both peers dispatch the messages received as the read loop does
+	dispatch := func(p *peer, rw p2p.MsgReader) {
+		for {
+			msg, err := rw.ReadMsg()
+			if err != nil {
+				return
+			}
+			if err = pm.msgDispatch(msg, p); err != nil {
+				return
+			}
+		}
+	}
+	go dispatch(client, clientRW)
+	go dispatch(host, hostRW)
+
+	for i := 0; i != 3; i++ {
+		start := time.Now()
+		if err := client.Ping(); err != nil {
+			t.Fatalf("ping %d: live peer not detected: %v", i, err)
+		}
+		if elapsed := time.Since(start); elapsed >= storage.PingTimeout {
+			t.Errorf("ping %d: pong received after %v", i, elapsed)
+		}
+	}
+
+	// the dead peer never reads the ping
+	deadRW, _ := p2p.MsgPipe()
+	defer deadRW.Close()
+	dead := newTestStoragePeer("dead", deadRW)
+	start := time.Now()
+	if err := dead.Ping(); err != storage.ErrPingTimeout {
+		t.Fatalf("expect error %v, got %v", storage.ErrPingTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed > storage.PingTimeout+time.Second {
+		t.Errorf("dead peer detected after %v", elapsed)
+	}
+}
+
+// newTestStoragePeer creates a peer with a random id communicating through the rw
+func newTestStoragePeer(name string, rw p2p.MsgReadWriter) *peer {
+	var id enode.ID
+	rand.Read(id[:])
+	return newPeer(eth63, p2p.NewPeer(id, name, nil), rw)
+}
+
+// TestPeer_NegotiationOrder test the negotiation messages sent out of order are rejected, the
+// messages received out of order fail the negotiation only, and the messages in order are delivered
+func TestPeer_NegotiationOrder(t *testing.T) {
+	pm := &ProtocolManager{}
+	clientRW, hostRW := p2p.MsgPipe()
+	defer clientRW.Close()
+	client := newTestStoragePeer("client", clientRW)
+
+	// the commit without a negotiation is not sent
+	err := client.SendClientCommitSuccessMsg()
+	if _, ok := err.(*storage.NegotiationStateError); !ok {
+		t.Fatalf("expect the negotiation state error, got %v", err)
+	}
+
+	// the request and the response in order are delivered
+	received := make(chan p2p.Msg, 1)
+	go func() {
+		msg, err := hostRW.ReadMsg()
+		if err == nil {
+			msg.Discard()
+			received <- msg
+		}
+	}()
+	if err = client.RequestContractDownload(storage.DownloadRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-received; msg.Code != storage.ContractDownloadReqMsg {
+		t.Fatalf("expect the download request sent, got message 0x%x", msg.Code)
+	}
+	if err = pm.msgDispatch(p2p.Msg{Code: storage.ContractDownloadDataMsg}, client); err != nil {
+		t.Fatalf("download data in order rejected: %v", err)
+	}
+	if msg, err := client.ClientWaitContractResp(); err != nil || msg.Code != storage.ContractDownloadDataMsg {
+		t.Fatalf("download data not delivered: %v", err)
+	}
+
+	// the response of another negotiation is discarded and fails only the negotiation, and
+	// the client waiting for the response returns the error
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := client.ClientWaitContractResp()
+		waitErr <- err
+	}()
+	if err = pm.msgDispatch(p2p.Msg{Code: storage.ContractUploadRevisionSign, Payload: bytes.NewReader(nil)}, client); err != nil {
+		t.Fatalf("the out of order message drops the peer: %v", err)
+	}
+	select {
+	case err = <-waitErr:
+		if _, ok := err.(*storage.NegotiationStateError); !ok {
+			t.Errorf("expect the negotiation state error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the negotiation is not failed promptly")
+	}
+	select {
+	case msg := <-client.clientContractMsg:
+		t.Fatalf("the out of order message 0x%x is delivered", msg.Code)
+	default:
+	}
+	if state := client.clientNegotiation.State(); state != storage.NegotiationIdle {
+		t.Errorf("expect state %v, got %v", storage.NegotiationIdle, state)
+	}
+
+	// the out of order message without a negotiation is discarded as well
+	if err = pm.msgDispatch(p2p.Msg{Code: storage.HostAckMsg, Payload: bytes.NewReader(nil)}, client); err != nil {
+		t.Fatalf("the out of order message drops the peer: %v", err)
+	}
+	select {
+	case err = <-client.clientNegotiationFailed:
+		t.Fatalf("the failure %v is left without a negotiation", err)
+	default:
+	}
+}
@@ -88,7 +88,7 @@ var scr = types.StorageContractRevision{
 
 var spf = types.StorageProof{
 	ParentID: sc.RLPHash(),
-	Segment:  [64]byte{},
+	Segment:  make([]byte, 64),
 	HashSet: []common.Hash{
 		common.HexToHash("0000000001"),
 		common.HexToHash("0000000002"),
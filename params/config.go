@@ -127,16 +127,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, big.NewInt(0), big.NewInt(0), 0, big.NewInt(0), 0, new(EthashConfig), nil, nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, big.NewInt(0), big.NewInt(0), 0, big.NewInt(0), 0, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, big.NewInt(0), big.NewInt(0), 0, big.NewInt(0), 0, new(EthashConfig), nil, nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -176,6 +176,27 @@ type ChainConfig struct {
 	ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty"` // Constantinople switch block (nil = no fork, 0 = already activated)
 	EWASMBlock          *big.Int `json:"ewasmBlock,omitempty"`          // EWASM switch block (nil = no fork, 0 = already activated)
 
+	// StorageSegmentSizeBlock is the block from which the storage contract could declare the
+	// segment size of the storage proof (nil = no fork, 0 = already activated)
+	StorageSegmentSizeBlock *big.Int `json:"storageSegmentSizeBlock,omitempty"`
+
+	// StorageCollateralBlock is the block from which the host collateral of the storage contract
+	// must take at least MinHostCollateralPercentage percent of the payout (nil = no fork, 0 = already activated)
+	StorageCollateralBlock *big.Int `json:"storageCollateralBlock,omitempty"`
+
+	// MinHostCollateralPercentage is the minimum percentage of the storage contract payout the host
+	// collateral must take after the storage collateral fork (0 = DefaultMinHostCollateralPercentage)
+	MinHostCollateralPercentage uint64 `json:"minHostCollateralPercentage,omitempty"`
+
+	// StorageDurationBlock is the block from which the window end of the storage contract and its
+	// revisions must be within StorageContractMaxDuration blocks of the current block (nil = no fork,
+	// 0 = already activated)
+	StorageDurationBlock *big.Int `json:"storageDurationBlock,omitempty"`
+
+	// StorageContractMaxDuration is the max number of blocks from the current block to the window end
+	// of the storage contract after the storage duration fork (0 = DefaultMaxContractDuration)
+	StorageContractMaxDuration uint64 `json:"storageContractMaxDuration,omitempty"`
+
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
@@ -268,6 +289,47 @@ func (c *ChainConfig) IsEWASM(num *big.Int) bool {
 	return isForked(c.EWASMBlock, num)
 }
 
+// IsStorageSegmentSize returns whether num is either equal to the storage segment size fork
+// block or greater
+func (c *ChainConfig) IsStorageSegmentSize(num *big.Int) bool {
+	return isForked(c.StorageSegmentSizeBlock, num)
+}
+
+// IsStorageCollateral returns whether num is either equal to the storage collateral fork block
+// or greater
+func (c *ChainConfig) IsStorageCollateral(num *big.Int) bool {
+	return isForked(c.StorageCollateralBlock, num)
+}
+
+// MinHostCollateral returns the minimum percentage of the storage contract payout the host
+// collateral must take at block num. Zero is returned before the storage collateral fork
+func (c *ChainConfig) MinHostCollateral(num *big.Int) uint64 {
+	if !c.IsStorageCollateral(num) {
+		return 0
+	}
+	if c.MinHostCollateralPercentage == 0 {
+		return DefaultMinHostCollateralPercentage
+	}
+	return c.MinHostCollateralPercentage
+}
+
+// IsStorageDuration returns whether num is either equal to the storage duration fork block or greater
+func (c *ChainConfig) IsStorageDuration(num *big.Int) bool {
+	return isForked(c.StorageDurationBlock, num)
+}
+
+// MaxContractDuration returns the max number of blocks from the block num to the window end of the
+// storage contract. Zero is returned before the storage duration fork, where the duration is unbounded
+func (c *ChainConfig) MaxContractDuration(num *big.Int) uint64 {
+	if !c.IsStorageDuration(num) {
+		return 0
+	}
+	if c.StorageContractMaxDuration == 0 {
+		return DefaultMaxContractDuration
+	}
+	return c.StorageContractMaxDuration
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -336,6 +398,21 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.EWASMBlock, newcfg.EWASMBlock, head) {
 		return newCompatError("ewasm fork block", c.EWASMBlock, newcfg.EWASMBlock)
 	}
+	if isForkIncompatible(c.StorageSegmentSizeBlock, newcfg.StorageSegmentSizeBlock, head) {
+		return newCompatError("storage segment size fork block", c.StorageSegmentSizeBlock, newcfg.StorageSegmentSizeBlock)
+	}
+	if isForkIncompatible(c.StorageCollateralBlock, newcfg.StorageCollateralBlock, head) {
+		return newCompatError("storage collateral fork block", c.StorageCollateralBlock, newcfg.StorageCollateralBlock)
+	}
+	if c.IsStorageCollateral(head) && c.MinHostCollateral(head) != newcfg.MinHostCollateral(head) {
+		return newCompatError("min host collateral percentage", c.StorageCollateralBlock, newcfg.StorageCollateralBlock)
+	}
+	if isForkIncompatible(c.StorageDurationBlock, newcfg.StorageDurationBlock, head) {
+		return newCompatError("storage duration fork block", c.StorageDurationBlock, newcfg.StorageDurationBlock)
+	}
+	if c.IsStorageDuration(head) && c.MaxContractDuration(head) != newcfg.MaxContractDuration(head) {
+		return newCompatError("storage contract max duration", c.StorageDurationBlock, newcfg.StorageDurationBlock)
+	}
 	return nil
 }
 
@@ -16,7 +16,11 @@
 
 package params
 
-import "math/big"
+import (
+	"math/big"
+
+	"github.com/DxChainNetwork/godx/common/unit"
+)
 
 const (
 	GasLimitBoundDivisor uint64 = 1024    // The bound divisor of the gas limit, used in update calculations.
@@ -92,6 +96,19 @@ const (
 	DecodeGas               uint64 = 1000  // the gas for rlp decoding
 )
 
+const (
+	// DefaultMinHostCollateralPercentage is the minimum percentage of the storage contract payout
+	// that the host collateral must take after the storage collateral fork, if not configured in
+	// the chain config. It protects the client from the host risking nothing
+	DefaultMinHostCollateralPercentage uint64 = 5
+
+	// DefaultMaxContractDuration is the maximum number of blocks from the current block to the
+	// window end of a storage contract after the storage duration fork, if not configured in the
+	// chain config. It bounds how long the collateral could be locked, and must be no less than
+	// the max duration advertised by the storage hosts plus the proof window
+	DefaultMaxContractDuration uint64 = 5 * unit.BlocksPerYear
+)
+
 var (
 	DifficultyBoundDivisor = big.NewInt(2048)   // The bound divisor of the difficulty, used in the update calculations.
 	GenesisDifficulty      = big.NewInt(131072) // Difficulty of the Genesis block.
@@ -0,0 +1,234 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"io"
+
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+const (
+	// CapabilitiesVersion is the version of the capabilities descriptor. The peer not
+	// advertising any capabilities is regarded as version 0
+	CapabilitiesVersion uint32 = 2
+
+	// StorageProtocolVersion is the version of the storage negotiation protocol
+	StorageProtocolVersion uint32 = 1
+
+	// CompressionNone is the compression that transfers the data as is
+	CompressionNone = "none"
+
+	// FeatureDeferredFunding is the feature of forming the contract with the minimal funding,
+	// which is funded later by renewing the contract before the data is uploaded
+	FeatureDeferredFunding = "deferredFunding"
+
+	// FeaturePing is the feature of responding to the liveness ping with a pong
+	FeaturePing = "ping"
+
+	// FeatureVirtualSector is the feature of appending a sector already stored for the same
+	// contract as a virtual sector, without transferring the sector data again
+	FeatureVirtualSector = "virtualSector"
+
+	// FeatureDeleteSector is the feature of deleting the sectors stored for the contract, so that
+	// the storage is reclaimed before the contract expires
+	FeatureDeleteSector = "deleteSector"
+
+	// FeatureSectorRoots is the feature of verifying the appended sector data against the
+	// merkle roots declared in the upload request
+	FeatureSectorRoots = "sectorRoots"
+)
+
+// Capabilities is the descriptor of the features supported by a storage client or a storage
+// host. Each list is ordered by the preference, the first being the most preferred. The
+// features are encoded as the tail, so that the peer of version 1 could still be decoded
+type Capabilities struct {
+	Version          uint32   `json:"version"`
+	ErasureCodeTypes []uint8  `json:"erasureCodeTypes"`
+	CipherCodes      []uint8  `json:"cipherCodes"`
+	ProtocolVersions []uint32 `json:"protocolVersions"`
+	Compressions     []string `json:"compressions"`
+	Features         []string `json:"features" rlp:"tail"`
+}
+
+// LocalCapabilities returns the capabilities supported by the local node
+func LocalCapabilities() Capabilities {
+	return Capabilities{
+		Version:          CapabilitiesVersion,
+		ErasureCodeTypes: []uint8{erasurecode.ECTypeStandard, erasurecode.ECTypeShard},
+		CipherCodes:      []uint8{crypto.GCMCipherCode, crypto.PlainCipherCode},
+		ProtocolVersions: []uint32{StorageProtocolVersion},
+		Compressions:     []string{CompressionNone},
+		Features:         []string{FeatureDeferredFunding, FeaturePing, FeatureVirtualSector, FeatureDeleteSector, FeatureSectorRoots},
+	}
+}
+
+// LegacyCapabilities returns the capabilities of the peer not advertising any capabilities,
+// which are the features supported before the capabilities are introduced
+func LegacyCapabilities() Capabilities {
+	return Capabilities{
+		Version:          0,
+		ErasureCodeTypes: []uint8{erasurecode.ECTypeStandard, erasurecode.ECTypeShard},
+		CipherCodes:      []uint8{crypto.GCMCipherCode, crypto.PlainCipherCode},
+		ProtocolVersions: []uint32{StorageProtocolVersion},
+		Compressions:     []string{CompressionNone},
+	}
+}
+
+// Negotiate returns the capabilities supported by both the local and the remote peer. The
+// version is the lower one of the two, and the lists keep the preference of the local peer
+func (c Capabilities) Negotiate(remote Capabilities) Capabilities {
+	negotiated := Capabilities{
+		Version: c.Version,
+	}
+	if remote.Version < negotiated.Version {
+		negotiated.Version = remote.Version
+	}
+	for _, ecType := range c.ErasureCodeTypes {
+		if remote.SupportErasureCodeType(ecType) {
+			negotiated.ErasureCodeTypes = append(negotiated.ErasureCodeTypes, ecType)
+		}
+	}
+	for _, cipherCode := range c.CipherCodes {
+		if remote.SupportCipherCode(cipherCode) {
+			negotiated.CipherCodes = append(negotiated.CipherCodes, cipherCode)
+		}
+	}
+	for _, version := range c.ProtocolVersions {
+		if remote.SupportProtocolVersion(version) {
+			negotiated.ProtocolVersions = append(negotiated.ProtocolVersions, version)
+		}
+	}
+	for _, compression := range c.Compressions {
+		if remote.SupportCompression(compression) {
+			negotiated.Compressions = append(negotiated.Compressions, compression)
+		}
+	}
+	for _, feature := range c.Features {
+		if remote.SupportFeature(feature) {
+			negotiated.Features = append(negotiated.Features, feature)
+		}
+	}
+	return negotiated
+}
+
+// SupportErasureCodeType returns whether the erasure code type is supported
+func (c Capabilities) SupportErasureCodeType(ecType uint8) bool {
+	for _, t := range c.ErasureCodeTypes {
+		if t == ecType {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportCipherCode returns whether the cipher code is supported
+func (c Capabilities) SupportCipherCode(cipherCode uint8) bool {
+	for _, code := range c.CipherCodes {
+		if code == cipherCode {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportProtocolVersion returns whether the storage protocol version is supported
+func (c Capabilities) SupportProtocolVersion(version uint32) bool {
+	for _, v := range c.ProtocolVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportCompression returns whether the compression is supported
+func (c Capabilities) SupportCompression(compression string) bool {
+	for _, comp := range c.Compressions {
+		if comp == compression {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportFeature returns whether the feature is supported
+func (c Capabilities) SupportFeature(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmpty returns whether no capabilities are advertised, which is the case of a legacy peer
+func (c Capabilities) isEmpty() bool {
+	return c.Version == 0 && len(c.ErasureCodeTypes) == 0 && len(c.CipherCodes) == 0 &&
+		len(c.ProtocolVersions) == 0 && len(c.Compressions) == 0 && len(c.Features) == 0
+}
+
+// HostConfigMsg is the message of the storage host config sent to the storage client. The
+// Capabilities of the config is encoded after the fields of the legacy config, and only if
+// not empty, so that the config sent to a legacy client is encoded the same as the config of
+// a legacy host
+type HostConfigMsg struct {
+	Config HostExtConfig
+}
+
+// EncodeRLP of HostConfigMsg implements rlp encode rule
+func (m HostConfigMsg) EncodeRLP(w io.Writer) error {
+	fields := m.Config.legacyFields()
+	if !m.Config.Capabilities.isEmpty() {
+		fields = append(fields, &m.Config.Capabilities)
+	}
+	return rlp.Encode(w, fields)
+}
+
+// DecodeRLP of HostConfigMsg implements rlp decode rule. The config of a legacy host has no
+// Capabilities encoded, which is decoded as empty
+func (m *HostConfigMsg) DecodeRLP(st *rlp.Stream) error {
+	if _, err := st.List(); err != nil {
+		return err
+	}
+	m.Config = HostExtConfig{}
+	for _, field := range m.Config.legacyFields() {
+		if err := st.Decode(field); err != nil {
+			return err
+		}
+	}
+	if err := st.Decode(&m.Config.Capabilities); err != nil && err != rlp.EOL {
+		return err
+	}
+	return st.ListEnd()
+}
+
+// legacyFields returns the pointers to the fields of the config known by the legacy peers, in
+// the order they are encoded. A field added to HostExtConfig is not encoded unless listed here
+// or after the Capabilities in HostConfigMsg
+func (c *HostExtConfig) legacyFields() []interface{} {
+	return []interface{}{
+		&c.AcceptingContracts,
+		&c.MaxDownloadBatchSize,
+		&c.MaxDuration,
+		&c.MaxReviseBatchSize,
+		&c.PaymentAddress,
+		&c.RemainingStorage,
+		&c.SectorSize,
+		&c.TotalStorage,
+		&c.WindowSize,
+		&c.Deposit,
+		&c.MaxDeposit,
+		&c.BaseRPCPrice,
+		&c.ContractPrice,
+		&c.DownloadBandwidthPrice,
+		&c.SectorAccessPrice,
+		&c.StoragePrice,
+		&c.UploadBandwidthPrice,
+		&c.Version,
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/rlp"
+)
+
+// TestCapabilities_Negotiate test two peers negotiate the intersection of their capabilities,
+// keeping the preference of the local peer and the lower version
+func TestCapabilities_Negotiate(t *testing.T) {
+	client := Capabilities{
+		Version:          2,
+		ErasureCodeTypes: []uint8{3, 1, 2},
+		CipherCodes:      []uint8{2, 1},
+		ProtocolVersions: []uint32{2, 1},
+		Compressions:     []string{"snappy", CompressionNone},
+	}
+	host := Capabilities{
+		Version:          1,
+		ErasureCodeTypes: []uint8{1, 2},
+		CipherCodes:      []uint8{1, 2},
+		ProtocolVersions: []uint32{1},
+		Compressions:     []string{CompressionNone},
+	}
+	tests := []struct {
+		local, remote Capabilities
+		expect        Capabilities
+	}{
+		{
+			local:  client,
+			remote: host,
+			expect: Capabilities{
+				Version:          1,
+				ErasureCodeTypes: []uint8{1, 2},
+				CipherCodes:      []uint8{2, 1},
+				ProtocolVersions: []uint32{1},
+				Compressions:     []string{CompressionNone},
+			},
+		},
+		{
+			local:  host,
+			remote: client,
+			expect: Capabilities{
+				Version:          1,
+				ErasureCodeTypes: []uint8{1, 2},
+				CipherCodes:      []uint8{1, 2},
+				ProtocolVersions: []uint32{1},
+				Compressions:     []string{CompressionNone},
+			},
+		},
+		{
+			local:  client,
+			remote: Capabilities{Version: 1, CipherCodes: []uint8{3}},
+			expect: Capabilities{Version: 1},
+		},
+		{
+			local:  LocalCapabilities(),
+			remote: LegacyCapabilities(),
+			expect: func() Capabilities {
+				expect := LocalCapabilities()
+				expect.Version = 0
+				expect.Features = nil
+				return expect
+			}(),
+		},
+	}
+	for i, test := range tests {
+		negotiated := test.local.Negotiate(test.remote)
+		if !reflect.DeepEqual(negotiated, test.expect) {
+			t.Errorf("test %d: negotiated capabilities not expected.\n\texpect %+v\n\tgot %+v", i, test.expect, negotiated)
+		}
+	}
+}
+
+// TestCapabilities_EncodeDecode test the capabilities sent in the handshake is decoded as is,
+// and the legacy request without capabilities cannot be decoded as capabilities
+func TestCapabilities_EncodeDecode(t *testing.T) {
+	b, err := rlp.EncodeToBytes(LocalCapabilities())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Capabilities
+	if err = rlp.DecodeBytes(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, LocalCapabilities()) {
+		t.Errorf("decoded capabilities not expected.\n\texpect %+v\n\tgot %+v", LocalCapabilities(), decoded)
+	}
+
+	legacy, err := rlp.EncodeToBytes(struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rlp.DecodeBytes(legacy, &decoded); err == nil {
+		t.Errorf("legacy request is expected not to be decoded as capabilities")
+	}
+}
+
+// legacyHostExtConfig is the layout of the HostExtConfig sent by a host not advertising the
+// capabilities
+type legacyHostExtConfig struct {
+	AcceptingContracts     bool
+	MaxDownloadBatchSize   uint64
+	MaxDuration            uint64
+	MaxReviseBatchSize     uint64
+	PaymentAddress         common.Address
+	RemainingStorage       uint64
+	SectorSize             uint64
+	TotalStorage           uint64
+	WindowSize             uint64
+	Deposit                common.BigInt
+	MaxDeposit             common.BigInt
+	BaseRPCPrice           common.BigInt
+	ContractPrice          common.BigInt
+	DownloadBandwidthPrice common.BigInt
+	SectorAccessPrice      common.BigInt
+	StoragePrice           common.BigInt
+	UploadBandwidthPrice   common.BigInt
+	Version                string
+}
+
+// TestHostConfigMsg_EncodeDecode test the config of a legacy host is decoded without the
+// capabilities, the config without the capabilities is encoded the same as a legacy host, and
+// the config with the capabilities is decoded as is
+func TestHostConfigMsg_EncodeDecode(t *testing.T) {
+	legacy := legacyHostExtConfig{
+		AcceptingContracts:     true,
+		MaxDownloadBatchSize:   17,
+		MaxDuration:            144,
+		MaxReviseBatchSize:     17,
+		PaymentAddress:         common.HexToAddress("0x1"),
+		RemainingStorage:       1 << 30,
+		SectorSize:             1 << 22,
+		TotalStorage:           1 << 40,
+		WindowSize:             5,
+		Deposit:                common.NewBigIntUint64(1),
+		MaxDeposit:             common.NewBigIntUint64(2),
+		BaseRPCPrice:           common.NewBigIntUint64(3),
+		ContractPrice:          common.NewBigIntUint64(4),
+		DownloadBandwidthPrice: common.NewBigIntUint64(5),
+		SectorAccessPrice:      common.NewBigIntUint64(6),
+		StoragePrice:           common.NewBigIntUint64(7),
+		UploadBandwidthPrice:   common.NewBigIntUint64(8),
+		Version:                "1.0.1",
+	}
+	legacyBytes, err := rlp.EncodeToBytes(&legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg HostConfigMsg
+	if err = rlp.DecodeBytes(legacyBytes, &msg); err != nil {
+		t.Fatal(err)
+	}
+	config := msg.Config
+	if !config.Capabilities.isEmpty() {
+		t.Errorf("legacy config decoded with capabilities %+v", config.Capabilities)
+	}
+	if config.MaxDuration != legacy.MaxDuration || config.Version != legacy.Version ||
+		config.UploadBandwidthPrice.Cmp(legacy.UploadBandwidthPrice) != 0 {
+		t.Errorf("legacy config not decoded as expected: %+v", config)
+	}
+
+	b, err := rlp.EncodeToBytes(HostConfigMsg{Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, legacyBytes) {
+		t.Errorf("config without capabilities not encoded as a legacy config")
+	}
+
+	config.Capabilities = LocalCapabilities()
+	if b, err = rlp.EncodeToBytes(HostConfigMsg{Config: config}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded HostConfigMsg
+	if err = rlp.DecodeBytes(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Config, config) {
+		t.Errorf("config not expected.\n\texpect %+v\n\tgot %+v", config, decoded.Config)
+	}
+}
+
+// TestHostExtConfig_LegacyFields test all fields of HostExtConfig other than the Capabilities
+// are encoded in HostConfigMsg, so that a field added to the config is not silently dropped
+func TestHostExtConfig_LegacyFields(t *testing.T) {
+	var config HostExtConfig
+	encoded := make(map[uintptr]bool)
+	for _, field := range config.legacyFields() {
+		encoded[reflect.ValueOf(field).Pointer()] = true
+	}
+	v := reflect.ValueOf(&config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if name == "Capabilities" {
+			continue
+		}
+		if !encoded[v.Field(i).Addr().Pointer()] {
+			t.Errorf("field %v of HostExtConfig is not encoded", name)
+		}
+	}
+	if len(encoded) != v.NumField()-1 {
+		t.Errorf("number of legacy fields not expected: expect %v, got %v", v.NumField()-1, len(encoded))
+	}
+}
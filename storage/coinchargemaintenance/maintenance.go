@@ -33,6 +33,10 @@ var (
 	// KeyFileSize is the key to store file size into trie
 	KeyFileSize = common.BytesToHash([]byte("FileSize"))
 
+	// KeySegmentSize is the key to store the segment size into trie. It is stored only if the
+	// storage contract declares a segment size other than the default
+	KeySegmentSize = common.BytesToHash([]byte("SegmentSize"))
+
 	// KeyUnlockHash is the key to store unlock hash into trie
 	KeyUnlockHash = common.BytesToHash([]byte("UnlockHash"))
 
@@ -45,6 +45,7 @@ const (
 	HostCommitFailedMsg          = 0x27
 	HostAckMsg                   = 0x28
 	HostNegotiateErrorMsg        = 0x29
+	PongMsg                      = 0x2a
 
 	// Host Handle Message Set
 	HostConfigReqMsg                 = 0x30
@@ -57,6 +58,7 @@ const (
 	ClientCommitFailedMsg            = 0x37
 	ClientAckMsg                     = 0x38
 	ClientNegotiateErrorMsg          = 0x39
+	PingMsg                          = 0x3a
 )
 
 const (
@@ -70,6 +72,10 @@ var (
 	ResponsibilityLockTimeout = 60 * time.Second
 )
 
+// PingTimeout is the timeout of waiting for the pong of a liveness ping. The pong is sent
+// right away by a live peer, so the peer not responding within the timeout is regarded as dead
+var PingTimeout = 5 * time.Second
+
 // Default rentPayment values
 var (
 	DefaultRentPayment = RentPayment{
@@ -92,6 +98,18 @@ var (
 	DefaultMaxDownloadBatchSize = 17 * (1 << 20)         // 17 MB
 	DefaultMaxReviseBatchSize   = 17 * (1 << 20)         // 17 MB
 
+	// DefaultRevisionBatchWindow is the default window for batching the persistence of the
+	// revisions. Zero window only batches the revisions arriving while a write is in progress
+	DefaultRevisionBatchWindow = time.Duration(0)
+
+	// DefaultProofSubmissionMargin is the default number of blocks after the window start the
+	// storage proof is submitted at
+	DefaultProofSubmissionMargin = uint64(3)
+
+	// DefaultReadVerificationRate is the default fraction of the sector reads verified against
+	// the sector root
+	DefaultReadVerificationRate = 0.05
+
 	// deposit defaults value
 	DefaultDeposit       = common.PtrBigInt(math.BigPow(10, 3))  // 173 dx per TB per month
 	DefaultDepositBudget = common.PtrBigInt(math.BigPow(10, 22)) // 10000 DX
@@ -0,0 +1,118 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/p2p"
+)
+
+// NegotiationErrorCode is the code of the negotiation error sent to the other side of the
+// negotiation, which tells why the negotiation failed
+type NegotiationErrorCode uint8
+
+const (
+	// NegotiationErrUnknown is the code of the unclassified negotiation error, and the error
+	// sent by the legacy peer which sends a bare string
+	NegotiationErrUnknown NegotiationErrorCode = iota
+
+	// NegotiationErrInvalidRequest is the code that the request or the response is malformed
+	// or failed the verification. Retrying the same request does not help
+	NegotiationErrInvalidRequest
+
+	// NegotiationErrRejected is the code that the host refuses the negotiation, e.g. not
+	// accepting new contracts. The client shall switch to another host
+	NegotiationErrRejected
+
+	// NegotiationErrUnavailable is the code that the peer is temporarily unable to handle the
+	// negotiation, e.g. the host is draining before shutdown. The negotiation could be retried later
+	NegotiationErrUnavailable
+
+	// NegotiationErrContractNotFound is the code that the storage contract of the negotiation
+	// is not found
+	NegotiationErrContractNotFound
+
+	// NegotiationErrInsufficientFunds is the code that the balance is not enough for the contract
+	NegotiationErrInsufficientFunds
+
+	// NegotiationErrSectorLost is the code that the host has lost the data of the requested
+	// sector. The client shall no longer count the sector as stored on the host, and repair it
+	NegotiationErrSectorLost
+)
+
+// negotiationErrorCodeNames is the mapping from the negotiation error code to name
+var negotiationErrorCodeNames = map[NegotiationErrorCode]string{
+	NegotiationErrUnknown:           "unknown",
+	NegotiationErrInvalidRequest:    "invalid request",
+	NegotiationErrRejected:          "rejected",
+	NegotiationErrUnavailable:       "unavailable",
+	NegotiationErrContractNotFound:  "contract not found",
+	NegotiationErrInsufficientFunds: "insufficient funds",
+	NegotiationErrSectorLost:        "sector lost",
+}
+
+// String returns the name of the negotiation error code
+func (code NegotiationErrorCode) String() string {
+	if name, exist := negotiationErrorCodeNames[code]; exist {
+		return name
+	}
+	return fmt.Sprintf("code %d", uint8(code))
+}
+
+// NegotiationError is the structured payload of the negotiate error and commit failed messages.
+// The legacy peers send a bare string as the payload, which is decoded as a NegotiationError
+// with NegotiationErrUnknown code, and ignore the payload on receiving, so the structured
+// payload is compatible with the legacy peers
+type NegotiationError struct {
+	Code    NegotiationErrorCode
+	Message string
+	Detail  string
+}
+
+// NewNegotiationError creates a negotiation error with the code, message and optional detail
+func NewNegotiationError(code NegotiationErrorCode, message string, detail string) *NegotiationError {
+	return &NegotiationError{
+		Code:    code,
+		Message: message,
+		Detail:  detail,
+	}
+}
+
+// Error returns the message and the detail of the negotiation error
+func (e *NegotiationError) Error() string {
+	if e.Detail == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.Detail)
+}
+
+// Retryable returns whether the failed negotiation could be retried later with the same peer
+func (e *NegotiationError) Retryable() bool {
+	return e.Code == NegotiationErrUnavailable
+}
+
+// ToNegotiationError converts the error to the negotiation error to be sent. Only the code and
+// the fixed message are sent, so that the internal state in the error detail is not exposed to
+// the peer. The errors other than the negotiation error are sent with the NegotiationErrUnknown
+// code, and the legacy error is used as the message
+func ToNegotiationError(err error, legacy error) *NegotiationError {
+	negotiationErr, ok := err.(*NegotiationError)
+	if !ok || negotiationErr.Code == NegotiationErrUnknown {
+		return NewNegotiationError(NegotiationErrUnknown, legacy.Error(), "")
+	}
+	return NewNegotiationError(negotiationErr.Code, legacy.Error(), negotiationErr.Code.String())
+}
+
+// DecodeNegotiationError decodes the negotiation error from the negotiate error or commit
+// failed message. If the message is sent by a legacy peer, the legacy error is returned as the
+// message of a negotiation error with NegotiationErrUnknown code
+func DecodeNegotiationError(msg p2p.Msg, legacy error) *NegotiationError {
+	var negotiationErr NegotiationError
+	if err := msg.Decode(&negotiationErr); err != nil {
+		return NewNegotiationError(NegotiationErrUnknown, legacy.Error(), "")
+	}
+	return &negotiationErr
+}
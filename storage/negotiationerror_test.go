@@ -0,0 +1,54 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/p2p"
+	"github.com/DxChainNetwork/godx/rlp"
+)
+
+// TestDecodeNegotiationError test the negotiation error is round-tripped through the message
+// with the code preserved and the detail not sent, and the bare string sent by the legacy peer
+// is decoded as unknown
+func TestDecodeNegotiationError(t *testing.T) {
+	tests := []struct {
+		payload interface{}
+		expect  NegotiationError
+	}{
+		{
+			payload: ToNegotiationError(NewNegotiationError(NegotiationErrUnavailable, ErrHostNegotiate.Error(), "host is draining"), ErrHostNegotiate),
+			expect:  NegotiationError{Code: NegotiationErrUnavailable, Message: ErrHostNegotiate.Error(), Detail: NegotiationErrUnavailable.String()},
+		},
+		{
+			payload: ToNegotiationError(errors.New("wallet not found"), ErrClientNegotiate),
+			expect:  NegotiationError{Code: NegotiationErrUnknown, Message: ErrClientNegotiate.Error()},
+		},
+		{
+			payload: ToNegotiationError(nil, ErrHostCommit),
+			expect:  NegotiationError{Code: NegotiationErrUnknown, Message: ErrHostCommit.Error()},
+		},
+		{
+			payload: ErrHostNegotiate.Error(),
+			expect:  NegotiationError{Code: NegotiationErrUnknown, Message: ErrHostNegotiate.Error()},
+		},
+	}
+	for i, test := range tests {
+		size, r, err := rlp.EncodeToReader(test.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := p2p.Msg{Code: HostNegotiateErrorMsg, Size: uint32(size), Payload: r}
+		negotiationErr := DecodeNegotiationError(msg, ErrHostNegotiate)
+		if *negotiationErr != test.expect {
+			t.Errorf("test %d: expect %+v, got %+v", i, test.expect, *negotiationErr)
+		}
+		if retryable := test.expect.Code == NegotiationErrUnavailable; negotiationErr.Retryable() != retryable {
+			t.Errorf("test %d: expect retryable %v, got %v", i, retryable, negotiationErr.Retryable())
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"fmt"
+	"sync"
+)
+
+// NegotiationState is the state of a negotiation between the storage client and the storage
+// host, which tells the messages allowed to be sent or received next
+type NegotiationState uint8
+
+const (
+	// NegotiationIdle means no negotiation is in progress. Only the requests are allowed
+	NegotiationIdle NegotiationState = iota
+
+	// NegotiationCreateRequested means the contract create request is sent, and the host is to
+	// send the contract sign
+	NegotiationCreateRequested
+
+	// NegotiationCreateHostSigned means the host signed the contract, and the client is to send
+	// the revision sign
+	NegotiationCreateHostSigned
+
+	// NegotiationCreateClientRevisionSigned means the client signed the revision of the created
+	// contract, and the host is to send the revision sign
+	NegotiationCreateClientRevisionSigned
+
+	// NegotiationUploadRequested means the upload request is sent, and the host is to send the
+	// merkle proof
+	NegotiationUploadRequested
+
+	// NegotiationUploadProofSent means the host sent the merkle proof of the upload, and the
+	// client is to send the revision sign
+	NegotiationUploadProofSent
+
+	// NegotiationUploadClientRevisionSigned means the client signed the upload revision, and the
+	// host is to send the revision sign
+	NegotiationUploadClientRevisionSigned
+
+	// NegotiationDownloadRequested means the download request is sent, and the host is to send
+	// the data
+	NegotiationDownloadRequested
+
+	// NegotiationAwaitingCommit means the host sent its revision sign or the download data, and
+	// the client is to commit the revision
+	NegotiationAwaitingCommit
+
+	// NegotiationClientCommitted means the client committed the revision, and the host is to
+	// commit and send the ack
+	NegotiationClientCommitted
+
+	// NegotiationHostCommitFailed means the host failed to commit after the client committed,
+	// and the client is to send the ack
+	NegotiationHostCommitFailed
+
+	// NegotiationClientAcked means the client acknowledged the failed host commit, and the host
+	// is to send the last ack
+	NegotiationClientAcked
+
+	// NegotiationClosing means the client failed the negotiation or the commit, and the host is
+	// to send the last ack
+	NegotiationClosing
+)
+
+// negotiationStateNames is the mapping from the negotiation state to name
+var negotiationStateNames = map[NegotiationState]string{
+	NegotiationIdle:                       "idle",
+	NegotiationCreateRequested:            "create requested",
+	NegotiationCreateHostSigned:           "create host signed",
+	NegotiationCreateClientRevisionSigned: "create client revision signed",
+	NegotiationUploadRequested:            "upload requested",
+	NegotiationUploadProofSent:            "upload proof sent",
+	NegotiationUploadClientRevisionSigned: "upload client revision signed",
+	NegotiationDownloadRequested:          "download requested",
+	NegotiationAwaitingCommit:             "awaiting commit",
+	NegotiationClientCommitted:            "client committed",
+	NegotiationHostCommitFailed:           "host commit failed",
+	NegotiationClientAcked:                "client acked",
+	NegotiationClosing:                    "closing",
+}
+
+// String returns the name of the negotiation state
+func (state NegotiationState) String() string {
+	if name, exist := negotiationStateNames[state]; exist {
+		return name
+	}
+	return fmt.Sprintf("state %d", uint8(state))
+}
+
+// negotiationMsgNames is the mapping from the code of the negotiation message to name
+var negotiationMsgNames = map[uint64]string{
+	ContractCreateHostSign:           "ContractCreateHostSign",
+	ContractCreateRevisionSign:       "ContractCreateRevisionSign",
+	ContractUploadMerkleProofMsg:     "ContractUploadMerkleProofMsg",
+	ContractUploadRevisionSign:       "ContractUploadRevisionSign",
+	ContractDownloadDataMsg:          "ContractDownloadDataMsg",
+	HostBusyHandleReqMsg:             "HostBusyHandleReqMsg",
+	HostCommitFailedMsg:              "HostCommitFailedMsg",
+	HostAckMsg:                       "HostAckMsg",
+	HostNegotiateErrorMsg:            "HostNegotiateErrorMsg",
+	ContractCreateReqMsg:             "ContractCreateReqMsg",
+	ContractCreateClientRevisionSign: "ContractCreateClientRevisionSign",
+	ContractUploadReqMsg:             "ContractUploadReqMsg",
+	ContractUploadClientRevisionSign: "ContractUploadClientRevisionSign",
+	ContractDownloadReqMsg:           "ContractDownloadReqMsg",
+	ClientCommitSuccessMsg:           "ClientCommitSuccessMsg",
+	ClientCommitFailedMsg:            "ClientCommitFailedMsg",
+	ClientAckMsg:                     "ClientAckMsg",
+	ClientNegotiateErrorMsg:          "ClientNegotiateErrorMsg",
+}
+
+// negotiationMsgName returns the name of the negotiation message code
+func negotiationMsgName(code uint64) string {
+	if name, exist := negotiationMsgNames[code]; exist {
+		return name
+	}
+	return fmt.Sprintf("message 0x%x", code)
+}
+
+// negotiationTransitions is the state the negotiation moves to by each message allowed in the
+// state. A negotiation is started by a request, where the host either refuses it, or responds
+// and waits for the client's signature. After the client commits the revision, the host commits
+// and acknowledges it. Besides:
+//   - the host sends the ack or the negotiate error at its turn to end the negotiation
+//   - the client sends the negotiate error at its turn to end the negotiation, which the host
+//     acknowledges
+//   - the client abandons the negotiation at its turn by starting a new one
+var negotiationTransitions = func() map[NegotiationState]map[uint64]NegotiationState {
+	transitions := map[NegotiationState]map[uint64]NegotiationState{
+		NegotiationIdle: {},
+		NegotiationCreateRequested: {
+			ContractCreateHostSign: NegotiationCreateHostSigned,
+			HostBusyHandleReqMsg:   NegotiationIdle,
+		},
+		NegotiationCreateHostSigned: {
+			ContractCreateClientRevisionSign: NegotiationCreateClientRevisionSigned,
+		},
+		NegotiationCreateClientRevisionSigned: {
+			ContractCreateRevisionSign: NegotiationAwaitingCommit,
+		},
+		NegotiationUploadRequested: {
+			ContractUploadMerkleProofMsg: NegotiationUploadProofSent,
+			HostBusyHandleReqMsg:         NegotiationIdle,
+		},
+		NegotiationUploadProofSent: {
+			ContractUploadClientRevisionSign: NegotiationUploadClientRevisionSigned,
+		},
+		NegotiationUploadClientRevisionSigned: {
+			ContractUploadRevisionSign: NegotiationAwaitingCommit,
+		},
+		NegotiationDownloadRequested: {
+			ContractDownloadDataMsg: NegotiationAwaitingCommit,
+			HostBusyHandleReqMsg:    NegotiationIdle,
+		},
+		NegotiationAwaitingCommit: {
+			ClientCommitSuccessMsg: NegotiationClientCommitted,
+			ClientCommitFailedMsg:  NegotiationClosing,
+		},
+		NegotiationClientCommitted: {
+			HostCommitFailedMsg: NegotiationHostCommitFailed,
+		},
+		NegotiationHostCommitFailed: {
+			ClientAckMsg: NegotiationClientAcked,
+		},
+		NegotiationClientAcked: {},
+		NegotiationClosing:     {},
+	}
+
+	hostTurns := []NegotiationState{NegotiationCreateRequested, NegotiationCreateClientRevisionSigned,
+		NegotiationUploadRequested, NegotiationUploadClientRevisionSigned, NegotiationDownloadRequested,
+		NegotiationClientCommitted, NegotiationClientAcked, NegotiationClosing}
+	for _, state := range hostTurns {
+		transitions[state][HostAckMsg] = NegotiationIdle
+		if state != NegotiationClosing && state != NegotiationClientAcked {
+			transitions[state][HostNegotiateErrorMsg] = NegotiationIdle
+		}
+	}
+
+	clientTurns := []NegotiationState{NegotiationIdle, NegotiationCreateHostSigned, NegotiationUploadProofSent,
+		NegotiationAwaitingCommit, NegotiationHostCommitFailed}
+	for _, state := range clientTurns {
+		transitions[state][ContractCreateReqMsg] = NegotiationCreateRequested
+		transitions[state][ContractUploadReqMsg] = NegotiationUploadRequested
+		transitions[state][ContractDownloadReqMsg] = NegotiationDownloadRequested
+		if state != NegotiationIdle && state != NegotiationHostCommitFailed {
+			transitions[state][ClientNegotiateErrorMsg] = NegotiationClosing
+		}
+	}
+	return transitions
+}()
+
+// NegotiationStateError is the error of a negotiation message sent or received out of order
+type NegotiationStateError struct {
+	State NegotiationState
+	Code  uint64
+}
+
+// Error implements the error interface
+func (e *NegotiationStateError) Error() string {
+	return fmt.Sprintf("negotiation message %s is not allowed in state %s", negotiationMsgName(e.Code), e.State)
+}
+
+// NegotiationSession tracks the state of the negotiations with a peer in one direction, i.e.
+// either the local node is the client or the host of all negotiations tracked. Both the messages
+// sent and received are validated against the allowed transitions. The zero value is an idle
+// session ready to use
+type NegotiationSession struct {
+	state NegotiationState
+	lock  sync.Mutex
+}
+
+// Transit validates the negotiation message against the current state, and moves to the next
+// state. The *NegotiationStateError is returned if the message is out of order, in which case
+// the state is not changed
+func (s *NegotiationSession) Transit(code uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	next, allowed := negotiationTransitions[s.state][code]
+	if !allowed {
+		return &NegotiationStateError{State: s.state, Code: code}
+	}
+	s.state = next
+	return nil
+}
+
+// State returns the current state of the negotiation
+func (s *NegotiationSession) State() NegotiationState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.state
+}
+
+// Reset resets the session to idle, which is used when the negotiation ends without the last
+// message, e.g. timed out or abandoned
+func (s *NegotiationSession) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.state = NegotiationIdle
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"testing"
+)
+
+// TestNegotiationSession_Handshakes test the full negotiations, both succeeded and failed, are
+// driven back to idle through the allowed transitions
+func TestNegotiationSession_Handshakes(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []uint64
+	}{
+		{"contract create", []uint64{ContractCreateReqMsg, ContractCreateHostSign, ContractCreateClientRevisionSign,
+			ContractCreateRevisionSign, ClientCommitSuccessMsg, HostAckMsg}},
+		{"upload", []uint64{ContractUploadReqMsg, ContractUploadMerkleProofMsg, ContractUploadClientRevisionSign,
+			ContractUploadRevisionSign, ClientCommitSuccessMsg, HostAckMsg}},
+		{"download", []uint64{ContractDownloadReqMsg, ContractDownloadDataMsg, ClientCommitSuccessMsg, HostAckMsg}},
+		{"host busy", []uint64{ContractUploadReqMsg, HostBusyHandleReqMsg}},
+		{"host rejects request", []uint64{ContractCreateReqMsg, HostNegotiateErrorMsg}},
+		{"host malformed request", []uint64{ContractDownloadReqMsg, HostAckMsg}},
+		{"client negotiate error", []uint64{ContractUploadReqMsg, ContractUploadMerkleProofMsg, ClientNegotiateErrorMsg, HostAckMsg}},
+		{"client commit failed", []uint64{ContractDownloadReqMsg, ContractDownloadDataMsg, ClientCommitFailedMsg, HostAckMsg}},
+		{"host commit failed", []uint64{ContractUploadReqMsg, ContractUploadMerkleProofMsg, ContractUploadClientRevisionSign,
+			ContractUploadRevisionSign, ClientCommitSuccessMsg, HostCommitFailedMsg, ClientAckMsg, HostAckMsg}},
+		{"client abandons at its turn", []uint64{ContractCreateReqMsg, ContractCreateHostSign, ContractUploadReqMsg,
+			HostNegotiateErrorMsg}},
+	}
+	for _, test := range tests {
+		var s NegotiationSession
+		// each negotiation is run twice to make sure the session is reusable
+		for round := 0; round != 2; round++ {
+			for i, code := range test.messages {
+				if err := s.Transit(code); err != nil {
+					t.Fatalf("%v: message %d: %v", test.name, i, err)
+				}
+			}
+			if s.State() != NegotiationIdle {
+				t.Errorf("%v: expect idle after the negotiation, got %v", test.name, s.State())
+			}
+		}
+	}
+}
+
+// TestNegotiationSession_OutOfOrder test the messages out of order are rejected with the
+// NegotiationStateError, and the state is kept
+func TestNegotiationSession_OutOfOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []uint64
+		expect   NegotiationState
+	}{
+		{"commit without request", []uint64{ClientCommitSuccessMsg}, NegotiationIdle},
+		{"ack without request", []uint64{HostAckMsg}, NegotiationIdle},
+		{"response to another request", []uint64{ContractUploadReqMsg, ContractDownloadDataMsg}, NegotiationUploadRequested},
+		{"request while waiting for host", []uint64{ContractCreateReqMsg, ContractUploadReqMsg}, NegotiationCreateRequested},
+		{"revision sign before host sign", []uint64{ContractCreateReqMsg, ContractCreateClientRevisionSign}, NegotiationCreateRequested},
+		{"commit before host revision sign", []uint64{ContractUploadReqMsg, ContractUploadMerkleProofMsg, ClientCommitSuccessMsg},
+			NegotiationUploadProofSent},
+		{"host busy after response", []uint64{ContractDownloadReqMsg, ContractDownloadDataMsg, HostBusyHandleReqMsg},
+			NegotiationAwaitingCommit},
+		{"client ack without host commit failed", []uint64{ContractDownloadReqMsg, ContractDownloadDataMsg, ClientCommitSuccessMsg,
+			ClientAckMsg}, NegotiationClientCommitted},
+		{"host negotiate error after client failed", []uint64{ContractDownloadReqMsg, ContractDownloadDataMsg, ClientCommitFailedMsg,
+			HostNegotiateErrorMsg}, NegotiationClosing},
+		{"message after the negotiation", []uint64{ContractUploadReqMsg, HostBusyHandleReqMsg, ContractUploadMerkleProofMsg},
+			NegotiationIdle},
+		{"unknown message", []uint64{ContractUploadReqMsg, PongMsg}, NegotiationUploadRequested},
+	}
+	for _, test := range tests {
+		var s NegotiationSession
+		last := len(test.messages) - 1
+		for i, code := range test.messages[:last] {
+			if err := s.Transit(code); err != nil {
+				t.Fatalf("%v: message %d: %v", test.name, i, err)
+			}
+		}
+		err := s.Transit(test.messages[last])
+		stateErr, ok := err.(*NegotiationStateError)
+		if !ok {
+			t.Errorf("%v: expect the negotiation state error, got %v", test.name, err)
+			continue
+		}
+		if stateErr.State != test.expect || stateErr.Code != test.messages[last] {
+			t.Errorf("%v: expect message 0x%x rejected in state %v, got %+v", test.name, test.messages[last], test.expect, stateErr)
+		}
+		if s.State() != test.expect {
+			t.Errorf("%v: expect the state kept as %v, got %v", test.name, test.expect, s.State())
+		}
+	}
+
+	// the reset session starts a new negotiation
+	var s NegotiationSession
+	if err := s.Transit(ContractUploadReqMsg); err != nil {
+		t.Fatal(err)
+	}
+	s.Reset()
+	if err := s.Transit(ContractDownloadReqMsg); err != nil {
+		t.Errorf("reset session does not start a new negotiation: %v", err)
+	}
+}
@@ -16,6 +16,14 @@ import (
 // should not be deducted.
 var ErrRequestingHostConfig = errors.New("host configuration should only be requested one at a time")
 
+// ErrOperationsAbandoned is the error returned by the operations waiting for the peer's response
+// when the in-flight operations with the peer are abandoned by the user
+var ErrOperationsAbandoned = errors.New("in-flight operations with the peer are abandoned")
+
+// ErrPingTimeout is the error returned by Ping when the peer does not respond to the ping
+// within PingTimeout
+var ErrPingTimeout = errors.New("timeout -> peer does not respond to the ping")
+
 // Peer is the interface returned by the SetupConnection. The use of it is to allow eth.peer object
 // to be used in the storage model. All the methods provided in the Peer interface is used for negotiation
 // during the contract create, contract revision, contract renew, and configuration request
@@ -34,13 +42,13 @@ type Peer interface {
 	RequestContractDownload(req DownloadRequest) error
 	SendContractDownloadData(resp DownloadResponse) error
 	SendHostBusyHandleRequestErr() error
-	SendClientNegotiateErrorMsg() error
-	SendClientCommitFailedMsg() error
+	SendClientNegotiateErrorMsg(negotiateErr error) error
+	SendClientCommitFailedMsg(negotiateErr error) error
 	SendClientCommitSuccessMsg() error
-	SendHostCommitFailedMsg() error
+	SendHostCommitFailedMsg(negotiateErr error) error
 	SendClientAckMsg() error
 	SendHostAckMsg() error
-	SendHostNegotiateErrorMsg() error
+	SendHostNegotiateErrorMsg(negotiateErr error) error
 	WaitConfigResp() (p2p.Msg, error)
 	ClientWaitContractResp() (msg p2p.Msg, err error)
 	HostWaitContractResp() (msg p2p.Msg, err error)
@@ -48,6 +56,9 @@ type Peer interface {
 	RevisionOrRenewingDone()
 	TryRequestHostConfig() error
 	RequestHostConfigDone()
+	AbandonOperations(err error)
+	Ping() error
+	SendPong(nonce uint64) error
 	PeerNode() *enode.Node
 	IsStaticConn() bool
 }
@@ -7,12 +7,22 @@ package storage
 import (
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
 	"math/big"
 )
 
 // Defines upload mode
 const (
 	UploadActionAppend = "Append"
+
+	// UploadActionAppendVirtual appends a sector already stored for the contract without
+	// transferring it. The data of the action is the merkle root of the sector
+	UploadActionAppendVirtual = "AppendVirtual"
+
+	// UploadActionDelete deletes a sector stored for the contract. The data of the action is the
+	// merkle root of the sector. The last sector of the contract is moved to the position of the
+	// sector deleted, so that only one leaf of the merkle tree is changed besides the last one
+	UploadActionDelete = "Delete"
 )
 
 type (
@@ -25,6 +35,10 @@ type (
 	}
 
 	// UploadRequest contains the request parameters for RPCUpload.
+	// SectorRoots are the Merkle roots of the sectors appended, in the order of the append actions.
+	// The host rejects the upload if the data does not hash to the declared roots. The field is
+	// empty in the requests of the legacy clients, and in the requests to the hosts not
+	// supporting FeatureSectorRoots
 	UploadRequest struct {
 		StorageContractID common.Hash
 		Actions           []UploadAction
@@ -32,6 +46,8 @@ type (
 		NewRevisionNumber    uint64
 		NewValidProofValues  []*big.Int
 		NewMissedProofValues []*big.Int
+
+		SectorRoots []common.Hash `rlp:"tail"`
 	}
 
 	// UploadAction is a generic Write action. The meaning of each field
@@ -76,3 +92,24 @@ type (
 		MerkleProof []common.Hash
 	}
 )
+
+// SectorRoot returns the merkle root of the sector appended or deleted by the action
+func (action UploadAction) SectorRoot() common.Hash {
+	if action.Type == UploadActionAppendVirtual || action.Type == UploadActionDelete {
+		return common.BytesToHash(action.Data)
+	}
+	return merkle.Sha256MerkleTreeRoot(action.Data)
+}
+
+// RemoveSectorRoot removes the last occurrence of the root from the sector roots by moving the
+// last root to its position. Return false if the root is not found. The roots are modified in
+// place, so the caller shall pass a copy if the original roots are still needed
+func RemoveSectorRoot(roots []common.Hash, root common.Hash) ([]common.Hash, bool) {
+	for i := len(roots) - 1; i >= 0; i-- {
+		if roots[i] == root {
+			roots[i] = roots[len(roots)-1]
+			return roots[:len(roots)-1], true
+		}
+	}
+	return roots, false
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storage
+
+import "fmt"
+
+// RenewalPolicy is the per file policy deciding whether the contracts storing the file
+// are renewed
+type RenewalPolicy uint8
+
+const (
+	// AlwaysRenew renews the contracts storing the file. It is the default policy
+	AlwaysRenew RenewalPolicy = iota
+
+	// NeverRenew allows the contracts storing the file to lapse
+	NeverRenew
+
+	// RenewIfHealthy renews the contracts storing the file only when the file is healthy
+	RenewIfHealthy
+)
+
+var renewalPolicyStrings = map[RenewalPolicy]string{
+	AlwaysRenew:    "always",
+	NeverRenew:     "never",
+	RenewIfHealthy: "ifhealthy",
+}
+
+// String returns the human readable renewal policy
+func (p RenewalPolicy) String() string {
+	if str, exist := renewalPolicyStrings[p]; exist {
+		return str
+	}
+	return fmt.Sprintf("RenewalPolicy(%d)", uint8(p))
+}
+
+// ParseRenewalPolicy parses the renewal policy from the string
+func ParseRenewalPolicy(str string) (RenewalPolicy, error) {
+	for p, s := range renewalPolicyStrings {
+		if s == str {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown renewal policy %v, expect one of always, never and ifhealthy", str)
+}
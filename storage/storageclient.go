@@ -36,6 +36,7 @@ type EthBackend interface {
 	SetupConnection(enodeURL string) (Peer, error)
 	TryToRenewOrRevise(hostID enode.ID) bool
 	RevisionOrRenewingDone(hostID enode.ID)
+	AbandonOperations(hostID enode.ID) bool
 	SetStatic(node *enode.Node)
 	CheckAndUpdateConnection(peerNode *enode.Node)
 	SelfEnodeURL() string
@@ -59,6 +60,7 @@ type ClientBackend interface {
 	SendStorageContractCreateTx(clientAddr common.Address, input []byte) (common.Hash, error)
 	GetHostAnnouncementWithBlockHash(blockHash common.Hash) (hostAnnouncements []types.HostAnnouncement, number uint64, errGet error)
 	GetPaymentAddress() (common.Address, error)
+	GetAvailableBalance(address common.Address) (*big.Int, error)
 	TryToRenewOrRevise(hostID enode.ID) bool
 	RevisionOrRenewingDone(hostID enode.ID)
 	CheckAndUpdateConnection(peerNode *enode.Node)
@@ -5,16 +5,21 @@
 package storageclient
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/DxChainNetwork/godx/common/unit"
 
 	"github.com/DxChainNetwork/godx/accounts"
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/common/hexutil"
 	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/rpc"
 	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/contractset"
 	"github.com/DxChainNetwork/godx/storage/storageclient/storagehostmanager"
 )
 
@@ -45,6 +50,11 @@ func (api *PublicStorageClientAPI) Config() (setting storage.ClientSettingAPIDis
 	return formatClientSetting(api.sc.RetrieveClientSetting())
 }
 
+// Capabilities will retrieve the features supported by the storage client
+func (api *PublicStorageClientAPI) Capabilities() storage.Capabilities {
+	return api.sc.Capabilities()
+}
+
 // Hosts will retrieve the current storage hosts from the storage host manager
 func (api *PublicStorageClientAPI) Hosts() (hosts []storage.HostInfo) {
 	return api.sc.storageHostManager.AllHosts()
@@ -105,6 +115,33 @@ func (api *PublicStorageClientAPI) Contract(contractID string) (detail ContractM
 	return
 }
 
+// ContractRevisionHistory will retrieve the latest revisions recorded of the contract, the oldest first
+func (api *PublicStorageClientAPI) ContractRevisionHistory(contractID string) (history []contractset.RevisionRecord, err error) {
+	// convert the string into contractID format
+	var convertContractID storage.ContractID
+	if convertContractID, err = storage.StringToContractID(contractID); err != nil {
+		err = fmt.Errorf("the contract id provided is invalid: %s", err.Error())
+		return
+	}
+
+	history, exists := api.sc.ContractRevisionHistory(convertContractID)
+	if !exists {
+		err = fmt.Errorf("the contract with %v does not exist", contractID)
+	}
+	return
+}
+
+// EstimateContractFees will estimate the gas fee and the contract fee of forming the given
+// number of contracts at the current gas price
+func (api *PublicStorageClientAPI) EstimateContractFees(numContracts uint64) (estimate ContractFeeEstimateAPIDisplay, err error) {
+	fees, err := api.sc.EstimateContractFees(numContracts)
+	if err != nil {
+		return
+	}
+	estimate = formatContractFeeEstimate(fees)
+	return
+}
+
 // PaymentAddress get the account address used to sign the storage contract. If not configured, the first address in the local wallet will be used as the paymentAddress by default.
 func (api *PublicStorageClientAPI) PaymentAddress() (common.Address, error) {
 	return api.sc.GetPaymentAddress()
@@ -144,6 +181,152 @@ func (api *PublicStorageClientAPI) Upload(source string, dxPath string) (string,
 	return "success", nil
 }
 
+// UploadWithDurability will upload the file with the erasure code recommended for the durability
+// target, which is the probability a segment is recoverable, for example 0.999999
+func (api *PublicStorageClientAPI) UploadWithDurability(source string, dxPath string, durabilityTarget float64) (string, error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return "", err
+	}
+	ec, err := api.sc.RecommendErasureCode(durabilityTarget)
+	if err != nil {
+		return "", err
+	}
+	param := storage.FileUploadParams{
+		Source:      source,
+		DxPath:      path,
+		ErasureCode: ec,
+		Mode:        storage.Override,
+	}
+	if err := api.sc.Upload(param); err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// UploadWithSegmentOrder will upload the file with the segments uploaded in the order, which is
+// sequential, reverse or priority. With the priority order, the segments in the priority list are
+// uploaded first, and the rest segments sequentially
+func (api *PublicStorageClientAPI) UploadWithSegmentOrder(source string, dxPath string, order string, priority []uint64) (string, error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return "", err
+	}
+	param := storage.FileUploadParams{
+		Source:          source,
+		DxPath:          path,
+		Mode:            storage.Override,
+		SegmentOrder:    order,
+		SegmentPriority: priority,
+	}
+	if err := api.sc.Upload(param); err != nil {
+		return "", err
+	}
+	return "success", nil
+}
+
+// UploadDirectory will upload the files in the local directory under the dxpath prefix, with
+// the directory structure preserved. The interrupted bulk upload resumes by calling again with
+// the same local directory and dxpath prefix. The result of each file is returned in the report
+func (api *PublicStorageClientAPI) UploadDirectory(localDir string, dxPathPrefix string, followSymlinks bool) (BulkUploadReport, error) {
+	prefix := storage.RootDxPath()
+	if dxPathPrefix != "" && dxPathPrefix != "/" {
+		var err error
+		if prefix, err = storage.NewDxPath(dxPathPrefix); err != nil {
+			return BulkUploadReport{}, err
+		}
+	}
+	return api.sc.UploadDirectory(localDir, prefix, BulkUploadOptions{FollowSymlinks: followSymlinks})
+}
+
+// RecommendErasureParams will return the erasure code params meeting the durability target with
+// the observed failure rate of the host pool. If the host failure rate is given, it is used instead
+func (api *PublicStorageClientAPI) RecommendErasureParams(durabilityTarget float64, hostFailureRate *float64) (ErasureParams, error) {
+	if hostFailureRate != nil {
+		return RecommendErasureParams(durabilityTarget, *hostFailureRate)
+	}
+	return api.sc.RecommendErasureParams(durabilityTarget)
+}
+
+// VerifyFileSegmentProof verifies the storage proof of a segment provided by the host offline.
+// The segment index is the index of the proof segment among the sectors of the file stored on the host
+func (api *PublicStorageClientAPI) VerifyFileSegmentProof(dxPath string, hostID string, segmentIndex uint64, segmentData hexutil.Bytes, hashSet []common.Hash) (bool, error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return false, err
+	}
+	var enodeid enode.ID
+	idSlice, err := hex.DecodeString(hostID)
+	if err != nil {
+		return false, errors.New("the hostID provided is not valid")
+	}
+	copy(enodeid[:], idSlice)
+	return api.sc.VerifyFileSegmentProof(path, enodeid, segmentIndex, segmentData, hashSet)
+}
+
+// UploadProgress will return the upload progress of the file, including the segments being
+// uploaded
+func (api *PublicStorageClientAPI) UploadProgress(dxPath string) (storage.UploadFileInfo, error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return storage.UploadFileInfo{}, err
+	}
+	return api.sc.UploadProgress(path)
+}
+
+// RepairThrottledFiles will return the paths of the files whose repairs are throttled because
+// of repeated failures. These files are likely stored on bad hosts
+func (api *PublicStorageClientAPI) RepairThrottledFiles() (paths []string) {
+	for _, dxPath := range api.sc.RepairThrottledFiles() {
+		paths = append(paths, dxPath.Path)
+	}
+	return
+}
+
+// FileHealthHistory will return the health samples of the file within the time range [from, to].
+// The samples older than a day are averaged hourly
+func (api *PublicStorageClientAPI) FileHealthHistory(path string, from, to time.Time) ([]HealthSample, error) {
+	dxPath, err := storage.NewDxPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return api.sc.FileHealthHistory(dxPath, from, to)
+}
+
+// RebalanceCostPlan will return the files the next rebalance for cost would migrate from the
+// expensive hosts to the cheaper hosts, and the projected storage cost saved per block
+func (api *PublicStorageClientAPI) RebalanceCostPlan() (storage.RebalancePlan, error) {
+	return api.sc.RebalanceCostPlan()
+}
+
+// RedundancyAlerts subscribes the alerts of the file redundancy dropping below the alert
+// threshold
+func (api *PublicStorageClientAPI) RedundancyAlerts(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		alerts := make(chan RedundancyAlert, redundancyAlertBufferSize)
+		sub := api.sc.SubscribeRedundancyAlert(alerts)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case alert := <-alerts:
+				notifier.Notify(rpcSub.ID, alert)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
 // GetRenewWindow return the renew window value
 func (api *PublicStorageClientAPI) GetRenewWindow() string {
 	return unit.FormatTime(storage.RenewWindow)
@@ -185,6 +368,402 @@ func (api *PrivateStorageClientAPI) SetConfig(settings map[string]string) (resp
 	return
 }
 
+// SetRedundancyAlertThreshold will set the redundancy threshold of the alert of the files without
+// their own thresholds, for example 150 for 1.5x redundancy. 0 disables the alert
+func (api *PrivateStorageClientAPI) SetRedundancyAlertThreshold(threshold uint32) (resp string, err error) {
+	if err = api.sc.SetRedundancyAlertThreshold(threshold); err != nil {
+		err = fmt.Errorf("failed to set the redundancy alert threshold: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the redundancy alert threshold to %v", threshold)
+	return
+}
+
+// SetFileRedundancyAlertThreshold will set the redundancy threshold of the alert of the file,
+// which overrides the global threshold. 0 disables the alert of the file
+func (api *PrivateStorageClientAPI) SetFileRedundancyAlertThreshold(path string, threshold uint32) (resp string, err error) {
+	dxPath, err := storage.NewDxPath(path)
+	if err != nil {
+		return
+	}
+	if err = api.sc.SetFileRedundancyAlertThreshold(dxPath, threshold); err != nil {
+		err = fmt.Errorf("failed to set the redundancy alert threshold of %v: %s", path, err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the redundancy alert threshold of %v to %v", path, threshold)
+	return
+}
+
+// ResetFileRedundancyAlertThreshold will remove the redundancy threshold of the alert of the
+// file, so that the global threshold applies to the file
+func (api *PrivateStorageClientAPI) ResetFileRedundancyAlertThreshold(path string) (resp string, err error) {
+	dxPath, err := storage.NewDxPath(path)
+	if err != nil {
+		return
+	}
+	if err = api.sc.ResetFileRedundancyAlertThreshold(dxPath); err != nil {
+		err = fmt.Errorf("failed to reset the redundancy alert threshold of %v: %s", path, err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully reset the redundancy alert threshold of %v", path)
+	return
+}
+
+// SetMaxInFlightDownloads will set the maximum number of segment downloads in flight.
+// 0 means unlimited
+func (api *PrivateStorageClientAPI) SetMaxInFlightDownloads(limit uint64) (resp string, err error) {
+	if err = api.sc.SetMaxInFlightDownloads(limit); err != nil {
+		err = fmt.Errorf("failed to set the max in flight downloads: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the max in flight downloads to %v", limit)
+	return
+}
+
+// SetReadAheadSegments will set the number of segments read ahead from the local file in one
+// pass during upload. 0 disables the read ahead
+func (api *PrivateStorageClientAPI) SetReadAheadSegments(numSegments uint64) (resp string, err error) {
+	if err = api.sc.SetReadAheadSegments(numSegments); err != nil {
+		err = fmt.Errorf("failed to set the read ahead segments: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the read ahead segments to %v", numSegments)
+	return
+}
+
+// SetMinSegmentHosts will set the minimum number of distinct hosts storing the sectors of a
+// healthy segment for the files uploaded afterwards. 0 means no requirement
+func (api *PrivateStorageClientAPI) SetMinSegmentHosts(minHosts uint32) (resp string, err error) {
+	if err = api.sc.SetMinSegmentHosts(minHosts); err != nil {
+		err = fmt.Errorf("failed to set the min segment hosts: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the min segment hosts to %v", minHosts)
+	return
+}
+
+// SetUploadPolicy will set the upload policy deciding the order of hosts the sectors are
+// assigned to, either "speed" or "cost"
+func (api *PrivateStorageClientAPI) SetUploadPolicy(policy string) (resp string, err error) {
+	if err = api.sc.SetUploadPolicy(policy); err != nil {
+		err = fmt.Errorf("failed to set the upload policy: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the upload policy to %v", policy)
+	return
+}
+
+// SetUploadConfirmPolicy will set the policy confirming a sector is stored by the host after
+// upload, either "trust" or "verify". The verify policy reads each sector back after upload
+func (api *PrivateStorageClientAPI) SetUploadConfirmPolicy(policy string) (resp string, err error) {
+	if err = api.sc.SetUploadConfirmPolicy(policy); err != nil {
+		err = fmt.Errorf("failed to set the upload confirmation policy: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the upload confirmation policy to %v", policy)
+	return
+}
+
+// SetUploadCompletionPolicy will set the policy deciding whether a partially uploaded segment is
+// accepted, either "lenient" or "strict". The strict policy keeps the segment in repair until all
+// sectors are uploaded
+func (api *PrivateStorageClientAPI) SetUploadCompletionPolicy(policy string) (resp string, err error) {
+	if err = api.sc.SetUploadCompletionPolicy(policy); err != nil {
+		err = fmt.Errorf("failed to set the upload completion policy: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the upload completion policy to %v", policy)
+	return
+}
+
+// SetUploadSchedulingPolicy will set the policy of the order the segments of different files are
+// dispatched, either "progress" or "fair". The fair policy interleaves the segments of different
+// files, so that a large file in repair does not delay the others
+func (api *PrivateStorageClientAPI) SetUploadSchedulingPolicy(policy string) (resp string, err error) {
+	if err = api.sc.SetUploadSchedulingPolicy(policy); err != nil {
+		err = fmt.Errorf("failed to set the upload scheduling policy: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the upload scheduling policy to %v", policy)
+	return
+}
+
+// SetHealthSampleInterval will set the interval the health of the files is sampled at, for
+// example "10m". 0 disables the sampling
+func (api *PrivateStorageClientAPI) SetHealthSampleInterval(interval string) (resp string, err error) {
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		err = fmt.Errorf("failed to set the health sample interval: %s", err.Error())
+		return
+	}
+	if err = api.sc.SetHealthSampleInterval(duration); err != nil {
+		err = fmt.Errorf("failed to set the health sample interval: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the health sample interval to %v", duration)
+	return
+}
+
+// SetDirUpdateBatchInterval will set the interval the directory metadata updates of the segment
+// completions are batched in, for example "2s". 0 updates the metadata on each completion
+func (api *PrivateStorageClientAPI) SetDirUpdateBatchInterval(interval string) (resp string, err error) {
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		err = fmt.Errorf("failed to set the dir update batch interval: %s", err.Error())
+		return
+	}
+	if err = api.sc.SetDirUpdateBatchInterval(duration); err != nil {
+		err = fmt.Errorf("failed to set the dir update batch interval: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the dir update batch interval to %v", duration)
+	return
+}
+
+// SetRevisionHistoryLimit will set the number of latest revisions recorded for each contract.
+// 0 disables the revision history
+func (api *PrivateStorageClientAPI) SetRevisionHistoryLimit(limit uint64) (resp string, err error) {
+	if err = api.sc.SetRevisionHistoryLimit(limit); err != nil {
+		err = fmt.Errorf("failed to set the revision history limit: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the revision history limit to %v", limit)
+	return
+}
+
+// SetMaxConcurrentNegotiations will set the maximum number of contract formations and renewals
+// in progress at the same time. 0 means unlimited
+func (api *PrivateStorageClientAPI) SetMaxConcurrentNegotiations(limit uint64) (resp string, err error) {
+	if err = api.sc.SetMaxConcurrentNegotiations(limit); err != nil {
+		err = fmt.Errorf("failed to set the max concurrent negotiations: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the max concurrent negotiations to %v", limit)
+	return
+}
+
+// SetContractRenewPolicy will set the policy deciding whether the contract about to expire is
+// renewed or replaced with a fresh formation. The policy is one of cheapest, renew and form
+func (api *PrivateStorageClientAPI) SetContractRenewPolicy(policy string) (resp string, err error) {
+	if err = api.sc.SetContractRenewPolicy(policy); err != nil {
+		err = fmt.Errorf("failed to set the contract renew policy: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the contract renew policy to %v", policy)
+	return
+}
+
+// SetDeriveSectorKeys will set whether the sectors of the files uploaded afterwards are
+// encrypted with the subkeys derived for each sector, so that a leaked subkey exposes one sector only
+func (api *PrivateStorageClientAPI) SetDeriveSectorKeys(derive bool) (resp string, err error) {
+	if err = api.sc.SetDeriveSectorKeys(derive); err != nil {
+		err = fmt.Errorf("failed to set the sector key derivation: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the sector key derivation to %v", derive)
+	return
+}
+
+// SetVerifyRepairSource will set whether the local source of the file is verified against the
+// checksum of the file before it is read for the upload and repair
+func (api *PrivateStorageClientAPI) SetVerifyRepairSource(verify bool) (resp string, err error) {
+	if err = api.sc.SetVerifyRepairSource(verify); err != nil {
+		err = fmt.Errorf("failed to set the repair source verification: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the repair source verification to %v", verify)
+	return
+}
+
+// SetSourceChecksum will set the checksum of the file, which is the reference the local source
+// of the file is verified against
+func (api *PrivateStorageClientAPI) SetSourceChecksum(dxPath string, checksum common.Hash) (resp string, err error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return
+	}
+	if err = api.sc.SetSourceChecksum(path, checksum); err != nil {
+		err = fmt.Errorf("failed to set the source checksum: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the source checksum of %v to %v", dxPath, checksum.Hex())
+	return
+}
+
+// SetDedupSectors will set whether the sector already stored for the contract with the host
+// is appended as a virtual sector, instead of uploading the same data again
+func (api *PrivateStorageClientAPI) SetDedupSectors(dedup bool) (resp string, err error) {
+	if err = api.sc.SetDedupSectors(dedup); err != nil {
+		err = fmt.Errorf("failed to set the sector deduplication: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the sector deduplication to %v", dedup)
+	return
+}
+
+// SetReclaimDeletedSectors will set whether the sectors of the deleted files are deleted from
+// the hosts, so that the storage is reclaimed before the contracts expire
+func (api *PrivateStorageClientAPI) SetReclaimDeletedSectors(reclaim bool) (resp string, err error) {
+	if err = api.sc.SetReclaimDeletedSectors(reclaim); err != nil {
+		err = fmt.Errorf("failed to set the deleted sectors reclamation: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("Successfully set the deleted sectors reclamation to %v", reclaim)
+	return
+}
+
+// ProbeHostStorage will verify the remaining storage advertised by the host by uploading a
+// test sector. The host rejecting the sector while advertising enough storage is penalized
+func (api *PrivateStorageClientAPI) ProbeHostStorage(id string) (resp string, err error) {
+	var enodeid enode.ID
+
+	// convert the hex string back to the enode.ID type
+	idSlice, err := hex.DecodeString(id)
+	if err != nil {
+		return "", errors.New("the hostID provided is not valid")
+	}
+	copy(enodeid[:], idSlice)
+
+	if err = api.sc.ProbeHostStorage(enodeid); err != nil {
+		return "", err
+	}
+	resp = fmt.Sprintf("the host %v accepted the probe sector", id)
+	return
+}
+
+// RelocateFile will re-upload the sectors of the file to the target hosts specified by the host
+// IDs, and release the file from the other hosts once all sectors are stored on the target hosts
+func (api *PrivateStorageClientAPI) RelocateFile(dxPath string, hostIDs []string) (resp string, err error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return "", err
+	}
+	targets := make([]enode.ID, 0, len(hostIDs))
+	for _, id := range hostIDs {
+		var enodeid enode.ID
+		idSlice, err := hex.DecodeString(id)
+		if err != nil {
+			return "", fmt.Errorf("the hostID %v provided is not valid", id)
+		}
+		copy(enodeid[:], idSlice)
+		targets = append(targets, enodeid)
+	}
+	if err = api.sc.RelocateFile(path, targets); err != nil {
+		return "", fmt.Errorf("failed to relocate the file: %s", err.Error())
+	}
+	resp = fmt.Sprintf("Started relocating the file %v to %v hosts", dxPath, len(targets))
+	return
+}
+
+// RebalanceForCost will start migrating a bounded amount of files from the expensive hosts to
+// the cheaper hosts, and return the migrations started with the projected savings
+func (api *PrivateStorageClientAPI) RebalanceForCost() (storage.RebalancePlan, error) {
+	plan, err := api.sc.RebalanceForCost()
+	if err != nil {
+		return storage.RebalancePlan{}, fmt.Errorf("failed to rebalance for cost: %s", err.Error())
+	}
+	return plan, nil
+}
+
+// CancelUpload will cancel the upload of the file. The sectors being uploaded may still finish
+func (api *PrivateStorageClientAPI) CancelUpload(dxPath string) (resp string, err error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return "", err
+	}
+	if err = api.sc.CancelUpload(path); err != nil {
+		return "", fmt.Errorf("failed to cancel the upload: %s", err.Error())
+	}
+	resp = fmt.Sprintf("Successfully cancelled the upload of the file %v", dxPath)
+	return
+}
+
+// ResumeUpload will allow the file cancelled to be uploaded and repaired again
+func (api *PrivateStorageClientAPI) ResumeUpload(dxPath string) (resp string, err error) {
+	path, err := storage.NewDxPath(dxPath)
+	if err != nil {
+		return "", err
+	}
+	if err = api.sc.ResumeUpload(path); err != nil {
+		return "", fmt.Errorf("failed to resume the upload: %s", err.Error())
+	}
+	resp = fmt.Sprintf("Successfully resumed the upload of the file %v", dxPath)
+	return
+}
+
+// FormContract will form the contract with the storage host specified by the enode URL,
+// bypassing the automatic storage host selection. The fund is in currency unit, and the
+// duration is in time unit
+func (api *PrivateStorageClientAPI) FormContract(enodeURL string, fund string, duration string) (resp string, err error) {
+	funding, err := unit.ParseCurrency(fund)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the fund: %s", err.Error())
+	}
+	period, err := unit.ParseTime(duration)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the duration: %s", err.Error())
+	}
+
+	md, err := api.sc.contractManager.FormContractWithHost(enodeURL, funding, period)
+	if err != nil {
+		return "", fmt.Errorf("failed to form the contract: %s", err.Error())
+	}
+	resp = fmt.Sprintf("Successfully formed the contract %v with host %v", md.ID, md.EnodeID)
+	return
+}
+
+// FormDeferredContract will form the contract with the minimal funding with the storage host
+// specified by the enode URL. The contract is not used for uploading until it is activated.
+// The duration is in time unit
+func (api *PrivateStorageClientAPI) FormDeferredContract(enodeURL string, duration string) (resp string, err error) {
+	period, err := unit.ParseTime(duration)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the duration: %s", err.Error())
+	}
+
+	md, err := api.sc.contractManager.FormDeferredContract(enodeURL, period)
+	if err != nil {
+		return "", fmt.Errorf("failed to form the deferred contract: %s", err.Error())
+	}
+	resp = fmt.Sprintf("Successfully formed the deferred contract %v with host %v", md.ID, md.EnodeID)
+	return
+}
+
+// ActivateContract will fund the deferred contract, after which the contract is used for
+// uploading. The fund is in currency unit
+func (api *PrivateStorageClientAPI) ActivateContract(contractID string, fund string) (resp string, err error) {
+	id, err := storage.StringToContractID(contractID)
+	if err != nil {
+		return "", fmt.Errorf("the contract id provided is not valid: %s", err.Error())
+	}
+	funding, err := unit.ParseCurrency(fund)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the fund: %s", err.Error())
+	}
+
+	md, err := api.sc.contractManager.ActivateContract(id, funding)
+	if err != nil {
+		return "", fmt.Errorf("failed to activate the contract: %s", err.Error())
+	}
+	resp = fmt.Sprintf("Successfully activated the contract %v, renewed to the contract %v", contractID, md.ID)
+	return
+}
+
+// AbandonContractOperations abandons all in-flight operations with the host of the contract
+// immediately, which is used to escape from a host hanging in the middle of the negotiation
+func (api *PrivateStorageClientAPI) AbandonContractOperations(contractID string) (resp string, err error) {
+	id, err := storage.StringToContractID(contractID)
+	if err != nil {
+		return "", fmt.Errorf("the contract id provided is not valid: %s", err.Error())
+	}
+
+	if err = api.sc.AbandonContractOperations(id); err != nil {
+		return "", fmt.Errorf("failed to abandon the contract operations: %s", err.Error())
+	}
+	resp = fmt.Sprintf("Successfully abandoned the in-flight operations of the contract %v", contractID)
+	return
+}
+
 // SetPaymentAddress configure the account address used to sign the storage contract, which has and can only be the address of the local wallet.
 func (api *PrivateStorageClientAPI) SetPaymentAddress(addrStr string) bool {
 	paymentAddress := common.HexToAddress(addrStr)
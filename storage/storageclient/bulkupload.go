@@ -0,0 +1,350 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// bulkUploadMetadata is the metadata of the bulk upload manifest file
+var bulkUploadMetadata = common.Metadata{
+	Header:  "storage client bulk upload manifest",
+	Version: PersistStorageClientVersion,
+}
+
+// errBulkUploadInterrupted is the error returned if the bulk upload is interrupted before all
+// files are uploaded. The bulk upload resumes with the same local directory and dxpath prefix
+var errBulkUploadInterrupted = errors.New("bulk upload interrupted")
+
+// The status of a file in the bulk upload. A file is pending after the upload starts and before
+// the result is recorded, so a pending file found on resume was interrupted during the upload
+const (
+	BulkUploadUploaded = "uploaded"
+	BulkUploadSkipped  = "skipped"
+	BulkUploadFailed   = "failed"
+
+	bulkUploadPending = "pending"
+)
+
+// BulkUploadOptions is the options of uploading a local directory
+type BulkUploadOptions struct {
+	// ErasureCode is the erasure code of the files uploaded. nil uses the default one
+	ErasureCode erasurecode.ErasureCoder
+
+	// FollowSymlinks uploads the files linked by the symbolic links. The symbolic links to
+	// the directories are never followed, which may form a cycle
+	FollowSymlinks bool
+}
+
+// BulkUploadFileResult is the result of a file in the bulk upload
+type BulkUploadFileResult struct {
+	Source string `json:"source"`
+	DxPath string `json:"dxpath"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BulkUploadReport is the report of the bulk upload of a local directory
+type BulkUploadReport struct {
+	LocalDir     string                 `json:"localdir"`
+	DxPathPrefix string                 `json:"dxpathprefix"`
+	Uploaded     int                    `json:"uploaded"`
+	Skipped      int                    `json:"skipped"`
+	Failed       int                    `json:"failed"`
+	Files        []BulkUploadFileResult `json:"files"`
+}
+
+// add adds the result of a file to the report
+func (report *BulkUploadReport) add(result BulkUploadFileResult) {
+	switch result.Status {
+	case BulkUploadUploaded:
+		report.Uploaded++
+	case BulkUploadSkipped:
+		report.Skipped++
+	default:
+		report.Failed++
+	}
+	report.Files = append(report.Files, result)
+}
+
+// bulkUploadEntry is the progress of a file recorded in the manifest. Size and ModTime are
+// of the file when it is uploaded, which detect the file changed since the upload
+type bulkUploadEntry struct {
+	Size    int64
+	ModTime time.Time
+	Status  string
+}
+
+// bulkUploadManifest is the progress of the bulk upload of a local directory, mapping from the
+// path of the file relative to the local directory
+type bulkUploadManifest struct {
+	LocalDir     string
+	DxPathPrefix string
+	Files        map[string]*bulkUploadEntry
+}
+
+// loadBulkUploadManifest loads the manifest of the bulk upload. A missing file is regarded as
+// a bulk upload not started
+func loadBulkUploadManifest(path string, localDir string, prefix storage.DxPath) (*bulkUploadManifest, error) {
+	manifest := &bulkUploadManifest{
+		LocalDir:     localDir,
+		DxPathPrefix: prefix.Path,
+		Files:        make(map[string]*bulkUploadEntry),
+	}
+	err := common.LoadDxJSON(bulkUploadMetadata, path, manifest)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if manifest.LocalDir != localDir || manifest.DxPathPrefix != prefix.Path {
+		return nil, fmt.Errorf("manifest %v is of the bulk upload from %v to %v", path, manifest.LocalDir, manifest.DxPathPrefix)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]*bulkUploadEntry)
+	}
+	return manifest, nil
+}
+
+// save saves the manifest to the file
+func (manifest *bulkUploadManifest) save(path string) error {
+	return common.SaveDxJSON(bulkUploadMetadata, path, manifest)
+}
+
+// bulkUploadManifestPath returns the path of the manifest of the bulk upload from the local
+// directory to the dxpath prefix
+func (client *StorageClient) bulkUploadManifestPath(localDir string, prefix storage.DxPath) string {
+	id := crypto.Keccak256Hash([]byte(localDir), []byte{0}, []byte(prefix.Path))
+	return filepath.Join(client.persistDir, BulkUploadDirectory, id.Hex()[2:18]+".json")
+}
+
+// UploadDirectory uploads the files in the local directory, with the directory structure
+// preserved under the dxpath prefix. The progress is recorded in a manifest, so that an
+// interrupted bulk upload resumes with the files not uploaded yet. The result of each file is
+// returned in the report, and the bulk upload with any file failed could be retried
+func (client *StorageClient) UploadDirectory(localDir string, prefix storage.DxPath, opts BulkUploadOptions) (BulkUploadReport, error) {
+	if err := client.tm.Add(); err != nil {
+		return BulkUploadReport{}, err
+	}
+	defer client.tm.Done()
+
+	return client.uploadDirectory(localDir, prefix, opts, client.Upload, client.tm.StopChan())
+}
+
+// uploadDirectory uploads the files in the local directory with the upload function. The bulk
+// upload is interrupted once stop is closed, with the progress recorded
+func (client *StorageClient) uploadDirectory(localDir string, prefix storage.DxPath, opts BulkUploadOptions, upload func(storage.FileUploadParams) error, stop <-chan struct{}) (BulkUploadReport, error) {
+	localDir, err := filepath.Abs(localDir)
+	if err != nil {
+		return BulkUploadReport{}, err
+	}
+	info, err := os.Stat(localDir)
+	if err != nil {
+		return BulkUploadReport{}, fmt.Errorf("unable to stat the local directory, error: %v", err)
+	}
+	if !info.IsDir() {
+		return BulkUploadReport{}, fmt.Errorf("%v is not a directory", localDir)
+	}
+
+	manifestPath := client.bulkUploadManifestPath(localDir, prefix)
+	if err = os.MkdirAll(filepath.Dir(manifestPath), 0700); err != nil {
+		return BulkUploadReport{}, err
+	}
+	manifest, err := loadBulkUploadManifest(manifestPath, localDir, prefix)
+	if err != nil {
+		return BulkUploadReport{}, err
+	}
+
+	report := BulkUploadReport{
+		LocalDir:     localDir,
+		DxPathPrefix: prefix.Path,
+	}
+	files, err := walkUploadDirectory(localDir, prefix, opts.FollowSymlinks, &report)
+	if err != nil {
+		return report, err
+	}
+	for _, rel := range files {
+		select {
+		case <-stop:
+			return report, errBulkUploadInterrupted
+		default:
+		}
+		report.add(client.bulkUploadFile(manifest, manifestPath, rel, opts, upload))
+		if err = manifest.save(manifestPath); err != nil {
+			return report, fmt.Errorf("failed to save the bulk upload manifest: %v", err)
+		}
+	}
+
+	// The manifest of the completed bulk upload is no longer needed
+	if report.Failed == 0 {
+		if err = os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+			client.log.Warn("failed to remove the bulk upload manifest", "path", manifestPath, "err", err)
+		}
+	}
+	return report, nil
+}
+
+// walkUploadDirectory returns the relative paths of the regular files in the local directory in
+// lexical order. The entries not uploaded, such as the symbolic links not followed and the
+// directories not accessible, are added to the report
+func walkUploadDirectory(localDir string, prefix storage.DxPath, followSymlinks bool, report *BulkUploadReport) ([]string, error) {
+	var files []string
+	skip := func(path, status, reason string) {
+		result := BulkUploadFileResult{
+			Source: path,
+			Status: status,
+			Reason: reason,
+		}
+		if rel, err := filepath.Rel(localDir, path); err == nil {
+			if dxPath, err := prefix.Join(filepath.ToSlash(rel)); err == nil {
+				result.DxPath = dxPath.Path
+			}
+		}
+		report.add(result)
+	}
+	err := filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == localDir {
+				return err
+			}
+			skip(path, BulkUploadFailed, err.Error())
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !followSymlinks {
+				skip(path, BulkUploadSkipped, "symbolic link not followed")
+				return nil
+			}
+			if info, err = os.Stat(path); err != nil {
+				skip(path, BulkUploadFailed, err.Error())
+				return nil
+			}
+			if info.IsDir() {
+				skip(path, BulkUploadSkipped, "symbolic link to a directory not followed")
+				return nil
+			}
+		}
+		if !info.Mode().IsRegular() {
+			skip(path, BulkUploadSkipped, "not a regular file")
+			return nil
+		}
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// bulkUploadFile uploads the file in the bulk upload, and records the progress in the manifest.
+// The file recorded as uploaded and not changed since is skipped
+func (client *StorageClient) bulkUploadFile(manifest *bulkUploadManifest, manifestPath string, rel string, opts BulkUploadOptions, upload func(storage.FileUploadParams) error) BulkUploadFileResult {
+	source := filepath.Join(manifest.LocalDir, rel)
+	result := BulkUploadFileResult{Source: source}
+	fail := func(reason string) BulkUploadFileResult {
+		result.Status, result.Reason = BulkUploadFailed, reason
+		if entry, exist := manifest.Files[rel]; exist {
+			entry.Status = BulkUploadFailed
+		}
+		return result
+	}
+
+	dxPath, err := storage.DxPath{Path: manifest.DxPathPrefix}.Join(filepath.ToSlash(rel))
+	if err != nil {
+		return fail(err.Error())
+	}
+	result.DxPath = dxPath.Path
+
+	// The file may be removed or changed after the walk
+	info, err := os.Stat(source)
+	if err != nil {
+		return fail(err.Error())
+	}
+	if info.Size() == 0 {
+		result.Status, result.Reason = BulkUploadSkipped, "empty file"
+		return result
+	}
+	entry, exist := manifest.Files[rel]
+	unchanged := exist && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime())
+	if unchanged && entry.Status == BulkUploadUploaded {
+		result.Status, result.Reason = BulkUploadSkipped, "already uploaded"
+		return result
+	}
+
+	// Check the dx file uploaded before. The dx file left by a previous upload not completed, or
+	// uploaded from the file changed since, is uploaded again
+	df, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil && err != dxfile.ErrUnknownFile {
+		return fail(err.Error())
+	}
+	if err == nil {
+		checksum := df.Checksum()
+		df.Close()
+		switch {
+		case exist:
+			if err = client.fileSystem.DeleteDxFile(dxPath); err != nil {
+				return fail(fmt.Sprintf("cannot delete the dx file uploaded before: %v", err))
+			}
+		default:
+			sourceChecksum, err := fileChecksum(source)
+			if err != nil {
+				return fail(err.Error())
+			}
+			if checksum != sourceChecksum {
+				return fail("dx file already exists with different content")
+			}
+			manifest.Files[rel] = &bulkUploadEntry{Size: info.Size(), ModTime: info.ModTime(), Status: BulkUploadUploaded}
+			result.Status, result.Reason = BulkUploadSkipped, "already uploaded"
+			return result
+		}
+	}
+
+	// Record the file pending before the upload, so that the dx file left by an interrupted
+	// upload is found on resume
+	entry = &bulkUploadEntry{Size: info.Size(), ModTime: info.ModTime(), Status: bulkUploadPending}
+	manifest.Files[rel] = entry
+	if err = manifest.save(manifestPath); err != nil {
+		return fail(fmt.Sprintf("failed to save the bulk upload manifest: %v", err))
+	}
+	err = upload(storage.FileUploadParams{
+		Source:      source,
+		DxPath:      dxPath,
+		ErasureCode: opts.ErasureCode,
+		Mode:        storage.Override,
+	})
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	// The file changed during the upload is uploaded again in the retry
+	if info, err = os.Stat(source); err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		if deleteErr := client.fileSystem.DeleteDxFile(dxPath); deleteErr != nil {
+			client.log.Warn("failed to delete the dx file", "path", dxPath.Path, "err", deleteErr)
+		}
+		return fail("file changed during the upload")
+	}
+	entry.Status = BulkUploadUploaded
+	result.Status = BulkUploadUploaded
+	return result
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// TestStorageClient_UploadDirectory test the bulk upload interrupted resumes with the files not
+// uploaded yet, and the files already uploaded are skipped
+func TestStorageClient_UploadDirectory(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	localDir, err := ioutil.TempDir("", "bulkupload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(localDir)
+	files := []string{"1", "a/2", "a/3", "b/c/4", "b/c/5"}
+	for _, file := range files {
+		path := filepath.Join(localDir, filepath.FromSlash(file))
+		if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte("bulk upload "+file), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(localDir, "empty"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(filepath.Join(localDir, "1"), filepath.Join(localDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	prefix := randomDxPath()
+	defer func() {
+		for _, file := range files {
+			dxPath, _ := prefix.Join(file)
+			client.fileSystem.DeleteDxFile(dxPath)
+		}
+	}()
+
+	// The upload creates the dx file, and the bulk upload is interrupted after 2 files
+	uploaded := make(map[string]int)
+	stop := make(chan struct{})
+	upload := func(up storage.FileUploadParams) error {
+		if err := uploadTestDxFile(client, up); err != nil {
+			return err
+		}
+		uploaded[up.DxPath.Path]++
+		if len(uploaded) == 2 {
+			close(stop)
+		}
+		return nil
+	}
+	report, err := client.uploadDirectory(localDir, prefix, BulkUploadOptions{}, upload, stop)
+	if err != errBulkUploadInterrupted {
+		t.Fatalf("expect error %v, got %v", errBulkUploadInterrupted, err)
+	}
+	if report.Uploaded != 2 {
+		t.Fatalf("expect 2 files uploaded before the interruption, got %v", report.Uploaded)
+	}
+
+	// Resume to completion
+	report, err = client.uploadDirectory(localDir, prefix, BulkUploadOptions{}, upload, make(chan struct{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Uploaded != len(files)-2 || report.Failed != 0 {
+		t.Fatalf("expect %v files uploaded and 0 failed, got %v and %v", len(files)-2, report.Uploaded, report.Failed)
+	}
+	// The 2 files uploaded, the empty file and the symbolic link are skipped
+	if report.Skipped != 4 {
+		t.Fatalf("expect 4 files skipped, got %v: %+v", report.Skipped, report.Files)
+	}
+	for _, file := range files {
+		dxPath, err := prefix.Join(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uploaded[dxPath.Path] != 1 {
+			t.Errorf("file %v uploaded %v times", file, uploaded[dxPath.Path])
+		}
+		entry, err := client.fileSystem.OpenDxFile(dxPath)
+		if err != nil {
+			t.Fatalf("file %v not uploaded: %v", file, err)
+		}
+		entry.Close()
+	}
+	absDir, _ := filepath.Abs(localDir)
+	if _, err = os.Stat(client.bulkUploadManifestPath(absDir, prefix)); !os.IsNotExist(err) {
+		t.Errorf("manifest of the completed bulk upload not removed: %v", err)
+	}
+
+	// Without the manifest, the dx files with the same content are regarded as uploaded
+	report, err = client.uploadDirectory(localDir, prefix, BulkUploadOptions{}, upload, make(chan struct{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Uploaded != 0 || report.Failed != 0 {
+		t.Fatalf("expect all files skipped, got %v uploaded and %v failed", report.Uploaded, report.Failed)
+	}
+}
+
+// uploadTestDxFile creates the dx file of the upload with the checksum of the source file
+func uploadTestDxFile(client *StorageClient, up storage.FileUploadParams) error {
+	info, err := os.Stat(up.Source)
+	if err != nil {
+		return err
+	}
+	ec, err := erasurecode.New(erasurecode.ECTypeStandard, 1, 2)
+	if err != nil {
+		return err
+	}
+	ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		return err
+	}
+	entry, err := client.fileSystem.NewDxFile(up.DxPath, storage.SysPath(up.Source), false, ec, ck, uint64(info.Size()), info.Mode())
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	checksum, err := fileChecksum(up.Source)
+	if err != nil {
+		return err
+	}
+	return entry.SetChecksum(checksum)
+}
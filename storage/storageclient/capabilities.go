@@ -0,0 +1,38 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// Capabilities returns the features supported by the storage client
+func (client *StorageClient) Capabilities() storage.Capabilities {
+	return storage.LocalCapabilities()
+}
+
+// numHostsSupportErasureCodeType returns the number of hosts with active contracts which
+// support the erasure code type according to the capabilities negotiated
+func (client *StorageClient) numHostsSupportErasureCodeType(ecType uint8) (num uint64) {
+	for _, contract := range client.contractManager.RetrieveActiveContracts() {
+		host, exists := client.storageHostManager.RetrieveHostInfo(contract.EnodeID)
+		if !exists {
+			continue
+		}
+		if hostCapabilities(host).SupportErasureCodeType(ecType) {
+			num++
+		}
+	}
+	return
+}
+
+// hostCapabilities returns the capabilities negotiated with the storage host. The host not
+// advertising any capabilities is regarded as a legacy host
+func hostCapabilities(host storage.HostInfo) storage.Capabilities {
+	if host.Capabilities.Version == 0 && len(host.Capabilities.ErasureCodeTypes) == 0 {
+		return storage.LegacyCapabilities()
+	}
+	return host.Capabilities
+}
@@ -6,6 +6,7 @@ package storageclient
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/unit"
@@ -75,6 +76,15 @@ func parseClientSetting(settings map[string]string, prevSetting storage.ClientSe
 			}
 			clientSetting.MaxDownloadSpeed = downloadSpeed
 
+		case key == "repairthreshold":
+			var threshold float64
+			threshold, err = parseRepairDownloadThreshold(value)
+			if err != nil {
+				err = fmt.Errorf("failed to parse the repair download threshold: %s", err.Error())
+				break
+			}
+			clientSetting.RepairDownloadThreshold = threshold
+
 		default:
 			err = fmt.Errorf("the key entered: %s is not valid. Here is a list of available keys: %+v",
 				key, keys)
@@ -95,6 +105,25 @@ func parseStorageHosts(hosts string) (parsed uint64, err error) {
 	return unit.ParseUint64(hosts, 1, "")
 }
 
+// parseRepairDownloadThreshold will parse the string version of repair download threshold into
+// float64 type
+func parseRepairDownloadThreshold(threshold string) (parsed float64, err error) {
+	if parsed, err = strconv.ParseFloat(threshold, 64); err != nil {
+		return
+	}
+	err = checkRepairDownloadThreshold(parsed)
+	return
+}
+
+// checkRepairDownloadThreshold checks whether the repair download threshold is a fraction
+// within [0, 1]
+func checkRepairDownloadThreshold(threshold float64) error {
+	if threshold < 0 || threshold > 1 {
+		return fmt.Errorf("the repair download threshold %v shall be within [0, 1]", threshold)
+	}
+	return nil
+}
+
 // clientSettingGetDefault will take the clientSetting and check if any filed in the RentPayment is zero
 // if so, set the value to default value
 func clientSettingGetDefault(setting storage.ClientSetting) (newSetting storage.ClientSetting) {
@@ -73,6 +73,33 @@ func TestParseStorageHosts(t *testing.T) {
 	}
 }
 
+func TestParseRepairDownloadThreshold(t *testing.T) {
+	var tables = []struct {
+		threshold string
+		parsed    float64
+		valid     bool
+	}{
+		{"0", 0, true},
+		{"0.125", 0.125, true},
+		{"1", 1, true},
+		{"1.5", 0, false},
+		{"-0.1", 0, false},
+		{"high", 0, false},
+	}
+
+	for _, table := range tables {
+		result, err := parseRepairDownloadThreshold(table.threshold)
+		if (err == nil) != table.valid {
+			t.Fatalf("by using %s as input, expected valid %v, got error %v", table.threshold, table.valid, err)
+		}
+
+		if table.valid && result != table.parsed {
+			t.Errorf("by using %s as input, expected parsed value %v, got %v",
+				table.threshold, table.parsed, result)
+		}
+	}
+}
+
 func randomSettings() (settings map[string]string, err error) {
 	var keys map[string]string
 
@@ -139,6 +166,10 @@ func randomValue(selectedKeys map[string]string) (settings map[string]string, er
 			value = rand.Int63()
 			granularity = unit.SpeedUnit[rand.Intn(len(unit.SpeedUnit))]
 			break
+		case key == "repairthreshold":
+			value = rand.Float64()
+			granularity = ""
+			break
 		default:
 			err = fmt.Errorf("the key received is not valid: %s", key)
 			return
@@ -181,6 +212,9 @@ func clientSettingValidation(key string, prevSetting storage.ClientSetting, curr
 	case "downloadspeed":
 		valid = currentSetting.MaxDownloadSpeed == prevSetting.MaxDownloadSpeed
 		return
+	case "repairthreshold":
+		valid = currentSetting.RepairDownloadThreshold == prevSetting.RepairDownloadThreshold
+		return
 	default:
 		err = fmt.Errorf("the provided key is invalid: %s", key)
 		return
@@ -354,6 +354,7 @@ func (cm *ContractManager) updateExpiredContracts(contract storage.ContractMetaD
 	cm.lock.Lock()
 	defer cm.lock.Unlock()
 	cm.expiredContracts[contract.ID] = contract
+	delete(cm.deferredContracts, contract.ID)
 }
 
 // updateHostToContractID will update the hostToContract field, making sure that
@@ -469,6 +470,7 @@ func (cm *ContractManager) calculateMinEvaluation(hosts []storage.HostInfo) (min
 // 		not good for uploading and renewing
 // 		5. if the contract has been renewed already, mark the upload ability to false
 // 		6. lastly, if the client does not have enough money left, mark the upload ability as false
+// The deferred contract is not good for uploading until it is activated
 func (cm *ContractManager) checkContractStatus(contract storage.ContractMetaData, evalBaseline int64) (stats storage.ContractStatus) {
 	stats = contract.Status
 
@@ -478,6 +480,10 @@ func (cm *ContractManager) checkContractStatus(contract storage.ContractMetaData
 		stats.RenewAbility = true
 	}
 
+	if cm.isDeferredContract(contract.ID) {
+		stats.UploadAbility = false
+	}
+
 	// check if the host that signed the contract with is valid
 	host, exists := cm.hostManager.RetrieveHostInfo(contract.EnodeID)
 	if !exists || host.Filtered {
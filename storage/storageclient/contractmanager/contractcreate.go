@@ -7,6 +7,7 @@ package contractmanager
 import (
 	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/DxChainNetwork/godx/accounts"
 	"github.com/DxChainNetwork/godx/common"
@@ -34,8 +35,9 @@ func (cm *ContractManager) prepareCreateContract(neededContracts int, clientRema
 	contractEndHeight := cm.currentPeriod + rentPayment.Period + storage.RenewWindow
 	cm.lock.RUnlock()
 
-	// loop through each host and try to form contract with them
-	for _, host := range randomHosts {
+	// loop through the hosts and try to form contract with them in batches. The contracts in a
+	// batch are formed concurrently, with at most the negotiation limit in progress
+	for len(randomHosts) != 0 && neededContracts > 0 {
 		// check if the client has enough fund for forming contract
 		if contractFund.Cmp(clientRemainingFund) > 0 {
 			err = fmt.Errorf("the contract fund %v is larger than client remaining fund %v. Impossible to create contract",
@@ -43,30 +45,40 @@ func (cm *ContractManager) prepareCreateContract(neededContracts int, clientRema
 			return
 		}
 
-		// start to form contract
-		formCost, contract, errFormContract := cm.createContract(host, contractFund, contractEndHeight, rentPayment)
-		// if contract formation failed, the error do not need to be returned, just try to form the
-		// contract with another storage host
-		if errFormContract != nil {
-			cm.log.Warn("failed to create the contract", "err", errFormContract.Error())
-			continue
+		// the batch is limited by the hosts left and the fund that the client could afford
+		batchSize := cm.negotiations.batchSize(neededContracts)
+		if batchSize > len(randomHosts) {
+			batchSize = len(randomHosts)
 		}
-
-		// update the client remaining fund, and try to change the newly formed contract's status
-		clientRemainingFund = clientRemainingFund.Sub(formCost)
-		if err = cm.markNewlyFormedContractStats(contract.ID); err != nil {
-			return
+		if affordable := clientRemainingFund.Div(contractFund); affordable.CmpUint64(uint64(batchSize)) < 0 {
+			batchSize = int(affordable.BigIntPtr().Int64())
 		}
+		batch := randomHosts[:batchSize]
+		randomHosts = randomHosts[batchSize:]
+
+		// start to form contracts
+		results := cm.createContracts(batch, contractFund, contractEndHeight, rentPayment)
+		for _, result := range results {
+			// if contract formation failed, the error do not need to be returned, just try to form the
+			// contract with another storage host
+			if result.err != nil {
+				cm.log.Warn("failed to create the contract", "err", result.err.Error())
+				continue
+			}
 
-		// save persistently
-		if failedSave := cm.saveSettings(); failedSave != nil {
-			cm.log.Warn("after created the contract, failed to save the contract manager settings")
-		}
+			// update the client remaining fund, and try to change the newly formed contract's status
+			clientRemainingFund = clientRemainingFund.Sub(result.formCost)
+			if err = cm.markNewlyFormedContractStats(result.contract.ID); err != nil {
+				return
+			}
 
-		// update the number of needed contracts
-		neededContracts--
-		if neededContracts <= 0 {
-			break
+			// save persistently
+			if failedSave := cm.saveSettings(); failedSave != nil {
+				cm.log.Warn("after created the contract, failed to save the contract manager settings")
+			}
+
+			// update the number of needed contracts
+			neededContracts--
 		}
 
 		// check if the maintenance termination signal was sent
@@ -78,6 +90,29 @@ func (cm *ContractManager) prepareCreateContract(neededContracts int, clientRema
 	return
 }
 
+// contractFormResult is the result of forming a contract with a host
+type contractFormResult struct {
+	formCost common.BigInt
+	contract storage.ContractMetaData
+	err      error
+}
+
+// createContracts forms the contracts with the hosts concurrently, with at most the negotiation
+// limit in progress. The results are returned in the order of the hosts
+func (cm *ContractManager) createContracts(hosts []storage.HostInfo, contractFund common.BigInt, contractEndHeight uint64, rentPayment storage.RentPayment) (results []contractFormResult) {
+	results = make([]contractFormResult, len(hosts))
+	started := cm.negotiations.run(len(hosts), cm.quit, func(i int) {
+		result := &results[i]
+		result.formCost, result.contract, result.err = cm.createContract(hosts[i], contractFund, contractEndHeight, rentPayment)
+	})
+	for i := range results {
+		if !started[i] {
+			results[i].err = fmt.Errorf("failed to create the contract with host: %v, contract manager stopped", hosts[i].EnodeID)
+		}
+	}
+	return
+}
+
 // createContract will try to create the contract with the host that caller passed in:
 // 		1. storage host validation
 // 		2. form the contract create parameters
@@ -156,6 +191,112 @@ func (cm *ContractManager) createContract(host storage.HostInfo, contractFund co
 	return
 }
 
+// FormContractWithHost will form the contract with the storage host specified by the enode URL,
+// bypassing the automatic storage host selection. The newest host config is requested from the
+// storage host and validated before the contract negotiation starts
+func (cm *ContractManager) FormContractWithHost(enodeURL string, funding common.BigInt, duration uint64) (md storage.ContractMetaData, err error) {
+	return cm.formContractWithHost(enodeURL, funding, duration, false)
+}
+
+// formContractWithHost forms the contract with the storage host specified by the enode URL. If
+// the contract is deferred, the funding is replaced by the minimal funding accepted by the host
+func (cm *ContractManager) formContractWithHost(enodeURL string, funding common.BigInt, duration uint64, deferred bool) (md storage.ContractMetaData, err error) {
+	host, err := hostInfoFromEnodeURL(enodeURL)
+	if err != nil {
+		return storage.ContractMetaData{}, err
+	}
+
+	// keep the interaction records if the storage host is known by the storage host manager
+	if known, exists := cm.hostManager.RetrieveHostInfo(host.EnodeID); exists {
+		known.EnodeURL = host.EnodeURL
+		host = known
+	}
+
+	cm.lock.RLock()
+	_, exists := cm.hostToContract[host.EnodeID]
+	rentPayment := cm.rentPayment
+	contractEndHeight := cm.blockHeight + duration
+	cm.lock.RUnlock()
+
+	// validate the contract request
+	if exists {
+		return storage.ContractMetaData{}, fmt.Errorf("client already formed a contract with the storage host %v", host.EnodeID)
+	}
+	if reflect.DeepEqual(rentPayment, storage.RentPayment{}) {
+		return storage.ContractMetaData{}, errors.New("rent payment must be set before forming the contract")
+	}
+	if duration == 0 {
+		return storage.ContractMetaData{}, errors.New("the contract duration cannot be zero")
+	}
+
+	// request and validate the storage host config
+	var config storage.HostExtConfig
+	if err = cm.b.GetStorageHostSetting(host.EnodeID, host.EnodeURL, &config); err != nil {
+		return storage.ContractMetaData{}, fmt.Errorf("failed to get the config of storage host %v: %s", host.EnodeID, err.Error())
+	}
+	host.HostExtConfig = config
+	if !host.AcceptingContracts {
+		return storage.ContractMetaData{}, fmt.Errorf("the storage host %v is not accepting contracts", host.EnodeID)
+	}
+	if host.MaxDuration < duration {
+		return storage.ContractMetaData{}, fmt.Errorf("the contract duration %v exceeds the max duration %v of storage host %v", duration, host.MaxDuration, host.EnodeID)
+	}
+
+	// the deferred contract is only formed with the host agreed to fund the contract later
+	if deferred {
+		if !host.Capabilities.SupportFeature(storage.FeatureDeferredFunding) {
+			return storage.ContractMetaData{}, fmt.Errorf("the storage host %v does not support the deferred funding", host.EnodeID)
+		}
+		funding = deferredContractFunding(host)
+	}
+
+	// check if the client can afford the contract
+	if funding.Cmp(host.ContractPrice) <= 0 {
+		return storage.ContractMetaData{}, fmt.Errorf("the funding %v is not enough to pay the contract price %v", funding, host.ContractPrice)
+	}
+	clientRemainingFund := rentPayment.Fund.Sub(cm.CalculatePeriodCost(rentPayment).ContractFund)
+	if funding.Cmp(clientRemainingFund) > 0 {
+		return storage.ContractMetaData{}, fmt.Errorf("the funding %v is larger than client remaining fund %v", funding, clientRemainingFund)
+	}
+
+	// start to form the contract, the contract period is specified by the caller
+	rentPayment.Period = duration
+	if !cm.negotiations.acquire(cm.quit) {
+		return storage.ContractMetaData{}, errors.New("contract manager stopped before forming the contract")
+	}
+	_, md, err = cm.createContract(host, funding, contractEndHeight, rentPayment)
+	cm.negotiations.release()
+	if err != nil {
+		return storage.ContractMetaData{}, err
+	}
+	if deferred {
+		err = cm.markDeferredContract(md.ID, enodeURL)
+		md.Status.UploadAbility = false
+	} else {
+		err = cm.markNewlyFormedContractStats(md.ID)
+	}
+	if err != nil {
+		return storage.ContractMetaData{}, err
+	}
+	if failedSave := cm.saveSettings(); failedSave != nil {
+		cm.log.Warn("after created the contract, failed to save the contract manager settings")
+	}
+	return
+}
+
+// hostInfoFromEnodeURL parses the enode URL into the storage host information
+func hostInfoFromEnodeURL(enodeURL string) (host storage.HostInfo, err error) {
+	node, err := enode.ParseV4(enodeURL)
+	if err != nil {
+		return storage.HostInfo{}, fmt.Errorf("failed to parse the enode URL %v: %s", enodeURL, err.Error())
+	}
+	host.EnodeURL = enodeURL
+	host.EnodeID = node.ID()
+	host.IP = node.IP().String()
+	host.NodePubKey = crypto.FromECDSAPub(node.Pubkey())
+	return
+}
+
 // randomHostsForContractForm will randomly retrieve some storage hosts from the storage host pool
 func (cm *ContractManager) randomHostsForContractForm(neededContracts int) (randomHosts []storage.HostInfo, err error) {
 	// for all active contracts, the storage host will be added to be blacklist
@@ -188,7 +329,7 @@ func (cm *ContractManager) ContractCreate(params storage.ContractParams) (md sto
 	// Calculate the payouts for the client, host, and whole contract
 	period := endHeight - startHeight
 	expectedStorage := rentPayment.ExpectedStorage / rentPayment.StorageHosts
-	clientPayout, hostPayout, _, err := ClientPayouts(host, funding, common.BigInt0, common.BigInt0, period, expectedStorage)
+	clientPayout, hostPayout, _, err := ClientPayouts(host, funding, common.BigInt0, common.BigInt0, period, expectedStorage, cm.minHostCollateralPercentage())
 	if err != nil {
 		err = fmt.Errorf("failed to calculate the client payouts: %s", err.Error())
 		return storage.ContractMetaData{}, err
@@ -222,6 +363,11 @@ func (cm *ContractManager) ContractCreate(params storage.ContractParams) (md sto
 		},
 	}
 
+	// check the client can afford the contract before the negotiation starts
+	if err = cm.checkContractAffordability(clientPaymentAddress, funding); err != nil {
+		return storage.ContractMetaData{}, err
+	}
+
 	//Find the wallet based on the account address
 	account := accounts.Account{Address: clientPaymentAddress}
 	wallet, err := cm.b.AccountManager().Find(account)
@@ -242,7 +388,7 @@ func (cm *ContractManager) ContractCreate(params storage.ContractParams) (md sto
 	var clientNegotiateErr, hostNegotiateErr, hostCommitErr error
 	defer func() {
 		if clientNegotiateErr != nil {
-			_ = sp.SendClientNegotiateErrorMsg()
+			_ = sp.SendClientNegotiateErrorMsg(clientNegotiateErr)
 			if msg, err := sp.ClientWaitContractResp(); err != nil || msg.Code != storage.HostAckMsg {
 				cm.log.Error("Client receive host ack msg failed or msg.code is not host ack", "err", err)
 			}
@@ -293,7 +439,7 @@ func (cm *ContractManager) ContractCreate(params storage.ContractParams) (md sto
 
 	// if host send some negotiation error, client should handler it
 	if msg.Code == storage.HostNegotiateErrorMsg {
-		hostNegotiateErr = storage.ErrHostNegotiate
+		hostNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrHostNegotiate)
 		return storage.ContractMetaData{}, hostNegotiateErr
 	}
 
@@ -339,7 +485,7 @@ func (cm *ContractManager) ContractCreate(params storage.ContractParams) (md sto
 
 	// if host send some negotiation error, client should handler it
 	if msg.Code == storage.HostNegotiateErrorMsg {
-		hostNegotiateErr = storage.ErrHostNegotiate
+		hostNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrHostNegotiate)
 		return storage.ContractMetaData{}, hostNegotiateErr
 	}
 
@@ -383,7 +529,7 @@ func (cm *ContractManager) ContractCreate(params storage.ContractParams) (md sto
 	meta, err := cm.GetStorageContractSet().InsertContract(header, nil)
 	if err != nil {
 		// ignore the send message error the same as negotiate error
-		_ = sp.SendClientCommitFailedMsg()
+		_ = sp.SendClientCommitFailedMsg(err)
 
 		// wait for host ack msg
 		msg, err = sp.ClientWaitContractResp()
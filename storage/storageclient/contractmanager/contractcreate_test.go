@@ -0,0 +1,229 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/accounts"
+	"github.com/DxChainNetwork/godx/accounts/keystore"
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/p2p"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+func TestContractManager_FormContractWithHost(t *testing.T) {
+	cm, err := createNewContractManager()
+	if err != nil {
+		t.Fatalf("failed to create the contract manager: %s", err.Error())
+	}
+	backend, err := newFormContractBackend()
+	if err != nil {
+		t.Fatalf("failed to create the backend: %s", err.Error())
+	}
+	defer os.RemoveAll(backend.keyDir)
+	cm.b = backend
+
+	hostKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate the host key: %s", err.Error())
+	}
+	hostNode := enode.NewV4(&hostKey.PublicKey, net.ParseIP("127.0.0.1"), 30303, 30303)
+	funding := common.NewBigInt(1000000)
+
+	// the contract duration exceeding the host max duration is rejected
+	if _, err = cm.FormContractWithHost(hostNode.String(), funding, backend.config.MaxDuration+1); err == nil {
+		t.Fatalf("contract duration exceeding the host max duration is expected to be rejected")
+	}
+
+	// the funding not enough for the contract price is rejected
+	if _, err = cm.FormContractWithHost(hostNode.String(), backend.config.ContractPrice, backend.config.MaxDuration); err == nil {
+		t.Fatalf("funding not enough for the contract price is expected to be rejected")
+	}
+
+	md, err := cm.FormContractWithHost(hostNode.String(), funding, backend.config.MaxDuration)
+	if err != nil {
+		t.Fatalf("failed to form the contract with host: %s", err.Error())
+	}
+	defer rollbackContractSet(cm.activeContracts, md.ID)
+
+	if md.EnodeID != hostNode.ID() {
+		t.Errorf("the contract is expected to be formed with host %v, instead got %v", hostNode.ID(), md.EnodeID)
+	}
+	contract, exists := cm.RetrieveActiveContract(md.ID)
+	if !exists {
+		t.Fatalf("the contract formed is not found in the active contracts")
+	}
+	if !contract.Status.UploadAbility || !contract.Status.RenewAbility {
+		t.Errorf("the contract formed is expected to be good for upload and renew, instead got %+v", contract.Status)
+	}
+	if id, exists := cm.hostToContract[hostNode.ID()]; !exists || id != md.ID {
+		t.Errorf("the host to contract mapping is not updated")
+	}
+
+	// forming another contract with the same host is rejected
+	if _, err = cm.FormContractWithHost(hostNode.String(), funding, backend.config.MaxDuration); err == nil {
+		t.Errorf("forming another contract with the same host is expected to be rejected")
+	}
+}
+
+// TestContractManager_FormContractWithHost_InsufficientBalance test the contract formation with an
+// underfunded client account is aborted before the negotiation starts
+func TestContractManager_FormContractWithHost_InsufficientBalance(t *testing.T) {
+	cm, err := createNewContractManager()
+	if err != nil {
+		t.Fatalf("failed to create the contract manager: %s", err.Error())
+	}
+	formBackend, err := newFormContractBackend()
+	if err != nil {
+		t.Fatalf("failed to create the backend: %s", err.Error())
+	}
+	defer os.RemoveAll(formBackend.keyDir)
+	backend := &countingFormContractBackend{formContractBackend: formBackend}
+	cm.b = backend
+
+	hostKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate the host key: %s", err.Error())
+	}
+	hostNode := enode.NewV4(&hostKey.PublicKey, net.ParseIP("127.0.0.1"), 30303, 30303)
+
+	// the balance covers the funding but not the gas fee
+	funding := common.NewBigInt(1000000)
+	formBackend.balance = funding.BigIntPtr()
+	formBackend.gasPrice = big.NewInt(10)
+	_, err = cm.FormContractWithHost(hostNode.String(), funding, formBackend.config.MaxDuration)
+	if err == nil || !strings.Contains(err.Error(), "insufficient balance") {
+		t.Fatalf("expect the insufficient balance error, got %v", err)
+	}
+	if maxActive := atomic.LoadInt32(&backend.maxActive); maxActive != 0 {
+		t.Errorf("contract creation requested to the storage host with insufficient balance")
+	}
+	if _, exists := cm.hostToContract[hostNode.ID()]; exists {
+		t.Errorf("contract formed with insufficient balance")
+	}
+}
+
+// formContractBackend is the client backend used for contract formation test, where the
+// storage host config and the negotiation are mocked
+type formContractBackend struct {
+	storageClientBackendContractManager
+
+	keyDir         string
+	am             *accounts.Manager
+	paymentAddress common.Address
+	balance        *big.Int
+	gasPrice       *big.Int
+	config         storage.HostExtConfig
+}
+
+func newFormContractBackend() (*formContractBackend, error) {
+	keyDir, err := ioutil.TempDir("", "formcontract")
+	if err != nil {
+		return nil, err
+	}
+	ks := keystore.NewKeyStore(keyDir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		return nil, err
+	}
+	if err = ks.Unlock(account, ""); err != nil {
+		return nil, err
+	}
+
+	return &formContractBackend{
+		keyDir:         keyDir,
+		am:             accounts.NewManager(ks),
+		paymentAddress: account.Address,
+		balance:        new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil),
+		gasPrice:       big.NewInt(1),
+		config: storage.HostExtConfig{
+			AcceptingContracts: true,
+			MaxDuration:        testRentPayment.Period,
+			Deposit:            common.NewBigInt(10),
+			MaxDeposit:         common.NewBigInt(100),
+			ContractPrice:      common.NewBigInt(100),
+			StoragePrice:       common.NewBigInt(1),
+		},
+	}, nil
+}
+
+func (b *formContractBackend) GetStorageHostSetting(hostEnodeID enode.ID, hostEnodeURL string, config *storage.HostExtConfig) error {
+	*config = b.config
+	return nil
+}
+
+func (b *formContractBackend) AccountManager() *accounts.Manager {
+	return b.am
+}
+
+func (b *formContractBackend) GetPaymentAddress() (common.Address, error) {
+	return b.paymentAddress, nil
+}
+
+func (b *formContractBackend) GetAvailableBalance(address common.Address) (*big.Int, error) {
+	return b.balance, nil
+}
+
+func (b *formContractBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	return b.gasPrice, nil
+}
+
+func (b *formContractBackend) SetupConnection(enodeURL string) (storage.Peer, error) {
+	node, err := enode.ParseV4(enodeURL)
+	if err != nil {
+		return nil, err
+	}
+	return &formContractPeer{node: node}, nil
+}
+
+// formContractPeer mocks the storage host accepting the contract creation. Only the methods
+// used by the contract creation are implemented
+type formContractPeer struct {
+	storage.Peer
+
+	node      *enode.Node
+	responses []p2p.Msg
+}
+
+func (p *formContractPeer) RequestContractCreation(req storage.ContractCreateRequest) error {
+	return p.respond(storage.ContractCreateHostSign, []byte("host contract sign"))
+}
+
+func (p *formContractPeer) SendContractCreateClientRevisionSign(revisionSign []byte) error {
+	return p.respond(storage.ContractCreateRevisionSign, []byte("host revision sign"))
+}
+
+func (p *formContractPeer) SendClientCommitSuccessMsg() error {
+	return p.respond(storage.HostAckMsg, []byte{})
+}
+
+func (p *formContractPeer) ClientWaitContractResp() (msg p2p.Msg, err error) {
+	msg, p.responses = p.responses[0], p.responses[1:]
+	return
+}
+
+func (p *formContractPeer) PeerNode() *enode.Node {
+	return p.node
+}
+
+func (p *formContractPeer) respond(code uint64, data interface{}) error {
+	size, r, err := rlp.EncodeToReader(data)
+	if err != nil {
+		return err
+	}
+	p.responses = append(p.responses, p2p.Msg{Code: code, Size: uint32(size), Payload: r})
+	return nil
+}
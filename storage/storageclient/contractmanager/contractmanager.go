@@ -49,6 +49,20 @@ type ContractManager struct {
 	renewedTo        map[storage.ContractID]storage.ContractID
 	failedRenewCount map[storage.ContractID]uint64
 
+	// deferred contracts are formed with the minimal funding and wait for the activation,
+	// mapping from the contract id to the enode URL of the storage host
+	deferredContracts map[storage.ContractID]string
+
+	// renewalFilter decides the hosts whose contracts are allowed to lapse
+	renewalFilter RenewalFilter
+
+	// renewPolicy decides whether the contract about to expire is renewed or replaced with
+	// a fresh formation
+	renewPolicy string
+
+	// negotiations bounds the contract formations and renewals in progress
+	negotiations *negotiationLimiter
+
 	// used to acquire storage contract
 	blockHeight   uint64
 	currentPeriod uint64
@@ -67,15 +81,18 @@ type ContractManager struct {
 func New(persistDir string, hm *storagehostmanager.StorageHostManager) (cm *ContractManager, err error) {
 	// contract manager initialization
 	cm = &ContractManager{
-		persistDir:       persistDir,
-		hostManager:      hm,
-		maintenanceStop:  make(chan struct{}),
-		expiredContracts: make(map[storage.ContractID]storage.ContractMetaData),
-		renewedFrom:      make(map[storage.ContractID]storage.ContractID),
-		renewedTo:        make(map[storage.ContractID]storage.ContractID),
-		failedRenewCount: make(map[storage.ContractID]uint64),
-		hostToContract:   make(map[enode.ID]storage.ContractID),
-		quit:             make(chan struct{}),
+		persistDir:        persistDir,
+		hostManager:       hm,
+		maintenanceStop:   make(chan struct{}),
+		expiredContracts:  make(map[storage.ContractID]storage.ContractMetaData),
+		renewedFrom:       make(map[storage.ContractID]storage.ContractID),
+		renewedTo:         make(map[storage.ContractID]storage.ContractID),
+		failedRenewCount:  make(map[storage.ContractID]uint64),
+		deferredContracts: make(map[storage.ContractID]string),
+		hostToContract:    make(map[enode.ID]storage.ContractID),
+		negotiations:      newNegotiationLimiter(defaultMaxConcurrentNegotiations),
+		renewPolicy:       ContractRenewPolicyRenew,
+		quit:              make(chan struct{}),
 	}
 
 	// initialize log
@@ -156,6 +173,20 @@ func (cm *ContractManager) RetrieveRateLimit() (readBPS, writeBPS int64, packetS
 	return cm.activeContracts.RetrieveRateLimit()
 }
 
+// SetRenewalFilter will set the renewal filter, which is used to skip the renewal of the
+// contracts whose data is not required to be kept
+func (cm *ContractManager) SetRenewalFilter(filter RenewalFilter) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	cm.renewalFilter = filter
+}
+
+// SetMaxConcurrentNegotiations will set the maximum number of contract formations and renewals
+// in progress at the same time. 0 means unlimited
+func (cm *ContractManager) SetMaxConcurrentNegotiations(limit uint64) {
+	cm.negotiations.setLimit(int(limit))
+}
+
 // GetStorageContractSet will be used to get the contract set stored with active contracts
 func (cm *ContractManager) GetStorageContractSet() (contractSet *contractset.StorageContractSet) {
 	return cm.activeContracts
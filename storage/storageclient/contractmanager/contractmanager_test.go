@@ -75,17 +75,19 @@ var testRentPayment = storage.RentPayment{
 func newContractManagerTest(hm *storagehostmanager.StorageHostManager) (cm *ContractManager, err error) {
 	// create and initialize host manager
 	cm = &ContractManager{
-		b:                &storageClientBackendContractManager{},
-		persistDir:       "test",
-		hostManager:      hm,
-		maintenanceStop:  make(chan struct{}),
-		expiredContracts: make(map[storage.ContractID]storage.ContractMetaData),
-		renewedFrom:      make(map[storage.ContractID]storage.ContractID),
-		renewedTo:        make(map[storage.ContractID]storage.ContractID),
-		failedRenewCount: make(map[storage.ContractID]uint64),
-		hostToContract:   make(map[enode.ID]storage.ContractID),
-		quit:             make(chan struct{}),
-		log:              log.New(),
+		b:                 &storageClientBackendContractManager{},
+		persistDir:        "test",
+		hostManager:       hm,
+		maintenanceStop:   make(chan struct{}),
+		expiredContracts:  make(map[storage.ContractID]storage.ContractMetaData),
+		renewedFrom:       make(map[storage.ContractID]storage.ContractID),
+		renewedTo:         make(map[storage.ContractID]storage.ContractID),
+		failedRenewCount:  make(map[storage.ContractID]uint64),
+		deferredContracts: make(map[storage.ContractID]string),
+		hostToContract:    make(map[enode.ID]storage.ContractID),
+		negotiations:      newNegotiationLimiter(defaultMaxConcurrentNegotiations),
+		quit:              make(chan struct{}),
+		log:               log.New(),
 	}
 	cs, err := contractset.New("test")
 	if err != nil {
@@ -186,6 +188,10 @@ func (st *storageClientBackendContractManager) GetPaymentAddress() (address comm
 	return
 }
 
+func (st *storageClientBackendContractManager) GetAvailableBalance(address common.Address) (*big.Int, error) {
+	return new(big.Int), nil
+}
+
 func (st *storageClientBackendContractManager) TryToRenewOrRevise(hostID enode.ID) bool {
 	return false
 }
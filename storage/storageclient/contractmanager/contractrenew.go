@@ -8,11 +8,13 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/DxChainNetwork/godx/accounts"
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/math"
 	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/core/vm"
 	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/rlp"
@@ -23,6 +25,30 @@ import (
 	dberrors "github.com/syndtr/goleveldb/leveldb/errors"
 )
 
+// RenewalFilter returns the hosts whose contracts are allowed to lapse according to
+// the renewal policy of the files stored
+type RenewalFilter interface {
+	LapsingHosts() (map[enode.ID]struct{}, error)
+}
+
+// lapsingHosts returns the hosts whose contracts shall not be renewed. If the renewal
+// filter is not set or failed, nil is returned and all contracts are checked for renew
+func (cm *ContractManager) lapsingHosts() map[enode.ID]struct{} {
+	cm.lock.RLock()
+	filter := cm.renewalFilter
+	cm.lock.RUnlock()
+
+	if filter == nil {
+		return nil
+	}
+	lapsing, err := filter.LapsingHosts()
+	if err != nil {
+		cm.log.Warn("failed to get the lapsing hosts", "err", err.Error())
+		return nil
+	}
+	return lapsing
+}
+
 // checkForContractRenew will loop through all active contracts and filter out those needs to be renewed.
 // There are two types of contract needs to be renewed
 // 		1. contracts that are about to expired. they need to be renewed
@@ -34,8 +60,15 @@ func (cm *ContractManager) checkForContractRenew(rentPayment storage.RentPayment
 	currentBlockHeight := cm.blockHeight
 	cm.lock.RUnlock()
 
+	lapsing := cm.lapsingHosts()
+
 	// loop through all active contracts, get the closeToExpireRenews and insufficientFundingRenews
 	for _, contract := range cm.activeContracts.RetrieveAllContractsMetaData() {
+		// skip the contract whose data is not required to be kept by the renewal policy
+		if _, skip := lapsing[contract.EnodeID]; skip {
+			continue
+		}
+
 		// validate the storage host for the contract, check if the host exists or get filtered
 		host, exists := cm.hostManager.RetrieveHostInfo(contract.EnodeID)
 		if !exists || host.Filtered {
@@ -47,6 +80,11 @@ func (cm *ContractManager) checkForContractRenew(rentPayment storage.RentPayment
 			continue
 		}
 
+		// the deferred contract is only renewed when it is activated
+		if cm.isDeferredContract(contract.ID) {
+			continue
+		}
+
 		// for contract that is about to expire, it will be added to the priorityRenews
 		// calculate the renewCostEstimation and update the priorityRenews
 		if currentBlockHeight+storage.RenewWindow >= contract.EndHeight {
@@ -174,6 +212,14 @@ func (cm *ContractManager) contractRenewStart(record contractRenewRecord, curren
 	// finished renewing
 	defer cm.b.RevisionOrRenewingDone(contractMeta.EnodeID)
 
+	// wait for a negotiation slot
+	if !cm.negotiations.acquire(cm.quit) {
+		renewCost = common.BigInt0
+		err = fmt.Errorf("contract manager stopped before renewing the contract")
+		return
+	}
+	defer cm.negotiations.release()
+
 	// acquire the oldContract (contract that is about to be renewed)
 	oldContract, exists := cm.activeContracts.Acquire(renewContractID)
 	if !exists {
@@ -396,7 +442,7 @@ func (cm *ContractManager) ContractRenew(oldContract *contractset.Contract, para
 	// Calculate the payouts for the client, host, and whole contract
 	period := endHeight - startHeight
 	expectedStorage := rentPayment.ExpectedStorage / rentPayment.StorageHosts
-	clientPayout, hostPayout, hostCollateral, err := ClientPayouts(host, funding, basePrice, baseCollateral, period, expectedStorage)
+	clientPayout, hostPayout, hostCollateral, err := ClientPayouts(host, funding, basePrice, baseCollateral, period, expectedStorage, cm.minHostCollateralPercentage())
 	if err != nil {
 		return storage.ContractMetaData{}, err
 	}
@@ -432,6 +478,11 @@ func (cm *ContractManager) ContractRenew(oldContract *contractset.Contract, para
 		},
 	}
 
+	// check the client can afford the renewed contract before the negotiation starts
+	if err = cm.checkContractAffordability(clientAddr, funding); err != nil {
+		return storage.ContractMetaData{}, err
+	}
+
 	account := accounts.Account{Address: clientAddr}
 	wallet, err := cm.b.AccountManager().Find(account)
 	if err != nil {
@@ -449,7 +500,7 @@ func (cm *ContractManager) ContractRenew(oldContract *contractset.Contract, para
 	var clientNegotiateErr, hostNegotiateErr, hostCommitErr error
 	defer func() {
 		if clientNegotiateErr != nil {
-			_ = sp.SendClientNegotiateErrorMsg()
+			_ = sp.SendClientNegotiateErrorMsg(clientNegotiateErr)
 			if msg, err := sp.ClientWaitContractResp(); err != nil || msg.Code != storage.HostAckMsg {
 				cm.log.Error("Client receive host ack msg failed or msg.code is not host ack", "err", err)
 			}
@@ -498,7 +549,7 @@ func (cm *ContractManager) ContractRenew(oldContract *contractset.Contract, para
 
 	// if host send some negotiation error, client should handler it
 	if msg.Code == storage.HostNegotiateErrorMsg {
-		hostNegotiateErr = storage.ErrHostNegotiate
+		hostNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrHostNegotiate)
 		return storage.ContractMetaData{}, hostNegotiateErr
 	}
 
@@ -542,7 +593,7 @@ func (cm *ContractManager) ContractRenew(oldContract *contractset.Contract, para
 
 	// if host send some negotiation error, client should handler it
 	if msg.Code == storage.HostNegotiateErrorMsg {
-		hostNegotiateErr = storage.ErrHostNegotiate
+		hostNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrHostNegotiate)
 		return storage.ContractMetaData{}, hostNegotiateErr
 	}
 
@@ -595,7 +646,7 @@ func (cm *ContractManager) ContractRenew(oldContract *contractset.Contract, para
 	contractMetaData, err := cm.GetStorageContractSet().InsertContract(header, oldRoots)
 	if err != nil {
 		// ignore the send message error
-		_ = sp.SendClientCommitFailedMsg()
+		_ = sp.SendClientCommitFailedMsg(err)
 
 		// wait for host ack msg
 		msg, err = sp.ClientWaitContractResp()
@@ -641,8 +692,10 @@ func PubkeyToEnodeID(pubkey *ecdsa.PublicKey) enode.ID {
 	return enode.ID(crypto.Keccak256Hash(pubBytes[:]))
 }
 
-// ClientPayouts calculate client and host collateral
-func ClientPayouts(host storage.HostInfo, funding common.BigInt, basePrice common.BigInt, baseCollateral common.BigInt, period uint64, expectedStorage uint64) (clientPayout common.BigInt, hostPayout common.BigInt, hostCollateral common.BigInt, err error) {
+// ClientPayouts calculate client and host collateral. If minHostCollateralPercentage is not 0, the
+// host payout must take at least the percentage of the contract payout, otherwise the contract will
+// be rejected by the chain, and an error is returned so that the host is skipped
+func ClientPayouts(host storage.HostInfo, funding common.BigInt, basePrice common.BigInt, baseCollateral common.BigInt, period uint64, expectedStorage uint64, minHostCollateralPercentage uint64) (clientPayout common.BigInt, hostPayout common.BigInt, hostCollateral common.BigInt, err error) {
 	// Divide by zero check.
 	if host.StoragePrice.Sign() == 0 {
 		host.StoragePrice = common.NewBigIntUint64(1)
@@ -673,5 +726,22 @@ func ClientPayouts(host storage.HostInfo, funding common.BigInt, basePrice commo
 
 	// Calculate hostPayout.
 	hostPayout = hostCollateral.Add(host.ContractPrice).Add(basePrice)
+
+	// The host collateral cannot be raised above the MaxDeposit of the host, thus the host
+	// failing the collateral floor of the chain is skipped
+	if err = vm.CheckHostCollateral(clientPayout.BigIntPtr(), hostPayout.BigIntPtr(), minHostCollateralPercentage); err != nil {
+		err = fmt.Errorf("host payout %v is too low for client payout %v: %v", hostPayout, clientPayout, err)
+		return
+	}
 	return
 }
+
+// minHostCollateralPercentage returns the minimum percentage of the contract payout the host
+// collateral must take for the storage contract submitted at the next block
+func (cm *ContractManager) minHostCollateralPercentage() uint64 {
+	config, block := cm.b.ChainConfig(), cm.b.CurrentBlock()
+	if config == nil || block == nil {
+		return 0
+	}
+	return config.MinHostCollateral(new(big.Int).Add(block.Number(), big.NewInt(1)))
+}
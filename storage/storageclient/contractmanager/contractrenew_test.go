@@ -0,0 +1,100 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/params"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// fakeRenewalFilter is the renewal filter returning the hosts specified
+type fakeRenewalFilter struct {
+	lapsing map[enode.ID]struct{}
+}
+
+func (f *fakeRenewalFilter) LapsingHosts() (map[enode.ID]struct{}, error) {
+	return f.lapsing, nil
+}
+
+// TestContractManager_CheckForContractRenew_Lapsing test the contracts with the host storing only
+// the files with NeverRenew policy are skipped for renew
+func TestContractManager_CheckForContractRenew_Lapsing(t *testing.T) {
+	cm, err := createNewContractManager()
+	if err != nil {
+		t.Fatalf("failed to create contract manager: %s", err.Error())
+	}
+
+	defer os.RemoveAll("test")
+	defer cm.activeContracts.Close()
+	defer cm.activeContracts.EmptyDB()
+
+	// insert contracts about to expire
+	contracts, err := insertHighEvalContract(cm, 2)
+	if err != nil {
+		t.Fatalf("failed to insert contracts: %s", err.Error())
+	}
+	lapsingContract, renewContract := contracts[0], contracts[1]
+
+	// without the renewal filter, both contracts shall be renewed
+	closeToExpireRenews, _ := cm.checkForContractRenew(testRentPayment)
+	if !renewRecordsContain(closeToExpireRenews, lapsingContract.ID) || !renewRecordsContain(closeToExpireRenews, renewContract.ID) {
+		t.Fatalf("both contracts are expected to be renewed without the renewal filter")
+	}
+
+	// the contract with the lapsing host shall be skipped
+	cm.SetRenewalFilter(&fakeRenewalFilter{
+		lapsing: map[enode.ID]struct{}{lapsingContract.EnodeID: {}},
+	})
+	closeToExpireRenews, insufficientFundingRenews := cm.checkForContractRenew(testRentPayment)
+	if renewRecordsContain(closeToExpireRenews, lapsingContract.ID) || renewRecordsContain(insufficientFundingRenews, lapsingContract.ID) {
+		t.Errorf("the contract with the lapsing host is expected not to be renewed")
+	}
+	if !renewRecordsContain(closeToExpireRenews, renewContract.ID) {
+		t.Errorf("the contract not lapsing is expected to be renewed")
+	}
+}
+
+func renewRecordsContain(records []contractRenewRecord, id storage.ContractID) bool {
+	for _, record := range records {
+		if record.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TestClientPayouts_MinHostCollateral test the host with the host payout below the collateral
+// floor is rejected only when the floor is set
+func TestClientPayouts_MinHostCollateral(t *testing.T) {
+	host := storage.HostInfo{}
+	host.ContractPrice = common.NewBigIntUint64(10)
+	host.StoragePrice = common.NewBigIntUint64(1)
+	host.Deposit = common.NewBigIntUint64(1)
+	funding := common.NewBigIntUint64(1000)
+
+	// the host collateral is limited by the max deposit of the host
+	host.MaxDeposit = common.NewBigIntUint64(1)
+	if _, _, _, err := ClientPayouts(host, funding, common.BigInt0, common.BigInt0, 100, 100, 0); err != nil {
+		t.Fatalf("the payouts are expected to be accepted without the collateral floor: %v", err)
+	}
+	if _, _, _, err := ClientPayouts(host, funding, common.BigInt0, common.BigInt0, 100, 100, params.DefaultMinHostCollateralPercentage); err == nil {
+		t.Fatalf("the payouts with the host payout below the collateral floor are expected to be rejected")
+	}
+
+	// the host willing to put enough collateral is accepted
+	host.MaxDeposit = common.NewBigIntUint64(1e6)
+	clientPayout, hostPayout, _, err := ClientPayouts(host, funding, common.BigInt0, common.BigInt0, 100, 100, params.DefaultMinHostCollateralPercentage)
+	if err != nil {
+		t.Fatalf("the payouts are expected to be accepted: %v", err)
+	}
+	if !clientPayout.IsEqual(common.NewBigIntUint64(990)) || !hostPayout.IsEqual(common.NewBigIntUint64(1000)) {
+		t.Errorf("unexpected payouts: client %v, host %v", clientPayout, hostPayout)
+	}
+}
@@ -5,10 +5,89 @@
 package contractmanager
 
 import (
+	"context"
+	"fmt"
+	"math/big"
+
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/internal/ethapi"
 	"github.com/DxChainNetwork/godx/storage"
 )
 
+// ContractFeeEstimate is the projected fees of forming storage contracts
+type ContractFeeEstimate struct {
+	GasPrice    common.BigInt
+	Gas         uint64
+	GasFee      common.BigInt
+	ContractFee common.BigInt
+}
+
+// TotalFee returns the sum of the gas fee and the contract fee
+func (fe ContractFeeEstimate) TotalFee() common.BigInt {
+	return fe.GasFee.Add(fe.ContractFee)
+}
+
+// EstimateContractFees will estimate the gas fee and the contract fee of forming n contracts, based
+// on the gas price currently suggested by the network and the contract price of the host market
+func (cm *ContractManager) EstimateContractFees(n uint64) (estimate ContractFeeEstimate, err error) {
+	return cm.estimateContractFees(n, cm.hostManager)
+}
+
+// estimateContractFees estimate the fees of forming n contracts with the contract price of the market
+func (cm *ContractManager) estimateContractFees(n uint64, market hostMarket) (estimate ContractFeeEstimate, err error) {
+	gasPrice, err := cm.b.SuggestPrice(context.Background())
+	if err != nil {
+		err = fmt.Errorf("failed to get the suggested gas price: %s", err.Error())
+		return
+	}
+	estimate = contractFeeEstimation(n, gasPrice, market.GetMarketPrice())
+	return
+}
+
+// contractFeeEstimation calculates the fees of forming n contracts with the gas price and the
+// market price. Each contract is formed with a single storage contract creation transaction
+func contractFeeEstimation(n uint64, gasPrice *big.Int, prices storage.MarketPrice) (estimate ContractFeeEstimate) {
+	estimate.GasPrice = common.BigInt0
+	if gasPrice != nil {
+		estimate.GasPrice = common.PtrBigInt(gasPrice)
+	}
+	estimate.Gas = contractCreateTxGas * n
+	estimate.GasFee = estimate.GasPrice.MultUint64(estimate.Gas)
+	estimate.ContractFee = prices.ContractPrice.MultUint64(n)
+	return
+}
+
+// checkContractAffordability checks the client account has the balance to pay for the contract
+// before the negotiation starts, so that a contract which is doomed to be rejected on chain is
+// not negotiated with the storage host. The client collateral locked on chain and the contract
+// price are both paid out of the funding, thus the balance shall cover the funding and the gas
+// of the contract creation transaction
+func (cm *ContractManager) checkContractAffordability(clientAddr common.Address, funding common.BigInt) error {
+	balance, err := cm.b.GetAvailableBalance(clientAddr)
+	if err != nil {
+		return fmt.Errorf("failed to get the balance of the client account %v: %s", clientAddr.Hex(), err.Error())
+	}
+	gasPrice, err := cm.b.SuggestPrice(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get the suggested gas price: %s", err.Error())
+	}
+
+	gasFee := common.BigInt0
+	if gasPrice != nil {
+		gasFee = common.PtrBigInt(gasPrice).MultUint64(ethapi.StorageContractTxGas)
+	}
+	required := funding.Add(gasFee)
+	if balance == nil || common.PtrBigInt(balance).Cmp(required) < 0 {
+		available := common.BigInt0
+		if balance != nil {
+			available = common.PtrBigInt(balance)
+		}
+		return fmt.Errorf("insufficient balance of the client account %v to form the contract: available %v, required %v for the funding %v and the gas fee %v",
+			clientAddr.Hex(), available, required, funding, gasFee)
+	}
+	return nil
+}
+
 // renewCostEstimation will estimate the estimated cost for the contract period after the renew, the cost estimation included the following costs:
 // 		1. storageCost for storing current amount of data (contract.LatestContractRevision.NewFileSize) for the current amount of time (period)
 // 		2. calculate the upload and download cost within the current period. Multiple renews may happen within the same current period when contract go renew
@@ -0,0 +1,63 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// gasPriceBackend is the backend whose suggested gas price could be changed
+type gasPriceBackend struct {
+	storageClientBackendContractManager
+	gasPrice *big.Int
+}
+
+func (b *gasPriceBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	return b.gasPrice, nil
+}
+
+// TestContractManager_EstimateContractFees test the estimated fees track the gas price
+// suggested by the network
+func TestContractManager_EstimateContractFees(t *testing.T) {
+	backend := &gasPriceBackend{}
+	cm := &ContractManager{b: backend}
+	market := &fakeHostMarket{
+		storage.MarketPrice{
+			ContractPrice: common.NewBigInt(1000),
+		},
+	}
+	numContracts := uint64(5)
+
+	for _, gasPrice := range []int64{0, 1, 20, 300} {
+		backend.gasPrice = big.NewInt(gasPrice)
+		estimate, err := cm.estimateContractFees(numContracts, market)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estimate.GasPrice.Cmp(common.NewBigInt(gasPrice)) != 0 {
+			t.Errorf("gas price not expected. Expect %v, got %v", gasPrice, estimate.GasPrice)
+		}
+		expectedGas := contractCreateTxGas * numContracts
+		if estimate.Gas != expectedGas {
+			t.Errorf("gas not expected. Expect %v, got %v", expectedGas, estimate.Gas)
+		}
+		expectedGasFee := common.NewBigInt(gasPrice).MultUint64(expectedGas)
+		if estimate.GasFee.Cmp(expectedGasFee) != 0 {
+			t.Errorf("gas fee not expected. Expect %v, got %v", expectedGasFee, estimate.GasFee)
+		}
+		expectedContractFee := market.prices.ContractPrice.MultUint64(numContracts)
+		if estimate.ContractFee.Cmp(expectedContractFee) != 0 {
+			t.Errorf("contract fee not expected. Expect %v, got %v", expectedContractFee, estimate.ContractFee)
+		}
+		if estimate.TotalFee().Cmp(expectedGasFee.Add(expectedContractFee)) != 0 {
+			t.Errorf("total fee not expected. Expect %v, got %v", expectedGasFee.Add(expectedContractFee), estimate.TotalFee())
+		}
+	}
+}
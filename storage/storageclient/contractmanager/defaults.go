@@ -9,6 +9,7 @@ import (
 	"math/big"
 
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/params"
 )
 
 // persistent related constants
@@ -40,6 +41,10 @@ const (
 
 	// if a contract failed to renew for 12 times, consider to replace the contract
 	consecutiveRenewFailsBeforeReplacement = 12
+
+	// defaultMaxConcurrentNegotiations is the default maximum number of contract formations
+	// and renewals in progress at the same time
+	defaultMaxConcurrentNegotiations = 4
 )
 
 // rentPayment related constants
@@ -51,6 +56,30 @@ const (
 	downloadSizeRatio float64 = 1
 )
 
+// contract fee estimation related constants
+const (
+	// contractCreateTxSize is the expected size in bytes of the payload of a storage contract
+	// creation transaction, which contains the storage contract and the signatures
+	contractCreateTxSize = uint64(512)
+
+	// contractCreateExecGas is the gas charged by executing a storage contract creation
+	// transaction, i.e. decoding the storage contract, checking it and its signatures
+	contractCreateExecGas = params.DecodeGas + params.CheckFileGas + params.CheckMultiSignaturesGas
+
+	// contractCreateTxGas is the expected gas used by a storage contract creation transaction.
+	// All bytes in the payload are regarded as non-zero
+	contractCreateTxGas = params.TxGas + contractCreateTxSize*params.TxDataNonZeroGas + contractCreateExecGas
+
+	// contractCarriedStateSize is the size in bytes of the file size and the file merkle root
+	// carried over by a renewal, which are zero in a fresh formation
+	contractCarriedStateSize = uint64(8 + common.HashLength)
+
+	// contractRenewTxGas and contractFormTxGas are the expected gas used by the storage contract
+	// creation transaction of a renewal and of a fresh formation
+	contractRenewTxGas = contractCreateTxGas
+	contractFormTxGas  = contractCreateTxGas - contractCarriedStateSize*(params.TxDataNonZeroGas-params.TxDataZeroGas)
+)
+
 // variables below are used to calculate the maxHostStoragePrice and maxHostDeposit, which set
 // a limitation to storage host's configuration
 var (
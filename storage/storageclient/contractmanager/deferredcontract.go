@@ -0,0 +1,162 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/contractset"
+)
+
+// FormDeferredContract forms the contract with the storage host specified by the enode URL with
+// the minimal funding, which reserves the contract with the storage host. The contract is not
+// good for uploading until it is funded by ActivateContract. The storage host must support the
+// deferred funding
+func (cm *ContractManager) FormDeferredContract(enodeURL string, duration uint64) (md storage.ContractMetaData, err error) {
+	return cm.formContractWithHost(enodeURL, common.BigInt0, duration, true)
+}
+
+// ActivateContract funds the deferred contract, after which the contract is good for uploading.
+// As the payouts cannot be changed by the contract revision, the deferred contract is renewed
+// with the funding till the same end height. The renewed contract is returned
+func (cm *ContractManager) ActivateContract(id storage.ContractID, funding common.BigInt) (md storage.ContractMetaData, err error) {
+	cm.lock.RLock()
+	enodeURL, deferred := cm.deferredContracts[id]
+	rentPayment := cm.rentPayment
+	blockHeight := cm.blockHeight
+	cm.lock.RUnlock()
+
+	// validate the contract to be activated
+	if !deferred {
+		return storage.ContractMetaData{}, fmt.Errorf("the contract %v is not waiting for activation", id)
+	}
+	contract, exists := cm.RetrieveActiveContract(id)
+	if !exists {
+		return storage.ContractMetaData{}, fmt.Errorf("the deferred contract %v no longer exists", id)
+	}
+	if blockHeight >= contract.EndHeight {
+		return storage.ContractMetaData{}, fmt.Errorf("the deferred contract %v is already expired", id)
+	}
+
+	// request the newest host config, keeping the interaction records if the storage host is known
+	host, err := hostInfoFromEnodeURL(enodeURL)
+	if err != nil {
+		return storage.ContractMetaData{}, err
+	}
+	if known, exists := cm.hostManager.RetrieveHostInfo(host.EnodeID); exists {
+		known.EnodeURL = host.EnodeURL
+		host = known
+	}
+	var config storage.HostExtConfig
+	if err = cm.b.GetStorageHostSetting(host.EnodeID, host.EnodeURL, &config); err != nil {
+		return storage.ContractMetaData{}, fmt.Errorf("failed to get the config of storage host %v: %s", host.EnodeID, err.Error())
+	}
+	host.HostExtConfig = config
+	if !host.AcceptingContracts {
+		return storage.ContractMetaData{}, fmt.Errorf("the storage host %v is not accepting contracts", host.EnodeID)
+	}
+
+	// check if the client can afford the activation
+	if funding.Cmp(host.ContractPrice) <= 0 {
+		return storage.ContractMetaData{}, fmt.Errorf("the funding %v is not enough to pay the contract price %v", funding, host.ContractPrice)
+	}
+	clientRemainingFund := rentPayment.Fund.Sub(cm.CalculatePeriodCost(rentPayment).ContractFund)
+	if funding.Cmp(clientRemainingFund) > 0 {
+		return storage.ContractMetaData{}, fmt.Errorf("the funding %v is larger than client remaining fund %v", funding, clientRemainingFund)
+	}
+	clientPaymentAddress, err := cm.b.GetPaymentAddress()
+	if err != nil {
+		return storage.ContractMetaData{}, fmt.Errorf("failed to get the clientPayment address: %s", err.Error())
+	}
+
+	// the contract cannot be revised while it is being activated
+	if cm.b.TryToRenewOrRevise(contract.EnodeID) {
+		return storage.ContractMetaData{}, fmt.Errorf("the contract is revising, cannot be activated")
+	}
+	defer cm.b.RevisionOrRenewingDone(contract.EnodeID)
+
+	if !cm.negotiations.acquire(cm.quit) {
+		return storage.ContractMetaData{}, fmt.Errorf("contract manager stopped before activating the contract")
+	}
+	defer cm.negotiations.release()
+
+	oldContract, exists := cm.activeContracts.Acquire(id)
+	if !exists {
+		return storage.ContractMetaData{}, fmt.Errorf("the deferred contract %v no longer exists", id)
+	}
+
+	// renew the deferred contract with the funding
+	rentPayment.Period = contract.EndHeight - blockHeight
+	params := storage.ContractParams{
+		RentPayment:          rentPayment,
+		HostEnodeURL:         host.EnodeURL,
+		Funding:              funding,
+		StartHeight:          blockHeight,
+		EndHeight:            contract.EndHeight,
+		ClientPaymentAddress: clientPaymentAddress,
+		Host:                 host,
+	}
+	if md, err = cm.ContractRenew(oldContract, params); err != nil {
+		if failedReturn := cm.activeContracts.Return(oldContract); failedReturn != nil {
+			cm.log.Warn("the deferred contract cannot be returned because it has been deleted already")
+		}
+		return storage.ContractMetaData{}, fmt.Errorf("failed to activate the contract %v: %s", id, err.Error())
+	}
+
+	// the deferred contract is replaced by the activated contract
+	status := oldContract.Status()
+	status.UploadAbility = false
+	status.RenewAbility = false
+	status.Canceled = true
+	if failedUpdate := oldContract.UpdateStatus(status); failedUpdate != nil {
+		cm.log.Warn("failed to update the deferred contract status", "err", failedUpdate.Error())
+	}
+
+	cm.lock.Lock()
+	cm.hostToContract[md.EnodeID] = md.ID
+	cm.renewedFrom[md.ID] = id
+	cm.renewedTo[id] = md.ID
+	cm.expiredContracts[id] = oldContract.Metadata()
+	delete(cm.deferredContracts, id)
+	cm.lock.Unlock()
+
+	if failedDelete := cm.activeContracts.Delete(oldContract); failedDelete != nil {
+		cm.log.Error("failed to delete the deferred contract from the active contract list", "err", failedDelete.Error())
+	}
+	if failedSave := cm.saveSettings(); failedSave != nil {
+		cm.log.Warn("after activated the contract, failed to save the contract manager settings")
+	}
+	return md, nil
+}
+
+// markDeferredContract records the contract as deferred. The deferred contract is not good for
+// uploading until it is activated
+func (cm *ContractManager) markDeferredContract(id storage.ContractID, enodeURL string) error {
+	cm.lock.Lock()
+	cm.deferredContracts[id] = enodeURL
+	cm.lock.Unlock()
+
+	return cm.updateContractStatus(id, storage.ContractStatus{RenewAbility: true})
+}
+
+// isDeferredContract checks if the contract is waiting for activation
+func (cm *ContractManager) isDeferredContract(id storage.ContractID) bool {
+	cm.lock.RLock()
+	defer cm.lock.RUnlock()
+	_, deferred := cm.deferredContracts[id]
+	return deferred
+}
+
+// deferredContractFunding returns the minimal funding of the deferred contract, which covers the
+// contract price and the storage of a sector for a single block
+func deferredContractFunding(host storage.HostInfo) common.BigInt {
+	storagePrice := host.StoragePrice
+	if storagePrice.Sign() == 0 {
+		storagePrice = common.NewBigIntUint64(1)
+	}
+	return host.ContractPrice.Add(storagePrice.MultUint64(contractset.SectorSize))
+}
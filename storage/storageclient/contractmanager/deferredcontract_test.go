@@ -0,0 +1,101 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestContractManager_ActivateContract test the deferred contract is formed with the minimal
+// funding and not good for uploading, and is good for uploading after it is activated
+func TestContractManager_ActivateContract(t *testing.T) {
+	cm, err := createNewContractManager()
+	if err != nil {
+		t.Fatalf("failed to create the contract manager: %s", err.Error())
+	}
+	backend, err := newFormContractBackend()
+	if err != nil {
+		t.Fatalf("failed to create the backend: %s", err.Error())
+	}
+	defer os.RemoveAll(backend.keyDir)
+	cm.b = backend
+
+	hostKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate the host key: %s", err.Error())
+	}
+	hostNode := enode.NewV4(&hostKey.PublicKey, net.ParseIP("127.0.0.1"), 30303, 30303)
+
+	// the storage host not supporting the deferred funding is rejected
+	if _, err = cm.FormDeferredContract(hostNode.String(), backend.config.MaxDuration); err == nil {
+		t.Fatalf("deferred contract with the host not supporting the deferred funding is expected to be rejected")
+	}
+
+	backend.config.Capabilities = storage.LocalCapabilities()
+	deferred, err := cm.FormDeferredContract(hostNode.String(), backend.config.MaxDuration)
+	if err != nil {
+		t.Fatalf("failed to form the deferred contract: %s", err.Error())
+	}
+	defer rollbackContractSet(cm.activeContracts, deferred.ID)
+
+	expectFunding := backend.config.ContractPrice.Add(backend.config.StoragePrice.MultUint64(storage.SectorSize))
+	if deferred.TotalCost.Cmp(expectFunding) != 0 {
+		t.Errorf("the deferred contract is expected to be funded with %v, instead got %v", expectFunding, deferred.TotalCost)
+	}
+	contract, exists := cm.RetrieveActiveContract(deferred.ID)
+	if !exists {
+		t.Fatalf("the deferred contract is not found in the active contracts")
+	}
+	if contract.Status.UploadAbility || !contract.Status.RenewAbility {
+		t.Errorf("the deferred contract is expected to be good for renew only, instead got %+v", contract.Status)
+	}
+	if stats := cm.checkContractStatus(contract, 0); stats.UploadAbility {
+		t.Errorf("the deferred contract is expected not to be good for upload before activation")
+	}
+
+	// activate the contract
+	funding := common.NewBigInt(1000000)
+	if _, err = cm.ActivateContract(deferred.ID, backend.config.ContractPrice); err == nil {
+		t.Fatalf("funding not enough for the contract price is expected to be rejected")
+	}
+	activated, err := cm.ActivateContract(deferred.ID, funding)
+	if err != nil {
+		t.Fatalf("failed to activate the contract: %s", err.Error())
+	}
+	defer rollbackContractSet(cm.activeContracts, activated.ID)
+
+	if _, exists := cm.RetrieveActiveContract(deferred.ID); exists {
+		t.Errorf("the deferred contract is expected to be replaced after activation")
+	}
+	contract, exists = cm.RetrieveActiveContract(activated.ID)
+	if !exists {
+		t.Fatalf("the activated contract is not found in the active contracts")
+	}
+	if !contract.Status.UploadAbility || !contract.Status.RenewAbility {
+		t.Errorf("the activated contract is expected to be good for upload and renew, instead got %+v", contract.Status)
+	}
+	if contract.TotalCost.Cmp(funding) != 0 || contract.EndHeight != deferred.EndHeight {
+		t.Errorf("the activated contract is expected to be funded with %v till %v, instead got %v till %v",
+			funding, deferred.EndHeight, contract.TotalCost, contract.EndHeight)
+	}
+	if contract.ContractBalance.Cmp(deferred.ContractBalance) <= 0 {
+		t.Errorf("the activated contract balance %v is expected to be larger than the deferred %v", contract.ContractBalance, deferred.ContractBalance)
+	}
+	if cm.isDeferredContract(deferred.ID) || cm.renewedTo[deferred.ID] != activated.ID || cm.hostToContract[hostNode.ID()] != activated.ID {
+		t.Errorf("the contract manager is not updated after activation")
+	}
+
+	// the activated contract cannot be activated again
+	if _, err = cm.ActivateContract(activated.ID, funding); err == nil {
+		t.Errorf("the contract not deferred is expected not to be activated")
+	}
+}
@@ -69,6 +69,9 @@ func (cm *ContractManager) contractMaintenance() {
 		return
 	}
 
+	// cancel the contracts about to expire which are to be replaced with the fresh formations
+	cm.replaceExpiringContracts(cm.hostManager)
+
 	// get the contract renew list
 	closeToExpireRenews, insufficientFundingRenews := cm.checkForContractRenew(rentPayment)
 
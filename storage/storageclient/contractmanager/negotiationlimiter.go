@@ -0,0 +1,113 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"sync"
+)
+
+// negotiationLimiter bounds the number of contract negotiations, including both contract
+// formations and renewals, in progress with the storage hosts at the same time
+type negotiationLimiter struct {
+	// limit is the maximum number of negotiations in progress. 0 means unlimited
+	limit int
+
+	// active is the number of negotiations in progress
+	active int
+
+	// released is closed and replaced when a negotiation slot is released or the limit changes
+	released chan struct{}
+
+	mu sync.Mutex
+}
+
+// newNegotiationLimiter creates a negotiationLimiter with the given limit
+func newNegotiationLimiter(limit int) *negotiationLimiter {
+	return &negotiationLimiter{
+		limit:    limit,
+		released: make(chan struct{}),
+	}
+}
+
+// setLimit set the maximum number of negotiations in progress. The negotiations already in
+// progress are not affected
+func (nl *negotiationLimiter) setLimit(limit int) {
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+	nl.limit = limit
+	nl.notify()
+}
+
+// batchSize returns the number of negotiations to be started in a batch, which is no larger
+// than the limit
+func (nl *negotiationLimiter) batchSize(needed int) int {
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+	if nl.limit != 0 && nl.limit < needed {
+		return nl.limit
+	}
+	return needed
+}
+
+// acquire blocks until a negotiation slot is available. Return false if stopped before
+// the slot is acquired
+func (nl *negotiationLimiter) acquire(stop <-chan struct{}) bool {
+	for {
+		nl.mu.Lock()
+		if nl.limit == 0 || nl.active < nl.limit {
+			nl.active++
+			nl.mu.Unlock()
+			return true
+		}
+		released := nl.released
+		nl.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// release releases a negotiation slot
+func (nl *negotiationLimiter) release() {
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+	if nl.active == 0 {
+		return
+	}
+	nl.active--
+	nl.notify()
+}
+
+// notify wakes up all negotiations waiting for a slot. The caller shall hold the lock
+func (nl *negotiationLimiter) notify() {
+	close(nl.released)
+	nl.released = make(chan struct{})
+}
+
+// run runs the negotiations 0 ~ n-1 concurrently, with each negotiation holding a slot. The
+// negotiations not started before stopped are skipped, with false returned in started
+func (nl *negotiationLimiter) run(n int, stop <-chan struct{}, negotiate func(i int)) (started []bool) {
+	started = make([]bool, n)
+	var wg sync.WaitGroup
+	for i := 0; i != n; i++ {
+		if !nl.acquire(stop) {
+			break
+		}
+		started[i] = true
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				nl.release()
+				wg.Done()
+			}()
+			negotiate(i)
+		}(i)
+	}
+	wg.Wait()
+	return
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestCreateContracts_NegotiationLimit test the contracts are formed concurrently with at most
+// the negotiation limit in progress, and all contracts are formed eventually
+func TestCreateContracts_NegotiationLimit(t *testing.T) {
+	cm, err := createNewContractManager()
+	if err != nil {
+		t.Fatalf("failed to create the contract manager: %s", err.Error())
+	}
+	formBackend, err := newFormContractBackend()
+	if err != nil {
+		t.Fatalf("failed to create the backend: %s", err.Error())
+	}
+	defer os.RemoveAll(formBackend.keyDir)
+	backend := &countingFormContractBackend{formContractBackend: formBackend}
+	cm.b = backend
+
+	limit, numHosts := 3, 12
+	cm.SetMaxConcurrentNegotiations(uint64(limit))
+	var hosts []storage.HostInfo
+	for i := 0; i != numHosts; i++ {
+		hostKey, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatalf("failed to generate the host key: %s", err.Error())
+		}
+		hostNode := enode.NewV4(&hostKey.PublicKey, net.ParseIP("127.0.0.1"), 30303, 30303)
+		host, err := hostInfoFromEnodeURL(hostNode.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		host.HostExtConfig = formBackend.config
+		hosts = append(hosts, host)
+	}
+
+	results := cm.createContracts(hosts, common.NewBigInt(1000000), formBackend.config.MaxDuration, testRentPayment)
+	for i, result := range results {
+		if result.err != nil {
+			t.Errorf("failed to form the contract with host %v: %v", i, result.err)
+			continue
+		}
+		defer rollbackContractSet(cm.activeContracts, result.contract.ID)
+		if result.contract.EnodeID != hosts[i].EnodeID {
+			t.Errorf("result %v: expect contract with host %v, got %v", i, hosts[i].EnodeID, result.contract.EnodeID)
+		}
+	}
+	if maxActive := atomic.LoadInt32(&backend.maxActive); maxActive > int32(limit) || maxActive == 0 {
+		t.Errorf("expect at most %v negotiations in progress, got %v", limit, maxActive)
+	}
+	if active := atomic.LoadInt32(&backend.active); active != 0 {
+		t.Errorf("%v negotiations still in progress", active)
+	}
+}
+
+// TestNegotiationLimiter_Stop test the negotiations waiting for a slot are skipped after stopped
+func TestNegotiationLimiter_Stop(t *testing.T) {
+	nl := newNegotiationLimiter(1)
+	if !nl.acquire(nil) {
+		t.Fatal("failed to acquire the slot")
+	}
+	stop := make(chan struct{})
+	close(stop)
+	started := nl.run(2, stop, func(i int) {
+		t.Errorf("negotiation %v started without a slot", i)
+	})
+	if started[0] || started[1] {
+		t.Errorf("negotiations started after stopped: %v", started)
+	}
+
+	// the negotiations start after the limit is lifted
+	nl.setLimit(0)
+	var numRun int32
+	started = nl.run(2, nil, func(i int) {
+		atomic.AddInt32(&numRun, 1)
+	})
+	if !started[0] || !started[1] || numRun != 2 {
+		t.Errorf("negotiations not started after the limit is lifted: %v", started)
+	}
+	if size := nl.batchSize(10); size != 10 {
+		t.Errorf("unlimited batch size: expect 10, got %v", size)
+	}
+}
+
+// countingFormContractBackend counts the contract negotiations in progress
+type countingFormContractBackend struct {
+	*formContractBackend
+
+	active    int32
+	maxActive int32
+}
+
+func (b *countingFormContractBackend) SetupConnection(enodeURL string) (storage.Peer, error) {
+	peer, err := b.formContractBackend.SetupConnection(enodeURL)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFormContractPeer{formContractPeer: peer.(*formContractPeer), backend: b}, nil
+}
+
+// countingFormContractPeer counts a negotiation in progress from the contract creation request
+// till the commit success message
+type countingFormContractPeer struct {
+	*formContractPeer
+
+	backend *countingFormContractBackend
+}
+
+func (p *countingFormContractPeer) RequestContractCreation(req storage.ContractCreateRequest) error {
+	active := atomic.AddInt32(&p.backend.active, 1)
+	for {
+		maxActive := atomic.LoadInt32(&p.backend.maxActive)
+		if active <= maxActive || atomic.CompareAndSwapInt32(&p.backend.maxActive, maxActive, active) {
+			break
+		}
+	}
+	// hold the negotiation for a while so that the negotiations overlap
+	time.Sleep(20 * time.Millisecond)
+	return p.formContractPeer.RequestContractCreation(req)
+}
+
+func (p *countingFormContractPeer) SendClientCommitSuccessMsg() error {
+	atomic.AddInt32(&p.backend.active, -1)
+	return p.formContractPeer.SendClientCommitSuccessMsg()
+}
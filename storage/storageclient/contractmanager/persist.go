@@ -23,6 +23,7 @@ type persistence struct {
 	ExpiredContracts []storage.ContractMetaData    `json:"expiredcontracts"`
 	RenewedFrom      map[string]storage.ContractID `json:"renewedfrom"`
 	RenewedTo        map[string]storage.ContractID `json:"renewedto"`
+	Deferred         map[string]string             `json:"deferredcontracts"`
 }
 
 func (cm *ContractManager) persistUpdate() (persist persistence) {
@@ -32,6 +33,7 @@ func (cm *ContractManager) persistUpdate() (persist persistence) {
 		CurrentPeriod: cm.currentPeriod,
 		RenewedFrom:   make(map[string]storage.ContractID),
 		RenewedTo:     make(map[string]storage.ContractID),
+		Deferred:      make(map[string]string),
 	}
 
 	// update the renewedFrom
@@ -44,6 +46,11 @@ func (cm *ContractManager) persistUpdate() (persist persistence) {
 		persist.RenewedTo[key.String()] = value
 	}
 
+	// update the deferred contracts
+	for key, value := range cm.deferredContracts {
+		persist.Deferred[key.String()] = value
+	}
+
 	// update the expiredContracts
 	for _, ec := range cm.expiredContracts {
 		persist.ExpiredContracts = append(persist.ExpiredContracts, ec)
@@ -108,6 +115,16 @@ func (cm *ContractManager) loadSettings() (err error) {
 		cm.renewedTo[id] = value
 	}
 
+	// update the deferred contracts
+	for key, value := range data.Deferred {
+		id, err := storage.StringToContractID(key)
+		if err != nil {
+			cm.log.Warn("contractmanager loadsettings deferred contracts", "err", err.Error())
+			continue
+		}
+		cm.deferredContracts[id] = value
+	}
+
 	// update expired contract list and hostToContract mapping
 	for _, ec := range data.ExpiredContracts {
 		cm.expiredContracts[ec.ID] = ec
@@ -0,0 +1,126 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+const (
+	// ContractRenewPolicyCheapest renews the contract about to expire or replaces it with a fresh
+	// formation, whichever is estimated cheaper with the gas price currently suggested. Only the
+	// transaction fees and the upload bandwidth of the data stored are estimated, so the fresh
+	// formation is chosen only when the gas price is far higher than the upload price
+	ContractRenewPolicyCheapest = "cheapest"
+
+	// ContractRenewPolicyRenew always renews the contract about to expire, which carries the
+	// data stored over to the renewed contract. It is the default policy
+	ContractRenewPolicyRenew = "renew"
+
+	// ContractRenewPolicyForm always replaces the contract about to expire with a fresh
+	// formation, after which the data stored is uploaded again
+	ContractRenewPolicyForm = "form"
+)
+
+// CheckContractRenewPolicy checks whether the contract renew policy is supported
+func CheckContractRenewPolicy(policy string) error {
+	switch policy {
+	case ContractRenewPolicyCheapest, ContractRenewPolicyRenew, ContractRenewPolicyForm:
+		return nil
+	default:
+		return fmt.Errorf("unknown contract renew policy %v, expect %v, %v or %v", policy,
+			ContractRenewPolicyCheapest, ContractRenewPolicyRenew, ContractRenewPolicyForm)
+	}
+}
+
+// SetContractRenewPolicy will set the policy deciding whether the contract about to expire is
+// renewed or replaced with a fresh formation
+func (cm *ContractManager) SetContractRenewPolicy(policy string) error {
+	if err := CheckContractRenewPolicy(policy); err != nil {
+		return err
+	}
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	cm.renewPolicy = policy
+	return nil
+}
+
+// renewFormCosts estimates the costs of renewing the contract and of replacing it with a fresh
+// formation. The renewal carries the data stored over, while the fresh formation needs the data
+// uploaded again at the upload price. The contract price and the storage cost of the data for
+// the next period are paid either way, and are not included
+func renewFormCosts(contract storage.ContractMetaData, gasPrice, uploadPrice common.BigInt) (renewCost, formCost common.BigInt) {
+	dataStored := contract.LatestContractRevision.NewFileSize
+	renewCost = gasPrice.MultUint64(contractRenewTxGas)
+	formCost = gasPrice.MultUint64(contractFormTxGas).Add(uploadPrice.MultUint64(dataStored))
+	return
+}
+
+// shouldRenewExpiring decides whether the contract about to expire is renewed under the policy.
+// The cheapest policy renews the contract if the renewal costs no more than the fresh formation
+func shouldRenewExpiring(policy string, contract storage.ContractMetaData, gasPrice, uploadPrice common.BigInt) bool {
+	switch policy {
+	case ContractRenewPolicyForm:
+		return false
+	case ContractRenewPolicyCheapest:
+		renewCost, formCost := renewFormCosts(contract, gasPrice, uploadPrice)
+		return renewCost.Cmp(formCost) <= 0
+	default:
+		return true
+	}
+}
+
+// replaceExpiringContracts cancels the contracts about to expire which the contract renew policy
+// decides to replace with a fresh formation. The canceled contracts are neither renewed nor used
+// for uploading, so that new contracts are formed in the maintenance, and the data stored is
+// uploaded again by the repair. The upload price of the market is used to estimate the cost of
+// uploading the data again
+func (cm *ContractManager) replaceExpiringContracts(market hostMarket) {
+	cm.lock.RLock()
+	policy := cm.renewPolicy
+	blockHeight := cm.blockHeight
+	cm.lock.RUnlock()
+
+	if policy == ContractRenewPolicyRenew {
+		return
+	}
+
+	// the contracts are renewed if the gas price is not available to compare the costs
+	gasPrice := common.BigInt0
+	if policy == ContractRenewPolicyCheapest {
+		price, err := cm.b.SuggestPrice(context.Background())
+		if err != nil {
+			cm.log.Warn("failed to get the suggested gas price, renew the contracts about to expire", "err", err.Error())
+			return
+		}
+		if price != nil {
+			gasPrice = common.PtrBigInt(price)
+		}
+	}
+	uploadPrice := market.GetMarketPrice().UploadPrice
+
+	lapsing := cm.lapsingHosts()
+	for _, contract := range cm.activeContracts.RetrieveAllContractsMetaData() {
+		// the contract not to be renewed anyway is left as is
+		if _, skip := lapsing[contract.EnodeID]; skip || !contract.Status.RenewAbility || cm.isDeferredContract(contract.ID) {
+			continue
+		}
+		if blockHeight+storage.RenewWindow < contract.EndHeight {
+			continue
+		}
+		if shouldRenewExpiring(policy, contract, gasPrice, uploadPrice) {
+			continue
+		}
+
+		cm.log.Info("replace the contract about to expire with a fresh formation", "contractID", contract.ID, "policy", policy)
+		if err := cm.markContractCancel(contract.ID); err != nil {
+			cm.log.Error("failed to mark the contract to be replaced as canceled", "contractID", contract.ID, "err", err.Error())
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package contractmanager
+
+import (
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestShouldRenewExpiring test the decision between renewing the contract and forming a new one
+// under each policy, with the data stored taken into account by the cheapest policy
+func TestShouldRenewExpiring(t *testing.T) {
+	var empty, stored storage.ContractMetaData
+	stored.LatestContractRevision.NewFileSize = 10 * storage.SectorSize
+	uploadPrice := common.NewBigInt(1)
+
+	tests := []struct {
+		policy   string
+		contract storage.ContractMetaData
+		gasPrice common.BigInt
+		renew    bool
+	}{
+		{ContractRenewPolicyRenew, stored, common.NewBigInt(1e9), true},
+		{ContractRenewPolicyForm, stored, common.BigInt0, false},
+		{ContractRenewPolicyCheapest, stored, common.NewBigInt(1), true},
+		{ContractRenewPolicyCheapest, stored, common.NewBigInt(1e9), false},
+		{ContractRenewPolicyCheapest, empty, common.NewBigInt(1), false},
+		{ContractRenewPolicyCheapest, empty, common.BigInt0, true},
+	}
+	for i, test := range tests {
+		renew := shouldRenewExpiring(test.policy, test.contract, test.gasPrice, uploadPrice)
+		if renew != test.renew {
+			t.Errorf("test %d: policy %v with gas price %v expect renew %v, got %v", i, test.policy, test.gasPrice, test.renew, renew)
+		}
+	}
+}
+
+// TestContractManager_ReplaceExpiringContracts test the contract about to expire with the data
+// stored is renewed or canceled to be replaced with a fresh formation, as decided by the policy
+func TestContractManager_ReplaceExpiringContracts(t *testing.T) {
+	cm, err := createNewContractManager()
+	if err != nil {
+		t.Fatalf("failed to create contract manager: %s", err.Error())
+	}
+
+	defer os.RemoveAll("test")
+	defer cm.activeContracts.Close()
+	defer cm.activeContracts.EmptyDB()
+
+	backend := &gasPriceBackend{}
+	cm.b = backend
+	market := &fakeHostMarket{
+		storage.MarketPrice{
+			UploadPrice: common.NewBigInt(1),
+		},
+	}
+
+	tests := []struct {
+		policy   string
+		gasPrice int64
+		renew    bool
+	}{
+		{ContractRenewPolicyRenew, 1e9, true},
+		{ContractRenewPolicyForm, 1, false},
+		{ContractRenewPolicyCheapest, 1, true},
+		{ContractRenewPolicyCheapest, 1e9, false},
+	}
+	for _, test := range tests {
+		contract, err := insertStoredExpiringContract(cm, 10)
+		if err != nil {
+			t.Fatalf("failed to insert contract: %s", err.Error())
+		}
+		if err = cm.SetContractRenewPolicy(test.policy); err != nil {
+			t.Fatal(err)
+		}
+		backend.gasPrice = big.NewInt(test.gasPrice)
+
+		cm.replaceExpiringContracts(market)
+
+		meta, _ := cm.activeContracts.RetrieveContractMetaData(contract.ID)
+		closeToExpireRenews, _ := cm.checkForContractRenew(testRentPayment)
+		renewed := renewRecordsContain(closeToExpireRenews, contract.ID)
+		if test.renew {
+			if !renewed || meta.Status.Canceled {
+				t.Errorf("policy %v with gas price %v: the contract is expected to be renewed", test.policy, test.gasPrice)
+			}
+			continue
+		}
+		if renewed || !meta.Status.Canceled || meta.Status.UploadAbility {
+			t.Errorf("policy %v with gas price %v: the contract is expected to be canceled for a fresh formation", test.policy, test.gasPrice)
+		}
+	}
+
+	if err = cm.SetContractRenewPolicy("unknown"); err == nil {
+		t.Errorf("the unknown contract renew policy is expected to be rejected")
+	}
+}
+
+// insertStoredExpiringContract inserts a contract about to expire, with the number of sectors
+// stored, for the host with high evaluation
+func insertStoredExpiringContract(cm *ContractManager, numSectors int) (meta storage.ContractMetaData, err error) {
+	enodeID := randomEnodeIDGenerator()
+	if err = insertHostHighEval(cm, enodeID); err != nil {
+		return
+	}
+	contract := randomContractWithEnodeID(enodeID)
+	contract.LatestContractRevision.NewFileSize = uint64(numSectors) * storage.SectorSize
+	return cm.activeContracts.InsertContract(contract, randomRootsGenerator(numSectors))
+}
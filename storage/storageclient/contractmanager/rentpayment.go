@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/unit"
 	"github.com/DxChainNetwork/godx/storage"
 )
@@ -32,9 +33,15 @@ func (cm *ContractManager) SetRentPayment(rent storage.RentPayment, market hostM
 		return errors.New("setRentPayment can only be done once the block chain finished syncing")
 	}
 
-	// Calculate the expected sizes in rent payment.
+	// Calculate the expected sizes in rent payment. The fees of forming the contracts are
+	// not available for the storage
 	prices := market.GetMarketPrice()
-	rent = estimateRentPaymentSizes(rent, prices)
+	fees, err := cm.estimateContractFees(rent.StorageHosts, market)
+	if err != nil {
+		cm.log.Warn("failed to estimate the contract fees", "err", err)
+		err = nil
+	}
+	rent = estimateRentPaymentSizes(rent, prices, fees.TotalFee())
 
 	// validate the rentPayment, making sure that fields are not empty
 	if err = RentPaymentValidation(rent); err != nil {
@@ -126,14 +133,18 @@ func RentPaymentValidation(rent storage.RentPayment) (err error) {
 }
 
 // estimateRentPaymentSizes estimate the sizes in rent payment based on fund settings and the
-// input market price. Currently, the contract fund are split among the storage fund, upload
-// fund and download fund. The sizes follows the ratio defined in defaults.go
-func estimateRentPaymentSizes(rent storage.RentPayment, prices storage.MarketPrice) storage.RentPayment {
+// input market price. Currently, the contract fund excluding the fees are split among the storage
+// fund, upload fund and download fund. The sizes follows the ratio defined in defaults.go
+func estimateRentPaymentSizes(rent storage.RentPayment, prices storage.MarketPrice, fees common.BigInt) storage.RentPayment {
 	// Estimate the redundancy
 	redundancy := float64(defaultNumSectors) / float64(defaultMinSectors)
 
 	// Estimate the sizes
-	fundPerContract := rent.Fund.DivUint64(rent.StorageHosts)
+	fund := common.BigInt0
+	if rent.Fund.Cmp(fees) > 0 {
+		fund = rent.Fund.Sub(fees)
+	}
+	fundPerContract := fund.DivUint64(rent.StorageHosts)
 	storageRatio := prices.StoragePrice.MultFloat64(redundancy).MultUint64(rent.Period).MultFloat64(storageSizeRatio)
 	downloadRatio := prices.DownloadPrice.MultFloat64(uploadSizeRatio)
 	uploadRatio := prices.UploadPrice.MultFloat64(downloadSizeRatio)
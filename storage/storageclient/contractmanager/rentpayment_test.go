@@ -132,7 +132,7 @@ func TestEstimateRentPaymentSizes(t *testing.T) {
 		Fund:         common.NewBigInt(100000000000000),
 		StorageHosts: 5,
 	}
-	res := estimateRentPaymentSizes(rent, prices)
+	res := estimateRentPaymentSizes(rent, prices, common.BigInt0)
 	// Check the results
 	expectedRedundancy := float64(defaultNumSectors) / float64(defaultMinSectors)
 	if res.ExpectedRedundancy != expectedRedundancy {
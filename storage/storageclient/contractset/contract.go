@@ -15,13 +15,19 @@ import (
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/writeaheadlog"
 	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
 	"github.com/DxChainNetwork/godx/storage"
 )
 
+// ErrFileMerkleRootMismatch is returned if the file merkle root reconstructed from the sectors
+// uploaded does not match with the one in the latest contract revision
+var ErrFileMerkleRootMismatch = errors.New("file merkle root does not match with the contract")
+
 // Contract is a data structure that stored the contract information
 type Contract struct {
 	headerLock    sync.Mutex
 	header        ContractHeader
+	historyLimit  uint64
 	merkleRoots   *merkleRoots
 	unappliedTxns []*writeaheadlog.Transaction
 
@@ -73,6 +79,7 @@ func (c *Contract) CommitRevision(signedRevision types.StorageContractRevision,
 
 	// update the contract
 	contractHeader.LatestContractRevision = signedRevision
+	contractHeader.recordRevision(signedRevision, c.revisionHistoryLimit())
 
 	paramLen := len(costs)
 	if paramLen == 2 {
@@ -137,6 +144,7 @@ func (c *Contract) CommitUpload(t *writeaheadlog.Transaction, signedRev types.St
 
 	// update the contract
 	contractHeader.LatestContractRevision = signedRev
+	contractHeader.recordRevision(signedRev, c.revisionHistoryLimit())
 	contractHeader.StorageCost = contractHeader.StorageCost.Add(storageCost)
 	contractHeader.UploadCost = contractHeader.UploadCost.Add(bandwidthCost)
 
@@ -177,6 +185,7 @@ func (c *Contract) CommitDownload(t *writeaheadlog.Transaction, signedRev types.
 
 	// update the contract
 	contractHeader.LatestContractRevision = signedRev
+	contractHeader.recordRevision(signedRev, c.revisionHistoryLimit())
 	contractHeader.DownloadCost = contractHeader.DownloadCost.Add(bandwidth)
 
 	if err = c.contractHeaderUpdate(contractHeader); err != nil {
@@ -388,7 +397,144 @@ func (c *Contract) Header() ContractHeader {
 	return c.header
 }
 
+// RevisionHistory will return the revisions recorded of the contract, the oldest first
+func (c *Contract) RevisionHistory() []RevisionRecord {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	return append([]RevisionRecord{}, c.header.RevisionHistory...)
+}
+
+// revisionHistoryLimit returns the max number of revisions recorded in the history
+func (c *Contract) revisionHistoryLimit() uint64 {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	return c.historyLimit
+}
+
+// setRevisionHistoryLimit sets the max number of revisions recorded in the history
+func (c *Contract) setRevisionHistoryLimit(limit uint64) {
+	c.headerLock.Lock()
+	defer c.headerLock.Unlock()
+	c.historyLimit = limit
+}
+
+// CommitUploadedRoots records the merkle roots of the sectors appended by the upload committed,
+// and verifies the file merkle root reconstructed afterwards. The roots are recorded only if the
+// roots of all sectors uploaded before are recorded, otherwise the file merkle root cannot be
+// reconstructed and the verification is skipped.
+//
+// NOTE: the contract should be acquired from the contract set
+func (c *Contract) CommitUploadedRoots(roots ...common.Hash) (err error) {
+	contractHeader := c.Header()
+	numSectors := contractHeader.LatestContractRevision.NewFileSize / SectorSize
+	if numSectors < uint64(len(roots)) || uint64(c.merkleRoots.len()) != numSectors-uint64(len(roots)) {
+		log.Debug("merkle roots of the contract not fully recorded, skip the verification", "contractID", contractHeader.ID,
+			"recorded", c.merkleRoots.len(), "sectors", numSectors)
+		return nil
+	}
+
+	for _, root := range roots {
+		if err = c.merkleRoots.push(root); err != nil {
+			return
+		}
+	}
+	return c.VerifyFileMerkleRoot()
+}
+
+// CommitDeletedRoots removes the merkle roots of the sectors deleted by the revision committed,
+// and verifies the file merkle root reconstructed afterwards. The roots are removed only if the
+// roots of all sectors before the delete are recorded, otherwise the verification is skipped.
+//
+// NOTE: the contract should be acquired from the contract set
+func (c *Contract) CommitDeletedRoots(roots ...common.Hash) (err error) {
+	contractHeader := c.Header()
+	numSectors := contractHeader.LatestContractRevision.NewFileSize / SectorSize
+	if uint64(c.merkleRoots.len()) != numSectors+uint64(len(roots)) {
+		log.Debug("merkle roots of the contract not fully recorded, skip the verification", "contractID", contractHeader.ID,
+			"recorded", c.merkleRoots.len(), "sectors", numSectors)
+		return nil
+	}
+
+	newRoots, err := c.rootsAfterDelete(roots)
+	if err != nil {
+		return
+	}
+	if err = c.merkleRoots.replace(newRoots); err != nil {
+		return
+	}
+	return c.VerifyFileMerkleRoot()
+}
+
+// DeletedMerkleRootPreview returns the file merkle root after the sectors are deleted, which
+// requires the roots of all sectors of the contract recorded. The sectors moved by the delete
+// are not covered by the diff proof of the host, so the new file merkle root is verified against
+// the preview instead.
+// Note: this is only a preview, the roots recorded are not modified
+//
+// NOTE: the contract should be acquired from the contract set
+func (c *Contract) DeletedMerkleRootPreview(roots ...common.Hash) (mroot common.Hash, err error) {
+	contractHeader := c.Header()
+	if numSectors := contractHeader.LatestContractRevision.NewFileSize / SectorSize; uint64(c.merkleRoots.len()) != numSectors {
+		return common.Hash{}, fmt.Errorf("%v merkle roots recorded for %v sectors in the contract", c.merkleRoots.len(), numSectors)
+	}
+
+	newRoots, err := c.rootsAfterDelete(roots)
+	if err != nil {
+		return
+	}
+	ct := merkle.NewSha256CachedTree(sectorHeight)
+	for _, root := range newRoots {
+		ct.Push(root)
+	}
+	return ct.Root(), nil
+}
+
+// rootsAfterDelete returns the merkle roots recorded after the sectors are deleted, in the same
+// way as the host moves the last sector to the position of the sector deleted
+func (c *Contract) rootsAfterDelete(roots []common.Hash) (newRoots []common.Hash, err error) {
+	if newRoots, err = c.merkleRoots.roots(); err != nil {
+		return
+	}
+	for _, root := range roots {
+		var found bool
+		if newRoots, found = storage.RemoveSectorRoot(newRoots, root); !found {
+			return nil, fmt.Errorf("deleted sector %v is not recorded in the contract", root)
+		}
+	}
+	return
+}
+
+// VerifyFileMerkleRoot reconstructs the file merkle root from the merkle roots of the sectors
+// recorded, in the same way as the host builds the storage proof, and checks it against the
+// file merkle root in the latest contract revision
+func (c *Contract) VerifyFileMerkleRoot() (err error) {
+	contractHeader := c.Header()
+	rev := contractHeader.LatestContractRevision
+	if numSectors := rev.NewFileSize / SectorSize; uint64(c.merkleRoots.len()) != numSectors {
+		return fmt.Errorf("%v merkle roots recorded for %v sectors in the contract", c.merkleRoots.len(), numSectors)
+	}
+
+	root, err := c.merkleRoots.fileMerkleRoot()
+	if err != nil {
+		return
+	}
+	if root != rev.NewFileMerkleRoot {
+		log.Error("the file merkle root reconstructed does not match with the contract", "contractID", contractHeader.ID,
+			"revision", rev.NewRevisionNumber, "expected", rev.NewFileMerkleRoot, "got", root)
+		return ErrFileMerkleRootMismatch
+	}
+	return nil
+}
+
 // MerkleRoots will return the merkle roots information of the contract
 func (c *Contract) MerkleRoots() ([]common.Hash, error) {
 	return c.merkleRoots.roots()
 }
+
+// HasMerkleRoot returns whether the sector with the merkle root is recorded in the contract.
+// The sectors uploaded before the roots are recorded are not reported
+//
+// NOTE: the contract should be acquired from the contract set
+func (c *Contract) HasMerkleRoot(root common.Hash) bool {
+	return c.merkleRoots.has(root)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/writeaheadlog"
 	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
 	"github.com/DxChainNetwork/godx/storage"
 )
 
@@ -212,6 +213,102 @@ func TestContract_CommitUploadAndRollback(t *testing.T) {
 	}
 }
 
+func TestContract_RevisionHistory(t *testing.T) {
+	contract, err := newContract()
+	if err != nil {
+		t.Fatalf("failed to generate new contract: %s", err.Error())
+	}
+
+	defer contract.db.Close()
+	defer contract.db.EmptyDB()
+
+	limit := 3
+	contract.setRevisionHistoryLimit(uint64(limit))
+
+	var revisions []types.StorageContractRevision
+	for i := 1; i <= 5; i++ {
+		rev := storageContractRevisionGenerator()
+		rev.NewRevisionNumber = uint64(i)
+		rev.NewValidProofOutputs[0].Value = big.NewInt(int64(100 - i))
+		if err := contract.CommitRevision(rev, common.RandomBigInt(), common.RandomBigInt()); err != nil {
+			t.Fatalf("failed to commit revision %v: %s", i, err.Error())
+		}
+		revisions = append(revisions, rev)
+	}
+
+	// the stale revision shall not be recorded
+	if err := contract.CommitRevision(revisions[1]); err != nil {
+		t.Fatalf("failed to commit revision: %s", err.Error())
+	}
+
+	history := contract.RevisionHistory()
+	if len(history) != limit {
+		t.Fatalf("expected %v records, got %v", limit, len(history))
+	}
+	for i, record := range history {
+		expected := revisions[len(revisions)-limit+i]
+		if record.RevisionNumber != expected.NewRevisionNumber {
+			t.Errorf("record %v: expected revision number %v, got %v", i, expected.NewRevisionNumber, record.RevisionNumber)
+		}
+		if record.ValidProofOutputs[0].Value.Cmp(expected.NewValidProofOutputs[0].Value) != 0 {
+			t.Errorf("record %v: expected valid proof output %v, got %v", i, expected.NewValidProofOutputs[0].Value, record.ValidProofOutputs[0].Value)
+		}
+	}
+
+	// the history is persisted along with the contract header
+	header, err := contract.db.FetchContractHeader(contract.header.ID)
+	if err != nil {
+		t.Fatalf("failed to fetch the contract header: %s", err.Error())
+	}
+	if !reflect.DeepEqual(revisionNumbers(header.RevisionHistory), revisionNumbers(history)) {
+		t.Errorf("persisted history %v does not match %v", revisionNumbers(header.RevisionHistory), revisionNumbers(history))
+	}
+}
+
+func TestContract_VerifyFileMerkleRoot(t *testing.T) {
+	contract, err := newContract()
+	if err != nil {
+		t.Fatalf("failed to generate new contract: %s", err.Error())
+	}
+
+	defer contract.db.Close()
+	defer contract.db.EmptyDB()
+
+	// the file merkle root in the contract is built from the leaves of the file data,
+	// which is how the host builds the storage proof
+	data := make([]byte, 2*SectorSize)
+	rand.Read(data)
+	roots := []common.Hash{
+		merkle.Sha256MerkleTreeRoot(data[:SectorSize]),
+		merkle.Sha256MerkleTreeRoot(data[SectorSize:]),
+	}
+	rev := storageContractRevisionGenerator()
+	rev.NewRevisionNumber = 1
+	rev.NewFileSize = 2 * SectorSize
+	rev.NewFileMerkleRoot = merkle.Sha256MerkleTreeRoot(data)
+	if err := contract.CommitRevision(rev, common.RandomBigInt(), common.RandomBigInt()); err != nil {
+		t.Fatalf("failed to commit revision: %s", err.Error())
+	}
+	if err := contract.CommitUploadedRoots(roots...); err != nil {
+		t.Fatalf("failed to verify the file merkle root: %s", err.Error())
+	}
+
+	// the revision with a mismatched file merkle root shall be detected
+	rev = storageContractRevisionGenerator()
+	rev.NewRevisionNumber = 2
+	rev.NewFileSize = 3 * SectorSize
+	rev.NewFileMerkleRoot = randomRootGenerator()
+	if err := contract.CommitRevision(rev, common.RandomBigInt(), common.RandomBigInt()); err != nil {
+		t.Fatalf("failed to commit revision: %s", err.Error())
+	}
+	if err := contract.CommitUploadedRoots(randomRootGenerator()); err != ErrFileMerkleRootMismatch {
+		t.Fatalf("expected error %v, got %v", ErrFileMerkleRootMismatch, err)
+	}
+	if err := contract.VerifyFileMerkleRoot(); err != ErrFileMerkleRootMismatch {
+		t.Fatalf("expected error %v, got %v", ErrFileMerkleRootMismatch, err)
+	}
+}
+
 /*
  _____  _____  _______      __  _______ ______      ______ _    _ _   _  _____ _______ _____ ____  _   _
 |  __ \|  __ \|_   _\ \    / /\|__   __|  ____|    |  ____| |  | | \ | |/ ____|__   __|_   _/ __ \| \ | |
@@ -292,6 +389,13 @@ func storageContractRevisionGenerator() types.StorageContractRevision {
 	}
 }
 
+func revisionNumbers(history []RevisionRecord) (numbers []uint64) {
+	for _, record := range history {
+		numbers = append(numbers, record.RevisionNumber)
+	}
+	return
+}
+
 func contractStatusGenerator(upload, renew, canceled bool) (cs storage.ContractStatus) {
 	return storage.ContractStatus{
 		UploadAbility: upload,
@@ -6,6 +6,7 @@ package contractset
 
 import (
 	"errors"
+	"time"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/core/types"
@@ -40,6 +41,42 @@ type ContractHeader struct {
 	// status specifies if the contract is good for file uploading or renewing.
 	// it also specifies if the contract is canceled
 	Status storage.ContractStatus
+
+	// RevisionHistory is the bounded history of the revisions committed, the oldest first
+	RevisionHistory []RevisionRecord
+}
+
+// RevisionRecord is the record of a committed contract revision, used for auditing the
+// payout changes of the contract
+type RevisionRecord struct {
+	RevisionNumber     uint64
+	ValidProofOutputs  []types.DxcoinCharge
+	MissedProofOutputs []types.DxcoinCharge
+	Timestamp          time.Time
+}
+
+// recordRevision appends the revision to the revision history, keeping at most limit records.
+// The revision not newer than the last record is ignored. Zero limit disables the history
+func (ch *ContractHeader) recordRevision(rev types.StorageContractRevision, limit uint64) {
+	if limit == 0 {
+		ch.RevisionHistory = nil
+		return
+	}
+	history := ch.RevisionHistory
+	if len(history) > 0 && history[len(history)-1].RevisionNumber >= rev.NewRevisionNumber {
+		return
+	}
+	record := RevisionRecord{
+		RevisionNumber:     rev.NewRevisionNumber,
+		ValidProofOutputs:  append([]types.DxcoinCharge{}, rev.NewValidProofOutputs...),
+		MissedProofOutputs: append([]types.DxcoinCharge{}, rev.NewMissedProofOutputs...),
+		Timestamp:          time.Now(),
+	}
+	// copy the history, so that the header before the update is not affected
+	if uint64(len(history)) >= limit {
+		history = history[uint64(len(history))-limit+1:]
+	}
+	ch.RevisionHistory = append(append(make([]RevisionRecord, 0, len(history)+1), history...), record)
 }
 
 func (ch *ContractHeader) validation() (err error) {
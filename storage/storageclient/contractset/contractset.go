@@ -27,6 +27,9 @@ type StorageContractSet struct {
 	lock             sync.Mutex
 	rl               *RateLimit
 	wal              *writeaheadlog.Wal
+
+	// historyLimit is the max number of revisions recorded for each contract
+	historyLimit uint64
 }
 
 // New will initialize the StorageContractSet object, as well as
@@ -122,6 +125,7 @@ func (scs *StorageContractSet) InsertContract(ch ContractHeader, roots []common.
 	// save the contract into the contract set
 	scs.lock.Lock()
 	defer scs.lock.Unlock()
+	c.historyLimit = scs.historyLimit
 	scs.contracts[c.header.ID] = c
 	scs.hostToContractID[c.header.EnodeID] = c.header.ID
 
@@ -205,6 +209,30 @@ func (scs *StorageContractSet) RetrieveRateLimit() (readBPS, writeBPS int64, pac
 	return scs.rl.RetrieveRateLimit()
 }
 
+// SetRevisionHistoryLimit will set the max number of revisions recorded for each contract.
+// Zero limit disables the revision history
+func (scs *StorageContractSet) SetRevisionHistoryLimit(limit uint64) {
+	scs.lock.Lock()
+	defer scs.lock.Unlock()
+	scs.historyLimit = limit
+	for _, contract := range scs.contracts {
+		contract.setRevisionHistoryLimit(limit)
+	}
+}
+
+// ContractRevisionHistory will return the revisions recorded of the contract, the oldest first
+func (scs *StorageContractSet) ContractRevisionHistory(id storage.ContractID) (history []RevisionRecord, exist bool) {
+	scs.lock.Lock()
+	defer scs.lock.Unlock()
+
+	contract, exist := scs.contracts[id]
+	if !exist {
+		return
+	}
+	history = contract.RevisionHistory()
+	return
+}
+
 // RetrieveContractMetaData will return ContractMetaData based on the contract id provided
 func (scs *StorageContractSet) RetrieveContractMetaData(id storage.ContractID) (cm storage.ContractMetaData, exist bool) {
 	scs.lock.Lock()
@@ -266,10 +294,11 @@ func (scs *StorageContractSet) loadContract(walTxns []*writeaheadlog.Transaction
 
 		// initialize contract
 		c := &Contract{
-			header:      ch,
-			merkleRoots: mr,
-			db:          scs.db,
-			wal:         scs.wal,
+			header:       ch,
+			merkleRoots:  mr,
+			db:           scs.db,
+			wal:          scs.wal,
+			historyLimit: scs.historyLimit,
 		}
 
 		// update contract set
@@ -17,6 +17,7 @@ type merkleRoots struct {
 	cachedSubTrees []*cachedSubTree
 	uncachedRoots  []common.Hash
 	numMerkleRoots int
+	rootSet        map[common.Hash]struct{}
 	db             *DB
 	id             storage.ContractID
 }
@@ -89,11 +90,33 @@ func (mr *merkleRoots) push(root common.Hash) (err error) {
 	return
 }
 
+// replace will replace all roots stored with the roots passed in, both in
+// the database and in the memory. It is used when the sectors are deleted,
+// which changes the roots in the middle of the list
+func (mr *merkleRoots) replace(roots []common.Hash) (err error) {
+	if err = mr.db.StoreMerkleRoots(mr.id, roots); err != nil {
+		return
+	}
+
+	// rebuild the roots in the memory
+	mr.cachedSubTrees, mr.uncachedRoots, mr.rootSet = nil, nil, nil
+	if err = mr.appendRootMemory(roots...); err != nil {
+		return
+	}
+	mr.numMerkleRoots = len(roots)
+
+	return
+}
+
 // appendRootMemory will store the root in the uncached roots field
 // if the number of uncached roots reached a limit, then those
 // roots will be build up to a cachedSubTree
 func (mr *merkleRoots) appendRootMemory(roots ...common.Hash) error {
+	if mr.rootSet == nil {
+		mr.rootSet = make(map[common.Hash]struct{})
+	}
 	for _, root := range roots {
+		mr.rootSet[root] = struct{}{}
 		mr.uncachedRoots = append(mr.uncachedRoots, root)
 		if len(mr.uncachedRoots) == merkleRootsPerCache {
 			cachedTree, err := newCachedSubTree(mr.uncachedRoots)
@@ -112,8 +135,31 @@ func (mr *merkleRoots) appendRootMemory(roots ...common.Hash) error {
 // newMerkleRootPreview will display the new merkle root when a newRoot is passed in.
 // Note: this is only a preview, root will not be saved into the memory nor db
 func (mr *merkleRoots) newMerkleRootPreview(newRoot common.Hash) (mroot common.Hash, err error) {
+	ct, err := mr.cachedTree()
+	if err != nil {
+		return
+	}
+
+	// push the newRoot and calculate the merkle root
+	ct.Push(newRoot)
+	mroot = ct.Root()
+	return
+}
+
+// fileMerkleRoot returns the merkle root of all sectors, which is the same as the merkle
+// root built from all leaves of the file data
+func (mr *merkleRoots) fileMerkleRoot() (mroot common.Hash, err error) {
+	ct, err := mr.cachedTree()
+	if err != nil {
+		return
+	}
+	return ct.Root(), nil
+}
+
+// cachedTree returns the cached merkle tree with all roots pushed
+func (mr *merkleRoots) cachedTree() (ct *merkle.Sha256CachedTree, err error) {
 	// create a new cached merkle tree
-	ct := merkle.NewSha256CachedTree(sectorHeight)
+	ct = merkle.NewSha256CachedTree(sectorHeight)
 
 	// append all cachedSubTrees first
 	for _, sub := range mr.cachedSubTrees {
@@ -126,10 +172,6 @@ func (mr *merkleRoots) newMerkleRootPreview(newRoot common.Hash) (mroot common.H
 	for _, root := range mr.uncachedRoots {
 		ct.Push(root)
 	}
-
-	// push the newRoot and calculate the merkle root
-	ct.Push(newRoot)
-	mroot = ct.Root()
 	return
 }
 
@@ -150,3 +192,9 @@ func (mr *merkleRoots) roots() (roots []common.Hash, err error) {
 func (mr *merkleRoots) len() int {
 	return mr.numMerkleRoots
 }
+
+// has returns whether the root is one of the merkle roots inserted
+func (mr *merkleRoots) has(root common.Hash) bool {
+	_, exist := mr.rootSet[root]
+	return exist
+}
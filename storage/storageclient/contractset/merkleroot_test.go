@@ -156,6 +156,95 @@ func TestMerkleRoot_newMerkleRootPreview(t *testing.T) {
 	}
 }
 
+func TestMerkleRoot_Has(t *testing.T) {
+	// initialize storage contract id and new merkle root object
+	id := storageContractIDGenerator()
+	mk, err := newTestMerkleRoots(id)
+	if err != nil {
+		t.Fatalf("failed to create and initialize: %s", err.Error())
+	}
+	defer mk.db.Close()
+	defer mk.db.EmptyDB()
+
+	// push the roots across the cached subtrees
+	roots := rootsGenerator(300)
+	for _, r := range roots {
+		if err := mk.push(r); err != nil {
+			t.Fatalf("failed to push the root %v: %s", r, err.Error())
+		}
+	}
+	for _, r := range roots {
+		if !mk.has(r) {
+			t.Fatalf("root %v pushed is not found", r)
+		}
+	}
+	if mk.has(randomHashGenerator()) {
+		t.Fatalf("root not pushed is found")
+	}
+
+	// the roots loaded are found as well
+	loaded, err := loadMerkleRoots(mk.db, id, roots)
+	if err != nil {
+		t.Fatalf("failed to load the merkle roots: %s", err.Error())
+	}
+	for _, r := range roots {
+		if !loaded.has(r) {
+			t.Fatalf("root %v loaded is not found", r)
+		}
+	}
+}
+
+func TestMerkleRoot_Replace(t *testing.T) {
+	// initialize storage contract id and new merkle root object
+	id := storageContractIDGenerator()
+	mk, err := newTestMerkleRoots(id)
+	if err != nil {
+		t.Fatalf("failed to create and initialize: %s", err.Error())
+	}
+	defer mk.db.Close()
+	defer mk.db.EmptyDB()
+
+	roots := rootsGenerator(300)
+	for _, r := range roots {
+		if err := mk.push(r); err != nil {
+			t.Fatalf("failed to push the root %v: %s", r, err.Error())
+		}
+	}
+
+	// delete a root in the first cached subtree
+	deleted := roots[10]
+	newRoots, found := storage.RemoveSectorRoot(append([]common.Hash(nil), roots...), deleted)
+	if !found {
+		t.Fatalf("root %v is not found", deleted)
+	}
+	if err := mk.replace(newRoots); err != nil {
+		t.Fatalf("failed to replace the roots: %s", err.Error())
+	}
+
+	if mk.len() != len(newRoots) {
+		t.Fatalf("expect %v roots, got %v", len(newRoots), mk.len())
+	}
+	if mk.has(deleted) {
+		t.Fatalf("root %v deleted is still found", deleted)
+	}
+	fetched, err := mk.roots()
+	if err != nil {
+		t.Fatalf("failed to fetch the roots: %s", err.Error())
+	}
+	for i, r := range fetched {
+		if r != newRoots[i] {
+			t.Fatalf("root %d stored does not match. Expected %v, got %v", i, newRoots[i], r)
+		}
+	}
+	root, err := mk.fileMerkleRoot()
+	if err != nil {
+		t.Fatalf("failed to get the file merkle root: %s", err.Error())
+	}
+	if expect := merkle.Sha256CachedTreeRoot2(newRoots); root != expect {
+		t.Fatalf("file merkle root not expected. Expected %v, got %v", expect, root)
+	}
+}
+
 /*
  _____  _____  _______      __  _______ ______      ______ _    _ _   _  _____ _______ _____ ____  _   _
 |  __ \|  __ \|_   _\ \    / /\|__   __|  ____|    |  ____| |  | | \ | |/ ____|__   __|_   _/ __ \| \ | |
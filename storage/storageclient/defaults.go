@@ -6,12 +6,17 @@ package storageclient
 
 import (
 	"time"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/contractmanager"
 )
 
 // Files and directories related constant
 const (
 	PersistDirectory            = "storageclient"
 	PersistFilename             = "storageclient.json"
+	HealthHistoryFilename       = "healthhistory.json"
+	SectorCleanupFilename       = "sectorcleanup.json"
+	BulkUploadDirectory         = "bulkuploads"
 	PersistStorageClientVersion = "1.0"
 	DxPathRoot                  = "dxfiles"
 )
@@ -33,6 +38,46 @@ const (
 
 	// how many times a bad host's timeout/cool down can be doubled before a maximum cool down is reached.
 	MaxConsecutivePenalty = 10
+
+	// the maximum number of segment downloads in flight
+	DefaultMaxInFlightDownloads = 64
+
+	// the number of segments read ahead from the local file during upload, 0 means disabled
+	DefaultReadAheadSegments = 0
+
+	// the minimum number of distinct hosts storing the sectors of a healthy segment, 0 means
+	// no requirement
+	DefaultMinSegmentHosts = 0
+
+	// the upload policy deciding the order of hosts the sectors are assigned to
+	DefaultUploadPolicy = UploadPolicySpeed
+
+	// the number of latest revisions recorded for each contract, 0 means disabled
+	DefaultRevisionHistoryLimit = 16
+
+	// the policy confirming a sector is stored by the host after upload
+	DefaultUploadConfirmPolicy = UploadConfirmTrust
+
+	// the policy deciding whether a partially uploaded segment is accepted
+	DefaultUploadCompletionPolicy = UploadCompletionLenient
+
+	// the policy of the order the segments of different files are dispatched
+	DefaultUploadSchedulingPolicy = UploadSchedulingProgress
+
+	// the interval the health of the files is sampled at, 0 means disabled
+	DefaultHealthSampleInterval = 10 * time.Minute
+
+	// the maximum number of contract formations and renewals in progress, 0 means unlimited
+	DefaultMaxConcurrentNegotiations = 4
+
+	// the policy deciding whether the contract about to expire is renewed or replaced with
+	// a fresh formation. The contracts are renewed by default, since the estimation of the
+	// cheapest policy does not cover all the costs of uploading the data again
+	DefaultContractRenewPolicy = contractmanager.ContractRenewPolicyRenew
+
+	// the interval the directory metadata updates of the segment completions are batched in,
+	// 0 means the metadata is updated on each completion
+	DefaultDirUpdateBatchInterval = 2 * time.Second
 )
 
 const (
@@ -62,13 +107,115 @@ var (
 	// of the root directory of the storage client's filesystem.
 	UploadAndRepairErrorSleepDuration = 15 * time.Minute
 
-	// RemoteRepairDownloadThreshold indicates the threshold in percent under
+	// DefaultRepairDownloadThreshold indicates the threshold in percent under
 	// which the storage client starts repairing a file that is not available on disk
-	RemoteRepairDownloadThreshold = 0.125
+	DefaultRepairDownloadThreshold = 0.125
 
 	// UploadFailureCoolDown is the initial time of punishment while upload consecutive fails
 	// the punishment time shows exponential growth
 	UploadFailureCoolDown = 3 * time.Second
 )
 
-var keys = []string{"fund", "hosts", "period", "violation", "uploadspeed", "downloadspeed"}
+// upload circuit breaker related params
+const (
+	// uploadBreakerWindow is the number of recent sector uploads considered by the upload breaker
+	uploadBreakerWindow = 50
+
+	// uploadBreakerMinResults is the minimum number of recent sector uploads before the upload
+	// breaker could trip
+	uploadBreakerMinResults = 20
+
+	// uploadBreakerFailureRate is the failure rate of recent sector uploads above which the
+	// upload breaker trips
+	uploadBreakerFailureRate = 0.8
+
+	// uploadBreakerInitialBackoff is the time waited before the first probe after the upload
+	// breaker trips
+	uploadBreakerInitialBackoff = 30 * time.Second
+
+	// uploadBreakerMaxBackoff is the maximum time waited between probes
+	uploadBreakerMaxBackoff = 10 * time.Minute
+)
+
+// worker upload health related params
+const (
+	// uploadHealthSmoothing is the weight of the latest upload outcome in the rolling upload
+	// success rate of a worker
+	uploadHealthSmoothing = 0.25
+
+	// uploadLatencyTarget is the latency of uploading a sector within which the host is regarded
+	// as fast. The health score of a slower host is discounted by the latency
+	uploadLatencyTarget = 10 * time.Second
+
+	// minHealthyUploadScore is the upload health score below which a worker is regarded as flaky,
+	// and is used only if the healthier workers are not enough to upload the segment
+	minHealthyUploadScore = 0.5
+)
+
+// repair budget related params
+const (
+	// repairBudgetMaxFailures is the number of failed repairs of a file within the budget window,
+	// after which the repairs of the file yield to other files until the window resets
+	repairBudgetMaxFailures = 10
+
+	// repairBudgetWindow is the time window the failed repairs of a file are counted in
+	repairBudgetWindow = time.Hour
+)
+
+// health history related params
+const (
+	// healthHistoryRetention is the time window the health samples are kept at full resolution
+	healthHistoryRetention = 24 * time.Hour
+
+	// healthHistoryDownsampleInterval is the interval the health samples older than the
+	// retention window are averaged over
+	healthHistoryDownsampleInterval = time.Hour
+
+	// healthHistoryMaxAge is the maximum age of the health samples kept
+	healthHistoryMaxAge = 30 * 24 * time.Hour
+
+	// healthSampleCheckInterval is the interval the health sample setting is checked at when
+	// the sampling is disabled
+	healthSampleCheckInterval = time.Minute
+)
+
+// sector cleanup related params
+const (
+	// sectorCleanupInterval is the interval the sectors of the deleted files are deleted from
+	// the hosts at. The sectors on the hosts not reachable are retried at the next interval
+	sectorCleanupInterval = 10 * time.Minute
+
+	// sectorCleanupBatchSize is the maximum number of sectors deleted in a single revision
+	sectorCleanupBatchSize = 64
+)
+
+// storage probe related params
+const (
+	// storageProbeInterval is the interval the remaining storage advertised by the hosts with
+	// active contracts is probed at. Each probe uploads and deletes a sector on the host
+	storageProbeInterval = 24 * time.Hour
+)
+
+// cost rebalance related params
+const (
+	// rebalanceInterval is the minimum time between two rebalance runs
+	rebalanceInterval = time.Hour
+
+	// rebalanceMaxBytesPerRun is the maximum amount of data re-uploaded by a rebalance run
+	rebalanceMaxBytesPerRun = uint64(1 << 30)
+
+	// rebalanceMinSavingsPercent is the minimum percentage of the storage cost of a file saved
+	// by the migration, below which the file is not worth to be migrated
+	rebalanceMinSavingsPercent = 20
+)
+
+// erasure params recommendation related params
+const (
+	// maxRecommendedMinSectors is the maximum minSectors of the recommended erasure code params
+	maxRecommendedMinSectors = 10
+
+	// maxRecommendedNumSectors is the maximum numSectors of the recommended erasure code params
+	maxRecommendedNumSectors = 30
+)
+
+var keys = []string{"fund", "hosts", "period", "violation", "uploadspeed", "downloadspeed", "repairthreshold"}
@@ -0,0 +1,84 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// dirMetadataBatcher records the directories with a metadata update scheduled. The updates
+// requested for a directory before its scheduled update starts are merged into the scheduled
+// one, so a burst of segment completions in a directory results in a single metadata update
+type dirMetadataBatcher struct {
+	pending map[storage.DxPath]struct{}
+	mu      sync.Mutex
+}
+
+// newDirMetadataBatcher creates an empty dirMetadataBatcher
+func newDirMetadataBatcher() *dirMetadataBatcher {
+	return &dirMetadataBatcher{
+		pending: make(map[storage.DxPath]struct{}),
+	}
+}
+
+// add records the update of the directory. Return false if an update of the directory is
+// already scheduled
+func (b *dirMetadataBatcher) add(dir storage.DxPath) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exist := b.pending[dir]; exist {
+		return false
+	}
+	b.pending[dir] = struct{}{}
+	return true
+}
+
+// remove removes the directory before its update starts, so that the updates requested
+// during the update schedule a new one
+func (b *dirMetadataBatcher) remove(dir storage.DxPath) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.pending, dir)
+}
+
+// updateFileDirMetadata updates the metadata of the directory containing the file. The update
+// is delayed by the dir update batch interval, and merged with the other updates of the
+// directory requested in the interval. 0 interval updates the metadata immediately
+func (client *StorageClient) updateFileDirMetadata(dxPath storage.DxPath) {
+	dir, err := dxPath.Parent()
+	if err != nil {
+		dir = dxPath
+	}
+
+	client.lock.Lock()
+	interval := client.persist.DirUpdateBatchInterval
+	client.lock.Unlock()
+
+	if interval == 0 {
+		if err = client.fileSystem.InitAndUpdateDirMetadata(dir); err != nil {
+			client.log.Error("update dir meta data failed", "dxpath", dir.Path, "err", err)
+		}
+		return
+	}
+	if !client.dirUpdates.add(dir) {
+		return
+	}
+	time.AfterFunc(interval, func() {
+		client.dirUpdates.remove(dir)
+		if err := client.tm.Add(); err != nil {
+			return
+		}
+		defer client.tm.Done()
+
+		if err := client.fileSystem.InitAndUpdateDirMetadata(dir); err != nil {
+			client.log.Error("update dir meta data failed", "dxpath", dir.Path, "err", err)
+		}
+	})
+}
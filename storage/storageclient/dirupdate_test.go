@@ -0,0 +1,108 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem"
+)
+
+// countingFileSystem is the file system counting the directory metadata updates
+type countingFileSystem struct {
+	filesystem.FileSystem
+
+	updates map[storage.DxPath]int
+	mu      sync.Mutex
+}
+
+func (fs *countingFileSystem) InitAndUpdateDirMetadata(path storage.DxPath) error {
+	fs.mu.Lock()
+	fs.updates[path]++
+	fs.mu.Unlock()
+	return fs.FileSystem.InitAndUpdateDirMetadata(path)
+}
+
+func (fs *countingFileSystem) numUpdates() (total int, dirs map[storage.DxPath]int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	dirs = make(map[storage.DxPath]int)
+	for path, num := range fs.updates {
+		total += num
+		dirs[path] = num
+	}
+	return
+}
+
+// TestStorageClient_UpdateFileDirMetadata test completing many segments of a file in a burst
+// updates the metadata of the file's directory a bounded number of times
+func TestStorageClient_UpdateFileDirMetadata(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+	fs := &countingFileSystem{
+		FileSystem: client.fileSystem,
+		updates:    make(map[storage.DxPath]int),
+	}
+	client.fileSystem = fs
+	client.persist.DirUpdateBatchInterval = 200 * time.Millisecond
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(string(entry.FilePath()))
+		entry.Close()
+	}()
+	dir, err := entry.DxPath().Parent()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockAddWorkers(3, client)
+	hosts := make(map[string]struct{})
+	for _, w := range client.workerPool {
+		w.contract.EnodeID = w.hostID
+		hosts[w.hostID.String()] = struct{}{}
+	}
+	segments, err := client.createUnfinishedSegments(entry, hosts, targetUnstuckSegments, client.contractManager.HostHealthMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) == 0 {
+		t.Fatal("no segments created")
+	}
+
+	// Complete the segments repeatedly within the batch interval
+	completions := 0
+	for completions < 500 {
+		for _, uc := range segments {
+			uc.sectorsCompletedNum = uc.sectorsAllNeedNum
+			client.updateUploadSegmentStuckStatus(uc)
+			completions++
+		}
+	}
+	if total, _ := fs.numUpdates(); total != 0 {
+		t.Fatalf("directory metadata updated %v times before the batch interval", total)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	total, dirs := fs.numUpdates()
+	if total != 1 || dirs[dir] != 1 {
+		t.Fatalf("%v completions: expect 1 update of %v, got %v", completions, dir.Path, dirs)
+	}
+
+	// The completions after the batched update schedule a new one
+	client.updateUploadSegmentStuckStatus(segments[0])
+	time.Sleep(500 * time.Millisecond)
+	if total, dirs = fs.numUpdates(); total != 2 || dirs[dir] != 2 {
+		t.Fatalf("expect 2 updates of %v, got %v", dir.Path, dirs)
+	}
+}
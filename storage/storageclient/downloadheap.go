@@ -81,13 +81,13 @@ LOOP:
 			}
 
 			// get the next segment.
-			nextSegment := client.nextDownloadSegment()
+			nextSegment := client.nextDispatchSegment()
 			if nextSegment == nil {
 				break
 			}
 
 			// get the required memory to download this segment.
-			if !client.acquireMemoryForDownloadSegment(nextSegment) {
+			if nextSegment.needsMemory && !client.acquireMemoryForDownloadSegment(nextSegment) {
 				return
 			}
 
@@ -131,6 +131,23 @@ func (client *StorageClient) nextDownloadSegment() *unfinishedDownloadSegment {
 	}
 }
 
+// nextDispatchSegment fetch the next segment from the download heap and acquire an in flight
+// download slot for it. If the number of in flight downloads has reached the limit, return nil
+// and the excess segments stay in the heap, so that the segment with higher priority goes first
+// when a slot is released.
+func (client *StorageClient) nextDispatchSegment() *unfinishedDownloadSegment {
+	if client.downloadLimiter.full() {
+		return nil
+	}
+	nextSegment := client.nextDownloadSegment()
+	if nextSegment == nil {
+		return nil
+	}
+	client.downloadLimiter.acquire()
+	nextSegment.limiter = client.downloadLimiter
+	return nextSegment
+}
+
 // Request memory to download segment, will block until memory is available
 func (client *StorageClient) acquireMemoryForDownloadSegment(uds *unfinishedDownloadSegment) bool {
 
@@ -145,10 +162,29 @@ func (client *StorageClient) distributeDownloadSegmentToWorkers(uds *unfinishedD
 
 	// distribute the segment to workers, marking the number of workers that have received the work.
 	client.lock.Lock()
+	workers := make([]*worker, 0, len(client.workerPool))
+	for _, worker := range client.workerPool {
+		workers = append(workers, worker)
+	}
+
+	// only the best ranked hosts are queued to fetch the sectors, the rest of the
+	// hosts are put on standby and used only if the preferred hosts fail
+	sources, others := client.downloadSources(uds, workers)
+	desired := int(uds.erasureCode.MinSectors() + uds.overdrive)
 	uds.mu.Lock()
-	uds.workersRemaining = uint32(len(client.workerPool))
+	uds.workersRemaining = uint32(len(workers))
+	uds.workersPending = make(map[*worker]struct{})
+	var queued []*worker
+	for i, source := range sources {
+		if i < desired {
+			uds.workersPending[source.worker] = struct{}{}
+			queued = append(queued, source.worker)
+			continue
+		}
+		uds.workersStandby = append(uds.workersStandby, source.worker)
+	}
 	uds.mu.Unlock()
-	for _, worker := range client.workerPool {
+	for _, worker := range append(queued, others...) {
 		worker.queueDownloadSegment(uds)
 	}
 	client.lock.Unlock()
@@ -161,14 +197,9 @@ func (client *StorageClient) distributeDownloadSegmentToWorkers(uds *unfinishedD
 // Add a segment to the download heap
 func (client *StorageClient) addSegmentToDownloadHeap(uds *unfinishedDownloadSegment) {
 
-	// the sole purpose of the heap is to block workers from receiving a segment until memory has been allocated
-	if !uds.needsMemory {
-		client.distributeDownloadSegmentToWorkers(uds)
-		return
-	}
-
-	// put the segment into the segment heap.
+	// the heap blocks workers from receiving a segment until memory has been allocated and
+	// the number of in flight downloads is within the limit
 	client.downloadHeapMu.Lock()
-	client.downloadHeap.Push(uds)
+	heap.Push(client.downloadHeap, uds)
 	client.downloadHeapMu.Unlock()
 }
@@ -0,0 +1,85 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"sync"
+)
+
+// downloadLimiter bounds the number of segment downloads in flight. Segments exceeding
+// the limit stay in the download heap until an in-flight segment finishes
+type downloadLimiter struct {
+	// limit is the maximum number of segment downloads in flight. 0 means unlimited
+	limit uint64
+
+	// inFlight is the number of segment downloads in flight
+	inFlight uint64
+
+	// notify is used to wake up the download loop when a download slot is released
+	notify chan struct{}
+
+	mu sync.Mutex
+}
+
+// newDownloadLimiter creates a new downloadLimiter with the given limit. When a slot is
+// released, a signal is sent to notify channel
+func newDownloadLimiter(limit uint64, notify chan struct{}) *downloadLimiter {
+	return &downloadLimiter{
+		limit:  limit,
+		notify: notify,
+	}
+}
+
+// setLimit set the maximum number of segment downloads in flight
+func (dl *downloadLimiter) setLimit(limit uint64) {
+	dl.mu.Lock()
+	dl.limit = limit
+	dl.mu.Unlock()
+
+	// the limit might be increased, wake up the download loop
+	dl.signal()
+}
+
+// full returns whether the in flight downloads already reached the limit
+func (dl *downloadLimiter) full() bool {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return dl.limit != 0 && dl.inFlight >= dl.limit
+}
+
+// acquire acquire a download slot. The caller shall make sure the limiter is not full
+func (dl *downloadLimiter) acquire() {
+	dl.mu.Lock()
+	dl.inFlight++
+	dl.mu.Unlock()
+}
+
+// release release a download slot and wake up the download loop
+func (dl *downloadLimiter) release() {
+	dl.mu.Lock()
+	if dl.inFlight == 0 {
+		dl.mu.Unlock()
+		return
+	}
+	dl.inFlight--
+	dl.mu.Unlock()
+
+	dl.signal()
+}
+
+// numInFlight returns the number of segment downloads in flight
+func (dl *downloadLimiter) numInFlight() uint64 {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return dl.inFlight
+}
+
+// signal notifies the download loop without blocking
+func (dl *downloadLimiter) signal() {
+	select {
+	case dl.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDownloadLimiter_HeavyLoad test that the number of segment downloads in flight never exceeds
+// the configured limit under heavy load
+func TestDownloadLimiter_HeavyLoad(t *testing.T) {
+	limit := uint64(8)
+	numSegments := 500
+	client := newDownloadLimiterTester(limit)
+	for i := 0; i != numSegments; i++ {
+		client.addSegmentToDownloadHeap(newTestDownloadSegment(uint64(i%3), uint64(i)))
+	}
+
+	var inFlight, maxInFlight int64
+	var wg sync.WaitGroup
+	timeout := time.After(10 * time.Second)
+	for dispatched := 0; dispatched != numSegments; {
+		for {
+			uds := client.nextDispatchSegment()
+			if uds == nil {
+				break
+			}
+			dispatched++
+			n := atomic.AddInt64(&inFlight, 1)
+			for max := atomic.LoadInt64(&maxInFlight); n > max; max = atomic.LoadInt64(&maxInFlight) {
+				if atomic.CompareAndSwapInt64(&maxInFlight, max, n) {
+					break
+				}
+			}
+			wg.Add(1)
+			go func(uds *unfinishedDownloadSegment) {
+				defer wg.Done()
+				time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+				atomic.AddInt64(&inFlight, -1)
+				uds.mu.Lock()
+				uds.recoveryComplete = true
+				uds.releaseDownloadSlot()
+				// releasing twice shall not affect the in flight count
+				uds.releaseDownloadSlot()
+				uds.mu.Unlock()
+			}(uds)
+		}
+		select {
+		case <-client.newDownloads:
+		case <-timeout:
+			t.Fatalf("timeout. dispatched %v out of %v segments", dispatched, numSegments)
+		}
+	}
+	wg.Wait()
+
+	if maxInFlight > int64(limit) {
+		t.Errorf("in flight downloads exceed the limit: %v > %v", maxInFlight, limit)
+	}
+	if maxInFlight != int64(limit) {
+		t.Errorf("in flight downloads shall reach the limit under heavy load: %v != %v", maxInFlight, limit)
+	}
+	if n := client.downloadLimiter.numInFlight(); n != 0 {
+		t.Errorf("after all segments finished, in flight count is not 0: %v", n)
+	}
+}
+
+// TestDownloadLimiter_Priority test that the segment with higher priority is dispatched first
+// when a download slot is released
+func TestDownloadLimiter_Priority(t *testing.T) {
+	client := newDownloadLimiterTester(1)
+	for i := 0; i != 10; i++ {
+		client.addSegmentToDownloadHeap(newTestDownloadSegment(0, uint64(i)))
+	}
+	first := client.nextDispatchSegment()
+	if first == nil {
+		t.Fatal("the first segment shall be dispatched")
+	}
+	if uds := client.nextDispatchSegment(); uds != nil {
+		t.Fatal("the segment shall not be dispatched after the limit is reached")
+	}
+
+	// a segment with higher priority comes in and shall preempt the waiting segments
+	client.addSegmentToDownloadHeap(newTestDownloadSegment(10, 100))
+	first.mu.Lock()
+	first.recoveryComplete = true
+	first.releaseDownloadSlot()
+	first.mu.Unlock()
+
+	uds := client.nextDispatchSegment()
+	if uds == nil {
+		t.Fatal("the segment shall be dispatched after the slot is released")
+	}
+	if uds.priority != 10 {
+		t.Errorf("segment priority not expected. Got %v, Expect %v", uds.priority, 10)
+	}
+}
+
+// TestDownloadLimiter_SetLimit test that changing the limit takes effect on the dispatch
+func TestDownloadLimiter_SetLimit(t *testing.T) {
+	client := newDownloadLimiterTester(2)
+	for i := 0; i != 10; i++ {
+		client.addSegmentToDownloadHeap(newTestDownloadSegment(0, uint64(i)))
+	}
+	tests := []struct {
+		limit          uint64
+		expectInFlight uint64
+	}{
+		{2, 2},
+		{5, 5},
+		{1, 5},
+		{0, 10},
+	}
+	for _, test := range tests {
+		client.downloadLimiter.setLimit(test.limit)
+		for client.nextDispatchSegment() != nil {
+		}
+		if n := client.downloadLimiter.numInFlight(); n != test.expectInFlight {
+			t.Errorf("limit %v: in flight count not expected. Got %v, Expect %v", test.limit, n, test.expectInFlight)
+		}
+	}
+}
+
+// newDownloadLimiterTester creates a storage client with only the download heap and download
+// limiter initialized
+func newDownloadLimiterTester(limit uint64) *StorageClient {
+	client := &StorageClient{
+		newDownloads: make(chan struct{}, 1),
+		downloadHeap: new(downloadSegmentHeap),
+	}
+	client.downloadLimiter = newDownloadLimiter(limit, client.newDownloads)
+	return client
+}
+
+// newTestDownloadSegment creates an unfinishedDownloadSegment with the given priority and segment index
+func newTestDownloadSegment(priority, segmentIndex uint64) *unfinishedDownloadSegment {
+	return &unfinishedDownloadSegment{
+		priority:     priority,
+		segmentIndex: segmentIndex,
+		download: &download{
+			startTime:    time.Unix(0, 0),
+			completeChan: make(chan struct{}),
+		},
+	}
+}
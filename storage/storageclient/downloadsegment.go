@@ -19,8 +19,9 @@ import (
 
 // the information of a sector of a segment to download
 type downloadSectorInfo struct {
-	index uint64
-	root  common.Hash
+	index         uint64
+	root          common.Hash
+	keyGeneration uint8
 }
 
 // represent a unfinished download task
@@ -33,8 +34,11 @@ type unfinishedDownloadSegment struct {
 	// used to generate twofishgcm key seed
 	segmentIndex uint64
 
-	// maps from host id to the downloadSectorInfo
-	segmentMap map[string]downloadSectorInfo
+	// maps from host id to all the sectors of the segment the host holds
+	segmentMap map[string][]downloadSectorInfo
+
+	// maps from host id to the sector the worker of the host is fetching
+	workerSectors map[string]downloadSectorInfo
 
 	// the length of the original data decoded
 	segmentSize uint64
@@ -83,9 +87,16 @@ type unfinishedDownloadSegment struct {
 	// backup workers that can be used to download when other workers fail
 	workersStandby []*worker
 
+	// the preferred workers queued for the segment but not yet processed it
+	workersPending map[*worker]struct{}
+
 	// record how much memory allocated
 	memoryAllocated uint64
 
+	// the limiter of in flight downloads, and whether the download slot has been released
+	limiter      *downloadLimiter
+	slotReleased bool
+
 	// used to update download progress
 	download *download
 	mu       sync.Mutex
@@ -101,6 +112,22 @@ func (uds *unfinishedDownloadSegment) removeWorker() {
 	uds.cleanUp()
 }
 
+// removeQueuedWorker removes the worker which will not process the queued segment
+func (uds *unfinishedDownloadSegment) removeQueuedWorker(w *worker) {
+	uds.mu.Lock()
+	uds.dequeueWorker(w)
+	uds.mu.Unlock()
+	uds.removeWorker()
+}
+
+// dequeueWorker removes the worker from the pending preferred workers, and returns whether
+// the worker was pending. The caller must hold the lock
+func (uds *unfinishedDownloadSegment) dequeueWorker(w *worker) bool {
+	_, pending := uds.workersPending[w]
+	delete(uds.workersPending, w)
+	return pending
+}
+
 // cleanUp will check if the download has failed, and if not it will add
 // any standby workers which need to be added.
 //
@@ -116,6 +143,9 @@ func (uds *unfinishedDownloadSegment) cleanUp() {
 	// return any excess memory.
 	uds.returnMemory()
 
+	// release the download slot if the segment is recovered or failed.
+	uds.releaseDownloadSlot()
+
 	// nothing to do if the segment has failed.
 	if uds.failed {
 		uds.mu.Unlock()
@@ -125,7 +155,9 @@ func (uds *unfinishedDownloadSegment) cleanUp() {
 	// check whether standby workers are required.
 	segmentComplete := uds.sectorsCompleted >= uds.erasureCode.MinSectors()
 	desiredSectorsRegistered := uds.erasureCode.MinSectors() + uds.overdrive - uds.sectorsCompleted
-	standbyWorkersRequired := !segmentComplete && uds.sectorsRegistered < desiredSectorsRegistered
+	// the pending preferred workers are expected to register
+	sectorsExpected := uds.sectorsRegistered + uint32(len(uds.workersPending))
+	standbyWorkersRequired := !segmentComplete && sectorsExpected < desiredSectorsRegistered
 	if !standbyWorkersRequired {
 		uds.mu.Unlock()
 		return
@@ -181,6 +213,93 @@ func (uds *unfinishedDownloadSegment) returnMemory() {
 	}
 }
 
+// releaseDownloadSlot releases the in flight download slot once the segment recovery completes.
+//
+// NOTE: This should be called with uds.mu locked.
+func (uds *unfinishedDownloadSegment) releaseDownloadSlot() {
+	if !uds.recoveryComplete || uds.limiter == nil || uds.slotReleased {
+		return
+	}
+	uds.slotReleased = true
+	uds.limiter.release()
+}
+
+// nextSector returns a sector held by the host which is neither completed nor being fetched.
+// The sectors held by the host are rotated through, so that any sector available could be
+// used to reach the minimum sectors.
+//
+// NOTE: This should be called with uds.mu locked.
+func (uds *unfinishedDownloadSegment) nextSector(hostID string) (downloadSectorInfo, bool) {
+	for _, sector := range uds.segmentMap[hostID] {
+		if !uds.completedSectors[sector.index] && !uds.sectorUsage[sector.index] {
+			return sector, true
+		}
+	}
+	return downloadSectorInfo{}, false
+}
+
+// sectorsCompletedByHost returns whether all sectors held by the host are completed.
+//
+// NOTE: This should be called with uds.mu locked.
+func (uds *unfinishedDownloadSegment) sectorsCompletedByHost(hostID string) bool {
+	for _, sector := range uds.segmentMap[hostID] {
+		if !uds.completedSectors[sector.index] {
+			return false
+		}
+	}
+	return true
+}
+
+// registerSector registers the sector to be fetched by the worker.
+//
+// NOTE: This should be called with uds.mu locked.
+func (uds *unfinishedDownloadSegment) registerSector(w *worker, sector downloadSectorInfo) {
+	if uds.workerSectors == nil {
+		uds.workerSectors = make(map[string]downloadSectorInfo)
+	}
+	uds.sectorsRegistered++
+	uds.sectorUsage[sector.index] = true
+	uds.workerSectors[w.hostID.String()] = sector
+}
+
+// registeredSector returns the sector registered to be fetched by the worker
+func (uds *unfinishedDownloadSegment) registeredSector(w *worker) downloadSectorInfo {
+	uds.mu.Lock()
+	defer uds.mu.Unlock()
+	return uds.workerSectors[w.hostID.String()]
+}
+
+// sectorDownloaded marks the sector fetched by the worker as completed, and starts the recovery
+// once the minimum sectors are completed. The returned boolean denotes whether the worker shall
+// fetch another sector its host holds, which happens if more sectors are still needed.
+func (uds *unfinishedDownloadSegment) sectorDownloaded(w *worker, sector downloadSectorInfo, data []byte) bool {
+	uds.mu.Lock()
+	defer uds.mu.Unlock()
+
+	delete(uds.workerSectors, w.hostID.String())
+	uds.markSectorCompleted(sector.index)
+	uds.sectorsRegistered--
+
+	// if the num of sectorsCompleted has not reached the required min sector num,
+	// go on keeping the decrypted sector.
+	if uds.sectorsCompleted <= uds.erasureCode.MinSectors() {
+		uds.physicalSegmentData[sector.index] = data
+		w.client.log.Debug("received a sector,but not enough to recover", "sectors_completed", uds.sectorsCompleted)
+	}
+
+	// recover the logical data
+	if uds.sectorsCompleted == uds.erasureCode.MinSectors() {
+		go uds.recoverLogicalData()
+		w.client.log.Debug("received enough sectors to recover", "sectors_completed", uds.sectorsCompleted)
+		return false
+	}
+	if uds.sectorsCompleted > uds.erasureCode.MinSectors() || uds.failed {
+		return false
+	}
+	_, more := uds.nextSector(w.hostID.String())
+	return more
+}
+
 // marks the sector with sectorIndex as completed.
 func (uds *unfinishedDownloadSegment) markSectorCompleted(sectorIndex uint64) {
 	uds.completedSectors[sectorIndex] = true
@@ -0,0 +1,63 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"sort"
+	"time"
+)
+
+// downloadSource is a worker holding a sector of the segment to download, along with the
+// evaluation of its host and the latency observed downloading from the host
+type downloadSource struct {
+	worker     *worker
+	evaluation int64
+	latency    time.Duration
+}
+
+// meetsLatencyTarget checks whether the latency of the source is within the latency target.
+// The source without latency observed yet is considered to meet the target
+func (ds downloadSource) meetsLatencyTarget(latencyTarget time.Duration) bool {
+	return ds.latency == 0 || latencyTarget == 0 || ds.latency <= latencyTarget
+}
+
+// rankDownloadSources sorts the download sources from the best to the worst. The sources
+// meeting the latency target are preferred, then the ones with higher host evaluation, then
+// the ones with lower latency
+func rankDownloadSources(sources []downloadSource, latencyTarget time.Duration) {
+	sort.SliceStable(sources, func(i, j int) bool {
+		iMeets, jMeets := sources[i].meetsLatencyTarget(latencyTarget), sources[j].meetsLatencyTarget(latencyTarget)
+		if iMeets != jMeets {
+			return iMeets
+		}
+		if sources[i].evaluation != sources[j].evaluation {
+			return sources[i].evaluation > sources[j].evaluation
+		}
+		return sources[i].latency < sources[j].latency
+	})
+}
+
+// downloadSources returns the ranked download sources of the segment among the workers.
+// The workers not holding any sector of the segment are returned separately.
+func (client *StorageClient) downloadSources(uds *unfinishedDownloadSegment, workers []*worker) ([]downloadSource, []*worker) {
+	var sources []downloadSource
+	var others []*worker
+	for _, w := range workers {
+		if _, exists := uds.segmentMap[w.hostID.String()]; !exists {
+			others = append(others, w)
+			continue
+		}
+		source := downloadSource{
+			worker:  w,
+			latency: w.downloadLatencyObserved(),
+		}
+		if info, exists := client.storageHostManager.RetrieveHostInfo(w.hostID); exists {
+			source.evaluation = client.storageHostManager.Evaluate(info)
+		}
+		sources = append(sources, source)
+	}
+	rankDownloadSources(sources, uds.latencyTarget)
+	return sources, others
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/log"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+	"github.com/DxChainNetwork/godx/storage/storageclient/storagehostmanager"
+)
+
+// TestRankDownloadSources test the download sources are ranked by latency target, host
+// evaluation and latency in order
+func TestRankDownloadSources(t *testing.T) {
+	latencyTarget := 100 * time.Millisecond
+	sources := []downloadSource{
+		{evaluation: 100, latency: 200 * time.Millisecond},
+		{evaluation: 10, latency: 50 * time.Millisecond},
+		{evaluation: 50, latency: 80 * time.Millisecond},
+		{evaluation: 50, latency: 20 * time.Millisecond},
+		{evaluation: 50, latency: 0},
+	}
+	for i := range sources {
+		sources[i].worker = &worker{hostID: enode.RandomID(enode.ID{}, i)}
+	}
+	expected := []*worker{sources[4].worker, sources[3].worker, sources[2].worker, sources[1].worker, sources[0].worker}
+
+	rankDownloadSources(sources, latencyTarget)
+	for i, source := range sources {
+		if source.worker != expected[i] {
+			t.Errorf("source %v not ranked as expected: %+v", i, source)
+		}
+	}
+}
+
+// TestDistributeDownloadSegmentToWorkers_PreferredHosts test the best hosts are queried first
+// for the minimum sectors, and the other hosts are used only after a preferred host fails
+func TestDistributeDownloadSegmentToWorkers_PreferredHosts(t *testing.T) {
+	persistDir, err := ioutil.TempDir("", "downloadsource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(persistDir)
+
+	client := &StorageClient{
+		workerPool:         make(map[storage.ContractID]*worker),
+		storageHostManager: storagehostmanager.New(persistDir),
+	}
+	ec, err := erasurecode.New(erasurecode.ECTypeStandard, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the workers are ordered by the latency observed, the first two being the best
+	uds := newTestDownloadSegment(0, 0)
+	uds.erasureCode = ec
+	uds.segmentMap = make(map[string][]downloadSectorInfo)
+	uds.sectorUsage = make([]bool, ec.NumSectors())
+	uds.completedSectors = make([]bool, ec.NumSectors())
+	var workers []*worker
+	for i := 0; i < int(ec.NumSectors()); i++ {
+		w := &worker{
+			hostID:          enode.RandomID(enode.ID{}, i),
+			downloadLatency: time.Duration(i+1) * time.Millisecond,
+			downloadChan:    make(chan struct{}, 1),
+			client:          client,
+		}
+		workers = append(workers, w)
+		client.workerPool[storage.ContractID{byte(i)}] = w
+		uds.segmentMap[w.hostID.String()] = []downloadSectorInfo{{index: uint64(i)}}
+	}
+
+	client.distributeDownloadSegmentToWorkers(uds)
+
+	for i, w := range workers {
+		queued := len(w.downloadSegments) == 1
+		if preferred := i < int(ec.MinSectors()); queued != preferred {
+			t.Errorf("worker %v: expect queued %v, got %v", i, preferred, queued)
+		}
+	}
+	if len(uds.workersStandby) != int(ec.NumSectors()-ec.MinSectors()) {
+		t.Fatalf("expect %v standby workers, got %v", ec.NumSectors()-ec.MinSectors(), len(uds.workersStandby))
+	}
+
+	// the standby workers are queued after a preferred worker fails
+	workers[0].nextDownloadSegment()
+	uds.removeQueuedWorker(workers[0])
+	for i, w := range workers[ec.MinSectors():] {
+		if len(w.downloadSegments) != 1 {
+			t.Errorf("standby worker %v is not queued after the preferred worker failed", i)
+		}
+	}
+}
+
+// TestDownloadSegment_RotateSectors test the segment is still recovered when the hosts of the
+// initially selected sectors are down, with the alternate hosts rotating through all the
+// sectors they hold
+func TestDownloadSegment_RotateSectors(t *testing.T) {
+	persistDir, err := ioutil.TempDir("", "downloadsource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(persistDir)
+
+	client := &StorageClient{
+		workerPool:         make(map[storage.ContractID]*worker),
+		storageHostManager: storagehostmanager.New(persistDir),
+		log:                log.New(),
+	}
+	ec, err := erasurecode.New(erasurecode.ECTypeStandard, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 128)
+	rand.Read(data)
+	sectors, err := ec.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uds := newTestDownloadSegment(0, 0)
+	uds.erasureCode = ec
+	uds.segmentSize = uint64(len(data))
+	uds.fetchLength = uint64(len(data))
+	destination := newDownloadBuffer(uint64(len(data)), uint64(len(data)))
+	uds.destination = destination
+	uds.download.segmentsRemaining = 1
+	uds.physicalSegmentData = make([][]byte, ec.NumSectors())
+	uds.segmentMap = make(map[string][]downloadSectorInfo)
+	uds.sectorUsage = make([]bool, ec.NumSectors())
+	uds.completedSectors = make([]bool, ec.NumSectors())
+
+	// the preferred hosts hold sector 0 and 1, the alternate hosts hold the same sectors
+	// together with sector 2 and 3
+	hostSectors := [][]uint64{{0}, {1}, {0, 2}, {1, 3}}
+	var workers []*worker
+	for i, indexes := range hostSectors {
+		w := &worker{
+			hostID:          enode.RandomID(enode.ID{}, i),
+			downloadLatency: time.Duration(i+1) * time.Millisecond,
+			downloadChan:    make(chan struct{}, 1),
+			client:          client,
+		}
+		workers = append(workers, w)
+		client.workerPool[storage.ContractID{byte(i)}] = w
+		for _, index := range indexes {
+			uds.segmentMap[w.hostID.String()] = append(uds.segmentMap[w.hostID.String()], downloadSectorInfo{index: index})
+		}
+	}
+	client.distributeDownloadSegmentToWorkers(uds)
+
+	// the preferred hosts are down
+	for _, w := range workers[:2] {
+		w.nextDownloadSegment()
+		uds.removeQueuedWorker(w)
+	}
+
+	// the alternate hosts take the sectors of the hosts down
+	for i, w := range workers[2:] {
+		if w.processDownloadSegment(w.nextDownloadSegment()) == nil {
+			t.Fatalf("alternate worker %v is not registered", i)
+		}
+		if sector := uds.registeredSector(w); sector.index != uint64(i) {
+			t.Fatalf("alternate worker %v: expect sector %v, got %v", i, i, sector.index)
+		}
+	}
+
+	// the first alternate host completes the sector, and shall fetch its other sector if needed
+	sector := uds.registeredSector(workers[2])
+	if !uds.sectorDownloaded(workers[2], sector, sectors[sector.index]) {
+		t.Fatal("the worker shall fetch another sector its host holds")
+	}
+	workers[2].queueDownloadSegment(uds)
+	if workers[2].processDownloadSegment(workers[2].nextDownloadSegment()) != nil {
+		t.Fatal("the worker shall be on standby while enough sectors are in progress")
+	}
+
+	// the second alternate host fails, and the first alternate host fetches its other sector
+	uds.unregisterWorker(workers[3])
+	uds.removeWorker()
+	if workers[2].processDownloadSegment(workers[2].nextDownloadSegment()) == nil {
+		t.Fatal("the standby worker is not registered after the other worker failed")
+	}
+	sector = uds.registeredSector(workers[2])
+	if sector.index != 2 {
+		t.Fatalf("expect sector 2, got %v", sector.index)
+	}
+	if uds.sectorDownloaded(workers[2], sector, sectors[sector.index]) {
+		t.Fatal("the worker shall not fetch more sectors after the minimum sectors are completed")
+	}
+	uds.removeWorker()
+
+	select {
+	case <-uds.download.completeChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("download not completed")
+	}
+	if err := uds.download.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(destination.buf[0], data) {
+		t.Error("recovered data not expected")
+	}
+}
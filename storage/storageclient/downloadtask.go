@@ -5,6 +5,7 @@
 package storageclient
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -13,6 +14,19 @@ import (
 	"github.com/DxChainNetwork/godx/storage/storageclient/memorymanager"
 )
 
+// SegmentUnavailableError is used when the download range contains a segment not yet uploaded
+// with enough sectors to be recovered
+type SegmentUnavailableError struct {
+	Segment uint64
+	Start   uint64
+	End     uint64
+}
+
+// Error implements the error interface
+func (e *SegmentUnavailableError) Error() string {
+	return fmt.Sprintf("segment %v covering bytes [%v, %v) not available yet", e.Segment, e.Start, e.End)
+}
+
 type (
 
 	// a file download that has been queued by the client.
@@ -0,0 +1,126 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestNewDownload_PartiallyUploaded test that a range within the segments already uploaded could
+// be downloaded while the file is still uploading, and a range containing a segment not yet
+// uploaded returns SegmentUnavailableError
+func TestNewDownload_PartiallyUploaded(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	defer sct.Client.Close()
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(entry.FilePath())
+		entry.Close()
+	}()
+
+	// only the first segment is uploaded
+	if entry.NumSegments() < 2 {
+		t.Fatalf("expect at least 2 segments, got %v", entry.NumSegments())
+	}
+	if err := entry.AddSector(enode.ID{1}, common.Hash{1}, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := entry.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	segmentSize := snap.SegmentSize()
+
+	d, err := client.newDownload(downloadParams{
+		file:   snap,
+		offset: segmentSize / 4,
+		length: segmentSize / 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to download the uploaded segment: %v", err)
+	}
+	if d.segmentsRemaining != 1 {
+		t.Errorf("expect 1 segment to download, got %v", d.segmentsRemaining)
+	}
+	client.downloadHeapMu.Lock()
+	heapLen := client.downloadHeap.Len()
+	client.downloadHeapMu.Unlock()
+	if heapLen != 1 {
+		t.Errorf("expect 1 segment in download heap, got %v", heapLen)
+	}
+
+	// the range crossing into the segment still uploading is not available
+	_, err = client.newDownload(downloadParams{
+		file:   snap,
+		offset: segmentSize / 2,
+		length: segmentSize,
+	})
+	unavailable, ok := err.(*SegmentUnavailableError)
+	if !ok {
+		t.Fatalf("expect the segment unavailable error, got %v", err)
+	}
+	if unavailable.Segment != 1 || unavailable.Start != segmentSize || unavailable.End <= unavailable.Start {
+		t.Errorf("unexpected unavailable segment %+v", unavailable)
+	}
+}
+
+// TestNewDownload_FinalSegment test the download of the whole file fetches the final partial
+// segment only up to the end of the file
+func TestNewDownload_FinalSegment(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	defer sct.Client.Close()
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(entry.FilePath())
+		entry.Close()
+	}()
+	for i := 0; i != entry.NumSegments(); i++ {
+		if err := entry.AddSector(enode.ID{byte(i + 1)}, common.Hash{byte(i + 1)}, i, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := entry.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalLength := common.FinalSegmentLength(snap.FileSize(), snap.SegmentSize())
+	if finalLength == snap.SegmentSize() {
+		t.Fatalf("expect a partial final segment, file size %v, segment size %v", snap.FileSize(), snap.SegmentSize())
+	}
+
+	if _, err = client.newDownload(downloadParams{file: snap, length: snap.FileSize()}); err != nil {
+		t.Fatal(err)
+	}
+	client.downloadHeapMu.Lock()
+	defer client.downloadHeapMu.Unlock()
+	if uint64(client.downloadHeap.Len()) != snap.NumSegments() {
+		t.Fatalf("expect %v segments to download, got %v", snap.NumSegments(), client.downloadHeap.Len())
+	}
+	var total uint64
+	for _, uds := range *client.downloadHeap {
+		total += uds.fetchLength
+		if uds.segmentIndex == snap.NumSegments()-1 && uds.fetchLength != finalLength {
+			t.Errorf("expect final segment length %v, got %v", finalLength, uds.fetchLength)
+		}
+	}
+	if total != snap.FileSize() {
+		t.Errorf("expect %v bytes to download, got %v", snap.FileSize(), total)
+	}
+}
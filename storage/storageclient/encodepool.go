@@ -0,0 +1,34 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// encodePool is the compute pool shared by the erasure encodes of all segments. It bounds the
+// number of encodes running at the same time, so that many segments encoded concurrently do not
+// oversubscribe the CPU cores
+type encodePool struct {
+	slots chan struct{}
+}
+
+// newEncodePool creates a new encodePool running at most size encodes at the same time
+func newEncodePool(size int) *encodePool {
+	if size < 1 {
+		size = 1
+	}
+	return &encodePool{
+		slots: make(chan struct{}, size),
+	}
+}
+
+// encode encodes the data with the erasure code once a slot of the pool is available
+func (ep *encodePool) encode(ec erasurecode.ErasureCoder, data []byte) ([][]byte, error) {
+	ep.slots <- struct{}{}
+	defer func() { <-ep.slots }()
+
+	return ec.Encode(data)
+}
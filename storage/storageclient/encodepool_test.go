@@ -0,0 +1,58 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// BenchmarkEncode_Unmanaged benchmark many segments erasure encoded concurrently, each encode
+// running as soon as the segment is ready
+func BenchmarkEncode_Unmanaged(b *testing.B) {
+	benchmarkConcurrentEncodes(b, nil)
+}
+
+// BenchmarkEncode_SharedPool benchmark many segments erasure encoded concurrently through the
+// encode pool sized to the number of CPU cores
+func BenchmarkEncode_SharedPool(b *testing.B) {
+	benchmarkConcurrentEncodes(b, newEncodePool(runtime.NumCPU()))
+}
+
+func benchmarkConcurrentEncodes(b *testing.B, pool *encodePool) {
+	ec, err := erasurecode.New(erasurecode.ECTypeStandard, 10, 30)
+	if err != nil {
+		b.Fatal(err)
+	}
+	numEncodes := 8 * runtime.NumCPU()
+	data := make([]byte, 1<<22)
+	rand.Read(data)
+
+	b.SetBytes(int64(numEncodes) * int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < numEncodes; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var err error
+				if pool == nil {
+					_, err = ec.Encode(data)
+				} else {
+					_, err = pool.encode(ec, data)
+				}
+				if err != nil {
+					b.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
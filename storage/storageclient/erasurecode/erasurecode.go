@@ -42,6 +42,10 @@ type ErasureCoder interface {
 	// Extra return the extra info included in the ErasureCoder
 	Extra() []interface{}
 
+	// ShardSize return the size of an encoded shard of a sector, and whether the code shards
+	// the segment. Only ECTypeShard shards the segment
+	ShardSize() (int, bool)
+
 	// Encode encode the segment to sectors
 	Encode(data []byte) ([][]byte, error)
 
@@ -34,3 +34,26 @@ func TestNewErasureCoder(t *testing.T) {
 		}
 	}
 }
+
+func TestErasureCoder_ShardSize(t *testing.T) {
+	tests := []struct {
+		ecType    uint8
+		extra     []interface{}
+		shardSize int
+		sharded   bool
+	}{
+		{ECTypeStandard, nil, 0, false},
+		{ECTypeShard, nil, EncodedShardUnit, true},
+		{ECTypeShard, []interface{}{EncodedShardUnit * 4}, EncodedShardUnit * 4, true},
+	}
+	for i, test := range tests {
+		ec, err := New(test.ecType, 1, 2, test.extra...)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		shardSize, sharded := ec.ShardSize()
+		if shardSize != test.shardSize || sharded != test.sharded {
+			t.Errorf("Test %d: expect shard size %v/%v, got %v/%v", i, test.shardSize, test.sharded, shardSize, sharded)
+		}
+	}
+}
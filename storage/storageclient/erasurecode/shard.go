@@ -48,6 +48,11 @@ func (sec *shardErasureCode) Extra() []interface{} {
 	return []interface{}{sec.encodedShardSize}
 }
 
+// ShardSize return encodedShardSize of shardErasureCode
+func (sec *shardErasureCode) ShardSize() (int, bool) {
+	return sec.encodedShardSize, true
+}
+
 // Encode encode the segment to sectors
 func (sec *shardErasureCode) Encode(segment []byte) ([][]byte, error) {
 	// append 0s if data is not divisible by shardSize
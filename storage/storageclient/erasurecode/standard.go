@@ -57,6 +57,11 @@ func (sec *standardErasureCode) Extra() []interface{} {
 	return nil
 }
 
+// ShardSize of standardErasureCode return false, since the segment is not sharded
+func (sec *standardErasureCode) ShardSize() (int, bool) {
+	return 0, false
+}
+
 // Encode encode the segment to sectors
 func (sec *standardErasureCode) Encode(data []byte) ([][]byte, error) {
 	sectors, err := sec.enc.Split(data)
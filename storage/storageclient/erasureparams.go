@@ -0,0 +1,101 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// errNoHostFailureRate is the error that the failure rate of the host pool is not observed yet
+var errNoHostFailureRate = errors.New("no host has been scanned to observe the host failure rate")
+
+// ErasureParams is the erasure code params recommended for a durability target
+type ErasureParams struct {
+	MinSectors      uint32  `json:"minSectors"`
+	NumSectors      uint32  `json:"numSectors"`
+	HostFailureRate float64 `json:"hostFailureRate"`
+	Durability      float64 `json:"durability"`
+}
+
+// RecommendErasureParams returns the erasure code params meeting the durability target, which is
+// the probability a segment is recoverable when each host fails independently with the host
+// failure rate. Among the params meeting the target, the one with the least redundancy is
+// recommended, and the one with fewer sectors is preferred if the redundancy is the same
+func RecommendErasureParams(durabilityTarget, hostFailureRate float64) (ErasureParams, error) {
+	if durabilityTarget <= 0 || durabilityTarget >= 1 {
+		return ErasureParams{}, fmt.Errorf("durability target %v not within (0, 1)", durabilityTarget)
+	}
+	if hostFailureRate < 0 || hostFailureRate >= 1 {
+		return ErasureParams{}, fmt.Errorf("host failure rate %v not within [0, 1)", hostFailureRate)
+	}
+
+	var best ErasureParams
+	for minSectors := uint32(1); minSectors <= maxRecommendedMinSectors; minSectors++ {
+		for numSectors := minSectors + 1; numSectors <= maxRecommendedNumSectors; numSectors++ {
+			durability := segmentDurability(minSectors, numSectors, hostFailureRate)
+			if durability < durabilityTarget {
+				continue
+			}
+			// compare the redundancy numSectors/minSectors without float division
+			redundancy, bestRedundancy := uint64(numSectors)*uint64(best.MinSectors), uint64(best.NumSectors)*uint64(minSectors)
+			if best.MinSectors == 0 || redundancy < bestRedundancy || (redundancy == bestRedundancy && numSectors < best.NumSectors) {
+				best = ErasureParams{
+					MinSectors:      minSectors,
+					NumSectors:      numSectors,
+					HostFailureRate: hostFailureRate,
+					Durability:      durability,
+				}
+			}
+			break
+		}
+	}
+	if best.MinSectors == 0 {
+		return ErasureParams{}, fmt.Errorf("durability target %v not reachable with at most %v sectors at host failure rate %v", durabilityTarget, maxRecommendedNumSectors, hostFailureRate)
+	}
+	return best, nil
+}
+
+// segmentDurability returns the probability that at least minSectors out of numSectors sectors
+// are available, when each host fails independently with the host failure rate
+func segmentDurability(minSectors, numSectors uint32, hostFailureRate float64) float64 {
+	var durability float64
+	// coefficient is the binomial coefficient C(numSectors, k), starting from k = numSectors
+	coefficient := 1.0
+	for k := numSectors; k >= minSectors; k-- {
+		durability += coefficient * math.Pow(1-hostFailureRate, float64(k)) * math.Pow(hostFailureRate, float64(numSectors-k))
+		coefficient = coefficient * float64(k) / float64(numSectors-k+1)
+		if k == 0 {
+			break
+		}
+	}
+	if durability > 1 {
+		durability = 1
+	}
+	return durability
+}
+
+// RecommendErasureParams returns the erasure code params meeting the durability target with
+// the observed failure rate of the host pool
+func (client *StorageClient) RecommendErasureParams(durabilityTarget float64) (ErasureParams, error) {
+	hostFailureRate, ok := client.storageHostManager.HostFailureRate()
+	if !ok {
+		return ErasureParams{}, errNoHostFailureRate
+	}
+	return RecommendErasureParams(durabilityTarget, hostFailureRate)
+}
+
+// RecommendErasureCode returns the standard erasure code meeting the durability target with the
+// observed failure rate of the host pool, which could be used as the erasure code of FileUploadParams
+func (client *StorageClient) RecommendErasureCode(durabilityTarget float64) (erasurecode.ErasureCoder, error) {
+	params, err := client.RecommendErasureParams(durabilityTarget)
+	if err != nil {
+		return nil, err
+	}
+	return erasurecode.New(erasurecode.ECTypeStandard, params.MinSectors, params.NumSectors)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"math"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// TestRecommendErasureParams test the recommended erasure code params meet the durability
+// target at the host failure rate, and one less sector does not
+func TestRecommendErasureParams(t *testing.T) {
+	tests := []struct {
+		durabilityTarget float64
+		hostFailureRate  float64
+	}{
+		{0.9, 0.1},
+		{0.999999, 0.1},
+		{0.999999, 0.3},
+		{0.99, 0},
+		{0.9, 0.2},
+	}
+	for i, test := range tests {
+		params, err := RecommendErasureParams(test.durabilityTarget, test.hostFailureRate)
+		if err != nil {
+			t.Fatalf("test %v: %v", i, err)
+		}
+		if params.MinSectors == 0 || params.NumSectors <= params.MinSectors || params.NumSectors > maxRecommendedNumSectors {
+			t.Fatalf("test %v: invalid params %+v", i, params)
+		}
+		durability := binomialDurability(params.MinSectors, params.NumSectors, test.hostFailureRate)
+		if durability < test.durabilityTarget {
+			t.Errorf("test %v: params %+v with durability %v not meeting the target %v", i, params, durability, test.durabilityTarget)
+		}
+		if math.Abs(durability-params.Durability) > 1e-9 {
+			t.Errorf("test %v: expect durability %v, got %v", i, durability, params.Durability)
+		}
+		if params.NumSectors > params.MinSectors+1 {
+			if less := binomialDurability(params.MinSectors, params.NumSectors-1, test.hostFailureRate); less >= test.durabilityTarget {
+				t.Errorf("test %v: params %+v not minimal, durability with one less sector %v", i, params, less)
+			}
+		}
+		if _, err := erasurecode.New(erasurecode.ECTypeStandard, params.MinSectors, params.NumSectors); err != nil {
+			t.Errorf("test %v: recommended params not valid for erasure code: %v", i, err)
+		}
+	}
+}
+
+// TestRecommendErasureParams_Invalid test the invalid or unreachable targets are rejected
+func TestRecommendErasureParams_Invalid(t *testing.T) {
+	tests := []struct {
+		durabilityTarget float64
+		hostFailureRate  float64
+	}{
+		{0, 0.1},
+		{1, 0.1},
+		{0.9, -0.1},
+		{0.9, 1},
+		{0.999999999999, 0.9},
+	}
+	for i, test := range tests {
+		if params, err := RecommendErasureParams(test.durabilityTarget, test.hostFailureRate); err == nil {
+			t.Errorf("test %v: expect error, got params %+v", i, params)
+		}
+	}
+}
+
+// binomialDurability calculates the probability that at least minSectors out of numSectors
+// sectors are available with the log gamma function
+func binomialDurability(minSectors, numSectors uint32, hostFailureRate float64) float64 {
+	n := float64(numSectors)
+	var durability float64
+	for k := minSectors; k <= numSectors; k++ {
+		kf := float64(k)
+		lgN, _ := math.Lgamma(n + 1)
+		lgK, _ := math.Lgamma(kf + 1)
+		lgNK, _ := math.Lgamma(n - kf + 1)
+		durability += math.Exp(lgN-lgK-lgNK) * math.Pow(1-hostFailureRate, kf) * math.Pow(hostFailureRate, n-kf)
+	}
+	return durability
+}
@@ -5,9 +5,13 @@
 package filesystem
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 
+	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
 )
 
 // PublicFileSystemDebugAPI is the APIs for the file system
@@ -146,3 +150,70 @@ func (api *PublicFileSystemAPI) Delete(path string) string {
 	}
 	return fmt.Sprintf("File %v deleted", path)
 }
+
+// SetRenewalPolicy set the renewal policy of the file specified by the path. The policy is
+// one of always, never and ifhealthy
+func (api *PublicFileSystemAPI) SetRenewalPolicy(path string, policy string) string {
+	dxPath, err := storage.NewDxPath(path)
+	if err != nil {
+		return fmt.Sprintf("Path not valid: %v", path)
+	}
+	renewalPolicy, err := storage.ParseRenewalPolicy(policy)
+	if err != nil {
+		return fmt.Sprintf("Policy not valid: %v", err)
+	}
+	if err = api.fs.SetFileRenewalPolicy(dxPath, renewalPolicy); err != nil {
+		return fmt.Sprintf("Cannot set renewal policy of file %v: %v", path, err)
+	}
+	return fmt.Sprintf("File %v renewal policy set to %v", path, renewalPolicy)
+}
+
+// FilesOnHost returns the files with sectors stored on the host, together with the health of each
+// file and the projected health if the sectors on the host are lost
+func (api *PublicFileSystemAPI) FilesOnHost(hostID string) ([]storage.FileOnHost, error) {
+	var id enode.ID
+	idSlice, err := hex.DecodeString(hostID)
+	if err != nil || len(idSlice) != len(id) {
+		return nil, errors.New("the hostID provided is not valid")
+	}
+	copy(id[:], idSlice)
+	return api.fs.FilesOnHost(id)
+}
+
+// DuplicateFiles returns the groups of files with identical content
+func (api *PublicFileSystemAPI) DuplicateFiles() ([]storage.DuplicateFiles, error) {
+	return api.fs.FindDuplicateFiles()
+}
+
+// DumpDxFile returns the diagnostic dump of the file specified by the path, including the
+// metadata, the host table, and the sectors of each segment. The cipher key is redacted
+func (api *PublicFileSystemAPI) DumpDxFile(path string) (dxfile.FileDump, error) {
+	dxPath, err := storage.NewDxPath(path)
+	if err != nil {
+		return dxfile.FileDump{}, err
+	}
+	return api.fs.DumpDxFile(dxPath)
+}
+
+// MergeDuplicate merges the file at remove into the file at keep with identical content. The
+// file at remove is deleted
+func (api *PublicFileSystemAPI) MergeDuplicate(keep, remove string) string {
+	keepDxPath, err := storage.NewDxPath(keep)
+	if err != nil {
+		return fmt.Sprintf("Path not valid: %v", keep)
+	}
+	removeDxPath, err := storage.NewDxPath(remove)
+	if err != nil {
+		return fmt.Sprintf("Path not valid: %v", remove)
+	}
+	if err = api.fs.MergeDuplicate(keepDxPath, removeDxPath); err != nil {
+		return fmt.Sprintf("Cannot merge file %v into %v: %v", remove, keep, err)
+	}
+	if parent, err := removeDxPath.Parent(); err == nil {
+		err = api.fs.InitAndUpdateDirMetadata(parent)
+		if err != nil {
+			api.fs.getLogger().Warn("InitAndUpdateDirMetadata error", "error", err)
+		}
+	}
+	return fmt.Sprintf("File %v merged into %v", remove, keep)
+}
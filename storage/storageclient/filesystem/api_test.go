@@ -5,15 +5,19 @@
 package filesystem
 
 import (
+	"encoding/hex"
 	"math"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
 	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxdir"
@@ -245,6 +249,7 @@ func TestPublicFileSystemAPI_DetailedFileInfo(t *testing.T) {
 		Redundancy:     300,
 		StoredOnDisk:   false,
 		UploadProgress: 100,
+		RenewalPolicy:  storage.AlwaysRenew.String(),
 	}
 	if err = df.Close(); err != nil {
 		t.Fatal(err)
@@ -266,3 +271,240 @@ func (fs *fileSystem) checkDxDirMetadata(path storage.DxPath, expectMd dxdir.Met
 	}
 	return nil
 }
+
+// TestPublicFileSystemAPI_SetRenewalPolicy test the renewal policy set is saved in the file metadata,
+// and the hosts storing only the NeverRenew file are reported as lapsing
+func TestPublicFileSystemAPI_SetRenewalPolicy(t *testing.T) {
+	fs := newEmptyTestFileSystem(t, "", &AlwaysSuccessContractManager{}, newStandardDisrupter())
+	api := NewPublicFileSystemAPI(fs)
+	ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	neverPath, alwaysPath := randomDxPath(t, 3), randomDxPath(t, 3)
+	var hostIDs [][]enode.ID
+	for _, path := range []storage.DxPath{neverPath, alwaysPath} {
+		df, err := fs.fileSet.NewRandomDxFile(path, 10, 30, erasurecode.ECTypeStandard, ck, 1<<22*10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hostIDs = append(hostIDs, df.HostIDs())
+		if err = df.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if res := api.SetRenewalPolicy(neverPath.Path, "unknown"); !strings.Contains(res, "Policy not valid") {
+		t.Fatalf("unexpected response message: %v", res)
+	}
+	if res := api.SetRenewalPolicy(neverPath.Path, storage.NeverRenew.String()); !strings.Contains(res, "renewal policy set to") {
+		t.Fatalf("unexpected response message: %v", res)
+	}
+	policy, err := fs.FileRenewalPolicy(neverPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy != storage.NeverRenew {
+		t.Fatalf("renewal policy not expected. Expect %v, got %v", storage.NeverRenew, policy)
+	}
+
+	lapsing, err := fs.LapsingHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range hostIDs[0] {
+		if _, exist := lapsing[id]; !exist {
+			t.Errorf("host %v storing only the NeverRenew file is expected to lapse", id)
+		}
+	}
+	for _, id := range hostIDs[1] {
+		if _, exist := lapsing[id]; exist {
+			t.Errorf("host %v storing the AlwaysRenew file is expected to renew", id)
+		}
+	}
+}
+
+// TestPublicFileSystemAPI_MergeDuplicate test the files with identical content are detected, and
+// merged only if erasure coded with the same params
+func TestPublicFileSystemAPI_MergeDuplicate(t *testing.T) {
+	fs := newEmptyTestFileSystem(t, "", &AlwaysSuccessContractManager{}, newStandardDisrupter())
+	api := NewPublicFileSystemAPI(fs)
+	ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := common.BytesToHash([]byte("identical content"))
+	fileSize := uint64(1 << 22 * 10)
+	keepPath, removePath, otherECPath, otherPath := randomDxPath(t, 2), randomDxPath(t, 2), randomDxPath(t, 2), randomDxPath(t, 2)
+	unhealthyPath := randomDxPath(t, 2)
+	files := []struct {
+		path       storage.DxPath
+		minSectors uint32
+		checksum   common.Hash
+	}{
+		{keepPath, 10, checksum},
+		{removePath, 10, checksum},
+		{otherECPath, 20, checksum},
+		{otherPath, 10, common.BytesToHash([]byte("other content"))},
+	}
+	// the file with no sectors uploaded yet is not healthy
+	ec, err := erasurecode.New(erasurecode.ECTypeStandard, 10, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unhealthy, err := fs.fileSet.NewDxFile(unhealthyPath, "", false, ec, ck, fileSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = unhealthy.SetChecksum(checksum); err != nil {
+		t.Fatal(err)
+	}
+	if err = unhealthy.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		df, err := fs.fileSet.NewRandomDxFile(file.path, file.minSectors, 30, erasurecode.ECTypeStandard, ck, fileSize, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = df.SetChecksum(file.checksum); err != nil {
+			t.Fatal(err)
+		}
+		if err = df.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the files with identical content are detected
+	duplicates, err := api.DuplicateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPaths := []string{keepPath.Path, removePath.Path, otherECPath.Path, unhealthyPath.Path}
+	sort.Strings(expectPaths)
+	if len(duplicates) != 1 || duplicates[0].Checksum != checksum || duplicates[0].FileSize != fileSize ||
+		!reflect.DeepEqual(duplicates[0].Paths, expectPaths) {
+		t.Fatalf("unexpected duplicate files: %+v", duplicates)
+	}
+
+	// the files with different erasure params or different content are not merged
+	if res := api.MergeDuplicate(keepPath.Path, otherECPath.Path); !strings.Contains(res, "different params") {
+		t.Errorf("unexpected response message: %v", res)
+	}
+	if res := api.MergeDuplicate(keepPath.Path, otherPath.Path); !strings.Contains(res, "not identical") {
+		t.Errorf("unexpected response message: %v", res)
+	}
+	if !fs.fileSet.Exists(otherECPath) || !fs.fileSet.Exists(otherPath) {
+		t.Fatalf("the files not mergeable are removed")
+	}
+
+	// the healthy file is not merged into the unhealthy file
+	if res := api.MergeDuplicate(unhealthyPath.Path, removePath.Path); !strings.Contains(res, "not recoverable") {
+		t.Errorf("unexpected response message: %v", res)
+	}
+	if !fs.fileSet.Exists(removePath) {
+		t.Fatalf("the file merged into an unhealthy file is removed")
+	}
+
+	// the duplicate is removed after merge
+	if res := api.MergeDuplicate(keepPath.Path, removePath.Path); !strings.Contains(res, "merged") {
+		t.Fatalf("unexpected response message: %v", res)
+	}
+	if fs.fileSet.Exists(removePath) {
+		t.Errorf("the merged file still exists")
+	}
+	if !fs.fileSet.Exists(keepPath) {
+		t.Errorf("the kept file is removed")
+	}
+	if err := fs.waitForUpdatesComplete(1 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if duplicates, err = api.DuplicateFiles(); err != nil {
+		t.Fatal(err)
+	}
+	expectPaths = []string{keepPath.Path, otherECPath.Path, unhealthyPath.Path}
+	sort.Strings(expectPaths)
+	if len(duplicates) != 1 || !reflect.DeepEqual(duplicates[0].Paths, expectPaths) {
+		t.Errorf("unexpected duplicate files after merge: %+v", duplicates)
+	}
+}
+
+// TestPublicFileSystemAPI_FilesOnHost test the files with sectors on the host are reported with
+// the health projected after losing the sectors on the host
+func TestPublicFileSystemAPI_FilesOnHost(t *testing.T) {
+	hosts := []enode.ID{{1}, {2}, {3}}
+	table := make(storage.HostHealthInfoTable)
+	for _, id := range hosts {
+		table[id] = storage.HostHealthInfo{GoodForRenew: true}
+	}
+	fs := newEmptyTestFileSystem(t, "", &fixedTableContractManager{table}, newStandardDisrupter())
+	api := NewPublicFileSystemAPI(fs)
+	ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := erasurecode.New(erasurecode.ECTypeStandard, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		path            storage.DxPath
+		sectorHosts     []enode.ID
+		onHost          bool
+		projectedHealth uint32
+	}{
+		{randomDxPath(t, 2), []enode.ID{hosts[0], hosts[1]}, true, 100},
+		{randomDxPath(t, 2), []enode.ID{hosts[0], hosts[0]}, true, 0},
+		{randomDxPath(t, 2), []enode.ID{hosts[1], hosts[2]}, false, 200},
+	}
+	var expect []storage.FileOnHost
+	for _, file := range files {
+		df, err := fs.fileSet.NewDxFile(file.path, "", false, ec, ck, 1<<22, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for segmentIndex := 0; segmentIndex != df.NumSegments(); segmentIndex++ {
+			for sectorIndex, id := range file.sectorHosts {
+				if err = df.AddSector(id, common.Hash{}, segmentIndex, sectorIndex); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err = df.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if file.onHost {
+			expect = append(expect, storage.FileOnHost{Path: file.path.Path, Health: 200, ProjectedHealth: file.projectedHealth})
+		}
+	}
+	sort.Slice(expect, func(i, j int) bool { return expect[i].Path < expect[j].Path })
+
+	got, err := api.FilesOnHost(hex.EncodeToString(hosts[0].Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("files on host not expected.\n\tGot %+v\n\tExpect %+v", got, expect)
+	}
+	if _, err = api.FilesOnHost("not a host id"); err == nil {
+		t.Error("invalid host id shall be rejected")
+	}
+}
+
+// fixedTableContractManager is the contractManager reporting the host health of the fixed table
+type fixedTableContractManager struct {
+	table storage.HostHealthInfoTable
+}
+
+func (c *fixedTableContractManager) HostHealthMapByID(ids []enode.ID) storage.HostHealthInfoTable {
+	table := make(storage.HostHealthInfoTable)
+	for _, id := range ids {
+		if info, exist := c.table[id]; exist {
+			table[id] = info
+		}
+	}
+	return table
+}
+
+func (c *fixedTableContractManager) HostHealthMap() storage.HostHealthInfoTable {
+	return c.table
+}
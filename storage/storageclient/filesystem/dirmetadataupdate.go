@@ -464,21 +464,22 @@ func (fs *fileSystem) calculateDxFileMetadata(path storage.DxPath, filename stri
 	}
 	defer file.Close()
 
-	// Get the healthInfoMap, mark all healthy as unstuck, and then calculate the health
+	// Get the healthInfoMap, mark the stuck segments and update TimeLastHealthCheck in one
+	// batch, and then calculate the health
 	healthInfoTable := fs.contractManager.HostHealthMapByID(file.HostIDs())
-	if err = file.MarkAllUnhealthySegmentsAsStuck(healthInfoTable); err != nil {
-		return nil, fmt.Errorf("cannot mark stuck segments for file %v: %v", fileDxPath.Path, err)
-	}
-	if err = file.MarkAllHealthySegmentsAsUnstuck(healthInfoTable); err != nil {
-		return nil, fmt.Errorf("cannot mark unstuck segments for file %v: %v", fileDxPath.Path, err)
+	err = file.BatchUpdate(func(b *dxfile.Batch) error {
+		b.MarkAllUnhealthySegmentsAsStuck(healthInfoTable)
+		b.MarkAllHealthySegmentsAsUnstuck(healthInfoTable)
+		b.SetTimeLastHealthCheck(time.Now())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot update the health check of file %v: %v", fileDxPath.Path, err)
 	}
 	health, stuckHealth, numStuckSegments := file.Health(healthInfoTable)
 	redundancy := file.Redundancy(healthInfoTable)
+	fs.runHealthCheckHook(fileDxPath, redundancy)
 
-	// Update TimeLastHealthCheck
-	if err := file.SetTimeLastHealthCheck(time.Now()); err != nil {
-		return nil, fmt.Errorf("cannot SetTimeLastHealthCheck for file %v: %v", fileDxPath.Path, err)
-	}
 	cachedMetadata := dxfile.CachedHealthMetadata{
 		Health:      health,
 		StuckHealth: stuckHealth,
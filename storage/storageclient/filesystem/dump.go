@@ -0,0 +1,27 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package filesystem
+
+import (
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// DumpDxFile returns the diagnostic dump of the metadata, host table, and sectors of the file
+// specified by the path. The cipher key of the file is not included in the dump
+func (fs *fileSystem) DumpDxFile(path storage.DxPath) (dxfile.FileDump, error) {
+	if err := fs.tm.Add(); err != nil {
+		return dxfile.FileDump{}, err
+	}
+	defer fs.tm.Done()
+
+	file, err := fs.fileSet.Open(path)
+	if err != nil {
+		return dxfile.FileDump{}, err
+	}
+	defer file.Close()
+
+	return file.Dump()
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// FindDuplicateFiles returns the groups of DxFiles with identical content, which is detected by
+// the checksum of the content and the file size. The files without checksum are not included
+func (fs *fileSystem) FindDuplicateFiles() ([]storage.DuplicateFiles, error) {
+	if err := fs.tm.Add(); err != nil {
+		return nil, err
+	}
+	defer fs.tm.Done()
+
+	type content struct {
+		checksum common.Hash
+		fileSize uint64
+	}
+	groups := make(map[content][]string)
+	err := fs.walkFiles(func(file *dxfile.FileSetEntryWithID) error {
+		checksum := file.Checksum()
+		if checksum == (common.Hash{}) {
+			return nil
+		}
+		key := content{checksum, file.FileSize()}
+		groups[key] = append(groups[key], file.DxPath().Path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicates []storage.DuplicateFiles
+	for key, paths := range groups {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		duplicates = append(duplicates, storage.DuplicateFiles{
+			Checksum: key.checksum,
+			FileSize: key.fileSize,
+			Paths:    paths,
+		})
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Paths[0] < duplicates[j].Paths[0]
+	})
+	return duplicates, nil
+}
+
+// MergeDuplicate merges the DxFile at remove into the DxFile at keep with identical content.
+// The DxFile at remove is deleted, thus its sectors are no longer repaired, and the storage on
+// the hosts is reclaimed when the contracts storing them are not renewed. The files are not
+// mergeable if the content differs or they are not erasure coded with the same params, and the
+// DxFile at remove is not deleted unless the DxFile at keep is recoverable and at least as healthy
+func (fs *fileSystem) MergeDuplicate(keep, remove storage.DxPath) error {
+	if err := fs.tm.Add(); err != nil {
+		return err
+	}
+	defer fs.tm.Done()
+
+	if keep.Path == remove.Path {
+		return errors.New("cannot merge a file into itself")
+	}
+	keepFile, err := fs.fileSet.Open(keep)
+	if err != nil {
+		return fmt.Errorf("cannot open file %v: %v", keep.Path, err)
+	}
+	defer keepFile.Close()
+	removeFile, err := fs.fileSet.Open(remove)
+	if err != nil {
+		return fmt.Errorf("cannot open file %v: %v", remove.Path, err)
+	}
+	err = checkMergeable(keepFile, removeFile)
+	if err == nil {
+		err = fs.checkMergeHealth(keepFile, removeFile)
+	}
+	if closeErr := removeFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return fs.fileSet.Delete(remove)
+}
+
+// checkMergeHealth checks whether the file at keep is healthy enough to replace the file at remove,
+// so that removing the duplicate does not make the content less available
+func (fs *fileSystem) checkMergeHealth(keep, remove *dxfile.FileSetEntryWithID) error {
+	keepHealth := fs.minFileHealth(keep)
+	if keepHealth < dxfile.StuckThreshold {
+		return fmt.Errorf("file %v is not recoverable with health %v", keep.DxPath().Path, keepHealth)
+	}
+	if removeHealth := fs.minFileHealth(remove); keepHealth < removeHealth {
+		return fmt.Errorf("file %v with health %v is less healthy than %v with health %v",
+			keep.DxPath().Path, keepHealth, remove.DxPath().Path, removeHealth)
+	}
+	return nil
+}
+
+// minFileHealth returns the health of the least healthy segment of the file, stuck or not
+func (fs *fileSystem) minFileHealth(file *dxfile.FileSetEntryWithID) uint32 {
+	health, stuckHealth, _ := file.Health(fs.contractManager.HostHealthMapByID(file.HostIDs()))
+	if stuckHealth < health {
+		return stuckHealth
+	}
+	return health
+}
+
+// checkMergeable checks whether the two files have identical content and are erasure coded with
+// the same params, so that one of them could be removed without losing anything
+func checkMergeable(keep, remove *dxfile.FileSetEntryWithID) error {
+	checksum := keep.Checksum()
+	if checksum == (common.Hash{}) || remove.Checksum() == (common.Hash{}) {
+		return errors.New("the content checksum of the files is unknown")
+	}
+	if checksum != remove.Checksum() || keep.FileSize() != remove.FileSize() {
+		return errors.New("the content of the files is not identical")
+	}
+	keepEC, err := keep.ErasureCode()
+	if err != nil {
+		return err
+	}
+	removeEC, err := remove.ErasureCode()
+	if err != nil {
+		return err
+	}
+	if keepEC.Type() != removeEC.Type() || keepEC.MinSectors() != removeEC.MinSectors() ||
+		keepEC.NumSectors() != removeEC.NumSectors() || !reflect.DeepEqual(keepEC.Extra(), removeEC.Extra()) {
+		return fmt.Errorf("the files are erasure coded with different params: %v/%v and %v/%v",
+			keepEC.MinSectors(), keepEC.NumSectors(), removeEC.MinSectors(), removeEC.NumSectors())
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/DxChainNetwork/godx/common/writeaheadlog"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// PersistBackend is the storage the DxFile is persisted to. The DxFile is laid out in pages
+// of PageSize, and is persisted as a blob named by the file path. The metadata, host table and
+// each segment start at a page boundary, thus are read and written as page-addressed chunks.
+type PersistBackend interface {
+	// Open open the blob to read. The blob is kept open until the BlobReader is closed, so
+	// that the blob is not opened again for each page. os.ErrNotExist is returned if the blob
+	// does not exist
+	Open(name string) (BlobReader, error)
+
+	// Apply apply the updates atomically, that either all or none of the updates are persisted.
+	// The insert updates write the data at the page aligned offset of the blob, creating the blob
+	// if not exist, and the delete updates delete the blob. Deleting a blob not exist is not an
+	// error
+	Apply(updates []storage.FileUpdate) error
+
+	// List list the names of all blobs persisted under the directory
+	List(dir string) ([]string, error)
+}
+
+// BlobReader reads the blob opened from the PersistBackend page by page
+type BlobReader interface {
+	// ReadPage read the page at the page index of the blob. The last page of the blob could
+	// be shorter than PageSize. io.EOF is returned if the page is beyond the blob
+	ReadPage(page uint64) ([]byte, error)
+
+	// Close close the blob
+	Close() error
+}
+
+// localBackend is the default PersistBackend which persists the DxFile as a file on local
+// disk. The updates are applied within the write ahead log transaction
+type localBackend struct {
+	wal *writeaheadlog.Wal
+}
+
+// NewLocalBackend create the PersistBackend persisting the DxFile on local disk with the wal
+func NewLocalBackend(wal *writeaheadlog.Wal) PersistBackend {
+	return &localBackend{wal: wal}
+}
+
+// Open open the file to read
+func (lb *localBackend) Open(name string) (BlobReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &localBlobReader{f}, nil
+}
+
+// Apply apply all updates in one wal transaction. The directories of the files are created
+// if not exist
+func (lb *localBackend) Apply(updates []storage.FileUpdate) error {
+	for _, up := range updates {
+		if iu, ok := up.(*storage.InsertUpdate); ok {
+			if err := os.MkdirAll(filepath.Dir(iu.FileName), 0700); err != nil {
+				return err
+			}
+		}
+	}
+	return storage.ApplyUpdates(lb.wal, updates)
+}
+
+// List list the files under the directory recursively
+func (lb *localBackend) List(dir string) (names []string, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			names = append(names, path)
+		}
+		return nil
+	})
+	return
+}
+
+// localBlobReader is the BlobReader of the local file
+type localBlobReader struct {
+	f *os.File
+}
+
+// ReadPage read the page at the page index of the file
+func (lr *localBlobReader) ReadPage(page uint64) ([]byte, error) {
+	data := make([]byte, PageSize)
+	n, err := lr.f.ReadAt(data, int64(page*PageSize))
+	if n == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// Close close the file
+func (lr *localBlobReader) Close() error {
+	return lr.f.Close()
+}
+
+// walOf returns the wal of the local backend. For other backends, nil is returned
+func walOf(backend PersistBackend) *writeaheadlog.Wal {
+	if lb, ok := backend.(*localBackend); ok {
+		return lb.wal
+	}
+	return nil
+}
+
+// applyUpdates apply the updates to the persist backend atomically
+func (df *DxFile) applyUpdates(updates []storage.FileUpdate) error {
+	for _, up := range updates {
+		if iu, ok := up.(*storage.InsertUpdate); ok && iu.Offset%PageSize != 0 {
+			return fmt.Errorf("update offset %d not divisible by page size", iu.Offset)
+		}
+	}
+	return df.backend.Apply(updates)
+}
+
+// blobExists returns whether the blob with the name exists in the backend
+func blobExists(backend PersistBackend, name string) bool {
+	blob, err := backend.Open(name)
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	blob.Close()
+	return true
+}
+
+// pageReader is the io.ReadSeeker reading the blob from the backend page by page
+type pageReader struct {
+	blob   BlobReader
+	offset uint64
+
+	// the page last read is cached
+	page     []byte
+	pageNum  uint64
+	pageRead bool
+}
+
+// newPageReader open the blob with name from the backend, and create a pageReader reading the
+// blob. The pageReader shall be closed after use
+func newPageReader(backend PersistBackend, name string) (*pageReader, error) {
+	blob, err := backend.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pageReader{blob: blob}, nil
+}
+
+// Close close the blob read
+func (pr *pageReader) Close() error {
+	return pr.blob.Close()
+}
+
+// Read read the data from the current offset
+func (pr *pageReader) Read(b []byte) (int, error) {
+	var read int
+	for read < len(b) {
+		pageNum, pageOffset := pr.offset/PageSize, pr.offset%PageSize
+		if !pr.pageRead || pr.pageNum != pageNum {
+			page, err := pr.blob.ReadPage(pageNum)
+			if err == io.EOF && read > 0 {
+				return read, nil
+			}
+			if err != nil {
+				return read, err
+			}
+			pr.page, pr.pageNum, pr.pageRead = page, pageNum, true
+		}
+		if pageOffset >= uint64(len(pr.page)) {
+			if read > 0 {
+				return read, nil
+			}
+			return 0, io.EOF
+		}
+		n := copy(b[read:], pr.page[pageOffset:])
+		read += n
+		pr.offset += uint64(n)
+	}
+	return read, nil
+}
+
+// Seek set the offset for the next Read
+func (pr *pageReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = int64(pr.offset) + offset
+	default:
+		return 0, errors.New("unsupported seek whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative seek offset")
+	}
+	pr.offset = uint64(abs)
+	return abs, nil
+}
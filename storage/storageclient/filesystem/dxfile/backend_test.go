@@ -0,0 +1,175 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// memoryBackend is the PersistBackend keeping the blobs in memory
+type memoryBackend struct {
+	blobs map[string][]byte
+	lock  sync.Mutex
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{blobs: make(map[string][]byte)}
+}
+
+func (mb *memoryBackend) Open(name string) (BlobReader, error) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	if _, exist := mb.blobs[name]; !exist {
+		return nil, os.ErrNotExist
+	}
+	return &memoryBlobReader{mb: mb, name: name}, nil
+}
+
+func (mb *memoryBackend) Apply(updates []storage.FileUpdate) error {
+	for _, up := range updates {
+		switch up.(type) {
+		case *storage.InsertUpdate, *storage.DeleteUpdate:
+		default:
+			return errors.New("unknown update type")
+		}
+	}
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	for _, up := range updates {
+		switch up := up.(type) {
+		case *storage.InsertUpdate:
+			blob := mb.blobs[up.FileName]
+			end := up.Offset + uint64(len(up.Data))
+			if end > uint64(len(blob)) {
+				blob = append(blob, make([]byte, end-uint64(len(blob)))...)
+			}
+			copy(blob[up.Offset:], up.Data)
+			mb.blobs[up.FileName] = blob
+		case *storage.DeleteUpdate:
+			delete(mb.blobs, up.FileName)
+		}
+	}
+	return nil
+}
+
+func (mb *memoryBackend) List(dir string) ([]string, error) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	var names []string
+	for name := range mb.blobs {
+		if strings.HasPrefix(name, dir) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// memoryBlobReader is the BlobReader of the blob in memoryBackend
+type memoryBlobReader struct {
+	mb   *memoryBackend
+	name string
+}
+
+func (mr *memoryBlobReader) ReadPage(page uint64) ([]byte, error) {
+	mr.mb.lock.Lock()
+	defer mr.mb.lock.Unlock()
+	blob, exist := mr.mb.blobs[mr.name]
+	if !exist {
+		return nil, os.ErrNotExist
+	}
+	start := page * PageSize
+	if start >= uint64(len(blob)) {
+		return nil, io.EOF
+	}
+	end := start + PageSize
+	if end > uint64(len(blob)) {
+		end = uint64(len(blob))
+	}
+	return append([]byte{}, blob[start:end]...), nil
+}
+
+func (mr *memoryBlobReader) Close() error {
+	return nil
+}
+
+// TestPersistBackend test the DxFile written to the in-memory backend could be reloaded, including
+// the segments shifted by a host table growing beyond its pages, and is deleted from the backend
+func TestPersistBackend(t *testing.T) {
+	backend := newMemoryBackend()
+	fs := NewFileSetWithBackend(testDir, backend)
+	ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dxPath := randomDxPath()
+	df, err := fs.NewRandomDxFile(dxPath, 10, 30, erasurecode.ECTypeStandard, ck, SectorSize*10*8, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close()
+	if _, err = os.Stat(string(df.filePath)); !os.IsNotExist(err) {
+		t.Fatalf("dxfile shall not be persisted on local disk: %v", err)
+	}
+
+	// add enough hosts for the host table to shift the segments
+	df.lock.Lock()
+	for k := range randomHostTable(PageSize / 16) {
+		df.hostTable[k] = false
+	}
+	err = df.saveHostTableUpdate()
+	df.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := readDxFileFromBackend(df.filePath, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkDxFileEqual(df.DxFile, recovered); err != nil {
+		t.Error(err)
+	}
+	// the dxfile is listed and read through the backend
+	dxPaths, err := fs.DxPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dxPaths) != 1 || dxPaths[0].Path != dxPath.Path {
+		t.Errorf("unexpected dx paths: %v", dxPaths)
+	}
+	sr, err := df.SnapshotReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata Metadata
+	err = rlp.Decode(sr, &metadata)
+	sr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkMetadataEqual(df.metadata, &metadata); err != nil {
+		t.Errorf("metadata not equal: %v", err)
+	}
+
+	if err = fs.Delete(dxPath); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Exists(dxPath) {
+		t.Error("dxfile still exists after deletion")
+	}
+	if _, err = readDxFileFromBackend(df.filePath, backend); !os.IsNotExist(err) {
+		t.Errorf("expect not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// Batch accumulates the updates of the DxFile within BatchUpdate. The updates are applied to the
+// DxFile in memory as they are made, and saved in one wal transaction after the batch function
+// returns. The Batch shall not be used after the batch function returns
+type Batch struct {
+	df *DxFile
+
+	// metadataDirty and segmentDirty are whether the metadata and any segment are updated.
+	// The segments updated are marked with the dirty flag of the segment
+	metadataDirty bool
+	segmentDirty  bool
+
+	// prevMetadata and prevStuck are the states before the batch, which are restored if the
+	// batch fails
+	prevMetadata Metadata
+	prevStuck    map[int]bool
+}
+
+// BatchUpdate calls fn with a Batch to update multiple fields of the DxFile, and save all the
+// updates in a single wal transaction. If fn returns an error or the save fails, none of the
+// updates is applied, in memory or on disk
+func (df *DxFile) BatchUpdate(fn func(b *Batch) error) (err error) {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	if df.deleted {
+		return fmt.Errorf("file %v is deleted", df.metadata.DxPath)
+	}
+	b := &Batch{
+		df:           df,
+		prevMetadata: *df.metadata,
+		prevStuck:    make(map[int]bool),
+	}
+	defer func() {
+		if err != nil {
+			b.revert()
+		}
+	}()
+	if err = fn(b); err != nil {
+		return
+	}
+	switch {
+	case b.segmentDirty:
+		err = df.saveDirty()
+	case b.metadataDirty:
+		err = df.saveMetadata()
+	}
+	return
+}
+
+// revert restores the DxFile to the states before the batch
+func (b *Batch) revert() {
+	*b.df.metadata = b.prevMetadata
+	for index, stuck := range b.prevStuck {
+		seg := b.df.segments[index]
+		seg.Stuck = stuck
+		seg.dirty = false
+	}
+}
+
+// SetLocalPath sets the local path of the file in the batch
+func (b *Batch) SetLocalPath(path storage.SysPath) {
+	b.df.metadata.LocalPath = path
+	b.metadataDirty = true
+}
+
+// SetTimeAccess sets the last access time of the file in the batch
+func (b *Batch) SetTimeAccess(t time.Time) {
+	b.df.metadata.TimeAccess = uint64(t.Unix())
+	b.metadataDirty = true
+}
+
+// SetTimeLastHealthCheck sets the time of the last health check of the file in the batch
+func (b *Batch) SetTimeLastHealthCheck(t time.Time) {
+	b.df.metadata.TimeLastHealthCheck = uint64(t.Unix())
+	b.metadataDirty = true
+}
+
+// SetTimeRecentRepair sets the time of the recent repair of the file in the batch
+func (b *Batch) SetTimeRecentRepair(t time.Time) {
+	b.df.metadata.TimeRecentRepair = uint64(t.Unix())
+	b.metadataDirty = true
+}
+
+// SetFileMode sets the os file mode of the file in the batch
+func (b *Batch) SetFileMode(mode os.FileMode) {
+	b.df.metadata.FileMode = mode
+	b.metadataDirty = true
+}
+
+// SetRenewalPolicy sets the renewal policy of the file in the batch
+func (b *Batch) SetRenewalPolicy(policy storage.RenewalPolicy) {
+	b.df.metadata.RenewalPolicy = policy
+	b.metadataDirty = true
+}
+
+// SetChecksum sets the checksum of the whole content of the file in the batch
+func (b *Batch) SetChecksum(checksum common.Hash) {
+	b.df.metadata.Checksum = checksum
+	b.metadataDirty = true
+}
+
+// SetMinSegmentHosts sets the minimum number of distinct hosts storing the sectors of a healthy
+// segment in the batch. The value cannot be larger than the number of sectors of a segment
+func (b *Batch) SetMinSegmentHosts(minHosts uint32) error {
+	if minHosts > b.df.metadata.NumSectors {
+		return fmt.Errorf("min segment hosts %v larger than the number of sectors %v", minHosts, b.df.metadata.NumSectors)
+	}
+	b.df.metadata.MinSegmentHosts = minHosts
+	b.metadataDirty = true
+	return nil
+}
+
+// SetKeyDerivation sets the derivation of the keys encrypting the sectors in the batch. The key
+// derivation can only be changed before any sector is uploaded
+func (b *Batch) SetKeyDerivation(derivation uint8) error {
+	if derivation != KeyDerivationNone && derivation != KeyDerivationSector {
+		return fmt.Errorf("unknown key derivation %v", derivation)
+	}
+	for _, segment := range b.df.segments {
+		if segment == nil {
+			continue
+		}
+		for _, sectors := range segment.Sectors {
+			if len(sectors) != 0 {
+				return errors.New("cannot change the key derivation after sectors are uploaded")
+			}
+		}
+	}
+	b.df.metadata.KeyDerivation = derivation
+	b.metadataDirty = true
+	return nil
+}
+
+// SetStuckByIndex sets the stuck status of the segment of the index in the batch
+func (b *Batch) SetStuckByIndex(index int, stuck bool) error {
+	if index < 0 || index >= len(b.df.segments) {
+		return fmt.Errorf("segment index %v out of range [0, %v)", index, len(b.df.segments))
+	}
+	b.setStuck(index, stuck)
+	return nil
+}
+
+// MarkAllUnhealthySegmentsAsStuck marks the segments with health smaller than StuckThreshold as
+// stuck in the batch
+func (b *Batch) MarkAllUnhealthySegmentsAsStuck(table storage.HostHealthInfoTable) {
+	for i := range b.df.segments {
+		if b.df.segment(i).Stuck || b.df.segmentHealth(i, table) >= StuckThreshold {
+			continue
+		}
+		b.setStuck(i, true)
+	}
+}
+
+// MarkAllHealthySegmentsAsUnstuck marks the stuck segments with health not smaller than
+// StuckThreshold as unstuck in the batch
+func (b *Batch) MarkAllHealthySegmentsAsUnstuck(table storage.HostHealthInfoTable) {
+	for i := range b.df.segments {
+		if !b.df.segment(i).Stuck || b.df.segmentHealth(i, table) < StuckThreshold {
+			continue
+		}
+		b.setStuck(i, false)
+	}
+}
+
+// setStuck sets the stuck status of the segment of the index, and records the status before
+// the batch to be restored if the batch fails
+func (b *Batch) setStuck(index int, stuck bool) {
+	if stuck == b.df.segment(index).Stuck {
+		return
+	}
+	seg := b.df.materializeSegment(index)
+	if _, exist := b.prevStuck[index]; !exist {
+		b.prevStuck[index] = seg.Stuck
+	}
+	seg.Stuck = stuck
+	seg.dirty = true
+	if stuck {
+		b.df.metadata.NumStuckSegments++
+	} else {
+		b.df.metadata.NumStuckSegments--
+	}
+	b.segmentDirty = true
+}
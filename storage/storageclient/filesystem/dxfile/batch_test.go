@@ -0,0 +1,172 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// failingBackend is the PersistBackend failing all writes
+type failingBackend struct {
+	PersistBackend
+}
+
+func (fb *failingBackend) Apply(updates []storage.FileUpdate) error {
+	return errors.New("write failed")
+}
+
+// TestDxFile_BatchUpdate test the updates in a batch are saved and could be reloaded
+func TestDxFile_BatchUpdate(t *testing.T) {
+	df, err := newTestDxFileWithSegments(t, sectorSize*10*8, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(time.Now().Unix(), 0)
+	prevNumStuck := df.metadata.NumStuckSegments
+	prevStuck := df.segments[1].Stuck
+	err = df.BatchUpdate(func(b *Batch) error {
+		b.SetTimeAccess(now)
+		b.SetTimeLastHealthCheck(now)
+		b.SetTimeRecentRepair(now)
+		b.SetLocalPath("batch")
+		return b.SetStuckByIndex(1, !prevStuck)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !df.TimeAccess().Equal(now) || !df.TimeLastHealthCheck().Equal(now) || !df.LastTimeRecentRepair().Equal(now) {
+		t.Errorf("times not updated in the batch")
+	}
+	if df.LocalPath() != "batch" {
+		t.Errorf("expect local path batch, got %v", df.LocalPath())
+	}
+	if df.GetStuckByIndex(1) == prevStuck {
+		t.Errorf("stuck of segment 1 not updated in the batch")
+	}
+	if df.metadata.NumStuckSegments == prevNumStuck {
+		t.Errorf("NumStuckSegments not updated in the batch")
+	}
+
+	path, err := storage.NewDxPath(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := readDxFile(testDir.Join(path), df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkDxFileEqual(df, recovered); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDxFile_BatchUpdate_Failed test none of the updates in a batch is applied if the batch
+// function returns an error or the save fails
+func TestDxFile_BatchUpdate_Failed(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnErr   error
+		backend func(backend PersistBackend) PersistBackend
+	}{
+		{
+			name:  "batch function error",
+			fnErr: errors.New("batch function error"),
+		},
+		{
+			name: "save error",
+			backend: func(backend PersistBackend) PersistBackend {
+				return &failingBackend{backend}
+			},
+		},
+	}
+	for _, test := range tests {
+		df, err := newTestDxFileWithSegments(t, sectorSize*10*8, 10, 30, erasurecode.ECTypeStandard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := storage.NewDxPath(t.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		original, err := readDxFile(testDir.Join(path), df.wal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevStuck := df.segments[1].Stuck
+		backend := df.backend
+		if test.backend != nil {
+			df.backend = test.backend(backend)
+		}
+		err = df.BatchUpdate(func(b *Batch) error {
+			b.SetTimeAccess(time.Unix(1, 0))
+			b.SetLocalPath("batch")
+			if err := b.SetStuckByIndex(1, !prevStuck); err != nil {
+				return err
+			}
+			return test.fnErr
+		})
+		df.backend = backend
+		if err == nil {
+			t.Fatalf("%v: expect error", test.name)
+		}
+		// Neither the DxFile in memory nor on disk is updated
+		if err = checkDxFileEqual(original, df); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+		recovered, err := readDxFile(testDir.Join(path), df.wal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = checkDxFileEqual(original, recovered); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+		}
+	}
+}
+
+// BenchmarkDxFile_PerUpdate benchmark saving each of the updates in its own wal transaction
+func BenchmarkDxFile_PerUpdate(b *testing.B) {
+	benchmarkDxFileUpdates(b, func(df *DxFile, now time.Time) error {
+		if err := df.SetTimeAccess(now); err != nil {
+			return err
+		}
+		if err := df.SetTimeLastHealthCheck(now); err != nil {
+			return err
+		}
+		if err := df.SetTimeRecentRepair(now); err != nil {
+			return err
+		}
+		return df.SetStuckByIndex(int(now.UnixNano())%len(df.segments), now.UnixNano()%2 == 0)
+	})
+}
+
+// BenchmarkDxFile_BatchUpdate benchmark saving the updates in a single wal transaction
+func BenchmarkDxFile_BatchUpdate(b *testing.B) {
+	benchmarkDxFileUpdates(b, func(df *DxFile, now time.Time) error {
+		return df.BatchUpdate(func(batch *Batch) error {
+			batch.SetTimeAccess(now)
+			batch.SetTimeLastHealthCheck(now)
+			batch.SetTimeRecentRepair(now)
+			return batch.SetStuckByIndex(int(now.UnixNano())%len(df.segments), now.UnixNano()%2 == 0)
+		})
+	})
+}
+
+func benchmarkDxFileUpdates(b *testing.B, update func(df *DxFile, now time.Time) error) {
+	df, err := newTestDxFileWithSegments(b, sectorSize*10*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = update(df, time.Now()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
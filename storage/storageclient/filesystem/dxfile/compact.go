@@ -0,0 +1,139 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"errors"
+
+	"github.com/DxChainNetwork/godx/log"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// DefaultCompactThreshold is the default number of stale entries accumulated in a DxFile
+// after which the DxFile is compacted automatically
+const DefaultCompactThreshold = 256
+
+// Compact rebuilds the DxFile with the stale entries removed. The stale entries are the hosts
+// in the host table no longer used, the sectors stored on these hosts and the duplicate sectors.
+// The DxFile is then rewritten with the segments laid out in the order of the segment index,
+// reclaiming the space of the host table and the segments shifted by a growing host table.
+// The segment indexes and the sectors on the used hosts are preserved.
+func (df *DxFile) Compact() error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	return df.compact()
+}
+
+// SetCompactThreshold set the number of stale entries after which the DxFile is compacted
+// automatically. Threshold 0 disables the automatic compaction
+func (df *DxFile) SetCompactThreshold(threshold uint64) {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	df.compactThreshold = threshold
+}
+
+// SetCompactThreshold set the threshold of the automatic compaction of all DxFiles in the
+// FileSet, including the ones already opened
+func (fs *FileSet) SetCompactThreshold(threshold uint64) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.compactThreshold = threshold
+	for _, entry := range fs.filesMap {
+		entry.SetCompactThreshold(threshold)
+	}
+}
+
+// compact compacts the DxFile. If the compacted DxFile failed to be persisted, the DxFile
+// is reverted.
+func (df *DxFile) compact() error {
+	if df.deleted {
+		return errors.New("cannot compact the file: file already deleted")
+	}
+	prevSegments, prevHostTable, prevSegmentOffset := df.segments, df.hostTable, df.metadata.SegmentOffset
+
+	df.hostTable = make(hostTable)
+	for id, used := range prevHostTable {
+		if used {
+			df.hostTable[id] = true
+		}
+	}
+	df.segments = make([]*Segment, len(prevSegments))
+	for i, seg := range prevSegments {
+		df.segments[i] = compactSegment(seg, df.hostTable)
+	}
+
+	// rewrite the whole file, so that the pages beyond the compacted file are discarded
+	du, err := df.createDeleteUpdate()
+	if err != nil {
+		df.segments, df.hostTable, df.metadata.SegmentOffset = prevSegments, prevHostTable, prevSegmentOffset
+		return err
+	}
+	updates, err := df.createAllUpdates()
+	if err == nil {
+		err = df.applyUpdates(append([]storage.FileUpdate{du}, updates...))
+	}
+	if err != nil {
+		df.segments, df.hostTable, df.metadata.SegmentOffset = prevSegments, prevHostTable, prevSegmentOffset
+		return err
+	}
+	df.clearDirty()
+	df.staleEntries = 0
+	return nil
+}
+
+// compactSegment returns a copy of the segment with only the sectors stored on the used hosts
+// in the table, and without the duplicate sectors. The segment not allocated is kept as is.
+func compactSegment(seg *Segment, table hostTable) *Segment {
+	if seg == nil {
+		return nil
+	}
+	compacted := &Segment{
+		Sectors: make([][]*Sector, len(seg.Sectors)),
+		Index:   seg.Index,
+		Stuck:   seg.Stuck,
+		offset:  seg.offset,
+	}
+	for i, sectors := range seg.Sectors {
+		for _, sector := range sectors {
+			if !table[sector.HostID] || containsSector(compacted.Sectors[i], sector) {
+				continue
+			}
+			compacted.Sectors[i] = append(compacted.Sectors[i], &Sector{
+				MerkleRoot:    sector.MerkleRoot,
+				HostID:        sector.HostID,
+				KeyGeneration: sector.KeyGeneration,
+			})
+		}
+	}
+	return compacted
+}
+
+// containsSector returns whether the sectors contains a sector with the same host and root
+func containsSector(sectors []*Sector, sector *Sector) bool {
+	for _, s := range sectors {
+		if s.HostID == sector.HostID && s.MerkleRoot == sector.MerkleRoot {
+			return true
+		}
+	}
+	return false
+}
+
+// addStaleEntries records the stale entries newly added, and compacts the DxFile if the
+// stale entries reach the threshold. Failure of the compaction is not fatal, since the stale
+// entries only waste space.
+//
+// NOTE: This should be called with df.lock locked.
+func (df *DxFile) addStaleEntries(num uint64) {
+	df.staleEntries += num
+	if df.compactThreshold == 0 || df.staleEntries < df.compactThreshold {
+		return
+	}
+	if err := df.compact(); err != nil {
+		log.Warn("failed to compact dxfile", "dxpath", df.metadata.DxPath.Path, "error", err)
+	}
+}
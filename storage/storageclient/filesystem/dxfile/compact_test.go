@@ -0,0 +1,147 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// TestCompact test that after the host table grows, duplicate sectors are added and hosts are
+// no longer used, the compaction removes the stale entries, lays out the segments in index
+// order, and preserves the sectors on the used hosts
+func TestCompact(t *testing.T) {
+	backend := newMemoryBackend()
+	fs := NewFileSetWithBackend(testDir, backend)
+	fs.SetCompactThreshold(0)
+	ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	df, err := fs.NewRandomDxFile(randomDxPath(), 10, 30, erasurecode.ECTypeStandard, ck, SectorSize*10*8, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close()
+
+	// the host table grows beyond its pages, and the segments are shifted
+	df.lock.Lock()
+	for k := range randomHostTable(PageSize / 16) {
+		df.hostTable[k] = false
+	}
+	err = df.saveHostTableUpdate()
+	df.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the repair adds a duplicate sector
+	segmentIndex, sectorIndex, dup := findSector(t, df.DxFile)
+	if err = df.AddSector(dup.HostID, dup.MerkleRoot, segmentIndex, sectorIndex); err != nil {
+		t.Fatal(err)
+	}
+	// half of the hosts storing sectors are no longer used
+	usedTable := make(hostTable)
+	var used []enode.ID
+	df.lock.RLock()
+	var i int
+	for id, inUse := range df.hostTable {
+		if inUse && (i%2 == 0 || id == dup.HostID) {
+			usedTable[id] = true
+			used = append(used, id)
+		}
+		i++
+	}
+	df.lock.RUnlock()
+	if err = df.UpdateUsedHosts(used); err != nil {
+		t.Fatal(err)
+	}
+
+	// the expected segments only have the sectors on the used hosts without duplicates
+	df.lock.RLock()
+	expect := make([][][]Sector, len(df.segments))
+	for i, seg := range df.segments {
+		expect[i] = make([][]Sector, len(seg.Sectors))
+		for j, sectors := range seg.Sectors {
+			seen := make(map[Sector]bool)
+			for _, sector := range sectors {
+				if usedTable[sector.HostID] && !seen[*sector] {
+					seen[*sector] = true
+					expect[i][j] = append(expect[i][j], *sector)
+				}
+			}
+		}
+	}
+	df.lock.RUnlock()
+	prevSize := len(backend.blobs[string(df.filePath)])
+
+	if err = df.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if size := len(backend.blobs[string(df.filePath)]); size >= prevSize {
+		t.Errorf("space not reclaimed: %v -> %v", prevSize, size)
+	}
+	if !reflect.DeepEqual(df.hostTable, usedTable) {
+		t.Errorf("host table not expected.\n\tGot %v\n\tExpect %v", df.hostTable, usedTable)
+	}
+	segmentSize := PageSize * segmentPersistNumPages(df.metadata.NumSectors)
+	for i, seg := range df.segments {
+		if seg.Index != uint64(i) {
+			t.Fatalf("segment %d has index %d", i, seg.Index)
+		}
+		if seg.offset != df.metadata.SegmentOffset+uint64(i)*segmentSize {
+			t.Errorf("segment %d not laid out in index order", i)
+		}
+		for j, sectors := range seg.Sectors {
+			var got []Sector
+			for _, sector := range sectors {
+				got = append(got, *sector)
+			}
+			if !reflect.DeepEqual(got, expect[i][j]) {
+				t.Errorf("segment %d sector %d not expected.\n\tGot %v\n\tExpect %v", i, j, got, expect[i][j])
+			}
+		}
+	}
+
+	// the compacted file is persisted
+	recovered, err := readDxFileFromBackend(df.filePath, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkDxFileEqual(df.DxFile, recovered); err != nil {
+		t.Error(err)
+	}
+
+	// the duplicate sector is compacted automatically once the threshold is reached
+	df.SetCompactThreshold(1)
+	if err = df.AddSector(dup.HostID, dup.MerkleRoot, segmentIndex, sectorIndex); err != nil {
+		t.Fatal(err)
+	}
+	sectors, err := df.Sectors(segmentIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sectors[sectorIndex]) != len(expect[segmentIndex][sectorIndex]) {
+		t.Errorf("duplicate sector not compacted: %v sectors", len(sectors[sectorIndex]))
+	}
+}
+
+// findSector returns the location and the content of a sector in the DxFile
+func findSector(t *testing.T, df *DxFile) (int, int, Sector) {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+	for i, seg := range df.segments {
+		for j, sectors := range seg.Sectors {
+			if len(sectors) != 0 {
+				return i, j, *sectors[0]
+			}
+		}
+	}
+	t.Fatal("no sector in dxfile")
+	return 0, 0, Sector{}
+}
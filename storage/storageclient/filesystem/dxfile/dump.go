@@ -0,0 +1,188 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+)
+
+type (
+	// FileDump is the diagnostic dump of the complete internal state of a DxFile. The cipher
+	// key is redacted, and only the type of the cipher is reported
+	FileDump struct {
+		ID              string      `json:"id"`
+		DxPath          string      `json:"dxpath"`
+		LocalPath       string      `json:"localPath"`
+		FileSize        uint64      `json:"fileSize"`
+		SectorSize      uint64      `json:"sectorSize"`
+		CipherType      string      `json:"cipherType"`
+		KeyDerivation   uint8       `json:"keyDerivation"`
+		KeyGeneration   uint8       `json:"keyGeneration"`
+		ErasureCodeType uint8       `json:"erasureCodeType"`
+		MinSectors      uint32      `json:"minSectors"`
+		NumSectors      uint32      `json:"numSectors"`
+		FileMode        string      `json:"fileMode"`
+		RenewalPolicy   string      `json:"renewalPolicy"`
+		MinSegmentHosts uint32      `json:"minSegmentHosts"`
+		Checksum        common.Hash `json:"checksum"`
+		Version         string      `json:"version"`
+
+		Health              uint32    `json:"health"`
+		StuckHealth         uint32    `json:"stuckHealth"`
+		NumStuckSegments    uint32    `json:"numStuckSegments"`
+		LastRedundancy      uint32    `json:"lastRedundancy"`
+		TimeCreate          time.Time `json:"timeCreate"`
+		TimeModify          time.Time `json:"timeModify"`
+		TimeUpdate          time.Time `json:"timeUpdate"`
+		TimeAccess          time.Time `json:"timeAccess"`
+		TimeLastHealthCheck time.Time `json:"timeLastHealthCheck"`
+		TimeRecentRepair    time.Time `json:"timeRecentRepair"`
+
+		HostTable []HostDump    `json:"hostTable"`
+		Segments  []SegmentDump `json:"segments"`
+	}
+
+	// HostDump is a host in the host table of the DxFile, and whether the host is used
+	HostDump struct {
+		HostID string `json:"hostID"`
+		Used   bool   `json:"used"`
+	}
+
+	// SegmentDump is a segment of the DxFile with the sectors assigned to the hosts. Each entry
+	// of Sectors is the list of the sectors recorded at the sector index
+	SegmentDump struct {
+		Index   uint64         `json:"index"`
+		Stuck   bool           `json:"stuck"`
+		Sectors [][]SectorDump `json:"sectors"`
+	}
+
+	// SectorDump is a sector stored on a host, and the generation of the cipher key encrypting it
+	SectorDump struct {
+		MerkleRoot    common.Hash `json:"merkleRoot"`
+		HostID        string      `json:"hostID"`
+		KeyGeneration uint8       `json:"keyGeneration"`
+	}
+)
+
+// Dump returns the diagnostic dump of the DxFile. All fields are copied within a single lock,
+// so that the dump is a consistent snapshot of the DxFile
+func (df *DxFile) Dump() (FileDump, error) {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	if df.deleted {
+		return FileDump{}, fmt.Errorf("file has been deleted")
+	}
+	ck, err := df.getCipherKey()
+	if err != nil {
+		return FileDump{}, err
+	}
+	md := df.metadata
+	dump := FileDump{
+		ID:              hex.EncodeToString(md.ID[:]),
+		DxPath:          md.DxPath.Path,
+		LocalPath:       string(md.LocalPath),
+		FileSize:        md.FileSize,
+		SectorSize:      md.SectorSize,
+		CipherType:      ck.CodeName(),
+		KeyDerivation:   md.KeyDerivation,
+		KeyGeneration:   md.keyGeneration(),
+		ErasureCodeType: md.ErasureCodeType,
+		MinSectors:      md.MinSectors,
+		NumSectors:      md.NumSectors,
+		FileMode:        md.FileMode.String(),
+		RenewalPolicy:   md.RenewalPolicy.String(),
+		MinSegmentHosts: md.MinSegmentHosts,
+		Checksum:        md.Checksum,
+		Version:         md.Version,
+
+		Health:              md.Health,
+		StuckHealth:         md.StuckHealth,
+		NumStuckSegments:    md.NumStuckSegments,
+		LastRedundancy:      md.LastRedundancy,
+		TimeCreate:          time.Unix(int64(md.TimeCreate), 0),
+		TimeModify:          time.Unix(int64(md.TimeModify), 0),
+		TimeUpdate:          time.Unix(int64(md.TimeUpdate), 0),
+		TimeAccess:          time.Unix(int64(md.TimeAccess), 0),
+		TimeLastHealthCheck: time.Unix(int64(md.TimeLastHealthCheck), 0),
+		TimeRecentRepair:    time.Unix(int64(md.TimeRecentRepair), 0),
+	}
+
+	dump.HostTable = make([]HostDump, 0, len(df.hostTable))
+	for id, used := range df.hostTable {
+		dump.HostTable = append(dump.HostTable, HostDump{HostID: id.String(), Used: used})
+	}
+	sort.Slice(dump.HostTable, func(i, j int) bool { return dump.HostTable[i].HostID < dump.HostTable[j].HostID })
+
+	dump.Segments = make([]SegmentDump, 0, len(df.segments))
+	for i := range df.segments {
+		seg := df.segment(i)
+		segDump := SegmentDump{
+			Index:   seg.Index,
+			Stuck:   seg.Stuck,
+			Sectors: make([][]SectorDump, len(seg.Sectors)),
+		}
+		for j, sectors := range seg.Sectors {
+			segDump.Sectors[j] = make([]SectorDump, 0, len(sectors))
+			for _, sector := range sectors {
+				segDump.Sectors[j] = append(segDump.Sectors[j], SectorDump{
+					MerkleRoot:    sector.MerkleRoot,
+					HostID:        sector.HostID.String(),
+					KeyGeneration: sector.KeyGeneration,
+				})
+			}
+		}
+		dump.Segments = append(dump.Segments, segDump)
+	}
+	return dump, nil
+}
+
+// String returns the human-readable form of the dump
+func (dump FileDump) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "DxFile %v (id %v)\n", dump.DxPath, dump.ID)
+	fmt.Fprintf(&buf, "  local path:        %v\n", dump.LocalPath)
+	fmt.Fprintf(&buf, "  file size:         %v\n", dump.FileSize)
+	fmt.Fprintf(&buf, "  sector size:       %v\n", dump.SectorSize)
+	fmt.Fprintf(&buf, "  cipher:            %v (key redacted, derivation %v, generation %v)\n", dump.CipherType, dump.KeyDerivation, dump.KeyGeneration)
+	fmt.Fprintf(&buf, "  erasure code:      type %v, %v/%v sectors\n", dump.ErasureCodeType, dump.MinSectors, dump.NumSectors)
+	fmt.Fprintf(&buf, "  file mode:         %v\n", dump.FileMode)
+	fmt.Fprintf(&buf, "  renewal policy:    %v\n", dump.RenewalPolicy)
+	fmt.Fprintf(&buf, "  min segment hosts: %v\n", dump.MinSegmentHosts)
+	fmt.Fprintf(&buf, "  checksum:          %v\n", dump.Checksum.Hex())
+	fmt.Fprintf(&buf, "  version:           %v\n", dump.Version)
+	fmt.Fprintf(&buf, "  health:            %v (stuck %v, %v stuck segments, redundancy %v)\n", dump.Health, dump.StuckHealth, dump.NumStuckSegments, dump.LastRedundancy)
+	fmt.Fprintf(&buf, "  created:           %v\n", dump.TimeCreate)
+	fmt.Fprintf(&buf, "  modified:          %v\n", dump.TimeModify)
+	fmt.Fprintf(&buf, "  updated:           %v\n", dump.TimeUpdate)
+	fmt.Fprintf(&buf, "  accessed:          %v\n", dump.TimeAccess)
+	fmt.Fprintf(&buf, "  health checked:    %v\n", dump.TimeLastHealthCheck)
+	fmt.Fprintf(&buf, "  repaired:          %v\n", dump.TimeRecentRepair)
+
+	fmt.Fprintf(&buf, "Hosts (%v):\n", len(dump.HostTable))
+	for _, host := range dump.HostTable {
+		fmt.Fprintf(&buf, "  %v used=%v\n", host.HostID, host.Used)
+	}
+	fmt.Fprintf(&buf, "Segments (%v):\n", len(dump.Segments))
+	for _, seg := range dump.Segments {
+		fmt.Fprintf(&buf, "  segment %v stuck=%v\n", seg.Index, seg.Stuck)
+		for i, sectors := range seg.Sectors {
+			if len(sectors) == 0 {
+				fmt.Fprintf(&buf, "    sector %v: missing\n", i)
+				continue
+			}
+			for _, sector := range sectors {
+				fmt.Fprintf(&buf, "    sector %v: root %v host %v key generation %v\n", i, sector.MerkleRoot.Hex(), sector.HostID, sector.KeyGeneration)
+			}
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// TestDxFile_Dump test the dump of a DxFile contains the segments, sectors and host assignments
+// of the file, while omitting the cipher key
+func TestDxFile_Dump(t *testing.T) {
+	df, err := newTestDxFile(t, sectorSize*2*2, 2, 3, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numSegments := int(df.metadata.numSegments())
+	hosts := []Sector{{HostID: randomAddress(), MerkleRoot: randomHash()}, {HostID: randomAddress(), MerkleRoot: randomHash()}}
+	if err = df.AddSector(hosts[0].HostID, hosts[0].MerkleRoot, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = df.AddSector(hosts[1].HostID, hosts[1].MerkleRoot, numSegments-1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = df.SetStuckByIndex(numSegments-1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := df.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dump.DxPath != df.metadata.DxPath.Path || dump.FileSize != df.metadata.FileSize {
+		t.Errorf("unexpected metadata in the dump: %v %v", dump.DxPath, dump.FileSize)
+	}
+	if len(dump.Segments) != numSegments {
+		t.Fatalf("expect %v segments, got %v", numSegments, len(dump.Segments))
+	}
+	for i, seg := range dump.Segments {
+		if seg.Index != uint64(i) || len(seg.Sectors) != int(df.metadata.NumSectors) {
+			t.Errorf("unexpected segment %v: index %v, %v sectors", i, seg.Index, len(seg.Sectors))
+		}
+		if seg.Stuck != (i == numSegments-1) {
+			t.Errorf("segment %v: expect stuck %v, got %v", i, i == numSegments-1, seg.Stuck)
+		}
+	}
+	checkSector := func(segmentIndex, sectorIndex int, expect Sector) {
+		sectors := dump.Segments[segmentIndex].Sectors[sectorIndex]
+		if len(sectors) != 1 {
+			t.Fatalf("segment %v sector %v: expect 1 sector, got %v", segmentIndex, sectorIndex, len(sectors))
+		}
+		if sectors[0].MerkleRoot != expect.MerkleRoot || sectors[0].HostID != expect.HostID.String() {
+			t.Errorf("segment %v sector %v: unexpected sector %+v", segmentIndex, sectorIndex, sectors[0])
+		}
+	}
+	checkSector(0, 1, hosts[0])
+	checkSector(numSegments-1, 2, hosts[1])
+	if len(dump.Segments[0].Sectors[0]) != 0 {
+		t.Errorf("unexpected sector in the dump of an empty sector slot")
+	}
+	if len(dump.HostTable) != len(hosts) {
+		t.Fatalf("expect %v hosts, got %v", len(hosts), len(dump.HostTable))
+	}
+	for _, host := range dump.HostTable {
+		if !host.Used || (host.HostID != hosts[0].HostID.String() && host.HostID != hosts[1].HostID.String()) {
+			t.Errorf("unexpected host in the dump: %+v", host)
+		}
+	}
+
+	// Neither the structured nor the text dump contains the key
+	ck, err := df.CipherKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hex.EncodeToString(ck.Key())
+	if dump.CipherType != ck.CodeName() {
+		t.Errorf("expect cipher type %v, got %v", ck.CodeName(), dump.CipherType)
+	}
+	b, err := json.Marshal(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := dump.String()
+	if strings.Contains(strings.ToLower(string(b)), key) || strings.Contains(strings.ToLower(text), key) {
+		t.Errorf("the cipher key is exposed in the dump")
+	}
+	if !strings.Contains(text, hosts[1].MerkleRoot.Hex()) || !strings.Contains(text, hosts[1].HostID.String()) {
+		t.Errorf("the sector is missing in the text dump:\n%v", text)
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"fmt"
 	"math"
 	"os"
-	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -28,8 +28,18 @@ const (
 	// SectorSize is the size of a Sector, which is 4MiB
 	SectorSize = uint64(1 << 22)
 
-	// Version is the version of dxfile
-	Version = "1.0.0"
+	// Version is the version of the persisted layout of dxfile
+	Version = "1.2.0"
+)
+
+const (
+	// KeyDerivationNone is the key derivation that all sectors are encrypted with the
+	// cipher key of the file
+	KeyDerivationNone uint8 = iota
+
+	// KeyDerivationSector is the key derivation that each sector is encrypted with a subkey
+	// derived from the cipher key of the file, the segment index and the sector index
+	KeyDerivationSector
 )
 
 type (
@@ -44,12 +54,27 @@ type (
 		// segments is a list of segments the file is split into
 		segments []*Segment
 
+		// corruptSegments is the indexes of the segments failing the integrity check on load,
+		// which are loaded as empty segments until rewritten
+		corruptSegments map[uint64]struct{}
+
 		// utils field
 		deleted bool
 		lock    sync.RWMutex
 		ID      FileID
 		wal     *writeaheadlog.Wal
 
+		// backend is where the DxFile is persisted
+		backend PersistBackend
+
+		// staleEntries is the number of stale entries since last compaction, and the DxFile
+		// is compacted after compactThreshold stale entries. Value 0 disables the compaction
+		staleEntries     uint64
+		compactThreshold uint64
+
+		// hostAdded is called with the DxPath when a new host is added to the host table
+		hostAdded func(id enode.ID, dxPath storage.DxPath)
+
 		// filePath is full file path
 		filePath storage.SysPath
 
@@ -67,12 +92,17 @@ type (
 		Index   uint64
 		Stuck   bool
 		offset  uint64
+
+		// dirty indicates the segment is changed but not saved yet
+		dirty bool
 	}
 
-	// Sector is the Data for a single Sector, which has Data of merkle root and related host address
+	// Sector is the Data for a single Sector, which has Data of merkle root and related host address,
+	// and the generation of the cipher key the sector is encrypted with
 	Sector struct {
-		MerkleRoot common.Hash
-		HostID     enode.ID
+		MerkleRoot    common.Hash
+		HostID        enode.ID
+		KeyGeneration uint8
 	}
 
 	// FileID is the ID for a DxFile
@@ -85,6 +115,20 @@ type (
 // erasureCode is the erasure coder for encoding. cipherKey is the key for encryption.
 // fileSize is the size of the original data file. fileMode is the file privilege mode (e.g. 0777)
 func New(filePath storage.SysPath, dxPath storage.DxPath, sourcePath storage.SysPath, wal *writeaheadlog.Wal, erasureCode erasurecode.ErasureCoder, cipherKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode) (*DxFile, error) {
+	return newDxFile(filePath, dxPath, sourcePath, NewLocalBackend(wal), erasureCode, cipherKey, fileSize, fileMode, false)
+}
+
+// NewLazy creates a new dxfile with the same params as New, but the segments are not allocated
+// until they are written to. The persisted file is the same as the file created by New, and the
+// number of segments still reports the logical count. NewLazy reduces the memory for creating
+// a large file whose segments are uploaded gradually
+func NewLazy(filePath storage.SysPath, dxPath storage.DxPath, sourcePath storage.SysPath, wal *writeaheadlog.Wal, erasureCode erasurecode.ErasureCoder, cipherKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode) (*DxFile, error) {
+	return newDxFile(filePath, dxPath, sourcePath, NewLocalBackend(wal), erasureCode, cipherKey, fileSize, fileMode, true)
+}
+
+// newDxFile creates a new dxfile persisted to the backend. If lazy is true, the segments are
+// allocated on first write
+func newDxFile(filePath storage.SysPath, dxPath storage.DxPath, sourcePath storage.SysPath, backend PersistBackend, erasureCode erasurecode.ErasureCoder, cipherKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode, lazy bool) (*DxFile, error) {
 	currentTime := uint64(time.Now().Unix())
 	// create the params for erasureCode and cipherKey
 	minSectors, numSectors, extra, err := erasureCodeToParams(erasureCode)
@@ -123,33 +167,68 @@ func New(filePath storage.SysPath, dxPath storage.DxPath, sourcePath storage.Sys
 	}
 	// create the DxFile
 	df := &DxFile{
-		metadata:    md,
-		hostTable:   make(map[enode.ID]bool),
-		deleted:     false,
-		ID:          id,
-		wal:         wal,
-		filePath:    filePath,
-		erasureCode: erasureCode,
-		cipherKey:   cipherKey,
+		metadata:         md,
+		hostTable:        make(map[enode.ID]bool),
+		deleted:          false,
+		ID:               id,
+		wal:              walOf(backend),
+		backend:          backend,
+		compactThreshold: DefaultCompactThreshold,
+		filePath:         filePath,
+		erasureCode:      erasureCode,
+		cipherKey:        cipherKey,
+	}
+
+	// initialize the segments. The lazy segments are left nil until written
+	df.segments = make([]*Segment, md.numSegments())
+	if !lazy {
+		for i := range df.segments {
+			df.segments[i] = &Segment{Sectors: make([][]*Sector, numSectors), Index: uint64(i)}
+		}
 	}
+	return df, df.saveAll()
+}
 
-	// initialize the segments.
-	df.segments = make([]*Segment, md.numSegments())
+// segment returns the segment of the index. If the segment is not allocated yet, an empty
+// segment is returned without being allocated in df.segments. The returned segment shall
+// not be modified
+func (df *DxFile) segment(index int) *Segment {
+	if seg := df.segments[index]; seg != nil {
+		return seg
+	}
+	return df.emptySegment(index)
+}
+
+// materializeSegment returns the segment of the index to be modified. If the segment is not
+// allocated yet, an empty segment is allocated in df.segments
+func (df *DxFile) materializeSegment(index int) *Segment {
+	if df.segments[index] == nil {
+		df.segments[index] = df.emptySegment(index)
+	}
+	return df.segments[index]
+}
+
+// materializeSegments allocates all the segments not allocated yet
+func (df *DxFile) materializeSegments() {
 	for i := range df.segments {
-		df.segments[i] = &Segment{Sectors: make([][]*Sector, numSectors), Index: uint64(i)}
+		df.materializeSegment(i)
+	}
+}
+
+// emptySegment creates an empty segment of the index. The segment not allocated is always
+// persisted at the offset following the previous segments
+func (df *DxFile) emptySegment(index int) *Segment {
+	return &Segment{
+		Sectors: make([][]*Sector, df.metadata.NumSectors),
+		Index:   uint64(index),
+		offset:  df.metadata.SegmentOffset + uint64(index)*PageSize*segmentPersistNumPages(df.metadata.NumSectors),
 	}
-	return df, df.saveAll()
 }
 
 // Rename rename the DxFile, remove the previous dxfile and create a new file
 func (df *DxFile) Rename(newDxFile storage.DxPath, newDxFilename storage.SysPath) error {
-	df.lock.RLock()
-	defer df.lock.RUnlock()
-
-	dir, _ := filepath.Split(string(newDxFilename))
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
-	}
+	df.lock.Lock()
+	defer df.lock.Unlock()
 
 	return df.rename(newDxFile, newDxFilename)
 }
@@ -163,13 +242,15 @@ func (df *DxFile) Sectors(segmentIndex int) ([][]*Sector, error) {
 	}
 
 	// Return a deep-copy to avoid race conditions
-	sectors := make([][]*Sector, len(df.segments[segmentIndex].Sectors))
+	seg := df.segment(segmentIndex)
+	sectors := make([][]*Sector, len(seg.Sectors))
 	for sectorIndex := range sectors {
-		sectors[sectorIndex] = make([]*Sector, len(df.segments[segmentIndex].Sectors[sectorIndex]))
-		for i, sector := range df.segments[segmentIndex].Sectors[sectorIndex] {
+		sectors[sectorIndex] = make([]*Sector, len(seg.Sectors[sectorIndex]))
+		for i, sector := range seg.Sectors[sectorIndex] {
 			sectors[sectorIndex][i] = &Sector{
-				HostID:     sector.HostID,
-				MerkleRoot: sector.MerkleRoot,
+				HostID:        sector.HostID,
+				MerkleRoot:    sector.MerkleRoot,
+				KeyGeneration: sector.KeyGeneration,
 			}
 		}
 	}
@@ -177,40 +258,110 @@ func (df *DxFile) Sectors(segmentIndex int) ([][]*Sector, error) {
 }
 
 // AddSector add a Sector to DxFile to the location specified by segmentIndex and sectorIndex.
-// The sector content is filled by address and merkleRoot.
+// The sector content is filled by address and merkleRoot. The host is marked as used, and the
+// change is persisted through the wal. Out of range indexes are rejected without any change.
+// The sector is regarded as encrypted with the current cipher key
 func (df *DxFile) AddSector(address enode.ID, merkleRoot common.Hash, segmentIndex, sectorIndex int) error {
 	df.lock.Lock()
 	defer df.lock.Unlock()
+
+	return df.addSector(address, merkleRoot, segmentIndex, sectorIndex, df.metadata.keyGeneration())
+}
+
+// AddSectorOfKeyGeneration add a Sector encrypted with the cipher key of the generation, in
+// the same way as AddSector. The sector is rejected if the key of the generation is dropped
+func (df *DxFile) AddSectorOfKeyGeneration(address enode.ID, merkleRoot common.Hash, segmentIndex, sectorIndex int, generation uint8) error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	if _, err := df.cipherKeyOfGeneration(generation); err != nil {
+		return err
+	}
+	return df.addSector(address, merkleRoot, segmentIndex, sectorIndex, generation)
+}
+
+// addSector add a Sector encrypted with the cipher key of the generation. The caller shall
+// hold the lock
+func (df *DxFile) addSector(address enode.ID, merkleRoot common.Hash, segmentIndex, sectorIndex int, generation uint8) error {
 	// if file already deleted, report an error
 	if df.deleted {
 		return fmt.Errorf("file already deleted")
 	}
-	// Update the hostTable
-	df.hostTable[address] = true
 	// Params validation
-	if segmentIndex > len(df.segments) {
+	if segmentIndex < 0 || segmentIndex >= len(df.segments) {
 		return fmt.Errorf("segment Index %d out of bound %d", segmentIndex, len(df.segments))
 	}
-	if uint32(sectorIndex) > df.metadata.NumSectors {
+	if sectorIndex < 0 || uint64(sectorIndex) >= uint64(df.metadata.NumSectors) {
 		return fmt.Errorf("sector Index %d out of bound %d", sectorIndex, df.metadata.NumSectors)
 	}
-	df.segments[segmentIndex].Sectors[sectorIndex] = append(df.segments[segmentIndex].Sectors[sectorIndex],
-		&Sector{
-			HostID:     address,
-			MerkleRoot: merkleRoot,
-		})
+	// Update the hostTable
+	if _, exist := df.hostTable[address]; !exist && df.hostAdded != nil {
+		df.hostAdded(address, df.metadata.DxPath)
+	}
+	df.hostTable[address] = true
+	seg := df.materializeSegment(segmentIndex)
+	sector := &Sector{
+		HostID:        address,
+		MerkleRoot:    merkleRoot,
+		KeyGeneration: generation,
+	}
+	duplicate := containsSector(seg.Sectors[sectorIndex], sector)
+	seg.Sectors[sectorIndex] = append(seg.Sectors[sectorIndex], sector)
 	df.metadata.TimeAccess = unixNow()
 	df.metadata.TimeModify = df.metadata.TimeAccess
 	df.metadata.TimeUpdate = df.metadata.TimeAccess
+	seg.dirty = true
+
+	if err := df.saveDirty(); err != nil {
+		return err
+	}
+	if duplicate {
+		df.addStaleEntries(1)
+	}
+	return nil
+}
 
-	return df.saveSegments([]int{int(segmentIndex)})
+// RemoveSector removes the Sector with the merkleRoot stored on the host from the location
+// specified by segmentIndex and sectorIndex, e.g. the host reports the sector data is lost.
+// The host is kept in the host table. Removing a Sector not in the DxFile is not an error
+func (df *DxFile) RemoveSector(address enode.ID, merkleRoot common.Hash, segmentIndex, sectorIndex int) error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	if df.deleted {
+		return fmt.Errorf("file already deleted")
+	}
+	if segmentIndex < 0 || segmentIndex >= len(df.segments) {
+		return fmt.Errorf("segment Index %d out of bound %d", segmentIndex, len(df.segments))
+	}
+	if sectorIndex < 0 || uint64(sectorIndex) >= uint64(df.metadata.NumSectors) {
+		return fmt.Errorf("sector Index %d out of bound %d", sectorIndex, df.metadata.NumSectors)
+	}
+	seg := df.segments[segmentIndex]
+	if seg == nil {
+		return nil
+	}
+	var remain []*Sector
+	for _, sector := range seg.Sectors[sectorIndex] {
+		if sector.HostID != address || sector.MerkleRoot != merkleRoot {
+			remain = append(remain, sector)
+		}
+	}
+	if len(remain) == len(seg.Sectors[sectorIndex]) {
+		return nil
+	}
+	seg.Sectors[sectorIndex] = remain
+	df.metadata.TimeModify = unixNow()
+	df.metadata.TimeUpdate = df.metadata.TimeModify
+	seg.dirty = true
+	return df.saveDirty()
 }
 
 // Delete delete the DxFile. The function delete the DxFile on disk, and also mark
 // df.deleted as true
 func (df *DxFile) Delete() error {
-	df.lock.RLock()
-	defer df.lock.RUnlock()
+	df.lock.Lock()
+	defer df.lock.Unlock()
 
 	err := df.delete()
 	if err != nil {
@@ -240,70 +391,65 @@ func (df *DxFile) HostIDs() []enode.ID {
 	return hosts
 }
 
-// MarkAllHealthySegmentsAsUnstuck mark all health > 100 segments as unstuck
-func (df *DxFile) MarkAllHealthySegmentsAsUnstuck(table storage.HostHealthInfoTable) error {
-	df.lock.Lock()
-	defer df.lock.Unlock()
-	if df.deleted {
-		return fmt.Errorf("file %v is deleted", df.metadata.DxPath)
+// HasSectorsOnHost returns whether any sector of the DxFile is stored on the host
+func (df *DxFile) HasSectorsOnHost(id enode.ID) bool {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	if _, exist := df.hostTable[id]; !exist {
+		return false
 	}
-	// loop over segments and check health. If health is 200, mark the segment as unstuck
-	indexes := make([]int, 0, len(df.segments))
-	for i := range df.segments {
-		if !df.segments[i].Stuck {
+	for _, seg := range df.segments {
+		if seg == nil {
 			continue
 		}
-		segHealth := df.segmentHealth(i, table)
-		if segHealth < StuckThreshold {
-			continue
+		for _, sectors := range seg.Sectors {
+			for _, sector := range sectors {
+				if sector.HostID == id {
+					return true
+				}
+			}
 		}
-		df.segments[i].Stuck = false
-		df.metadata.NumStuckSegments--
-		indexes = append(indexes, i)
 	}
-	// save the segments. If error happens, revert.
-	err := df.saveSegments(indexes)
-	if err != nil {
-		for _, i := range indexes {
-			df.segments[i].Stuck = true
-			df.metadata.NumStuckSegments++
+	return false
+}
+
+// HostSectorRoots returns the merkle roots of all sectors of the DxFile, grouped by the host
+// storing the sector. The sector recorded multiple times for the same host is returned as many
+// times as it is recorded
+func (df *DxFile) HostSectorRoots() map[enode.ID][]common.Hash {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	roots := make(map[enode.ID][]common.Hash)
+	for _, seg := range df.segments {
+		if seg == nil {
+			continue
+		}
+		for _, sectors := range seg.Sectors {
+			for _, sector := range sectors {
+				roots[sector.HostID] = append(roots[sector.HostID], sector.MerkleRoot)
+			}
 		}
 	}
-	return err
+	return roots
+}
+
+// MarkAllHealthySegmentsAsUnstuck mark all health > 100 segments as unstuck
+func (df *DxFile) MarkAllHealthySegmentsAsUnstuck(table storage.HostHealthInfoTable) error {
+	return df.BatchUpdate(func(b *Batch) error {
+		b.MarkAllHealthySegmentsAsUnstuck(table)
+		return nil
+	})
 }
 
 // MarkAllUnhealthySegmentsAsStuck mark all unhealthy segments (health smaller than RepairHealthThreshold)
 // as Stuck
 func (df *DxFile) MarkAllUnhealthySegmentsAsStuck(table storage.HostHealthInfoTable) error {
-	df.lock.Lock()
-	defer df.lock.Unlock()
-	if df.deleted {
-		return fmt.Errorf("file %v is deleted", df.metadata.DxPath)
-	}
-	// loop over segments. If segment health is smaller than RepairHealthThreshold,
-	// mark the segment as stuck.
-	indexes := make([]int, 0, len(df.segments))
-	for i := range df.segments {
-		if df.segments[i].Stuck {
-			continue
-		}
-		segHealth := df.segmentHealth(i, table)
-		if segHealth >= StuckThreshold {
-			continue
-		}
-		df.segments[i].Stuck = true
-		df.metadata.NumStuckSegments++
-		indexes = append(indexes, i)
-	}
-	// save the segments. If error happens, mark the segment as stuck
-	err := df.saveSegments(indexes)
-	if err != nil {
-		for _, i := range indexes {
-			df.segments[i].Stuck = false
-			df.metadata.NumStuckSegments--
-		}
-	}
-	return err
+	return df.BatchUpdate(func(b *Batch) error {
+		b.MarkAllUnhealthySegmentsAsStuck(table)
+		return nil
+	})
 }
 
 // NumSegments return the number of segments
@@ -314,6 +460,20 @@ func (df *DxFile) NumSegments() int {
 	return len(df.segments)
 }
 
+// CorruptSegments returns the indexes of the segments failing the integrity check on load and
+// not rewritten yet. The sectors of the segments are lost, and the segments shall be repaired
+func (df *DxFile) CorruptSegments() []uint64 {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	indexes := make([]uint64, 0, len(df.corruptSegments))
+	for index := range df.corruptSegments {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes
+}
+
 // NumStuckChunks returns the Number of Stuck Chunks recorded in the file's
 // metadata
 func (df *DxFile) NumStuckSegments() int {
@@ -337,7 +497,7 @@ func (df *DxFile) SectorsOfSegmentIndex(index int) ([][]*Sector, error) {
 	if index > len(df.segments) {
 		return nil, fmt.Errorf("index %d out of range", index)
 	}
-	return copySectors(df.segments[index]), nil
+	return copySectors(df.segment(index)), nil
 }
 
 // Redundancy return the redundancy of a dxfile.
@@ -401,34 +561,9 @@ func (df *DxFile) GetRedundancy() uint32 {
 
 // SetStuckByIndex set a Segment of Index to the value of Stuck.
 func (df *DxFile) SetStuckByIndex(index int, stuck bool) (err error) {
-	df.lock.Lock()
-	defer df.lock.Unlock()
-
-	if df.deleted {
-		return fmt.Errorf("file %v is deleted", df.metadata.DxPath)
-	}
-
-	if stuck == df.segments[index].Stuck {
-		return nil
-	}
-	// if error happens, revert the change
-	prevNumStuckSegments := df.metadata.NumStuckSegments
-	prevStuck := df.segments[index].Stuck
-	defer func() {
-		if err != nil {
-			df.metadata.NumStuckSegments = prevNumStuckSegments
-			df.segments[index].Stuck = prevStuck
-		}
-	}()
-	df.segments[index].Stuck = stuck
-	if stuck {
-		df.metadata.NumStuckSegments++
-	} else {
-		df.metadata.NumStuckSegments--
-	}
-
-	err = df.saveSegments([]int{index})
-	return
+	return df.BatchUpdate(func(b *Batch) error {
+		return b.SetStuckByIndex(index, stuck)
+	})
 }
 
 // GetStuckByIndex get the Stuck status of the indexed Segment
@@ -436,7 +571,7 @@ func (df *DxFile) GetStuckByIndex(index int) bool {
 	df.lock.Lock()
 	defer df.lock.Unlock()
 
-	return df.segments[index].Stuck
+	return df.segment(index).Stuck
 }
 
 // UID return the id of the dxfile
@@ -451,6 +586,9 @@ func (df *DxFile) UploadedBytes() uint64 {
 	defer df.lock.RUnlock()
 	var uploaded uint64
 	for _, segment := range df.segments {
+		if segment == nil {
+			continue
+		}
 		for _, sectors := range segment.Sectors {
 			uploaded += SectorSize * uint64(len(sectors))
 		}
@@ -490,22 +628,32 @@ func (df *DxFile) UpdateUsedHosts(used []enode.ID) error {
 	}
 	// If the host exist in used slice, used = true
 	// if not exist in used slice, used = false
+	var numUnused uint64
 	for host := range df.hostTable {
 		_, exist := usedMap[host]
+		if df.hostTable[host] && !exist {
+			numUnused++
+		}
 		df.hostTable[host] = exist
 	}
 	// save the updates. If error happens, revert.
-	err := df.saveHostTableUpdate()
-	if err != nil {
+	if err := df.saveHostTableUpdate(); err != nil {
 		df.hostTable = prevHostTable
+		return err
 	}
-	return err
+	// the hosts no longer used, as well as the sectors on them, are stale
+	df.addStaleEntries(numUnused)
+	return nil
 }
 
 // pruneSegment try to prune Sectors from unused hosts to fit in the page size.
 // The size limit is defined by segmentPersistNumPages * PageSize.
 // After prune, all sectors' hosts must be used in hostTable
 func (df *DxFile) pruneSegment(segIndex int) {
+	// the segment not allocated has no sectors to prune
+	if df.segments[segIndex] == nil {
+		return
+	}
 	maxSegmentSize := segmentPersistNumPages(df.metadata.NumSectors) * PageSize
 	maxSectors := (maxSegmentSize - segmentPersistOverhead) / sectorPersistSize
 	// Max number of sectors per sector index
@@ -542,7 +690,7 @@ func (df *DxFile) ApplyCachedHealthMetadata(metadata CachedHealthMetadata) error
 
 	var numStuckSegments uint32
 	for _, seg := range df.segments {
-		if seg.Stuck {
+		if seg != nil && seg.Stuck {
 			numStuckSegments++
 		}
 	}
@@ -8,9 +8,13 @@ import (
 	"bytes"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/DxChainNetwork/godx/common/writeaheadlog"
+	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/rlp"
 	"github.com/DxChainNetwork/godx/storage"
@@ -117,6 +121,140 @@ func TestAddSector(t *testing.T) {
 	}
 }
 
+// TestRemoveSector test DxFile.RemoveSector removes only the sector of the merkle root on the
+// host, and the removal is persisted
+func TestRemoveSector(t *testing.T) {
+	df, err := newTestDxFileWithSegments(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, root, otherRoot := randomAddress(), randomHash(), randomHash()
+	if err = df.AddSector(addr, root, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = df.AddSector(addr, otherRoot, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	numSectors := len(df.segments[0].Sectors[0])
+	if err = df.RemoveSector(addr, root, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	path, err := storage.NewDxPath(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveredDF, err := readDxFile(testDir.Join(path), df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectors := recoveredDF.segments[0].Sectors[0]
+	if len(sectors) != numSectors-1 {
+		t.Fatalf("number of sectors not expected. Expect %v, got %v", numSectors-1, len(sectors))
+	}
+	for _, sector := range sectors {
+		if sector.HostID == addr && sector.MerkleRoot == root {
+			t.Fatalf("sector removed still exists")
+		}
+	}
+	if last := sectors[len(sectors)-1]; last.HostID != addr || last.MerkleRoot != otherRoot {
+		t.Errorf("the other sector on the host shall be kept")
+	}
+	// removing the sector not exist is not an error
+	if err = df.RemoveSector(addr, root, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddSectorOutOfRange test DxFile.AddSector rejects the out of range indexes without
+// changing the DxFile
+func TestAddSectorOutOfRange(t *testing.T) {
+	df, err := newTestDxFileWithSegments(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numSegments, numSectors := df.NumSegments(), int(df.metadata.NumSectors)
+	tests := []struct {
+		segmentIndex, sectorIndex int
+	}{
+		{numSegments, 0},
+		{-1, 0},
+		{0, numSectors},
+		{0, -1},
+	}
+	for _, test := range tests {
+		addr := randomAddress()
+		if err = df.AddSector(addr, randomHash(), test.segmentIndex, test.sectorIndex); err == nil {
+			t.Errorf("segment %d sector %d: out of range index not rejected", test.segmentIndex, test.sectorIndex)
+		}
+		if _, exist := df.hostTable[addr]; exist {
+			t.Errorf("segment %d sector %d: host added to the table", test.segmentIndex, test.sectorIndex)
+		}
+	}
+	// the last sector of the last segment is still within range
+	if err = df.AddSector(randomAddress(), randomHash(), numSegments-1, numSectors-1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNewLazy test creating a large file lazily. The segments are allocated on write, and the
+// persisted file is the same as the file with all segments allocated
+func TestNewLazy(t *testing.T) {
+	ec, _ := erasurecode.New(erasurecode.ECTypeStandard, 10, 30)
+	ck, _ := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	path, err := storage.NewDxPath(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := testDir.Join(path)
+	wal, txns, _ := writeaheadlog.New(filepath.Join(string(testDir), t.Name()+".wal"))
+	for _, txn := range txns {
+		txn.Release()
+	}
+	df, err := NewLazy(filename, path, storage.SysPath(filepath.Join("~/tmp", t.Name())), wal, ec, ck, SectorSize*10*256, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(df.NumSegments()) != df.metadata.numSegments() {
+		t.Fatalf("number of segments not expected. Expect %v, got %v", df.metadata.numSegments(), df.NumSegments())
+	}
+	for i, seg := range df.segments {
+		if seg != nil {
+			t.Fatalf("segment %d allocated before written", i)
+		}
+	}
+	segmentIndex := rand.Intn(df.NumSegments())
+	if err = df.AddSector(randomAddress(), randomHash(), segmentIndex, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = df.SetStuckByIndex(segmentIndex, true); err != nil {
+		t.Fatal(err)
+	}
+	for i, seg := range df.segments {
+		if (seg != nil) != (i == segmentIndex) {
+			t.Fatalf("segment %d: expect allocated %v, got %v", i, i == segmentIndex, seg != nil)
+		}
+	}
+	recoveredDF, err := readDxFile(filename, wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkMetadataEqual(df.metadata, recoveredDF.metadata); err != nil {
+		t.Fatal(err)
+	}
+	if len(recoveredDF.segments) != df.NumSegments() {
+		t.Fatalf("number of recovered segments not expected. Expect %v, got %v", df.NumSegments(), len(recoveredDF.segments))
+	}
+	for i, recovered := range recoveredDF.segments {
+		seg := df.segment(i)
+		if err = checkSegmentEqual(*seg, *recovered); err != nil {
+			t.Fatalf("segment[%d]: %v", i, err)
+		}
+		if seg.offset != recovered.offset || seg.Stuck != recovered.Stuck {
+			t.Fatalf("segment[%d]: expect offset %v stuck %v, got offset %v stuck %v", i, seg.offset, seg.Stuck, recovered.offset, recovered.Stuck)
+		}
+	}
+}
+
 // TestDelete test DxFile.Delete function
 func TestDelete(t *testing.T) {
 	df, err := newTestDxFile(t, sectorSize*64, 10, 30, erasurecode.ECTypeStandard)
@@ -371,6 +509,84 @@ func TestHostIDs(t *testing.T) {
 	}
 }
 
+// TestHostTableConcurrentAccess test the host table is safely accessed by the repair adding new
+// hosts concurrently with the downloads reading the host table and updating the access time.
+// The test is meaningful with the race detector
+func TestHostTableConcurrentAccess(t *testing.T) {
+	df, err := newTestDxFile(t, sectorSize*10*4, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numSegments := int(df.metadata.numSegments())
+	numSectors := int(df.metadata.NumSectors)
+	rounds := 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*rounds)
+	// repair adds sectors on new hosts, and releases some hosts
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var hosts []enode.ID
+		for i := 0; i != rounds; i++ {
+			host := randomAddress()
+			hosts = append(hosts, host)
+			if err := df.AddSector(host, randomHash(), i%numSegments, i%numSectors); err != nil {
+				errs <- err
+			}
+			if i%5 == 4 {
+				if err := df.UpdateUsedHosts(hosts[len(hosts)/2:]); err != nil {
+					errs <- err
+				}
+			}
+		}
+	}()
+	// downloads read the host table and update the access time
+	for d := 0; d != 2; d++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i != rounds; i++ {
+				snap, err := df.Snapshot()
+				if err != nil {
+					errs <- err
+					continue
+				}
+				for id := range snap.hostTable {
+					df.HasSectorsOnHost(id)
+				}
+				df.HostIDs()
+				if _, err := df.Dump(); err != nil {
+					errs <- err
+				}
+				if err := df.SetTimeAccess(time.Now()); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if len(df.HostIDs()) != rounds {
+		t.Errorf("expect %v hosts, got %v", rounds, len(df.HostIDs()))
+	}
+	path, err := storage.NewDxPath(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveredDF, err := readDxFile(testDir.Join(path), df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkDxFileEqual(df, recoveredDF); err != nil {
+		t.Error(err)
+	}
+}
+
 // TestRename test DxFile.Rename
 func TestRename(t *testing.T) {
 	fileSegments := uint64(10)
@@ -9,7 +9,9 @@ import (
 	"encoding/binary"
 	"errors"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,8 +41,14 @@ type (
 		// filesMap is the mapping from dxPath to contents
 		filesMap map[storage.DxPath]*fileSetEntry
 
-		lock sync.Mutex
-		wal  *writeaheadlog.Wal
+		lock    sync.Mutex
+		backend PersistBackend
+
+		// compactThreshold is the threshold of the automatic compaction of the DxFiles
+		compactThreshold uint64
+
+		// hostIndex is the reverse index from the host to the DxFiles using the host
+		hostIndex *hostIndex
 	}
 
 	// fileSetEntry is an entry for fileSet. fileSetEntry extends DxFile.
@@ -68,17 +76,27 @@ type (
 	}
 )
 
-// NewFileSet create a new DxFileSet with provided rootDir and wal.
+// NewFileSet create a new DxFileSet with provided rootDir and wal. The DxFiles are persisted
+// on local disk.
 func NewFileSet(rootDir storage.SysPath, wal *writeaheadlog.Wal) *FileSet {
+	return NewFileSetWithBackend(rootDir, NewLocalBackend(wal))
+}
+
+// NewFileSetWithBackend create a new DxFileSet with provided rootDir, and the DxFiles are
+// persisted to the backend
+func NewFileSetWithBackend(rootDir storage.SysPath, backend PersistBackend) *FileSet {
 	return &FileSet{
-		rootDir:  rootDir,
-		filesMap: make(map[storage.DxPath]*fileSetEntry),
-		wal:      wal,
+		rootDir:          rootDir,
+		filesMap:         make(map[storage.DxPath]*fileSetEntry),
+		backend:          backend,
+		compactThreshold: DefaultCompactThreshold,
+		hostIndex:        newHostIndex(),
 	}
 }
 
 // NewDxFile create a DxFile based on the params given. Return a FileSetEntryWithID that has been
-// registered with threadID in FileSetEntry
+// registered with threadID in FileSetEntry. The segments of the DxFile are allocated lazily as
+// the sectors are uploaded, so that creating a large file does not allocate all segments
 func (fs *FileSet) NewDxFile(dxPath storage.DxPath, sourcePath storage.SysPath, force bool, erasureCode erasurecode.ErasureCoder, cipherKey crypto.CipherKey, fileSize uint64, fileMode os.FileMode) (*FileSetEntryWithID, error) {
 	fs.lock.Lock()
 	defer fs.lock.Unlock()
@@ -87,7 +105,7 @@ func (fs *FileSet) NewDxFile(dxPath storage.DxPath, sourcePath storage.SysPath,
 		return nil, ErrFileExist
 	}
 	// Create a new DxFile
-	df, err := New(fs.filepath(dxPath), dxPath, sourcePath, fs.wal, erasureCode, cipherKey, fileSize, fileMode)
+	df, err := newDxFile(fs.filepath(dxPath), dxPath, sourcePath, fs.backend, erasureCode, cipherKey, fileSize, fileMode, true)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +147,7 @@ func (fs *FileSet) open(dxPath storage.DxPath) (*FileSetEntryWithID, error) {
 	entry, exist := fs.filesMap[dxPath]
 	if !exist {
 		// file not loaded or not exist. Try to read DxFile from disk.
-		df, err := readDxFile(fs.filepath(dxPath), fs.wal)
+		df, err := readDxFileFromBackend(fs.filepath(dxPath), fs.backend)
 		if os.IsNotExist(err) {
 			return nil, ErrUnknownFile
 		}
@@ -174,6 +192,7 @@ func (fs *FileSet) Delete(dxPath storage.DxPath) error {
 	}
 
 	delete(fs.filesMap, entry.metadata.DxPath)
+	fs.hostIndex.remove(dxPath)
 	return nil
 }
 
@@ -185,14 +204,34 @@ func (fs *FileSet) Exists(dxPath storage.DxPath) bool {
 	return fs.exists(dxPath)
 }
 
+// DxPaths returns the DxPaths of all DxFiles persisted in the backend under the root directory
+func (fs *FileSet) DxPaths() ([]storage.DxPath, error) {
+	names, err := fs.backend.List(string(fs.rootDir))
+	if err != nil {
+		return nil, err
+	}
+	dxPaths := make([]storage.DxPath, 0, len(names))
+	for _, name := range names {
+		if filepath.Ext(name) != storage.DxFileExt {
+			continue
+		}
+		str := strings.TrimSuffix(strings.TrimPrefix(name, string(fs.rootDir)), storage.DxFileExt)
+		dxPath, err := storage.NewDxPath(str)
+		if err != nil {
+			return nil, err
+		}
+		dxPaths = append(dxPaths, dxPath)
+	}
+	return dxPaths, nil
+}
+
 // Exists return whether the dxPath exists (cached then on disk)
 func (fs *FileSet) exists(dxPath storage.DxPath) bool {
 	entry, exists := fs.filesMap[dxPath]
 	if exists {
 		return !entry.Deleted()
 	}
-	_, err := os.Stat(string(fs.filepath(dxPath)))
-	return !os.IsNotExist(err)
+	return blobExists(fs.backend, string(fs.filepath(dxPath)))
 }
 
 // Rename rename the file with dxPath to newDxPath.
@@ -213,7 +252,11 @@ func (fs *FileSet) Rename(dxPath, newDxPath storage.DxPath) error {
 	fs.filesMap[newDxPath] = entry.fileSetEntry
 	delete(fs.filesMap, dxPath)
 
-	return entry.Rename(newDxPath, fs.filepath(newDxPath))
+	if err := entry.Rename(newDxPath, fs.filepath(newDxPath)); err != nil {
+		return err
+	}
+	fs.hostIndex.rename(dxPath, newDxPath)
+	return nil
 }
 
 // Close close a FileSetEntryWithID
@@ -226,6 +269,8 @@ func (entry *FileSetEntryWithID) Close() error {
 
 // newFileSetEntry is a helper function to create a fileSetEntry based on input df
 func (fs *FileSet) newFileSetEntry(df *DxFile) *fileSetEntry {
+	df.compactThreshold = fs.compactThreshold
+	df.hostAdded = fs.hostIndex.add
 	return &fileSetEntry{
 		DxFile:    df,
 		fileSet:   fs,
@@ -121,6 +121,11 @@ func TestFileSet_NewDxFile(t *testing.T) {
 	if _, err := os.Stat(string(testDir.Join(newEntry.metadata.DxPath)) + storage.DxFileExt); err != nil {
 		t.Errorf("Creating a DxFile, the file does not exist: %v", err)
 	}
+	for i, seg := range newEntry.segments {
+		if seg != nil {
+			t.Fatalf("segment %d allocated before written", i)
+		}
+	}
 }
 
 // TestFileSet_CloseOpen test the FileSet Close and Open process.
@@ -250,3 +255,58 @@ func TestFileSet_RenameOpen(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestFileSet_DxPathsOnHost test the host index is built from the persisted DxFiles, and
+// maintained as the hosts are added and the DxFiles are renamed or deleted.
+func TestFileSet_DxPathsOnHost(t *testing.T) {
+	backend := newMemoryBackend()
+	fs := NewFileSetWithBackend(testDir, backend)
+	ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dxPath := randomDxPath()
+	df, err := fs.NewRandomDxFile(dxPath, 10, 30, erasurecode.ECTypeStandard, ck, SectorSize*10*8, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := df.HostIDs()[0]
+	df.Close()
+
+	// the index is built from the DxFile persisted
+	fs = NewFileSetWithBackend(testDir, backend)
+	dxPaths, err := fs.DxPathsOnHost(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dxPaths, []storage.DxPath{dxPath}) {
+		t.Fatalf("dxPaths on host not expected. Got %v, Expect %v", dxPaths, []storage.DxPath{dxPath})
+	}
+	// the new host is indexed when the sector is added
+	df, err = fs.Open(dxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newHost := randomAddress()
+	if err = df.AddSector(newHost, randomHash(), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	df.Close()
+	if dxPaths, _ = fs.DxPathsOnHost(newHost); !reflect.DeepEqual(dxPaths, []storage.DxPath{dxPath}) {
+		t.Fatalf("dxPaths on new host not expected. Got %v, Expect %v", dxPaths, []storage.DxPath{dxPath})
+	}
+	// the index follows the rename and the delete
+	newDxPath := randomDxPath()
+	if err = fs.Rename(dxPath, newDxPath); err != nil {
+		t.Fatal(err)
+	}
+	if dxPaths, _ = fs.DxPathsOnHost(host); !reflect.DeepEqual(dxPaths, []storage.DxPath{newDxPath}) {
+		t.Fatalf("dxPaths after rename not expected. Got %v, Expect %v", dxPaths, []storage.DxPath{newDxPath})
+	}
+	if err = fs.Delete(newDxPath); err != nil {
+		t.Fatal(err)
+	}
+	if dxPaths, _ = fs.DxPathsOnHost(host); len(dxPaths) != 0 {
+		t.Fatalf("dxPaths after delete not empty: %v", dxPaths)
+	}
+}
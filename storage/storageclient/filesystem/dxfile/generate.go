@@ -58,7 +58,7 @@ func (fs *FileSet) NewRandomDxFile(dxPath storage.DxPath, minSectors, numSectors
 }
 
 // newTestDxFile generate a random DxFile used for testing. The generated DxFile segments are empty
-func newTestDxFile(t *testing.T, fileSize uint64, minSectors, numSectors uint32, ecCode uint8) (*DxFile, error) {
+func newTestDxFile(t testing.TB, fileSize uint64, minSectors, numSectors uint32, ecCode uint8) (*DxFile, error) {
 	ec, _ := erasurecode.New(ecCode, minSectors, numSectors, 64)
 	ck, _ := crypto.GenerateCipherKey(crypto.GCMCipherCode)
 	path, err := storage.NewDxPath(t.Name())
@@ -109,7 +109,7 @@ func userHomeDir() string {
 }
 
 // newTestDxFileWithSegments generate a random DxFile with some segment data.
-func newTestDxFileWithSegments(t *testing.T, fileSize uint64, minSectors, numSectors uint32, ecCode uint8) (*DxFile, error) {
+func newTestDxFileWithSegments(t testing.TB, fileSize uint64, minSectors, numSectors uint32, ecCode uint8) (*DxFile, error) {
 	df, err := newTestDxFile(t, fileSize, minSectors, numSectors, ecCode)
 	if err != nil {
 		t.Fatal(err)
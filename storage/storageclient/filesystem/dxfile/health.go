@@ -5,6 +5,7 @@
 package dxfile
 
 import (
+	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/storage"
 )
 
@@ -43,9 +44,9 @@ func (df *DxFile) Health(table storage.HostHealthInfoTable) (uint32, uint32, uin
 	stuckHealth := uint32(200)
 	// health, stuckHealth should be the minimum value of the segment health
 	var numStuckSegments uint32
-	for i, seg := range df.segments {
+	for i := range df.segments {
 		segHealth := df.segmentHealth(i, table)
-		if seg.Stuck {
+		if df.segment(i).Stuck {
 			numStuckSegments++
 			if segHealth < stuckHealth {
 				stuckHealth = segHealth
@@ -82,16 +83,37 @@ func (df *DxFile) segmentHealth(segmentIndex int, table storage.HostHealthInfoTa
 	} else {
 		score = uint32(goodSectors) * 100 / minSectors
 	}
+	// The segment with sectors stored on too few distinct hosts is not healthy even if
+	// enough sectors are stored, so that the segment is repaired to more hosts
+	minHosts := df.metadata.MinSegmentHosts
+	if minHosts != 0 && score >= RepairHealthThreshold && df.segmentHosts(segmentIndex, table) < minHosts {
+		score = RepairHealthThreshold - 1
+	}
 	return score
 }
 
+// segmentHosts return the number of distinct hosts good for renew storing the sectors of the segment
+func (df *DxFile) segmentHosts(segmentIndex int, table storage.HostHealthInfoTable) uint32 {
+	hosts := make(map[enode.ID]struct{})
+	for _, sectors := range df.segment(segmentIndex).Sectors {
+		for _, sector := range sectors {
+			info, exist := table[sector.HostID]
+			if !exist || info.Offline || !info.GoodForRenew {
+				continue
+			}
+			hosts[sector.HostID] = struct{}{}
+		}
+	}
+	return uint32(len(hosts))
+}
+
 // goodSectors return the number of Sectors goodForRenew and numSectorsGoodForUpload with the
 // given offlineMap and goodForRenewMap
 func (df *DxFile) goodSectors(segmentIndex int, table storage.HostHealthInfoTable) (uint32, uint32) {
 	numSectorsGoodForRenew := uint64(0)
 	numSectorsGoodForUpload := uint64(0)
 
-	for _, sectors := range df.segments[segmentIndex].Sectors {
+	for _, sectors := range df.segment(segmentIndex).Sectors {
 		foundGoodForRenew := false
 		foundOnline := false
 		for _, sector := range sectors {
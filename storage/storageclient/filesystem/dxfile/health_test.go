@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
 )
@@ -117,6 +118,49 @@ func TestSegmentHealth(t *testing.T) {
 }
 
 // TestHealth test DxFile.Health
+// TestSegmentHealth_MinSegmentHosts test the segment with sectors concentrated on fewer hosts than
+// the min segment hosts stays under the repair threshold even if all sectors are stored
+func TestSegmentHealth_MinSegmentHosts(t *testing.T) {
+	minSectors, numSectors := uint32(10), uint32(30)
+	tests := []struct {
+		numHosts        int
+		minSegmentHosts uint32
+		expectHealth    uint32
+	}{
+		{3, 0, CompleteHealthThreshold},
+		{3, 10, RepairHealthThreshold - 1},
+		{10, 10, CompleteHealthThreshold},
+		{30, 30, CompleteHealthThreshold},
+	}
+	for index, test := range tests {
+		var hosts []enode.ID
+		table := make(storage.HostHealthInfoTable)
+		for i := 0; i != test.numHosts; i++ {
+			id := enode.RandomID(enode.ID{}, i)
+			hosts = append(hosts, id)
+			table[id] = storage.HostHealthInfo{
+				Offline:      false,
+				GoodForRenew: true,
+			}
+		}
+		seg := &Segment{Sectors: make([][]*Sector, numSectors)}
+		for i := range seg.Sectors {
+			seg.Sectors[i] = []*Sector{{MerkleRoot: randomHash(), HostID: hosts[i%test.numHosts]}}
+		}
+		df := DxFile{
+			metadata: &Metadata{
+				NumSectors:      numSectors,
+				MinSectors:      minSectors,
+				MinSegmentHosts: test.minSegmentHosts,
+			},
+			segments: []*Segment{seg},
+		}
+		if health := df.SegmentHealth(0, table); health != test.expectHealth {
+			t.Errorf("test %d: expect health %v, got %v", index, test.expectHealth, health)
+		}
+	}
+}
+
 func TestHealth(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 	numSectors := uint32(30)
@@ -0,0 +1,134 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// hostIndex is the reverse index from the host to the DxPaths of the DxFiles with the host
+// in the host table. The index is built from all DxFiles at the first query, and maintained
+// afterwards as the hosts are added to the DxFiles and the DxFiles are renamed or deleted.
+// Hosts removed from a DxFile by compaction or prune are not removed from the index, thus
+// the index is a superset and the DxFiles found shall be checked by the caller.
+type hostIndex struct {
+	files map[enode.ID]map[storage.DxPath]struct{}
+	built bool
+	lock  sync.Mutex
+
+	// buildLock makes sure only one thread scans the DxFiles to build the index
+	buildLock sync.Mutex
+}
+
+// newHostIndex returns an empty hostIndex which is not built yet
+func newHostIndex() *hostIndex {
+	return &hostIndex{
+		files: make(map[enode.ID]map[storage.DxPath]struct{}),
+	}
+}
+
+// add adds the dxPath to the DxPaths of the host
+func (hi *hostIndex) add(id enode.ID, dxPath storage.DxPath) {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+
+	paths, exist := hi.files[id]
+	if !exist {
+		paths = make(map[storage.DxPath]struct{})
+		hi.files[id] = paths
+	}
+	paths[dxPath] = struct{}{}
+}
+
+// remove removes the dxPath from the DxPaths of all hosts
+func (hi *hostIndex) remove(dxPath storage.DxPath) {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+
+	for id, paths := range hi.files {
+		delete(paths, dxPath)
+		if len(paths) == 0 {
+			delete(hi.files, id)
+		}
+	}
+}
+
+// rename replaces the dxPath with newDxPath for all hosts
+func (hi *hostIndex) rename(dxPath, newDxPath storage.DxPath) {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+
+	for _, paths := range hi.files {
+		if _, exist := paths[dxPath]; exist {
+			delete(paths, dxPath)
+			paths[newDxPath] = struct{}{}
+		}
+	}
+}
+
+// dxPaths returns the DxPaths of the host, sorted by path
+func (hi *hostIndex) dxPaths(id enode.ID) []storage.DxPath {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+
+	dxPaths := make([]storage.DxPath, 0, len(hi.files[id]))
+	for dxPath := range hi.files[id] {
+		dxPaths = append(dxPaths, dxPath)
+	}
+	sort.Slice(dxPaths, func(i, j int) bool { return dxPaths[i].Path < dxPaths[j].Path })
+	return dxPaths
+}
+
+// DxPathsOnHost returns the DxPaths of the DxFiles which may have sectors stored on the host,
+// sorted by path. The result may contain DxFiles no longer storing sectors on the host, or no
+// longer existing, which shall be checked by the caller.
+func (fs *FileSet) DxPathsOnHost(id enode.ID) ([]storage.DxPath, error) {
+	if err := fs.buildHostIndex(); err != nil {
+		return nil, err
+	}
+	return fs.hostIndex.dxPaths(id), nil
+}
+
+// buildHostIndex scans the host tables of all DxFiles to build the host index, if the index
+// is not built yet. The hosts added during the scan are indexed by the DxFiles directly.
+func (fs *FileSet) buildHostIndex() error {
+	hi := fs.hostIndex
+	hi.buildLock.Lock()
+	defer hi.buildLock.Unlock()
+
+	hi.lock.Lock()
+	built := hi.built
+	hi.lock.Unlock()
+	if built {
+		return nil
+	}
+
+	dxPaths, err := fs.DxPaths()
+	if err != nil {
+		return err
+	}
+	for _, dxPath := range dxPaths {
+		entry, err := fs.Open(dxPath)
+		if err == ErrUnknownFile {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, id := range entry.HostIDs() {
+			hi.add(id, entry.DxPath())
+		}
+		entry.Close()
+	}
+
+	hi.lock.Lock()
+	hi.built = true
+	hi.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/crypto"
+)
+
+const (
+	// maxKeyGeneration is the last generation of the cipher key. The generation up to 127 is rlp
+	// encoded as a single byte, so that the sector still fits in sectorPersistSize
+	maxKeyGeneration = 127
+
+	// maxKeyGenerationsKept is the maximum number of cipher key generations kept in the
+	// metadata, so that the metadata still fits in a page
+	maxKeyGenerationsKept = 16
+)
+
+var (
+	// errKeyGenerationsExhausted is the error returned if the cipher key cannot be rotated
+	// since the generation reaches maxKeyGeneration
+	errKeyGenerationsExhausted = errors.New("cipher key generations exhausted")
+
+	// errKeyGenerationUnknown is the error returned if the cipher key of the generation is not
+	// kept in the metadata
+	errKeyGenerationUnknown = errors.New("unknown cipher key generation")
+)
+
+// CipherKeyGeneration is a generation of the cipher key of the DxFile. Each sector records the
+// generation of the key it is encrypted with
+type CipherKeyGeneration struct {
+	Generation    uint8
+	CipherKeyCode uint8
+	CipherKey     []byte
+}
+
+// KeyGeneration return the generation of the current cipher key, which encrypts the sectors
+// uploaded afterwards
+func (df *DxFile) KeyGeneration() uint8 {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	return df.metadata.keyGeneration()
+}
+
+// RotateCipherKey records the new key as the current cipher key of the DxFile, so that the
+// sectors uploaded and repaired afterwards are encrypted with the new key. The previous keys
+// still used by the sectors are kept to decrypt the sectors, and the ones no longer used are
+// dropped. The new key shall have the same overhead as the current key, since the sector
+// size of the DxFile depends on the overhead.
+//
+// The sector encrypted with a dropped key before the rotation cannot be added to the DxFile,
+// and shall be uploaded again
+func (df *DxFile) RotateCipherKey(newKey crypto.CipherKey) error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	if df.deleted {
+		return errors.New("file already deleted")
+	}
+	ck, err := df.getCipherKey()
+	if err != nil {
+		return err
+	}
+	if newKey.Overhead() != ck.Overhead() {
+		return fmt.Errorf("new cipher key overhead %v not equal to %v", newKey.Overhead(), ck.Overhead())
+	}
+	code := crypto.CipherCodeByName(newKey.CodeName())
+	if code == crypto.CipherCodeNotSupport {
+		return fmt.Errorf("cipher %v not supported", newKey.CodeName())
+	}
+	current := df.metadata.keyGeneration()
+	if current == maxKeyGeneration {
+		return errKeyGenerationsExhausted
+	}
+
+	// Keep the generations still used by the sectors
+	used := df.usedKeyGenerations()
+	var kept []CipherKeyGeneration
+	for _, generation := range df.metadata.cipherKeyGenerations() {
+		if _, exist := used[generation.Generation]; exist {
+			kept = append(kept, generation)
+		}
+	}
+	if len(kept) >= maxKeyGenerationsKept {
+		return fmt.Errorf("%v cipher key generations still used by the sectors", len(kept))
+	}
+	kept = append(kept, CipherKeyGeneration{
+		Generation:    current + 1,
+		CipherKeyCode: code,
+		CipherKey:     newKey.Key(),
+	})
+
+	// Apply the new key and revert if the metadata cannot be saved
+	prevGenerations, prevCode, prevKey := df.metadata.KeyGenerations, df.metadata.CipherKeyCode, df.metadata.CipherKey
+	df.metadata.KeyGenerations, df.metadata.CipherKeyCode, df.metadata.CipherKey = kept, code, newKey.Key()
+	if err = df.saveMetadata(); err != nil {
+		df.metadata.KeyGenerations, df.metadata.CipherKeyCode, df.metadata.CipherKey = prevGenerations, prevCode, prevKey
+		return err
+	}
+	df.cipherKey = newKey
+	return nil
+}
+
+// SectorCipherKeyOfGeneration return the key encrypting the sector at the sector index of the
+// segment with the cipher key of the generation
+func (df *DxFile) SectorCipherKeyOfGeneration(generation uint8, segmentIndex, sectorIndex uint64) (crypto.CipherKey, error) {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	ck, err := df.cipherKeyOfGeneration(generation)
+	if err != nil {
+		return nil, err
+	}
+	return sectorCipherKey(ck, df.metadata.KeyDerivation, segmentIndex, sectorIndex)
+}
+
+// cipherKeyOfGeneration return the cipher key of the generation. The caller shall hold the lock
+func (df *DxFile) cipherKeyOfGeneration(generation uint8) (crypto.CipherKey, error) {
+	if generation == df.metadata.keyGeneration() {
+		return df.getCipherKey()
+	}
+	for _, kg := range df.metadata.KeyGenerations {
+		if kg.Generation == generation {
+			return crypto.NewCipherKey(kg.CipherKeyCode, kg.CipherKey)
+		}
+	}
+	return nil, errKeyGenerationUnknown
+}
+
+// cipherKeys return the cipher keys of all generations kept. The caller shall hold the lock
+func (df *DxFile) cipherKeys() (map[uint8]crypto.CipherKey, error) {
+	keys := make(map[uint8]crypto.CipherKey)
+	for _, kg := range df.metadata.cipherKeyGenerations() {
+		ck, err := df.cipherKeyOfGeneration(kg.Generation)
+		if err != nil {
+			return nil, err
+		}
+		keys[kg.Generation] = ck
+	}
+	return keys, nil
+}
+
+// usedKeyGenerations return the generations of the keys encrypting the sectors of the DxFile.
+// The caller shall hold the lock
+func (df *DxFile) usedKeyGenerations() map[uint8]struct{} {
+	used := make(map[uint8]struct{})
+	for _, seg := range df.segments {
+		if seg == nil {
+			continue
+		}
+		for _, sectors := range seg.Sectors {
+			for _, sector := range sectors {
+				used[sector.KeyGeneration] = struct{}{}
+			}
+		}
+	}
+	return used
+}
+
+// keyGeneration return the generation of the current cipher key. The DxFile never rotated has
+// no generations recorded, and all its sectors are of generation 0
+func (md Metadata) keyGeneration() uint8 {
+	if len(md.KeyGenerations) == 0 {
+		return 0
+	}
+	return md.KeyGenerations[len(md.KeyGenerations)-1].Generation
+}
+
+// cipherKeyGenerations return the cipher key generations kept, including the current one
+func (md Metadata) cipherKeyGenerations() []CipherKeyGeneration {
+	if len(md.KeyGenerations) == 0 {
+		return []CipherKeyGeneration{{
+			Generation:    0,
+			CipherKeyCode: md.CipherKeyCode,
+			CipherKey:     md.CipherKey,
+		}}
+	}
+	return md.KeyGenerations
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// TestRotateCipherKey test the sectors encrypted before and after the rotation are decrypted
+// with the key of their own generation, and the generations are persisted
+func TestRotateCipherKey(t *testing.T) {
+	df, err := newTestDxFile(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, err := df.CipherKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSector := Sector{HostID: randomAddress(), MerkleRoot: randomHash()}
+	if err = df.AddSector(oldSector.HostID, oldSector.MerkleRoot, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = df.RotateCipherKey(newKey); err != nil {
+		t.Fatal(err)
+	}
+	if gen := df.KeyGeneration(); gen != 1 {
+		t.Fatalf("expect key generation 1, got %v", gen)
+	}
+	newSector := Sector{HostID: randomAddress(), MerkleRoot: randomHash()}
+	if err = df.AddSector(newSector.HostID, newSector.MerkleRoot, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is read back with the keys of both generations
+	path, err := storage.NewDxPath(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := readDxFile(testDir.Join(path), df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkDxFileEqual(df, recovered); err != nil {
+		t.Fatal(err)
+	}
+	sectors, err := recovered.Sectors(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sectors[0][0].KeyGeneration != 0 || sectors[1][0].KeyGeneration != 1 {
+		t.Errorf("unexpected key generations %v and %v", sectors[0][0].KeyGeneration, sectors[1][0].KeyGeneration)
+	}
+	for gen, expect := range []crypto.CipherKey{oldKey, newKey} {
+		key, err := recovered.SectorCipherKeyOfGeneration(uint8(gen), 0, uint64(gen))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key.Key(), expect.Key()) {
+			t.Errorf("generation %v: unexpected cipher key", gen)
+		}
+	}
+	current, err := recovered.CipherKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current.Key(), newKey.Key()) {
+		t.Errorf("the current cipher key is not the rotated key")
+	}
+
+	// the snapshot decrypts the sectors of both generations
+	s, err := recovered.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := s.SectorCipherKeyOfGeneration(0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.Key(), oldKey.Key()) {
+		t.Errorf("unexpected cipher key of generation 0 in the snapshot")
+	}
+	if _, err = s.SectorCipherKeyOfGeneration(2, 0, 0); err != errKeyGenerationUnknown {
+		t.Errorf("expect error %v, got %v", errKeyGenerationUnknown, err)
+	}
+}
+
+// TestRotateCipherKey_DropUnused test the generations no longer used by any sector are dropped,
+// and the sector of a dropped generation is rejected
+func TestRotateCipherKey_DropUnused(t *testing.T) {
+	df, err := newTestDxFile(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i != 2; i++ {
+		ck, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = df.RotateCipherKey(ck); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(df.metadata.KeyGenerations) != 1 || df.metadata.KeyGenerations[0].Generation != 2 {
+		t.Fatalf("unexpected key generations kept: %+v", df.metadata.KeyGenerations)
+	}
+	if err = df.AddSectorOfKeyGeneration(randomAddress(), randomHash(), 0, 0, 1); err != errKeyGenerationUnknown {
+		t.Errorf("expect error %v, got %v", errKeyGenerationUnknown, err)
+	}
+	if err = df.AddSectorOfKeyGeneration(randomAddress(), randomHash(), 0, 0, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key of a different overhead changes the sector size, and is rejected
+	plain, err := crypto.GenerateCipherKey(crypto.PlainCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = df.RotateCipherKey(plain); err == nil {
+		t.Errorf("the cipher key of a different overhead is rotated")
+	}
+	if gen := df.KeyGeneration(); gen != 2 {
+		t.Errorf("expect key generation 2, got %v", gen)
+	}
+}
+
+// TestSector_EncodeRLP_KeyGeneration test the sector of generation 0 is encoded the same as
+// version 1.0.0, and the sector of any generation fits in sectorPersistSize
+func TestSector_EncodeRLP_KeyGeneration(t *testing.T) {
+	legacy := struct {
+		MerkleRoot [32]byte
+		HostID     [32]byte
+	}{}
+	sector := randomSector()
+	legacy.MerkleRoot, legacy.HostID = sector.MerkleRoot, sector.HostID
+	expect, err := rlp.EncodeToBytes(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rlp.EncodeToBytes(sector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("sector of generation 0 not encoded as version 1.0.0")
+	}
+
+	for _, gen := range []uint8{1, 64, maxKeyGeneration} {
+		sector.KeyGeneration = gen
+		b, err := rlp.EncodeToBytes(sector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > len(expect)+1 || len(b) > sectorPersistSize {
+			t.Errorf("generation %v: encoded size %v larger than %v", gen, len(b), len(expect)+1)
+		}
+		var decoded *Sector
+		if err = rlp.DecodeBytes(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if *decoded != *sector {
+			t.Errorf("generation %v: expect %+v, got %+v", gen, sector, decoded)
+		}
+	}
+
+	// the generation out of bound is not decoded
+	sector.KeyGeneration = maxKeyGeneration + 1
+	if b, err = rlp.EncodeToBytes(sector); err != nil {
+		t.Fatal(err)
+	}
+	var decoded *Sector
+	if err = rlp.DecodeBytes(b, &decoded); err == nil {
+		t.Errorf("generation %v out of bound decoded", maxKeyGeneration+1)
+	}
+}
@@ -5,10 +5,12 @@
 package dxfile
 
 import (
+	"encoding/binary"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/log"
 	"github.com/DxChainNetwork/godx/storage"
@@ -59,8 +61,26 @@ type (
 		NumSectors      uint32 // params for erasure coding. The number of total Sectors
 		ECExtra         []byte // extra parameters for erasure code
 
-		// Version control for fork
+		// Version control for fork. The fields added after version 1.0.0 are placed after
+		// Version, and are decoded only if present, so that the Version of the metadata
+		// persisted by any version is found at the same index
 		Version string
+
+		// Renewal policy of the contracts storing the file
+		RenewalPolicy storage.RenewalPolicy
+
+		// Minimum number of distinct hosts storing the sectors of a healthy segment
+		MinSegmentHosts uint32
+
+		// The derivation of the keys encrypting the sectors from CipherKey
+		KeyDerivation uint8
+
+		// Checksum of the whole content of the source file, empty if unknown
+		Checksum common.Hash
+
+		// The cipher key generations still used by the sectors, the last being the current key
+		// of CipherKeyCode and CipherKey. Empty if the key is never rotated
+		KeyGenerations []CipherKeyGeneration
 	}
 
 	// UpdateMetaData is the Metadata to be updated
@@ -93,8 +113,8 @@ func (df *DxFile) LocalPath() storage.SysPath {
 
 // SetLocalPath change the value of local path and save to disk
 func (df *DxFile) SetLocalPath(path storage.SysPath) error {
-	df.lock.RLock()
-	defer df.lock.RUnlock()
+	df.lock.Lock()
+	defer df.lock.Unlock()
 
 	df.metadata.LocalPath = path
 	return df.saveMetadata()
@@ -145,8 +165,8 @@ func (df *DxFile) TimeAccess() time.Time {
 
 // SetTimeAccess set df.metadata.TimeAccess
 func (df *DxFile) SetTimeAccess(t time.Time) error {
-	df.lock.RLock()
-	defer df.lock.RUnlock()
+	df.lock.Lock()
+	defer df.lock.Unlock()
 	df.metadata.TimeAccess = uint64(t.Unix())
 	return df.saveMetadata()
 }
@@ -186,8 +206,8 @@ func (df *DxFile) TimeLastHealthCheck() time.Time {
 
 // SetTimeLastHealthCheck set and save df.metadata.TimeLastHealthCheck
 func (df *DxFile) SetTimeLastHealthCheck(t time.Time) error {
-	df.lock.RLock()
-	defer df.lock.RUnlock()
+	df.lock.Lock()
+	defer df.lock.Unlock()
 	df.metadata.TimeLastHealthCheck = uint64(t.Unix())
 	return df.saveMetadata()
 }
@@ -223,7 +243,11 @@ func (df *DxFile) SegmentSize() uint64 {
 func (df *DxFile) CipherKey() (crypto.CipherKey, error) {
 	df.lock.RLock()
 	defer df.lock.RUnlock()
+	return df.getCipherKey()
+}
 
+// getCipherKey return the cipher key. The caller shall hold the lock
+func (df *DxFile) getCipherKey() (crypto.CipherKey, error) {
 	if df.cipherKey != nil {
 		return df.cipherKey, nil
 	}
@@ -240,12 +264,15 @@ func (df *DxFile) CipherKey() (crypto.CipherKey, error) {
 func (df *DxFile) ErasureCode() (erasurecode.ErasureCoder, error) {
 	df.lock.RLock()
 	defer df.lock.RUnlock()
+	return df.getErasureCode()
+}
 
+// getErasureCode return the erasure code. The caller shall hold the lock
+func (df *DxFile) getErasureCode() (erasurecode.ErasureCoder, error) {
 	if df.erasureCode != nil {
 		return df.erasureCode, nil
 	}
-	ec, err := erasurecode.New(df.metadata.ErasureCodeType, df.metadata.MinSectors, df.metadata.NumSectors,
-		df.metadata.ECExtra)
+	ec, err := df.metadata.newErasureCode()
 	if err != nil {
 		// this shall not happen
 		log.Error("New erasure code return an error: %v", err)
@@ -279,3 +306,100 @@ func (df *DxFile) SectorSize() uint64 {
 
 	return df.metadata.SectorSize
 }
+
+// RenewalPolicy return the renewal policy of the dxfile
+func (df *DxFile) RenewalPolicy() storage.RenewalPolicy {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	return df.metadata.RenewalPolicy
+}
+
+// SetRenewalPolicy change the value of df.metadata.RenewalPolicy and save it to file
+func (df *DxFile) SetRenewalPolicy(policy storage.RenewalPolicy) error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	df.metadata.RenewalPolicy = policy
+
+	return df.saveMetadata()
+}
+
+// MinSegmentHosts return the minimum number of distinct hosts storing the sectors of a healthy segment
+func (df *DxFile) MinSegmentHosts() uint32 {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	return df.metadata.MinSegmentHosts
+}
+
+// SetMinSegmentHosts change the value of df.metadata.MinSegmentHosts and save it to file.
+// The value cannot be larger than the number of sectors of a segment
+func (df *DxFile) SetMinSegmentHosts(minHosts uint32) error {
+	return df.BatchUpdate(func(b *Batch) error {
+		return b.SetMinSegmentHosts(minHosts)
+	})
+}
+
+// KeyDerivation return the derivation of the keys encrypting the sectors
+func (df *DxFile) KeyDerivation() uint8 {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	return df.metadata.KeyDerivation
+}
+
+// SetKeyDerivation change the value of df.metadata.KeyDerivation and save it to file.
+// The key derivation can only be changed before any sector is uploaded
+func (df *DxFile) SetKeyDerivation(derivation uint8) error {
+	return df.BatchUpdate(func(b *Batch) error {
+		return b.SetKeyDerivation(derivation)
+	})
+}
+
+// Checksum return the checksum of the whole content of the file
+func (df *DxFile) Checksum() common.Hash {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	return df.metadata.Checksum
+}
+
+// SetChecksum change the value of df.metadata.Checksum and save it to file
+func (df *DxFile) SetChecksum(checksum common.Hash) error {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+
+	df.metadata.Checksum = checksum
+
+	return df.saveMetadata()
+}
+
+// SectorCipherKey return the key encrypting the sector at the sector index of the segment
+// with the current cipher key
+func (df *DxFile) SectorCipherKey(segmentIndex, sectorIndex uint64) (crypto.CipherKey, error) {
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	ck, err := df.getCipherKey()
+	if err != nil {
+		return nil, err
+	}
+	return sectorCipherKey(ck, df.metadata.KeyDerivation, segmentIndex, sectorIndex)
+}
+
+// sectorCipherKey derives the key encrypting the sector from the master key of the file.
+// With KeyDerivationNone, the master key is used for all sectors
+func sectorCipherKey(master crypto.CipherKey, derivation uint8, segmentIndex, sectorIndex uint64) (crypto.CipherKey, error) {
+	switch derivation {
+	case KeyDerivationNone:
+		return master, nil
+	case KeyDerivationSector:
+		nonce := make([]byte, 16)
+		binary.LittleEndian.PutUint64(nonce[:8], segmentIndex)
+		binary.LittleEndian.PutUint64(nonce[8:], sectorIndex)
+		return crypto.DeriveCipherKey(master, nonce)
+	default:
+		return nil, fmt.Errorf("unknown key derivation %v", derivation)
+	}
+}
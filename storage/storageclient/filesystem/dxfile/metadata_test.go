@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"testing"
 
+	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
 )
 
@@ -75,6 +76,68 @@ func TestNewErasureCode_ErasureCodeToParams(t *testing.T) {
 	}
 }
 
+// TestSectorCipherKey test the sector keys derived are deterministic and distinct for each
+// sector, and the data encrypted by a sector key can only be decrypted by the same key
+func TestSectorCipherKey(t *testing.T) {
+	master, err := crypto.GenerateCipherKey(crypto.GCMCipherCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without derivation, the master key is used for all sectors
+	key, err := sectorCipherKey(master, KeyDerivationNone, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.Key(), master.Key()) {
+		t.Errorf("key derivation none should return the master key")
+	}
+
+	indexes := [][2]uint64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
+	keys := make([]crypto.CipherKey, 0, len(indexes))
+	for _, index := range indexes {
+		key, err := sectorCipherKey(master, KeyDerivationSector, index[0], index[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := sectorCipherKey(master, KeyDerivationSector, index[0], index[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key.Key(), again.Key()) {
+			t.Errorf("sector %v: derived keys not deterministic", index)
+		}
+		if bytes.Equal(key.Key(), master.Key()) {
+			t.Errorf("sector %v: derived key equals to the master key", index)
+		}
+		for j, prev := range keys {
+			if bytes.Equal(key.Key(), prev.Key()) {
+				t.Errorf("sector %v: derived key equals to the key of sector %v", index, indexes[j])
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	data := []byte("the sector data to be encrypted")
+	cipherData, err := keys[0].Encrypt(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = keys[1].Decrypt(cipherData); err == nil {
+		t.Errorf("data decrypted with the key of another sector")
+	}
+	plainData, err := keys[0].Decrypt(cipherData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plainData, data) {
+		t.Errorf("decrypted data not expected. Want %x, Got %x", data, plainData)
+	}
+
+	if _, err = sectorCipherKey(master, KeyDerivationSector+1, 0, 0); err == nil {
+		t.Errorf("unknown key derivation should return an error")
+	}
+}
+
 // makeUint32Byte return a 32 byte as the value of num
 func makeUint32Byte(num uint32) []byte {
 	uint32Byte := make([]byte, 4)
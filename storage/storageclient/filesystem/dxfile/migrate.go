@@ -0,0 +1,193 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// errNewerVersion is the error returned if the DxFile is persisted by a newer version than
+// the Version supported
+var errNewerVersion = errors.New("dxfile persisted by a newer version")
+
+// migration upgrades the persisted data of a DxFile from the layout of version from to the
+// layout of version to. upgrade takes the metadata and the persisted data of the whole file,
+// and return the data in the new layout. The metadata is encoded in the new layout after all
+// migrations are applied, so upgrade only updates the fields of the metadata, for example the
+// SegmentOffset if the segments are moved.
+//
+// The layout of the segments depends on segmentPersistNumPages, so a migration changing
+// sectorPersistSize or segmentPersistOverhead shall move each segment to the offset of the
+// new layout
+type migration struct {
+	from    string
+	to      string
+	upgrade func(md *Metadata, raw []byte) ([]byte, error)
+}
+
+// migrations are the migrations applied in order to the DxFile persisted by an older version.
+// A new Version shall append the migration from the previous Version
+var migrations = []migration{
+	// Version 1.1.0 encodes the cipher key generation of the sectors encrypted with a rotated
+	// key, which version 1.0.0 cannot decode. The layout is otherwise unchanged
+	{from: "1.0.0", to: "1.1.0", upgrade: func(md *Metadata, raw []byte) ([]byte, error) {
+		return raw, nil
+	}},
+	// Version 1.2.0 appends the checksum to the metadata and each segment. The checksum of the
+	// metadata is appended when the metadata is encoded
+	{from: "1.1.0", to: checksumVersion, upgrade: appendSegmentChecksums},
+}
+
+// appendSegmentChecksums appends the checksum to the segments persisted without the checksum
+func appendSegmentChecksums(md *Metadata, raw []byte) ([]byte, error) {
+	segmentSize := PageSize * segmentPersistNumPages(md.NumSectors)
+	for i := uint64(0); i < md.numSegments(); i++ {
+		start := md.SegmentOffset + i*segmentSize
+		if start >= uint64(len(raw)) {
+			break
+		}
+		end := start + segmentSize
+		if end > uint64(len(raw)) {
+			end = uint64(len(raw))
+		}
+		kind, _, rest, err := rlp.Split(raw[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %v", i, err)
+		}
+		if kind != rlp.List {
+			return nil, fmt.Errorf("segment %d not encoded as a list", i)
+		}
+		size := end - start - uint64(len(rest))
+		if size+checksumSize > segmentSize {
+			return nil, fmt.Errorf("segment %d has no space for the checksum", i)
+		}
+		if gap := int(start+size+checksumSize) - len(raw); gap > 0 {
+			raw = append(raw, make([]byte, gap)...)
+		}
+		binary.BigEndian.PutUint32(raw[start+size:], crc32.ChecksumIEEE(raw[start:start+size]))
+	}
+	return raw, nil
+}
+
+// metadataVersionIndex is the index of Version in the rlp list of the Metadata persisted by
+// version 1.0.0. A new field of the Metadata shall be added after Version, so that the Version
+// of the metadata persisted by any version is decoded at the same index
+const metadataVersionIndex = 24
+
+// migrate upgrades the persisted data of the DxFile of an older version to the layout of the
+// current Version, and writes the upgraded data. md is the metadata decoded from raw, which is
+// the persisted data of the whole file. md is updated to the current Version
+func (df *DxFile) migrate(md *Metadata, raw []byte) error {
+	upgraded := *md
+	for upgraded.Version != Version {
+		var applied bool
+		for _, m := range migrations {
+			if m.from != upgraded.Version {
+				continue
+			}
+			var err error
+			if raw, err = m.upgrade(&upgraded, raw); err != nil {
+				return fmt.Errorf("cannot migrate from version %v to %v: %v", m.from, m.to, err)
+			}
+			upgraded.Version, applied = m.to, true
+			break
+		}
+		if !applied {
+			return fmt.Errorf("no migration from version %v", upgraded.Version)
+		}
+	}
+	if err := upgraded.validate(); err != nil {
+		return fmt.Errorf("invalid metadata migrated: %v", err)
+	}
+
+	// Encode the metadata in the current layout
+	metaBytes, err := encodeMetadata(&upgraded)
+	if err != nil {
+		return err
+	}
+	if uint64(len(metaBytes)) > upgraded.HostTableOffset || len(metaBytes) > len(raw) {
+		return fmt.Errorf("metadata migrated should not have length larger than %v", upgraded.HostTableOffset)
+	}
+	copy(raw, metaBytes)
+
+	// Rewrite the whole file in one transaction
+	du, err := df.createDeleteUpdate()
+	if err != nil {
+		return err
+	}
+	iu, err := df.createInsertUpdate(0, raw)
+	if err != nil {
+		return err
+	}
+	if err = df.applyUpdates([]storage.FileUpdate{du, iu}); err != nil {
+		return err
+	}
+	*md = upgraded
+	return nil
+}
+
+// persistedVersion return the Version of the metadata encoded in metaBytes. Only the version is
+// decoded, since the layout of the other fields depends on the version
+func persistedVersion(metaBytes []byte) (string, error) {
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(metaBytes, &fields); err != nil {
+		return "", err
+	}
+	if len(fields) <= metadataVersionIndex {
+		return "", fmt.Errorf("metadata has %v fields, version not found", len(fields))
+	}
+	var version string
+	if err := rlp.DecodeBytes(fields[metadataVersionIndex], &version); err != nil {
+		return "", fmt.Errorf("cannot decode version: %v", err)
+	}
+	return version, nil
+}
+
+// compareVersion compares the versions in the form of major.minor.patch. Return -1 if v1 is
+// older than v2, 1 if v1 is newer than v2, and 0 if equal
+func compareVersion(v1, v2 string) (int, error) {
+	n1, err := parseVersion(v1)
+	if err != nil {
+		return 0, err
+	}
+	n2, err := parseVersion(v2)
+	if err != nil {
+		return 0, err
+	}
+	for i := range n1 {
+		if n1[i] < n2[i] {
+			return -1, nil
+		}
+		if n1[i] > n2[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// parseVersion parses the version in the form of major.minor.patch
+func parseVersion(version string) ([3]uint64, error) {
+	var nums [3]uint64
+	parts := strings.Split(version, ".")
+	if len(parts) != len(nums) {
+		return nums, fmt.Errorf("invalid version %q", version)
+	}
+	for i, part := range parts {
+		num, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nums, fmt.Errorf("invalid version %q", version)
+		}
+		nums[i] = num
+	}
+	return nums, nil
+}
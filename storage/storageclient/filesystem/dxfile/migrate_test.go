@@ -0,0 +1,232 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package dxfile
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
+)
+
+// TestReadDxFile_Migrate test the DxFile persisted by version 1.0.0 is upgraded to the current
+// version on load, and the upgraded file validates with the checksums
+func TestReadDxFile_Migrate(t *testing.T) {
+	df, err := newTestDxFileWithSegments(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLegacyDxFile(t, df)
+	filename := df.filePath
+
+	migrated, err := readDxFile(filename, df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated.metadata.Version != Version {
+		t.Errorf("expect version %v, got %v", Version, migrated.metadata.Version)
+	}
+	df.metadata.Version = Version
+	if err = checkDxFileEqual(df, migrated); err != nil {
+		t.Fatal(err)
+	}
+
+	// the upgraded file is persisted
+	recovered, err := readDxFile(filename, df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = recovered.metadata.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err = checkDxFileEqual(df, recovered); err != nil {
+		t.Fatal(err)
+	}
+	// the segments are upgraded with the checksum
+	if corrupted := recovered.CorruptSegments(); len(corrupted) != 0 {
+		t.Errorf("segments %v corrupted after migration", corrupted)
+	}
+}
+
+// TestMetadataVersionIndex test the Version of the Metadata stays at the index of version 1.0.0
+func TestMetadataVersionIndex(t *testing.T) {
+	field, _ := reflect.TypeOf(Metadata{}).FieldByName("Version")
+	if field.Index[0] != metadataVersionIndex {
+		t.Fatalf("Version moved from index %v to %v", metadataVersionIndex, field.Index[0])
+	}
+	field, _ = reflect.TypeOf(metadataV100{}).FieldByName("Version")
+	if field.Index[0] != metadataVersionIndex {
+		t.Fatalf("Version of version 1.0.0 at index %v, expect %v", field.Index[0], metadataVersionIndex)
+	}
+}
+
+// TestReadDxFile_NewerVersion test the DxFile persisted by a newer version is not loaded
+func TestReadDxFile_NewerVersion(t *testing.T) {
+	df, err := newTestDxFileWithSegments(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	df.metadata.Version = "99.0.0"
+	if err = df.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = readDxFile(df.filePath, df.wal)
+	if err == nil || !strings.Contains(err.Error(), errNewerVersion.Error()) {
+		t.Errorf("expect error %v, got %v", errNewerVersion, err)
+	}
+}
+
+// TestCompareVersion test the comparison of the versions
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		v1, v2 string
+		expect int
+		err    bool
+	}{
+		{"1.0.0", "1.0.0", 0, false},
+		{"1.0.0", "1.1.0", -1, false},
+		{"1.10.0", "1.9.0", 1, false},
+		{"2.0.0", "1.99.99", 1, false},
+		{"1.0.1", "1.0.0", 1, false},
+		{"1.0", "1.0.0", 0, true},
+		{"", "1.0.0", 0, true},
+		{"1.a.0", "1.0.0", 0, true},
+	}
+	for _, test := range tests {
+		cmp, err := compareVersion(test.v1, test.v2)
+		if (err != nil) != test.err {
+			t.Errorf("%v vs %v: unexpected error %v", test.v1, test.v2, err)
+			continue
+		}
+		if cmp != test.expect {
+			t.Errorf("%v vs %v: expect %v, got %v", test.v1, test.v2, test.expect, cmp)
+		}
+	}
+}
+
+// metadataV100 is the layout of the Metadata persisted by version 1.0.0
+type metadataV100 struct {
+	ID                  FileID
+	HostTableOffset     uint64
+	SegmentOffset       uint64
+	FileSize            uint64
+	SectorSize          uint64
+	LocalPath           storage.SysPath
+	DxPath              storage.DxPath
+	CipherKeyCode       uint8
+	CipherKey           []byte
+	TimeModify          uint64
+	TimeUpdate          uint64
+	TimeAccess          uint64
+	TimeCreate          uint64
+	Health              uint32
+	StuckHealth         uint32
+	TimeLastHealthCheck uint64
+	NumStuckSegments    uint32
+	TimeRecentRepair    uint64
+	LastRedundancy      uint32
+	FileMode            os.FileMode
+	ErasureCodeType     uint8
+	MinSectors          uint32
+	NumSectors          uint32
+	ECExtra             []byte
+	Version             string
+}
+
+// segmentV100 and sectorV100 are the layout of the segment persisted by version 1.0.0
+type (
+	segmentV100 struct {
+		Sectors [][]*sectorV100
+		Index   uint64
+		Stuck   bool
+	}
+
+	sectorV100 struct {
+		MerkleRoot common.Hash
+		HostID     enode.ID
+	}
+)
+
+// writeLegacyDxFile rewrites the DxFile in the layout of version 1.0.0, where the metadata and
+// the segments are encoded with the structures of version 1.0.0 without the checksum. The fields
+// added after version 1.0.0 are reset in df, since they are not persisted
+func writeLegacyDxFile(t *testing.T, df *DxFile) {
+	md := df.metadata
+	md.RenewalPolicy, md.MinSegmentHosts, md.KeyDerivation = 0, 0, KeyDerivationNone
+	md.Checksum, md.KeyGenerations = common.Hash{}, nil
+	metaBytes, err := rlp.EncodeToBytes(&metadataV100{
+		ID:                  md.ID,
+		HostTableOffset:     md.HostTableOffset,
+		SegmentOffset:       md.SegmentOffset,
+		FileSize:            md.FileSize,
+		SectorSize:          md.SectorSize,
+		LocalPath:           md.LocalPath,
+		DxPath:              md.DxPath,
+		CipherKeyCode:       md.CipherKeyCode,
+		CipherKey:           md.CipherKey,
+		TimeModify:          md.TimeModify,
+		TimeUpdate:          md.TimeUpdate,
+		TimeAccess:          md.TimeAccess,
+		TimeCreate:          md.TimeCreate,
+		Health:              md.Health,
+		StuckHealth:         md.StuckHealth,
+		TimeLastHealthCheck: md.TimeLastHealthCheck,
+		NumStuckSegments:    md.NumStuckSegments,
+		TimeRecentRepair:    md.TimeRecentRepair,
+		LastRedundancy:      md.LastRedundancy,
+		FileMode:            md.FileMode,
+		ErasureCodeType:     md.ErasureCodeType,
+		MinSectors:          md.MinSectors,
+		NumSectors:          md.NumSectors,
+		ECExtra:             md.ECExtra,
+		Version:             "1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := persistedVersion(metaBytes); err != nil || version != "1.0.0" {
+		t.Fatalf("cannot read the version of the legacy metadata: %v %v", version, err)
+	}
+	hostTableBytes, err := rlp.EncodeToBytes(df.hostTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segmentSize := PageSize * segmentPersistNumPages(md.NumSectors)
+	raw := make([]byte, md.SegmentOffset+uint64(len(df.segments))*segmentSize)
+	copy(raw, metaBytes)
+	copy(raw[md.HostTableOffset:], hostTableBytes)
+	for i, seg := range df.segments {
+		legacy := segmentV100{Sectors: make([][]*sectorV100, len(seg.Sectors)), Index: seg.Index, Stuck: seg.Stuck}
+		for j, sectors := range seg.Sectors {
+			legacy.Sectors[j] = make([]*sectorV100, 0, len(sectors))
+			for _, sector := range sectors {
+				legacy.Sectors[j] = append(legacy.Sectors[j], &sectorV100{MerkleRoot: sector.MerkleRoot, HostID: sector.HostID})
+			}
+		}
+		segBytes, err := rlp.EncodeToBytes(&legacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(raw[md.SegmentOffset+uint64(i)*segmentSize:], segBytes)
+	}
+
+	du, err := df.createDeleteUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iu, err := df.createInsertUpdate(0, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = df.applyUpdates([]storage.FileUpdate{du, iu}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,8 +6,11 @@ package dxfile
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"reflect"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/crypto"
@@ -21,13 +24,43 @@ const (
 	// PageSize is the page size of persist Data
 	PageSize = 4096
 
-	// sectorPersistSize is the size of rlp encoded string of a Sector
+	// sectorPersistSize is the size reserved for the rlp encoded string of a Sector. The sector
+	// of generation 0 is encoded in 68 bytes, and the key generation not larger than
+	// maxKeyGeneration adds a single byte
 	sectorPersistSize = 70
 
-	// Overhead for persistSegment persist Data. The value is larger than Data actually used
+	// Overhead for persistSegment persist Data, including the checksum. The value is larger
+	// than Data actually used
 	segmentPersistOverhead = 32
+
+	// checksumSize is the size of the checksum following the persisted metadata and segments
+	checksumSize = crc32.Size
+
+	// checksumVersion is the first version persisting the checksums
+	checksumVersion = "1.2.0"
+)
+
+var (
+	// errChecksumMismatch is the error returned if the persisted data does not match its checksum
+	errChecksumMismatch = errors.New("checksum mismatch")
+
+	// errCorruptMetadata is the error returned if the persisted metadata fails the integrity check
+	errCorruptMetadata = errors.New("dxfile metadata corrupted")
 )
 
+// ErrCorruptSegment is the error of a persisted segment failing the integrity check. The other
+// segments of the DxFile are still loaded, and the segment corrupted is loaded as an empty
+// segment to be repaired
+type ErrCorruptSegment struct {
+	Index uint64
+	Err   error
+}
+
+// Error implements error interface
+func (e *ErrCorruptSegment) Error() string {
+	return fmt.Sprintf("segment %d corrupted: %v", e.Index, e.Err)
+}
+
 type (
 	// persistHostTable is unmarshaled form of hostTable. Instead of a map, it is marshaled as slice
 	persistHostTable []*persistHostAddress
@@ -45,10 +78,13 @@ type (
 		Stuck   bool        // Stuck indicates whether the Segment is Stuck or not
 	}
 
-	// persistSector is the smallest unit of storage. It the erasure code encoded persistSegment
+	// persistSector is the smallest unit of storage. It the erasure code encoded persistSegment.
+	// The key generation is encoded only if not 0, so that the sectors never rotated are
+	// encoded the same as in version 1.0.0
 	persistSector struct {
-		MerkleRoot common.Hash
-		HostID     enode.ID
+		MerkleRoot    common.Hash
+		HostID        enode.ID
+		KeyGeneration []uint64 `rlp:"tail"`
 	}
 )
 
@@ -86,10 +122,14 @@ func (ht hostTable) DecodeRLP(st *rlp.Stream) error {
 
 // EncodeRLP of Sector implements rlp encode rule
 func (s *Sector) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, persistSector{
+	ps := persistSector{
 		MerkleRoot: s.MerkleRoot,
 		HostID:     s.HostID,
-	})
+	}
+	if s.KeyGeneration != 0 {
+		ps.KeyGeneration = []uint64{uint64(s.KeyGeneration)}
+	}
+	return rlp.Encode(w, ps)
 }
 
 // DecodeRLP of Sector implements rlp decode rule
@@ -98,7 +138,17 @@ func (s *Sector) DecodeRLP(st *rlp.Stream) error {
 	if err := st.Decode(&ps); err != nil {
 		return err
 	}
-	s.MerkleRoot, s.HostID = ps.MerkleRoot, ps.HostID
+	s.MerkleRoot, s.HostID, s.KeyGeneration = ps.MerkleRoot, ps.HostID, 0
+	switch len(ps.KeyGeneration) {
+	case 0:
+	case 1:
+		if ps.KeyGeneration[0] > maxKeyGeneration {
+			return fmt.Errorf("sector key generation %v out of bound", ps.KeyGeneration[0])
+		}
+		s.KeyGeneration = uint8(ps.KeyGeneration[0])
+	default:
+		return fmt.Errorf("unexpected sector fields: %v", ps.KeyGeneration)
+	}
 	return nil
 }
 
@@ -121,6 +171,76 @@ func (s *Segment) DecodeRLP(st *rlp.Stream) error {
 	return nil
 }
 
+// EncodeRLP of Metadata implements rlp encode rule. The metadata is encoded as the list of its
+// fields in order, which is the same as the layout of version 1.0.0 followed by the fields
+// added after Version
+func (md *Metadata) EncodeRLP(w io.Writer) error {
+	v := reflect.ValueOf(md).Elem()
+	fields := make([]interface{}, v.NumField())
+	for i := range fields {
+		fields[i] = v.Field(i).Addr().Interface()
+	}
+	return rlp.Encode(w, fields)
+}
+
+// DecodeRLP of Metadata implements rlp decode rule. The fields up to Version are required. The
+// fields after Version are not persisted by the older versions, and are left as zero values if
+// not present. The metadata of the file never rotated has no key generations, which is decoded
+// as nil
+func (md *Metadata) DecodeRLP(st *rlp.Stream) error {
+	if _, err := st.List(); err != nil {
+		return err
+	}
+	*md = Metadata{}
+	v := reflect.ValueOf(md).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		err := st.Decode(v.Field(i).Addr().Interface())
+		if err == rlp.EOL && i > metadataVersionIndex {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot decode metadata field %v: %v", v.Type().Field(i).Name, err)
+		}
+	}
+	if len(md.KeyGenerations) == 0 {
+		md.KeyGenerations = nil
+	}
+	return st.ListEnd()
+}
+
+// appendChecksum appends the checksum of the rlp encoded data b to b
+func appendChecksum(b []byte) []byte {
+	checksum := make([]byte, checksumSize)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(b))
+	return append(b, checksum...)
+}
+
+// verifyChecksum verifies the checksum following the rlp encoded data at the start of b, and
+// return the rlp encoded data
+func verifyChecksum(b []byte) ([]byte, error) {
+	_, _, rest, err := rlp.Split(b)
+	if err != nil {
+		return nil, err
+	}
+	data := b[:len(b)-len(rest)]
+	if len(rest) < checksumSize {
+		return nil, errChecksumMismatch
+	}
+	if binary.BigEndian.Uint32(rest[:checksumSize]) != crc32.ChecksumIEEE(data) {
+		return nil, errChecksumMismatch
+	}
+	return data, nil
+}
+
+// encodeMetadata encodes the metadata with the checksum
+func encodeMetadata(md *Metadata) ([]byte, error) {
+	metaBytes, err := rlp.EncodeToBytes(md)
+	if err != nil {
+		return nil, err
+	}
+	return appendChecksum(metaBytes), nil
+}
+
 // segmentPersistSize is the helper function to calculate the number of pages to be used for
 // the persist of a Segment
 func segmentPersistNumPages(numSectors uint32) uint64 {
@@ -163,7 +283,14 @@ func (md Metadata) newErasureCode() (erasurecode.ErasureCoder, error) {
 		} else {
 			shardSize = erasurecode.EncodedShardUnit
 		}
-		return erasurecode.New(md.ErasureCodeType, md.MinSectors, md.NumSectors, shardSize)
+		ec, err := erasurecode.New(md.ErasureCodeType, md.MinSectors, md.NumSectors, shardSize)
+		if err != nil {
+			return nil, err
+		}
+		if size, sharded := ec.ShardSize(); !sharded || size != shardSize {
+			return nil, fmt.Errorf("erasure code not sharded with the shard size %v", shardSize)
+		}
+		return ec, nil
 	default:
 		return nil, erasurecode.ErrInvalidECType
 	}
@@ -178,9 +305,11 @@ func erasureCodeToParams(ec erasurecode.ErasureCoder) (uint32, uint32, []byte, e
 	case erasurecode.ECTypeStandard:
 		return minSectors, numSectors, nil, nil
 	case erasurecode.ECTypeShard:
-		extra := ec.Extra()
+		shardSize, sharded := ec.ShardSize()
+		if !sharded {
+			return 0, 0, []byte{}, fmt.Errorf("shard size of the erasure code type %v unknown", ec.Type())
+		}
 		extraBytes := make([]byte, 4)
-		shardSize := extra[0].(int)
 		binary.LittleEndian.PutUint32(extraBytes, uint32(shardSize))
 		return minSectors, numSectors, extraBytes, nil
 	default:
@@ -201,9 +330,5 @@ func (md Metadata) segmentSize() uint64 {
 
 // numSegments is the number of segments of a dxfile based on metadata info
 func (md Metadata) numSegments() uint64 {
-	num := md.FileSize / md.segmentSize()
-	if md.FileSize%md.segmentSize() != 0 || num == 0 {
-		num++
-	}
-	return num
+	return common.NumSegments(md.FileSize, md.segmentSize())
 }
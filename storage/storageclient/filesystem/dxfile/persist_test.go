@@ -112,7 +112,7 @@ func TestMetadata_EncodeRLP_DecodeRLP(t *testing.T) {
 		ECExtra:             []byte{},
 		Version:             "1.0.0",
 	}
-	b, err := rlp.EncodeToBytes(meta)
+	b, err := rlp.EncodeToBytes(&meta)
 	if err != nil {
 		t.Fatalf(err.Error())
 	}
@@ -125,3 +125,44 @@ func TestMetadata_EncodeRLP_DecodeRLP(t *testing.T) {
 		t.Errorf("not Equal\n\texpect %+v\n\tgot %+v", meta, md)
 	}
 }
+
+// TestErasureCodeToParams test the erasure code converted to the params of the metadata is
+// recovered by Metadata.newErasureCode
+func TestErasureCodeToParams(t *testing.T) {
+	tests := []struct {
+		ecType uint8
+		extra  []interface{}
+	}{
+		{erasurecode.ECTypeStandard, nil},
+		{erasurecode.ECTypeShard, nil},
+		{erasurecode.ECTypeShard, []interface{}{erasurecode.EncodedShardUnit * 4}},
+	}
+	for i, test := range tests {
+		ec, err := erasurecode.New(test.ecType, 10, 30, test.extra...)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		minSectors, numSectors, extra, err := erasureCodeToParams(ec)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		md := Metadata{
+			ErasureCodeType: ec.Type(),
+			MinSectors:      minSectors,
+			NumSectors:      numSectors,
+			ECExtra:         extra,
+		}
+		recovered, err := md.newErasureCode()
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(ec.Extra(), recovered.Extra()) || ec.MinSectors() != recovered.MinSectors() || ec.NumSectors() != recovered.NumSectors() {
+			t.Errorf("test %d: erasure code not recovered", i)
+		}
+		shardSize, sharded := ec.ShardSize()
+		recoveredSize, recoveredSharded := recovered.ShardSize()
+		if shardSize != recoveredSize || sharded != recoveredSharded {
+			t.Errorf("test %d: expect shard size %v/%v, got %v/%v", i, shardSize, sharded, recoveredSize, recoveredSharded)
+		}
+	}
+}
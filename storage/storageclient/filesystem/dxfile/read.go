@@ -7,9 +7,11 @@ package dxfile
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/DxChainNetwork/godx/common/writeaheadlog"
+	"github.com/DxChainNetwork/godx/log"
 	"github.com/DxChainNetwork/godx/rlp"
 	"github.com/DxChainNetwork/godx/storage"
 )
@@ -17,26 +19,56 @@ import (
 // readDxFile create a new DxFile with a random ID, then open and read the dxfile from filepath
 // and load all params from the file.
 func readDxFile(filepath storage.SysPath, wal *writeaheadlog.Wal) (*DxFile, error) {
+	return readDxFileFromBackend(filepath, NewLocalBackend(wal))
+}
+
+// readDxFileFromBackend read the dxfile persisted at filepath of the backend and load all
+// params from the persisted data
+func readDxFileFromBackend(filepath storage.SysPath, backend PersistBackend) (*DxFile, error) {
 	df := &DxFile{
-		filePath: filepath,
-		wal:      wal,
+		filePath:         filepath,
+		wal:              walOf(backend),
+		backend:          backend,
+		compactThreshold: DefaultCompactThreshold,
+		corruptSegments:  make(map[uint64]struct{}),
 	}
-	f, err := os.OpenFile(string(filepath), os.O_RDONLY, 0777)
+	f, err := newPageReader(backend, string(filepath))
 	if os.IsNotExist(err) {
-		return nil, err
+		return nil, os.ErrNotExist
 	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot open file %s: %v", filepath, err)
+		return nil, err
 	}
-	defer f.Close()
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
 	// load data
-	if err = df.loadMetadata(f); err != nil {
+	if err := df.loadMetadata(f); err != nil {
 		return nil, fmt.Errorf("cannot load metadata: %v", err)
 	}
-	if err = df.loadHostAddresses(f); err != nil {
+	// Upgrade the file persisted by an older version, and load the upgraded file
+	if df.metadata.Version != Version {
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		raw, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the file to migrate: %v", err)
+		}
+		if err = df.migrate(df.metadata, raw); err != nil {
+			return nil, fmt.Errorf("cannot migrate from version %v: %v", df.metadata.Version, err)
+		}
+		f.Close()
+		if f, err = newPageReader(backend, string(filepath)); err != nil {
+			return nil, fmt.Errorf("cannot open the migrated file: %v", err)
+		}
+	}
+	if err := df.loadHostAddresses(f); err != nil {
 		return nil, fmt.Errorf("cannot load host addresses: %v", err)
 	}
-	if err = df.loadSegments(f); err != nil {
+	if err := df.loadSegments(f); err != nil {
 		return nil, fmt.Errorf("cannot load segments: %v", err)
 	}
 	// New erasure code
@@ -50,12 +82,40 @@ func readDxFile(filepath storage.SysPath, wal *writeaheadlog.Wal) (*DxFile, erro
 	return df, nil
 }
 
-// readMetadata load metadata from the file
+// readMetadata load metadata from the file. The metadata persisted by a newer version is not
+// decoded, since the layout may not be understood
 func (df *DxFile) loadMetadata(f io.Reader) error {
-	err := rlp.Decode(f, &df.metadata)
+	page := make([]byte, PageSize)
+	n, err := io.ReadFull(f, page)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	page = page[:n]
+	_, _, rest, err := rlp.Split(page)
+	if err != nil {
+		return fmt.Errorf("%v: %v", errCorruptMetadata, err)
+	}
+	metaBytes := page[:len(page)-len(rest)]
+	version, err := persistedVersion(metaBytes)
 	if err != nil {
 		return err
 	}
+	cmp, err := compareVersion(version, Version)
+	if err != nil {
+		return err
+	}
+	if cmp > 0 {
+		return fmt.Errorf("%v: version %v, supported version %v", errNewerVersion, version, Version)
+	}
+	// The metadata persisted before checksumVersion has no checksum
+	if cmp, _ = compareVersion(version, checksumVersion); cmp >= 0 {
+		if _, err = verifyChecksum(page); err != nil {
+			return fmt.Errorf("%v: %v", errCorruptMetadata, err)
+		}
+	}
+	if err = rlp.DecodeBytes(metaBytes, &df.metadata); err != nil {
+		return err
+	}
 	// sanity check
 	if err = df.metadata.validate(); err != nil {
 		return err
@@ -93,11 +153,18 @@ func (df *DxFile) loadSegments(f io.ReadSeeker) error {
 	offset := uint64(df.metadata.SegmentOffset)
 	segmentSize := PageSize * segmentPersistNumPages(df.metadata.NumSectors)
 	df.segments = make([]*Segment, df.metadata.numSegments())
-	for i := 0; uint64(i) < df.metadata.numSegments(); i++ {
+	for i := 0; uint64(i) < df.metadata.numSegments(); i, offset = i+1, offset+segmentSize {
 		seg, err := df.readSegment(f, offset)
 		if err == io.EOF {
 			break
 		}
+		// The segment corrupted is left not allocated, so that it is loaded as an empty
+		// segment, and repaired
+		if cerr, ok := err.(*ErrCorruptSegment); ok {
+			log.Warn("dxfile segment corrupted", "dxpath", df.metadata.DxPath.Path, "err", cerr)
+			df.corruptSegments[cerr.Index] = struct{}{}
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("failed to load Segment at %d: %v", offset, err)
 		}
@@ -106,12 +173,12 @@ func (df *DxFile) loadSegments(f io.ReadSeeker) error {
 			return fmt.Errorf("duplicate Segment %d at %d", seg.Index, seg.offset)
 		}
 		df.segments[seg.Index] = seg
-		offset += segmentSize
 	}
 	return nil
 }
 
-// readSegment read a segment from the f at offset
+// readSegment read a segment from the f at offset, and verifies its checksum. If the segment
+// is corrupted, an ErrCorruptSegment is returned
 func (df *DxFile) readSegment(f io.ReadSeeker, offset uint64) (*Segment, error) {
 	if int64(offset) < 0 {
 		return nil, fmt.Errorf("int64 overflow")
@@ -120,13 +187,40 @@ func (df *DxFile) readSegment(f io.ReadSeeker, offset uint64) (*Segment, error)
 	if err != nil {
 		return nil, err
 	}
-	var seg *Segment
-	err = rlp.Decode(f, &seg)
-	if err != nil {
+	segmentSize := PageSize * segmentPersistNumPages(df.metadata.NumSectors)
+	b := make([]byte, segmentSize)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF {
 		return nil, err
 	}
+	// The segments are persisted in the order of the segment index
+	index := (offset - df.metadata.SegmentOffset) / segmentSize
+	segBytes, err := verifyChecksum(b[:n])
+	if err != nil {
+		return nil, &ErrCorruptSegment{Index: index, Err: err}
+	}
+	var seg *Segment
+	if err = rlp.DecodeBytes(segBytes, &seg); err != nil {
+		return nil, &ErrCorruptSegment{Index: index, Err: err}
+	}
+	if seg.Index != index {
+		return nil, &ErrCorruptSegment{Index: index, Err: fmt.Errorf("unexpected segment index %d", seg.Index)}
+	}
 	if len(seg.Sectors) != int(df.metadata.NumSectors) {
 		return nil, fmt.Errorf("segment does not have expected numSectors")
 	}
 	return seg, nil
 }
+
+// readSegmentIndex return the index of the segment persisted at offset. The index of the
+// segment corrupted is returned as well, so that the segment can be rewritten
+func (df *DxFile) readSegmentIndex(f io.ReadSeeker, offset uint64) (uint64, error) {
+	seg, err := df.readSegment(f, offset)
+	if cerr, ok := err.(*ErrCorruptSegment); ok {
+		return cerr.Index, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return seg.Index, nil
+}
@@ -8,11 +8,15 @@ import (
 	"bytes"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/common/writeaheadlog"
 	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
@@ -159,6 +163,109 @@ func TestDxFile_SaveSegment(t *testing.T) {
 	}
 }
 
+// TestDxFile_SaveDirty_CrashRecovery test the incremental save could be recovered from wal
+// if the program crashed after the wal transaction is committed but before it is applied
+func TestDxFile_SaveDirty_CrashRecovery(t *testing.T) {
+	minSectors := uint32(10)
+	numSectors := uint32(30)
+	fileSize := sectorSize * uint64(minSectors) * 10
+	df, err := newTestDxFileWithSegments(t, fileSize, minSectors, numSectors, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Edit one of the Segment and commit the updates to wal without applying
+	modifyIndex := rand.Intn(len(df.segments))
+	df.segments[modifyIndex].Sectors[0][0].MerkleRoot = randomHash()
+	df.segments[modifyIndex].dirty = true
+	updates, err := df.createDirtyUpdates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := make([]writeaheadlog.Operation, 0, len(updates))
+	for _, up := range updates {
+		op, err := up.EncodeToWalOp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, op)
+	}
+	txn, err := df.wal.NewTransaction(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-txn.InitComplete
+	if txn.InitErr != nil {
+		t.Fatal(txn.InitErr)
+	}
+	if err = <-txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// crash
+	if _, err = df.wal.CloseIncomplete(); err != nil {
+		t.Fatal(err)
+	}
+	// recover from wal
+	wal, txns, err := writeaheadlog.New(filepath.Join(string(testDir), t.Name()+".wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txns) != 1 {
+		t.Fatalf("expect 1 transaction recovered, got %v", len(txns))
+	}
+	for _, txn := range txns {
+		if err = storage.ApplyOperations(txn.Operations); err != nil {
+			t.Fatal(err)
+		}
+		if err = txn.Release(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path, err := storage.NewDxPath(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDF, err := readDxFile(testDir.Join(path), wal)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err = checkDxFileEqual(df, newDF); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// BenchmarkDxFile_SaveAll benchmark saving the whole DxFile after a single segment change
+func BenchmarkDxFile_SaveAll(b *testing.B) {
+	benchmarkDxFileSave(b, func(df *DxFile, index int) error {
+		return df.saveAll()
+	})
+}
+
+// BenchmarkDxFile_SaveDirty benchmark saving only the dirty segment after a single segment change
+func BenchmarkDxFile_SaveDirty(b *testing.B) {
+	benchmarkDxFileSave(b, func(df *DxFile, index int) error {
+		df.segments[index].dirty = true
+		return df.saveDirty()
+	})
+}
+
+func benchmarkDxFileSave(b *testing.B, save func(df *DxFile, index int) error) {
+	minSectors := uint32(10)
+	numSectors := uint32(30)
+	fileSize := sectorSize * uint64(minSectors) * 256
+	df, err := newTestDxFileWithSegments(b, fileSize, minSectors, numSectors, erasurecode.ECTypeStandard)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index := rand.Intn(len(df.segments))
+		df.segments[index].Sectors[0][0].MerkleRoot = randomHash()
+		if err = save(df, index); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // Two DxFile are exactly the same if the all fields other than file id are the same
 // (of course not including wal, lock, id, e.t.c
 func checkDxFileEqual(df1, df2 *DxFile) error {
@@ -169,7 +276,7 @@ func checkDxFileEqual(df1, df2 *DxFile) error {
 		return fmt.Errorf("length of segments not equal: %d / %d", len(df1.segments), len(df2.segments))
 	}
 	for i := range df1.segments {
-		if err := checkSegmentEqual(*df1.segments[i], *df2.segments[i]); err != nil {
+		if err := checkSegmentEqual(*df1.segment(i), *df2.segment(i)); err != nil {
 			return fmt.Errorf("segment[%d]: %v", i, err)
 		}
 	}
@@ -262,6 +369,9 @@ func checkMetadataEqual(md1, md2 *Metadata) error {
 	if md1.Version != md2.Version {
 		return fmt.Errorf("md.Version not equal:\n\t%+v\n\t%+v", md1.Version, md2.Version)
 	}
+	if !reflect.DeepEqual(md1.KeyGenerations, md2.KeyGenerations) {
+		return fmt.Errorf("md.KeyGenerations not equal:\n\t%+v\n\t%+v", md1.KeyGenerations, md2.KeyGenerations)
+	}
 	return nil
 }
 
@@ -294,3 +404,94 @@ func checkSegmentEqual(seg1, seg2 Segment) error {
 	}
 	return nil
 }
+
+// TestReadDxFile_CorruptSegment test the segment with bytes flipped on disk fails the checksum
+// verification, and the other segments are still loaded
+func TestReadDxFile_CorruptSegment(t *testing.T) {
+	df, err := newTestDxFileWithSegments(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptIndex := uint64(1)
+	segmentOffset := df.metadata.SegmentOffset + corruptIndex*PageSize*segmentPersistNumPages(df.metadata.NumSectors)
+	flipBytes(t, df.filePath, int64(segmentOffset)+100, 4)
+
+	f, err := newPageReader(df.backend, string(df.filePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = df.readSegment(f, segmentOffset)
+	f.Close()
+	if cerr, ok := err.(*ErrCorruptSegment); !ok || cerr.Index != corruptIndex {
+		t.Fatalf("expect corrupt segment %d, got %v", corruptIndex, err)
+	}
+
+	recovered, err := readDxFile(df.filePath, df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corrupted := recovered.CorruptSegments(); !reflect.DeepEqual(corrupted, []uint64{corruptIndex}) {
+		t.Fatalf("expect corrupt segments [%d], got %v", corruptIndex, corrupted)
+	}
+	for i, seg := range recovered.segments {
+		if uint64(i) == corruptIndex {
+			if seg != nil {
+				t.Errorf("corrupt segment %d loaded", i)
+			}
+			continue
+		}
+		if err = checkSegmentEqual(*df.segments[i], *seg); err != nil {
+			t.Errorf("segment %d: %v", i, err)
+		}
+	}
+
+	// the segment rewritten is no longer corrupted
+	recovered.segments[corruptIndex] = df.segments[corruptIndex]
+	if err = recovered.saveSegments([]int{int(corruptIndex)}); err != nil {
+		t.Fatal(err)
+	}
+	if corrupted := recovered.CorruptSegments(); len(corrupted) != 0 {
+		t.Errorf("segments %v still corrupted after rewritten", corrupted)
+	}
+	recovered, err = readDxFile(df.filePath, df.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkDxFileEqual(df, recovered); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReadDxFile_CorruptMetadata test the DxFile with the metadata corrupted is not loaded
+func TestReadDxFile_CorruptMetadata(t *testing.T) {
+	df, err := newTestDxFileWithSegments(t, SectorSize*64, 10, 30, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip the bytes of the file ID
+	flipBytes(t, df.filePath, 6, 4)
+
+	_, err = readDxFile(df.filePath, df.wal)
+	if err == nil || !strings.Contains(err.Error(), errCorruptMetadata.Error()) {
+		t.Errorf("expect error %v, got %v", errCorruptMetadata, err)
+	}
+}
+
+// flipBytes flips num bytes at offset of the file
+func flipBytes(t *testing.T, path storage.SysPath, offset int64, num int) {
+	f, err := os.OpenFile(string(path), os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, num)
+	if _, err = f.ReadAt(b, offset); err != nil {
+		t.Fatal(err)
+	}
+	for i := range b {
+		b[i] ^= 0xff
+	}
+	if _, err = f.WriteAt(b, offset); err != nil {
+		t.Fatal(err)
+	}
+}
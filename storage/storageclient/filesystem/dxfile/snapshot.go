@@ -22,6 +22,8 @@ type Snapshot struct {
 	sectorSize  uint64
 	erasureCode erasurecode.ErasureCoder
 	cipherKey   crypto.CipherKey
+	cipherKeys  map[uint8]crypto.CipherKey
+	derivation  uint8
 	fileMode    os.FileMode
 	segments    []Segment
 	hostTable   map[enode.ID]bool
@@ -30,11 +32,12 @@ type Snapshot struct {
 
 // SnapshotReader is the structure that allow reading the raw DxFile content
 type SnapshotReader struct {
-	f  *os.File
+	r  *pageReader
 	df *DxFile
 }
 
-// SnapshotReader creates a reader that could be used to read DxFile content
+// SnapshotReader creates a reader that could be used to read DxFile content from the persist
+// backend. The DxFile is locked from updates until the reader is closed
 func (df *DxFile) SnapshotReader() (*SnapshotReader, error) {
 	df.lock.RLock()
 
@@ -42,46 +45,46 @@ func (df *DxFile) SnapshotReader() (*SnapshotReader, error) {
 		df.lock.RUnlock()
 		return nil, fmt.Errorf("file has been deleted")
 	}
-	f, err := os.Open(string(df.filePath))
+	r, err := newPageReader(df.backend, string(df.filePath))
 	if err != nil {
 		df.lock.RUnlock()
 		return nil, err
 	}
 	return &SnapshotReader{
 		df: df,
-		f:  f,
+		r:  r,
 	}, nil
 }
 
 // Read read the content from the DxFile data file
 func (sr *SnapshotReader) Read(b []byte) (int, error) {
-	return sr.f.Read(b)
-}
-
-// Stat return the file info of the DxFile data file
-func (sr *SnapshotReader) Stat() (os.FileInfo, error) {
-	return sr.f.Stat()
+	return sr.r.Read(b)
 }
 
 // Close close the DxFile data file, and also release the lock of the DxFile
 func (sr *SnapshotReader) Close() error {
 	sr.df.lock.RUnlock()
-	return sr.f.Close()
+	return sr.r.Close()
 }
 
-// Snapshot creates the Snapshot of the DxFile
+// Snapshot creates the Snapshot of the DxFile. All fields are copied within a single lock,
+// so that the reads on the snapshot are not affected by the concurrent repair
 func (df *DxFile) Snapshot() (*Snapshot, error) {
-	ck, err := df.CipherKey()
+	df.lock.RLock()
+	defer df.lock.RUnlock()
+
+	ck, err := df.getCipherKey()
 	if err != nil {
 		return nil, err
 	}
-	ec, err := df.ErasureCode()
+	cks, err := df.cipherKeys()
+	if err != nil {
+		return nil, err
+	}
+	ec, err := df.getErasureCode()
 	if err != nil {
 		return nil, err
 	}
-
-	df.lock.RLock()
-	defer df.lock.RUnlock()
 
 	hostTable := make(map[enode.ID]bool)
 	for key, value := range df.hostTable {
@@ -89,8 +92,8 @@ func (df *DxFile) Snapshot() (*Snapshot, error) {
 	}
 
 	segments := make([]Segment, 0, len(df.segments))
-	for _, segment := range df.segments {
-		segments = append(segments, copySegment(segment))
+	for i := range df.segments {
+		segments = append(segments, copySegment(df.segment(i)))
 	}
 
 	return &Snapshot{
@@ -98,6 +101,8 @@ func (df *DxFile) Snapshot() (*Snapshot, error) {
 		sectorSize:  df.metadata.SectorSize,
 		erasureCode: ec,
 		cipherKey:   ck,
+		cipherKeys:  cks,
+		derivation:  df.metadata.KeyDerivation,
 		fileMode:    df.metadata.FileMode,
 		segments:    segments,
 		hostTable:   hostTable,
@@ -127,6 +132,22 @@ func (s *Snapshot) CipherKey() crypto.CipherKey {
 	return s.cipherKey
 }
 
+// SectorCipherKey return the key encrypting the sector at the sector index of the segment
+// with the current cipher key
+func (s *Snapshot) SectorCipherKey(segmentIndex, sectorIndex uint64) (crypto.CipherKey, error) {
+	return sectorCipherKey(s.cipherKey, s.derivation, segmentIndex, sectorIndex)
+}
+
+// SectorCipherKeyOfGeneration return the key encrypting the sector at the sector index of the
+// segment with the cipher key of the generation
+func (s *Snapshot) SectorCipherKeyOfGeneration(generation uint8, segmentIndex, sectorIndex uint64) (crypto.CipherKey, error) {
+	ck, exist := s.cipherKeys[generation]
+	if !exist {
+		return nil, errKeyGenerationUnknown
+	}
+	return sectorCipherKey(ck, s.derivation, segmentIndex, sectorIndex)
+}
+
 // FileMode return the file mode
 func (s *Snapshot) FileMode() os.FileMode {
 	return s.fileMode
@@ -142,6 +163,21 @@ func (s *Snapshot) Sectors(segmentIndex uint64) ([][]*Sector, error) {
 	return copySectors(&s.segments[segmentIndex]), nil
 }
 
+// SegmentAvailable return whether the segment has been uploaded with enough sectors to be
+// recovered, so that it could be downloaded even if the rest of the file is still uploading
+func (s *Snapshot) SegmentAvailable(segmentIndex uint64) bool {
+	if segmentIndex >= uint64(len(s.segments)) {
+		return false
+	}
+	var numUploaded uint32
+	for _, sectors := range s.segments[segmentIndex].Sectors {
+		if len(sectors) != 0 {
+			numUploaded++
+		}
+	}
+	return numUploaded >= s.erasureCode.MinSectors()
+}
+
 // SectorSize return the sectorSize
 func (s *Snapshot) SectorSize() uint64 {
 	return s.sectorSize
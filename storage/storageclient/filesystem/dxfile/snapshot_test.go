@@ -27,10 +27,6 @@ func TestSnapshotReader(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = sr.Stat()
-	if err != nil {
-		t.Fatal(err)
-	}
 	b := make([]byte, PageSize)
 	_, err = sr.Read(b)
 	if err != nil {
@@ -150,3 +146,108 @@ func checkSegmentEqualNotSame(got, expect *Segment) error {
 	}
 	return nil
 }
+
+// TestSnapshot_ConcurrentRepair test the snapshot taken while a repair is adding sectors to the
+// DxFile is a consistent view of the file, and is not affected by the repair afterwards.
+// Run with -race to detect the data race between the reads and the repair.
+func TestSnapshot_ConcurrentRepair(t *testing.T) {
+	numSector := uint32(4)
+	minSector := uint32(2)
+	df, err := newTestDxFileWithSegments(t, sectorSize*uint64(minSector)*3, minSector, numSector, erasurecode.ECTypeStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numRounds := 8
+
+	// The repair adds a sector of a new host to each sector index of each segment in order
+	repairDone := make(chan error)
+	go func() {
+		for round := 0; round != numRounds; round++ {
+			host := randomAddress()
+			for segIndex := 0; segIndex != df.NumSegments(); segIndex++ {
+				for sectorIndex := 0; sectorIndex != int(numSector); sectorIndex++ {
+					if err := df.AddSector(host, randomHash(), segIndex, sectorIndex); err != nil {
+						repairDone <- err
+						return
+					}
+				}
+			}
+		}
+		close(repairDone)
+	}()
+
+	var snapshots []*Snapshot
+	var sectors [][][][]*Sector
+loop:
+	for {
+		select {
+		case err, ok := <-repairDone:
+			if ok {
+				t.Fatal(err)
+			}
+			break loop
+		default:
+		}
+		s, err := df.Snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = checkSnapshotConsistent(s); err != nil {
+			t.Fatalf("snapshot not consistent: %v", err)
+		}
+		var snapSectors [][][]*Sector
+		for i := uint64(0); i != s.NumSegments(); i++ {
+			secs, _ := s.Sectors(i)
+			snapSectors = append(snapSectors, secs)
+		}
+		snapshots = append(snapshots, s)
+		sectors = append(sectors, snapSectors)
+	}
+	// The snapshots shall not be affected by the repair completed afterwards
+	for i, s := range snapshots {
+		for segIndex := uint64(0); segIndex != s.NumSegments(); segIndex++ {
+			secs, _ := s.Sectors(segIndex)
+			if !reflect.DeepEqual(secs, sectors[i][segIndex]) {
+				t.Fatalf("snapshot %v segment %v changed after repair", i, segIndex)
+			}
+		}
+	}
+	// The snapshot after the repair shall have all sectors added
+	s, err := df.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for segIndex := uint64(0); segIndex != s.NumSegments(); segIndex++ {
+		secs, _ := s.Sectors(segIndex)
+		for sectorIndex, sector := range secs {
+			if len(sector) != numRounds+1 {
+				t.Errorf("segment %v sector %v: expect %v sectors, got %v", segIndex, sectorIndex, numRounds+1, len(sector))
+			}
+		}
+	}
+}
+
+// checkSnapshotConsistent checks the hosts of all sectors in the snapshot are in the host table,
+// and the sectors added by the repair in order form a prefix, that is, the number of sectors
+// of each sector index is non-increasing, and differs from the first one by at most 1
+func checkSnapshotConsistent(s *Snapshot) error {
+	firstLen, prevLen := -1, -1
+	for segIndex := uint64(0); segIndex != s.NumSegments(); segIndex++ {
+		secs, _ := s.Sectors(segIndex)
+		for sectorIndex, sectors := range secs {
+			for _, sector := range sectors {
+				if _, exist := s.hostTable[sector.HostID]; !exist {
+					return fmt.Errorf("segment %v sector %v: host %v not in host table", segIndex, sectorIndex, sector.HostID)
+				}
+			}
+			if firstLen == -1 {
+				firstLen, prevLen = len(sectors), len(sectors)
+			}
+			if len(sectors) > prevLen || len(sectors) < firstLen-1 {
+				return fmt.Errorf("segment %v sector %v: unexpected number of sectors %v", segIndex, sectorIndex, len(sectors))
+			}
+			prevLen = len(sectors)
+		}
+	}
+	return nil
+}
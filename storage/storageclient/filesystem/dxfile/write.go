@@ -7,7 +7,6 @@ package dxfile
 import (
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/DxChainNetwork/godx/rlp"
@@ -20,41 +19,16 @@ func (df *DxFile) saveAll() error {
 	if df.deleted {
 		return errors.New("cannot save the file: file already deleted")
 	}
-	var updates []storage.FileUpdate
-	// create updates for hostTable
-	up, hostTableSize, err := df.createHostTableUpdate()
+	updates, err := df.createAllUpdates()
 	if err != nil {
 		return err
 	}
-	updates = append(updates, up)
-	pagesHostTable := hostTableSize / PageSize
-	if hostTableSize%PageSize != 0 {
-		pagesHostTable++
-	}
-	df.metadata.SegmentOffset = df.metadata.HostTableOffset + PageSize*pagesHostTable
-	segmentPersistSize := PageSize * segmentPersistNumPages(df.metadata.NumSectors)
-
-	// create updates for segments
-	for i := range df.segments {
-		df.pruneSegment(i)
-		offset := df.metadata.SegmentOffset + uint64(i)*segmentPersistSize
-		update, err := df.createSegmentUpdate(uint64(i), offset)
-		if err != nil {
-			return err
-		}
-		df.segments[i].offset = offset
-		updates = append(updates, update)
-	}
-
-	// create update for metadata
-	up, err = df.createMetadataUpdate()
-	if err != nil {
+	// save all updates
+	if err = df.applyUpdates(updates); err != nil {
 		return err
 	}
-	updates = append(updates, up)
-
-	// save all updates
-	return storage.ApplyUpdates(df.wal, updates)
+	df.clearDirty()
+	return nil
 }
 
 // rename create a series of transactions to rename the file to a new file
@@ -71,10 +45,28 @@ func (df *DxFile) rename(dxPath storage.DxPath, newFilePath storage.SysPath) err
 	updates = append(updates, du)
 	df.filePath = newFilePath
 	df.metadata.DxPath = dxPath
+	// create updates for all contents
+	ups, err := df.createAllUpdates()
+	if err != nil {
+		return err
+	}
+	updates = append(updates, ups...)
+	// apply updates
+	if err = df.applyUpdates(updates); err != nil {
+		return err
+	}
+	df.clearDirty()
+	return nil
+}
+
+// createAllUpdates creates the updates for all contents of the DxFile. The segments are laid
+// out in the order of the segment index right after the host table.
+func (df *DxFile) createAllUpdates() ([]storage.FileUpdate, error) {
+	var updates []storage.FileUpdate
 	// create updates for hostTable
 	up, hostTableSize, err := df.createHostTableUpdate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	updates = append(updates, up)
 	pagesHostTable := hostTableSize / PageSize
@@ -90,19 +82,17 @@ func (df *DxFile) rename(dxPath storage.DxPath, newFilePath storage.SysPath) err
 		offset := df.metadata.SegmentOffset + uint64(i)*segmentPersistSize
 		update, err := df.createSegmentUpdate(uint64(i), offset)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		updates = append(updates, update)
 	}
 
-	// create updates for metadata
+	// create update for metadata
 	up, err = df.createMetadataUpdate()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	updates = append(updates, up)
-	// apply updates
-	return storage.ApplyUpdates(df.wal, updates)
+	return append(updates, up), nil
 }
 
 // delete create and apply the deletion update
@@ -114,40 +104,72 @@ func (df *DxFile) delete() error {
 	if err != nil {
 		return fmt.Errorf("cannot create delete update: %v", err)
 	}
-	return storage.ApplyUpdates(df.wal, []storage.FileUpdate{du})
+	return df.applyUpdates([]storage.FileUpdate{du})
 }
 
-// saveSegment save the Segment with the segmentIndex, and write to file
+// saveSegments mark the segments with the indexes as dirty, and save the dirty segments
 func (df *DxFile) saveSegments(indexes []int) error {
+	for _, index := range indexes {
+		df.materializeSegment(index).dirty = true
+	}
+	return df.saveDirty()
+}
+
+// saveDirty incrementally save the DxFile. Only the segments marked as dirty are rewritten
+// along with the host table and metadata. All updates are applied in one wal transaction,
+// so that the save is atomic.
+func (df *DxFile) saveDirty() error {
 	if df.deleted {
 		return errors.New("cannot save the Segment: file already deleted")
 	}
+	updates, err := df.createDirtyUpdates()
+	if err != nil {
+		return err
+	}
+	if err = df.applyUpdates(updates); err != nil {
+		return err
+	}
+	df.clearDirty()
+	return nil
+}
+
+// createDirtyUpdates creates the updates for the host table, the dirty segments and metadata
+func (df *DxFile) createDirtyUpdates() ([]storage.FileUpdate, error) {
 	// create updates for hostTable
 	updates, err := df.createMetadataHostTableUpdate()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// Write the Segment with the segmentIndex
-	for _, index := range indexes {
+	// write the dirty segments
+	for index, seg := range df.segments {
+		if seg == nil || !seg.dirty {
+			continue
+		}
 		df.pruneSegment(index)
-		seg := df.segments[index]
 		if seg.Index != uint64(index) {
-			return fmt.Errorf("cannot write Segment: data corrupted - Segment Index not expected")
+			return nil, fmt.Errorf("cannot write Segment: data corrupted - Segment Index not expected")
 		}
 		up, err := df.createSegmentUpdate(uint64(index), seg.offset)
 		if err != nil {
-			return fmt.Errorf("cannot write Segment: %v", err)
+			return nil, fmt.Errorf("cannot write Segment: %v", err)
 		}
 		updates = append(updates, up)
 	}
 	// create updates for metadata
 	up, err := df.createMetadataUpdate()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return append(updates, up), nil
+}
+
+// clearDirty clear the dirty flag of all segments after the segments are saved
+func (df *DxFile) clearDirty() {
+	for _, seg := range df.segments {
+		if seg != nil {
+			seg.dirty = false
+		}
 	}
-	updates = append(updates, up)
-	// apply the updates
-	return storage.ApplyUpdates(df.wal, updates)
 }
 
 // saveHostTableUpdate save the host table as well as the metadata
@@ -159,7 +181,7 @@ func (df *DxFile) saveHostTableUpdate() error {
 	if err != nil {
 		return err
 	}
-	return storage.ApplyUpdates(df.wal, updates)
+	return df.applyUpdates(updates)
 }
 
 // saveMetadata only save the metadata
@@ -171,7 +193,7 @@ func (df *DxFile) saveMetadata() error {
 	if err != nil {
 		return err
 	}
-	return storage.ApplyUpdates(df.wal, []storage.FileUpdate{up})
+	return df.applyUpdates([]storage.FileUpdate{up})
 }
 
 // createMetadataHostTableUpdate creates the update for metadata and hostTable
@@ -203,26 +225,32 @@ func (df *DxFile) createMetadataHostTableUpdate() ([]storage.FileUpdate, error)
 // segmentShift shift Segment in persist file to the end of the persist file to give space for hostTable.
 // Return the corresponding update and the underlying error.
 func (df *DxFile) segmentShift(targetHostTableSize uint64) ([]storage.FileUpdate, error) {
-	f, err := os.OpenFile(string(df.filePath), os.O_RDONLY, 0777)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open the file %v: %v", df.filePath, err)
-	}
-	defer f.Close()
-
 	// calculate the offsets after the host table update
 	shiftOffset, numSegToShift, segmentOffsetDiff := df.shiftOffset(targetHostTableSize)
+	var f *pageReader
+	if numSegToShift != 0 {
+		var err error
+		if f, err = newPageReader(df.backend, string(df.filePath)); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
 	prevOffset := df.metadata.SegmentOffset
 	segmentSize := PageSize * segmentPersistNumPages(df.metadata.NumSectors)
 
+	// the segments not allocated are located by the segment offset, thus shall be allocated
+	// with the current offsets before shifting
+	df.materializeSegments()
+
 	// move the segment to the end of DxFile
 	var updates []storage.FileUpdate
 	for i := 0; uint64(i) < numSegToShift; i++ {
-		seg, err := df.readSegment(f, prevOffset)
+		index, err := df.readSegmentIndex(f, prevOffset)
 		if err != nil {
 			return nil, err
 		}
 		newOffset := prevOffset + shiftOffset
-		iu, err := df.createSegmentUpdate(seg.Index, newOffset)
+		iu, err := df.createSegmentUpdate(index, newOffset)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Segment update: %v", err)
 		}
@@ -258,7 +286,7 @@ func (df *DxFile) shiftOffset(targetHostTableSize uint64) (uint64, uint64, uint6
 // createMetadataUpdate create an insert update for metadata
 func (df *DxFile) createMetadataUpdate() (storage.FileUpdate, error) {
 	df.metadata.TimeUpdate = unixNow()
-	metaBytes, err := rlp.EncodeToBytes(df.metadata)
+	metaBytes, err := encodeMetadata(df.metadata)
 	if err != nil {
 		return nil, err
 	}
@@ -290,7 +318,7 @@ func (df *DxFile) createSegmentUpdate(segmentIndex uint64, offset uint64) (stora
 	if segmentIndex > uint64(len(df.segments)) {
 		return nil, fmt.Errorf("unexpected Index: %d", segmentIndex)
 	}
-	segment := df.segments[segmentIndex]
+	segment := df.segment(int(segmentIndex))
 	if segment.Index != segmentIndex {
 		return nil, fmt.Errorf("data corrupted: Segment Index not align: %d != %d", segment.Index, segmentIndex)
 	}
@@ -300,6 +328,9 @@ func (df *DxFile) createSegmentUpdate(segmentIndex uint64, offset uint64) (stora
 	if err != nil {
 		return nil, fmt.Errorf("cannot encode Segment: %+v", segment)
 	}
+	segBytes = appendChecksum(segBytes)
+	// the segment corrupted is no longer corrupted once rewritten
+	delete(df.corruptSegments, segmentIndex)
 	// if the Segment does not fit in, prune Sectors with unused hosts
 	if limit := PageSize * segmentPersistNumPages(df.metadata.NumSectors); uint64(len(segBytes)) > limit {
 		return nil, fmt.Errorf("segment bytes exceed limit: %d > %d", len(segBytes), limit)
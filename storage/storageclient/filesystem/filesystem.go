@@ -77,6 +77,10 @@ type fileSystem struct {
 
 	// stuckFound is the channel to signal a stuck segment is found
 	stuckFound chan struct{}
+
+	// healthCheckHook is called with the redundancy of each file checked in the health scan
+	healthCheckHook HealthCheckHook
+	hookLock        sync.RWMutex
 }
 
 // newFileSystem creates a new file system with the standardDisrupter
@@ -517,32 +521,21 @@ func (fs *fileSystem) fileList() ([]storage.FileBriefInfo, error) {
 
 	var fileList []storage.FileBriefInfo
 	healthInfoTable := fs.contractManager.HostHealthMap()
-	err := filepath.Walk(string(fs.fileRootDir), func(path string, info os.FileInfo, err error) error {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-		if info.IsDir() || filepath.Ext(path) != storage.DxFileExt {
-			return nil
-		}
-		str := strings.TrimSuffix(strings.TrimPrefix(path, string(fs.fileRootDir)), storage.DxFileExt)
-		dxPath, err := storage.NewDxPath(str)
-		if err != nil {
-			return err
-		}
+	dxPaths, err := fs.fileSet.DxPaths()
+	if err != nil {
+		return nil, err
+	}
+	for _, dxPath := range dxPaths {
 		fileInfo, err := fs.fileBriefInfo(dxPath, healthInfoTable)
-		if os.IsNotExist(err) {
-			return nil
+		if os.IsNotExist(err) || err == dxfile.ErrUnknownFile {
+			continue
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fileList = append(fileList, fileInfo)
-		return nil
-	})
-	return fileList, err
+	}
+	return fileList, nil
 }
 
 // fileDetailedInfo returns detailed information for a file specified by the path
@@ -574,6 +567,7 @@ func (fs *fileSystem) fileDetailedInfo(path storage.DxPath, table storage.HostHe
 		Redundancy:     redundancy,
 		StoredOnDisk:   onDisk,
 		UploadProgress: file.UploadProgress(),
+		RenewalPolicy:  file.RenewalPolicy().String(),
 	}
 	return info, nil
 }
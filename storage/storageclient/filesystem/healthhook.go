@@ -0,0 +1,32 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package filesystem
+
+import "github.com/DxChainNetwork/godx/storage"
+
+// HealthCheckHook is the function called with the redundancy of each file checked in the health
+// scan. The hook is called in the thread updating the directory metadata, so a slow hook delays
+// the update
+type HealthCheckHook func(path storage.DxPath, redundancy uint32)
+
+// SetHealthCheckHook set the hook called with the redundancy of each file checked in the health
+// scan. nil removes the hook
+func (fs *fileSystem) SetHealthCheckHook(hook HealthCheckHook) {
+	fs.hookLock.Lock()
+	defer fs.hookLock.Unlock()
+
+	fs.healthCheckHook = hook
+}
+
+// runHealthCheckHook calls the health check hook if set
+func (fs *fileSystem) runHealthCheckHook(path storage.DxPath, redundancy uint32) {
+	fs.hookLock.RLock()
+	hook := fs.healthCheckHook
+	fs.hookLock.RUnlock()
+
+	if hook != nil {
+		hook(path, redundancy)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package filesystem
+
+import (
+	"os"
+
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// FilesOnHost returns the files with sectors stored on the host, sorted by path. For each file,
+// the current health and the projected health if all sectors on the host are lost are reported,
+// so that the user knows the effect of cancelling the contract with the host or the host going
+// offline.
+func (fs *fileSystem) FilesOnHost(id enode.ID) ([]storage.FileOnHost, error) {
+	if err := fs.tm.Add(); err != nil {
+		return nil, err
+	}
+	defer fs.tm.Done()
+
+	healthInfoTable := fs.contractManager.HostHealthMap()
+	projectedTable := make(storage.HostHealthInfoTable, len(healthInfoTable)+1)
+	for hostID, info := range healthInfoTable {
+		projectedTable[hostID] = info
+	}
+	projectedTable[id] = storage.HostHealthInfo{Offline: true}
+
+	// The host index may contain stale DxPaths, thus each DxFile is checked
+	dxPaths, err := fs.fileSet.DxPathsOnHost(id)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]storage.FileOnHost, 0, len(dxPaths))
+	for _, dxPath := range dxPaths {
+		file, err := fs.fileSet.Open(dxPath)
+		if os.IsNotExist(err) || err == dxfile.ErrUnknownFile {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if file.HasSectorsOnHost(id) {
+			health, _, _ := file.Health(healthInfoTable)
+			projectedHealth, _, _ := file.Health(projectedTable)
+			files = append(files, storage.FileOnHost{
+				Path:            file.DxPath().Path,
+				Health:          health,
+				ProjectedHealth: projectedHealth,
+			})
+		}
+		file.Close()
+	}
+	return files, nil
+}
@@ -47,6 +47,27 @@ type FileSystem interface {
 	RepairNeededChan() chan struct{}
 	StuckFoundChan() chan struct{}
 
+	// Renewal policy related functions
+	SetFileRenewalPolicy(path storage.DxPath, policy storage.RenewalPolicy) error
+	FileRenewalPolicy(path storage.DxPath) (storage.RenewalPolicy, error)
+	LapsingHosts() (map[enode.ID]struct{}, error)
+
+	// Health history related functions
+	FileHealths() (map[storage.DxPath]uint32, error)
+
+	// Host dependency related functions
+	FilesOnHost(id enode.ID) ([]storage.FileOnHost, error)
+
+	// Duplicate files related functions
+	FindDuplicateFiles() ([]storage.DuplicateFiles, error)
+	MergeDuplicate(keep, remove storage.DxPath) error
+
+	// Diagnostic functions
+	DumpDxFile(path storage.DxPath) (dxfile.FileDump, error)
+
+	// Monitoring related functions
+	SetHealthCheckHook(hook HealthCheckHook)
+
 	// private function fields used for APIs
 	getLogger() log.Logger
 	fileDetailedInfo(path storage.DxPath, table storage.HostHealthInfoTable) (storage.FileInfo, error)
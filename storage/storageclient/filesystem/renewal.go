@@ -0,0 +1,123 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package filesystem
+
+import (
+	"os"
+
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// SetFileRenewalPolicy set the renewal policy of the file specified by the path
+func (fs *fileSystem) SetFileRenewalPolicy(path storage.DxPath, policy storage.RenewalPolicy) error {
+	file, err := fs.fileSet.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.SetRenewalPolicy(policy)
+}
+
+// FileRenewalPolicy returns the renewal policy of the file specified by the path
+func (fs *fileSystem) FileRenewalPolicy(path storage.DxPath) (storage.RenewalPolicy, error) {
+	file, err := fs.fileSet.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return file.RenewalPolicy(), nil
+}
+
+// LapsingHosts returns the hosts whose contracts are allowed to lapse. A contract is allowed
+// to lapse if the host stores data of some files, and none of the files requires renewal
+// according to its renewal policy. The hosts not storing any file are not included.
+func (fs *fileSystem) LapsingHosts() (map[enode.ID]struct{}, error) {
+	if err := fs.tm.Add(); err != nil {
+		return nil, err
+	}
+	defer fs.tm.Done()
+
+	// renewRequired maps from the host id to whether any file stored on the host requires renewal
+	renewRequired := make(map[enode.ID]bool)
+	healthInfoTable := fs.contractManager.HostHealthMap()
+	err := fs.walkFiles(func(file *dxfile.FileSetEntryWithID) error {
+		required := fileRenewRequired(file, healthInfoTable)
+		for _, id := range file.HostIDs() {
+			renewRequired[id] = renewRequired[id] || required
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lapsing := make(map[enode.ID]struct{})
+	for id, required := range renewRequired {
+		if !required {
+			lapsing[id] = struct{}{}
+		}
+	}
+	return lapsing, nil
+}
+
+// FileHealths returns the health of all files, mapping from the path of the file
+func (fs *fileSystem) FileHealths() (map[storage.DxPath]uint32, error) {
+	if err := fs.tm.Add(); err != nil {
+		return nil, err
+	}
+	defer fs.tm.Done()
+
+	healths := make(map[storage.DxPath]uint32)
+	healthInfoTable := fs.contractManager.HostHealthMap()
+	err := fs.walkFiles(func(file *dxfile.FileSetEntryWithID) error {
+		health, _, _ := file.Health(healthInfoTable)
+		healths[file.DxPath()] = health
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return healths, nil
+}
+
+// walkFiles opens each DxFile in the file system and calls fn on the file
+func (fs *fileSystem) walkFiles(fn func(file *dxfile.FileSetEntryWithID) error) error {
+	dxPaths, err := fs.fileSet.DxPaths()
+	if err != nil {
+		return err
+	}
+	for _, dxPath := range dxPaths {
+		file, err := fs.fileSet.Open(dxPath)
+		if os.IsNotExist(err) || err == dxfile.ErrUnknownFile {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileRenewRequired returns whether the contracts storing the file shall be renewed
+func fileRenewRequired(file *dxfile.FileSetEntryWithID, table storage.HostHealthInfoTable) bool {
+	switch file.RenewalPolicy() {
+	case storage.NeverRenew:
+		return false
+	case storage.RenewIfHealthy:
+		health, _, numStuckSegments := file.Health(table)
+		return numStuckSegments == 0 && health > recoverableThreshold
+	default:
+		return true
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/DxChainNetwork/godx/core/types"
 	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/contractmanager"
 )
 
 // ContractMetaDataAPIDisplay is the data structure used for console
@@ -57,6 +58,26 @@ func formatContractMetaData(data storage.ContractMetaData) (formatted ContractMe
 	return
 }
 
+// ContractFeeEstimateAPIDisplay is the data structure used for console contract fee
+// estimation display purposes
+type ContractFeeEstimateAPIDisplay struct {
+	GasPrice    string
+	Gas         uint64
+	GasFee      string
+	ContractFee string
+	TotalFee    string
+}
+
+// formatContractFeeEstimate will format the contract fee estimation for display
+func formatContractFeeEstimate(estimate contractmanager.ContractFeeEstimate) (formatted ContractFeeEstimateAPIDisplay) {
+	formatted.GasPrice = unit.FormatCurrency(estimate.GasPrice)
+	formatted.Gas = estimate.Gas
+	formatted.GasFee = unit.FormatCurrency(estimate.GasFee)
+	formatted.ContractFee = unit.FormatCurrency(estimate.ContractFee)
+	formatted.TotalFee = unit.FormatCurrency(estimate.TotalFee())
+	return
+}
+
 // formatStatus will format the storage contract status into human understandable format
 func formatStatus(upload, renew, canceled bool) (formatUpload, formatRenew, formatCanceled string) {
 	if upload {
@@ -85,6 +106,7 @@ func formatClientSetting(setting storage.ClientSetting) (formatted storage.Clien
 	formatted.EnableIPViolation = formatIPViolation(setting.EnableIPViolation)
 	formatted.MaxUploadSpeed = unit.FormatSpeed(setting.MaxUploadSpeed)
 	formatted.MaxDownloadSpeed = unit.FormatSpeed(setting.MaxDownloadSpeed)
+	formatted.RepairDownloadThreshold = fmt.Sprintf("%v%%", setting.RepairDownloadThreshold*100)
 	formatted.RentPayment = formatRentPayment(setting.RentPayment)
 	return
 }
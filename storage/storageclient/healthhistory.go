@@ -0,0 +1,232 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// healthHistoryMetadata is the metadata of the health history persist file
+var healthHistoryMetadata = common.Metadata{
+	Header:  "storage client health history",
+	Version: PersistStorageClientVersion,
+}
+
+// HealthSample is the health of a file sampled at a time. The samples older than the retention
+// window are averaged over the downsample interval, with the time of the start of the interval
+type HealthSample struct {
+	Time   time.Time `json:"time"`
+	Health float64   `json:"health"`
+}
+
+// healthHistory is the health time series of the files, mapping from the dxPath of the file.
+// The recent samples are kept at full resolution, and the old samples are downsampled so that
+// the size of the history is bounded
+type healthHistory struct {
+	files map[string][]HealthSample
+	mu    sync.Mutex
+}
+
+// newHealthHistory creates an empty healthHistory
+func newHealthHistory() *healthHistory {
+	return &healthHistory{
+		files: make(map[string][]HealthSample),
+	}
+}
+
+// record appends the sample to the history of the file, and compacts the history
+func (hh *healthHistory) record(dxPath string, sample HealthSample, now time.Time) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	hh.files[dxPath] = compactHealthSamples(append(hh.files[dxPath], sample), now)
+}
+
+// retain removes the history of the files not in the given set
+func (hh *healthHistory) retain(dxPaths map[string]struct{}) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	for dxPath := range hh.files {
+		if _, exist := dxPaths[dxPath]; !exist {
+			delete(hh.files, dxPath)
+		}
+	}
+}
+
+// remove removes the history of the file
+func (hh *healthHistory) remove(dxPath string) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	delete(hh.files, dxPath)
+}
+
+// series returns the samples of the file within the time range [from, to]
+func (hh *healthHistory) series(dxPath string, from, to time.Time) []HealthSample {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	var samples []HealthSample
+	for _, sample := range hh.files[dxPath] {
+		if sample.Time.Before(from) || sample.Time.After(to) {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// latest returns the health of the latest sample of each file
+func (hh *healthHistory) latest() map[string]float64 {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	healths := make(map[string]float64, len(hh.files))
+	for dxPath, samples := range hh.files {
+		if len(samples) != 0 {
+			healths[dxPath] = samples[len(samples)-1].Health
+		}
+	}
+	return healths
+}
+
+// save saves the health history to the file
+func (hh *healthHistory) save(path string) error {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	return common.SaveDxJSON(healthHistoryMetadata, path, hh.files)
+}
+
+// load loads the health history from the file. A missing file is regarded as an empty history
+func (hh *healthHistory) load(path string) error {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+
+	files := make(map[string][]HealthSample)
+	err := common.LoadDxJSON(healthHistoryMetadata, path, &files)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	hh.files = files
+	return nil
+}
+
+// compactHealthSamples drops the samples older than healthHistoryMaxAge, and averages the samples
+// older than healthHistoryRetention within each healthHistoryDownsampleInterval. The samples are
+// expected to be in time order
+func compactHealthSamples(samples []HealthSample, now time.Time) []HealthSample {
+	oldest := now.Add(-healthHistoryMaxAge)
+	retention := now.Add(-healthHistoryRetention)
+
+	compacted := make([]HealthSample, 0, len(samples))
+	var bucketStart time.Time
+	var bucketSum float64
+	var bucketSize int
+	flush := func() {
+		if bucketSize != 0 {
+			compacted = append(compacted, HealthSample{
+				Time:   bucketStart,
+				Health: bucketSum / float64(bucketSize),
+			})
+		}
+		bucketSum, bucketSize = 0, 0
+	}
+	for _, sample := range samples {
+		if sample.Time.Before(oldest) {
+			continue
+		}
+		if !sample.Time.Before(retention) {
+			flush()
+			compacted = append(compacted, sample)
+			continue
+		}
+		start := sample.Time.Truncate(healthHistoryDownsampleInterval)
+		if bucketSize != 0 && !start.Equal(bucketStart) {
+			flush()
+		}
+		bucketStart = start
+		bucketSum += sample.Health
+		bucketSize++
+	}
+	flush()
+	return compacted
+}
+
+// healthHistoryPath returns the path of the health history persist file
+func (client *StorageClient) healthHistoryPath() string {
+	return filepath.Join(client.persistDir, HealthHistoryFilename)
+}
+
+// sampleFileHealth records the health of all files, and removes the history of the files
+// no longer existing
+func (client *StorageClient) sampleFileHealth(now time.Time) error {
+	healths, err := client.fileSystem.FileHealths()
+	if err != nil {
+		return err
+	}
+	dxPaths := make(map[string]struct{})
+	for dxPath, health := range healths {
+		dxPaths[dxPath.Path] = struct{}{}
+		client.healthHistory.record(dxPath.Path, HealthSample{Time: now, Health: float64(health)}, now)
+	}
+	client.healthHistory.retain(dxPaths)
+	return client.healthHistory.save(client.healthHistoryPath())
+}
+
+// healthSampleLoop samples the health of all files at the configured interval. When the interval
+// is 0, the sampling is disabled and the setting is checked again after healthSampleCheckInterval
+func (client *StorageClient) healthSampleLoop() {
+	if err := client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	for {
+		client.lock.Lock()
+		interval := client.persist.HealthSampleInterval
+		client.lock.Unlock()
+
+		wait := interval
+		if wait == 0 {
+			wait = healthSampleCheckInterval
+		}
+		select {
+		case <-client.tm.StopChan():
+			return
+		case <-time.After(wait):
+		}
+		if interval == 0 {
+			continue
+		}
+		if err := client.sampleFileHealth(time.Now()); err != nil {
+			client.log.Warn("failed to sample the file health", "err", err)
+		}
+	}
+}
+
+// FileHealthHistory returns the health samples of the file within the time range [from, to]
+func (client *StorageClient) FileHealthHistory(dxPath storage.DxPath, from, to time.Time) ([]HealthSample, error) {
+	if err := client.tm.Add(); err != nil {
+		return nil, err
+	}
+	defer client.tm.Done()
+
+	if to.Before(from) {
+		return nil, fmt.Errorf("invalid time range: %v is before %v", to, from)
+	}
+	return client.healthHistory.series(dxPath.Path, from, to), nil
+}
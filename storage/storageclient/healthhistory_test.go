@@ -0,0 +1,97 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestHealthHistory_Record test the recorded samples are returned within the time range, and
+// the history is kept after save and load
+func TestHealthHistory_Record(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	hh := newHealthHistory()
+	var samples []HealthSample
+	for i := 0; i != 10; i++ {
+		sample := HealthSample{Time: now.Add(time.Duration(i) * time.Minute), Health: float64(100 + i)}
+		hh.record("file", sample, sample.Time)
+		samples = append(samples, sample)
+	}
+	hh.record("other", HealthSample{Time: now, Health: 200}, now)
+
+	got := hh.series("file", now.Add(2*time.Minute), now.Add(5*time.Minute))
+	if !reflect.DeepEqual(got, samples[2:6]) {
+		t.Errorf("unexpected series: expect %v, got %v", samples[2:6], got)
+	}
+	if got := hh.series("file", now.Add(time.Hour), now.Add(2*time.Hour)); len(got) != 0 {
+		t.Errorf("expect no samples out of range, got %v", got)
+	}
+
+	// the history of the removed file is dropped
+	hh.retain(map[string]struct{}{"file": {}})
+	if got := hh.series("other", now, now); len(got) != 0 {
+		t.Errorf("history of removed file not dropped: %v", got)
+	}
+
+	// save and load
+	persistDir, err := ioutil.TempDir("", "healthhistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(persistDir)
+	path := filepath.Join(persistDir, HealthHistoryFilename)
+	if err := hh.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newHealthHistory()
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	got = loaded.series("file", now, now.Add(time.Hour))
+	if len(got) != len(samples) {
+		t.Fatalf("loaded history size: expect %v, got %v", len(samples), len(got))
+	}
+	for i := range got {
+		if !got[i].Time.Equal(samples[i].Time) || got[i].Health != samples[i].Health {
+			t.Errorf("loaded sample %v: expect %v, got %v", i, samples[i], got[i])
+		}
+	}
+}
+
+// TestCompactHealthSamples test the samples beyond the retention window are averaged over the
+// downsample interval, and the samples beyond the maximum age are dropped
+func TestCompactHealthSamples(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-healthHistoryRetention).Add(-3 * time.Hour)
+	samples := []HealthSample{
+		{Time: now.Add(-healthHistoryMaxAge).Add(-time.Hour), Health: 0},
+		{Time: old, Health: 100},
+		{Time: old.Add(20 * time.Minute), Health: 150},
+		{Time: old.Add(40 * time.Minute), Health: 200},
+		{Time: old.Add(time.Hour), Health: 120},
+		{Time: now.Add(-time.Hour), Health: 180},
+		{Time: now, Health: 190},
+	}
+	expect := []HealthSample{
+		{Time: old, Health: 150},
+		{Time: old.Add(time.Hour), Health: 120},
+		{Time: now.Add(-time.Hour), Health: 180},
+		{Time: now, Health: 190},
+	}
+	got := compactHealthSamples(samples, now)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected compacted samples: expect %v, got %v", expect, got)
+	}
+
+	// compacting again does not change the downsampled samples
+	if again := compactHealthSamples(got, now); !reflect.DeepEqual(again, expect) {
+		t.Errorf("compaction not stable: expect %v, got %v", expect, again)
+	}
+}
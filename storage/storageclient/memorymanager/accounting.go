@@ -0,0 +1,28 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package memorymanager
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/log"
+)
+
+// ReportAccountingError reports a memory accounting error, such as returning more memory
+// than requested. Accounting errors are caused by bugs, so the program panics in test mode
+// to surface the bug immediately. Otherwise, the error is logged
+func ReportAccountingError(msg string, ctx ...interface{}) {
+	if inTestMode() {
+		panic(fmt.Sprintf("memory accounting error: %s %v", msg, ctx))
+	}
+	log.Error("memory accounting error: "+msg, ctx...)
+}
+
+// inTestMode checks whether the program is running by go test. The test flags are
+// registered before the tests run
+func inTestMode() bool {
+	return flag.Lookup("test.v") != nil
+}
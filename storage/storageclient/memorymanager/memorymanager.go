@@ -18,6 +18,7 @@ type MemoryManager struct {
 	available        uint64
 	limit            uint64
 	underflow        uint64
+	inUse            uint64
 	waitlist         []*memoryRequest
 	priorityWaitlist []*memoryRequest
 	lock             sync.Mutex
@@ -76,11 +77,37 @@ func (mm *MemoryManager) Request(amount uint64, priority bool) bool {
 	}
 }
 
+// TryRequest will try to get the memory requested without blocking. Unlike Request,
+// it never gives out more memory than available, and it will not jump the
+// queue ahead of the requests already in the waitlists
+func (mm *MemoryManager) TryRequest(amount uint64) bool {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	if len(mm.priorityWaitlist) != 0 || len(mm.waitlist) != 0 {
+		return false
+	}
+	if mm.available < amount {
+		return false
+	}
+	mm.available -= amount
+	mm.inUse += amount
+	return true
+}
+
 // Return will return memory requested and processing memory requests in the waitlist
 func (mm *MemoryManager) Return(amount uint64) {
 	mm.lock.Lock()
 	defer mm.lock.Unlock()
 
+	// returning more memory than requested is caused by accounting bugs, reject it
+	// to keep the memory budget from being corrupted
+	if amount > mm.inUse {
+		ReportAccountingError("returned more memory than requested", "amount", amount, "inUse", mm.inUse)
+		return
+	}
+	mm.inUse -= amount
+
 	// return memory requested, give back underflowing memory if needed
 	if mm.underflow > 0 && amount <= mm.underflow {
 		mm.underflow -= amount
@@ -101,11 +128,13 @@ func (mm *MemoryManager) Return(amount uint64) {
 func (mm *MemoryManager) try(amount uint64) bool {
 	if mm.available >= amount {
 		mm.available -= amount
+		mm.inUse += amount
 		return true
 	} else if mm.available == mm.limit {
 		// give all the memory requested, record underflow memory amount
 		mm.available = 0
 		mm.underflow = amount - mm.limit
+		mm.inUse += amount
 		return true
 	}
 	return false
@@ -92,3 +92,61 @@ func TestMemoryManager_Return(t *testing.T) {
 		t.Errorf("error: memory request is expected to be successfully")
 	}
 }
+
+func TestMemoryManager_TryRequest(t *testing.T) {
+	mm := New(10000, stopChan)
+
+	if !mm.TryRequest(6000) {
+		t.Fatalf("error: memory request is expected to be successful")
+	}
+	if mm.available != 4000 {
+		t.Errorf("error: expected memory left 4000, got %d", mm.available)
+	}
+
+	// not enough memory, the request shall fail without causing underflow
+	if mm.TryRequest(5000) {
+		t.Errorf("error: memory request is expected to fail")
+	}
+	if mm.available != 4000 || mm.underflow != 0 {
+		t.Errorf("error, expected underflow 0, got %d. expected memory left 4000, got %d",
+			mm.underflow, mm.available)
+	}
+
+	// a pending request in the waitlist shall not be bypassed
+	done := make(chan struct{})
+	go func() {
+		mm.Request(5000, false)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if mm.TryRequest(1000) {
+		t.Errorf("error: memory request is not expected to bypass the waitlist")
+	}
+
+	mm.Return(6000)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("error: memory request is expected to be successfully")
+	}
+}
+
+func TestMemoryManager_Return_Double(t *testing.T) {
+	mm := New(10000, stopChan)
+	mm.Request(2000, false)
+	mm.Request(3000, false)
+
+	mm.Return(3000)
+	mm.Return(2000)
+
+	// returning the memory again is an accounting error, which panics in test mode
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("error: double return of memory is expected to be detected")
+		}
+		if mm.available != 10000 || mm.inUse != 0 {
+			t.Errorf("error: expected memory left 10000 and in use 0, got %d and %d", mm.available, mm.inUse)
+		}
+	}()
+	mm.Return(2000)
+}
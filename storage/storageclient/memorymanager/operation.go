@@ -8,11 +8,15 @@ import "fmt"
 
 // MemoryLimit returns max memory allowed
 func (mm *MemoryManager) MemoryLimit() uint64 {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
 	return mm.limit
 }
 
 // MemoryAvailable returns current memory available
 func (mm *MemoryManager) MemoryAvailable() uint64 {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
 	return mm.available
 }
 
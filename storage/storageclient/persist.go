@@ -7,6 +7,7 @@ package storageclient
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/log"
@@ -18,8 +19,27 @@ var settingsMetadata = common.Metadata{
 }
 
 type persistence struct {
-	MaxDownloadSpeed int64
-	MaxUploadSpeed   int64
+	MaxDownloadSpeed              int64
+	MaxUploadSpeed                int64
+	MaxInFlightDownloads          uint64
+	ReadAheadSegments             uint64
+	MinSegmentHosts               uint32
+	UploadPolicy                  string
+	RevisionHistoryLimit          uint64
+	DeriveSectorKeys              bool
+	UploadConfirmPolicy           string
+	UploadCompletionPolicy        string
+	UploadSchedulingPolicy        string
+	RepairDownloadThreshold       float64
+	HealthSampleInterval          time.Duration
+	MaxConcurrentNegotiations     uint64
+	DedupSectors                  bool
+	DirUpdateBatchInterval        time.Duration
+	RedundancyAlertThreshold      uint32
+	FileRedundancyAlertThresholds map[string]uint32
+	VerifyRepairSource            bool
+	ReclaimDeletedSectors         bool
+	ContractRenewPolicy           string
 }
 
 func (client *StorageClient) loadPersist() error {
@@ -32,7 +52,13 @@ func (client *StorageClient) loadPersist() error {
 	// initialize logger
 	client.log = log.New()
 
-	return client.loadSettings()
+	if err = client.loadSettings(); err != nil {
+		return err
+	}
+	if err = client.healthHistory.load(client.healthHistoryPath()); err != nil {
+		return err
+	}
+	return client.sectorCleanup.load(client.sectorCleanupPath())
 }
 
 // save StorageClient settings into storageclient.json file
@@ -42,7 +68,21 @@ func (client *StorageClient) saveSettings() error {
 
 // load prior StorageClient settings
 func (client *StorageClient) loadSettings() error {
-	client.persist = persistence{}
+	client.persist = persistence{
+		MaxInFlightDownloads:      DefaultMaxInFlightDownloads,
+		ReadAheadSegments:         DefaultReadAheadSegments,
+		MinSegmentHosts:           DefaultMinSegmentHosts,
+		UploadPolicy:              DefaultUploadPolicy,
+		RevisionHistoryLimit:      DefaultRevisionHistoryLimit,
+		UploadConfirmPolicy:       DefaultUploadConfirmPolicy,
+		UploadCompletionPolicy:    DefaultUploadCompletionPolicy,
+		UploadSchedulingPolicy:    DefaultUploadSchedulingPolicy,
+		RepairDownloadThreshold:   DefaultRepairDownloadThreshold,
+		HealthSampleInterval:      DefaultHealthSampleInterval,
+		MaxConcurrentNegotiations: DefaultMaxConcurrentNegotiations,
+		DirUpdateBatchInterval:    DefaultDirUpdateBatchInterval,
+		ContractRenewPolicy:       DefaultContractRenewPolicy,
+	}
 	err := common.LoadDxJSON(settingsMetadata, filepath.Join(client.persistDir, PersistFilename), &client.persist)
 	if os.IsNotExist(err) {
 		client.persist.MaxDownloadSpeed = DefaultMaxDownloadSpeed
@@ -54,5 +94,13 @@ func (client *StorageClient) loadSettings() error {
 	} else if err != nil {
 		return err
 	}
+	client.downloadLimiter.setLimit(client.persist.MaxInFlightDownloads)
+	client.segmentReadAhead.setNumSegments(client.persist.ReadAheadSegments)
+	client.uploadHeap.setSchedulingPolicy(client.persist.UploadSchedulingPolicy)
+	client.contractManager.GetStorageContractSet().SetRevisionHistoryLimit(client.persist.RevisionHistoryLimit)
+	client.contractManager.SetMaxConcurrentNegotiations(client.persist.MaxConcurrentNegotiations)
+	if err = client.contractManager.SetContractRenewPolicy(client.persist.ContractRenewPolicy); err != nil {
+		return err
+	}
 	return client.setBandwidthLimits(client.persist.MaxUploadSpeed, client.persist.MaxUploadSpeed)
 }
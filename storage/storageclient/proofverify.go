@@ -0,0 +1,60 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/vm"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// VerifyFileSegmentProof verifies the storage proof of a segment provided by the host offline,
+// without the chain state. The merkle root and the size used for the verification are computed
+// from the sectors of the file stored on the host, in the order of the segments, as if the
+// contract with the host only contained the file. The segmentIndex is the index of the proof
+// segment among all the sectors of the file stored on the host.
+func (client *StorageClient) VerifyFileSegmentProof(dxPath storage.DxPath, hostID enode.ID, segmentIndex uint64, segmentData []byte, hashSet []common.Hash) (verified bool, err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return
+	}
+	defer entry.Close()
+
+	// collect the sector roots stored on the host
+	var roots []common.Hash
+	for i := 0; i != entry.NumSegments(); i++ {
+		sectors, err := entry.Sectors(i)
+		if err != nil {
+			return false, err
+		}
+		for _, sectorList := range sectors {
+			for _, sector := range sectorList {
+				if sector.HostID == hostID {
+					roots = append(roots, sector.MerkleRoot)
+				}
+			}
+		}
+	}
+	if len(roots) == 0 {
+		return false, fmt.Errorf("no sector of file %v is stored on host %v", dxPath.Path, hostID)
+	}
+	return verifySectorsSegmentProof(roots, segmentIndex, segmentData, hashSet), nil
+}
+
+// verifySectorsSegmentProof verifies the storage proof of the segment against the sectors
+// with the given merkle roots, the same way as the storage proof is checked on chain
+func verifySectorsSegmentProof(roots []common.Hash, segmentIndex uint64, segmentData []byte, hashSet []common.Hash) bool {
+	fileSize := uint64(len(roots)) * storage.SectorSize
+	return vm.VerifyStorageProof(segmentData, hashSet, fileSize, storage.SegmentSize, segmentIndex, merkle.Sha256CachedTreeRoot2(roots))
+}
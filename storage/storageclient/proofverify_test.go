@@ -0,0 +1,106 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/vm"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestVerifySectorsSegmentProof test the storage proof built the same way as the host is
+// verified, and the proof with the tampered segment or the wrong index is rejected
+func TestVerifySectorsSegmentProof(t *testing.T) {
+	numSectors := 3
+	var sectors [][]byte
+	var roots []common.Hash
+	for i := 0; i != numSectors; i++ {
+		data := make([]byte, storage.SectorSize)
+		rand.Read(data)
+		sectors = append(sectors, data)
+		roots = append(roots, merkle.Sha256MerkleTreeRoot(data))
+	}
+	segmentsPerSector := storage.SectorSize / merkle.LeafSize
+	segmentIndex := segmentsPerSector + 7
+
+	segment, hashSet := buildSegmentProof(t, sectors, roots, segmentIndex)
+	if !verifySectorsSegmentProof(roots, segmentIndex, segment, hashSet) {
+		t.Fatal("valid storage proof is not verified")
+	}
+
+	tampered := append([]byte{}, segment...)
+	tampered[0] ^= 0xff
+	if verifySectorsSegmentProof(roots, segmentIndex, tampered, hashSet) {
+		t.Error("storage proof with tampered segment is verified")
+	}
+	if verifySectorsSegmentProof(roots, segmentIndex+1, segment, hashSet) {
+		t.Error("storage proof with wrong segment index is verified")
+	}
+	if verifySectorsSegmentProof(roots, segmentIndex, segment[:merkle.LeafSize/2], hashSet) {
+		t.Error("storage proof with short segment is verified")
+	}
+}
+
+// buildSegmentProof builds the storage proof of the segment among the sectors, the same way
+// as the host builds the storage proof to submit
+func buildSegmentProof(t *testing.T, sectors [][]byte, roots []common.Hash, segmentIndex uint64) ([]byte, []common.Hash) {
+	segmentsPerSector := storage.SectorSize / merkle.LeafSize
+	sector := sectors[segmentIndex/segmentsPerSector]
+	base, cachedHashSet, _, err := merkle.Sha256MerkleTreeProof(sector, segmentIndex%segmentsPerSector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log2SectorSize := uint64(0)
+	for 1<<log2SectorSize < segmentsPerSector {
+		log2SectorSize++
+	}
+	ct := merkle.NewSha256CachedTree(log2SectorSize)
+	if err = ct.SetStorageProofIndex(segmentIndex); err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range roots {
+		ct.Push(root)
+	}
+	return base, ct.Prove(base, cachedHashSet)
+}
+
+// TestVerifyStorageProof_FinalSegment test the storage proof of the final segment is verified for
+// the files whose sizes are exact multiples and non-multiples of the segment size
+func TestVerifyStorageProof_FinalSegment(t *testing.T) {
+	fileSizes := []uint64{
+		merkle.LeafSize * 4,
+		merkle.LeafSize*4 + 10,
+		merkle.LeafSize*5 - 1,
+		10,
+	}
+	for _, fileSize := range fileSizes {
+		data := make([]byte, fileSize)
+		rand.Read(data)
+		root := merkle.Sha256MerkleTreeRoot(data)
+		finalIndex := common.NumSegments(fileSize, merkle.LeafSize) - 1
+		base, hashSet, _, err := merkle.Sha256MerkleTreeProof(data, finalIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(base)) != common.FinalSegmentLength(fileSize, merkle.LeafSize) {
+			t.Fatalf("file size %v: expect final segment length %v, got %v", fileSize,
+				common.FinalSegmentLength(fileSize, merkle.LeafSize), len(base))
+		}
+
+		// the segment submitted in the proof is padded to the full segment size
+		var segment [merkle.LeafSize]byte
+		copy(segment[:], base)
+		if !vm.VerifyStorageProof(segment[:], hashSet, fileSize, storage.SegmentSize, finalIndex, root) {
+			t.Errorf("file size %v: valid storage proof of the final segment not verified", fileSize)
+		}
+		if len(base) > 1 && vm.VerifyStorageProof(segment[:len(base)-1], hashSet, fileSize, storage.SegmentSize, finalIndex, root) {
+			t.Errorf("file size %v: storage proof with short final segment is verified", fileSize)
+		}
+	}
+}
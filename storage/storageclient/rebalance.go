@@ -0,0 +1,321 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// errRebalanceTooFrequent is the error returned if the rebalance is run again within the
+// rebalance interval
+var errRebalanceTooFrequent = errors.New("the last rebalance was run too recently")
+
+// hostInfoRetriever retrieves the host info of the storage host, which is
+// StorageHostManager.RetrieveHostInfo
+type hostInfoRetriever func(id enode.ID) (storage.HostInfo, bool)
+
+// rebalanceHost is a host with active contract the files could be migrated to
+type rebalanceHost struct {
+	id           enode.ID
+	storagePrice common.BigInt
+	uploadPrice  common.BigInt
+
+	// remainingStorage is the storage the host has left
+	remainingStorage uint64
+
+	// endHeight is the end height of the contract with the host
+	endHeight uint64
+}
+
+// RebalanceCostPlan returns the migrations the next rebalance run would start, and the projected
+// storage cost saved, without migrating any file
+func (client *StorageClient) RebalanceCostPlan() (storage.RebalancePlan, error) {
+	if err := client.tm.Add(); err != nil {
+		return storage.RebalancePlan{}, err
+	}
+	defer client.tm.Done()
+
+	return client.planRebalance(client.storageHostManager.RetrieveHostInfo, rebalanceMaxBytesPerRun)
+}
+
+// RebalanceForCost migrates the files stored on the expensive hosts to the cheapest hosts with
+// active contracts, to reduce the ongoing storage cost. Each run migrates the files saving the
+// most first, up to rebalanceMaxBytesPerRun of data, and the runs are at least rebalanceInterval
+// apart. The files are migrated by the relocation, so the files keep their redundancy during
+// the migration. Return the migrations started
+func (client *StorageClient) RebalanceForCost() (storage.RebalancePlan, error) {
+	if err := client.tm.Add(); err != nil {
+		return storage.RebalancePlan{}, err
+	}
+	defer client.tm.Done()
+
+	return client.rebalanceForCost(client.storageHostManager.RetrieveHostInfo, rebalanceMaxBytesPerRun)
+}
+
+// rebalanceForCost runs the rebalance with the host info from retrieve, migrating at most
+// maxBytes of data
+func (client *StorageClient) rebalanceForCost(retrieve hostInfoRetriever, maxBytes uint64) (storage.RebalancePlan, error) {
+	client.lock.Lock()
+	if !client.lastRebalance.IsZero() && time.Since(client.lastRebalance) < rebalanceInterval {
+		client.lock.Unlock()
+		return storage.RebalancePlan{}, errRebalanceTooFrequent
+	}
+	client.lastRebalance = time.Now()
+	client.lock.Unlock()
+
+	plan, err := client.planRebalance(retrieve, maxBytes)
+	if err != nil {
+		return storage.RebalancePlan{}, err
+	}
+	started := storage.RebalancePlan{
+		UploadCost:      common.BigInt0,
+		SavingsPerBlock: common.BigInt0,
+	}
+	for _, migration := range plan.Migrations {
+		path, err := storage.NewDxPath(migration.Path)
+		if err == nil {
+			err = client.RelocateFile(path, migration.ToHosts)
+		}
+		if err != nil {
+			client.log.Warn("failed to migrate the file for cost", "dxpath", migration.Path, "err", err)
+			continue
+		}
+		addRebalanceMigration(&started, migration)
+	}
+	return started, nil
+}
+
+// planRebalance plans the migrations of the files to the cheapest hosts with active contracts,
+// with the host prices from retrieve. The file is migrated only if every sector of the file is
+// stored, the migration saves at least rebalanceMinSavingsPercent of its storage cost, and the
+// savings pay back the upload cost before the contracts with the target hosts end. The
+// migrations saving the most are planned first, until maxBytes of data are to be re-uploaded
+// or the target hosts have no storage left
+func (client *StorageClient) planRebalance(retrieve hostInfoRetriever, maxBytes uint64) (storage.RebalancePlan, error) {
+	plan := storage.RebalancePlan{
+		UploadCost:      common.BigInt0,
+		SavingsPerBlock: common.BigInt0,
+	}
+	hosts := client.rebalanceHosts(retrieve)
+	height := client.ethBackend.GetCurrentBlockHeight()
+	healths, err := client.fileSystem.FileHealths()
+	if err != nil {
+		return plan, err
+	}
+
+	var migrations []storage.RebalanceMigration
+	for path := range healths {
+		migration, ok, err := client.planFileMigration(path, hosts, retrieve, height)
+		if err != nil {
+			client.log.Warn("failed to plan the migration of the file", "dxpath", path.Path, "err", err)
+			continue
+		}
+		if ok {
+			migrations = append(migrations, migration)
+		}
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		if cmp := migrations[i].SavingsPerBlock.Cmp(migrations[j].SavingsPerBlock); cmp != 0 {
+			return cmp > 0
+		}
+		return migrations[i].Path < migrations[j].Path
+	})
+	remaining := make(map[enode.ID]uint64, len(hosts))
+	for _, host := range hosts {
+		remaining[host.id] = host.remainingStorage
+	}
+	for _, migration := range migrations {
+		if plan.Bytes+migration.Bytes > maxBytes {
+			continue
+		}
+		// each target host stores one sector of each segment
+		hostBytes := migration.Bytes / uint64(len(migration.ToHosts))
+		if !rebalanceHostsFit(remaining, migration.ToHosts, hostBytes) {
+			continue
+		}
+		for _, host := range migration.ToHosts {
+			remaining[host] -= hostBytes
+		}
+		addRebalanceMigration(&plan, migration)
+	}
+	return plan, nil
+}
+
+// rebalanceHostsFit returns whether each of the hosts has at least size of storage remaining
+func rebalanceHostsFit(remaining map[enode.ID]uint64, hosts []enode.ID, size uint64) bool {
+	for _, host := range hosts {
+		if remaining[host] < size {
+			return false
+		}
+	}
+	return true
+}
+
+// rebalanceHosts returns the hosts with active contracts able to upload and known prices, sorted
+// from the cheapest to the most expensive in storage price
+func (client *StorageClient) rebalanceHosts(retrieve hostInfoRetriever) []rebalanceHost {
+	client.lock.Lock()
+	contracts := make(map[enode.ID]storage.ContractMetaData)
+	for _, w := range client.workerPool {
+		contracts[w.contract.EnodeID] = w.contract
+	}
+	client.lock.Unlock()
+
+	hosts := make([]rebalanceHost, 0, len(contracts))
+	for id, contract := range contracts {
+		if !client.contractUploadAbility(contract.ID) {
+			continue
+		}
+		info, exist := retrieve(id)
+		if !exist {
+			continue
+		}
+		hosts = append(hosts, rebalanceHost{
+			id:               id,
+			storagePrice:     info.StoragePrice,
+			uploadPrice:      info.UploadBandwidthPrice,
+			remainingStorage: info.RemainingStorage,
+			endHeight:        contract.EndHeight,
+		})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if cmp := hosts[i].storagePrice.Cmp(hosts[j].storagePrice); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(hosts[i].id[:], hosts[j].id[:]) < 0
+	})
+	return hosts
+}
+
+// planFileMigration plans the migration of the file to the cheapest hosts with enough storage
+// left. Return false if the file is not worth or not able to be migrated
+func (client *StorageClient) planFileMigration(path storage.DxPath, hosts []rebalanceHost, retrieve hostInfoRetriever, height uint64) (storage.RebalanceMigration, bool, error) {
+	entry, err := client.fileSystem.OpenDxFile(path)
+	if err != nil {
+		return storage.RebalanceMigration{}, false, err
+	}
+	defer entry.Close()
+
+	if _, relocating := client.relocations.targets(entry.UID()); relocating {
+		return storage.RebalanceMigration{}, false, nil
+	}
+	ec, err := entry.ErasureCode()
+	if err != nil {
+		return storage.RebalanceMigration{}, false, err
+	}
+	// each target host stores one sector of each segment
+	numSectors := int(ec.NumSectors())
+	numSegments := uint64(entry.NumSegments())
+	var targets []rebalanceHost
+	for _, host := range hosts {
+		if len(targets) == numSectors {
+			break
+		}
+		if host.remainingStorage >= numSegments*storage.SectorSize {
+			targets = append(targets, host)
+		}
+	}
+	if len(targets) < numSectors {
+		return storage.RebalanceMigration{}, false, nil
+	}
+
+	// the current storage cost of all sectors stored, and the hosts to be released
+	currentCost, usedHosts, complete, err := fileStorageCost(entry, retrieve)
+	if err != nil || !complete {
+		return storage.RebalanceMigration{}, false, err
+	}
+
+	// after the migration, each segment is stored with one sector on each target host. The
+	// savings are collected until the first contract with the target hosts ends
+	targetStoragePrice, targetUploadPrice := common.BigInt0, common.BigInt0
+	migration := storage.RebalanceMigration{
+		Path:  path.Path,
+		Bytes: numSegments * uint64(numSectors) * storage.SectorSize,
+	}
+	targetSet := make(map[enode.ID]struct{}, len(targets))
+	endHeight := targets[0].endHeight
+	for _, host := range targets {
+		if host.endHeight < endHeight {
+			endHeight = host.endHeight
+		}
+		targetSet[host.id] = struct{}{}
+		targetStoragePrice = targetStoragePrice.Add(host.storagePrice)
+		targetUploadPrice = targetUploadPrice.Add(host.uploadPrice)
+		migration.ToHosts = append(migration.ToHosts, host.id)
+	}
+	for host := range usedHosts {
+		if _, target := targetSet[host]; !target {
+			migration.FromHosts = append(migration.FromHosts, host)
+		}
+	}
+	if len(migration.FromHosts) == 0 {
+		return storage.RebalanceMigration{}, false, nil
+	}
+	sort.Slice(migration.FromHosts, func(i, j int) bool {
+		return bytes.Compare(migration.FromHosts[i][:], migration.FromHosts[j][:]) < 0
+	})
+
+	projectedCost := targetStoragePrice.MultUint64(numSegments * storage.SectorSize)
+	savings := currentCost.Sub(projectedCost)
+	if savings.Sign() <= 0 || savings.MultUint64(100).Cmp(currentCost.MultUint64(rebalanceMinSavingsPercent)) < 0 {
+		return storage.RebalanceMigration{}, false, nil
+	}
+	migration.SavingsPerBlock = savings
+	migration.UploadCost = targetUploadPrice.MultUint64(numSegments * storage.SectorSize)
+
+	// the migration must pay back the upload cost within the remaining contract period
+	if endHeight <= height || savings.MultUint64(endHeight-height).Cmp(migration.UploadCost) < 0 {
+		return storage.RebalanceMigration{}, false, nil
+	}
+	return migration, true, nil
+}
+
+// fileStorageCost returns the storage cost per block of all sectors of the file stored, and
+// the hosts storing the sectors. The sector on the host with unknown price costs nothing.
+// complete tells whether every sector of the file is stored on at least one host
+func fileStorageCost(entry *dxfile.FileSetEntryWithID, retrieve hostInfoRetriever) (cost common.BigInt, hosts map[enode.ID]struct{}, complete bool, err error) {
+	cost, hosts, complete = common.BigInt0, make(map[enode.ID]struct{}), true
+	prices := make(map[enode.ID]common.BigInt)
+	for i := 0; i != entry.NumSegments(); i++ {
+		sectors, err := entry.Sectors(i)
+		if err != nil {
+			return common.BigInt0, nil, false, err
+		}
+		for _, sectorList := range sectors {
+			if len(sectorList) == 0 {
+				complete = false
+			}
+			for _, sector := range sectorList {
+				price, known := prices[sector.HostID]
+				if !known {
+					price = common.BigInt0
+					if info, exist := retrieve(sector.HostID); exist {
+						price = info.StoragePrice
+					}
+					prices[sector.HostID] = price
+				}
+				hosts[sector.HostID] = struct{}{}
+				cost = cost.Add(price.MultUint64(storage.SectorSize))
+			}
+		}
+	}
+	return
+}
+
+// addRebalanceMigration adds the migration to the plan, and sums up the data and costs
+func addRebalanceMigration(plan *storage.RebalancePlan, migration storage.RebalanceMigration) {
+	plan.Migrations = append(plan.Migrations, migration)
+	plan.Bytes += migration.Bytes
+	plan.UploadCost = plan.UploadCost.Add(migration.UploadCost)
+	plan.SavingsPerBlock = plan.SavingsPerBlock.Add(migration.SavingsPerBlock)
+}
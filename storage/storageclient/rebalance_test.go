@@ -0,0 +1,200 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// TestStorageClient_RebalanceForCost test the files on the expensive hosts are planned to be
+// migrated to the cheap hosts with the projected savings, and each rebalance run migrates the
+// files within the data limit and is rate limited
+func TestStorageClient_RebalanceForCost(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	// two expensive hosts storing the files, and two cheap hosts
+	mockAddWorkers(4, client)
+	var hosts []enode.ID
+	for _, w := range client.workerPool {
+		w.contract.EnodeID = w.hostID
+		w.contract.EndHeight = 1000
+		hosts = append(hosts, w.hostID)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].String() < hosts[j].String() })
+	expensive, cheap := hosts[:2], hosts[2:]
+	prices := make(map[enode.ID]storage.HostInfo)
+	for _, host := range expensive {
+		prices[host] = storage.HostInfo{HostExtConfig: storage.HostExtConfig{StoragePrice: common.NewBigInt(100), UploadBandwidthPrice: common.NewBigInt(1), RemainingStorage: 1 << 40}}
+	}
+	for _, host := range cheap {
+		prices[host] = storage.HostInfo{HostExtConfig: storage.HostExtConfig{StoragePrice: common.NewBigInt(10), UploadBandwidthPrice: common.NewBigInt(1), RemainingStorage: 1 << 40}}
+	}
+	retrieve := func(id enode.ID) (storage.HostInfo, bool) {
+		info, exist := prices[id]
+		return info, exist
+	}
+
+	var entries []*dxfile.FileSetEntryWithID
+	for i := 0; i != 2; i++ {
+		entry := newFileEntry(t, client)
+		defer func() {
+			os.Remove(string(entry.LocalPath()))
+			os.Remove(string(entry.FilePath()))
+			entry.Close()
+		}()
+		for segmentIndex := 0; segmentIndex != entry.NumSegments(); segmentIndex++ {
+			for sectorIndex, host := range expensive {
+				if err := entry.AddSector(host, common.Hash{byte(i), byte(segmentIndex), byte(sectorIndex)}, segmentIndex, sectorIndex); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	fileBytes := uint64(entries[0].NumSegments()) * 2 * storage.SectorSize
+
+	// the projected savings are exposed before any file is migrated
+	plan, err := client.planRebalance(retrieve, 2*fileBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Migrations) != 2 || plan.Bytes != 2*fileBytes {
+		t.Fatalf("expect 2 files of %v bytes planned, got %v files of %v bytes", 2*fileBytes, len(plan.Migrations), plan.Bytes)
+	}
+	expectSavings := common.NewBigInt(2 * (100 - 10)).MultUint64(fileBytes / 2)
+	for _, migration := range plan.Migrations {
+		if !reflect.DeepEqual(migration.ToHosts, cheap) || !reflect.DeepEqual(migration.FromHosts, expensive) {
+			t.Errorf("expect migrating from %v to %v, got from %v to %v", expensive, cheap, migration.FromHosts, migration.ToHosts)
+		}
+		if migration.SavingsPerBlock.Cmp(expectSavings) != 0 {
+			t.Errorf("expect savings %v per block, got %v", expectSavings, migration.SavingsPerBlock)
+		}
+	}
+	for _, entry := range entries {
+		if _, relocating := client.relocations.targets(entry.UID()); relocating {
+			t.Fatalf("file migrated by the plan")
+		}
+	}
+
+	// the run migrates the files within the limit to the cheap hosts
+	started, err := client.rebalanceForCost(retrieve, fileBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(started.Migrations) != 1 || started.Bytes != fileBytes {
+		t.Fatalf("expect 1 file of %v bytes migrated, got %v files of %v bytes", fileBytes, len(started.Migrations), started.Bytes)
+	}
+	var migrated *dxfile.FileSetEntryWithID
+	for _, entry := range entries {
+		targets, relocating := client.relocations.targets(entry.UID())
+		if !relocating {
+			continue
+		}
+		migrated = entry
+		for _, host := range cheap {
+			if _, exist := targets[host]; !exist {
+				t.Errorf("file not migrated to the cheap host %v", host)
+			}
+		}
+	}
+	if migrated == nil || migrated.DxPath().Path != started.Migrations[0].Path {
+		t.Fatalf("the file planned is not migrated")
+	}
+
+	// the runs are rate limited
+	if _, err = client.rebalanceForCost(retrieve, fileBytes); err != errRebalanceTooFrequent {
+		t.Fatalf("expect %v, got %v", errRebalanceTooFrequent, err)
+	}
+
+	// the next run continues with the file not yet migrated
+	client.lastRebalance = client.lastRebalance.Add(-rebalanceInterval)
+	started, err = client.rebalanceForCost(retrieve, fileBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(started.Migrations) != 1 || started.Migrations[0].Path == migrated.DxPath().Path {
+		t.Fatalf("expect the other file migrated in the next run, got %+v", started.Migrations)
+	}
+}
+
+// TestStorageClient_RebalanceSkipsMigrations test the migrations are not planned if the savings
+// do not pay back the upload cost before the contracts end, or the cheap hosts have no storage left
+func TestStorageClient_RebalanceSkipsMigrations(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	mockAddWorkers(4, client)
+	var hosts []enode.ID
+	for _, w := range client.workerPool {
+		w.contract.EnodeID = w.hostID
+		hosts = append(hosts, w.hostID)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].String() < hosts[j].String() })
+	expensive, cheap := hosts[:2], hosts[2:]
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(string(entry.FilePath()))
+		entry.Close()
+	}()
+	for segmentIndex := 0; segmentIndex != entry.NumSegments(); segmentIndex++ {
+		for sectorIndex, host := range expensive {
+			if err := entry.AddSector(host, common.Hash{byte(segmentIndex), byte(sectorIndex)}, segmentIndex, sectorIndex); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fileBytes := uint64(entry.NumSegments()) * 2 * storage.SectorSize
+
+	tests := []struct {
+		name             string
+		endHeight        uint64
+		uploadPrice      int64
+		remainingStorage uint64
+		migrate          bool
+	}{
+		{"profitable", 1000, 1, 1 << 40, true},
+		{"upload cost not paid back", 1000, 1e6, 1 << 40, false},
+		{"contracts ended", 0, 1, 1 << 40, false},
+		{"cheap hosts full", 1000, 1, storage.SectorSize, false},
+	}
+	for _, test := range tests {
+		for _, w := range client.workerPool {
+			w.contract.EndHeight = test.endHeight
+		}
+		prices := make(map[enode.ID]storage.HostInfo)
+		for _, host := range expensive {
+			prices[host] = storage.HostInfo{HostExtConfig: storage.HostExtConfig{StoragePrice: common.NewBigInt(100), UploadBandwidthPrice: common.NewBigInt(1), RemainingStorage: 1 << 40}}
+		}
+		for _, host := range cheap {
+			prices[host] = storage.HostInfo{HostExtConfig: storage.HostExtConfig{StoragePrice: common.NewBigInt(10), UploadBandwidthPrice: common.NewBigInt(test.uploadPrice), RemainingStorage: test.remainingStorage}}
+		}
+		retrieve := func(id enode.ID) (storage.HostInfo, bool) {
+			info, exist := prices[id]
+			return info, exist
+		}
+		plan, err := client.planRebalance(retrieve, fileBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if migrate := len(plan.Migrations) != 0; migrate != test.migrate {
+			t.Errorf("%v: expect migrate %v, got %v", test.name, test.migrate, migrate)
+		}
+	}
+}
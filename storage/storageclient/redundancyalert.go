@@ -0,0 +1,148 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/DxChainNetwork/godx/event"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// redundancyAlertBufferSize is the size of the channel buffering the alerts for a subscriber
+const redundancyAlertBufferSize = 16
+
+// RedundancyAlert is the alert fired when the redundancy of a file drops below the alert
+// threshold. The redundancy is in the unit of FileInfo.Redundancy, that is, 100 for the sectors
+// just enough to recover the file
+type RedundancyAlert struct {
+	DxPath     string `json:"dxpath"`
+	Redundancy uint32 `json:"redundancy"`
+	Threshold  uint32 `json:"threshold"`
+}
+
+// redundancyAlerts records the files with the redundancy below the alert threshold, so that an
+// alert is fired once when the redundancy drops below the threshold, and fired again only after
+// the redundancy recovers and drops again
+type redundancyAlerts struct {
+	below map[string]struct{}
+	feed  event.Feed
+	mu    sync.Mutex
+}
+
+// newRedundancyAlerts creates an empty redundancyAlerts
+func newRedundancyAlerts() *redundancyAlerts {
+	return &redundancyAlerts{
+		below: make(map[string]struct{}),
+	}
+}
+
+// check records the redundancy of the file checked. Return true if the redundancy crosses
+// below the threshold. 0 threshold disables the alert of the file
+func (ra *redundancyAlerts) check(path string, redundancy, threshold uint32) bool {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	if threshold == 0 || redundancy >= threshold {
+		delete(ra.below, path)
+		return false
+	}
+	if _, exist := ra.below[path]; exist {
+		return false
+	}
+	ra.below[path] = struct{}{}
+	return true
+}
+
+// checkRedundancyAlert is the health check hook of the file system. An alert is sent to the
+// subscribers if the redundancy of the file crosses below its alert threshold
+func (client *StorageClient) checkRedundancyAlert(dxPath storage.DxPath, redundancy uint32) {
+	client.lock.Lock()
+	threshold, exist := client.persist.FileRedundancyAlertThresholds[dxPath.Path]
+	if !exist {
+		threshold = client.persist.RedundancyAlertThreshold
+	}
+	client.lock.Unlock()
+
+	if !client.redundancyAlerts.check(dxPath.Path, redundancy, threshold) {
+		return
+	}
+	client.log.Warn("file redundancy below the alert threshold", "dxpath", dxPath.Path, "redundancy", redundancy, "threshold", threshold)
+	client.redundancyAlerts.feed.Send(RedundancyAlert{
+		DxPath:     dxPath.Path,
+		Redundancy: redundancy,
+		Threshold:  threshold,
+	})
+}
+
+// SubscribeRedundancyAlert subscribes the alerts of the file redundancy dropping below the alert
+// threshold. The alerts are sent in the health scan, so the subscriber shall keep receiving
+func (client *StorageClient) SubscribeRedundancyAlert(ch chan<- RedundancyAlert) event.Subscription {
+	return client.redundancyAlerts.feed.Subscribe(ch)
+}
+
+// SetRedundancyAlertThreshold set the redundancy threshold of the alert of the files without
+// their own thresholds. 0 disables the alert
+func (client *StorageClient) SetRedundancyAlertThreshold(threshold uint32) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.RedundancyAlertThreshold = threshold
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetFileRedundancyAlertThreshold set the redundancy threshold of the alert of the file, which
+// overrides the global threshold. 0 disables the alert of the file
+func (client *StorageClient) SetFileRedundancyAlertThreshold(dxPath storage.DxPath, threshold uint32) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return
+	}
+	entry.Close()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if client.persist.FileRedundancyAlertThresholds == nil {
+		client.persist.FileRedundancyAlertThresholds = make(map[string]uint32)
+	}
+	client.persist.FileRedundancyAlertThresholds[dxPath.Path] = threshold
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// ResetFileRedundancyAlertThreshold removes the redundancy threshold of the alert of the file,
+// so that the global threshold applies to the file
+func (client *StorageClient) ResetFileRedundancyAlertThreshold(dxPath storage.DxPath) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	delete(client.persist.FileRedundancyAlertThresholds, dxPath.Path)
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"testing"
+
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestStorageClient_CheckRedundancyAlert test the alert is fired once when the redundancy of a
+// file drops below the threshold, and fired again only after the redundancy recovers
+func TestStorageClient_CheckRedundancyAlert(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+	client.persist.RedundancyAlertThreshold = 150
+
+	alerts := make(chan RedundancyAlert, redundancyAlertBufferSize)
+	sub := client.SubscribeRedundancyAlert(alerts)
+	defer sub.Unsubscribe()
+
+	path, err := storage.NewDxPath("alert/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, redundancy := range []uint32{200, 120, 100, 160, 140} {
+		client.checkRedundancyAlert(path, redundancy)
+	}
+	expects := []RedundancyAlert{
+		{DxPath: path.Path, Redundancy: 120, Threshold: 150},
+		{DxPath: path.Path, Redundancy: 140, Threshold: 150},
+	}
+	if len(alerts) != len(expects) {
+		t.Fatalf("expect %v alerts, got %v", len(expects), len(alerts))
+	}
+	for i, expect := range expects {
+		if alert := <-alerts; alert != expect {
+			t.Errorf("alert %v: expect %+v, got %+v", i, expect, alert)
+		}
+	}
+
+	// The threshold of the file overrides the global threshold
+	client.persist.FileRedundancyAlertThresholds = map[string]uint32{path.Path: 0}
+	client.checkRedundancyAlert(path, 200)
+	client.checkRedundancyAlert(path, 50)
+	if len(alerts) != 0 {
+		t.Fatalf("alert of the file disabled, got %+v", <-alerts)
+	}
+	client.persist.FileRedundancyAlertThresholds[path.Path] = 60
+	client.checkRedundancyAlert(path, 50)
+	if len(alerts) != 1 {
+		t.Fatalf("expect 1 alert, got %v", len(alerts))
+	}
+	if alert := <-alerts; alert.Threshold != 60 {
+		t.Errorf("expect threshold 60, got %v", alert.Threshold)
+	}
+}
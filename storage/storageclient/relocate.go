@@ -0,0 +1,219 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// errRelocationInProgress is the error returned if the file is already being relocated
+var errRelocationInProgress = errors.New("the file is already being relocated")
+
+// fileRelocations records the target hosts of the files being relocated. While a file is being
+// relocated, only the sectors stored on the target hosts count as uploaded, and the sectors are
+// uploaded only to the target hosts. The sectors on the other hosts are kept until every sector
+// of the file is stored on the target hosts, so the file never drops below its redundancy.
+// The relocations are not persisted, so an interrupted relocation leaves the file on both host sets
+type fileRelocations struct {
+	files map[dxfile.FileID]map[enode.ID]struct{}
+	mu    sync.Mutex
+}
+
+// newFileRelocations creates an empty fileRelocations
+func newFileRelocations() *fileRelocations {
+	return &fileRelocations{
+		files: make(map[dxfile.FileID]map[enode.ID]struct{}),
+	}
+}
+
+// add starts the relocation of the file to the target hosts. Return false if the file is
+// already being relocated
+func (fr *fileRelocations) add(fid dxfile.FileID, targets map[enode.ID]struct{}) bool {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if _, exist := fr.files[fid]; exist {
+		return false
+	}
+	fr.files[fid] = targets
+	return true
+}
+
+// targets returns the target hosts of the file being relocated
+func (fr *fileRelocations) targets(fid dxfile.FileID) (map[enode.ID]struct{}, bool) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	targets, exist := fr.files[fid]
+	return targets, exist
+}
+
+// remove finishes the relocation of the file
+func (fr *fileRelocations) remove(fid dxfile.FileID) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	delete(fr.files, fid)
+}
+
+// RelocateFile re-uploads the sectors of the file to the target hosts, and releases the file from
+// the other hosts once every sector is stored on the target hosts. The sectors on the other hosts
+// are no longer tracked by the file after the release. The target hosts must have
+// active contracts, and be enough to store all sectors of a segment on distinct hosts
+func (client *StorageClient) RelocateFile(dxPath storage.DxPath, targetHosts []enode.ID) error {
+	if err := client.tm.Add(); err != nil {
+		return err
+	}
+	defer client.tm.Done()
+
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+
+	ec, err := entry.ErasureCode()
+	if err != nil {
+		return err
+	}
+	targets := make(map[enode.ID]struct{})
+	for _, host := range targetHosts {
+		targets[host] = struct{}{}
+	}
+	if len(targets) < int(ec.NumSectors()) {
+		return fmt.Errorf("%v target hosts cannot store the %v sectors of a segment", len(targets), ec.NumSectors())
+	}
+
+	// All target hosts must be able to upload
+	client.lock.Lock()
+	workerHosts := make(map[enode.ID]struct{})
+	for _, w := range client.workerPool {
+		workerHosts[w.contract.EnodeID] = struct{}{}
+	}
+	client.lock.Unlock()
+	for host := range targets {
+		if _, exist := workerHosts[host]; !exist {
+			return fmt.Errorf("no active contract with the target host %v", host.String())
+		}
+	}
+
+	if !client.relocations.add(entry.UID(), targets) {
+		return errRelocationInProgress
+	}
+	if client.finishRelocation(entry) {
+		return nil
+	}
+
+	// Push all segments of the file to the upload heap, including the stuck segments. The
+	// segments are uploaded only to the target hosts
+	hosts := make(map[string]struct{})
+	for host := range targets {
+		hosts[host.String()] = struct{}{}
+	}
+	hostHealthInfoTable := client.contractManager.HostHealthMap()
+	for _, target := range []uploadTarget{targetUnstuckSegments, targetStuckSegments} {
+		client.lock.Lock()
+		segments, err := client.createUnfinishedSegments(entry, hosts, target, hostHealthInfoTable)
+		client.lock.Unlock()
+		if err != nil {
+			client.relocations.remove(entry.UID())
+			return err
+		}
+		for _, segment := range segments {
+			client.uploadHeap.push(segment)
+		}
+	}
+
+	select {
+	case client.uploadHeap.segmentComing <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// finishRelocation releases the file from the hosts other than the target hosts if every sector
+// of the file is stored on the target hosts. Return whether the relocation is finished
+func (client *StorageClient) finishRelocation(entry *dxfile.FileSetEntryWithID) bool {
+	targets, exist := client.relocations.targets(entry.UID())
+	if !exist {
+		return false
+	}
+	stored, err := storedOnHosts(entry, targets)
+	if err != nil {
+		client.log.Error("failed to check the sectors of the file relocated", "dxpath", entry.DxPath(), "err", err)
+		return false
+	}
+	if !stored {
+		return false
+	}
+
+	used := make([]enode.ID, 0, len(targets))
+	for host := range targets {
+		used = append(used, host)
+	}
+	// The sectors on the previous hosts are deleted from the hosts, so that the storage
+	// released by the relocation is no longer paid for
+	released := make(map[enode.ID][]common.Hash)
+	for host, roots := range entry.HostSectorRoots() {
+		if _, target := targets[host]; !target {
+			released[host] = roots
+		}
+	}
+	if err = entry.UpdateUsedHosts(used); err != nil {
+		client.log.Error("failed to release the file from the previous hosts", "dxpath", entry.DxPath(), "err", err)
+		return false
+	}
+	if len(released) != 0 {
+		client.enqueueSectorCleanup(released)
+	}
+	// Remove the sectors on the previous hosts. The failure only wastes space
+	if err = entry.Compact(); err != nil {
+		client.log.Warn("failed to compact the file relocated", "dxpath", entry.DxPath(), "err", err)
+	}
+	client.relocations.remove(entry.UID())
+	client.log.Info("file relocated to the target hosts", "dxpath", entry.DxPath())
+	return true
+}
+
+// isRelocationTarget returns whether the host specified by the enode ID string is one of the
+// target hosts
+func isRelocationTarget(targets map[enode.ID]struct{}, host string) bool {
+	for target := range targets {
+		if target.String() == host {
+			return true
+		}
+	}
+	return false
+}
+
+// storedOnHosts returns whether every sector of the file is stored on at least one of the hosts
+func storedOnHosts(entry *dxfile.FileSetEntryWithID, hosts map[enode.ID]struct{}) (bool, error) {
+	for i := 0; i != entry.NumSegments(); i++ {
+		sectors, err := entry.Sectors(i)
+		if err != nil {
+			return false, err
+		}
+		for _, sectorList := range sectors {
+			var stored bool
+			for _, sector := range sectorList {
+				if _, exist := hosts[sector.HostID]; exist {
+					stored = true
+					break
+				}
+			}
+			if !stored {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+)
+
+// TestStorageClient_RelocateFile test relocating a file stored on the previous hosts to a new
+// host set. The segments are uploaded only to the target hosts, and the previous hosts are
+// released only after every sector is stored on the target hosts
+func TestStorageClient_RelocateFile(t *testing.T) {
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(string(entry.FilePath()))
+		entry.Close()
+	}()
+
+	// the file is stored on the previous hosts
+	prevHosts := []enode.ID{enode.RandomID(enode.ID{}, 10), enode.RandomID(enode.ID{}, 11)}
+	for i := 0; i != entry.NumSegments(); i++ {
+		for sectorIndex, host := range prevHosts {
+			if err := entry.AddSector(host, common.Hash{byte(i), byte(sectorIndex)}, i, sectorIndex); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	mockAddWorkers(3, client)
+	var targets []enode.ID
+	for _, w := range client.workerPool {
+		w.contract.EnodeID = w.hostID
+		targets = append(targets, w.hostID)
+	}
+	targets = targets[:2]
+
+	// The target hosts shall be enough and all have contracts
+	if err := client.RelocateFile(entry.DxPath(), targets[:1]); err == nil {
+		t.Errorf("relocated to the target hosts not enough for a segment")
+	}
+	if err := client.RelocateFile(entry.DxPath(), []enode.ID{targets[0], prevHosts[0]}); err == nil {
+		t.Errorf("relocated to the host without contract")
+	}
+
+	if err := client.RelocateFile(entry.DxPath(), targets); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RelocateFile(entry.DxPath(), targets); err != errRelocationInProgress {
+		t.Errorf("expect %v relocating again, got %v", errRelocationInProgress, err)
+	}
+	if client.uploadHeap.len() != entry.NumSegments() {
+		t.Fatalf("expect %v segments pushed, got %v", entry.NumSegments(), client.uploadHeap.len())
+	}
+	for client.uploadHeap.len() > 0 {
+		segment := client.uploadHeap.pop()
+		if segment.sectorsCompletedNum != 0 {
+			t.Errorf("sectors on the previous hosts counted as uploaded: %v", segment.sectorsCompletedNum)
+		}
+		if len(segment.unusedHosts) != len(targets) {
+			t.Errorf("expect segment uploaded to %v target hosts, got %v", len(targets), len(segment.unusedHosts))
+		}
+		for _, host := range targets {
+			if _, exist := segment.unusedHosts[host.String()]; !exist {
+				t.Errorf("target host %v not assigned to the segment", host)
+			}
+		}
+	}
+
+	// The previous hosts are not released until all segments are stored on the target hosts
+	for i := 0; i != entry.NumSegments(); i++ {
+		if i == entry.NumSegments()-1 && client.finishRelocation(entry) {
+			t.Fatalf("relocation finished before all segments are stored on the target hosts")
+		}
+		for sectorIndex, host := range targets {
+			if err := entry.AddSector(host, common.Hash{byte(i), byte(sectorIndex)}, i, sectorIndex); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !client.finishRelocation(entry) {
+		t.Fatalf("relocation not finished after all segments are stored on the target hosts")
+	}
+	pending := client.sectorCleanup.pending()
+	for _, host := range prevHosts {
+		if entry.HasSectorsOnHost(host) {
+			t.Errorf("previous host %v not released", host)
+		}
+		if len(pending[host]) != entry.NumSegments() {
+			t.Errorf("expect %v sectors on the previous host %v queued for cleanup, got %v", entry.NumSegments(), host, len(pending[host]))
+		}
+	}
+	for _, host := range targets {
+		if len(pending[host]) != 0 {
+			t.Errorf("sectors on the target host %v queued for cleanup", host)
+		}
+	}
+	for _, host := range targets {
+		if !entry.HasSectorsOnHost(host) {
+			t.Errorf("target host %v not storing sectors", host)
+		}
+	}
+	if _, relocating := client.relocations.targets(entry.UID()); relocating {
+		t.Errorf("relocation not removed after finished")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// repairBudget caps the failed repairs of each file within a time window. Once a file exhausts
+// its budget, the segments of the file are skipped so that the repairs of other files proceed,
+// until the window of the file resets. The files exhausting the budget are flagged as problematic
+type repairBudget struct {
+	maxFailures int
+	window      time.Duration
+
+	files map[dxfile.FileID]*fileRepairBudget
+	mu    sync.Mutex
+}
+
+// fileRepairBudget is the repair budget spent by a file in the current window
+type fileRepairBudget struct {
+	dxPath      storage.DxPath
+	windowStart time.Time
+	failures    int
+}
+
+// newRepairBudget creates a repairBudget allowing maxFailures failed repairs per file in each window
+func newRepairBudget(maxFailures int, window time.Duration) *repairBudget {
+	return &repairBudget{
+		maxFailures: maxFailures,
+		window:      window,
+		files:       make(map[dxfile.FileID]*fileRepairBudget),
+	}
+}
+
+// recordFailure records a failed repair of the file. Return true if the file exhausts its
+// budget with this failure
+func (rb *repairBudget) recordFailure(fid dxfile.FileID, dxPath storage.DxPath, now time.Time) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	budget := rb.fileBudget(fid, now)
+	if budget == nil {
+		budget = &fileRepairBudget{windowStart: now}
+		rb.files[fid] = budget
+	}
+	budget.dxPath = dxPath
+	budget.failures++
+	return budget.failures == rb.maxFailures
+}
+
+// allow returns whether the file still has budget for repairs
+func (rb *repairBudget) allow(fid dxfile.FileID, now time.Time) bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	budget := rb.fileBudget(fid, now)
+	return budget == nil || budget.failures < rb.maxFailures
+}
+
+// exhaustedFiles returns the paths of the files which have exhausted their budgets in the
+// current window, sorted by path
+func (rb *repairBudget) exhaustedFiles(now time.Time) []storage.DxPath {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	var paths []storage.DxPath
+	for fid := range rb.files {
+		if budget := rb.fileBudget(fid, now); budget != nil && budget.failures >= rb.maxFailures {
+			paths = append(paths, budget.dxPath)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
+	return paths
+}
+
+// fileBudget returns the budget of the file in the current window. The budget of the expired
+// window is removed and nil is returned. The caller must hold the lock
+func (rb *repairBudget) fileBudget(fid dxfile.FileID, now time.Time) *fileRepairBudget {
+	budget, exists := rb.files[fid]
+	if !exists {
+		return nil
+	}
+	if now.Sub(budget.windowStart) >= rb.window {
+		delete(rb.files, fid)
+		return nil
+	}
+	return budget
+}
+
+// popSegmentWithinBudget pops the next segment from the upload heap whose file still has repair
+// budget. The segments of the files exhausting their budgets are dropped from the heap, and they
+// will be pushed again by the repair loop after the budget window resets
+func (client *StorageClient) popSegmentWithinBudget() *unfinishedUploadSegment {
+	now := time.Now()
+	for {
+		segment := client.uploadHeap.pop()
+		if segment == nil || client.repairBudget.allow(segment.id.fid, now) {
+			return segment
+		}
+		client.log.Debug("skip the segment of the file exhausting the repair budget", "segmentID", segment.id)
+	}
+}
+
+// RepairThrottledFiles returns the files whose repairs are throttled because of repeated
+// failures. These files are likely stored on bad hosts and need the attention of the user
+func (client *StorageClient) RepairThrottledFiles() []storage.DxPath {
+	return client.repairBudget.exhaustedFiles(time.Now())
+}
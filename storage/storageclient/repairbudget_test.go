@@ -0,0 +1,73 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/log"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// TestRepairBudget test the file keeps failing repair is throttled until the window resets,
+// while the segments of the other files proceed
+func TestRepairBudget(t *testing.T) {
+	maxFailures, window := 3, time.Minute
+	client := &StorageClient{
+		log: log.New(),
+		uploadHeap: uploadHeap{
+			pendingSegments: make(map[uploadSegmentID]*unfinishedUploadSegment),
+		},
+		repairBudget: newRepairBudget(maxFailures, window),
+	}
+	badFile, goodFile := dxfile.FileID{1}, dxfile.FileID{2}
+	badPath := storage.DxPath{Path: "bad"}
+
+	now := time.Now()
+	for i := 0; i < maxFailures; i++ {
+		if !client.repairBudget.allow(badFile, now) {
+			t.Fatalf("file throttled after %v failures", i)
+		}
+		exhausted := client.repairBudget.recordFailure(badFile, badPath, now)
+		if exhausted != (i == maxFailures-1) {
+			t.Errorf("failure %v: expect exhausted %v, got %v", i, i == maxFailures-1, exhausted)
+		}
+	}
+	if client.repairBudget.allow(badFile, now) {
+		t.Errorf("file exhausting the budget is not throttled")
+	}
+	if !client.repairBudget.allow(goodFile, now) {
+		t.Errorf("other file is throttled")
+	}
+	if files := client.repairBudget.exhaustedFiles(now); len(files) != 1 || !files[0].Equals(badPath) {
+		t.Errorf("file exhausting the budget not flagged: %v", files)
+	}
+
+	// the segments of the throttled file yield to the segments of the other file
+	for i := 0; i < 2; i++ {
+		client.uploadHeap.push(&unfinishedUploadSegment{id: uploadSegmentID{fid: badFile, index: uint64(i)}, stuck: true, sectorsAllNeedNum: 1})
+		client.uploadHeap.push(&unfinishedUploadSegment{id: uploadSegmentID{fid: goodFile, index: uint64(i)}, sectorsAllNeedNum: 1})
+	}
+	for i := 0; i < 2; i++ {
+		segment := client.popSegmentWithinBudget()
+		if segment == nil || segment.id.fid != goodFile {
+			t.Fatalf("pop %v: expect the segment of the other file, got %+v", i, segment)
+		}
+	}
+	if segment := client.popSegmentWithinBudget(); segment != nil {
+		t.Errorf("segment of the throttled file is popped: %+v", segment.id)
+	}
+
+	// the budget is restored after the window resets
+	later := now.Add(window)
+	if !client.repairBudget.allow(badFile, later) {
+		t.Errorf("file still throttled after the window resets")
+	}
+	if files := client.repairBudget.exhaustedFiles(later); len(files) != 0 {
+		t.Errorf("file still flagged after the window resets: %v", files)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// errSourceMismatch is the error returned if the content of the local source does not match the
+// checksum of the file, which means the local source is modified or replaced since the upload
+var errSourceMismatch = errors.New("local source does not match the checksum of the file")
+
+// verifiedSource is the local source verified against the checksum of the file. The source is
+// regarded as unchanged while its size and modification time are unchanged
+type verifiedSource struct {
+	size     int64
+	modTime  time.Time
+	checksum common.Hash
+}
+
+// checksumCall is the checksum calculation of a source in progress. The result is available
+// after done is closed
+type checksumCall struct {
+	done     chan struct{}
+	checksum common.Hash
+	err      error
+}
+
+// sourceVerifier verifies the local sources of the files against the checksums of the files
+// before they are read for the upload and repair. The sources verified are cached, so that the
+// whole source is hashed only once until it is modified. The segments of the same file verified
+// concurrently share a single checksum calculation
+type sourceVerifier struct {
+	verified map[dxfile.FileID]verifiedSource
+	inflight map[dxfile.FileID]*checksumCall
+	mu       sync.Mutex
+}
+
+// newSourceVerifier creates an empty sourceVerifier
+func newSourceVerifier() *sourceVerifier {
+	return &sourceVerifier{
+		verified: make(map[dxfile.FileID]verifiedSource),
+		inflight: make(map[dxfile.FileID]*checksumCall),
+	}
+}
+
+// verify verifies the local source of the file at path against the checksum. Return
+// errSourceMismatch if the content of the source does not match
+func (sv *sourceVerifier) verify(id dxfile.FileID, path string, checksum common.Hash) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	sv.mu.Lock()
+	source, exist := sv.verified[id]
+	if exist && source.checksum == checksum && source.size == info.Size() && source.modTime.Equal(info.ModTime()) {
+		sv.mu.Unlock()
+		return nil
+	}
+	// wait for the checksum calculation of the same file in progress
+	if call, exist := sv.inflight[id]; exist {
+		sv.mu.Unlock()
+		<-call.done
+		if call.err != nil {
+			return call.err
+		}
+		if call.checksum != checksum {
+			return errSourceMismatch
+		}
+		return nil
+	}
+	call := &checksumCall{done: make(chan struct{})}
+	sv.inflight[id] = call
+	sv.mu.Unlock()
+
+	call.checksum, call.err = fileChecksum(path)
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	delete(sv.inflight, id)
+	close(call.done)
+	if call.err != nil {
+		return call.err
+	}
+	if call.checksum != checksum {
+		delete(sv.verified, id)
+		return errSourceMismatch
+	}
+	sv.verified[id] = verifiedSource{
+		size:     info.Size(),
+		modTime:  info.ModTime(),
+		checksum: checksum,
+	}
+	return nil
+}
+
+// verifyLocalSource verifies the local source of the segment against the checksum of the file if
+// the source verification is enabled. The file without the checksum is not verified
+func (client *StorageClient) verifyLocalSource(segment *unfinishedUploadSegment) error {
+	client.lock.Lock()
+	enabled := client.persist.VerifyRepairSource
+	client.lock.Unlock()
+	if !enabled {
+		return nil
+	}
+	checksum := segment.fileEntry.Checksum()
+	if checksum == (common.Hash{}) {
+		return nil
+	}
+	return client.sourceVerifier.verify(segment.fileEntry.UID(), string(segment.fileEntry.LocalPath()), checksum)
+}
+
+// SetVerifyRepairSource set whether the local source of the file is verified against the
+// checksum of the file before it is read for the upload and repair. The source not matching
+// is not used, and the segment is downloaded from the hosts instead if possible
+func (client *StorageClient) SetVerifyRepairSource(verify bool) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.VerifyRepairSource = verify
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetSourceChecksum set the checksum of the whole content of the file, which is the reference
+// the local source is verified against. The checksum is calculated on upload, and is set for the
+// files uploaded without the checksum or with a trusted copy of the source
+func (client *StorageClient) SetSourceChecksum(dxPath storage.DxPath, checksum common.Hash) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return
+	}
+	defer entry.Close()
+	return entry.SetChecksum(checksum)
+}
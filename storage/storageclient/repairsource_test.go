@@ -0,0 +1,128 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// TestStorageClient_VerifyLocalSource test the repair rejects the local source modified since
+// the upload if the source verification is enabled
+func TestStorageClient_VerifyLocalSource(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+	client.persist.VerifyRepairSource = true
+
+	entry := newFileEntry(t, client)
+	localPath := string(entry.LocalPath())
+	defer func() {
+		os.Remove(localPath)
+		os.Remove(string(entry.FilePath()))
+		entry.Close()
+	}()
+	checksum, err := fileChecksum(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entry.SetChecksum(checksum); err != nil {
+		t.Fatal(err)
+	}
+
+	mockAddWorkers(3, client)
+	hosts := make(map[string]struct{})
+	for _, w := range client.workerPool {
+		hosts[w.hostID.String()] = struct{}{}
+	}
+	segments, err := client.createUnfinishedSegments(entry, hosts, targetUnstuckSegments, make(storage.HostHealthInfoTable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) == 0 {
+		t.Fatal("no segments created")
+	}
+	// The segment is repaired from the local source only
+	segment := segments[0]
+	segment.sectorsCompletedNum = segment.sectorsAllNeedNum
+
+	if err = client.retrieveLogicalSegmentData(segment); err != nil {
+		t.Fatalf("the source not modified is rejected: %v", err)
+	}
+
+	// Tamper the local source
+	f, err := os.OpenFile(localPath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt([]byte("tampered"), 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	modTime := time.Now().Add(time.Minute)
+	if err = os.Chtimes(localPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	segment.logicalSegmentData = nil
+	err = client.retrieveLogicalSegmentData(segment)
+	if err == nil || !strings.Contains(err.Error(), errSourceMismatch.Error()) {
+		t.Fatalf("expect error %v, got %v", errSourceMismatch, err)
+	}
+	if segment.logicalSegmentData != nil {
+		t.Error("data of the tampered source is used")
+	}
+
+	// The source is not verified with the verification disabled
+	client.persist.VerifyRepairSource = false
+	if err = client.retrieveLogicalSegmentData(segment); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSourceVerifier_ConcurrentVerify test the source verified concurrently for the same file
+// is verified with a shared checksum calculation
+func TestSourceVerifier_ConcurrentVerify(t *testing.T) {
+	localPath, _, _ := generateFile(t, homeDir(), 4)
+	defer os.Remove(localPath)
+	checksum, err := fileChecksum(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := newSourceVerifier()
+	var id dxfile.FileID
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- sv.verify(id, localPath, checksum)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sv.inflight) != 0 {
+		t.Errorf("checksum calculation in progress after all verified: %v", len(sv.inflight))
+	}
+	if _, exist := sv.verified[id]; !exist {
+		t.Errorf("the verified source is not cached")
+	}
+	if err = sv.verify(id, localPath, common.Hash{}); err != errSourceMismatch {
+		t.Errorf("expect error %v, got %v", errSourceMismatch, err)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// sectorCleanupMetadata is the metadata of the sector cleanup persist file
+var sectorCleanupMetadata = common.Metadata{
+	Header:  "storage client sector cleanup",
+	Version: PersistStorageClientVersion,
+}
+
+// sectorCleanupQueue is the queue of the sectors of the deleted files to be deleted from the
+// hosts, mapping from the host to the merkle roots of the sectors. The queue is persisted, so
+// that the sectors on the hosts offline are deleted after the hosts come back, even after
+// the client restarts
+type sectorCleanupQueue struct {
+	hosts map[enode.ID][]common.Hash
+	mu    sync.Mutex
+}
+
+// newSectorCleanupQueue creates an empty sectorCleanupQueue
+func newSectorCleanupQueue() *sectorCleanupQueue {
+	return &sectorCleanupQueue{
+		hosts: make(map[enode.ID][]common.Hash),
+	}
+}
+
+// enqueue adds the sectors to be deleted from the hosts
+func (q *sectorCleanupQueue) enqueue(sectors map[enode.ID][]common.Hash) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for host, roots := range sectors {
+		q.hosts[host] = append(q.hosts[host], roots...)
+	}
+}
+
+// pending returns a copy of the sectors to be deleted from the hosts
+func (q *sectorCleanupQueue) pending() map[enode.ID][]common.Hash {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sectors := make(map[enode.ID][]common.Hash, len(q.hosts))
+	for host, roots := range q.hosts {
+		sectors[host] = append([]common.Hash(nil), roots...)
+	}
+	return sectors
+}
+
+// remove removes one entry of each of the roots queued for the host
+func (q *sectorCleanupQueue) remove(host enode.ID, roots []common.Hash) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := q.hosts[host]
+	for _, root := range roots {
+		for i := range queued {
+			if queued[i] == root {
+				queued = append(queued[:i], queued[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(queued) == 0 {
+		delete(q.hosts, host)
+		return
+	}
+	q.hosts[host] = queued
+}
+
+// len returns the number of sectors queued
+func (q *sectorCleanupQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var n int
+	for _, roots := range q.hosts {
+		n += len(roots)
+	}
+	return n
+}
+
+// save saves the sector cleanup queue to the file
+func (q *sectorCleanupQueue) save(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return common.SaveDxJSON(sectorCleanupMetadata, path, q.hosts)
+}
+
+// load loads the sector cleanup queue from the file. A missing file is regarded as an empty queue
+func (q *sectorCleanupQueue) load(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	hosts := make(map[enode.ID][]common.Hash)
+	err := common.LoadDxJSON(sectorCleanupMetadata, path, &hosts)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	q.hosts = hosts
+	return nil
+}
+
+// sectorCleanupPath returns the path of the sector cleanup persist file
+func (client *StorageClient) sectorCleanupPath() string {
+	return filepath.Join(client.persistDir, SectorCleanupFilename)
+}
+
+// enqueueSectorCleanup queues the sectors of the deleted file to be deleted from the hosts. The
+// cleanup is best-effort, so the failure to persist the queue is only logged
+func (client *StorageClient) enqueueSectorCleanup(sectors map[enode.ID][]common.Hash) {
+	client.sectorCleanup.enqueue(sectors)
+	if err := client.sectorCleanup.save(client.sectorCleanupPath()); err != nil {
+		client.log.Warn("failed to save the sector cleanup queue", "err", err)
+	}
+}
+
+// cleanupSectors deletes the queued sectors from the hosts. The sectors on the host not
+// reachable are kept in the queue and retried later. The sectors which could never be deleted,
+// because the contract with the host is gone, the host does not support deleting the sectors,
+// or the host rejects the delete, are dropped from the queue
+func (client *StorageClient) cleanupSectors() error {
+	for host, roots := range client.sectorCleanup.pending() {
+		select {
+		case <-client.tm.StopChan():
+			return nil
+		default:
+		}
+		deleted, err := client.cleanupHostSectors(host, roots)
+		if err != nil {
+			client.log.Debug("failed to delete the sectors from the host, retry later", "host", host, "err", err)
+		}
+		client.sectorCleanup.remove(host, deleted)
+	}
+	return client.sectorCleanup.save(client.sectorCleanupPath())
+}
+
+// cleanupHostSectors deletes the sectors from the host in batches. Return the roots to be
+// removed from the queue, which are the ones deleted and the ones could never be deleted
+func (client *StorageClient) cleanupHostSectors(host enode.ID, roots []common.Hash) ([]common.Hash, error) {
+	hostInfo, exist := client.storageHostManager.RetrieveHostInfo(host)
+	if !exist || !hostInfo.Capabilities.SupportFeature(storage.FeatureDeleteSector) {
+		return roots, nil
+	}
+	roots, deleted := client.recordedSectorRoots(host, roots)
+	if len(roots) == 0 {
+		return deleted, nil
+	}
+	sp, err := client.SetupConnection(hostInfo.EnodeURL)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to set up connection with host %v: %s", host, err.Error())
+	}
+
+	for start := 0; start < len(roots); start += sectorCleanupBatchSize {
+		end := start + sectorCleanupBatchSize
+		if end > len(roots) {
+			end = len(roots)
+		}
+		err = client.DeleteSectors(sp, roots[start:end], &hostInfo)
+		if negotiationErr, ok := err.(*storage.NegotiationError); ok && negotiationErr.Code == storage.NegotiationErrRejected {
+			// the host will never accept the delete, drop the sectors
+			deleted = append(deleted, roots[start:end]...)
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, roots[start:end]...)
+	}
+	return deleted, nil
+}
+
+// recordedSectorRoots splits the roots into the ones recorded in the contract with the host and
+// the ones not, with each root regarded as recorded at most as many times as it is recorded.
+// The sectors not recorded cannot be deleted, either because the contract is renewed or
+// expired, or because the roots of the contract are not fully recorded
+func (client *StorageClient) recordedSectorRoots(host enode.ID, roots []common.Hash) (recorded, unrecorded []common.Hash) {
+	scs := client.contractManager.GetStorageContractSet()
+	contract, exist := scs.Acquire(scs.GetContractIDByHostID(host))
+	if !exist {
+		return nil, roots
+	}
+	defer scs.Return(contract)
+
+	contractRoots, err := contract.MerkleRoots()
+	numSectors := contract.Header().LatestContractRevision.NewFileSize / storage.SectorSize
+	if err != nil || uint64(len(contractRoots)) != numSectors {
+		return nil, roots
+	}
+	counts := make(map[common.Hash]int, len(contractRoots))
+	for _, root := range contractRoots {
+		counts[root]++
+	}
+	for _, root := range roots {
+		if counts[root] > 0 {
+			counts[root]--
+			recorded = append(recorded, root)
+		} else {
+			unrecorded = append(unrecorded, root)
+		}
+	}
+	return
+}
+
+// sectorCleanupLoop deletes the queued sectors from the hosts at sectorCleanupInterval
+func (client *StorageClient) sectorCleanupLoop() {
+	if err := client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	for {
+		select {
+		case <-client.tm.StopChan():
+			return
+		case <-time.After(sectorCleanupInterval):
+		}
+		if client.sectorCleanup.len() == 0 {
+			continue
+		}
+		if err := client.cleanupSectors(); err != nil {
+			client.log.Warn("failed to clean up the sectors of the deleted files", "err", err)
+		}
+	}
+}
+
+// DeleteSectors deletes the sectors stored for the contract with the host, so that the storage
+// of the host is reclaimed before the contract expires
+func (client *StorageClient) DeleteSectors(sp storage.Peer, roots []common.Hash, hostInfo *storage.HostInfo) error {
+	actions := make([]storage.UploadAction, 0, len(roots))
+	for _, root := range roots {
+		actions = append(actions, storage.UploadAction{Type: storage.UploadActionDelete, Data: root.Bytes()})
+	}
+	return client.Write(sp, actions, hostInfo)
+}
+
+// SetReclaimDeletedSectors set whether the sectors of the deleted files are deleted from the
+// hosts, so that the storage is reclaimed before the contracts expire. The deletion is
+// best-effort and does not block deleting the files
+func (client *StorageClient) SetReclaimDeletedSectors(reclaim bool) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.ReclaimDeletedSectors = reclaim
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
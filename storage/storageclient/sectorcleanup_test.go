@@ -0,0 +1,117 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+)
+
+// TestSectorCleanupQueue test the sectors queued are removed one entry per root, and the queue
+// is persisted
+func TestSectorCleanupQueue(t *testing.T) {
+	q := newSectorCleanupQueue()
+	q.enqueue(map[enode.ID][]common.Hash{
+		{1}: {{1}, {2}, {2}},
+		{2}: {{3}},
+	})
+	q.enqueue(map[enode.ID][]common.Hash{
+		{2}: {{4}},
+	})
+	if q.len() != 5 {
+		t.Fatalf("expect 5 sectors queued, got %v", q.len())
+	}
+
+	q.remove(enode.ID{1}, []common.Hash{{2}, {5}})
+	q.remove(enode.ID{2}, []common.Hash{{3}, {4}})
+	expect := map[enode.ID][]common.Hash{
+		{1}: {{1}, {2}},
+	}
+	if pending := q.pending(); !reflect.DeepEqual(pending, expect) {
+		t.Fatalf("sectors pending not expected.\n\texpect %v\n\tgot %v", expect, pending)
+	}
+
+	path := filepath.Join(homeDir(), t.Name()+".json")
+	defer os.Remove(path)
+	if err := q.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newSectorCleanupQueue()
+	if err := loaded.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if pending := loaded.pending(); !reflect.DeepEqual(pending, expect) {
+		t.Fatalf("sectors loaded not expected.\n\texpect %v\n\tgot %v", expect, pending)
+	}
+
+	// a missing file is loaded as an empty queue
+	if err := newSectorCleanupQueue().load(path + ".missing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestStorageClient_DeleteFileReclaim test the sectors of the deleted file are queued for the
+// cleanup only if the reclamation is enabled, and the file is deleted regardless of the cleanup
+func TestStorageClient_DeleteFileReclaim(t *testing.T) {
+	sct := newStorageClientTester(t)
+	client := sct.Client
+	defer os.Remove(client.sectorCleanupPath())
+
+	for _, reclaim := range []bool{false, true} {
+		client.persist.ReclaimDeletedSectors = reclaim
+		client.sectorCleanup = newSectorCleanupQueue()
+
+		entry := newFileEntry(t, client)
+		defer os.Remove(string(entry.LocalPath()))
+		sectors := map[enode.ID][]common.Hash{
+			{1}: {{1}, {2}},
+			{2}: {{3}},
+		}
+		for host, roots := range sectors {
+			for i, root := range roots {
+				if err := entry.AddSector(host, root, 0, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		dxPath := entry.DxPath()
+		entry.Close()
+		now := time.Now()
+		client.healthHistory.record(dxPath.Path, HealthSample{Time: now, Health: 100}, now)
+
+		if err := client.DeleteFile(dxPath); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.fileSystem.OpenDxFile(dxPath); err == nil {
+			t.Fatalf("reclaim %v: file is not deleted", reclaim)
+		}
+		if samples := client.healthHistory.series(dxPath.Path, now, now); len(samples) != 0 {
+			t.Fatalf("reclaim %v: health history of the deleted file is not pruned", reclaim)
+		}
+		if !reclaim {
+			if q := client.sectorCleanup.len(); q != 0 {
+				t.Fatalf("expect no sector queued with the reclamation disabled, got %v", q)
+			}
+			continue
+		}
+		if pending := client.sectorCleanup.pending(); !reflect.DeepEqual(pending, sectors) {
+			t.Fatalf("sectors queued not expected.\n\texpect %v\n\tgot %v", sectors, pending)
+		}
+
+		// the sectors on the hosts unknown could never be deleted, and are dropped
+		if err := client.cleanupSectors(); err != nil {
+			t.Fatal(err)
+		}
+		if q := client.sectorCleanup.len(); q != 0 {
+			t.Fatalf("expect the sectors on the unknown hosts dropped, got %v", q)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package storageclient
 
 import (
 	"bytes"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -30,7 +32,9 @@ import (
 	"github.com/DxChainNetwork/godx/rlp"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/DxChainNetwork/godx/storage/storageclient/contractmanager"
+	"github.com/DxChainNetwork/godx/storage/storageclient/contractset"
 	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
 	"github.com/DxChainNetwork/godx/storage/storageclient/memorymanager"
 	"github.com/DxChainNetwork/godx/storage/storageclient/storagehostmanager"
 )
@@ -47,16 +51,41 @@ type StorageClient struct {
 	contractManager    *contractmanager.ContractManager
 
 	// Download management
-	downloadHeapMu sync.Mutex
-	downloadHeap   *downloadSegmentHeap
-	newDownloads   chan struct{}
+	downloadHeapMu  sync.Mutex
+	downloadHeap    *downloadSegmentHeap
+	newDownloads    chan struct{}
+	downloadLimiter *downloadLimiter
+	uploadLimiter   *uploadLimiter
 
 	// Upload management
-	uploadHeap uploadHeap
+	uploadHeap       uploadHeap
+	segmentReadAhead *segmentReadAhead
+	uploadBreaker    *uploadBreaker
+	repairBudget     *repairBudget
+	encodePool       *encodePool
+	relocations      *fileRelocations
+	dirUpdates       *dirMetadataBatcher
+	sourceVerifier   *sourceVerifier
+
+	// Alerts of the file redundancy
+	redundancyAlerts *redundancyAlerts
+
+	// Health history of the files
+	healthHistory *healthHistory
+
+	// Sectors of the deleted files to be deleted from the hosts
+	sectorCleanup *sectorCleanupQueue
+
+	// lastRebalance is the time the last rebalance for cost was run
+	lastRebalance time.Time
 
 	// List of workers that can be used for uploading and/or downloading.
 	workerPool map[storage.ContractID]*worker
 
+	// uploadAssignCursor rotates the workers equal in load and health, so that they take turns
+	// to be assigned the sectors first
+	uploadAssignCursor int
+
 	// Directories and File related
 	persist        persistence
 	persistDir     string
@@ -87,7 +116,8 @@ func New(persistDir string) (*StorageClient, error) {
 		newDownloads:   make(chan struct{}, 1),
 		downloadHeap:   new(downloadSegmentHeap),
 		uploadHeap: uploadHeap{
-			pendingSegments:     make(map[uploadSegmentID]struct{}),
+			pendingSegments:     make(map[uploadSegmentID]*unfinishedUploadSegment),
+			cancelled:           make(map[dxfile.FileID]struct{}),
 			segmentComing:       make(chan struct{}, 1),
 			stuckSegmentSuccess: make(chan storage.DxPath, 1),
 		},
@@ -95,6 +125,18 @@ func New(persistDir string) (*StorageClient, error) {
 	}
 
 	sc.memoryManager = memorymanager.New(DefaultMaxMemory, sc.tm.StopChan())
+	sc.downloadLimiter = newDownloadLimiter(DefaultMaxInFlightDownloads, sc.newDownloads)
+	sc.uploadLimiter = newUploadLimiter(DefaultMaxUploadSpeed)
+	sc.segmentReadAhead = newSegmentReadAhead(DefaultReadAheadSegments, sc.memoryManager)
+	sc.encodePool = newEncodePool(runtime.NumCPU())
+	sc.uploadBreaker = newUploadBreaker()
+	sc.repairBudget = newRepairBudget(repairBudgetMaxFailures, repairBudgetWindow)
+	sc.relocations = newFileRelocations()
+	sc.dirUpdates = newDirMetadataBatcher()
+	sc.sourceVerifier = newSourceVerifier()
+	sc.redundancyAlerts = newRedundancyAlerts()
+	sc.healthHistory = newHealthHistory()
+	sc.sectorCleanup = newSectorCleanupQueue()
 
 	// initialize storageHostManager
 	sc.storageHostManager = storagehostmanager.New(sc.persistDir)
@@ -107,6 +149,10 @@ func New(persistDir string) (*StorageClient, error) {
 
 	// initialize fileSystem
 	sc.fileSystem = filesystem.New(persistDir, sc.contractManager)
+	sc.fileSystem.SetHealthCheckHook(sc.checkRedundancyAlert)
+
+	// contracts of the hosts storing only the files not required to renew are allowed to lapse
+	sc.contractManager.SetRenewalFilter(sc.fileSystem)
 
 	return sc, nil
 }
@@ -150,6 +196,9 @@ func (client *StorageClient) Start(b storage.EthBackend, apiBackend ethapi.Backe
 	go client.stuckLoop()
 	go client.uploadOrRepair()
 	go client.healthCheckLoop()
+	go client.healthSampleLoop()
+	go client.sectorCleanupLoop()
+	go client.storageProbeLoop()
 
 	// kill workers on shutdown.
 	client.tm.OnStop(func() error {
@@ -191,13 +240,37 @@ func (client *StorageClient) Close() error {
 }
 
 // DeleteFile will delete from the file system file set. The file
-// wil also be deleted from the disk
+// wil also be deleted from the disk. If reclaiming the deleted sectors is
+// enabled, the sectors of the file are queued to be deleted from the hosts
 func (client *StorageClient) DeleteFile(path storage.DxPath) error {
 	if err := client.tm.Add(); err != nil {
 		return err
 	}
 	defer client.tm.Done()
-	return client.fileSystem.DeleteDxFile(path)
+
+	// collect the sectors to be deleted from the hosts before the file is deleted. The local
+	// file is deleted regardless of whether the sectors are deleted from the hosts
+	client.lock.Lock()
+	reclaim := client.persist.ReclaimDeletedSectors
+	client.lock.Unlock()
+	var sectors map[enode.ID][]common.Hash
+	if reclaim {
+		if entry, err := client.fileSystem.OpenDxFile(path); err != nil {
+			client.log.Warn("failed to collect the sectors of the deleted file", "path", path.Path, "err", err)
+		} else {
+			sectors = entry.HostSectorRoots()
+			entry.Close()
+		}
+	}
+
+	if err := client.fileSystem.DeleteDxFile(path); err != nil {
+		return err
+	}
+	client.healthHistory.remove(path.Path)
+	if len(sectors) != 0 {
+		client.enqueueSectorCleanup(sectors)
+	}
+	return nil
 }
 
 // ContractDetail will return the detailed contract information
@@ -205,6 +278,17 @@ func (client *StorageClient) ContractDetail(contractID storage.ContractID) (deta
 	return client.contractManager.RetrieveActiveContract(contractID)
 }
 
+// ContractRevisionHistory will return the latest revisions recorded of the contract, the oldest first
+func (client *StorageClient) ContractRevisionHistory(contractID storage.ContractID) (history []contractset.RevisionRecord, exists bool) {
+	return client.contractManager.GetStorageContractSet().ContractRevisionHistory(contractID)
+}
+
+// EstimateContractFees will estimate the gas fee and the contract fee of forming n contracts
+// at the current gas price
+func (client *StorageClient) EstimateContractFees(n uint64) (contractmanager.ContractFeeEstimate, error) {
+	return client.contractManager.EstimateContractFees(n)
+}
+
 // ActiveContracts will retrieve all active contracts, reformat them, and return them back
 func (client *StorageClient) ActiveContracts() (activeContracts []ActiveContractsAPIDisplay) {
 	allActiveContracts := client.contractManager.RetrieveActiveContracts()
@@ -241,6 +325,9 @@ func (client *StorageClient) SetClientSetting(setting storage.ClientSetting) (er
 			setting.MaxUploadSpeed, setting.MaxDownloadSpeed)
 		return
 	}
+	if err = checkRepairDownloadThreshold(setting.RepairDownloadThreshold); err != nil {
+		return
+	}
 
 	// set the rent payment
 	if err = client.contractManager.SetRentPayment(setting.RentPayment, client.storageHostManager); err != nil {
@@ -259,6 +346,7 @@ func (client *StorageClient) SetClientSetting(setting storage.ClientSetting) (er
 	client.lock.Lock()
 	client.persist.MaxDownloadSpeed = setting.MaxDownloadSpeed
 	client.persist.MaxUploadSpeed = setting.MaxUploadSpeed
+	client.persist.RepairDownloadThreshold = setting.RepairDownloadThreshold
 	if err = client.saveSettings(); err != nil {
 		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
 		client.lock.Unlock()
@@ -276,14 +364,405 @@ func (client *StorageClient) SetClientSetting(setting storage.ClientSetting) (er
 func (client *StorageClient) RetrieveClientSetting() (setting storage.ClientSetting) {
 	maxDownloadSpeed, maxUploadSpeed, _ := client.contractManager.RetrieveRateLimit()
 	setting = storage.ClientSetting{
-		RentPayment:       client.contractManager.AcquireRentPayment(),
-		EnableIPViolation: client.storageHostManager.RetrieveIPViolationCheckSetting(),
-		MaxUploadSpeed:    maxUploadSpeed,
-		MaxDownloadSpeed:  maxDownloadSpeed,
+		RentPayment:             client.contractManager.AcquireRentPayment(),
+		EnableIPViolation:       client.storageHostManager.RetrieveIPViolationCheckSetting(),
+		MaxUploadSpeed:          maxUploadSpeed,
+		MaxDownloadSpeed:        maxDownloadSpeed,
+		RepairDownloadThreshold: client.repairDownloadThreshold(),
+	}
+	return
+}
+
+// repairDownloadThreshold returns the fraction of the redundant sectors a segment shall lose
+// before it is downloaded from the hosts for repair
+func (client *StorageClient) repairDownloadThreshold() float64 {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.persist.RepairDownloadThreshold
+}
+
+// SetMaxInFlightDownloads set the maximum number of segment downloads in flight. The
+// segments exceeding the limit are queued in the download heap. 0 means unlimited
+func (client *StorageClient) SetMaxInFlightDownloads(limit uint64) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	client.downloadLimiter.setLimit(limit)
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.MaxInFlightDownloads = limit
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetReadAheadSegments set the number of segments read ahead from the local file in one pass
+// during upload. 0 disables the read ahead
+func (client *StorageClient) SetReadAheadSegments(numSegments uint64) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	client.segmentReadAhead.setNumSegments(numSegments)
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.ReadAheadSegments = numSegments
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetMinSegmentHosts set the minimum number of distinct hosts storing the sectors of a healthy
+// segment for the files uploaded afterwards. 0 means no requirement
+func (client *StorageClient) SetMinSegmentHosts(minHosts uint32) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.MinSegmentHosts = minHosts
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetUploadPolicy set the upload policy deciding the order of hosts the sectors are assigned
+// to. UploadPolicySpeed uploads to all hosts at once, and UploadPolicyCost prefers the cheaper hosts
+func (client *StorageClient) SetUploadPolicy(policy string) (err error) {
+	if err = checkUploadPolicy(policy); err != nil {
+		return
+	}
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.UploadPolicy = policy
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetUploadConfirmPolicy set the policy confirming a sector is stored by the host after upload.
+// UploadConfirmTrust trusts the host signature, and UploadConfirmVerify reads the sector back
+func (client *StorageClient) SetUploadConfirmPolicy(policy string) (err error) {
+	if err = checkUploadConfirmPolicy(policy); err != nil {
+		return
+	}
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.UploadConfirmPolicy = policy
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetUploadCompletionPolicy set the policy deciding whether a partially uploaded segment is accepted.
+// UploadCompletionStrict keeps the segment in repair until all sectors are uploaded
+func (client *StorageClient) SetUploadCompletionPolicy(policy string) (err error) {
+	if err = checkUploadCompletionPolicy(policy); err != nil {
+		return
+	}
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.UploadCompletionPolicy = policy
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetUploadSchedulingPolicy set the policy of the order the segments of different files are
+// dispatched. UploadSchedulingFair interleaves the segments so that no file monopolizes the workers
+func (client *StorageClient) SetUploadSchedulingPolicy(policy string) (err error) {
+	if err = checkUploadSchedulingPolicy(policy); err != nil {
+		return
+	}
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.UploadSchedulingPolicy = policy
+	client.uploadHeap.setSchedulingPolicy(policy)
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetHealthSampleInterval set the interval the health of the files is sampled at. 0 disables
+// the sampling
+func (client *StorageClient) SetHealthSampleInterval(interval time.Duration) (err error) {
+	if interval < 0 {
+		return fmt.Errorf("negative health sample interval %v", interval)
+	}
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.HealthSampleInterval = interval
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetDirUpdateBatchInterval set the interval the directory metadata updates of the segment
+// completions are batched in. 0 updates the metadata on each completion
+func (client *StorageClient) SetDirUpdateBatchInterval(interval time.Duration) (err error) {
+	if interval < 0 {
+		return fmt.Errorf("negative dir update batch interval %v", interval)
+	}
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.DirUpdateBatchInterval = interval
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetRevisionHistoryLimit set the number of latest revisions recorded for each contract.
+// 0 disables the revision history
+func (client *StorageClient) SetRevisionHistoryLimit(limit uint64) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	client.contractManager.GetStorageContractSet().SetRevisionHistoryLimit(limit)
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.RevisionHistoryLimit = limit
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetMaxConcurrentNegotiations set the maximum number of contract formations and renewals
+// in progress at the same time. 0 means unlimited
+func (client *StorageClient) SetMaxConcurrentNegotiations(limit uint64) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	client.contractManager.SetMaxConcurrentNegotiations(limit)
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.MaxConcurrentNegotiations = limit
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
 	}
 	return
 }
 
+// SetContractRenewPolicy set the policy deciding whether the contract about to expire is renewed,
+// which carries the data stored over, or replaced with a fresh formation, which needs the data
+// uploaded again
+func (client *StorageClient) SetContractRenewPolicy(policy string) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	if err = client.contractManager.SetContractRenewPolicy(policy); err != nil {
+		return
+	}
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.ContractRenewPolicy = policy
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetDeriveSectorKeys set whether the sectors of the files uploaded afterwards are encrypted
+// with the subkeys derived for each sector instead of the file cipher key
+func (client *StorageClient) SetDeriveSectorKeys(derive bool) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.DeriveSectorKeys = derive
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// SetDedupSectors set whether the sector already stored for the contract with the host is
+// appended as a virtual sector, instead of uploading the same data again
+func (client *StorageClient) SetDedupSectors(dedup bool) (err error) {
+	if err = client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	// update and save the persist
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.persist.DedupSectors = dedup
+	if err = client.saveSettings(); err != nil {
+		err = fmt.Errorf("failed to save the storage client settings: %s", err.Error())
+	}
+	return
+}
+
+// ProbeHostStorage verifies the remaining storage advertised by the host by uploading a random
+// test sector through the contract signed with the host. The random data makes sure the host
+// cannot accept the sector without storing it. The result is recorded in the storage host
+// manager, which penalizes the host rejecting the sector while advertising enough storage.
+// The test sector is deleted from the host after the probe, so only the host supporting the
+// sector deletion is probed.
+func (client *StorageClient) ProbeHostStorage(hostID enode.ID) error {
+	if err := client.tm.Add(); err != nil {
+		return err
+	}
+	defer client.tm.Done()
+
+	hostInfo, exist := client.storageHostManager.RetrieveHostInfo(hostID)
+	if !exist {
+		return fmt.Errorf("host %v does not exist", hostID)
+	}
+	if !hostInfo.Capabilities.SupportFeature(storage.FeatureDeleteSector) {
+		return fmt.Errorf("host %v cannot delete the probe sector", hostID)
+	}
+	sp, err := client.SetupConnection(hostInfo.EnodeURL)
+	if err != nil {
+		return fmt.Errorf("failed to set up connection with host %v: %s", hostID, err.Error())
+	}
+
+	// only the host rejecting the sector counts for the probe result. Other errors such as
+	// the host being busy, the invalid request or the insufficient funds of the client are
+	// returned directly
+	data := make([]byte, storage.SectorSize)
+	if _, err := rand.Read(data); err != nil {
+		return fmt.Errorf("failed to generate the probe sector: %s", err.Error())
+	}
+	root, err := client.Append(sp, data, &hostInfo)
+	if err == nil {
+		client.deleteProbeSector(sp, root, &hostInfo)
+	}
+	if negotiationErr, ok := err.(*storage.NegotiationError); err != nil && (!ok || negotiationErr.Code != storage.NegotiationErrRejected) {
+		return fmt.Errorf("failed to probe host %v: %s", hostID, err.Error())
+	}
+	accepted := err == nil
+	if errRecord := client.storageHostManager.RecordStorageProbe(hostID, accepted); errRecord != nil {
+		return errRecord
+	}
+	if !accepted {
+		return fmt.Errorf("host %v rejected the probe sector", hostID)
+	}
+	return nil
+}
+
+// deleteProbeSector deletes the probe sector from the host, so that the contract does not keep
+// paying for it. If the sector cannot be deleted now, it is queued for the sector cleanup
+func (client *StorageClient) deleteProbeSector(sp storage.Peer, root common.Hash, hostInfo *storage.HostInfo) {
+	if err := client.DeleteSectors(sp, []common.Hash{root}, hostInfo); err != nil {
+		client.log.Debug("failed to delete the probe sector, queued for the cleanup", "host", hostInfo.EnodeID, "err", err)
+		client.enqueueSectorCleanup(map[enode.ID][]common.Hash{hostInfo.EnodeID: {root}})
+	}
+}
+
+// storageProbeLoop periodically probes the remaining storage of the hosts with active contracts,
+// so that the hosts over-reporting the remaining storage are penalized without the manual probe
+func (client *StorageClient) storageProbeLoop() {
+	if err := client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	for {
+		select {
+		case <-client.tm.StopChan():
+			return
+		case <-time.After(storageProbeInterval):
+		}
+		client.probeHostsStorage()
+	}
+}
+
+// probeHostsStorage probes the hosts with active contracts able to upload. The hosts not
+// supporting the sector deletion, and the hosts honestly advertising not enough storage for
+// a sector, are skipped
+func (client *StorageClient) probeHostsStorage() {
+	for _, contract := range client.contractManager.RetrieveActiveContracts() {
+		select {
+		case <-client.tm.StopChan():
+			return
+		default:
+		}
+		if !contract.Status.UploadAbility {
+			continue
+		}
+		hostInfo, exist := client.storageHostManager.RetrieveHostInfo(contract.EnodeID)
+		if !exist || !hostInfo.Capabilities.SupportFeature(storage.FeatureDeleteSector) || hostInfo.RemainingStorage < storage.SectorSize {
+			continue
+		}
+		if err := client.ProbeHostStorage(contract.EnodeID); err != nil {
+			client.log.Debug("failed to probe the host storage", "host", contract.EnodeID, "err", err)
+		}
+	}
+}
+
 // setBandwidthLimits specifies the data upload and downloading speed limit
 func (client *StorageClient) setBandwidthLimits(downloadSpeedLimit, uploadSpeedLimit int64) (err error) {
 	// validation
@@ -297,14 +776,47 @@ func (client *StorageClient) setBandwidthLimits(downloadSpeedLimit, uploadSpeedL
 	} else {
 		client.contractManager.SetRateLimits(downloadSpeedLimit, uploadSpeedLimit, DefaultPacketSize)
 	}
+	client.uploadLimiter.setRate(uploadSpeedLimit)
 
 	return nil
 }
 
-// Append will send the given data to host and return the merkle root of data
+// Append will send the given data to host and return the merkle root of data. If the sector
+// deduplication is enabled and the sector is already stored for the contract, the sector is
+// appended as a virtual sector without sending the data. The data is sent if the host rejects
+// the virtual sector
 func (client *StorageClient) Append(sp storage.Peer, data []byte, hostInfo *storage.HostInfo) (common.Hash, error) {
+	root := merkle.Sha256MerkleTreeRoot(data)
+	if client.canAppendVirtual(root, hostInfo) {
+		err := client.Write(sp, []storage.UploadAction{{Type: storage.UploadActionAppendVirtual, Data: root.Bytes()}}, hostInfo)
+		if err == nil {
+			return root, nil
+		}
+		client.log.Debug("failed to append the virtual sector, upload the sector data", "host", hostInfo.EnodeID, "root", root, "err", err)
+	}
 	err := client.Write(sp, []storage.UploadAction{{Type: storage.UploadActionAppend, Data: data}}, hostInfo)
-	return merkle.Sha256MerkleTreeRoot(data), err
+	return root, err
+}
+
+// canAppendVirtual returns whether the sector could be appended as a virtual sector, which
+// requires the sector deduplication enabled, the host supporting the virtual sectors, and the
+// sector already stored for the contract with the host. The encrypted sectors are never
+// deduplicated since they are sealed with the random nonces
+func (client *StorageClient) canAppendVirtual(root common.Hash, hostInfo *storage.HostInfo) bool {
+	client.lock.Lock()
+	dedup := client.persist.DedupSectors
+	client.lock.Unlock()
+	if !dedup || !hostInfo.Capabilities.SupportFeature(storage.FeatureVirtualSector) {
+		return false
+	}
+
+	scs := client.contractManager.GetStorageContractSet()
+	contract, exist := scs.Acquire(scs.GetContractIDByHostID(hostInfo.EnodeID))
+	if !exist {
+		return false
+	}
+	defer scs.Return(contract)
+	return contract.HasMerkleRoot(root)
 }
 
 func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadAction, hostInfo *storage.HostInfo) (err error) {
@@ -338,6 +850,14 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 		case storage.UploadActionAppend:
 			bandwidthPrice = bandwidthPrice.Add(sectorBandwidthPrice)
 			newFileSize += storage.SectorSize
+		case storage.UploadActionAppendVirtual:
+			// the virtual sector is not transferred
+			newFileSize += storage.SectorSize
+		case storage.UploadActionDelete:
+			if newFileSize < storage.SectorSize {
+				return errors.New("cannot delete more sectors than stored in the contract")
+			}
+			newFileSize -= storage.SectorSize
 		}
 	}
 	if newFileSize > contractRevision.NewFileSize {
@@ -346,6 +866,16 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 		deposit = sectorDeposit.MultUint64(addedSectors)
 	}
 
+	// the sectors moved by the deletes are not covered by the diff proof, so the new file merkle
+	// root is verified against the one reconstructed from the merkle roots recorded
+	deletedRoots := deletedSectorRoots(actions)
+	var deletedMerkleRoot common.Hash
+	if len(deletedRoots) != 0 {
+		if deletedMerkleRoot, err = contract.DeletedMerkleRootPreview(deletedRoots...); err != nil {
+			return fmt.Errorf("failed to preview the file merkle root after delete: %v", err)
+		}
+	}
+
 	// estimate cost of Merkle proof
 	proofSize := storage.HashSize * (128 + len(actions))
 	bandwidthPrice = bandwidthPrice.Add(hostInfo.DownloadBandwidthPrice.MultUint64(uint64(proofSize)))
@@ -378,11 +908,20 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 	for i, o := range rev.NewMissedProofOutputs {
 		req.NewMissedProofValues[i] = o.Value
 	}
+	// the sector roots are only sent to the host verifying them, since the legacy host cannot
+	// decode the request with the sector roots
+	if hostInfo.Capabilities.SupportFeature(storage.FeatureSectorRoots) {
+		for _, action := range actions {
+			if action.Type == storage.UploadActionAppend {
+				req.SectorRoots = append(req.SectorRoots, merkle.Sha256MerkleTreeRoot(action.Data))
+			}
+		}
+	}
 
 	var clientNegotiateErr, hostNegotiateErr, hostCommitErr error
 	defer func() {
 		if clientNegotiateErr != nil {
-			_ = sp.SendClientNegotiateErrorMsg()
+			_ = sp.SendClientNegotiateErrorMsg(clientNegotiateErr)
 			if msg, err := sp.ClientWaitContractResp(); err != nil || msg.Code != storage.HostAckMsg {
 				client.log.Error("Client receive host ack msg failed or msg.code is not host ack", "err", err)
 			}
@@ -418,7 +957,13 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 	}
 
 	if msg.Code == storage.HostNegotiateErrorMsg {
-		hostNegotiateErr = storage.ErrHostNegotiate
+		negotiateErr := storage.DecodeNegotiationError(msg, storage.ErrHostNegotiate)
+		// the host rejecting the virtual sectors is not penalized, the caller uploads the
+		// sector data instead. Neither is the host rejecting the deletes
+		if negotiateErr.Code == storage.NegotiationErrRejected && (hasVirtualAppend(actions) || len(deletedRoots) != 0) {
+			return negotiateErr
+		}
+		hostNegotiateErr = negotiateErr
 		return hostNegotiateErr
 	}
 
@@ -428,23 +973,31 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 	}
 
 	// verify merkle proof
-	numSectors := contractRevision.NewFileSize / storage.SectorSize
-	proofRanges := CalculateProofRanges(actions, numSectors)
-	proofHashes := merkleResp.OldSubtreeHashes
-	leafHashes := merkleResp.OldLeafHashes
-	oldRoot, newRoot := contractRevision.NewFileMerkleRoot, merkleResp.NewMerkleRoot
+	newRoot := merkleResp.NewMerkleRoot
+	if len(deletedRoots) != 0 {
+		if newRoot != deletedMerkleRoot {
+			hostNegotiateErr = errors.New("invalid new merkle root after delete")
+			return hostNegotiateErr
+		}
+	} else {
+		numSectors := contractRevision.NewFileSize / storage.SectorSize
+		proofRanges := CalculateProofRanges(actions, numSectors)
+		proofHashes := merkleResp.OldSubtreeHashes
+		leafHashes := merkleResp.OldLeafHashes
+		oldRoot := contractRevision.NewFileMerkleRoot
 
-	if err := merkle.Sha256VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, oldRoot); err != nil {
-		hostNegotiateErr = err
-		return fmt.Errorf("invalid merkle proof for old root, err: %v", err)
-	}
+		if err := merkle.Sha256VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, oldRoot); err != nil {
+			hostNegotiateErr = err
+			return fmt.Errorf("invalid merkle proof for old root, err: %v", err)
+		}
 
-	// and then modify the leaves and verify the new Merkle root
-	leafHashes = ModifyLeaves(leafHashes, actions, numSectors)
-	proofRanges = ModifyProofRanges(proofRanges, actions, numSectors)
-	if err := merkle.Sha256VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, newRoot); err != nil {
-		hostNegotiateErr = err
-		return fmt.Errorf("invalid merkle proof for new root, err: %v", err)
+		// and then modify the leaves and verify the new Merkle root
+		leafHashes = ModifyLeaves(leafHashes, actions, numSectors)
+		proofRanges = ModifyProofRanges(proofRanges, actions, numSectors)
+		if err := merkle.Sha256VerifyDiffProof(proofRanges, numSectors, proofHashes, leafHashes, newRoot); err != nil {
+			hostNegotiateErr = err
+			return fmt.Errorf("invalid merkle proof for new root, err: %v", err)
+		}
 	}
 
 	// update the revision, sign it, and send it
@@ -480,7 +1033,7 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 	}
 
 	if msg.Code == storage.HostNegotiateErrorMsg {
-		hostNegotiateErr = storage.ErrHostNegotiate
+		hostNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrHostNegotiate)
 		return hostNegotiateErr
 	}
 
@@ -494,7 +1047,7 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 	// commit upload revision
 	err = contract.CommitRevision(rev, storagePrice, bandwidthPrice)
 	if err != nil {
-		_ = sp.SendClientCommitFailedMsg()
+		_ = sp.SendClientCommitFailedMsg(err)
 
 		// wait for host ack msg
 		msg, err = sp.ClientWaitContractResp()
@@ -518,6 +1071,25 @@ func (client *StorageClient) Write(sp storage.Peer, actions []storage.UploadActi
 
 	switch msg.Code {
 	case storage.HostAckMsg:
+		// verify the file merkle root of the contract with the sectors appended or deleted. A
+		// mismatch means the client and the host do not agree on the data the contract covers
+		if len(deletedRoots) != 0 {
+			if err = contract.CommitDeletedRoots(deletedRoots...); err != nil {
+				client.log.Error("failed to verify the file merkle root after delete", "contractID", contractID, "err", err)
+				return fmt.Errorf("failed to verify the file merkle root after delete: %v", err)
+			}
+			return
+		}
+		var roots []common.Hash
+		for _, action := range actions {
+			if action.Type == storage.UploadActionAppend || action.Type == storage.UploadActionAppendVirtual {
+				roots = append(roots, action.SectorRoot())
+			}
+		}
+		if err = contract.CommitUploadedRoots(roots...); err != nil {
+			client.log.Error("failed to verify the file merkle root after upload", "contractID", contractID, "err", err)
+			return fmt.Errorf("failed to verify the file merkle root after upload: %v", err)
+		}
 		return
 	default:
 		hostCommitErr = storage.ErrHostCommit
@@ -617,7 +1189,7 @@ func (client *StorageClient) Read(sp storage.Peer, w io.Writer, req storage.Down
 	var clientNegotiateErr, hostNegotiateErr, hostCommitErr error
 	defer func() {
 		if clientNegotiateErr != nil {
-			_ = sp.SendClientNegotiateErrorMsg()
+			_ = sp.SendClientNegotiateErrorMsg(clientNegotiateErr)
 			if msg, err := sp.ClientWaitContractResp(); err != nil || msg.Code != storage.HostAckMsg {
 				client.log.Error("Client receive host ack msg failed or msg.code is not host ack", "err", err)
 			}
@@ -658,7 +1230,7 @@ func (client *StorageClient) Read(sp storage.Peer, w io.Writer, req storage.Down
 
 	// if host send some negotiation error, client should handler it
 	if msg.Code == storage.HostNegotiateErrorMsg {
-		hostNegotiateErr = storage.ErrHostNegotiate
+		hostNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrHostNegotiate)
 		return hostNegotiateErr
 	}
 
@@ -708,8 +1280,8 @@ func (client *StorageClient) Read(sp storage.Peer, w io.Writer, req storage.Down
 	// commit this revision
 	err = contract.CommitRevision(newRevision, price)
 	if err != nil {
-		if err := sp.SendClientCommitFailedMsg(); err != nil {
-			return err
+		if sendErr := sp.SendClientCommitFailedMsg(err); sendErr != nil {
+			return sendErr
 		}
 
 		// wait for host ack msg
@@ -819,28 +1391,42 @@ func (client *StorageClient) newDownload(params downloadParams) (*download, erro
 		endSegmentIndex--
 	}
 
-	// map from the host id to the index of the sector within the segment
-	segmentMaps := make([]map[string]downloadSectorInfo, endSegmentIndex-startSegmentIndex+1)
+	// the file might be still uploading. Only the segments uploaded with enough sectors could
+	// be downloaded, thus the download fails if any segment in range is not available yet
+	for segmentIndex := startSegmentIndex; segmentIndex <= endSegmentIndex; segmentIndex++ {
+		if !params.file.SegmentAvailable(segmentIndex) {
+			segmentLength := params.file.SegmentSize()
+			if segmentIndex == params.file.NumSegments()-1 {
+				segmentLength = common.FinalSegmentLength(params.file.FileSize(), params.file.SegmentSize())
+			}
+			segmentStart := segmentIndex * params.file.SegmentSize()
+			return nil, &SegmentUnavailableError{
+				Segment: segmentIndex,
+				Start:   segmentStart,
+				End:     segmentStart + segmentLength,
+			}
+		}
+	}
+
+	// map from the host id to all the sectors the host holds within the segment. The workers
+	// rotate through the sectors of all hosts, so that any working sectors could be used
+	segmentMaps := make([]map[string][]downloadSectorInfo, endSegmentIndex-startSegmentIndex+1)
 	for segmentIndex := startSegmentIndex; segmentIndex <= endSegmentIndex; segmentIndex++ {
-		segmentMaps[segmentIndex-startSegmentIndex] = make(map[string]downloadSectorInfo)
+		segmentMap := make(map[string][]downloadSectorInfo)
 		sectors, err := params.file.Sectors(uint64(segmentIndex))
 		if err != nil {
 			return nil, err
 		}
 		for sectorIndex, sectorSet := range sectors {
 			for _, sector := range sectorSet {
-
-				// check that a worker should not have two sectors for the same segment
-				_, exists := segmentMaps[segmentIndex-startSegmentIndex][sector.HostID.String()]
-				if exists {
-					client.log.Error("a worker has multiple sectors for the same segment")
-				}
-				segmentMaps[segmentIndex-startSegmentIndex][sector.HostID.String()] = downloadSectorInfo{
-					index: uint64(sectorIndex),
-					root:  sector.MerkleRoot,
-				}
+				segmentMap[sector.HostID.String()] = append(segmentMap[sector.HostID.String()], downloadSectorInfo{
+					index:         uint64(sectorIndex),
+					root:          sector.MerkleRoot,
+					keyGeneration: sector.KeyGeneration,
+				})
 			}
 		}
+		segmentMaps[segmentIndex-startSegmentIndex] = segmentMap
 	}
 
 	// record where to write every segment
@@ -959,7 +1545,7 @@ func (client *StorageClient) createDownload(p storage.DownloadParameters) (*down
 		latencyTarget:     25e3 * time.Millisecond,
 
 		// always download the whole file
-		length:      entry.FileSize(),
+		length:      snap.FileSize(),
 		needsMemory: true,
 
 		// always download from 0
@@ -1108,6 +1694,21 @@ func (client *StorageClient) RevisionOrRenewingDone(hostID enode.ID) {
 	client.ethBackend.RevisionOrRenewingDone(hostID)
 }
 
+// AbandonContractOperations abandons all in-flight operations with the host of the contract
+// without waiting for the timeouts. The connection with the host is torn down, the negotiation
+// gates are released, and the operations waiting for the host return immediately
+func (client *StorageClient) AbandonContractOperations(id storage.ContractID) error {
+	contract, exists := client.contractManager.RetrieveActiveContract(id)
+	if !exists {
+		return fmt.Errorf("the contract %v does not exist", id)
+	}
+	if !client.ethBackend.AbandonOperations(contract.EnodeID) {
+		return fmt.Errorf("the host %v of the contract is not connected", contract.EnodeID)
+	}
+	client.log.Warn("abandoned the in-flight operations", "contractID", id, "hostID", contract.EnodeID)
+	return nil
+}
+
 // CheckAndUpdateConnection will check the connection between client
 // and host. If there are no contracts signed between the two, the
 // connection will be updated from the static connection to dynamic
@@ -462,6 +462,8 @@ func (b *BackendTest) TryToRenewOrRevise(hostID enode.ID) bool { return false }
 
 func (b *BackendTest) RevisionOrRenewingDone(hostID enode.ID) {}
 
+func (b *BackendTest) AbandonOperations(hostID enode.ID) bool { return false }
+
 /*
 _____  _____  _______      __  _______ ______        ______ _    _ _   _  _____ _______ _____ ____  _   _
 |  __ \|  __ \|_   _\ \    / /\|__   __|  ____|      |  ____| |  | | \ | |/ ____|__   __|_   _/ __ \| \ | |
@@ -486,10 +488,11 @@ func settingValidation(settings storage.ClientSetting) (expectedErr bool) {
 
 func randomClientSettingsGenerator() (settings storage.ClientSetting) {
 	settings = storage.ClientSetting{
-		RentPayment:       randRentPaymentGenerator(),
-		EnableIPViolation: true,
-		MaxUploadSpeed:    randInt64(),
-		MaxDownloadSpeed:  randInt64(),
+		RentPayment:             randRentPaymentGenerator(),
+		EnableIPViolation:       true,
+		MaxUploadSpeed:          randInt64(),
+		MaxDownloadSpeed:        randInt64(),
+		RepairDownloadThreshold: randFloat64(),
 	}
 
 	return
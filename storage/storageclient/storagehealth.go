@@ -0,0 +1,43 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// Health returns the health summary of the storage client. The summary is built from the
+// in-memory state only, with the files counted by the latest health sample instead of
+// opening each file, so that it is cheap to be called periodically
+func (client *StorageClient) Health() storage.ClientHealth {
+	var health storage.ClientHealth
+	for _, contract := range client.contractManager.RetrieveActiveContracts() {
+		health.TotalContracts++
+		if contract.Status.UploadAbility {
+			health.UploadableContracts++
+		}
+		if contract.Status.RenewAbility {
+			health.RenewableContracts++
+		}
+		if contract.Status.Canceled {
+			health.CanceledContracts++
+		}
+	}
+	for _, fileHealth := range client.healthHistory.latest() {
+		switch {
+		case fileHealth < dxfile.StuckThreshold:
+			health.UnrecoverableFiles++
+		case fileHealth < dxfile.RepairHealthThreshold:
+			health.RepairNeededFiles++
+		default:
+			health.HealthyFiles++
+		}
+	}
+	health.RepairBacklog = uint64(client.uploadHeap.len())
+	health.MemoryLimit = client.memoryManager.MemoryLimit()
+	health.MemoryAvailable = client.memoryManager.MemoryAvailable()
+	return health
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// TestStorageClient_Health test the client health reflects the contract status, the health band
+// of the files, the repair backlog and the memory usage
+func TestStorageClient_Health(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storageclient-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.contractManager.GetStorageContractSet().Close()
+
+	// three contracts with one of them canceled
+	if err := client.contractManager.InsertRandomActiveContracts(3); err != nil {
+		t.Fatal(err)
+	}
+	contractSet := client.contractManager.GetStorageContractSet()
+	contract, _ := contractSet.Acquire(contractSet.IDs()[0])
+	if err := contract.UpdateStatus(storage.ContractStatus{Canceled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := contractSet.Return(contract); err != nil {
+		t.Fatal(err)
+	}
+
+	// the files are counted by the latest health sample
+	now := time.Now()
+	client.healthHistory.record("unrecoverable", HealthSample{Time: now, Health: 50}, now)
+	client.healthHistory.record("repair", HealthSample{Time: now, Health: 200}, now)
+	client.healthHistory.record("repair", HealthSample{Time: now.Add(time.Minute), Health: 150}, now)
+	client.healthHistory.record("healthy", HealthSample{Time: now, Health: 200}, now)
+
+	for i := 0; i < 2; i++ {
+		client.uploadHeap.push(&unfinishedUploadSegment{id: uploadSegmentID{fid: dxfile.FileID{1}, index: uint64(i)}, sectorsAllNeedNum: 1})
+	}
+	if !client.memoryManager.Request(100, false) {
+		t.Fatal("cannot request memory")
+	}
+
+	expect := storage.ClientHealth{
+		TotalContracts:      3,
+		UploadableContracts: 2,
+		RenewableContracts:  2,
+		CanceledContracts:   1,
+		HealthyFiles:        1,
+		RepairNeededFiles:   1,
+		UnrecoverableFiles:  1,
+		RepairBacklog:       2,
+		MemoryLimit:         DefaultMaxMemory,
+		MemoryAvailable:     DefaultMaxMemory - 100,
+	}
+	if health := client.Health(); health != expect {
+		t.Errorf("unexpected client health\n\texpect %+v\n\tgot %+v", expect, health)
+	}
+}
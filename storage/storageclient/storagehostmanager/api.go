@@ -63,11 +63,22 @@ func (api *PublicStorageHostManagerAPI) StorageHostRanks() (rankings []StorageHo
 	return api.shm.StorageHostRanks()
 }
 
+// QueryHosts will return the hosts satisfying the filter, sorted by "evaluation", "price" or
+// "uptime". At most limit hosts after offset are returned, and 0 limit means no limit
+func (api *PublicStorageHostManagerAPI) QueryHosts(filter HostQueryFilter, sortBy string, limit, offset int) ([]storage.HostInfo, error) {
+	return api.shm.QueryHosts(filter, sortBy, limit, offset)
+}
+
 // FilterMode will return the current storage host manager filter mode setting
 func (api *PublicStorageHostManagerAPI) FilterMode() (fm string) {
 	return api.shm.RetrieveFilterMode()
 }
 
+// MinEvaluation will return the current minimum evaluation of a host to be selected for new contracts
+func (api *PublicStorageHostManagerAPI) MinEvaluation() int64 {
+	return api.shm.RetrieveMinEvaluation()
+}
+
 // FilteredHosts will return hosts stored in the filtered host tree
 func (api *PublicStorageHostManagerAPI) FilteredHosts() (allFiltered []storage.HostInfo) {
 	return api.shm.filteredTree.All()
@@ -105,6 +116,71 @@ func (api *PrivateStorageHostManagerAPI) SetFilterMode(fm string, hostInfos []en
 	return
 }
 
+// SetInteractionForgiveness will be used to change the forgiveness policy of failed interactions.
+// After a host achieves successThreshold consecutive successful interactions, each further success
+// forgives a fraction of rate from its failed interaction factor
+func (api *PrivateStorageHostManagerAPI) SetInteractionForgiveness(successThreshold int, rate float64) (resp string, err error) {
+	if err = api.shm.SetInteractionForgiveness(successThreshold, rate); err != nil {
+		err = fmt.Errorf("failed to set the interaction forgiveness: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("the interaction forgiveness has been successfully set to threshold %v, rate %v",
+		successThreshold, rate)
+	return
+}
+
+// SetInteractionAggregation will be used to change the policy to aggregate the interaction records.
+// The records within the window are kept in detail, and the older ones are aggregated into time
+// buckets of bucketSize. Both are duration strings, e.g. "24h"
+func (api *PrivateStorageHostManagerAPI) SetInteractionAggregation(window string, bucketSize string) (resp string, err error) {
+	windowDuration, err := time.ParseDuration(window)
+	if err != nil {
+		err = fmt.Errorf("failed to set the interaction aggregation: %s", err.Error())
+		return
+	}
+	bucketDuration, err := time.ParseDuration(bucketSize)
+	if err != nil {
+		err = fmt.Errorf("failed to set the interaction aggregation: %s", err.Error())
+		return
+	}
+	if err = api.shm.SetInteractionAggregation(windowDuration, bucketDuration); err != nil {
+		err = fmt.Errorf("failed to set the interaction aggregation: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("the interaction aggregation has been successfully set to window %v, bucket size %v",
+		windowDuration, bucketDuration)
+	return
+}
+
+// SetURLChangePolicy will be used to change the policy to handle the hosts changing their enode URL.
+// A host changing its URL more than maxChanges times within the window is flagged as suspicious, and
+// its URL is kept unchanged if freezeSuspicious is set. The window is a duration string, e.g. "24h"
+func (api *PrivateStorageHostManagerAPI) SetURLChangePolicy(maxChanges int, window string, freezeSuspicious bool) (resp string, err error) {
+	duration, err := time.ParseDuration(window)
+	if err != nil {
+		err = fmt.Errorf("failed to set the url change policy: %s", err.Error())
+		return
+	}
+	if err = api.shm.SetURLChangePolicy(maxChanges, duration, freezeSuspicious); err != nil {
+		err = fmt.Errorf("failed to set the url change policy: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("the url change policy has been successfully set to max changes %v, window %v, freeze %v",
+		maxChanges, duration, freezeSuspicious)
+	return
+}
+
+// SetMinEvaluation will be used to change the minimum evaluation of a host to be selected for
+// new contracts. Hosts evaluated below the minimum are never selected. Set to 0 to disable
+func (api *PrivateStorageHostManagerAPI) SetMinEvaluation(minEvaluation int64) (resp string, err error) {
+	if err = api.shm.SetMinEvaluation(minEvaluation); err != nil {
+		err = fmt.Errorf("failed to set the minimum evaluation: %s", err.Error())
+		return
+	}
+	resp = fmt.Sprintf("the minimum evaluation has been successfully set to %v", minEvaluation)
+	return
+}
+
 // PublicHostManagerDebugAPI defines the object used to call eligible APIs
 // that are used to perform testing
 type PublicHostManagerDebugAPI struct {
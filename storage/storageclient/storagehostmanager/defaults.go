@@ -70,6 +70,10 @@ const (
 	// storageBaseDivider is the parameter to be used in storageRemainingScore calculation.
 	// The larger the divider, the slower the function approaching asymptote y = 1 as storage grows.
 	storageBaseDivider float64 = 10
+
+	// storageOverReportDiscount is the discount applied to the advertised remaining storage
+	// for each consecutive storage probe the host failed while claiming enough storage
+	storageOverReportDiscount float64 = 0.5
 )
 
 // interaction related fields
@@ -96,6 +100,44 @@ const (
 	// maxNumInteractionRecord is the maximum number of interaction records to be saved in
 	// nodeInfo
 	maxNumInteractionRecord = 30
+
+	// defaultForgivenessSuccessThreshold is the default number of consecutive successful
+	// interactions a host must achieve before its failed interaction factor starts to be forgiven
+	defaultForgivenessSuccessThreshold = 10
+
+	// defaultForgivenessRate is the default fraction of the failed interaction factor to be
+	// forgiven on each successful interaction once the threshold is reached
+	defaultForgivenessRate float64 = 0.05
+)
+
+// interaction aggregation related fields
+const (
+	// defaultInteractionWindow is the default duration in which the interaction records are
+	// kept in detail
+	defaultInteractionWindow = 24 * time.Hour
+
+	// defaultInteractionBucketSize is the default duration of a time bucket the interaction
+	// records beyond the detailed window are aggregated into
+	defaultInteractionBucketSize = time.Hour
+
+	// maxNumInteractionBucket is the maximum number of interaction buckets to be saved in
+	// nodeInfo
+	maxNumInteractionBucket = 7 * 24
+)
+
+// enode URL change related fields
+const (
+	// defaultURLChangeMaxChanges is the default maximum number of enode URL changes of a host
+	// within the window before it is flagged as suspicious
+	defaultURLChangeMaxChanges = 3
+
+	// defaultURLChangeWindow is the default duration in which the enode URL changes of a host
+	// are counted
+	defaultURLChangeWindow = 24 * time.Hour
+
+	// defaultURLChangeFreezeSuspicious denotes whether the enode URL of a suspicious host is
+	// frozen by default
+	defaultURLChangeFreezeSuspicious = true
 )
 
 // uptime related fields
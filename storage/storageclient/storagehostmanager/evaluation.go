@@ -198,7 +198,7 @@ func contractCostScoreCalc(info storage.HostInfo, rent storage.RentPayment, mark
 // space the storage host remained, higher evaluation it will got. The baseline for storage is set to
 // required storage * storageBaseDivider
 func storageRemainingScoreCalc(info storage.HostInfo, settings storage.RentPayment) float64 {
-	ratio := float64(info.RemainingStorage) / float64(expectedStoragePerContract(settings))
+	ratio := believedRemainingStorage(info) / float64(expectedStoragePerContract(settings))
 	factor := ratio / (ratio + storageBaseDivider)
 	return factor
 }
@@ -0,0 +1,133 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// The fields the hosts queried can be sorted by
+const (
+	// HostSortEvaluation sorts the hosts from the highest evaluation to the lowest
+	HostSortEvaluation = "evaluation"
+
+	// HostSortPrice sorts the hosts from the lowest storage price to the highest
+	HostSortPrice = "price"
+
+	// HostSortUptime sorts the hosts from the highest uptime rate to the lowest
+	HostSortUptime = "uptime"
+)
+
+// HostQueryFilter defines the conditions the hosts queried must satisfy. The zero value
+// of each field means no restriction
+type HostQueryFilter struct {
+	AcceptingContracts bool          `json:"acceptingContracts"`
+	Online             bool          `json:"online"`
+	MinStorage         uint64        `json:"minStorage"`
+	MinStoragePrice    common.BigInt `json:"minStoragePrice"`
+	MaxStoragePrice    common.BigInt `json:"maxStoragePrice"`
+}
+
+// hostQueryEntry is the host info along with the fields it is sorted by
+type hostQueryEntry struct {
+	info   storage.HostInfo
+	eval   int64
+	uptime float64
+}
+
+// QueryHosts returns the hosts satisfying the filter, sorted by the field specified. The hosts
+// with the same value are ordered by their enode ID, so that the pagination is stable. At most
+// limit hosts after offset are returned, and 0 limit means no limit
+func (shm *StorageHostManager) QueryHosts(filter HostQueryFilter, sortBy string, limit, offset int) ([]storage.HostInfo, error) {
+	if limit < 0 || offset < 0 {
+		return nil, fmt.Errorf("invalid pagination, limit %v, offset %v", limit, offset)
+	}
+	less, err := hostQueryLess(sortBy)
+	if err != nil {
+		return nil, err
+	}
+
+	shm.lock.RLock()
+	allHosts := shm.storageHostTree.All()
+	entries := make([]hostQueryEntry, 0, len(allHosts))
+	for _, info := range allHosts {
+		if !filter.match(info) {
+			continue
+		}
+		eval, _ := shm.storageHostTree.RetrieveHostEval(info.EnodeID)
+		entries = append(entries, hostQueryEntry{
+			info:   info,
+			eval:   eval,
+			uptime: getHostUpRate(info),
+		})
+	}
+	shm.lock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if less(entries[i], entries[j]) {
+			return true
+		}
+		if less(entries[j], entries[i]) {
+			return false
+		}
+		return bytes.Compare(entries[i].info.EnodeID[:], entries[j].info.EnodeID[:]) < 0
+	})
+
+	// paginate the sorted hosts
+	if offset >= len(entries) {
+		return []storage.HostInfo{}, nil
+	}
+	entries = entries[offset:]
+	if limit != 0 && limit < len(entries) {
+		entries = entries[:limit]
+	}
+	hosts := make([]storage.HostInfo, 0, len(entries))
+	for _, entry := range entries {
+		hosts = append(hosts, entry.info)
+	}
+	return hosts, nil
+}
+
+// match checks whether the host satisfies the filter
+func (filter HostQueryFilter) match(info storage.HostInfo) bool {
+	if filter.AcceptingContracts && !info.AcceptingContracts {
+		return false
+	}
+	if filter.Online {
+		numScanRecords := len(info.ScanRecords)
+		if numScanRecords == 0 || !info.ScanRecords[numScanRecords-1].Success {
+			return false
+		}
+	}
+	if info.RemainingStorage < filter.MinStorage {
+		return false
+	}
+	if info.StoragePrice.Cmp(filter.MinStoragePrice) < 0 {
+		return false
+	}
+	if filter.MaxStoragePrice.Sign() != 0 && info.StoragePrice.Cmp(filter.MaxStoragePrice) > 0 {
+		return false
+	}
+	return true
+}
+
+// hostQueryLess returns the function comparing the hosts by the field specified
+func hostQueryLess(sortBy string) (func(a, b hostQueryEntry) bool, error) {
+	switch sortBy {
+	case HostSortEvaluation, "":
+		return func(a, b hostQueryEntry) bool { return a.eval > b.eval }, nil
+	case HostSortPrice:
+		return func(a, b hostQueryEntry) bool { return a.info.StoragePrice.Cmp(b.info.StoragePrice) < 0 }, nil
+	case HostSortUptime:
+		return func(a, b hostQueryEntry) bool { return a.uptime > b.uptime }, nil
+	default:
+		return nil, fmt.Errorf("unknown sort field %v, expect %v, %v or %v", sortBy, HostSortEvaluation, HostSortPrice, HostSortUptime)
+	}
+}
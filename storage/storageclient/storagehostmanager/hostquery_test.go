@@ -0,0 +1,91 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestQueryHosts test the hosts queried are filtered, sorted and paginated as expected
+func TestQueryHosts(t *testing.T) {
+	hosts := []struct {
+		eval      int64
+		price     int64
+		storage   uint64
+		accepting bool
+		online    bool
+		uptime    float64
+	}{
+		{50, 30, 100, true, true, 9},
+		{40, 10, 500, true, false, 5},
+		{50, 20, 300, false, true, 7},
+		{20, 10, 200, true, true, 9},
+		{10, 40, 50, true, true, 1},
+	}
+	shm := New("test")
+	for i, host := range hosts {
+		var id enode.ID
+		id[0] = byte(i)
+		info := storage.HostInfo{
+			HostExtConfig: storage.HostExtConfig{
+				AcceptingContracts: host.accepting,
+				StoragePrice:       common.NewBigInt(host.price),
+				RemainingStorage:   host.storage,
+			},
+			AccumulatedUptime:   host.uptime,
+			AccumulatedDowntime: 10 - host.uptime,
+			ScanRecords:         storage.HostPoolScans{{Timestamp: time.Now(), Success: host.online}},
+			EnodeID:             id,
+		}
+		if err := shm.storageHostTree.Insert(info, host.eval); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter   HostQueryFilter
+		sortBy   string
+		limit    int
+		offset   int
+		expected []byte
+	}{
+		{HostQueryFilter{}, HostSortEvaluation, 0, 0, []byte{0, 2, 1, 3, 4}},
+		{HostQueryFilter{}, HostSortPrice, 0, 0, []byte{1, 3, 2, 0, 4}},
+		{HostQueryFilter{}, HostSortUptime, 0, 0, []byte{0, 3, 2, 1, 4}},
+		{HostQueryFilter{AcceptingContracts: true, Online: true}, HostSortPrice, 0, 0, []byte{3, 0, 4}},
+		{HostQueryFilter{MinStorage: 200}, HostSortEvaluation, 0, 0, []byte{2, 1, 3}},
+		{HostQueryFilter{MinStoragePrice: common.NewBigInt(10), MaxStoragePrice: common.NewBigInt(20)}, HostSortUptime, 0, 0, []byte{3, 2, 1}},
+		{HostQueryFilter{AcceptingContracts: true}, HostSortEvaluation, 0, 0, []byte{0, 1, 3, 4}},
+		{HostQueryFilter{}, HostSortPrice, 2, 1, []byte{3, 2}},
+		{HostQueryFilter{}, HostSortPrice, 0, 3, []byte{0, 4}},
+		{HostQueryFilter{}, HostSortPrice, 10, 5, []byte{}},
+	}
+	for i, test := range tests {
+		infos, err := shm.QueryHosts(test.filter, test.sortBy, test.limit, test.offset)
+		if err != nil {
+			t.Fatalf("test %v: %v", i, err)
+		}
+		if len(infos) != len(test.expected) {
+			t.Fatalf("test %v: expect %v hosts, got %v", i, len(test.expected), len(infos))
+		}
+		for j, info := range infos {
+			if info.EnodeID[0] != test.expected[j] {
+				t.Errorf("test %v: host %v expect %v, got %v", i, j, test.expected[j], info.EnodeID[0])
+			}
+		}
+	}
+
+	if _, err := shm.QueryHosts(HostQueryFilter{}, "unknown", 0, 0); err == nil {
+		t.Errorf("unknown sort field should return an error")
+	}
+	if _, err := shm.QueryHosts(HostQueryFilter{}, HostSortPrice, -1, 0); err == nil {
+		t.Errorf("negative limit should return an error")
+	}
+}
@@ -31,7 +31,7 @@ func (shm *StorageHostManager) hostInfoUpdate(info storage.HostInfo, b onlineBac
 	info = applyInfoToStoredHostInfo(info, storedInfo)
 	success := err == nil
 	info = calcUptimeUpdate(info, success, uint64(time.Now().Unix()))
-	info = calcInteractionUpdate(info, InteractionGetConfig, success, uint64(time.Now().Unix()))
+	info = calcInteractionUpdate(info, InteractionGetConfig, success, uint64(time.Now().Unix()), shm.forgiveness, shm.aggregation)
 
 	// Check whether to remove the host
 	remove := whetherRemoveHost(info, shm.getBlockHeight())
@@ -5,6 +5,7 @@
 package storagehostmanager
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -36,6 +37,10 @@ const (
 
 	// InteractionDownload is the interaction code for client's download negotiation
 	InteractionDownload
+
+	// InteractionStorageProbe is the interaction code for client's probe on the host's
+	// remaining storage
+	InteractionStorageProbe
 )
 
 var (
@@ -46,6 +51,7 @@ var (
 		InteractionRenewContract:  "renew contract",
 		InteractionUpload:         "upload",
 		InteractionDownload:       "download",
+		InteractionStorageProbe:   "storage probe",
 	}
 
 	// interactionNameToTypeDict is the mapping from name string to type
@@ -55,6 +61,7 @@ var (
 		"renew contract":   InteractionRenewContract,
 		"upload":           InteractionUpload,
 		"download":         InteractionDownload,
+		"storage probe":    InteractionStorageProbe,
 	}
 
 	// interactonWeight is the mapping from interaction type to weight
@@ -64,9 +71,46 @@ var (
 		InteractionRenewContract:  5,
 		InteractionUpload:         5,
 		InteractionDownload:       10,
+		InteractionStorageProbe:   5,
 	}
 )
 
+// InteractionForgiveness is the policy to forgive the accumulated failed interaction weight
+// of a host which has proven to be reliable again. After the host achieves SuccessThreshold
+// consecutive successful interactions, each further successful interaction forgives a fraction
+// of Rate from the host's FailedInteractionFactor.
+type InteractionForgiveness struct {
+	// SuccessThreshold is the number of consecutive successful interactions required before
+	// the forgiveness starts. Value 0 disables the forgiveness.
+	SuccessThreshold int `json:"successThreshold"`
+
+	// Rate is the fraction of the FailedInteractionFactor to be forgiven on each successful
+	// interaction after the threshold is reached. The value shall be within [0, 1]
+	Rate float64 `json:"rate"`
+}
+
+// defaultInteractionForgiveness is the default forgiveness policy used by storage host manager
+var defaultInteractionForgiveness = InteractionForgiveness{
+	SuccessThreshold: defaultForgivenessSuccessThreshold,
+	Rate:             defaultForgivenessRate,
+}
+
+// validate checks whether the forgiveness policy is valid
+func (f InteractionForgiveness) validate() error {
+	if f.SuccessThreshold < 0 || f.SuccessThreshold > maxNumInteractionRecord {
+		return fmt.Errorf("success threshold shall be within [0, %v]", maxNumInteractionRecord)
+	}
+	if f.Rate < 0 || f.Rate > 1 {
+		return errors.New("forgiveness rate shall be within [0, 1]")
+	}
+	return nil
+}
+
+// enabled returns whether the forgiveness policy takes effect
+func (f InteractionForgiveness) enabled() bool {
+	return f.SuccessThreshold > 0 && f.Rate > 0
+}
+
 // String return the string representation of the InteractionType
 func (it InteractionType) String() string {
 	if _, exist := interactionTypeToNameDict[it]; !exist {
@@ -129,7 +173,7 @@ func (shm *StorageHostManager) updateInteraction(id enode.ID, interactionType In
 	if !exist {
 		return fmt.Errorf("failed to retrive host info [%v]", id)
 	}
-	info = calcInteractionUpdate(info, interactionType, success, uint64(time.Now().Unix()))
+	info = calcInteractionUpdate(info, interactionType, success, uint64(time.Now().Unix()), shm.forgiveness, shm.aggregation)
 	// Evaluate the score and update the host info
 	score := shm.hostEvaluator.Evaluate(info)
 	if err := shm.storageHostTree.HostInfoUpdate(info, score); err != nil {
@@ -139,8 +183,9 @@ func (shm *StorageHostManager) updateInteraction(id enode.ID, interactionType In
 }
 
 // calcInteractionUpdate update the host info with the give interaction type and whether the interaction
-// is successful
-func calcInteractionUpdate(info storage.HostInfo, interactionType InteractionType, success bool, now uint64) storage.HostInfo {
+// is successful. The forgiveness policy is applied after the interaction record is updated
+func calcInteractionUpdate(info storage.HostInfo, interactionType InteractionType, success bool, now uint64,
+	forgiveness InteractionForgiveness, aggregation InteractionAggregation) storage.HostInfo {
 	// Calculate the weight for the interaction
 	weight := interactionWeight(interactionType)
 	// Apply the decay the host info
@@ -150,10 +195,38 @@ func calcInteractionUpdate(info storage.HostInfo, interactionType InteractionTyp
 	} else {
 		updateFailedInteraction(&info, weight)
 	}
-	updateInteractionRecord(&info, interactionType, success, now)
+	updateInteractionRecord(&info, interactionType, success, now, aggregation)
+	if success {
+		processForgiveness(&info, forgiveness)
+	}
 	return info
 }
 
+// processForgiveness forgive part of the failed interaction factor if the host has got enough
+// consecutive successful interactions
+func processForgiveness(info *storage.HostInfo, forgiveness InteractionForgiveness) {
+	if !forgiveness.enabled() {
+		return
+	}
+	if numConsecutiveSuccess(info.InteractionRecords) < forgiveness.SuccessThreshold {
+		return
+	}
+	info.FailedInteractionFactor *= 1 - forgiveness.Rate
+}
+
+// numConsecutiveSuccess returns the number of the most recent consecutive successful
+// interactions in the records
+func numConsecutiveSuccess(records []storage.HostInteractionRecord) int {
+	var num int
+	for i := len(records) - 1; i >= 0; i-- {
+		if !records[i].Success {
+			break
+		}
+		num++
+	}
+	return num
+}
+
 // processDecay calculate and apply the decay factor to the interaction factors
 func processDecay(info *storage.HostInfo, now uint64) {
 	// Calculate the decay factor
@@ -166,18 +239,16 @@ func processDecay(info *storage.HostInfo, now uint64) {
 	info.LastInteractionTime = now
 }
 
-// updateInteractionRecord add the current interaction record to the host info
-// If the host info has already got 10 or more records, only keep the most recent 10 records
+// updateInteractionRecord add the current interaction record to the host info. The records
+// beyond the detailed window or the maximum number are aggregated into the time buckets
 func updateInteractionRecord(info *storage.HostInfo, interactionType InteractionType, success bool,
-	now uint64) {
+	now uint64, aggregation InteractionAggregation) {
 	info.InteractionRecords = append(info.InteractionRecords, storage.HostInteractionRecord{
 		Time:            time.Unix(int64(now), 0),
 		InteractionType: interactionType.String(),
 		Success:         success,
 	})
-	if len(info.InteractionRecords) > maxNumInteractionRecord {
-		info.InteractionRecords = info.InteractionRecords[len(info.InteractionRecords)-maxNumInteractionRecord:]
-	}
+	aggregateInteractionRecords(info, now, aggregation)
 }
 
 // updateSuccessfulInteraction update the successful factor based on weight
@@ -185,7 +256,7 @@ func updateSuccessfulInteraction(info *storage.HostInfo, weight float64) {
 	info.SuccessfulInteractionFactor += weight
 }
 
-// updateFailedInteraction update the
+// updateFailedInteraction update the failed factor based on weight
 func updateFailedInteraction(info *storage.HostInfo, weight float64) {
 	info.FailedInteractionFactor += weight
 }
@@ -110,7 +110,7 @@ func TestUpdateInteractionRecord(t *testing.T) {
 				Success:         true,
 			})
 		}
-		updateInteractionRecord(&info, InteractionGetConfig, true, 0)
+		updateInteractionRecord(&info, InteractionGetConfig, true, 0, defaultInteractionAggregation)
 		size := len(info.InteractionRecords)
 		if test.recordSize >= maxNumInteractionRecord {
 			if size != maxNumInteractionRecord {
@@ -171,3 +171,102 @@ func TestStorageHostManager_IncrementFailedInteractions(t *testing.T) {
 		t.Errorf("After success update, interaction not increasing: %v -> %v", prevSc, newSc)
 	}
 }
+
+// TestInteractionForgiveness test a host that failed and then succeeded consistently shall
+// recover its interaction score with the forgiveness policy
+func TestInteractionForgiveness(t *testing.T) {
+	forgiveness := InteractionForgiveness{SuccessThreshold: 5, Rate: 0.2}
+	tests := []struct {
+		forgiveness InteractionForgiveness
+		recovered   bool
+	}{
+		{forgiveness, true},
+		{InteractionForgiveness{}, false},
+	}
+	for index, test := range tests {
+		info := storage.HostInfo{}
+		interactionInitiate(&info)
+		now := info.LastInteractionTime
+		eligibleScore := interactionScoreCalc(info) * 0.9
+
+		// The host failed 10 downloads in a row
+		for i := 0; i != 10; i++ {
+			info = calcInteractionUpdate(info, InteractionDownload, false, now, test.forgiveness, defaultInteractionAggregation)
+		}
+		if sc := interactionScoreCalc(info); sc >= eligibleScore {
+			t.Fatalf("test %d: after failures, score %v shall be smaller than %v", index, sc, eligibleScore)
+		}
+		failedFactor := info.FailedInteractionFactor
+
+		// The host then succeeded consistently
+		for i := 0; i != maxNumInteractionRecord; i++ {
+			info = calcInteractionUpdate(info, InteractionGetConfig, true, now, test.forgiveness, defaultInteractionAggregation)
+		}
+		sc := interactionScoreCalc(info)
+		if recovered := sc >= eligibleScore; recovered != test.recovered {
+			t.Errorf("test %d: recovered not expected. Got %v, Expect %v. Score %v, eligible score %v",
+				index, recovered, test.recovered, sc, eligibleScore)
+		}
+		if !test.recovered && info.FailedInteractionFactor != failedFactor {
+			t.Errorf("test %d: failed factor shall not be forgiven. Got %v, Expect %v", index,
+				info.FailedInteractionFactor, failedFactor)
+		}
+	}
+}
+
+// TestInteractionForgiveness_FailureResetsStreak test that a failed interaction resets the
+// consecutive successful interaction count, thus no forgiveness happens before the threshold
+// is reached again
+func TestInteractionForgiveness_FailureResetsStreak(t *testing.T) {
+	forgiveness := InteractionForgiveness{SuccessThreshold: 5, Rate: 0.5}
+	info := storage.HostInfo{}
+	interactionInitiate(&info)
+	now := info.LastInteractionTime
+	for i := 0; i != forgiveness.SuccessThreshold; i++ {
+		info = calcInteractionUpdate(info, InteractionGetConfig, true, now, forgiveness, defaultInteractionAggregation)
+	}
+	info = calcInteractionUpdate(info, InteractionDownload, false, now, forgiveness, defaultInteractionAggregation)
+	failedFactor := info.FailedInteractionFactor
+	for i := 0; i != forgiveness.SuccessThreshold-1; i++ {
+		info = calcInteractionUpdate(info, InteractionGetConfig, true, now, forgiveness, defaultInteractionAggregation)
+	}
+	if info.FailedInteractionFactor != failedFactor {
+		t.Errorf("failed factor forgiven before threshold. Got %v, Expect %v", info.FailedInteractionFactor, failedFactor)
+	}
+	info = calcInteractionUpdate(info, InteractionGetConfig, true, now, forgiveness, defaultInteractionAggregation)
+	if expect := failedFactor * (1 - forgiveness.Rate); info.FailedInteractionFactor != expect {
+		t.Errorf("failed factor not forgiven after threshold. Got %v, Expect %v", info.FailedInteractionFactor, expect)
+	}
+}
+
+// TestStorageHostManager_SetInteractionForgiveness test StorageHostManager.SetInteractionForgiveness
+func TestStorageHostManager_SetInteractionForgiveness(t *testing.T) {
+	tests := []struct {
+		threshold int
+		rate      float64
+		valid     bool
+	}{
+		{0, 0, true},
+		{defaultForgivenessSuccessThreshold, defaultForgivenessRate, true},
+		{maxNumInteractionRecord, 1, true},
+		{-1, 0.1, false},
+		{maxNumInteractionRecord + 1, 0.1, false},
+		{10, -0.1, false},
+		{10, 1.1, false},
+	}
+	for index, test := range tests {
+		shm := &StorageHostManager{forgiveness: defaultInteractionForgiveness}
+		err := shm.SetInteractionForgiveness(test.threshold, test.rate)
+		if (err == nil) != test.valid {
+			t.Errorf("test %d: validity not expected. Got err %v, Expect valid %v", index, err, test.valid)
+			continue
+		}
+		expect := defaultInteractionForgiveness
+		if test.valid {
+			expect = InteractionForgiveness{SuccessThreshold: test.threshold, Rate: test.rate}
+		}
+		if got := shm.RetrieveInteractionForgiveness(); got != expect {
+			t.Errorf("test %d: forgiveness not expected. Got %v, Expect %v", index, got, expect)
+		}
+	}
+}
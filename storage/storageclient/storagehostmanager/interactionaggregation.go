@@ -0,0 +1,82 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// InteractionAggregation is the policy to aggregate the host interaction records. The most
+// recent records within Window are kept in detail, bounded by maxNumInteractionRecord. The
+// older records are aggregated into time buckets of BucketSize, which keep the success and
+// failure counts and weights of the interactions. At most maxNumInteractionBucket buckets
+// are kept.
+type InteractionAggregation struct {
+	// Window is the duration in which the interaction records are kept in detail. Value 0
+	// denotes the detailed records are only bounded by number
+	Window time.Duration `json:"window"`
+
+	// BucketSize is the duration of a time bucket the records are aggregated into
+	BucketSize time.Duration `json:"bucketSize"`
+}
+
+// defaultInteractionAggregation is the default aggregation policy used by storage host manager
+var defaultInteractionAggregation = InteractionAggregation{
+	Window:     defaultInteractionWindow,
+	BucketSize: defaultInteractionBucketSize,
+}
+
+// validate checks whether the aggregation policy is valid
+func (a InteractionAggregation) validate() error {
+	if a.Window < 0 {
+		return errors.New("window shall not be negative")
+	}
+	if a.BucketSize < time.Second {
+		return errors.New("bucket size shall be at least one second")
+	}
+	return nil
+}
+
+// aggregateInteractionRecords folds the interaction records beyond the detailed window or the
+// maximum number into the time buckets
+func aggregateInteractionRecords(info *storage.HostInfo, now uint64, aggregation InteractionAggregation) {
+	var numAggregated int
+	for _, record := range info.InteractionRecords {
+		overflow := len(info.InteractionRecords)-numAggregated > maxNumInteractionRecord
+		expired := aggregation.Window > 0 && time.Unix(int64(now), 0).Sub(record.Time) > aggregation.Window
+		if !overflow && !expired {
+			break
+		}
+		addInteractionToBucket(info, record, aggregation.BucketSize)
+		numAggregated++
+	}
+	info.InteractionRecords = info.InteractionRecords[numAggregated:]
+	if len(info.InteractionBuckets) > maxNumInteractionBucket {
+		info.InteractionBuckets = info.InteractionBuckets[len(info.InteractionBuckets)-maxNumInteractionBucket:]
+	}
+}
+
+// addInteractionToBucket add the interaction record to the bucket it belongs to. Since the
+// records are aggregated in time order, only the last bucket is checked
+func addInteractionToBucket(info *storage.HostInfo, record storage.HostInteractionRecord, bucketSize time.Duration) {
+	start := record.Time.Truncate(bucketSize)
+	numBuckets := len(info.InteractionBuckets)
+	if numBuckets == 0 || info.InteractionBuckets[numBuckets-1].Start.Before(start) {
+		info.InteractionBuckets = append(info.InteractionBuckets, storage.HostInteractionBucket{Start: start})
+		numBuckets++
+	}
+	bucket := &info.InteractionBuckets[numBuckets-1]
+	weight := interactionWeight(InteractionNameToType(record.InteractionType))
+	if record.Success {
+		bucket.Successes++
+		bucket.SuccessWeight += weight
+	} else {
+		bucket.Failures++
+		bucket.FailedWeight += weight
+	}
+}
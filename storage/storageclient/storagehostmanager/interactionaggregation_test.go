@@ -0,0 +1,124 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestInteractionAggregation test that after many interactions, the records beyond the detailed
+// window are aggregated into the time buckets without losing the counts and weights, and the
+// interaction factors are the same as calculated from the full interaction history
+func TestInteractionAggregation(t *testing.T) {
+	aggregation := InteractionAggregation{Window: time.Hour, BucketSize: time.Hour}
+	info := storage.HostInfo{}
+	interactionInitiate(&info)
+	now := info.LastInteractionTime
+	expectSuccess, expectFailed := info.SuccessfulInteractionFactor, info.FailedInteractionFactor
+
+	// interact every 10 minutes for 3 days, failing each fourth download
+	numInteractions := 3 * 24 * 6
+	var successWeight, failedWeight float64
+	for i := 0; i != numInteractions; i++ {
+		now += uint64(10 * time.Minute / time.Second)
+		it, success := InteractionGetConfig, true
+		if i%2 == 0 {
+			it, success = InteractionDownload, i%8 != 0
+		}
+		info = calcInteractionUpdate(info, it, success, now, InteractionForgiveness{}, aggregation)
+
+		decay := math.Pow(interactionDecay, float64(10*time.Minute/time.Second))
+		expectSuccess, expectFailed = expectSuccess*decay, expectFailed*decay
+		if success {
+			expectSuccess += interactionWeight(it)
+			successWeight += interactionWeight(it)
+		} else {
+			expectFailed += interactionWeight(it)
+			failedWeight += interactionWeight(it)
+		}
+	}
+
+	// the old records are bucketed
+	if len(info.InteractionRecords) > maxNumInteractionRecord {
+		t.Errorf("detailed records %v exceed %v", len(info.InteractionRecords), maxNumInteractionRecord)
+	}
+	for _, record := range info.InteractionRecords {
+		if time.Unix(int64(now), 0).Sub(record.Time) > aggregation.Window {
+			t.Errorf("record at %v beyond the detailed window", record.Time)
+		}
+	}
+	if len(info.InteractionBuckets) == 0 || len(info.InteractionBuckets) > maxNumInteractionBucket {
+		t.Fatalf("unexpected number of buckets %v", len(info.InteractionBuckets))
+	}
+	var numRecorded uint64
+	var gotSuccessWeight, gotFailedWeight float64
+	for i, bucket := range info.InteractionBuckets {
+		if !bucket.Start.Equal(bucket.Start.Truncate(aggregation.BucketSize)) {
+			t.Errorf("bucket %d start %v not aligned", i, bucket.Start)
+		}
+		if i > 0 && !info.InteractionBuckets[i-1].Start.Before(bucket.Start) {
+			t.Errorf("bucket %d not in time order", i)
+		}
+		numRecorded += bucket.Successes + bucket.Failures
+		gotSuccessWeight += bucket.SuccessWeight
+		gotFailedWeight += bucket.FailedWeight
+	}
+	for _, record := range info.InteractionRecords {
+		numRecorded++
+		weight := interactionWeight(InteractionNameToType(record.InteractionType))
+		if record.Success {
+			gotSuccessWeight += weight
+		} else {
+			gotFailedWeight += weight
+		}
+	}
+	if numRecorded != uint64(numInteractions) {
+		t.Errorf("expect %v interactions recorded, got %v", numInteractions, numRecorded)
+	}
+	if gotSuccessWeight != successWeight || gotFailedWeight != failedWeight {
+		t.Errorf("weights not preserved. Got %v / %v, Expect %v / %v", gotSuccessWeight, gotFailedWeight,
+			successWeight, failedWeight)
+	}
+
+	// the decayed factors are not affected by the aggregation
+	if math.Abs(info.SuccessfulInteractionFactor-expectSuccess) > 1e-6*expectSuccess {
+		t.Errorf("successful factor not expected. Got %v, Expect %v", info.SuccessfulInteractionFactor, expectSuccess)
+	}
+	if math.Abs(info.FailedInteractionFactor-expectFailed) > 1e-6*expectFailed {
+		t.Errorf("failed factor not expected. Got %v, Expect %v", info.FailedInteractionFactor, expectFailed)
+	}
+}
+
+// TestStorageHostManager_SetInteractionAggregation test StorageHostManager.SetInteractionAggregation
+func TestStorageHostManager_SetInteractionAggregation(t *testing.T) {
+	tests := []struct {
+		window     time.Duration
+		bucketSize time.Duration
+		valid      bool
+	}{
+		{defaultInteractionWindow, defaultInteractionBucketSize, true},
+		{0, time.Second, true},
+		{-time.Hour, time.Hour, false},
+		{time.Hour, time.Millisecond, false},
+	}
+	for index, test := range tests {
+		shm := &StorageHostManager{aggregation: defaultInteractionAggregation}
+		err := shm.SetInteractionAggregation(test.window, test.bucketSize)
+		if (err == nil) != test.valid {
+			t.Errorf("test %d: validity not expected. Got error %v, Expect valid %v", index, err, test.valid)
+		}
+		expect := defaultInteractionAggregation
+		if test.valid {
+			expect = InteractionAggregation{Window: test.window, BucketSize: test.bucketSize}
+		}
+		if got := shm.RetrieveInteractionAggregation(); got != expect {
+			t.Errorf("test %d: aggregation not expected. Got %+v, Expect %+v", index, got, expect)
+		}
+	}
+}
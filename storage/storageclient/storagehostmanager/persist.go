@@ -30,6 +30,10 @@ type persistence struct {
 	IPViolationCheck bool
 	FilteredHosts    map[enode.ID]struct{}
 	FilterMode       FilterMode
+	Forgiveness      InteractionForgiveness
+	Aggregation      InteractionAggregation
+	URLChangePolicy  URLChangePolicy
+	MinEvaluation    int64
 }
 
 // saveSettings will save the storage host configurations into the JSON file
@@ -47,6 +51,10 @@ func (shm *StorageHostManager) persistUpdate() (persist persistence) {
 		IPViolationCheck: shm.ipViolationCheck,
 		FilteredHosts:    shm.filteredHosts,
 		FilterMode:       shm.filterMode,
+		Forgiveness:      shm.forgiveness,
+		Aggregation:      shm.aggregation,
+		URLChangePolicy:  shm.urlChangePolicy,
+		MinEvaluation:    shm.minEvaluation,
 	}
 }
 
@@ -85,6 +93,9 @@ func (shm *StorageHostManager) loadSettings() error {
 
 	var persist persistence
 	persist.FilteredHosts = make(map[enode.ID]struct{})
+	persist.Forgiveness = shm.forgiveness
+	persist.Aggregation = shm.aggregation
+	persist.URLChangePolicy = shm.urlChangePolicy
 
 	err = common.LoadDxJSON(settingsMetadata, filepath.Join(shm.persistDir, PersistFilename), &persist)
 	if err != nil {
@@ -97,6 +108,18 @@ func (shm *StorageHostManager) loadSettings() error {
 	shm.ipViolationCheck = persist.IPViolationCheck
 	shm.filteredHosts = persist.FilteredHosts
 	shm.filterMode = persist.FilterMode
+	if err := persist.Forgiveness.validate(); err == nil {
+		shm.forgiveness = persist.Forgiveness
+	}
+	if err := persist.Aggregation.validate(); err == nil {
+		shm.aggregation = persist.Aggregation
+	}
+	if err := persist.URLChangePolicy.validate(); err == nil {
+		shm.urlChangePolicy = persist.URLChangePolicy
+	}
+	if persist.MinEvaluation >= 0 {
+		shm.minEvaluation = persist.MinEvaluation
+	}
 
 	// update the storage host tree
 	for _, info := range persist.StorageHostsInfo {
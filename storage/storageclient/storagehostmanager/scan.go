@@ -220,6 +220,11 @@ func (shm *StorageHostManager) scanExecute(scanWorker <-chan storage.HostInfo) {
 // scanAndUpdateHostConfig will connect to the host, grabbing the settings,
 // and update the host pool
 func (shm *StorageHostManager) scanAndUpdateHostConfig(hi storage.HostInfo) {
+	// the host might have changed its enode URL since it is added to the scan wait list,
+	// connect to the latest address of the host
+	if stored, exist := shm.storageHostTree.RetrieveHostInfo(hi.EnodeID); exist {
+		hi.EnodeURL, hi.IP = stored.EnodeURL, stored.IP
+	}
 	shm.log.Info("Started updating the storage host", "Host ID", hi.EnodeURL)
 
 	// get the IP network and check if it is changed
@@ -260,6 +265,17 @@ func (shm *StorageHostManager) scanAndUpdateHostConfig(hi storage.HostInfo) {
 func (shm *StorageHostManager) retrieveHostConfig(hi storage.HostInfo) (storage.HostExtConfig, error) {
 	var config storage.HostExtConfig
 
+	// fast-fail the dead host before requesting the host setting
+	if hi.Capabilities.SupportFeature(storage.FeaturePing) {
+		sp, err := shm.b.SetupConnection(hi.EnodeURL)
+		if err != nil {
+			return config, err
+		}
+		if err = sp.Ping(); err != nil {
+			return config, fmt.Errorf("storage host not responding: %v", err)
+		}
+	}
+
 	// send message, and get host setting
 	err := shm.b.GetStorageHostSetting(hi.EnodeID, hi.EnodeURL, &config)
 	return config, err
@@ -309,6 +309,10 @@ func (st *storageClientBackendTestData) GetPaymentAddress() (common.Address, err
 	return common.Address{}, nil
 }
 
+func (st *storageClientBackendTestData) GetAvailableBalance(address common.Address) (*big.Int, error) {
+	return new(big.Int), nil
+}
+
 func (st *storageClientBackendTestData) RevisionOrRenewingDone(hostID enode.ID) {}
 
 func (st *storageClientBackendTestData) CheckAndUpdateConnection(peerNode *enode.Node) {}
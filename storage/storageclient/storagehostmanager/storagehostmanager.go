@@ -12,6 +12,7 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/threadmanager"
@@ -21,6 +22,10 @@ import (
 	"github.com/DxChainNetwork/godx/storage/storageclient/storagehosttree"
 )
 
+// errTooFewQualifiedHosts is the warning when too few hosts qualify the minimum evaluation to
+// be selected for new contracts
+var errTooFewQualifiedHosts = errors.New("too few storage hosts qualify the minimum evaluation")
+
 // StorageHostManager contains necessary fields that are used to manage storage hosts
 // establishing connection with them and getting their settings
 type StorageHostManager struct {
@@ -35,6 +40,19 @@ type StorageHostManager struct {
 	// ip violation check
 	ipViolationCheck bool
 
+	// forgiveness is the policy to forgive failed interactions of recovered hosts
+	forgiveness InteractionForgiveness
+
+	// aggregation is the policy to aggregate the interaction records into time buckets
+	aggregation InteractionAggregation
+
+	// urlChangePolicy is the policy to handle the hosts changing their enode URL
+	urlChangePolicy URLChangePolicy
+
+	// minEvaluation is the minimum evaluation of a host to be selected for new contracts.
+	// 0 means no minimum
+	minEvaluation int64
+
 	// maintenance related
 	// initialScanFinished is atomic value to denote the status whether the initial scan has been
 	// finished. Initialized to value 0, and changed value to 1 when initial scan is finished.
@@ -69,11 +87,14 @@ type StorageHostManager struct {
 func New(persistDir string) *StorageHostManager {
 	// initialization
 	shm := &StorageHostManager{
-		persistDir:    persistDir,
-		rent:          storage.DefaultRentPayment,
-		scanLookup:    make(map[enode.ID]struct{}),
-		filterMode:    DisableFilter,
-		filteredHosts: make(map[enode.ID]struct{}),
+		persistDir:      persistDir,
+		rent:            storage.DefaultRentPayment,
+		scanLookup:      make(map[enode.ID]struct{}),
+		filterMode:      DisableFilter,
+		filteredHosts:   make(map[enode.ID]struct{}),
+		forgiveness:     defaultInteractionForgiveness,
+		aggregation:     defaultInteractionAggregation,
+		urlChangePolicy: defaultURLChangePolicy,
 	}
 
 	shm.hostEvaluator = newDefaultEvaluator(shm, shm.rent)
@@ -236,6 +257,100 @@ func (shm *StorageHostManager) RetrieveIPViolationCheckSetting() (violationCheck
 	return shm.ipViolationCheck
 }
 
+// SetInteractionForgiveness will set the forgiveness policy of failed interactions. After
+// a host achieves successThreshold consecutive successful interactions, each further success
+// forgives a fraction of rate from its failed interaction factor. Set successThreshold to 0
+// to disable the forgiveness
+func (shm *StorageHostManager) SetInteractionForgiveness(successThreshold int, rate float64) error {
+	forgiveness := InteractionForgiveness{
+		SuccessThreshold: successThreshold,
+		Rate:             rate,
+	}
+	if err := forgiveness.validate(); err != nil {
+		return err
+	}
+	shm.lock.Lock()
+	defer shm.lock.Unlock()
+	shm.forgiveness = forgiveness
+	return nil
+}
+
+// RetrieveInteractionForgiveness will return the current forgiveness policy of failed interactions
+func (shm *StorageHostManager) RetrieveInteractionForgiveness() InteractionForgiveness {
+	shm.lock.RLock()
+	defer shm.lock.RUnlock()
+	return shm.forgiveness
+}
+
+// SetInteractionAggregation will set the policy to aggregate the interaction records. The records
+// within the window are kept in detail, and the older ones are aggregated into time buckets of
+// bucketSize. Set window to 0 to keep the most recent records in detail regardless of their time
+func (shm *StorageHostManager) SetInteractionAggregation(window, bucketSize time.Duration) error {
+	aggregation := InteractionAggregation{
+		Window:     window,
+		BucketSize: bucketSize,
+	}
+	if err := aggregation.validate(); err != nil {
+		return err
+	}
+	shm.lock.Lock()
+	defer shm.lock.Unlock()
+	shm.aggregation = aggregation
+	return nil
+}
+
+// RetrieveInteractionAggregation will return the current policy to aggregate the interaction records
+func (shm *StorageHostManager) RetrieveInteractionAggregation() InteractionAggregation {
+	shm.lock.RLock()
+	defer shm.lock.RUnlock()
+	return shm.aggregation
+}
+
+// SetURLChangePolicy will set the policy to handle the hosts changing their enode URL. A host
+// changing its URL more than maxChanges times within the window is flagged as suspicious, and
+// its URL is kept unchanged if freezeSuspicious is set. Set maxChanges to 0 to disable the check
+func (shm *StorageHostManager) SetURLChangePolicy(maxChanges int, window time.Duration, freezeSuspicious bool) error {
+	policy := URLChangePolicy{
+		MaxChanges:       maxChanges,
+		Window:           window,
+		FreezeSuspicious: freezeSuspicious,
+	}
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	shm.lock.Lock()
+	defer shm.lock.Unlock()
+	shm.urlChangePolicy = policy
+	return nil
+}
+
+// RetrieveURLChangePolicy will return the current policy to handle the hosts changing their enode URL
+func (shm *StorageHostManager) RetrieveURLChangePolicy() URLChangePolicy {
+	shm.lock.RLock()
+	defer shm.lock.RUnlock()
+	return shm.urlChangePolicy
+}
+
+// SetMinEvaluation will set the minimum evaluation of a host to be selected for new contracts.
+// Hosts evaluated below the minimum are never selected even if few hosts are available. Set
+// minEvaluation to 0 to disable the minimum
+func (shm *StorageHostManager) SetMinEvaluation(minEvaluation int64) error {
+	if minEvaluation < 0 {
+		return fmt.Errorf("minimum evaluation %v shall not be negative", minEvaluation)
+	}
+	shm.lock.Lock()
+	defer shm.lock.Unlock()
+	shm.minEvaluation = minEvaluation
+	return nil
+}
+
+// RetrieveMinEvaluation will return the current minimum evaluation of a host to be selected
+func (shm *StorageHostManager) RetrieveMinEvaluation() int64 {
+	shm.lock.RLock()
+	defer shm.lock.RUnlock()
+	return shm.minEvaluation
+}
+
 // FilterIPViolationHosts will evaluate the storage hosts passed in. For hosts located under the same
 // network, it will be considered as badHosts if the IPViolation is enabled
 func (shm *StorageHostManager) FilterIPViolationHosts(hostIDs []enode.ID) (badHostIDs []enode.ID) {
@@ -279,12 +394,24 @@ func (shm *StorageHostManager) FilterIPViolationHosts(hostIDs []enode.ID) (badHo
 	return
 }
 
-// RetrieveRandomHosts will randomly select storage hosts from the storage host pool
-//  1. blacklist represents the storage host that are prohibited to be selected
-//  2. addrBlacklist represents for any storage host whose network address is caontine
+// RetrieveRandomHosts will randomly select storage hosts from the storage host pool. Hosts
+// evaluated below the minimum evaluation are never selected, and a warning is logged if
+// too few hosts qualify
 func (shm *StorageHostManager) RetrieveRandomHosts(num int, blacklist, addrBlacklist []enode.ID) (infos []storage.HostInfo, err error) {
+	infos, warning, err := shm.retrieveQualifiedHosts(num, blacklist, addrBlacklist)
+	if warning != nil {
+		shm.log.Warn("Storage host selection", "warning", warning)
+	}
+	return
+}
+
+// retrieveQualifiedHosts randomly selects storage hosts evaluated no lower than the minimum
+// evaluation. If fewer hosts than needed are selected because of the minimum evaluation, a
+// warning wrapping errTooFewQualifiedHosts is returned
+func (shm *StorageHostManager) retrieveQualifiedHosts(num int, blacklist, addrBlacklist []enode.ID) (infos []storage.HostInfo, warning error, err error) {
 	shm.lock.RLock()
 	ipCheck := shm.ipViolationCheck
+	minEvaluation := shm.minEvaluation
 	shm.lock.RUnlock()
 
 	// if the initialize scan is not complete
@@ -293,6 +420,18 @@ func (shm *StorageHostManager) RetrieveRandomHosts(num int, blacklist, addrBlack
 		return
 	}
 
+	// blacklist the hosts evaluated below the minimum evaluation
+	var belowMinimum int
+	if minEvaluation > 0 {
+		blacklist = append([]enode.ID{}, blacklist...)
+		for _, info := range shm.filteredTree.All() {
+			if eval, exist := shm.filteredTree.RetrieveHostEval(info.EnodeID); exist && eval < minEvaluation {
+				blacklist = append(blacklist, info.EnodeID)
+				belowMinimum++
+			}
+		}
+	}
+
 	// select random
 	if ipCheck {
 		infos = shm.filteredTree.SelectRandom(num, blacklist, addrBlacklist)
@@ -300,6 +439,10 @@ func (shm *StorageHostManager) RetrieveRandomHosts(num int, blacklist, addrBlack
 		infos = shm.filteredTree.SelectRandom(num, blacklist, nil)
 	}
 
+	if belowMinimum > 0 && len(infos) < num {
+		warning = fmt.Errorf("%v: %v hosts selected out of %v needed, %v hosts evaluated below the minimum evaluation %v",
+			errTooFewQualifiedHosts, len(infos), num, belowMinimum, minEvaluation)
+	}
 	return
 }
 
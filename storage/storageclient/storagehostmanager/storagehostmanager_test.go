@@ -6,6 +6,7 @@ package storagehostmanager
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -170,3 +171,64 @@ func TestStorageHostManager_finishInitialScan(t *testing.T) {
 		}
 	}
 }
+
+// TestStorageHostManager_RetrieveRandomHosts_MinEvaluation test that the hosts evaluated below
+// the minimum evaluation are never selected, and a warning is returned if too few hosts qualify
+func TestStorageHostManager_RetrieveRandomHosts_MinEvaluation(t *testing.T) {
+	shm := newHostManagerTestData()
+	shm.finishInitialScan()
+
+	// a pool of 2 qualified hosts and 6 low scoring hosts
+	minEvaluation := int64(100)
+	qualified := make(map[enode.ID]struct{})
+	for i := 0; i != 8; i++ {
+		info := hostInfoGeneratorForIPViolation(fmt.Sprintf("%v.1.1.1", 10+i), time.Now())
+		info.ScanRecords = storage.HostPoolScans{storage.HostPoolScan{Timestamp: time.Now(), Success: true}}
+		eval := minEvaluation / 10
+		if i < 2 {
+			eval = minEvaluation * 10
+			qualified[info.EnodeID] = struct{}{}
+		}
+		if err := shm.storageHostTree.Insert(info, eval); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without the minimum evaluation, low scoring hosts are selected in a thin pool
+	infos, warning, err := shm.retrieveQualifiedHosts(5, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 5 || warning != nil {
+		t.Fatalf("expect 5 hosts selected without warning, got %v hosts, warning %v", len(infos), warning)
+	}
+
+	if err = shm.SetMinEvaluation(-1); err == nil {
+		t.Fatal("negative minimum evaluation shall be rejected")
+	}
+	if err = shm.SetMinEvaluation(minEvaluation); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i != 10; i++ {
+		infos, warning, err = shm.retrieveQualifiedHosts(5, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(infos) != len(qualified) {
+			t.Fatalf("expect %v hosts selected, got %v", len(qualified), len(infos))
+		}
+		for _, info := range infos {
+			if _, exist := qualified[info.EnodeID]; !exist {
+				t.Fatalf("host %v below the minimum evaluation selected", info.EnodeID)
+			}
+		}
+		if warning == nil || !strings.Contains(warning.Error(), errTooFewQualifiedHosts.Error()) {
+			t.Fatalf("expect warning %v, got %v", errTooFewQualifiedHosts, warning)
+		}
+	}
+
+	// no warning if enough hosts qualify
+	if infos, warning, err = shm.retrieveQualifiedHosts(2, nil, nil); err != nil || warning != nil || len(infos) != 2 {
+		t.Fatalf("expect 2 hosts selected without warning, got %v hosts, warning %v, err %v", len(infos), warning, err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// RecordStorageProbe records the result of probing the host's ability to accept a sector.
+// If the host rejected the sector while advertising enough remaining storage, the host is
+// regarded as over-reporting its remaining storage. The believed remaining storage of the
+// host is discounted for each consecutive over-report, and a failed interaction is recorded.
+func (shm *StorageHostManager) RecordStorageProbe(id enode.ID, accepted bool) error {
+	shm.lock.Lock()
+	defer shm.lock.Unlock()
+
+	info, exist := shm.storageHostTree.RetrieveHostInfo(id)
+	if !exist {
+		return fmt.Errorf("failed to retrive host info [%v]", id)
+	}
+	overReported := !accepted && info.RemainingStorage >= storage.SectorSize
+	if !accepted && !overReported {
+		// The host honestly advertised not having enough storage. No penalty applied
+		return nil
+	}
+	info = calcStorageProbeUpdate(info, accepted)
+	info = calcInteractionUpdate(info, InteractionStorageProbe, accepted, uint64(time.Now().Unix()), shm.forgiveness, shm.aggregation)
+	if overReported {
+		shm.log.Warn("host over-reported the remaining storage", "host", id, "remainingStorage",
+			info.RemainingStorage, "overReports", info.StorageOverReports)
+	}
+	if err := shm.modify(info); err != nil {
+		return fmt.Errorf("failed to update host info: %v", err)
+	}
+	return nil
+}
+
+// calcStorageProbeUpdate update the StorageOverReports of the host info with the probe result
+func calcStorageProbeUpdate(info storage.HostInfo, accepted bool) storage.HostInfo {
+	if accepted {
+		info.StorageOverReports = 0
+	} else {
+		info.StorageOverReports++
+	}
+	return info
+}
+
+// believedRemainingStorage returns the remaining storage of the host the client believes.
+// The advertised remaining storage is discounted by storageOverReportDiscount for each
+// consecutive over-report
+func believedRemainingStorage(info storage.HostInfo) float64 {
+	discount := math.Pow(storageOverReportDiscount, float64(info.StorageOverReports))
+	return float64(info.RemainingStorage) * discount
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"testing"
+
+	"github.com/DxChainNetwork/godx/log"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/storagehosttree"
+)
+
+// TestStorageHostManager_RecordStorageProbe test that a host over-reporting its remaining storage
+// is detected and penalized by the storage probes
+func TestStorageHostManager_RecordStorageProbe(t *testing.T) {
+	tests := []struct {
+		remainingStorage uint64
+		penalized        bool
+	}{
+		// the host over-reports the remaining storage
+		{1 << 40, true},
+		// the host honestly reports not having enough storage
+		{0, false},
+	}
+	for index, test := range tests {
+		enodeID := enode.ID{1, 2, 3, 4}
+		shm := newStorageProbeTester(t, enodeID, test.remainingStorage)
+		prevInfo, _ := shm.storageHostTree.RetrieveHostInfo(enodeID)
+		prevScore := storageProbeScore(shm, prevInfo)
+
+		// the host consistently rejects the probe sector
+		for i := 0; i != 3; i++ {
+			if err := shm.RecordStorageProbe(enodeID, false); err != nil {
+				t.Fatalf("test %d: failed to record storage probe: %v", index, err)
+			}
+			info, _ := shm.storageHostTree.RetrieveHostInfo(enodeID)
+			score := storageProbeScore(shm, info)
+
+			if !test.penalized {
+				if info.StorageOverReports != 0 || score != prevScore {
+					t.Errorf("test %d: honest host penalized. Over reports %v, score %v -> %v", index,
+						info.StorageOverReports, prevScore, score)
+				}
+				continue
+			}
+			if info.StorageOverReports != uint64(i+1) {
+				t.Errorf("test %d: over reports not expected. Got %v, Expect %v", index, info.StorageOverReports, i+1)
+			}
+			if believed := believedRemainingStorage(info); believed >= float64(info.RemainingStorage) {
+				t.Errorf("test %d: believed remaining storage not discounted: %v", index, believed)
+			}
+			if score >= prevScore {
+				t.Errorf("test %d: host score shall decrease after over-reporting: %v -> %v", index, prevScore, score)
+			}
+			prevScore = score
+		}
+	}
+}
+
+// TestStorageHostManager_RecordStorageProbeAccepted test that an accepted probe resets the
+// over reports of the host
+func TestStorageHostManager_RecordStorageProbeAccepted(t *testing.T) {
+	enodeID := enode.ID{1, 2, 3, 4}
+	shm := newStorageProbeTester(t, enodeID, 1<<40)
+	if err := shm.RecordStorageProbe(enodeID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := shm.RecordStorageProbe(enodeID, true); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := shm.storageHostTree.RetrieveHostInfo(enodeID)
+	if info.StorageOverReports != 0 {
+		t.Errorf("after probe accepted, over reports shall be reset. Got %v", info.StorageOverReports)
+	}
+	if believed := believedRemainingStorage(info); believed != float64(info.RemainingStorage) {
+		t.Errorf("believed remaining storage not expected. Got %v, Expect %v", believed, info.RemainingStorage)
+	}
+	if err := shm.RecordStorageProbe(enode.ID{5, 6}, true); err == nil {
+		t.Errorf("recording probe of non-exist host shall return error")
+	}
+}
+
+// storageProbeScore returns the product of the scores affected by the storage probe
+func storageProbeScore(shm *StorageHostManager, info storage.HostInfo) float64 {
+	detail := shm.hostEvaluator.EvaluateDetail(info)
+	return detail.StorageRemainingScore * detail.InteractionScore
+}
+
+// newStorageProbeTester creates a storage host manager with a host of the given remaining storage
+func newStorageProbeTester(t *testing.T, enodeID enode.ID, remainingStorage uint64) *StorageHostManager {
+	shm := &StorageHostManager{
+		log:           log.New(),
+		filteredHosts: make(map[enode.ID]struct{}),
+	}
+	shm.hostEvaluator = newDefaultEvaluator(shm, storage.DefaultRentPayment)
+	shm.storageHostTree = storagehosttree.New()
+	shm.filteredTree = shm.storageHostTree
+	info := storage.HostInfo{
+		EnodeID: enodeID,
+		HostExtConfig: storage.HostExtConfig{
+			RemainingStorage: remainingStorage,
+		},
+		SuccessfulInteractionFactor: 10,
+		FailedInteractionFactor:     0,
+	}
+	if err := shm.storageHostTree.Insert(info, shm.hostEvaluator.Evaluate(info)); err != nil {
+		t.Fatal("cannot insert into the storage host tree: ", err)
+	}
+	return shm
+}
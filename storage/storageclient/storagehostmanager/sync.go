@@ -118,9 +118,18 @@ func (shm *StorageHostManager) insertStorageHostInformation(info storage.HostInf
 		return
 	}
 
-	// if the storage host information already existed, update the settings
-	oldInfo.EnodeURL = info.EnodeURL
-	oldInfo.IP = info.IP
+	// if the storage host information already existed, the host is matched by the enode ID
+	// derived from its public key. The reputation of the host is preserved, and the new
+	// enode URL is followed according to the url change policy
+	shm.lock.RLock()
+	policy := shm.urlChangePolicy
+	shm.lock.RUnlock()
+	oldURL := oldInfo.EnodeURL
+	oldInfo, followed := calcEnodeURLUpdate(oldInfo, info, policy, time.Now())
+	if oldInfo.SuspiciousURLChange {
+		shm.log.Warn("storage host changed enode url too often", "enodeID", info.EnodeID,
+			"old", oldURL, "new", info.EnodeURL, "followed", followed)
+	}
 
 	// check if the ip address has been changed, if so, update the IP network field
 	// and update the LastIPNetWorkChange time
@@ -27,6 +27,24 @@ func getHostUpRate(info storage.HostInfo) float64 {
 	return info.AccumulatedUptime / (info.AccumulatedUptime + info.AccumulatedDowntime)
 }
 
+// HostFailureRate returns the observed failure rate of the host pool, which is the average
+// downtime rate of the scanned hosts. Return false if no host has been scanned
+func (shm *StorageHostManager) HostFailureRate() (float64, bool) {
+	var sum float64
+	var num int
+	for _, info := range shm.storageHostTree.All() {
+		if len(info.ScanRecords) == 0 {
+			continue
+		}
+		sum += 1 - getHostUpRate(info)
+		num++
+	}
+	if num == 0 {
+		return 0, false
+	}
+	return sum / float64(num), true
+}
+
 // calcUptimeUpdate calculate the Uptime update for the host info
 func calcUptimeUpdate(info storage.HostInfo, success bool, now uint64) storage.HostInfo {
 	// Calculate the decay form time
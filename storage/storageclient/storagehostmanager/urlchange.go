@@ -0,0 +1,88 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// URLChangePolicy is the policy to handle the storage hosts announcing a new enode URL. The
+// host is matched across the URL changes by its enode ID, which is derived from the node public
+// key, so that its reputation is preserved and the new URL is used for the connections. A host
+// changing its URL more than MaxChanges times within Window is flagged as suspicious, which
+// might be caused by identity spoofing.
+type URLChangePolicy struct {
+	// MaxChanges is the maximum number of URL changes allowed within the window before the
+	// host is flagged as suspicious. Value 0 disables the check
+	MaxChanges int `json:"maxChanges"`
+
+	// Window is the duration in which the URL changes are counted
+	Window time.Duration `json:"window"`
+
+	// FreezeSuspicious denotes whether to keep the previous URL of a host flagged as
+	// suspicious instead of following its new announcement
+	FreezeSuspicious bool `json:"freezeSuspicious"`
+}
+
+// defaultURLChangePolicy is the default URL change policy used by storage host manager
+var defaultURLChangePolicy = URLChangePolicy{
+	MaxChanges:       defaultURLChangeMaxChanges,
+	Window:           defaultURLChangeWindow,
+	FreezeSuspicious: defaultURLChangeFreezeSuspicious,
+}
+
+// validate checks whether the URL change policy is valid
+func (p URLChangePolicy) validate() error {
+	if p.MaxChanges < 0 {
+		return errors.New("max changes shall not be negative")
+	}
+	if p.MaxChanges > 0 && p.Window <= 0 {
+		return errors.New("window shall be positive")
+	}
+	return nil
+}
+
+// enabled returns whether the URL change check takes effect
+func (p URLChangePolicy) enabled() bool {
+	return p.MaxChanges > 0
+}
+
+// calcEnodeURLUpdate calculates the stored host information after the host announced the info.
+// The announced info is matched with the stored one by enode ID. The returned boolean denotes
+// whether the new URL is followed
+func calcEnodeURLUpdate(stored, announced storage.HostInfo, policy URLChangePolicy, now time.Time) (storage.HostInfo, bool) {
+	if stored.EnodeURL == announced.EnodeURL {
+		return stored, true
+	}
+	// the enode ID is derived from the public key, thus a different public key could only be
+	// caused by a corrupted record or a forged announcement
+	if len(stored.NodePubKey) != 0 && !bytes.Equal(stored.NodePubKey, announced.NodePubKey) {
+		return stored, false
+	}
+
+	// record the URL change, and flag the host if it changed too often within the window.
+	// The flag is cleared once the earlier changes are out of the window
+	stored.SuspiciousURLChange = false
+	if policy.enabled() {
+		var changes []time.Time
+		for _, change := range stored.EnodeURLChanges {
+			if now.Sub(change) < policy.Window {
+				changes = append(changes, change)
+			}
+		}
+		stored.EnodeURLChanges = append(changes, now)
+		stored.SuspiciousURLChange = len(stored.EnodeURLChanges) > policy.MaxChanges
+	}
+	if stored.SuspiciousURLChange && policy.FreezeSuspicious {
+		return stored, false
+	}
+	stored.EnodeURL = announced.EnodeURL
+	stored.IP = announced.IP
+	return stored, true
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehostmanager
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/crypto"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestStorageHostManager_insertStorageHostInformation_URLChange test a host changing its enode URL
+// but keeping its key is matched with the stored host. The reputation is preserved and the new
+// URL is used for the connection, while the rapid URL changes are flagged and frozen
+func TestStorageHostManager_insertStorageHostInformation_URLChange(t *testing.T) {
+	shm := newHostManagerTestData()
+	backend := &urlRecordingBackend{storageClientBackendTestData: &storageClientBackendTestData{}}
+	shm.b = backend
+	// keep the hosts in the scan wait list
+	shm.scanWait = true
+	shm.urlChangePolicy = URLChangePolicy{MaxChanges: 2, Window: time.Hour, FreezeSuspicious: true}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	announce := func(ip string) string {
+		url := enode.NewV4(&key.PublicKey, net.ParseIP(ip), 30303, 30303).String()
+		info, err := parseHostAnnouncement(types.HostAnnouncement{NetAddress: url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		shm.insertStorageHostInformation(info)
+		return url
+	}
+	url1 := announce("10.0.0.1")
+	stored, exist := shm.storageHostTree.RetrieveHostInfo(enode.PubkeyToIDV4(&key.PublicKey))
+	if !exist {
+		t.Fatal("host not inserted")
+	}
+	id := stored.EnodeID
+
+	// the host has earned some reputation
+	stored.SuccessfulInteractionFactor = 20
+	stored.FailedInteractionFactor = 1
+	stored.AccumulatedUptime = 1000
+	stored.FirstSeen = 10
+	if err = shm.modify(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	url2 := announce("10.0.0.2")
+	if url2 == url1 {
+		t.Fatal("the enode url not changed")
+	}
+	changed, _ := shm.storageHostTree.RetrieveHostInfo(id)
+	if changed.EnodeURL != url2 || changed.IP != "10.0.0.2" {
+		t.Errorf("new url not stored: expect %v, got %v", url2, changed.EnodeURL)
+	}
+	if changed.SuccessfulInteractionFactor != stored.SuccessfulInteractionFactor ||
+		changed.FailedInteractionFactor != stored.FailedInteractionFactor ||
+		changed.AccumulatedUptime != stored.AccumulatedUptime || changed.FirstSeen != stored.FirstSeen {
+		t.Errorf("reputation not preserved after url change")
+	}
+	if changed.SuspiciousURLChange {
+		t.Errorf("single url change flagged as suspicious")
+	}
+	if shm.storageHostTree.All()[0].EnodeID != id || len(shm.storageHostTree.All()) != 1 {
+		t.Errorf("url change shall not be treated as a new host")
+	}
+
+	// rapid url changes beyond the limit are flagged and not followed
+	url3 := announce("10.0.0.3")
+	announce("10.0.0.4")
+	frozen, _ := shm.storageHostTree.RetrieveHostInfo(id)
+	if !frozen.SuspiciousURLChange {
+		t.Errorf("rapid url changes not flagged")
+	}
+	if frozen.EnodeURL != url3 || frozen.IP != "10.0.0.3" {
+		t.Errorf("url of suspicious host not frozen: expect %v, got %v", url3, frozen.EnodeURL)
+	}
+
+	// the scan queued with the old url connects to the new url
+	if len(shm.scanWaitList) != 1 || shm.scanWaitList[0].EnodeURL != url1 {
+		t.Fatalf("unexpected scan wait list: %v", shm.scanWaitList)
+	}
+	shm.scanAndUpdateHostConfig(shm.scanWaitList[0])
+	if len(backend.urls) != 1 || backend.urls[0] != url3 {
+		t.Errorf("expect connection to %v, got %v", url3, backend.urls)
+	}
+}
+
+// TestCalcEnodeURLUpdate_Window test the url changes out of the window are not counted, and the
+// suspicious flag is cleared after the window
+func TestCalcEnodeURLUpdate_Window(t *testing.T) {
+	policy := URLChangePolicy{MaxChanges: 1, Window: time.Hour, FreezeSuspicious: true}
+	now := time.Now()
+	info := storage.HostInfo{EnodeURL: "url0", IP: "ip0"}
+
+	info, followed := calcEnodeURLUpdate(info, storage.HostInfo{EnodeURL: "url1", IP: "ip1"}, policy, now)
+	if !followed || info.SuspiciousURLChange {
+		t.Fatalf("first change not followed")
+	}
+	info, followed = calcEnodeURLUpdate(info, storage.HostInfo{EnodeURL: "url2", IP: "ip2"}, policy, now.Add(time.Minute))
+	if followed || !info.SuspiciousURLChange || info.EnodeURL != "url1" {
+		t.Fatalf("second change within window shall be frozen")
+	}
+	info, followed = calcEnodeURLUpdate(info, storage.HostInfo{EnodeURL: "url2", IP: "ip2"}, policy, now.Add(2*time.Hour))
+	if !followed || info.SuspiciousURLChange || info.EnodeURL != "url2" || info.IP != "ip2" {
+		t.Fatalf("change after window shall be followed")
+	}
+	if len(info.EnodeURLChanges) != 1 {
+		t.Errorf("expect 1 change in window, got %v", len(info.EnodeURLChanges))
+	}
+
+	// disabled policy follows every change
+	policy.MaxChanges = 0
+	for i := 0; i != 5; i++ {
+		if _, followed = calcEnodeURLUpdate(info, storage.HostInfo{EnodeURL: "url"}, policy, now); !followed {
+			t.Fatalf("change not followed with disabled policy")
+		}
+	}
+}
+
+// urlRecordingBackend records the enode URLs the storage host settings are requested with
+type urlRecordingBackend struct {
+	*storageClientBackendTestData
+	urls []string
+}
+
+func (b *urlRecordingBackend) GetStorageHostSetting(hostEnodeID enode.ID, hostEnodeURL string, config *storage.HostExtConfig) error {
+	b.urls = append(b.urls, hostEnodeURL)
+	return nil
+}
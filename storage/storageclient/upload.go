@@ -6,14 +6,17 @@ package storageclient
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"os"
 
+	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
 	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxdir"
 	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+	"golang.org/x/crypto/sha3"
 )
 
 // Upload instructs the storage client to start tracking a file. The storage client will
@@ -49,17 +52,33 @@ func (client *StorageClient) Upload(up storage.FileUploadParams) error {
 	//	}
 	//}
 
+	if err := checkSegmentOrder(up.SegmentOrder, up.SegmentPriority); err != nil {
+		return err
+	}
+
 	// Setup ECTypeStandard's ErasureCode with default params
 	if up.ErasureCode == nil {
 		up.ErasureCode, _ = erasurecode.New(erasurecode.ECTypeStandard, storage.DefaultMinSectors, storage.DefaultNumSectors)
 	}
 
+	client.lock.Lock()
+	minSegmentHosts := client.persist.MinSegmentHosts
+	deriveSectorKeys := client.persist.DeriveSectorKeys
+	client.lock.Unlock()
+	if minSegmentHosts > up.ErasureCode.NumSectors() {
+		return fmt.Errorf("min segment hosts %v larger than the number of sectors %v", minSegmentHosts, up.ErasureCode.NumSectors())
+	}
+
 	numContracts := uint64(len(client.contractManager.GetStorageContractSet().Contracts()))
 	// requiredContracts = ceil(min + redundant/2)
 	requiredContracts := math.Ceil(float64(up.ErasureCode.NumSectors()+up.ErasureCode.MinSectors()) / 2)
 	if numContracts < uint64(requiredContracts) {
 		return fmt.Errorf("not enough contracts to upload file: got %v, needed %v", numContracts, (up.ErasureCode.NumSectors()+up.ErasureCode.MinSectors())/2)
 	}
+	// the erasure code type is used only if enough hosts support it
+	if numSupported := client.numHostsSupportErasureCodeType(up.ErasureCode.Type()); numSupported < uint64(requiredContracts) {
+		return fmt.Errorf("not enough hosts supporting the erasure code type %v: got %v, needed %v", up.ErasureCode.Type(), numSupported, uint64(requiredContracts))
+	}
 
 	dirDxPath := up.DxPath
 
@@ -80,16 +99,44 @@ func (client *StorageClient) Upload(up storage.FileUploadParams) error {
 		return fmt.Errorf("generate cipher key error: %v", err)
 	}
 
+	if sourceInfo.Size() == 0 {
+		return fmt.Errorf("source file size is 0, fileName: %s", sourceInfo.Name())
+	}
+
 	// Create the DxFile and add to client
 	entry, err := client.fileSystem.NewDxFile(up.DxPath, storage.SysPath(up.Source), false, up.ErasureCode, cipherKey, uint64(sourceInfo.Size()), sourceInfo.Mode())
 
 	if err != nil {
 		return fmt.Errorf("could not create a new dx file, error: %v", err)
 	}
-	if sourceInfo.Size() == 0 {
-		return fmt.Errorf("source file size is 0, fileName: %s", sourceInfo.Name())
+	err = entry.BatchUpdate(func(b *dxfile.Batch) error {
+		if minSegmentHosts != 0 {
+			if err := b.SetMinSegmentHosts(minSegmentHosts); err != nil {
+				return fmt.Errorf("could not set the min segment hosts, error: %v", err)
+			}
+		}
+		if deriveSectorKeys {
+			if err := b.SetKeyDerivation(dxfile.KeyDerivationSector); err != nil {
+				return fmt.Errorf("could not set the key derivation, error: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		client.deleteFailedUpload(up.DxPath)
+		return err
 	}
 
+	ranks, err := segmentUploadRanks(uint64(entry.NumSegments()), up.SegmentOrder, up.SegmentPriority)
+	if err != nil {
+		client.deleteFailedUpload(up.DxPath)
+		return err
+	}
+
+	// The checksum of the whole source is calculated in the background, so that the upload
+	// of a large file is not blocked by hashing the whole content
+	go client.calculateSourceChecksum(up.DxPath, entry.UID(), up.Source)
+
 	// Update the health of the DxFile directory recursively to ensure the health is updated with the new file
 	go client.fileSystem.InitAndUpdateDirMetadata(dirDxPath)
 
@@ -98,7 +145,7 @@ func (client *StorageClient) Upload(up storage.FileUploadParams) error {
 	// Send the upload to the repair loop
 	hosts := client.refreshHostsAndWorkers()
 
-	if err := client.createAndPushSegments([]*dxfile.FileSetEntryWithID{entry}, hosts, targetUnstuckSegments, nilHostHealthInfoTable); err != nil {
+	if err := client.createAndPushOrderedSegments(entry, hosts, ranks, nilHostHealthInfoTable); err != nil {
 		return err
 	}
 
@@ -108,3 +155,59 @@ func (client *StorageClient) Upload(up storage.FileUploadParams) error {
 	}
 	return nil
 }
+
+// deleteFailedUpload deletes the dx file created by the upload failed before dispatched
+func (client *StorageClient) deleteFailedUpload(dxPath storage.DxPath) {
+	if err := client.fileSystem.DeleteDxFile(dxPath); err != nil {
+		client.log.Warn("failed to delete the dx file", "path", dxPath.Path, "err", err)
+	}
+}
+
+// calculateSourceChecksum calculates the checksum of the source of the file uploaded and set it
+// to the file. The file is deleted if the source cannot be read, since it cannot be uploaded either.
+// The file replaced at the path since the upload is left untouched
+func (client *StorageClient) calculateSourceChecksum(dxPath storage.DxPath, id dxfile.FileID, source string) {
+	if err := client.tm.Add(); err != nil {
+		return
+	}
+	defer client.tm.Done()
+
+	checksum, checksumErr := fileChecksum(source)
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return
+	}
+	if entry.UID() != id {
+		entry.Close()
+		return
+	}
+	if checksumErr != nil {
+		entry.Close()
+		client.log.Warn("could not calculate the checksum of the source file", "path", dxPath.Path, "err", checksumErr)
+		if err = client.DeleteFile(dxPath); err != nil {
+			client.log.Warn("failed to delete the dx file", "path", dxPath.Path, "err", err)
+		}
+		return
+	}
+	if err = entry.SetChecksum(checksum); err != nil {
+		client.log.Warn("could not set the checksum of the file", "path", dxPath.Path, "err", err)
+	}
+	entry.Close()
+}
+
+// fileChecksum calculates the checksum of the whole content of the file, which is used to detect
+// the files uploaded with identical content
+func fileChecksum(path string) (checksum common.Hash, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer file.Close()
+
+	h := sha3.NewLegacyKeccak256()
+	if _, err = io.Copy(h, file); err != nil {
+		return common.Hash{}, err
+	}
+	copy(checksum[:], h.Sum(nil))
+	return checksum, nil
+}
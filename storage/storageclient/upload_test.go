@@ -5,6 +5,7 @@
 package storageclient
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 	"io/ioutil"
@@ -375,6 +376,196 @@ func TestReadFromLocalFile(t *testing.T) {
 	}
 }
 
+func TestUnfinishedUploadSegment_ReleaseMemory(t *testing.T) {
+	segment := &unfinishedUploadSegment{memoryNeeded: 10000}
+
+	if released := segment.releaseMemory(6000); released != 6000 {
+		t.Fatalf("expected to release 6000, got %d", released)
+	}
+
+	// releasing more memory than requested is an accounting error, which panics in test mode
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("double release of segment memory is expected to be detected")
+		}
+		if segment.memoryReleased != 6000 {
+			t.Errorf("expected memory released 6000, got %d", segment.memoryReleased)
+		}
+	}()
+	segment.releaseMemory(6000)
+}
+
+// TestEncodeAndDispatchSegment_ShortEncode test the segment with fewer physical sectors encoded
+// than the sector slots is aborted, with all memory returned and the repair marked failed
+func TestEncodeAndDispatchSegment_ShortEncode(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	defer sct.Client.Close()
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		if err := os.Remove(string(entry.LocalPath())); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(string(entry.FilePath())); err != nil {
+			t.Fatal(err)
+		}
+		if err := entry.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	hosts := map[string]struct{}{
+		"111111": {},
+		"222222": {},
+		"333333": {},
+	}
+	mockAddWorkers(3, client)
+	unfinishedSegments, _ := client.createUnfinishedSegments(entry, hosts, targetUnstuckSegments, make(storage.HostHealthInfoTable))
+	if len(unfinishedSegments) <= 0 {
+		t.Fatal("push heap failed")
+	}
+	segment := unfinishedSegments[0]
+	client.uploadHeap.mu.Lock()
+	client.uploadHeap.pendingSegments[segment.id] = segment
+	client.uploadHeap.mu.Unlock()
+
+	available := client.memoryManager.MemoryAvailable()
+	client.memoryManager.Request(segment.memoryNeeded, true)
+	ec, err := entry.ErasureCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.encodeAndDispatchSegment(segment, &shortErasureCoder{ErasureCoder: ec})
+
+	if segment.memoryReleased != segment.memoryNeeded {
+		t.Errorf("segment memory not released: needed %v, released %v", segment.memoryNeeded, segment.memoryReleased)
+	}
+	if got := client.memoryManager.MemoryAvailable(); got != available {
+		t.Errorf("memory not returned: expect %v available, got %v", available, got)
+	}
+	if segment.sectorsUploadingNum != 0 || !segment.released {
+		t.Errorf("aborted segment not released: uploading %v, released %v", segment.sectorsUploadingNum, segment.released)
+	}
+	client.uploadHeap.mu.Lock()
+	_, pending := client.uploadHeap.pendingSegments[segment.id]
+	client.uploadHeap.mu.Unlock()
+	if pending {
+		t.Errorf("aborted segment still pending")
+	}
+	if !entry.GetStuckByIndex(int(segment.index)) {
+		t.Errorf("repair of the aborted segment not marked failed")
+	}
+}
+
+// TestEncodeAndDispatchSegment_FinalSegment test the logical data of the final partial segment is
+// zero padded beyond the end of the file before encoded, even if the local file has grown since
+func TestEncodeAndDispatchSegment_FinalSegment(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	defer sct.Client.Close()
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		if err := os.Remove(string(entry.LocalPath())); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(string(entry.FilePath())); err != nil {
+			t.Fatal(err)
+		}
+		if err := entry.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	finalLength := common.FinalSegmentLength(entry.FileSize(), entry.SegmentSize())
+	if finalLength == entry.SegmentSize() {
+		t.Fatalf("expect a partial final segment, file size %v, segment size %v", entry.FileSize(), entry.SegmentSize())
+	}
+
+	// append some data to the local file after the upload started
+	fileData, err := ioutil.ReadFile(string(entry.LocalPath()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(string(entry.LocalPath()), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write(bytes.Repeat([]byte{0xff}, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := map[string]struct{}{
+		"111111": {},
+		"222222": {},
+		"333333": {},
+	}
+	mockAddWorkers(3, client)
+	unfinishedSegments, _ := client.createUnfinishedSegments(entry, hosts, targetUnstuckSegments, make(storage.HostHealthInfoTable))
+	var segment *unfinishedUploadSegment
+	for _, s := range unfinishedSegments {
+		if s.index == uint64(entry.NumSegments()-1) {
+			segment = s
+		}
+	}
+	if segment == nil {
+		t.Fatal("final segment not created")
+	}
+	client.uploadHeap.mu.Lock()
+	client.uploadHeap.pendingSegments[segment.id] = segment
+	client.uploadHeap.mu.Unlock()
+
+	client.memoryManager.Request(segment.memoryNeeded, true)
+	ec, err := entry.ErasureCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &recordingErasureCoder{shortErasureCoder: shortErasureCoder{ErasureCoder: ec}}
+	client.encodeAndDispatchSegment(segment, recorder)
+
+	if uint64(len(recorder.data)) < finalLength {
+		t.Fatalf("expect at least %v bytes encoded, got %v", finalLength, len(recorder.data))
+	}
+	if !bytes.Equal(recorder.data[:finalLength], fileData[segment.offset:]) {
+		t.Errorf("file data of the final segment not encoded")
+	}
+	if !bytes.Equal(recorder.data[finalLength:], make([]byte, uint64(len(recorder.data))-finalLength)) {
+		t.Errorf("data beyond the end of file not zero padded")
+	}
+}
+
+// shortErasureCoder is the erasure coder which encodes one sector fewer than expected
+type shortErasureCoder struct {
+	erasurecode.ErasureCoder
+}
+
+func (ec *shortErasureCoder) Encode(data []byte) ([][]byte, error) {
+	sectors, err := ec.ErasureCoder.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	return sectors[:len(sectors)-1], nil
+}
+
+// recordingErasureCoder records the data encoded, and aborts the segment upload with a short
+// encode result
+type recordingErasureCoder struct {
+	shortErasureCoder
+	data []byte
+}
+
+func (ec *recordingErasureCoder) Encode(data []byte) ([][]byte, error) {
+	ec.data = append([]byte{}, data...)
+	return ec.shortErasureCoder.Encode(data)
+}
+
 func generateFile(t *testing.T, localFilePath string, mb int) (string, int, common.Hash) {
 	_, err := os.Stat(localFilePath)
 	if os.IsNotExist(err) {
@@ -423,3 +614,40 @@ func getDxPathFromPath(root string, path string) storage.DxPath {
 	}
 	return storage.RootDxPath()
 }
+
+// TestStorageClient_CalculateSourceChecksum test the checksum of the source is set to the file
+// uploaded, and the file is deleted if the source cannot be read
+func TestStorageClient_CalculateSourceChecksum(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	localPath := string(entry.LocalPath())
+	dxPath := entry.DxPath()
+	defer os.Remove(localPath)
+	entry.Close()
+
+	expect, err := fileChecksum(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.calculateSourceChecksum(dxPath, entry.UID(), localPath)
+	if entry, err = client.fileSystem.OpenDxFile(dxPath); err != nil {
+		t.Fatal(err)
+	}
+	if got := entry.Checksum(); got != expect {
+		t.Errorf("unexpected checksum: got %v, expect %v", got, expect)
+	}
+	entry.Close()
+
+	// the file of the source not readable is deleted
+	if err = os.Remove(localPath); err != nil {
+		t.Fatal(err)
+	}
+	client.calculateSourceChecksum(dxPath, entry.UID(), localPath)
+	if _, err = client.fileSystem.OpenDxFile(dxPath); err != dxfile.ErrUnknownFile {
+		t.Errorf("expect error %v, got %v", dxfile.ErrUnknownFile, err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"bytes"
+	"sort"
+)
+
+// uploadLoad returns the number of segments queued to the worker to be uploaded
+func (w *worker) uploadLoad() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pendingSegments)
+}
+
+// sortWorkersByContractID sorts the workers by the contract ID, which is the fixed order of the
+// workers tied in the ranking before they are rotated
+func sortWorkersByContractID(workers []*worker) {
+	sort.Slice(workers, func(i, j int) bool {
+		return bytes.Compare(workers[i].contract.ID[:], workers[j].contract.ID[:]) < 0
+	})
+}
+
+// rotateTies rotates left by the cursor each run of the consecutive elements tied in the
+// ranking, so that the elements tied take turns to come first as the cursor advances. The
+// n elements are accessed by the index, where tied reports whether two elements are tied in
+// the ranking, and swap swaps two elements
+func rotateTies(n, cursor int, tied func(i, j int) bool, swap func(i, j int)) {
+	reverse := func(start, end int) {
+		for i, j := start, end-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	for start := 0; start < n; {
+		end := start + 1
+		for end < n && tied(start, end) {
+			end++
+		}
+		if size := end - start; size > 1 {
+			offset := start + cursor%size
+			reverse(start, offset)
+			reverse(offset, end)
+			reverse(start, end)
+		}
+		start = end
+	}
+}
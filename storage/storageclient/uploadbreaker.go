@@ -0,0 +1,147 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"sync"
+	"time"
+)
+
+// uploadBreaker is the circuit breaker of the upload pipeline. It records the results of the
+// recent sector uploads of all workers. When the failure rate exceeds the threshold, the breaker
+// trips and no segment is dispatched until the backoff passes. After that, a single segment is
+// dispatched as a probe. A successful upload closes the breaker, while another failure trips the
+// breaker again with a doubled backoff
+type uploadBreaker struct {
+	// results is the ring buffer of the recent upload results, true for failure
+	results     []bool
+	next        int
+	numResults  int
+	numFailures int
+
+	// open is whether the breaker is tripped. When open, the segments are dispatched only
+	// as probes
+	open bool
+
+	// probing is whether a probe is allowed since the breaker tripped
+	probing bool
+
+	// nextProbe is the time the next probe is allowed
+	nextProbe time.Time
+
+	// backoff is the time waited before the next probe
+	backoff time.Duration
+
+	mu sync.Mutex
+}
+
+// newUploadBreaker creates a closed uploadBreaker
+func newUploadBreaker() *uploadBreaker {
+	return &uploadBreaker{
+		results: make([]bool, uploadBreakerWindow),
+	}
+}
+
+// recordResult records the result of a sector upload
+func (ub *uploadBreaker) recordResult(failed bool, now time.Time) {
+	ub.mu.Lock()
+	defer ub.mu.Unlock()
+
+	// the result of the probe decides whether the breaker is closed
+	if ub.open {
+		if !ub.probing {
+			return
+		}
+		if failed {
+			ub.trip(now)
+			return
+		}
+		ub.reset()
+		return
+	}
+
+	// update the recent results
+	if ub.numResults == len(ub.results) {
+		if ub.results[ub.next] {
+			ub.numFailures--
+		}
+	} else {
+		ub.numResults++
+	}
+	ub.results[ub.next] = failed
+	if failed {
+		ub.numFailures++
+	}
+	ub.next = (ub.next + 1) % len(ub.results)
+
+	if ub.numResults >= uploadBreakerMinResults && float64(ub.numFailures)/float64(ub.numResults) > uploadBreakerFailureRate {
+		ub.trip(now)
+	}
+}
+
+// allow returns whether a segment could be dispatched now. If not, the time to wait before
+// the next probe is returned
+func (ub *uploadBreaker) allow(now time.Time) (allowed bool, wait time.Duration) {
+	ub.mu.Lock()
+	defer ub.mu.Unlock()
+
+	if !ub.open {
+		return true, 0
+	}
+	if now.Before(ub.nextProbe) {
+		return false, ub.nextProbe.Sub(now)
+	}
+	// dispatch a probe. If the probe does not get any result, another probe is allowed
+	// after the backoff
+	ub.probing = true
+	ub.nextProbe = now.Add(ub.backoff)
+	return true, 0
+}
+
+// isOpen returns whether the breaker is tripped
+func (ub *uploadBreaker) isOpen() bool {
+	ub.mu.Lock()
+	defer ub.mu.Unlock()
+	return ub.open
+}
+
+// trip opens the breaker. The backoff is doubled each time the breaker trips in a row
+func (ub *uploadBreaker) trip(now time.Time) {
+	if !ub.open {
+		ub.backoff = uploadBreakerInitialBackoff
+	} else {
+		ub.backoff *= 2
+	}
+	if ub.backoff > uploadBreakerMaxBackoff {
+		ub.backoff = uploadBreakerMaxBackoff
+	}
+	ub.open = true
+	ub.probing = false
+	ub.nextProbe = now.Add(ub.backoff)
+}
+
+// reset closes the breaker and clears the recent results
+func (ub *uploadBreaker) reset() {
+	ub.open = false
+	ub.probing = false
+	ub.backoff = 0
+	ub.next, ub.numResults, ub.numFailures = 0, 0, 0
+}
+
+// waitUploadBreaker blocks until the upload breaker allows a segment to be dispatched.
+// Return false if the storage client is stopped
+func (client *StorageClient) waitUploadBreaker() bool {
+	for {
+		allowed, wait := client.uploadBreaker.allow(time.Now())
+		if allowed {
+			return true
+		}
+		select {
+		case <-time.After(wait):
+		case <-client.tm.StopChan():
+			return false
+		}
+	}
+}
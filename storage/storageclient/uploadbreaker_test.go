@@ -0,0 +1,67 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"testing"
+	"time"
+)
+
+// TestUploadBreaker test the upload breaker trips under a high failure rate, backs off
+// with the failed probes, and recovers after a successful probe
+func TestUploadBreaker(t *testing.T) {
+	ub := newUploadBreaker()
+	now := time.Now()
+
+	// a low failure rate does not trip the breaker
+	for i := 0; i != uploadBreakerWindow; i++ {
+		ub.recordResult(i%2 == 0, now)
+	}
+	if ub.isOpen() {
+		t.Fatal("breaker tripped with a low failure rate")
+	}
+
+	// drive a high failure rate
+	for i := 0; i != uploadBreakerWindow && !ub.isOpen(); i++ {
+		ub.recordResult(true, now)
+	}
+	if !ub.isOpen() {
+		t.Fatal("breaker not tripped with a high failure rate")
+	}
+	if allowed, wait := ub.allow(now); allowed || wait != uploadBreakerInitialBackoff {
+		t.Fatalf("expect dispatch paused for %v, got allowed %v wait %v", uploadBreakerInitialBackoff, allowed, wait)
+	}
+
+	// after the backoff, a single probe is allowed
+	now = now.Add(uploadBreakerInitialBackoff)
+	if allowed, _ := ub.allow(now); !allowed {
+		t.Fatal("probe not allowed after the backoff")
+	}
+	if allowed, _ := ub.allow(now); allowed {
+		t.Fatal("more than one probe allowed")
+	}
+
+	// the failed probe trips the breaker again with a doubled backoff
+	ub.recordResult(true, now)
+	if allowed, wait := ub.allow(now); allowed || wait != 2*uploadBreakerInitialBackoff {
+		t.Fatalf("expect dispatch paused for %v, got allowed %v wait %v", 2*uploadBreakerInitialBackoff, allowed, wait)
+	}
+
+	// the successful probe closes the breaker
+	now = now.Add(2 * uploadBreakerInitialBackoff)
+	if allowed, _ := ub.allow(now); !allowed {
+		t.Fatal("probe not allowed after the backoff")
+	}
+	ub.recordResult(false, now)
+	if ub.isOpen() {
+		t.Fatal("breaker not recovered after a successful probe")
+	}
+	for i := 0; i != uploadBreakerMinResults-1; i++ {
+		ub.recordResult(true, now)
+		if allowed, _ := ub.allow(now); !allowed {
+			t.Fatalf("dispatch paused with %v recent results after recovery", i+1)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"container/heap"
+
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// CancelUpload cancels the upload of the file. The segments of the file waiting in the upload heap
+// are removed, and the segments dispatched no longer assign sectors to the workers. The sectors
+// being uploaded may finish, and the memory of a cancelled segment is returned once none of its
+// sectors is being uploaded. The segments popped from the heap but not yet dispatched are not
+// handled here, and are cleaned up by dispatchSegment. The file is not uploaded or repaired
+// again until ResumeUpload
+func (client *StorageClient) CancelUpload(dxPath storage.DxPath) error {
+	if err := client.tm.Add(); err != nil {
+		return err
+	}
+	defer client.tm.Done()
+
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+
+	dispatched := client.uploadHeap.cancelFile(entry.UID())
+	if len(dispatched) == 0 {
+		return nil
+	}
+	cancelled := make(map[*unfinishedUploadSegment]struct{})
+	for _, uc := range dispatched {
+		uc.mu.Lock()
+		uc.cancelled = true
+		uc.mu.Unlock()
+		cancelled[uc] = struct{}{}
+	}
+
+	// Take the cancelled segments back from the workers which have not started uploading them
+	client.lock.Lock()
+	workers := make([]*worker, 0, len(client.workerPool))
+	for _, w := range client.workerPool {
+		workers = append(workers, w)
+	}
+	client.lock.Unlock()
+	dropped := make(map[*unfinishedUploadSegment]map[*worker]struct{})
+	for _, w := range workers {
+		for _, uc := range w.dropCancelledSegments(cancelled) {
+			if dropped[uc] == nil {
+				dropped[uc] = make(map[*worker]struct{})
+			}
+			dropped[uc][w] = struct{}{}
+		}
+	}
+
+	// The backup workers which have left the queue of the worker are no longer signaled
+	for _, uc := range dispatched {
+		uc.mu.Lock()
+		backupWorkers := make([]*worker, len(uc.workerBackups))
+		copy(backupWorkers, uc.workerBackups)
+		uc.workerBackups = uc.workerBackups[:0]
+		uc.mu.Unlock()
+		for _, w := range backupWorkers {
+			if _, exist := dropped[uc][w]; exist {
+				continue
+			}
+			if dropped[uc] == nil {
+				dropped[uc] = make(map[*worker]struct{})
+			}
+			dropped[uc][w] = struct{}{}
+			w.dropSegment(uc)
+		}
+	}
+
+	for _, uc := range dispatched {
+		client.cleanupUploadSegment(uc)
+	}
+	client.log.Info("upload cancelled", "dxpath", dxPath, "segments", len(dispatched))
+	return nil
+}
+
+// ResumeUpload allows the file cancelled by CancelUpload to be uploaded and repaired again.
+// The segments of the file are pushed to the upload heap in the next iteration of the repair loop
+func (client *StorageClient) ResumeUpload(dxPath storage.DxPath) error {
+	if err := client.tm.Add(); err != nil {
+		return err
+	}
+	defer client.tm.Done()
+
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+
+	client.uploadHeap.mu.Lock()
+	delete(client.uploadHeap.cancelled, entry.UID())
+	client.uploadHeap.mu.Unlock()
+	return nil
+}
+
+// cancelFile marks the upload of the file as cancelled, removes the segments of the file from
+// the heap and the pending segments, and returns the segments already dispatched to the workers
+func (uh *uploadHeap) cancelFile(fid dxfile.FileID) []*unfinishedUploadSegment {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	if uh.cancelled == nil {
+		uh.cancelled = make(map[dxfile.FileID]struct{})
+	}
+	uh.cancelled[fid] = struct{}{}
+
+	queued := make(map[uploadSegmentID]struct{})
+	remain := uh.heap[:0]
+	for _, uc := range uh.heap {
+		if uc.id.fid == fid {
+			queued[uc.id] = struct{}{}
+			continue
+		}
+		remain = append(remain, uc)
+	}
+	for i := len(remain); i != len(uh.heap); i++ {
+		uh.heap[i] = nil
+	}
+	uh.heap = remain
+	heap.Init(&uh.heap)
+
+	var dispatched []*unfinishedUploadSegment
+	for id, uc := range uh.pendingSegments {
+		if id.fid != fid {
+			continue
+		}
+		delete(uh.pendingSegments, id)
+		if _, exist := queued[id]; !exist {
+			dispatched = append(dispatched, uc)
+		}
+	}
+	return dispatched
+}
+
+// dropCancelledSegments drops the cancelled segments the worker has received but not started,
+// and returns the segments dropped
+func (w *worker) dropCancelledSegments(cancelled map[*unfinishedUploadSegment]struct{}) []*unfinishedUploadSegment {
+	var segmentsToDrop []*unfinishedUploadSegment
+	w.mu.Lock()
+	remain := w.pendingSegments[:0]
+	for _, uc := range w.pendingSegments {
+		if _, exist := cancelled[uc]; exist {
+			segmentsToDrop = append(segmentsToDrop, uc)
+			continue
+		}
+		remain = append(remain, uc)
+	}
+	w.pendingSegments = remain
+	w.mu.Unlock()
+
+	for _, uc := range segmentsToDrop {
+		w.dropSegment(uc)
+	}
+	return segmentsToDrop
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestStorageClient_CancelUpload test cancelling the upload of a file while a sector is being
+// uploaded. The segments are drained from the upload heap, the sector being uploaded finishes,
+// and all memory requested by the segments is returned
+func TestStorageClient_CancelUpload(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(string(entry.FilePath()))
+		entry.Close()
+	}()
+
+	mockAddWorkers(3, client)
+	hosts := make(map[string]struct{})
+	var workers []*worker
+	for _, w := range client.workerPool {
+		w.contract.EnodeID = w.hostID
+		hosts[w.hostID.String()] = struct{}{}
+		workers = append(workers, w)
+	}
+	segments, err := client.createUnfinishedSegments(entry, hosts, targetUnstuckSegments, client.contractManager.HostHealthMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expect at least 2 segments, got %v", len(segments))
+	}
+	for _, segment := range segments {
+		client.uploadHeap.push(segment)
+	}
+	memoryAvailable := client.memoryManager.MemoryAvailable()
+
+	// Encode and dispatch a segment the way the repair loop does
+	uc := client.uploadHeap.pop()
+	if !client.memoryManager.Request(uc.memoryNeeded, false) {
+		t.Fatal("failed to request the memory of the segment")
+	}
+	for i := range uc.physicalSegmentData {
+		uc.physicalSegmentData[i] = make([]byte, storage.SectorSize)
+	}
+	client.memoryManager.Return(uc.releaseMemory(entry.SectorSize()))
+	client.dispatchSegment(uc)
+
+	// The first worker starts uploading a sector
+	w := workers[0]
+	w.mu.Lock()
+	if len(w.pendingSegments) != 1 || w.pendingSegments[0] != uc {
+		t.Fatal("the segment is not dispatched to the worker")
+	}
+	w.pendingSegments = w.pendingSegments[:0]
+	w.mu.Unlock()
+	sectorIndex := uint64(0)
+	uc.mu.Lock()
+	uc.sectorSlotsStatus[sectorIndex] = true
+	uc.sectorsUploadingNum++
+	uc.workersRemain--
+	uc.mu.Unlock()
+
+	if err := client.CancelUpload(entry.DxPath()); err != nil {
+		t.Fatal(err)
+	}
+	if client.uploadHeap.len() != 0 {
+		t.Errorf("expect the upload heap drained, got %v segments", client.uploadHeap.len())
+	}
+	if len(client.uploadHeap.fileSegments(entry.UID())) != 0 {
+		t.Errorf("the segments of the file cancelled are still pending")
+	}
+	for _, other := range workers[1:] {
+		if len(other.pendingSegments) != 0 {
+			t.Errorf("the worker still has %v segments to upload", len(other.pendingSegments))
+		}
+	}
+
+	// The sector being uploaded finishes, and the memory is fully returned
+	if err := w.commitUploadedSector(uc, sectorIndex, common.Hash{1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if uc.memoryReleased != uc.memoryNeeded {
+		t.Errorf("expect the segment released %v memory, got %v", uc.memoryNeeded, uc.memoryReleased)
+	}
+	if available := client.memoryManager.MemoryAvailable(); available != memoryAvailable {
+		t.Errorf("expect %v memory available, got %v", memoryAvailable, available)
+	}
+
+	// The segments of the file are accepted again only after the upload is resumed
+	if client.uploadHeap.push(segments[1]) {
+		t.Errorf("the segment of the file cancelled is pushed")
+	}
+	if err := client.ResumeUpload(entry.DxPath()); err != nil {
+		t.Fatal(err)
+	}
+	if !client.uploadHeap.push(segments[1]) {
+		t.Errorf("the segment of the file resumed is not pushed")
+	}
+}
+
+// TestStorageClient_CancelUploadBeforeDispatch test cancelling the upload of a file while a
+// segment popped from the heap is being encoded. The segment is not dispatched to any worker,
+// and its memory is returned when it is to be dispatched
+func TestStorageClient_CancelUploadBeforeDispatch(t *testing.T) {
+	storage.ENV = storage.EnvTest
+
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(string(entry.FilePath()))
+		entry.Close()
+	}()
+
+	mockAddWorkers(3, client)
+	hosts := make(map[string]struct{})
+	var workers []*worker
+	for _, w := range client.workerPool {
+		w.contract.EnodeID = w.hostID
+		hosts[w.hostID.String()] = struct{}{}
+		workers = append(workers, w)
+	}
+	segments, err := client.createUnfinishedSegments(entry, hosts, targetUnstuckSegments, client.contractManager.HostHealthMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.uploadHeap.push(segments[0])
+	memoryAvailable := client.memoryManager.MemoryAvailable()
+
+	uc := client.uploadHeap.pop()
+	if !client.memoryManager.Request(uc.memoryNeeded, false) {
+		t.Fatal("failed to request the memory of the segment")
+	}
+	for i := range uc.physicalSegmentData {
+		uc.physicalSegmentData[i] = make([]byte, storage.SectorSize)
+	}
+
+	// The upload is cancelled while the segment is encoded
+	if err := client.CancelUpload(entry.DxPath()); err != nil {
+		t.Fatal(err)
+	}
+	if uc.memoryReleased != 0 {
+		t.Fatalf("the memory of the segment not dispatched is released by CancelUpload: %v", uc.memoryReleased)
+	}
+	client.dispatchSegment(uc)
+
+	for _, w := range workers {
+		if len(w.pendingSegments) != 0 {
+			t.Errorf("the segment cancelled is dispatched to the worker")
+		}
+	}
+	if len(client.uploadHeap.fileSegments(entry.UID())) != 0 {
+		t.Errorf("the segment cancelled is pending")
+	}
+	if uc.memoryReleased != uc.memoryNeeded {
+		t.Errorf("expect the segment released %v memory, got %v", uc.memoryNeeded, uc.memoryReleased)
+	}
+	if available := client.memoryManager.MemoryAvailable(); available != memoryAvailable {
+		t.Errorf("expect %v memory available, got %v", memoryAvailable, available)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import "fmt"
+
+const (
+	// UploadCompletionLenient accepts the segment that is partially uploaded once no workers
+	// remain. The segment is kept in repair only if it lost more than the repair download threshold
+	// of the sectors, or less than the minimum sectors to recover the segment are uploaded
+	UploadCompletionLenient = "lenient"
+
+	// UploadCompletionStrict accepts the segment only if all sectors including the redundant
+	// sectors are uploaded. Otherwise the segment is marked as stuck and kept in repair
+	UploadCompletionStrict = "strict"
+)
+
+// checkUploadCompletionPolicy checks whether the upload completion policy is supported
+func checkUploadCompletionPolicy(policy string) error {
+	switch policy {
+	case UploadCompletionLenient, UploadCompletionStrict:
+		return nil
+	default:
+		return fmt.Errorf("unknown upload completion policy %v, expect %v or %v", policy, UploadCompletionLenient, UploadCompletionStrict)
+	}
+}
+
+// isUploadAccepted checks whether the sectors completed of the segment are enough to accept the
+// segment as successfully uploaded under the upload completion policy. The segment not accepted
+// is marked as stuck after the upload finishes
+func (uc *unfinishedUploadSegment) isUploadAccepted() bool {
+	if uc.completionPolicy == UploadCompletionStrict {
+		return uc.sectorsCompletedNum >= uc.sectorsAllNeedNum
+	}
+	// the sectors completed are stored on distinct hosts, see unusedHosts
+	if uc.sectorsCompletedNum < uc.sectorsMinNeedNum || uc.sectorsCompletedNum < uc.minHostsNum {
+		return false
+	}
+	return (1-uc.repairThreshold)*float64(uc.sectorsAllNeedNum) <= float64(uc.sectorsCompletedNum)
+}
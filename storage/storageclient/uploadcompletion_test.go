@@ -0,0 +1,108 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import "testing"
+
+// TestIsUploadAccepted test whether a finished segment is accepted at various completion levels
+// under the lenient and the strict upload completion policy
+func TestIsUploadAccepted(t *testing.T) {
+	tests := []struct {
+		policy    string
+		completed int
+		accepted  bool
+	}{
+		{UploadCompletionLenient, 0, false},
+		{UploadCompletionLenient, 2, false},
+		{UploadCompletionLenient, 6, false},
+		{UploadCompletionLenient, 7, true},
+		{UploadCompletionLenient, 8, true},
+		{UploadCompletionStrict, 0, false},
+		{UploadCompletionStrict, 2, false},
+		{UploadCompletionStrict, 7, false},
+		{UploadCompletionStrict, 8, true},
+		{"", 7, true},
+	}
+	for _, test := range tests {
+		uc := &unfinishedUploadSegment{
+			sectorsMinNeedNum:   2,
+			sectorsAllNeedNum:   8,
+			sectorsCompletedNum: test.completed,
+			completionPolicy:    test.policy,
+			repairThreshold:     DefaultRepairDownloadThreshold,
+		}
+		// no workers remain, so the upload of the segment is finished
+		if !uc.IsSegmentUploadComplete() {
+			t.Fatalf("policy %v with %v sectors: segment not complete with no workers remaining", test.policy, test.completed)
+		}
+		if accepted := uc.isUploadAccepted(); accepted != test.accepted {
+			t.Errorf("policy %v with %v sectors: accepted %v, expect %v", test.policy, test.completed, accepted, test.accepted)
+		}
+	}
+}
+
+// TestIsUploadAccepted_MinSectors test under the lenient policy the segment is not accepted if
+// the sectors completed is not enough to recover the segment
+func TestIsUploadAccepted_MinSectors(t *testing.T) {
+	uc := &unfinishedUploadSegment{
+		sectorsMinNeedNum:   4,
+		sectorsAllNeedNum:   4,
+		sectorsCompletedNum: 3,
+		completionPolicy:    UploadCompletionLenient,
+		repairThreshold:     DefaultRepairDownloadThreshold,
+	}
+	if uc.isUploadAccepted() {
+		t.Errorf("segment below the minimum sectors is accepted")
+	}
+}
+
+// TestIsUploadAccepted_MinHosts test under the lenient policy the segment is not accepted if
+// the sectors completed are stored on fewer distinct hosts than required
+func TestIsUploadAccepted_MinHosts(t *testing.T) {
+	uc := &unfinishedUploadSegment{
+		sectorsMinNeedNum:   2,
+		sectorsAllNeedNum:   8,
+		minHostsNum:         7,
+		sectorsCompletedNum: 6,
+		completionPolicy:    UploadCompletionLenient,
+		repairThreshold:     1,
+	}
+	if uc.isUploadAccepted() {
+		t.Errorf("segment below the minimum hosts is accepted")
+	}
+	uc.sectorsCompletedNum = 7
+	if !uc.isUploadAccepted() {
+		t.Errorf("segment meeting the minimum hosts is not accepted")
+	}
+}
+
+// TestIsUploadAccepted_RepairThreshold test under the lenient policy the segment losing no more
+// than the repair download threshold of the sectors is accepted
+func TestIsUploadAccepted_RepairThreshold(t *testing.T) {
+	tests := []struct {
+		threshold float64
+		completed int
+		accepted  bool
+	}{
+		{0, 7, false},
+		{0, 8, true},
+		{0.5, 3, false},
+		{0.5, 4, true},
+		{1, 2, true},
+		{1, 1, false},
+	}
+	for _, test := range tests {
+		uc := &unfinishedUploadSegment{
+			sectorsMinNeedNum:   2,
+			sectorsAllNeedNum:   8,
+			sectorsCompletedNum: test.completed,
+			completionPolicy:    UploadCompletionLenient,
+			repairThreshold:     test.threshold,
+		}
+		if accepted := uc.isUploadAccepted(); accepted != test.accepted {
+			t.Errorf("threshold %v with %v sectors: accepted %v, expect %v", test.threshold, test.completed, accepted, test.accepted)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+)
+
+const (
+	// UploadConfirmTrust counts the sector as completed once the host signed the revision
+	UploadConfirmTrust = "trust"
+
+	// UploadConfirmVerify reads the sector back from the host after upload, and counts the
+	// sector as completed only if the merkle root of the data read back matches
+	UploadConfirmVerify = "verify"
+)
+
+// errSectorNotStored is the error returned if the sector read back from the host does not
+// match the sector uploaded
+var errSectorNotStored = errors.New("the sector read back does not match the sector uploaded")
+
+// sectorDownloader downloads the full sector with the merkle root from the host
+type sectorDownloader func(root common.Hash) ([]byte, error)
+
+// checkUploadConfirmPolicy checks whether the upload confirmation policy is supported
+func checkUploadConfirmPolicy(policy string) error {
+	switch policy {
+	case UploadConfirmTrust, UploadConfirmVerify:
+		return nil
+	default:
+		return fmt.Errorf("unknown upload confirmation policy %v, expect %v or %v", policy, UploadConfirmTrust, UploadConfirmVerify)
+	}
+}
+
+// confirmUploadedSector confirms the sector with the merkle root is stored by the host based
+// on the upload confirmation policy
+func confirmUploadedSector(policy string, root common.Hash, download sectorDownloader) error {
+	if policy != UploadConfirmVerify {
+		return nil
+	}
+	data, err := download(root)
+	if err != nil {
+		return fmt.Errorf("failed to read back the sector: %v", err)
+	}
+	if merkle.Sha256MerkleTreeRoot(data) != root {
+		return errSectorNotStored
+	}
+	return nil
+}
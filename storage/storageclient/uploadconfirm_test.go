@@ -0,0 +1,82 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+)
+
+// TestCommitUploadedSector_Verify test under the verify-after-write policy, the sector is not
+// counted as completed if the host did not store the sector
+func TestCommitUploadedSector_Verify(t *testing.T) {
+	sct := newStorageClientTester(t)
+	client := sct.Client
+	client.persist.UploadConfirmPolicy = UploadConfirmVerify
+
+	sector := generateRandomBytes(1)[:4096]
+	root := merkle.Sha256MerkleTreeRoot(sector)
+	memoryNeeded := uint64(2 * len(sector))
+	client.memoryManager.Request(memoryNeeded, true)
+	uc := &unfinishedUploadSegment{
+		fileEntry:           newFileEntry(t, client),
+		memoryNeeded:        memoryNeeded,
+		sectorsMinNeedNum:   1,
+		sectorsAllNeedNum:   2,
+		sectorsUploadingNum: 2,
+		sectorSlotsStatus:   []bool{true, true},
+		physicalSegmentData: [][]byte{sector, sector},
+		unusedHosts:         make(map[string]struct{}),
+	}
+	w := &worker{client: client}
+	w.contract.EnodeID = enode.RandomID(enode.ID{}, 0)
+
+	downloads := []struct {
+		name     string
+		download sectorDownloader
+	}{
+		{"host not responding", func(common.Hash) ([]byte, error) { return nil, errors.New("sector not found") }},
+		{"host returning other data", func(common.Hash) ([]byte, error) { return make([]byte, len(sector)), nil }},
+	}
+	for _, test := range downloads {
+		if err := w.commitUploadedSector(uc, 0, root, test.download); err == nil {
+			t.Errorf("%v: sector not stored is confirmed", test.name)
+		}
+		if uc.sectorsCompletedNum != 0 {
+			t.Errorf("%v: sector not stored is counted as completed", test.name)
+		}
+	}
+	sectors, err := uc.fileEntry.Sectors(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sectors[0]) != 0 {
+		t.Errorf("sector not stored is added to the file")
+	}
+
+	// the sector stored by the host is counted as completed
+	err = w.commitUploadedSector(uc, 0, root, func(common.Hash) ([]byte, error) { return sector, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uc.sectorsCompletedNum != 1 || uc.sectorsUploadingNum != 1 {
+		t.Errorf("sector stored not counted as completed: completed %v, uploading %v", uc.sectorsCompletedNum, uc.sectorsUploadingNum)
+	}
+}
+
+// TestConfirmUploadedSector_Trust test the trust policy does not read the sector back
+func TestConfirmUploadedSector_Trust(t *testing.T) {
+	download := func(common.Hash) ([]byte, error) {
+		t.Fatal("sector read back under the trust policy")
+		return nil, nil
+	}
+	if err := confirmUploadedSector(UploadConfirmTrust, common.Hash{}, download); err != nil {
+		t.Fatal(err)
+	}
+}
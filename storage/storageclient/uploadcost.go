@@ -0,0 +1,121 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/DxChainNetwork/godx/common"
+)
+
+const (
+	// UploadPolicySpeed dispatches the segment to all workers at once, and the sectors are
+	// uploaded by whichever hosts respond first
+	UploadPolicySpeed = "speed"
+
+	// UploadPolicyCost dispatches the segment to the hosts with the lowest upload bandwidth
+	// price first, and the other hosts are used only when the cheaper hosts fail
+	UploadPolicyCost = "cost"
+)
+
+// uploadCandidate is a worker able to upload a sector of the segment, along with the upload
+// bandwidth price of its host, the number of segments queued to the worker, and the upload
+// health score of the worker
+type uploadCandidate struct {
+	worker *worker
+	price  common.BigInt
+	load   int
+	health float64
+}
+
+// checkUploadPolicy checks whether the upload policy is supported
+func checkUploadPolicy(policy string) error {
+	switch policy {
+	case UploadPolicySpeed, UploadPolicyCost:
+		return nil
+	default:
+		return fmt.Errorf("unknown upload policy %v, expect %v or %v", policy, UploadPolicySpeed, UploadPolicyCost)
+	}
+}
+
+// rankUploadCandidates sorts the upload candidates from the cheapest to the most expensive.
+// The candidates with the same price are sorted from the least loaded to the most loaded, then
+// from the healthiest to the flakiest, and otherwise keep their original order
+func rankUploadCandidates(candidates []uploadCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if cmp := candidates[i].price.Cmp(candidates[j].price); cmp != 0 {
+			return cmp < 0
+		}
+		if candidates[i].load != candidates[j].load {
+			return candidates[i].load < candidates[j].load
+		}
+		return candidates[i].health > candidates[j].health
+	})
+}
+
+// uploadCandidates returns the ranked upload candidates among the workers. The host with
+// unknown price is regarded as free, and it is left for the worker to decide whether to upload.
+// The candidates tied in the ranking are rotated by the cursor, see rotateTies
+func (client *StorageClient) uploadCandidates(workers []*worker, cursor int) []uploadCandidate {
+	candidates := make([]uploadCandidate, 0, len(workers))
+	for _, w := range workers {
+		candidate := uploadCandidate{
+			worker: w,
+			price:  common.BigInt0,
+			load:   w.uploadLoad(),
+			health: w.uploadHealthScore(),
+		}
+		if info, exists := client.storageHostManager.RetrieveHostInfo(w.hostID); exists {
+			candidate.price = info.UploadBandwidthPrice
+		}
+		candidates = append(candidates, candidate)
+	}
+	rankUploadCandidates(candidates)
+	rotateTies(len(candidates), cursor, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		return ci.price.Cmp(cj.price) == 0 && ci.load == cj.load && ci.health == cj.health
+	}, func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates
+}
+
+// assignSegmentByCost queues the segment to all candidates, but only signals the cheapest
+// candidates of distinct hosts needed to upload the remaining sectors. The other candidates
+// are registered as the backup workers, which are signaled when a sector is available again.
+func assignSegmentByCost(candidates []uploadCandidate, uc *unfinishedUploadSegment) {
+	uc.mu.Lock()
+	needed := uc.sectorsAllNeedNum - uc.sectorsCompletedNum - uc.sectorsUploadingNum
+	preferredHosts := make(map[string]struct{})
+	var preferred, backups []*worker
+	for _, candidate := range candidates {
+		w := candidate.worker
+		host := w.contract.EnodeID.String()
+		_, unused := uc.unusedHosts[host]
+		_, picked := preferredHosts[host]
+		switch {
+		case !unused:
+			// the worker will drop the segment immediately, signal it to release the segment
+			preferred = append(preferred, w)
+		case !picked && len(preferredHosts) < needed:
+			preferredHosts[host] = struct{}{}
+			preferred = append(preferred, w)
+		default:
+			backups = append(backups, w)
+		}
+	}
+	uc.workerBackups = append(uc.workerBackups, backups...)
+	uc.mu.Unlock()
+
+	for _, w := range append(preferred, backups...) {
+		w.mu.Lock()
+		w.pendingSegments = append(w.pendingSegments, uc)
+		w.mu.Unlock()
+	}
+	for _, w := range preferred {
+		w.signalUploadChan(uc)
+	}
+}
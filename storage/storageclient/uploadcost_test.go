@@ -0,0 +1,90 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+)
+
+// TestRankUploadCandidates test the upload candidates are ranked by the upload bandwidth price
+func TestRankUploadCandidates(t *testing.T) {
+	prices := []int64{30, 10, 20, 10, 0}
+	var candidates []uploadCandidate
+	for i, price := range prices {
+		candidates = append(candidates, uploadCandidate{
+			worker: &worker{hostID: enode.RandomID(enode.ID{}, i)},
+			price:  common.NewBigInt(price),
+		})
+	}
+	expected := []*worker{candidates[4].worker, candidates[1].worker, candidates[3].worker, candidates[2].worker, candidates[0].worker}
+
+	rankUploadCandidates(candidates)
+	for i, candidate := range candidates {
+		if candidate.worker != expected[i] {
+			t.Errorf("candidate %v not ranked as expected: %+v", i, candidate)
+		}
+	}
+}
+
+// TestAssignSegmentByCost test the cheapest hosts are signaled first for the sectors needed,
+// each sector goes to a distinct host, and the expensive hosts serve as backups
+func TestAssignSegmentByCost(t *testing.T) {
+	numSectors := 3
+	uc := &unfinishedUploadSegment{
+		sectorsAllNeedNum: numSectors,
+		sectorSlotsStatus: make([]bool, numSectors),
+		unusedHosts:       make(map[string]struct{}),
+	}
+
+	// the workers with the index as the price. Worker 1 and 2 share the same host, and the
+	// host of worker 5 is already storing a sector of the segment
+	hosts := []int{0, 1, 1, 2, 3, 4}
+	var candidates []uploadCandidate
+	var workers []*worker
+	for i, host := range hosts {
+		w := &worker{
+			uploadChan: make(chan struct{}, 1),
+		}
+		w.contract.EnodeID = enode.RandomID(enode.ID{}, host)
+		if i != 5 {
+			uc.unusedHosts[w.contract.EnodeID.String()] = struct{}{}
+		}
+		workers = append(workers, w)
+		candidates = append(candidates, uploadCandidate{
+			worker: w,
+			price:  common.NewBigInt(int64(len(hosts) - i)),
+		})
+	}
+	rankUploadCandidates(candidates)
+
+	assignSegmentByCost(candidates, uc)
+
+	// worker 5 is signaled to drop the segment, and the cheapest distinct hosts are signaled
+	// for the three sectors: worker 4, 3 and 2. Worker 1 shares the host with worker 2.
+	expectSignaled := []bool{false, false, true, true, true, true}
+	for i, w := range workers {
+		if len(w.pendingSegments) != 1 {
+			t.Errorf("worker %v: segment not queued", i)
+		}
+		signaled := len(w.uploadChan) == 1
+		if signaled != expectSignaled[i] {
+			t.Errorf("worker %v: expect signaled %v, got %v", i, expectSignaled[i], signaled)
+		}
+	}
+	if len(uc.workerBackups) != 2 {
+		t.Fatalf("expect 2 backup workers, got %v", len(uc.workerBackups))
+	}
+
+	// the backup workers are signaled when a sector is available again
+	uc.notifyBackupWorkers()
+	for i, w := range workers[:2] {
+		if len(w.uploadChan) != 1 {
+			t.Errorf("backup worker %v is not signaled", i)
+		}
+	}
+}
@@ -34,13 +34,24 @@ const (
 // uploadSegmentHeap is a min-heap of priority-sorted segments that need to be either uploaded or repaired
 // The rules of priority:
 //   1) stuck first
-//   2) the lower completion percentage, the more forward when they have the same stuck status
+//   2) the lower fair queuing tag, the more forward when they have the same stuck status. The tags
+//      are all zero unless the fair scheduling is enabled
+//   3) the lower completion percentage, the more forward when they have the same fair queuing tag
+//   4) the lower upload rank, the more forward when they have the same completion percentage
 type uploadSegmentHeap []*unfinishedUploadSegment
 
 func (uch uploadSegmentHeap) Len() int { return len(uch) }
 func (uch uploadSegmentHeap) Less(i, j int) bool {
 	if uch[i].stuck == uch[j].stuck {
-		return float64(uch[i].sectorsCompletedNum)/float64(uch[i].sectorsAllNeedNum) < float64(uch[j].sectorsCompletedNum)/float64(uch[j].sectorsAllNeedNum)
+		if uch[i].fairTag != uch[j].fairTag {
+			return uch[i].fairTag < uch[j].fairTag
+		}
+		completionI := float64(uch[i].sectorsCompletedNum) / float64(uch[i].sectorsAllNeedNum)
+		completionJ := float64(uch[j].sectorsCompletedNum) / float64(uch[j].sectorsAllNeedNum)
+		if completionI == completionJ {
+			return uch[i].uploadRank < uch[j].uploadRank
+		}
+		return completionI < completionJ
 	}
 
 	if uch[i].stuck {
@@ -64,8 +75,16 @@ type uploadHeap struct {
 	heap uploadSegmentHeap
 
 	// pendingSegments is a map containing all the segments are that currently
-	// assigned to workers and are being repaired or uploaded
-	pendingSegments map[uploadSegmentID]struct{}
+	// in the heap or assigned to workers and are being repaired or uploaded
+	pendingSegments map[uploadSegmentID]*unfinishedUploadSegment
+
+	// cancelled is the set of files whose uploads are cancelled. The segments of these files
+	// are not accepted by the heap
+	cancelled map[dxfile.FileID]struct{}
+
+	// fairness is the weighted fair queuing of the segments from different files, nil if the
+	// fair scheduling is disabled
+	fairness *fairQueue
 
 	// Control channels
 	segmentComing       chan struct{}
@@ -85,8 +104,12 @@ func (uh *uploadHeap) push(uuc *unfinishedUploadSegment) bool {
 	var added bool
 	uh.mu.Lock()
 	_, exists := uh.pendingSegments[uuc.id]
-	if !exists {
-		uh.pendingSegments[uuc.id] = struct{}{}
+	_, cancelled := uh.cancelled[uuc.id.fid]
+	if !exists && !cancelled {
+		uh.pendingSegments[uuc.id] = uuc
+		if uh.fairness != nil {
+			uuc.fairTag = uh.fairness.startTag(uuc.id.fid)
+		}
 		heap.Push(&uh.heap, uuc)
 		added = true
 	}
@@ -104,12 +127,29 @@ func (uh *uploadHeap) pop() (uc *unfinishedUploadSegment) {
 	return uc
 }
 
+// fileSegments returns the segments of the file that are either in the heap or being
+// uploaded, keyed by the segment index
+func (uh *uploadHeap) fileSegments(fid dxfile.FileID) map[uint64]*unfinishedUploadSegment {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	segments := make(map[uint64]*unfinishedUploadSegment)
+	for id, uc := range uh.pendingSegments {
+		if id.fid == fid {
+			segments[id.index] = uc
+		}
+	}
+	return segments
+}
+
 func (client *StorageClient) createUnfinishedSegments(entry *dxfile.FileSetEntryWithID, hosts map[string]struct{}, target uploadTarget, hostHealthInfoTable storage.HostHealthInfoTable) ([]*unfinishedUploadSegment, error) {
 	ec, err := entry.ErasureCode()
 	if err != nil {
 		return nil, err
 	}
-	if len(client.workerPool) < int(ec.MinSectors()) {
+	// each worker uploads to a distinct host, so the workers shall be enough to store the minimum
+	// sectors, and to store the sectors on the minimum number of distinct hosts
+	if len(client.workerPool) < int(ec.MinSectors()) || len(client.workerPool) < int(entry.MinSegmentHosts()) {
 		client.log.Info("cannot create any segment from file because there are not enough workers, so marked all unhealthy segments as stuck")
 
 		var err error
@@ -137,6 +177,7 @@ func (client *StorageClient) createUnfinishedSegments(entry *dxfile.FileSetEntry
 	}
 
 	// Assemble the set of segments
+	relocationTargets, relocating := client.relocations.targets(entry.UID())
 	newUnfinishedSegments := make([]*unfinishedUploadSegment, len(segmentIndexes))
 	for i, index := range segmentIndexes {
 		// Sanity check: fileUID should not be the empty value.
@@ -169,6 +210,9 @@ func (client *StorageClient) createUnfinishedSegments(entry *dxfile.FileSetEntry
 			memoryNeeded:      entry.SectorSize()*uint64(ec.NumSectors()+ec.MinSectors()) + uint64(ec.NumSectors())*uint64(key.Overhead()),
 			sectorsMinNeedNum: int(ec.MinSectors()),
 			sectorsAllNeedNum: int(ec.NumSectors()),
+			minHostsNum:       int(entry.MinSegmentHosts()),
+			completionPolicy:  client.persist.UploadCompletionPolicy,
+			repairThreshold:   client.persist.RepairDownloadThreshold,
 			stuck:             entry.GetStuckByIndex(index),
 
 			physicalSegmentData: make([][]byte, ec.NumSectors()),
@@ -177,8 +221,12 @@ func (client *StorageClient) createUnfinishedSegments(entry *dxfile.FileSetEntry
 			unusedHosts:       make(map[string]struct{}),
 		}
 
-		// Every Segment can have a different set of unused hosts.
+		// Every Segment can have a different set of unused hosts. The segment of the file
+		// being relocated is uploaded only to the target hosts
 		for host := range hosts {
+			if relocating && !isRelocationTarget(relocationTargets, host) {
+				continue
+			}
 			newUnfinishedSegments[i].unusedHosts[host] = struct{}{}
 		}
 	}
@@ -194,6 +242,10 @@ func (client *StorageClient) createUnfinishedSegments(entry *dxfile.FileSetEntry
 		}
 		for sectorIndex, sectorSet := range sectors {
 			for _, sector := range sectorSet {
+				// While relocating, the sectors on the previous hosts do not count as uploaded
+				if _, isTarget := relocationTargets[sector.HostID]; relocating && !isTarget {
+					continue
+				}
 				contractID := client.contractManager.GetStorageContractSet().GetContractIDByHostID(sector.HostID)
 				if meta, ok := client.contractManager.GetStorageContractSet().RetrieveContractMetaData(contractID); !ok || !meta.Status.RenewAbility {
 					continue
@@ -228,9 +280,12 @@ func (client *StorageClient) createUnfinishedSegments(entry *dxfile.FileSetEntry
 		// Check if segment seems stuck
 		stuck := !isIncomplete && segmentHealth != dxfile.CompleteHealthThreshold
 
+		// Check if the hosts left are enough to store the sectors on the minimum number of distinct hosts
+		hostsReachable := segment.sectorsCompletedNum+len(segment.unusedHosts) >= segment.minHostsNum
+
 		// Add segment to list of incompleteSegments if it is isIncomplete and
 		// downloadable or if we are targeting stuck segments
-		if isIncomplete && (downloadable || target == targetStuckSegments) {
+		if isIncomplete && hostsReachable && (downloadable || target == targetStuckSegments) {
 			incompleteSegments = append(incompleteSegments, segment)
 			continue
 		}
@@ -252,6 +307,13 @@ func (client *StorageClient) createUnfinishedSegments(entry *dxfile.FileSetEntry
 				client.log.Error("unable to mark segment as stuck", "err", err)
 			}
 			continue
+		} else if isIncomplete && !hostsReachable {
+			client.log.Info("Marking segment", "ID", segment.id, "as stuck due to not enough distinct hosts", segment.minHostsNum)
+			err = segment.fileEntry.SetStuckByIndex(int(segment.index), true)
+			if err != nil {
+				client.log.Error("unable to mark segment as stuck", "err", err)
+			}
+			continue
 		}
 
 		// Close entry of completed Segment
@@ -457,8 +519,13 @@ func (client *StorageClient) uploadOrRepair() {
 			}
 		}
 
-		// Pop the next segment and check whether is empty
-		nextSegment := client.uploadHeap.pop()
+		// Pause the dispatches while most of the recent uploads failed
+		if !client.waitUploadBreaker() {
+			return
+		}
+
+		// Pop the next segment within the repair budget and check whether is empty
+		nextSegment := client.popSegmentWithinBudget()
 		if nextSegment == nil {
 			continue
 		}
@@ -478,6 +545,7 @@ func (client *StorageClient) uploadOrRepair() {
 		}
 
 		// doPrepareNextSegment block until enough memory of segment and then distribute it to the workers
+		client.uploadHeap.serve(nextSegment)
 		err := client.doProcessNextSegment(nextSegment)
 		if err != nil {
 			client.log.Error("Unable to prepare next segment without issues", "segmentID", nextSegment.id, "err", err)
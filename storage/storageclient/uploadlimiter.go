@@ -0,0 +1,102 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errUploadLimiterStopped is returned if the storage client stops while the worker is waiting
+// for the upload bandwidth
+var errUploadLimiterStopped = errors.New("storage client stopped while waiting for the upload bandwidth")
+
+// uploadLimiter is a token bucket bounding the aggregate rate the workers send the sector data
+// to the hosts. The bucket holds at most one second of tokens. A worker takes the tokens of the
+// whole sector once the bucket is not in debt, so a sector larger than the bucket is sent
+// without waiting forever, and the following sectors wait until the debt is paid back
+type uploadLimiter struct {
+	// rate is the maximum upload speed in bytes per second. 0 means unlimited
+	rate int64
+
+	tokens     float64
+	lastRefill time.Time
+
+	// changed is closed to wake up the waiting workers when the rate changes
+	changed chan struct{}
+
+	mu sync.Mutex
+}
+
+// newUploadLimiter creates a new uploadLimiter with the given rate in bytes per second
+func newUploadLimiter(rate int64) *uploadLimiter {
+	return &uploadLimiter{
+		rate:       rate,
+		tokens:     float64(rate),
+		lastRefill: time.Now(),
+		changed:    make(chan struct{}),
+	}
+}
+
+// setRate set the maximum upload speed in bytes per second. 0 means unlimited
+func (ul *uploadLimiter) setRate(rate int64) {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	ul.refill(time.Now())
+	ul.rate = rate
+	if ul.rate == 0 || ul.tokens > float64(ul.rate) {
+		ul.tokens = float64(ul.rate)
+	}
+
+	// wake up the waiting workers to wait with the new rate
+	close(ul.changed)
+	ul.changed = make(chan struct{})
+}
+
+// wait blocks until n bytes are allowed to be sent, or the stop channel is closed
+func (ul *uploadLimiter) wait(n uint64, stop <-chan struct{}) error {
+	for {
+		ul.mu.Lock()
+		if ul.rate == 0 {
+			ul.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		ul.refill(now)
+		if ul.tokens >= 0 {
+			ul.tokens -= float64(n)
+			ul.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration(-ul.tokens / float64(ul.rate) * float64(time.Second))
+		changed := ul.changed
+		ul.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			return errUploadLimiterStopped
+		}
+	}
+}
+
+// refill adds the tokens accumulated since the last refill. The caller shall hold the lock
+func (ul *uploadLimiter) refill(now time.Time) {
+	elapsed := now.Sub(ul.lastRefill)
+	ul.lastRefill = now
+	if ul.rate == 0 || elapsed <= 0 {
+		return
+	}
+	ul.tokens += elapsed.Seconds() * float64(ul.rate)
+	if ul.tokens > float64(ul.rate) {
+		ul.tokens = float64(ul.rate)
+	}
+}
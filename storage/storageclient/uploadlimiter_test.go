@@ -0,0 +1,94 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"testing"
+	"time"
+)
+
+// TestUploadLimiter_Rate test the time to upload the sectors under a low rate is bounded below
+// by the bytes beyond the first second of tokens
+func TestUploadLimiter_Rate(t *testing.T) {
+	rate, sectorSize, numSectors := int64(1000), uint64(500), 5
+	ul := newUploadLimiter(rate)
+	stop := make(chan struct{})
+
+	start := time.Now()
+	for i := 0; i != numSectors; i++ {
+		if err := ul.wait(sectorSize, stop); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	// the bucket starts full, and the last sector is sent on debt
+	minBytes := uint64(numSectors)*sectorSize - uint64(rate) - sectorSize
+	minElapsed := time.Duration(minBytes) * time.Second / time.Duration(rate)
+	if elapsed < minElapsed*9/10 {
+		t.Errorf("%v sectors uploaded in %v, expect at least %v", numSectors, elapsed, minElapsed)
+	}
+	if elapsed > 5*minElapsed {
+		t.Errorf("%v sectors uploaded in %v, expect around %v", numSectors, elapsed, minElapsed)
+	}
+}
+
+// TestUploadLimiter_Unlimited test the upload is not limited with rate 0
+func TestUploadLimiter_Unlimited(t *testing.T) {
+	ul := newUploadLimiter(0)
+	start := time.Now()
+	for i := 0; i != 100; i++ {
+		if err := ul.wait(1<<22, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("unlimited upload waited %v", elapsed)
+	}
+}
+
+// TestUploadLimiter_Reconfigure test the waiting worker is released once the rate is raised
+// at runtime, or the client stops
+func TestUploadLimiter_Reconfigure(t *testing.T) {
+	ul := newUploadLimiter(1)
+	// put the bucket in debt for a long time
+	if err := ul.wait(1<<20, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 2)
+	go func() { done <- ul.wait(1, stop) }()
+	select {
+	case err := <-done:
+		t.Fatalf("worker not waiting for the debt: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ul.setRate(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker not released after the limit is removed")
+	}
+
+	ul.setRate(1)
+	if err := ul.wait(1<<20, nil); err != nil {
+		t.Fatal(err)
+	}
+	go func() { done <- ul.wait(1, stop) }()
+	close(stop)
+	select {
+	case err := <-done:
+		if err != errUploadLimiterStopped {
+			t.Errorf("expect %v, got %v", errUploadLimiterStopped, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker not released after the client stops")
+	}
+}
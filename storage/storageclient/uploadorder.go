@@ -0,0 +1,102 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+const (
+	// SegmentOrderSequential uploads the segments of a new file from the first to the last
+	SegmentOrderSequential = "sequential"
+
+	// SegmentOrderReverse uploads the segments of a new file from the last to the first
+	SegmentOrderReverse = "reverse"
+
+	// SegmentOrderPriority uploads the segments in the user supplied priority list first,
+	// and the rest segments sequentially
+	SegmentOrderPriority = "priority"
+)
+
+// checkSegmentOrder checks whether the segment order is supported, and whether the priority
+// list is valid for the order. The empty order is regarded as SegmentOrderSequential
+func checkSegmentOrder(order string, priority []uint64) error {
+	switch order {
+	case "", SegmentOrderSequential, SegmentOrderReverse:
+		if len(priority) != 0 {
+			return fmt.Errorf("segment priority list is only used with the segment order %v", SegmentOrderPriority)
+		}
+		return nil
+	case SegmentOrderPriority:
+		seen := make(map[uint64]struct{})
+		for _, index := range priority {
+			if _, exist := seen[index]; exist {
+				return fmt.Errorf("duplicate segment %v in the priority list", index)
+			}
+			seen[index] = struct{}{}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown segment order %v, expect %v, %v or %v", order, SegmentOrderSequential,
+			SegmentOrderReverse, SegmentOrderPriority)
+	}
+}
+
+// segmentUploadRanks returns the upload rank of each segment of a new file with numSegments
+// segments. The segment with the lower rank is dispatched first
+func segmentUploadRanks(numSegments uint64, order string, priority []uint64) ([]uint64, error) {
+	if err := checkSegmentOrder(order, priority); err != nil {
+		return nil, err
+	}
+	ranks := make([]uint64, numSegments)
+	switch order {
+	case SegmentOrderReverse:
+		for i := range ranks {
+			ranks[i] = numSegments - 1 - uint64(i)
+		}
+	case SegmentOrderPriority:
+		prioritized := make(map[uint64]struct{})
+		for rank, index := range priority {
+			if index >= numSegments {
+				return nil, fmt.Errorf("segment %v in the priority list out of range, the file has %v segments", index, numSegments)
+			}
+			ranks[index] = uint64(rank)
+			prioritized[index] = struct{}{}
+		}
+		rank := uint64(len(priority))
+		for i := range ranks {
+			if _, exist := prioritized[uint64(i)]; !exist {
+				ranks[i] = rank
+				rank++
+			}
+		}
+	default:
+		for i := range ranks {
+			ranks[i] = uint64(i)
+		}
+	}
+	return ranks, nil
+}
+
+// createAndPushOrderedSegments creates the unfinished segments of the new file and push them to
+// the upload heap, where the segments are dispatched with the upload ranks
+func (client *StorageClient) createAndPushOrderedSegments(entry *dxfile.FileSetEntryWithID, hosts map[string]struct{}, ranks []uint64, hostHealthInfoTable storage.HostHealthInfoTable) error {
+	client.lock.Lock()
+	unfinishedUploadSegments, err := client.createUnfinishedSegments(entry, hosts, targetUnstuckSegments, hostHealthInfoTable)
+	client.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, segment := range unfinishedUploadSegments {
+		if segment.index < uint64(len(ranks)) {
+			segment.uploadRank = ranks[segment.index]
+		}
+		client.uploadHeap.push(segment)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// TestSegmentUploadRanks_Dispatch test the segments of a new file are dispatched from the upload
+// heap in the requested segment order
+func TestSegmentUploadRanks_Dispatch(t *testing.T) {
+	tests := []struct {
+		order    string
+		priority []uint64
+		expect   []uint64
+	}{
+		{"", nil, []uint64{0, 1, 2, 3, 4}},
+		{SegmentOrderSequential, nil, []uint64{0, 1, 2, 3, 4}},
+		{SegmentOrderReverse, nil, []uint64{4, 3, 2, 1, 0}},
+		{SegmentOrderPriority, []uint64{3, 1}, []uint64{3, 1, 0, 2, 4}},
+		{SegmentOrderPriority, []uint64{4, 0, 2, 1, 3}, []uint64{4, 0, 2, 1, 3}},
+	}
+	for i, test := range tests {
+		ranks, err := segmentUploadRanks(uint64(len(test.expect)), test.order, test.priority)
+		if err != nil {
+			t.Fatalf("test %v: %v", i, err)
+		}
+		uh := &uploadHeap{
+			pendingSegments: make(map[uploadSegmentID]*unfinishedUploadSegment),
+		}
+		// push the segments in an order different from the requested one
+		for _, index := range []uint64{2, 4, 0, 3, 1} {
+			uh.push(&unfinishedUploadSegment{
+				id:                uploadSegmentID{fid: dxfile.FileID{1}, index: index},
+				index:             index,
+				sectorsAllNeedNum: 3,
+				uploadRank:        ranks[index],
+			})
+		}
+		var dispatched []uint64
+		for segment := uh.pop(); segment != nil; segment = uh.pop() {
+			dispatched = append(dispatched, segment.index)
+		}
+		if !reflect.DeepEqual(dispatched, test.expect) {
+			t.Errorf("test %v: segments dispatched in order %v, expect %v", i, dispatched, test.expect)
+		}
+	}
+}
+
+// TestSegmentUploadRanks_Invalid test the invalid segment orders are rejected
+func TestSegmentUploadRanks_Invalid(t *testing.T) {
+	tests := []struct {
+		order    string
+		priority []uint64
+	}{
+		{"random", nil},
+		{SegmentOrderReverse, []uint64{1}},
+		{SegmentOrderPriority, []uint64{1, 1}},
+		{SegmentOrderPriority, []uint64{5}},
+	}
+	for i, test := range tests {
+		if _, err := segmentUploadRanks(5, test.order, test.priority); err == nil {
+			t.Errorf("test %v: invalid segment order %v %v shall be rejected", i, test.order, test.priority)
+		}
+	}
+	if err := checkSegmentOrder(SegmentOrderPriority, []uint64{5}); err != nil {
+		t.Errorf("the range of the priority list is checked only with the number of segments: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"math"
+
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// UploadProgress returns the upload progress of the file. The segments in the upload heap or
+// being uploaded are counted with their live upload state, and the other segments are counted
+// with the sectors recorded in the file. The uploaded bytes count each sector of a segment once
+func (client *StorageClient) UploadProgress(dxPath storage.DxPath) (storage.UploadFileInfo, error) {
+	if err := client.tm.Add(); err != nil {
+		return storage.UploadFileInfo{}, err
+	}
+	defer client.tm.Done()
+
+	entry, err := client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		return storage.UploadFileInfo{}, err
+	}
+	defer entry.Close()
+
+	ec, err := entry.ErasureCode()
+	if err != nil {
+		return storage.UploadFileInfo{}, err
+	}
+
+	liveSegments := client.uploadHeap.fileSegments(entry.UID())
+	var sectorsCompleted, numStuck uint64
+	for i := 0; i != entry.NumSegments(); i++ {
+		if uc, exist := liveSegments[uint64(i)]; exist {
+			uc.mu.Lock()
+			sectorsCompleted += uint64(uc.sectorsCompletedNum)
+			stuck := uc.stuck
+			uc.mu.Unlock()
+			if stuck {
+				numStuck++
+			}
+			continue
+		}
+
+		sectors, err := entry.Sectors(i)
+		if err != nil {
+			return storage.UploadFileInfo{}, err
+		}
+		for _, sectorList := range sectors {
+			if len(sectorList) != 0 {
+				sectorsCompleted++
+			}
+		}
+		if entry.GetStuckByIndex(i) {
+			numStuck++
+		}
+	}
+
+	progress := float64(100)
+	if sectorsAllNeed := uint64(entry.NumSegments()) * uint64(ec.NumSectors()); entry.FileSize() != 0 && sectorsAllNeed != 0 {
+		progress = math.Min(100*float64(sectorsCompleted)/float64(sectorsAllNeed), 100)
+	}
+
+	return storage.UploadFileInfo{
+		DxPath:         dxPath.Path,
+		LocalPath:      string(entry.LocalPath()),
+		FileSize:       entry.FileSize(),
+		NumStuckChunks: numStuck,
+		Stuck:          numStuck != 0,
+		UploadedBytes:  sectorsCompleted * entry.SectorSize(),
+		UploadProgress: progress,
+	}, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file
+
+package storageclient
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/p2p/enode"
+)
+
+// TestStorageClient_UploadProgress test the upload progress counts the live state of the
+// segments being uploaded, and the recorded sectors of the other segments
+func TestStorageClient_UploadProgress(t *testing.T) {
+	sct := newStorageClientTester(t)
+	client := sct.Client
+
+	entry := newFileEntry(t, client)
+	defer func() {
+		os.Remove(string(entry.LocalPath()))
+		os.Remove(string(entry.FilePath()))
+		entry.Close()
+	}()
+	if entry.NumSegments() < 2 {
+		t.Fatalf("expect at least 2 segments, got %v", entry.NumSegments())
+	}
+	sectorsAllNeed := float64(entry.NumSegments() * 2)
+
+	info, err := client.UploadProgress(entry.DxPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UploadedBytes != 0 || info.UploadProgress != 0 || info.NumStuckChunks != 0 {
+		t.Errorf("unexpected progress before upload: %+v", info)
+	}
+
+	// The duplicate sectors on different hosts count once
+	for i, host := range []enode.ID{enode.RandomID(enode.ID{}, 1), enode.RandomID(enode.ID{}, 2)} {
+		if err := entry.AddSector(host, common.Hash{byte(i)}, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err = client.UploadProgress(entry.DxPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UploadedBytes != entry.SectorSize() {
+		t.Errorf("expect uploaded bytes %v, got %v", entry.SectorSize(), info.UploadedBytes)
+	}
+	if expect := 100 / sectorsAllNeed; info.UploadProgress != expect {
+		t.Errorf("expect progress %v, got %v", expect, info.UploadProgress)
+	}
+
+	// The segment being uploaded counts the live state
+	segment := &unfinishedUploadSegment{
+		id:                  uploadSegmentID{fid: entry.UID(), index: 1},
+		index:               1,
+		sectorsAllNeedNum:   2,
+		sectorsCompletedNum: 2,
+		stuck:               true,
+	}
+	client.uploadHeap.push(segment)
+	info, err = client.UploadProgress(entry.DxPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UploadedBytes != 3*entry.SectorSize() {
+		t.Errorf("expect uploaded bytes %v, got %v", 3*entry.SectorSize(), info.UploadedBytes)
+	}
+	if expect := 300 / sectorsAllNeed; info.UploadProgress != expect {
+		t.Errorf("expect progress %v, got %v", expect, info.UploadProgress)
+	}
+	if info.NumStuckChunks != 1 || !info.Stuck {
+		t.Errorf("expect 1 stuck segment, got %v", info.NumStuckChunks)
+	}
+
+	// The progress falls back to the recorded sectors after the segment is released
+	client.uploadHeap.pop()
+	info, err = client.UploadProgress(entry.DxPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UploadedBytes != entry.SectorSize() || info.NumStuckChunks != 0 {
+		t.Errorf("unexpected progress after release: %+v", info)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/memorymanager"
+)
+
+// readAheadExpiry is the duration after which the segment data read ahead but not
+// consumed by the upload is dropped, and the memory is returned to the memory manager
+var readAheadExpiry = 10 * time.Minute
+
+// readAheadEntry is the logical data of a segment read ahead from the local file
+type readAheadEntry struct {
+	data   [][]byte
+	memory uint64
+	added  time.Time
+}
+
+// segmentReadAhead reads the segments following the requested one from the local file in
+// the same pass, and buffers them for the upload. Consecutive segments of a large file
+// are then served from memory instead of opening and reading the file for each segment.
+// The buffered data is accounted in the memory manager, and the read ahead is skipped
+// when there is not enough memory available
+type segmentReadAhead struct {
+	// numSegments is the number of segments to read ahead. 0 disables the read ahead
+	numSegments uint64
+
+	entries       map[uploadSegmentID]*readAheadEntry
+	memoryManager *memorymanager.MemoryManager
+	mu            sync.Mutex
+}
+
+// newSegmentReadAhead creates a new segmentReadAhead reading ahead numSegments segments
+func newSegmentReadAhead(numSegments uint64, mm *memorymanager.MemoryManager) *segmentReadAhead {
+	return &segmentReadAhead{
+		numSegments:   numSegments,
+		entries:       make(map[uploadSegmentID]*readAheadEntry),
+		memoryManager: mm,
+	}
+}
+
+// setNumSegments sets the number of segments to read ahead. If the read ahead is disabled,
+// all buffered segments are dropped
+func (ra *segmentReadAhead) setNumSegments(numSegments uint64) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	ra.numSegments = numSegments
+	if numSegments == 0 {
+		for id := range ra.entries {
+			ra.drop(id)
+		}
+	}
+}
+
+// take removes and returns the buffered data of the segment if exists. The memory of the
+// buffer is returned, since the segment has already requested the memory for its own data
+func (ra *segmentReadAhead) take(id uploadSegmentID) ([][]byte, bool) {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	ra.dropExpired(time.Now())
+	entry, exist := ra.entries[id]
+	if !exist {
+		return nil, false
+	}
+	delete(ra.entries, id)
+	ra.memoryManager.Return(entry.memory)
+	return entry.data, true
+}
+
+// readSegment reads the logical data of the segment from the local file. The following
+// segments of the same file are read ahead in the same pass and buffered if the memory
+// allows
+func (ra *segmentReadAhead) readSegment(f io.ReaderAt, segment *unfinishedUploadSegment) ([][]byte, error) {
+	sectorSize := segment.fileEntry.SectorSize()
+	numAhead := ra.numSegmentsAhead(segment)
+
+	// each segment buffered takes the memory of a buffer rounded up to sector size
+	segmentMemory := segment.length
+	if segmentMemory%sectorSize != 0 {
+		segmentMemory += sectorSize - segmentMemory%sectorSize
+	}
+	for numAhead > 0 && !ra.memoryManager.TryRequest(numAhead*segmentMemory) {
+		numAhead /= 2
+	}
+
+	data, err := readSegments(f, segment.offset, segment.length, sectorSize, int(numAhead)+1)
+	if err != nil {
+		if numAhead > 0 {
+			ra.memoryManager.Return(numAhead * segmentMemory)
+		}
+		return nil, err
+	}
+
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	now := time.Now()
+	for i := uint64(1); i <= numAhead; i++ {
+		id := uploadSegmentID{fid: segment.id.fid, index: segment.id.index + i}
+		if _, exist := ra.entries[id]; exist {
+			ra.memoryManager.Return(segmentMemory)
+			continue
+		}
+		ra.entries[id] = &readAheadEntry{
+			data:   data[i],
+			memory: segmentMemory,
+			added:  now,
+		}
+	}
+	return data[0], nil
+}
+
+// numSegmentsAhead returns the number of segments following the given segment to be read
+// ahead. It stops at the end of the file or at the first segment already buffered
+func (ra *segmentReadAhead) numSegmentsAhead(segment *unfinishedUploadSegment) uint64 {
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	numSegments := uint64(segment.fileEntry.NumSegments())
+	var numAhead uint64
+	for numAhead < ra.numSegments {
+		index := segment.id.index + numAhead + 1
+		if index >= numSegments {
+			break
+		}
+		if _, exist := ra.entries[uploadSegmentID{fid: segment.id.fid, index: index}]; exist {
+			break
+		}
+		numAhead++
+	}
+	return numAhead
+}
+
+// dropExpired drops the buffered segments which have not been consumed before expiry.
+// The caller must hold the lock
+func (ra *segmentReadAhead) dropExpired(now time.Time) {
+	for id, entry := range ra.entries {
+		if now.Sub(entry.added) > readAheadExpiry {
+			ra.drop(id)
+		}
+	}
+}
+
+// drop removes the buffered segment and returns its memory. The caller must hold the lock
+func (ra *segmentReadAhead) drop(id uploadSegmentID) {
+	entry, exist := ra.entries[id]
+	if !exist {
+		return
+	}
+	delete(ra.entries, id)
+	ra.memoryManager.Return(entry.memory)
+}
+
+// readSegments reads num consecutive segments starting from offset with one section reader.
+// The last segment of the file might be partial, and the rest of its buffer is left as zero
+func readSegments(f io.ReaderAt, offset int64, segmentLength, sectorSize uint64, num int) ([][][]byte, error) {
+	sr := io.NewSectionReader(f, offset, int64(segmentLength)*int64(num))
+	segments := make([][][]byte, 0, num)
+	for i := 0; i < num; i++ {
+		buf := newDownloadBuffer(segmentLength, sectorSize)
+		_, err := buf.ReadFrom(io.LimitReader(sr, int64(segmentLength)))
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		segments = append(segments, buf.buf)
+	}
+	return segments, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/memorymanager"
+)
+
+const (
+	readAheadTestSectorSize    = 1 << 12
+	readAheadTestSegmentLength = 4 * readAheadTestSectorSize
+)
+
+// TestReadSegments test reading several segments in one pass gives the same data as
+// reading the segments one by one, including the partial segment at the end of the file
+func TestReadSegments(t *testing.T) {
+	numSegments := 5
+	// the last segment is partial
+	fileSize := numSegments*readAheadTestSegmentLength - readAheadTestSectorSize - 100
+	f, content := newReadAheadTestFile(t, fileSize)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	segments, err := readSegments(f, 0, readAheadTestSegmentLength, readAheadTestSectorSize, numSegments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != numSegments {
+		t.Fatalf("expect %v segments, got %v", numSegments, len(segments))
+	}
+	for i := 0; i < numSegments; i++ {
+		offset := int64(i * readAheadTestSegmentLength)
+		single, err := readSegments(f, offset, readAheadTestSegmentLength, readAheadTestSectorSize, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bytes.Join(segments[i], nil), bytes.Join(single[0], nil)) {
+			t.Errorf("segment %v: data read ahead not equal to data read by segment", i)
+		}
+
+		// compare with the file content, padded with zero at the end of the file
+		expect := make([]byte, readAheadTestSegmentLength)
+		if int(offset) < len(content) {
+			copy(expect, content[offset:])
+		}
+		if !bytes.Equal(bytes.Join(segments[i], nil), expect) {
+			t.Errorf("segment %v: data not expected", i)
+		}
+	}
+}
+
+// TestSegmentReadAhead_Memory test the memory of buffered segments is returned to the
+// memory manager when the segment is taken, expired, or the read ahead is disabled
+func TestSegmentReadAhead_Memory(t *testing.T) {
+	memoryLimit := uint64(10 * readAheadTestSegmentLength)
+	mm := memorymanager.New(memoryLimit, make(chan struct{}))
+	ra := newSegmentReadAhead(3, mm)
+
+	addEntry := func(index uint64, added time.Time) uploadSegmentID {
+		if !mm.TryRequest(readAheadTestSegmentLength) {
+			t.Fatal("not enough memory")
+		}
+		id := uploadSegmentID{index: index}
+		ra.entries[id] = &readAheadEntry{
+			data:   [][]byte{make([]byte, readAheadTestSegmentLength)},
+			memory: readAheadTestSegmentLength,
+			added:  added,
+		}
+		return id
+	}
+
+	// taking a buffered segment returns the memory
+	id := addEntry(1, time.Now())
+	if _, exist := ra.take(id); !exist {
+		t.Fatal("buffered segment not found")
+	}
+	if _, exist := ra.take(id); exist {
+		t.Fatal("segment shall be taken only once")
+	}
+	if mm.MemoryAvailable() != memoryLimit {
+		t.Errorf("memory not returned after taken: expect %v, got %v", memoryLimit, mm.MemoryAvailable())
+	}
+
+	// expired segments are dropped
+	expired := addEntry(2, time.Now().Add(-2*readAheadExpiry))
+	valid := addEntry(3, time.Now())
+	if _, exist := ra.take(expired); exist {
+		t.Error("expired segment shall be dropped")
+	}
+	if _, exist := ra.entries[valid]; !exist {
+		t.Error("segment not expired shall be kept")
+	}
+	if mm.MemoryAvailable() != memoryLimit-readAheadTestSegmentLength {
+		t.Errorf("memory not returned after expired: expect %v, got %v", memoryLimit-readAheadTestSegmentLength, mm.MemoryAvailable())
+	}
+
+	// disabling the read ahead drops all segments
+	ra.setNumSegments(0)
+	if len(ra.entries) != 0 {
+		t.Errorf("segments not dropped after disabled: %v", len(ra.entries))
+	}
+	if mm.MemoryAvailable() != memoryLimit {
+		t.Errorf("memory not returned after disabled: expect %v, got %v", memoryLimit, mm.MemoryAvailable())
+	}
+}
+
+// BenchmarkReadSegments_PerSegment benchmark reading a large local file by opening and
+// reading the file for each segment
+func BenchmarkReadSegments_PerSegment(b *testing.B) {
+	benchmarkReadSegments(b, 1)
+}
+
+// BenchmarkReadSegments_ReadAhead benchmark reading a large local file with 8 segments
+// read in one pass
+func BenchmarkReadSegments_ReadAhead(b *testing.B) {
+	benchmarkReadSegments(b, 8)
+}
+
+func benchmarkReadSegments(b *testing.B, segmentsPerRead int) {
+	numSegments := 64
+	segmentLength := uint64(1 << 20)
+	sectorSize := uint64(1 << 18)
+	f, _ := newReadAheadTestFile(b, numSegments*int(segmentLength))
+	defer os.Remove(f.Name())
+	f.Close()
+
+	b.SetBytes(int64(numSegments) * int64(segmentLength))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for index := 0; index < numSegments; index += segmentsPerRead {
+			osFile, err := os.Open(f.Name())
+			if err != nil {
+				b.Fatal(err)
+			}
+			offset := int64(index) * int64(segmentLength)
+			if _, err = readSegments(osFile, offset, segmentLength, sectorSize, segmentsPerRead); err != nil {
+				b.Fatal(err)
+			}
+			osFile.Close()
+		}
+	}
+}
+
+// newReadAheadTestFile creates a temporary file filled with random data of the given size
+func newReadAheadTestFile(tb testing.TB, size int) (*os.File, []byte) {
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		tb.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "readahead")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err = f.Write(content); err != nil {
+		tb.Fatal(err)
+	}
+	return f, content
+}
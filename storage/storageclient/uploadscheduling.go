@@ -0,0 +1,116 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+const (
+	// UploadSchedulingProgress dispatches the segments with the lower completion first,
+	// regardless of the files they belong to. A large file in repair may delay the other files
+	UploadSchedulingProgress = "progress"
+
+	// UploadSchedulingFair interleaves the segments of different files by weighted fair queuing,
+	// so that the files share the workers by the sectors uploaded. The segments of the same file
+	// are still dispatched by completion
+	UploadSchedulingFair = "fair"
+)
+
+// checkUploadSchedulingPolicy checks whether the upload scheduling policy is supported
+func checkUploadSchedulingPolicy(policy string) error {
+	switch policy {
+	case UploadSchedulingProgress, UploadSchedulingFair:
+		return nil
+	default:
+		return fmt.Errorf("unknown upload scheduling policy %v, expect %v or %v", policy, UploadSchedulingProgress, UploadSchedulingFair)
+	}
+}
+
+// fairQueue keeps the virtual time of the weighted fair queuing. Each file has a finish tag,
+// which advances by the sectors of the segment dispatched. The segments in the upload heap are
+// tagged with the start tag of their files, and the segment with the lowest tag goes first.
+// The file new to the heap starts from the current virtual time, so the files idle for a while
+// do not accumulate credits
+type fairQueue struct {
+	virtualTime float64
+	finishTags  map[dxfile.FileID]float64
+}
+
+// newFairQueue creates an empty fairQueue
+func newFairQueue() *fairQueue {
+	return &fairQueue{
+		finishTags: make(map[dxfile.FileID]float64),
+	}
+}
+
+// startTag returns the tag of the next segment of the file
+func (fq *fairQueue) startTag(fid dxfile.FileID) float64 {
+	return math.Max(fq.virtualTime, fq.finishTags[fid])
+}
+
+// serve charges the file of the segment dispatched with the sectors to upload, and advances the
+// virtual time to the tag of the segment. Return the start tag of the next segment of the file
+func (fq *fairQueue) serve(uc *unfinishedUploadSegment) float64 {
+	fid := uc.id.fid
+	cost := math.Max(float64(uc.sectorsAllNeedNum-uc.sectorsCompletedNum), 1)
+
+	fq.virtualTime = math.Max(fq.virtualTime, uc.fairTag)
+	fq.finishTags[fid] = fq.startTag(fid) + cost
+
+	// the files left behind the virtual time start from the virtual time anyway
+	for id, tag := range fq.finishTags {
+		if tag <= fq.virtualTime {
+			delete(fq.finishTags, id)
+		}
+	}
+	return fq.startTag(fid)
+}
+
+// setSchedulingPolicy sets the policy of the order the segments in the heap are dispatched
+func (uh *uploadHeap) setSchedulingPolicy(policy string) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	fair := policy == UploadSchedulingFair
+	if fair == (uh.fairness != nil) {
+		return
+	}
+	if fair {
+		uh.fairness = newFairQueue()
+	} else {
+		uh.fairness = nil
+	}
+	// the segments in the heap are tagged again under the new policy
+	for _, uc := range uh.heap {
+		uc.fairTag = 0
+		if fair {
+			uc.fairTag = uh.fairness.startTag(uc.id.fid)
+		}
+	}
+	heap.Init(&uh.heap)
+}
+
+// serve records the segment is dispatched to the workers. Under the fair scheduling, the other
+// segments of the same file in the heap are moved back by the sectors of the segment
+func (uh *uploadHeap) serve(uc *unfinishedUploadSegment) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+
+	if uh.fairness == nil {
+		return
+	}
+	next := uh.fairness.serve(uc)
+	for _, segment := range uh.heap {
+		if segment.id.fid == uc.id.fid {
+			segment.fairTag = next
+		}
+	}
+	heap.Init(&uh.heap)
+}
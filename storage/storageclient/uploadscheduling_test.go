@@ -0,0 +1,113 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"testing"
+
+	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+)
+
+// TestUploadScheduling_Fair test the segments of the small files in repair are dispatched
+// along with a large file under the fair scheduling, instead of waiting behind the large file
+func TestUploadScheduling_Fair(t *testing.T) {
+	largeFile := dxfile.FileID{1}
+	smallFiles := []dxfile.FileID{{2}, {3}, {4}}
+	numLarge, numSmall := 20, 2
+
+	dispatch := func(policy string) []*unfinishedUploadSegment {
+		uh := &uploadHeap{
+			pendingSegments: make(map[uploadSegmentID]*unfinishedUploadSegment),
+		}
+		uh.setSchedulingPolicy(policy)
+		for i := 0; i != numLarge; i++ {
+			uh.push(&unfinishedUploadSegment{
+				id:                uploadSegmentID{fid: largeFile, index: uint64(i)},
+				index:             uint64(i),
+				sectorsAllNeedNum: 3,
+				uploadRank:        uint64(i),
+			})
+		}
+		// the segments of the small files are partially uploaded
+		for _, fid := range smallFiles {
+			for i := 0; i != numSmall; i++ {
+				uh.push(&unfinishedUploadSegment{
+					id:                  uploadSegmentID{fid: fid, index: uint64(i)},
+					index:               uint64(i),
+					sectorsAllNeedNum:   3,
+					sectorsCompletedNum: 1,
+					uploadRank:          uint64(i),
+				})
+			}
+		}
+		var dispatched []*unfinishedUploadSegment
+		for uc := uh.pop(); uc != nil; uc = uh.pop() {
+			uh.serve(uc)
+			dispatched = append(dispatched, uc)
+		}
+		if len(dispatched) != numLarge+numSmall*len(smallFiles) {
+			t.Fatalf("%v: expect %v segments dispatched, got %v", policy, numLarge+numSmall*len(smallFiles), len(dispatched))
+		}
+		return dispatched
+	}
+
+	// The small files wait behind the large file when dispatched by completion
+	for i, uc := range dispatch(UploadSchedulingProgress) {
+		if isLarge := uc.id.fid == largeFile; isLarge != (i < numLarge) {
+			t.Fatalf("progress: segment %v of file %v dispatched at %v", uc.index, uc.id.fid, i)
+		}
+	}
+
+	// The small files make progress along with the large file, and the segments of the
+	// large file are still dispatched by rank
+	var nextLarge uint64
+	for i, uc := range dispatch(UploadSchedulingFair) {
+		if uc.id.fid == largeFile {
+			if uc.index != nextLarge {
+				t.Errorf("fair: segment %v of the large file dispatched before segment %v", uc.index, nextLarge)
+			}
+			nextLarge++
+			continue
+		}
+		if i >= 2*numSmall*len(smallFiles) {
+			t.Errorf("fair: segment %v of small file %v waited until %v", uc.index, uc.id.fid, i)
+		}
+	}
+}
+
+// TestUploadScheduling_SwitchPolicy test switching the scheduling policy re-tags the segments
+// already in the heap
+func TestUploadScheduling_SwitchPolicy(t *testing.T) {
+	uh := &uploadHeap{
+		pendingSegments: make(map[uploadSegmentID]*unfinishedUploadSegment),
+	}
+	uh.setSchedulingPolicy(UploadSchedulingFair)
+	for i := 0; i != 3; i++ {
+		uh.push(&unfinishedUploadSegment{
+			id:                uploadSegmentID{fid: dxfile.FileID{1}, index: uint64(i)},
+			sectorsAllNeedNum: 3,
+			uploadRank:        uint64(i),
+		})
+	}
+	uh.serve(uh.pop())
+	for _, uc := range uh.heap {
+		if uc.fairTag == 0 {
+			t.Fatalf("segment %v not moved back after the file is served", uc.id.index)
+		}
+	}
+
+	uh.setSchedulingPolicy(UploadSchedulingProgress)
+	if uh.fairness != nil {
+		t.Fatal("fair queuing not disabled")
+	}
+	for _, uc := range uh.heap {
+		if uc.fairTag != 0 {
+			t.Errorf("segment %v keeps the tag %v after the fair scheduling is disabled", uc.id.index, uc.fairTag)
+		}
+	}
+	if err := checkUploadSchedulingPolicy("random"); err == nil {
+		t.Error("unknown scheduling policy shall be rejected")
+	}
+}
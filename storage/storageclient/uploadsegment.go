@@ -7,13 +7,15 @@ package storageclient
 import (
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storageclient/erasurecode"
 	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem/dxfile"
+	"github.com/DxChainNetwork/godx/storage/storageclient/memorymanager"
 )
 
 // uploadSegmentID is a unique identifier for each segment in the storage client
@@ -48,20 +50,39 @@ type unfinishedUploadSegment struct {
 
 	sectorsMinNeedNum int // number of sectors minimum to recover file
 	sectorsAllNeedNum int // number of sectors of minimum + redundant
+	minHostsNum       int // number of distinct hosts minimum storing the sectors, 0 means no requirement
+
+	// completionPolicy decides whether a partially uploaded segment is accepted
+	completionPolicy string
+
+	// repairThreshold is the fraction of the redundant sectors the segment shall lose before it
+	// is downloaded for repair, or accepted after a partial upload
+	repairThreshold float64
 
 	stuck       bool // flag whether the segment was stuck during upload
 	stuckRepair bool // flag if the segment was set 'true' for repair by the stuck loop
 
+	// uploadRank is the rank of the segment within a new file by the segment order of the upload.
+	// The segment with the lower rank is dispatched first
+	uploadRank uint64
+
+	// fairTag is the tag of the segment in the weighted fair queuing of the upload heap
+	fairTag float64
+
 	// The logical data is the data read from file of user
 	// The physical data is all the sectors encrypted and stored on disk across the network
 	logicalSegmentData  [][]byte
 	physicalSegmentData [][]byte
 
+	// keyGeneration is the generation of the cipher key encrypting the physical data
+	keyGeneration uint8
+
 	mu                  sync.Mutex
 	sectorSlotsStatus   []bool              // 'true' in that index if a sector is either uploaded, or a worker is attempting to upload that sector
-	sectorsCompletedNum int                 // number of sectors that have been successful completely uploaded
+	sectorsCompletedNum int                 // number of sectors that have been successful completely uploaded, each on a distinct host
 	sectorsUploadingNum int                 // number of sectors that are being uploaded, but aren't finished yet (may fail)
 	released            bool                // whether this segment has been released from the active segments set
+	cancelled           bool                // whether the upload of the file is cancelled
 	unusedHosts         map[string]struct{} // hosts that aren't yet storing any sectors or performing any work
 	workersRemain       int                 // number of inactive workers still able to upload a sector
 	workerBackups       []*worker           // workers that can be used if other workers fail
@@ -88,6 +109,8 @@ func (uc *unfinishedUploadSegment) notifyBackupWorkers() {
 // IsSegmentUploadComplete checks some fields of the segment to determine if the segment is completed
 // 1）no remain workers and no uploading task
 // 2) completely upload and no uploading task
+// A completed segment is not necessarily accepted, which is decided by isUploadAccepted based
+// on the upload completion policy
 func (uc *unfinishedUploadSegment) IsSegmentUploadComplete() bool {
 	if uc.sectorsCompletedNum == uc.sectorsAllNeedNum && uc.sectorsUploadingNum == 0 {
 		return true
@@ -100,49 +123,81 @@ func (uc *unfinishedUploadSegment) IsSegmentUploadComplete() bool {
 	return false
 }
 
-// dispatchSegment dispatches segments to the workers in the pool in the current solution
-// Now it may be that one sector will not be assigned to worker, and this doesn't have a big impact on the upload process
-// But we will optimize this features and schedule strategy is more balanced and fair
+// dispatchSegment dispatches segments to the workers in the pool. The sectors are offered to
+// the least loaded workers first, see assignSectorTaskToWorker. The workers are counted in the
+// segment before the segment is visible in pendingSegments, so that CancelUpload never regards
+// a segment being dispatched as complete
 func (client *StorageClient) dispatchSegment(uc *unfinishedUploadSegment) {
+	client.lock.Lock()
+	workers := make([]*worker, 0, len(client.workerPool))
+	for _, worker := range client.workerPool {
+		workers = append(workers, worker)
+	}
+	client.lock.Unlock()
+
+	// Mark the number of workers that will receive the segment
+	uc.mu.Lock()
+	uc.workersRemain += len(workers)
+	uc.mu.Unlock()
+
 	// Add segment to pendingSegments map
 	client.uploadHeap.mu.Lock()
 	_, exists := client.uploadHeap.pendingSegments[uc.id]
-	if !exists {
-		client.uploadHeap.pendingSegments[uc.id] = struct{}{}
+	_, cancelled := client.uploadHeap.cancelled[uc.id.fid]
+	if !exists && !cancelled {
+		client.uploadHeap.pendingSegments[uc.id] = uc
 	}
 	client.uploadHeap.mu.Unlock()
 
-	// Distribute the segment to each worker in the work pool, marking the number of workers that have received the segment
-	client.lock.Lock()
-	uc.workersRemain += len(client.workerPool)
-	workers := make([]*worker, 0, len(client.workerPool))
-	for _, worker := range client.workerPool {
-		workers = append(workers, worker)
+	// The upload of the file is cancelled after the segment is popped from the heap. The segment
+	// is not known to CancelUpload, and is not dispatched to any worker. All the memory of the
+	// segment is returned by the cleanup here
+	if cancelled {
+		uc.mu.Lock()
+		uc.cancelled = true
+		uc.workersRemain -= len(workers)
+		uc.mu.Unlock()
+		client.cleanupUploadSegment(uc)
+		return
 	}
-	client.lock.Unlock()
 
 	client.assignSectorTaskToWorker(workers, uc)
 }
 
-// assignSectorTaskToWorker will assign non uploaded sector to worker
+// assignSectorTaskToWorker will assign non uploaded sector to worker. With the cost upload
+// policy, the cheaper hosts are signaled first, and the others serve as backups. With the speed
+// policy, the least loaded healthy workers are signaled first, and the flaky workers are signaled
+// only if the healthy workers are not enough. The segment is queued to every ready worker, so
+// each sector slot not uploaded is offered to a ready worker if there is any. The workers equal
+// in load and health take turns to be signaled first
 func (client *StorageClient) assignSectorTaskToWorker(workers []*worker, uc *unfinishedUploadSegment) {
+	client.lock.Lock()
+	policy := client.persist.UploadPolicy
+	cursor := client.uploadAssignCursor
+	client.uploadAssignCursor++
+	client.lock.Unlock()
+
+	readyWorkers := make([]*worker, 0, len(workers))
 	for _, w := range workers {
 		if w.isReady(uc) {
-			w.pendingSegments = append(w.pendingSegments, uc)
-			select {
-			case w.uploadChan <- struct{}{}:
-			default:
-			}
+			readyWorkers = append(readyWorkers, w)
 		}
 	}
+	sortWorkersByContractID(readyWorkers)
+	if policy == UploadPolicyCost {
+		assignSegmentByCost(client.uploadCandidates(readyWorkers, cursor), uc)
+		return
+	}
+	rankWorkersForUpload(readyWorkers, cursor)
+	assignSegmentByHealth(readyWorkers, uc)
 }
 
 // downloadLogicalSegmentData will fetch the logical segment data by sending a
 // download to the storage client's downloader, and then assign the data to the field
 func (client *StorageClient) downloadLogicalSegmentData(segment *unfinishedUploadSegment) error {
 	downloadLength := segment.length
-	if segment.index == uint64(segment.fileEntry.NumSegments()-1) && segment.fileEntry.FileSize()%segment.length != 0 {
-		downloadLength = segment.fileEntry.FileSize() % segment.length
+	if segment.index == uint64(segment.fileEntry.NumSegments()-1) {
+		downloadLength = common.FinalSegmentLength(segment.fileEntry.FileSize(), segment.length)
 	}
 
 	// Create the download
@@ -213,7 +268,13 @@ func (client *StorageClient) retrieveDataAndDispatchSegment(segment *unfinishedU
 	if err != nil {
 		return
 	}
+	client.encodeAndDispatchSegment(segment, ec)
+}
 
+// encodeAndDispatchSegment encodes the logical data of the segment into the physical sectors
+// with the erasure code, and distributes the sectors to the workers. If the sectors cannot be
+// encoded, the upload of the segment is aborted and retried later
+func (client *StorageClient) encodeAndDispatchSegment(segment *unfinishedUploadSegment, ec erasurecode.ErasureCoder) {
 	erasureCodingMemory := segment.fileEntry.SectorSize() * uint64(ec.MinSectors())
 	var sectorCompletedMemory uint64
 	for i := 0; i < len(segment.sectorSlotsStatus); i++ {
@@ -225,53 +286,55 @@ func (client *StorageClient) retrieveDataAndDispatchSegment(segment *unfinishedU
 	defer client.cleanupUploadSegment(segment)
 
 	// Retrieve the logical data for the segment
-	err = client.retrieveLogicalSegmentData(segment)
+	err := client.retrieveLogicalSegmentData(segment)
 	if err != nil {
-		// retrieve logical data failed, interrupt upload and release memory
-		segment.logicalSegmentData = nil
-		segment.workersRemain = 0
-		client.memoryManager.Return(erasureCodingMemory + sectorCompletedMemory)
-		segment.memoryReleased += erasureCodingMemory + sectorCompletedMemory
-		client.log.Error("retrieve logical data of a segment failed:", err)
+		client.log.Error("retrieve logical data of a segment failed", "err", err)
+		client.abortSegmentUpload(segment)
 		return
 	}
+	// The final segment might be partial, and the data beyond the end of the file is zero padded
+	if segment.index == uint64(segment.fileEntry.NumSegments()-1) {
+		segment.logicalSegmentData = common.FinalSegmentSectorData(segment.logicalSegmentData, segment.fileEntry.FileSize(), segment.length)
+	}
 
 	// Encode the physical sectors from content bytes of file
 	var segmentBytes []byte
 	for _, b := range segment.logicalSegmentData {
 		segmentBytes = append(segmentBytes, b...)
 	}
-	segment.physicalSegmentData, err = ec.Encode(segmentBytes)
+	segment.physicalSegmentData, err = client.encodePool.encode(ec, segmentBytes)
+	segment.logicalSegmentData = nil
+	client.memoryManager.Return(segment.releaseMemory(erasureCodingMemory))
 	if err != nil {
-		segment.workersRemain = 0
-		client.memoryManager.Return(sectorCompletedMemory)
-		segment.memoryReleased += sectorCompletedMemory
-		for i := 0; i < len(segment.physicalSegmentData); i++ {
-			segment.physicalSegmentData[i] = nil
-		}
 		client.log.Error("Erasure encode physical data of a segment failed", "err", err)
+		client.abortSegmentUpload(segment)
 		return
 	}
 
-	segment.logicalSegmentData = nil
-	client.memoryManager.Return(erasureCodingMemory)
-	segment.memoryReleased += erasureCodingMemory
-
 	// Sanity check that at least as many physical data sectors as sector slots
 	if len(segment.physicalSegmentData) < len(segment.sectorSlotsStatus) {
-		client.log.Info("not enough physical sectors to match the upload sector slots of the file")
+		client.log.Error("not enough physical sectors to match the upload sector slots of the file", "unfinishedSegmentID", segment.id,
+			"physicalSectors", len(segment.physicalSegmentData), "sectorSlots", len(segment.sectorSlotsStatus))
+		client.abortSegmentUpload(segment)
 		return
 	}
-	key, err := segment.fileEntry.CipherKey()
-	if err != nil {
-		return
-	}
-	// Loop through the sectorSlots and encrypt any that are needed
+
+	// Loop through the sectorSlots and encrypt any that are needed. Each sector is encrypted
+	// with the key derived for the sector, which is the file cipher key if no derivation is set.
+	// All sectors are encrypted with the same generation of the cipher key, which is recorded
+	// with the sectors uploaded.
 	// If the sector has been used, set physicalSegmentData nil and gc routine will collect this memory
+	segment.keyGeneration = segment.fileEntry.KeyGeneration()
 	for i := 0; i < len(segment.sectorSlotsStatus); i++ {
 		if segment.sectorSlotsStatus[i] {
 			segment.physicalSegmentData[i] = nil
 		} else {
+			key, err := segment.fileEntry.SectorCipherKeyOfGeneration(segment.keyGeneration, segment.index, uint64(i))
+			if err != nil {
+				segment.physicalSegmentData[i] = nil
+				client.log.Error("derive the sector cipher key failed", "err", err)
+				continue
+			}
 			cipherData, err := key.Encrypt(segment.physicalSegmentData[i])
 			if err != nil {
 				segment.physicalSegmentData[i] = nil
@@ -283,16 +346,33 @@ func (client *StorageClient) retrieveDataAndDispatchSegment(segment *unfinishedU
 	}
 
 	if sectorCompletedMemory > 0 {
-		client.memoryManager.Return(sectorCompletedMemory)
-		segment.memoryReleased += sectorCompletedMemory
+		client.memoryManager.Return(segment.releaseMemory(sectorCompletedMemory))
 	}
 	client.dispatchSegment(segment)
 }
 
+// abortSegmentUpload aborts the upload of the segment before it is dispatched to the workers.
+// All memory not yet released by the segment is returned, and no sector is left to upload, so
+// that the cleanup marks the repair of the segment as failed and the segment is retried later.
+// The caller must have exclusive access to the segment
+func (client *StorageClient) abortSegmentUpload(segment *unfinishedUploadSegment) {
+	segment.workersRemain = 0
+	segment.logicalSegmentData = nil
+	segment.physicalSegmentData = make([][]byte, len(segment.sectorSlotsStatus))
+
+	// mark all sector slots as released, so that the cleanup does not release the memory again
+	for i := range segment.sectorSlotsStatus {
+		segment.sectorSlotsStatus[i] = true
+	}
+	if remaining := segment.memoryNeeded - segment.memoryReleased; remaining > 0 {
+		client.memoryManager.Return(segment.releaseMemory(remaining))
+	}
+}
+
 // retrieveLogicalSegmentData will get the raw data from disk if possible otherwise queueing a download
 func (client *StorageClient) retrieveLogicalSegmentData(segment *unfinishedUploadSegment) error {
 	numRedundantSectors := float64(segment.sectorsAllNeedNum - segment.sectorsMinNeedNum)
-	minMissingSectorsToDownload := int(numRedundantSectors * RemoteRepairDownloadThreshold)
+	minMissingSectorsToDownload := int(numRedundantSectors * segment.repairThreshold)
 	needDownload := segment.sectorsCompletedNum+minMissingSectorsToDownload < segment.sectorsAllNeedNum
 
 	// Download the segment if it's not on disk.
@@ -302,6 +382,23 @@ func (client *StorageClient) retrieveLogicalSegmentData(segment *unfinishedUploa
 		return errors.New("file not available locally")
 	}
 
+	// Reject the local source not matching the checksum of the file, since the sectors encoded
+	// from a modified source would corrupt the redundancy of the file
+	if err := client.verifyLocalSource(segment); err != nil {
+		client.segmentReadAhead.take(segment.id)
+		if needDownload {
+			client.log.Warn("local source rejected, downloading instead", "dxpath", segment.fileEntry.DxPath().Path, "err", err)
+			return client.downloadLogicalSegmentData(segment)
+		}
+		return fmt.Errorf("local source rejected: %v", err)
+	}
+
+	// Use the segment data read ahead from disk if available
+	if data, exist := client.segmentReadAhead.take(segment.id); exist {
+		segment.logicalSegmentData = data
+		return nil
+	}
+
 	// Try to read the file content from disk. If failed, go through needDownload
 	osFile, err := os.Open(string(segment.fileEntry.LocalPath()))
 	if err != nil && needDownload {
@@ -311,21 +408,32 @@ func (client *StorageClient) retrieveLogicalSegmentData(segment *unfinishedUploa
 	}
 	defer osFile.Close()
 
-	buf := newDownloadBuffer(segment.length, segment.fileEntry.SectorSize())
-	sr := io.NewSectionReader(osFile, segment.offset, int64(segment.length))
-	_, err = buf.ReadFrom(sr)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF && needDownload {
+	data, err := client.segmentReadAhead.readSegment(osFile, segment)
+	if err != nil && needDownload {
 		client.log.Error("failed to read file, downloading instead", "err", err)
 		return client.downloadLogicalSegmentData(segment)
-	} else if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+	} else if err != nil {
 		client.log.Error("failed to read file locally", "err", err)
 		return errors.New("failed to read file locally")
 	}
-	segment.logicalSegmentData = buf.buf
+	segment.logicalSegmentData = data
 
 	return nil
 }
 
+// releaseMemory records the memory released by the segment, and returns the amount to be
+// returned to the memory manager. Releasing more memory than the segment requested is
+// rejected. The caller must have exclusive access to the segment
+func (uc *unfinishedUploadSegment) releaseMemory(amount uint64) uint64 {
+	if uc.memoryReleased+amount > uc.memoryNeeded {
+		memorymanager.ReportAccountingError("segment released more memory than requested", "index", uc.index,
+			"memoryNeeded", uc.memoryNeeded, "memoryReleased", uc.memoryReleased, "amount", amount)
+		amount = uc.memoryNeeded - uc.memoryReleased
+	}
+	uc.memoryReleased += amount
+	return amount
+}
+
 // cleanupUploadSegment will check the state of the segment and perform any
 // cleanup required. This can include returning memory and releasing the segment
 // from the map of active segments in the segment heap.
@@ -357,13 +465,23 @@ func (client *StorageClient) cleanupUploadSegment(uc *unfinishedUploadSegment) {
 	// If required, remove the segment from the set of repairing segments.
 	if segmentComplete && !released {
 		uc.released = true
-		client.updateUploadSegmentStuckStatus(uc)
+		if !uc.cancelled {
+			client.updateUploadSegmentStuckStatus(uc)
+		}
 		client.uploadHeap.mu.Lock()
-		delete(client.uploadHeap.pendingSegments, uc.id)
+		if client.uploadHeap.pendingSegments[uc.id] == uc {
+			delete(client.uploadHeap.pendingSegments, uc.id)
+		}
 		client.uploadHeap.mu.Unlock()
+		client.finishRelocation(uc.fileEntry)
 	}
 
-	uc.memoryReleased += uint64(memoryReleased)
+	// The cancelled segment returns all the memory left once no sector is being uploaded
+	if segmentComplete && uc.cancelled {
+		memoryReleased = uc.memoryNeeded - uc.memoryReleased
+	}
+
+	memoryReleased = uc.releaseMemory(memoryReleased)
 	totalMemoryReleased := uc.memoryReleased
 	uc.mu.Unlock()
 
@@ -390,7 +508,7 @@ func (client *StorageClient) setStuckAndClose(uc *unfinishedUploadSegment, stuck
 		return fmt.Errorf("unable to update Segment stuck status for file %v: %v", uc.fileEntry.DxPath(), err)
 	}
 
-	go client.fileSystem.InitAndUpdateDirMetadata(uc.fileEntry.DxPath())
+	go client.updateFileDirMetadata(uc.fileEntry.DxPath())
 
 	//err = uc.fileEntry.Close()
 	//if err != nil {
@@ -410,7 +528,7 @@ func (client *StorageClient) updateUploadSegmentStuckStatus(uc *unfinishedUpload
 	stuckRepair := uc.stuckRepair
 
 	// Determine if repair was successful
-	successfulRepair := (1-RemoteRepairDownloadThreshold)*float64(sectorsNeedNum) <= float64(sectorsCompleteNum)
+	successfulRepair := uc.isUploadAccepted()
 
 	// Check if client shut down
 	var clientOffline bool
@@ -436,19 +554,26 @@ func (client *StorageClient) updateUploadSegmentStuckStatus(uc *unfinishedUpload
 
 	if !successfulRepair {
 		client.log.Info("repair unsuccessful, marking segment", "unfinishedSegmentID", uc.id, "completePercent", float64(sectorsCompleteNum)/float64(sectorsNeedNum))
+		if client.repairBudget.recordFailure(uc.id.fid, uc.fileEntry.DxPath(), time.Now()) {
+			client.log.Warn("repair budget of the file exhausted, repairs yield to other files", "dxpath", uc.fileEntry.DxPath())
+		}
 	} else {
 		client.log.Info("repair successful, marking segment as non-stuck", "unfinishedSegmentID", uc.id)
 	}
 
-	if err := uc.fileEntry.SetStuckByIndex(int(index), !successfulRepair); err != nil {
+	// The stuck status and the time of the successful repair are saved in one batch
+	err := uc.fileEntry.BatchUpdate(func(b *dxfile.Batch) error {
+		if successfulRepair {
+			b.SetTimeRecentRepair(time.Now())
+		}
+		return b.SetStuckByIndex(int(index), !successfulRepair)
+	})
+	if err != nil {
 		client.log.Error("could not set segment stuck status for file", "unfinishedSegmentID", uc.id, "dxpath", uc.fileEntry.DxPath(), "err", err)
 	}
 
 	dxPath := uc.fileEntry.DxPath()
-
-	if err := client.fileSystem.InitAndUpdateDirMetadata(dxPath); err != nil {
-		client.log.Error("update dir meta data failed", "err", err)
-	}
+	client.updateFileDirMetadata(dxPath)
 
 	// Check to see if the segment was stuck and now is successfully repaired by the stuck loop
 	if stuck && successfulRepair && stuckRepair {
@@ -6,6 +6,7 @@ package storageclient
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"sort"
 	"time"
@@ -21,6 +22,7 @@ import (
 	"github.com/DxChainNetwork/godx/event"
 	"github.com/DxChainNetwork/godx/p2p/enode"
 	"github.com/DxChainNetwork/godx/params"
+	"github.com/DxChainNetwork/godx/rpc"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/DxChainNetwork/godx/storage/storageclient/filesystem"
 	"github.com/DxChainNetwork/godx/storage/storageclient/storagehostmanager"
@@ -183,6 +185,19 @@ func (client *StorageClient) GetPoolNonce(ctx context.Context, addr common.Addre
 	return client.ethBackend.GetPoolNonce(ctx, addr)
 }
 
+// GetAvailableBalance returns the balance of the account available for spending at the latest
+// block, which excludes the assets frozen by dpos
+func (client *StorageClient) GetAvailableBalance(address common.Address) (*big.Int, error) {
+	balance, err := client.info.BlockChain.GetBalance(context.Background(), address, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if balance.AvailableBalance == nil {
+		return nil, errors.New("failed to get the balance from the state")
+	}
+	return balance.AvailableBalance.ToInt(), nil
+}
+
 // GetFileSystem will get the file system
 func (client *StorageClient) GetFileSystem() filesystem.FileSystem {
 	return client.fileSystem
@@ -206,7 +221,7 @@ func CalculateProofRanges(actions []storage.UploadAction, oldNumSectors uint64)
 	sectorsChanged := make(map[uint64]struct{})
 	for _, action := range actions {
 		switch action.Type {
-		case storage.UploadActionAppend:
+		case storage.UploadActionAppend, storage.UploadActionAppendVirtual:
 			sectorsChanged[newNumSectors] = struct{}{}
 			newNumSectors++
 		}
@@ -233,7 +248,7 @@ func CalculateProofRanges(actions []storage.UploadAction, oldNumSectors uint64)
 func ModifyProofRanges(proofRanges []merkle.SubTreeLimit, actions []storage.UploadAction, numSectors uint64) []merkle.SubTreeLimit {
 	for _, action := range actions {
 		switch action.Type {
-		case storage.UploadActionAppend:
+		case storage.UploadActionAppend, storage.UploadActionAppendVirtual:
 			proofRanges = append(proofRanges, merkle.SubTreeLimit{
 				Left:  numSectors,
 				Right: numSectors + 1,
@@ -249,9 +264,30 @@ func ModifyProofRanges(proofRanges []merkle.SubTreeLimit, actions []storage.Uplo
 func ModifyLeaves(leafHashes []common.Hash, actions []storage.UploadAction, numSectors uint64) []common.Hash {
 	for _, action := range actions {
 		switch action.Type {
-		case storage.UploadActionAppend:
-			leafHashes = append(leafHashes, merkle.Sha256MerkleTreeRoot(action.Data))
+		case storage.UploadActionAppend, storage.UploadActionAppendVirtual:
+			leafHashes = append(leafHashes, action.SectorRoot())
 		}
 	}
 	return leafHashes
 }
+
+// hasVirtualAppend returns whether any of the actions appends a virtual sector
+func hasVirtualAppend(actions []storage.UploadAction) bool {
+	for _, action := range actions {
+		if action.Type == storage.UploadActionAppendVirtual {
+			return true
+		}
+	}
+	return false
+}
+
+// deletedSectorRoots returns the merkle roots of the sectors deleted by the actions
+func deletedSectorRoots(actions []storage.UploadAction) []common.Hash {
+	var roots []common.Hash
+	for _, action := range actions {
+		if action.Type == storage.UploadActionDelete {
+			roots = append(roots, action.SectorRoot())
+		}
+	}
+	return roots
+}
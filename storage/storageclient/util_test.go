@@ -109,3 +109,19 @@ func TestNewVision(t *testing.T) {
 	}
 
 }
+
+// TestModifyLeaves_Virtual test the virtual sector appends the same leaf as uploading the data
+func TestModifyLeaves_Virtual(t *testing.T) {
+	data := []byte("dxchain")
+	root := merkle.Sha256MerkleTreeRoot(data)
+	appended := ModifyLeaves(nil, []storage.UploadAction{{Type: storage.UploadActionAppend, Data: data}}, 5)
+	virtual := ModifyLeaves(nil, []storage.UploadAction{{Type: storage.UploadActionAppendVirtual, Data: root.Bytes()}}, 5)
+	if !reflect.DeepEqual(appended, virtual) || len(virtual) != 1 || virtual[0] != root {
+		t.Errorf("virtual sector leaves %v, expect %v", virtual, appended)
+	}
+
+	ranges := ModifyProofRanges(nil, []storage.UploadAction{{Type: storage.UploadActionAppendVirtual, Data: root.Bytes()}}, 5)
+	if expect := []merkle.SubTreeLimit{{Left: 5, Right: 6}}; !reflect.DeepEqual(ranges, expect) {
+		t.Errorf("virtual sector proof ranges %v, expect %v", ranges, expect)
+	}
+}
@@ -42,6 +42,9 @@ type worker struct {
 	// the time that last failure
 	ownedDownloadRecentFailure time.Time
 
+	// the smoothed latency of downloading a sector from the host, 0 if not observed yet
+	downloadLatency time.Duration
+
 	// Notifications of new download work. Takes priority over uploads.
 	downloadChan chan struct{}
 
@@ -59,6 +62,10 @@ type worker struct {
 	uploadRecentFailure       time.Time     // How recent was the last failure?
 	uploadTerminated          bool          // Have we stopped uploading?
 
+	// the rolling health of uploading to the host, which is the recent success rate and the
+	// smoothed latency of the successful uploads
+	uploadHealth workerUploadHealth
+
 	// Worker will shut down if a signal is sent down this channel.
 	killChan chan struct{}
 	mu       sync.Mutex
@@ -178,7 +185,7 @@ func (w *worker) killDownloading() {
 
 	// close connection after downloading
 	for i := 0; i < len(removedSegments); i++ {
-		removedSegments[i].removeWorker()
+		removedSegments[i].removeQueuedWorker(w)
 	}
 }
 
@@ -199,7 +206,7 @@ func (w *worker) queueDownloadSegment(uds *unfinishedDownloadSegment) {
 
 	// if the worker has terminated, remove it from the uds
 	if terminated {
-		uds.removeWorker()
+		uds.removeQueuedWorker(w)
 	}
 }
 
@@ -235,6 +242,11 @@ func (w *worker) checkConnection() (storage.Peer, *storage.HostInfo, error) {
 		return nil, nil, errors.New("the contract is currently renewing or revising")
 	}
 
+	// fast-fail the dead host before the heavyweight negotiation
+	if err == nil && hostInfo.Capabilities.SupportFeature(storage.FeaturePing) {
+		err = sp.Ping()
+	}
+
 	return sp, hostInfo, err
 }
 
@@ -245,6 +257,7 @@ func (w *worker) download(uds *unfinishedDownloadSegment) error {
 
 	if err != nil {
 		w.client.log.Error("failed to check the connection", "err", err)
+		uds.removeQueuedWorker(w)
 		return err
 	}
 
@@ -254,23 +267,41 @@ func (w *worker) download(uds *unfinishedDownloadSegment) error {
 		return err
 	}
 
-	// whether download success or fail, we should remove the worker at last
-	defer uds.removeWorker()
+	// whether download success or fail, we should remove the worker at last, unless the
+	// worker shall fetch another sector its host holds
+	var fetchMore bool
+	defer func() {
+		if fetchMore {
+			w.queueDownloadSegment(uds)
+			return
+		}
+		uds.removeWorker()
+	}()
 
 	// for not supporting partial encoding, we need to download the whole sector every time.
 	fetchOffset, fetchLength := 0, storage.SectorSize
-	root := uds.segmentMap[w.hostID.String()].root
+	sector := uds.registeredSector(w)
 
 	// call rpc request the data from host, if get error, unregister the worker.
-	sectorData, err := w.client.Download(sp, root, uint32(fetchOffset), uint32(fetchLength), hostInfo)
+	start := time.Now()
+	sectorData, err := w.client.Download(sp, sector.root, uint32(fetchOffset), uint32(fetchLength), hostInfo)
 	if err != nil {
 		w.client.log.Error("worker failed to download sector", "error", err)
+		if negotiationErr, ok := err.(*storage.NegotiationError); ok && negotiationErr.Code == storage.NegotiationErrSectorLost {
+			w.removeLostSector(uds, sector)
+		}
 		uds.unregisterWorker(w)
 		return err
 	}
+	w.updateDownloadLatency(time.Since(start))
 
 	// decrypt the sector
-	key := uds.clientFile.CipherKey()
+	key, err := uds.clientFile.SectorCipherKeyOfGeneration(sector.keyGeneration, uds.segmentIndex, sector.index)
+	if err != nil {
+		w.client.log.Error("worker failed to derive the sector cipher key", "error", err)
+		uds.unregisterWorker(w)
+		return err
+	}
 	decryptedSector, err := key.DecryptInPlace(sectorData)
 	if err != nil {
 		w.client.log.Error("worker failed to decrypt sector", "error", err)
@@ -279,64 +310,87 @@ func (w *worker) download(uds *unfinishedDownloadSegment) error {
 	}
 
 	// mark the sector as completed
-	sectorIndex := uds.segmentMap[w.hostID.String()].index
-	uds.mu.Lock()
-	uds.markSectorCompleted(sectorIndex)
-	uds.sectorsRegistered--
+	fetchMore = uds.sectorDownloaded(w, sector, decryptedSector)
+	return nil
+}
 
-	// if the num of sectorsCompleted has not reached the required min sector num,
-	// go on keeping the decrypted sector.
-	if uds.sectorsCompleted <= uds.erasureCode.MinSectors() {
-		uds.physicalSegmentData[sectorIndex] = decryptedSector
-		w.client.log.Debug("received a sector,but not enough to recover", "sectors_completed", uds.sectorsCompleted)
+// removeLostSector removes the sector the host reported as lost from the file, so that the
+// sector is no longer counted in the file health, and is repaired from the other sectors
+func (w *worker) removeLostSector(uds *unfinishedDownloadSegment, sector downloadSectorInfo) {
+	dxPath := uds.clientFile.DxPath()
+	entry, err := w.client.fileSystem.OpenDxFile(dxPath)
+	if err != nil {
+		w.client.log.Warn("failed to open the file to remove the lost sector", "dxpath", dxPath, "err", err)
+		return
 	}
+	defer entry.Close()
 
-	// recover the logical data
-	if uds.sectorsCompleted == uds.erasureCode.MinSectors() {
-		go uds.recoverLogicalData()
-		w.client.log.Debug("received enough sectors to recover", "sectors_completed", uds.sectorsCompleted)
+	if err = entry.RemoveSector(w.hostID, sector.root, int(uds.segmentIndex), int(sector.index)); err != nil {
+		w.client.log.Warn("failed to remove the lost sector", "dxpath", dxPath, "host", w.hostID, "err", err)
+		return
 	}
-
-	uds.mu.Unlock()
-
-	return nil
+	w.client.log.Warn("host lost the sector", "dxpath", dxPath, "host", w.hostID, "segment", uds.segmentIndex, "sector", sector.index)
 }
 
 // Check the given download segment whether there is work to do, and update its info
 func (w *worker) processDownloadSegment(uds *unfinishedDownloadSegment) *unfinishedDownloadSegment {
 	uds.mu.Lock()
+	pending := uds.dequeueWorker(w)
 	segmentComplete := uds.sectorsCompleted >= uds.erasureCode.MinSectors() || uds.download.isComplete()
 	segmentFailed := uds.sectorsCompleted+uds.workersRemaining < uds.erasureCode.MinSectors()
-	sectorData, workerHasSector := uds.segmentMap[w.hostID.String()]
-
-	sectorCompleted := uds.completedSectors[sectorData.index]
+	_, workerHasSector := uds.segmentMap[w.hostID.String()]
+	sectorsCompleted := uds.sectorsCompletedByHost(w.hostID.String())
 
 	// if the given segment downloading complete/fail, or no sector associated with host for downloading,
-	// or the sector has completed, the worker should be removed.
-	if segmentComplete || segmentFailed || w.onDownloadCooldown() || !workerHasSector || sectorCompleted {
+	// or all sectors of the host have completed, the worker should be removed.
+	if segmentComplete || segmentFailed || w.onDownloadCooldown() || !workerHasSector || sectorsCompleted {
 		uds.mu.Unlock()
 		uds.removeWorker()
 		return nil
 	}
-	defer uds.mu.Unlock()
 
-	// if need more sector, and the sector has not been fetched yet,
+	// if need more sector, and the host holds a sector not fetched yet,
 	// should register the worker and return the segment for downloading.
-	sectorTaken := uds.sectorUsage[sectorData.index]
+	sectorData, sectorAvailable := uds.nextSector(w.hostID.String())
 	sectorsInProgress := uds.sectorsRegistered + uds.sectorsCompleted
 	desiredSectorsInProgress := uds.erasureCode.MinSectors() + uds.overdrive
-	workersDesired := sectorsInProgress < desiredSectorsInProgress && !sectorTaken
+	workersDesired := sectorsInProgress < desiredSectorsInProgress && sectorAvailable
 	if workersDesired {
-		uds.sectorsRegistered++
-		uds.sectorUsage[sectorData.index] = true
+		uds.registerSector(w, sectorData)
+		uds.mu.Unlock()
 		return uds
 	}
 
 	// put this worker on standby for this segment, we can use it to download later.
 	uds.workersStandby = append(uds.workersStandby, w)
+	uds.mu.Unlock()
+
+	// the preferred worker is not used, standby workers might be required instead
+	if pending {
+		uds.cleanUp()
+	}
 	return nil
 }
 
+// updateDownloadLatency updates the smoothed latency of downloading from the host
+func (w *worker) updateDownloadLatency(latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.downloadLatency == 0 {
+		w.downloadLatency = latency
+		return
+	}
+	w.downloadLatency = (w.downloadLatency*3 + latency) / 4
+}
+
+// downloadLatencyObserved returns the smoothed latency of downloading from the host
+func (w *worker) downloadLatencyObserved() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.downloadLatency
+}
+
 // Return true if the worker is on cooldown for download failure.
 func (w *worker) onDownloadCooldown() bool {
 	requiredCooldown := DownloadFailureCooldown
@@ -353,8 +407,9 @@ func (w *worker) onDownloadCooldown() bool {
 func (uds *unfinishedDownloadSegment) unregisterWorker(w *worker) {
 	uds.mu.Lock()
 	uds.sectorsRegistered--
-	sectorIndex := uds.segmentMap[w.hostID.String()].index
-	uds.sectorUsage[sectorIndex] = false
+	sector := uds.workerSectors[w.hostID.String()]
+	delete(uds.workerSectors, w.hostID.String())
+	uds.sectorUsage[sector.index] = false
 	uds.mu.Unlock()
 }
 
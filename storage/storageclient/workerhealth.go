@@ -0,0 +1,133 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"sort"
+	"time"
+)
+
+// workerUploadHealth is the rolling health of uploading sectors to the host of a worker
+type workerUploadHealth struct {
+	observed    bool
+	successRate float64
+	latency     time.Duration
+}
+
+// record updates the health with the outcome of an upload. The latency is only counted for
+// the successful uploads
+func (h *workerUploadHealth) record(success bool, latency time.Duration) {
+	var outcome float64
+	if success {
+		outcome = 1
+	}
+	if !h.observed {
+		h.observed = true
+		h.successRate = outcome
+	} else {
+		h.successRate = h.successRate*(1-uploadHealthSmoothing) + outcome*uploadHealthSmoothing
+	}
+	if !success {
+		return
+	}
+	if h.latency == 0 {
+		h.latency = latency
+		return
+	}
+	h.latency = (h.latency*3 + latency) / 4
+}
+
+// score returns the health score between 0 and 1. The worker not observed yet is regarded
+// as healthy. The success rate is discounted by the latency beyond uploadLatencyTarget
+func (h workerUploadHealth) score() float64 {
+	if !h.observed {
+		return 1
+	}
+	if h.latency <= uploadLatencyTarget {
+		return h.successRate
+	}
+	return h.successRate * float64(uploadLatencyTarget) / float64(h.latency)
+}
+
+// uploadHealthScore returns the upload health score of the worker
+func (w *worker) uploadHealthScore() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.uploadHealth.score()
+}
+
+// rankWorkersForUpload sorts the workers so that the healthy workers come before the flaky
+// workers. Within the healthy and the flaky workers, the workers with fewer segments queued
+// come first, so that a slow worker does not hoard the sectors, and the workers with the same
+// load are sorted from the healthiest to the flakiest. The workers tied in the ranking are
+// rotated by the cursor, see rotateTies
+func rankWorkersForUpload(workers []*worker, cursor int) {
+	scores := make(map[*worker]float64, len(workers))
+	loads := make(map[*worker]int, len(workers))
+	for _, w := range workers {
+		scores[w] = w.uploadHealthScore()
+		loads[w] = w.uploadLoad()
+	}
+	sort.SliceStable(workers, func(i, j int) bool {
+		wi, wj := workers[i], workers[j]
+		if healthyI, healthyJ := scores[wi] >= minHealthyUploadScore, scores[wj] >= minHealthyUploadScore; healthyI != healthyJ {
+			return healthyI
+		}
+		if loads[wi] != loads[wj] {
+			return loads[wi] < loads[wj]
+		}
+		return scores[wi] > scores[wj]
+	})
+	rotateTies(len(workers), cursor, func(i, j int) bool {
+		return loads[workers[i]] == loads[workers[j]] && scores[workers[i]] == scores[workers[j]]
+	}, func(i, j int) {
+		workers[i], workers[j] = workers[j], workers[i]
+	})
+}
+
+// assignSegmentByHealth queues the segment to all workers ranked by rankWorkersForUpload, and
+// signals the workers of distinct hosts in the ranked order until the remaining sectors are
+// covered, along with all idle healthy workers. The other workers are registered as the backup
+// workers, which are signaled when a sector is available again. Thus the flaky workers and the
+// busy workers are signaled only if the idle healthy hosts are not enough.
+func assignSegmentByHealth(workers []*worker, uc *unfinishedUploadSegment) {
+	scores := make([]float64, len(workers))
+	loads := make([]int, len(workers))
+	for i, w := range workers {
+		scores[i] = w.uploadHealthScore()
+		loads[i] = w.uploadLoad()
+	}
+
+	uc.mu.Lock()
+	needed := uc.sectorsAllNeedNum - uc.sectorsCompletedNum - uc.sectorsUploadingNum
+	signaledHosts := make(map[string]struct{})
+	var signaled, backups []*worker
+	for i, w := range workers {
+		host := w.contract.EnodeID.String()
+		_, unused := uc.unusedHosts[host]
+		_, picked := signaledHosts[host]
+		switch {
+		case !unused:
+			// the worker will drop the segment immediately, signal it to release the segment
+			signaled = append(signaled, w)
+		case (scores[i] >= minHealthyUploadScore && loads[i] == 0) || (!picked && len(signaledHosts) < needed):
+			signaledHosts[host] = struct{}{}
+			signaled = append(signaled, w)
+		default:
+			backups = append(backups, w)
+		}
+	}
+	uc.workerBackups = append(uc.workerBackups, backups...)
+	uc.mu.Unlock()
+
+	for _, w := range append(signaled, backups...) {
+		w.mu.Lock()
+		w.pendingSegments = append(w.pendingSegments, uc)
+		w.mu.Unlock()
+	}
+	for _, w := range signaled {
+		w.signalUploadChan(uc)
+	}
+}
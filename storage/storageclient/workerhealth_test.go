@@ -0,0 +1,220 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storageclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/p2p/enode"
+)
+
+// TestWorkerUploadHealth test the upload health score follows the recent upload outcomes,
+// and is discounted by a slow latency
+func TestWorkerUploadHealth(t *testing.T) {
+	var h workerUploadHealth
+	if h.score() != 1 {
+		t.Fatalf("worker not observed should be healthy, got %v", h.score())
+	}
+	h.record(true, time.Second)
+	if h.score() != 1 {
+		t.Fatalf("expect score 1 after a fast success, got %v", h.score())
+	}
+	for i := 0; i != 5; i++ {
+		h.record(false, 0)
+	}
+	if h.score() >= minHealthyUploadScore {
+		t.Fatalf("expect flaky score after consecutive failures, got %v", h.score())
+	}
+	for i := 0; i != 20; i++ {
+		h.record(true, time.Second)
+	}
+	if h.score() < minHealthyUploadScore {
+		t.Fatalf("expect the score to recover after successes, got %v", h.score())
+	}
+
+	slow := workerUploadHealth{}
+	for i := 0; i != 5; i++ {
+		slow.record(true, 4*uploadLatencyTarget)
+	}
+	if slow.score() >= minHealthyUploadScore {
+		t.Errorf("expect slow worker to have a low score, got %v", slow.score())
+	}
+}
+
+// TestAssignSegmentByHealth test a worker with a poor health score receives fewer sector
+// assignments than a healthy peer
+func TestAssignSegmentByHealth(t *testing.T) {
+	flaky := &worker{uploadChan: make(chan struct{}, 1)}
+	flaky.contract.EnodeID = enode.RandomID(enode.ID{}, 0)
+	for i := 0; i != 5; i++ {
+		flaky.uploadHealth.record(false, 0)
+	}
+	healthy := &worker{uploadChan: make(chan struct{}, 1)}
+	healthy.contract.EnodeID = enode.RandomID(enode.ID{}, 1)
+	healthy.uploadHealth.record(true, time.Second)
+
+	assigned := make(map[*worker]int)
+	numSegments, numSectors := 10, 1
+	for i := 0; i != numSegments; i++ {
+		uc := &unfinishedUploadSegment{
+			sectorsAllNeedNum: numSectors,
+			sectorSlotsStatus: make([]bool, numSectors),
+			unusedHosts: map[string]struct{}{
+				flaky.contract.EnodeID.String():   {},
+				healthy.contract.EnodeID.String(): {},
+			},
+		}
+		workers := []*worker{flaky, healthy}
+		rankWorkersForUpload(workers, i)
+		assignSegmentByHealth(workers, uc)
+
+		for _, w := range workers {
+			select {
+			case <-w.uploadChan:
+				assigned[w]++
+			default:
+			}
+		}
+		if len(uc.workerBackups) != 1 || uc.workerBackups[0] != flaky {
+			t.Fatalf("segment %v: expect the flaky worker as the backup", i)
+		}
+	}
+	if assigned[flaky] >= assigned[healthy] {
+		t.Errorf("flaky worker assigned %v segments, healthy worker %v", assigned[flaky], assigned[healthy])
+	}
+	if assigned[healthy] != numSegments {
+		t.Errorf("expect healthy worker assigned %v segments, got %v", numSegments, assigned[healthy])
+	}
+
+	// the flaky worker is still signaled when the healthy workers are not enough
+	uc := &unfinishedUploadSegment{
+		sectorsAllNeedNum: 2,
+		sectorSlotsStatus: make([]bool, 2),
+		unusedHosts: map[string]struct{}{
+			flaky.contract.EnodeID.String():   {},
+			healthy.contract.EnodeID.String(): {},
+		},
+	}
+	assignSegmentByHealth([]*worker{healthy, flaky}, uc)
+	if len(flaky.uploadChan) != 1 || len(healthy.uploadChan) != 1 {
+		t.Errorf("expect both workers signaled when both hosts are needed")
+	}
+}
+
+// TestAssignSegmentByHealth_Load test the sectors are offered to the least loaded workers first.
+// A slow worker with a deep queue and a flaky worker are signaled only as the backups, and the
+// busy workers equal in load take turns to be signaled
+func TestAssignSegmentByHealth_Load(t *testing.T) {
+	newWorker := func(i int) *worker {
+		w := &worker{uploadChan: make(chan struct{}, 1)}
+		w.contract.ID[0] = byte(i)
+		w.contract.EnodeID = enode.RandomID(enode.ID{}, i)
+		return w
+	}
+	var fast []*worker
+	for i := 0; i != 3; i++ {
+		fast = append(fast, newWorker(i))
+	}
+	slow := newWorker(3)
+	for i := 0; i != 5; i++ {
+		slow.pendingSegments = append(slow.pendingSegments, &unfinishedUploadSegment{})
+	}
+	flaky := newWorker(4)
+	for i := 0; i != 5; i++ {
+		flaky.uploadHealth.record(false, 0)
+	}
+	all := append([]*worker{slow, flaky}, fast...)
+
+	newSegment := func(numSectors int) *unfinishedUploadSegment {
+		uc := &unfinishedUploadSegment{
+			sectorsAllNeedNum: numSectors,
+			sectorSlotsStatus: make([]bool, numSectors),
+			unusedHosts:       make(map[string]struct{}),
+		}
+		for _, w := range all {
+			uc.unusedHosts[w.contract.EnodeID.String()] = struct{}{}
+		}
+		return uc
+	}
+	assign := func(cursor int, uc *unfinishedUploadSegment) map[*worker]bool {
+		workers := append([]*worker{}, all...)
+		sortWorkersByContractID(workers)
+		rankWorkersForUpload(workers, cursor)
+		assignSegmentByHealth(workers, uc)
+		signaled := make(map[*worker]bool)
+		for _, w := range all {
+			select {
+			case <-w.uploadChan:
+				signaled[w] = true
+			default:
+			}
+		}
+		return signaled
+	}
+
+	// The fast workers drain their queues, and are all signaled as idle workers
+	numSegments := 12
+	assigned := make(map[*worker]int)
+	for i := 0; i != numSegments; i++ {
+		uc := newSegment(2)
+		for w := range assign(i, uc) {
+			assigned[w]++
+		}
+		if len(uc.workerBackups) != 2 {
+			t.Fatalf("segment %v: expect the slow and the flaky workers as the backups, got %v", i, len(uc.workerBackups))
+		}
+		for _, w := range uc.workerBackups {
+			if w != slow && w != flaky {
+				t.Fatalf("segment %v: unexpected backup worker %v", i, w.contract.ID)
+			}
+		}
+		for _, w := range fast {
+			w.pendingSegments = w.pendingSegments[:0]
+		}
+	}
+	for _, w := range fast {
+		if assigned[w] != numSegments {
+			t.Errorf("expect the fast worker signaled %v times, got %v", numSegments, assigned[w])
+		}
+	}
+	if assigned[slow] != 0 || assigned[flaky] != 0 {
+		t.Errorf("the slow worker signaled %v times, the flaky worker %v times", assigned[slow], assigned[flaky])
+	}
+
+	// The busy workers with the same load take turns to cover the sectors
+	for _, w := range fast {
+		w.pendingSegments = append(w.pendingSegments[:0], slow.pendingSegments...)
+	}
+	assigned = make(map[*worker]int)
+	for i := 0; i != numSegments; i++ {
+		uc := newSegment(1)
+		signaled := assign(i, uc)
+		if len(signaled) != 1 {
+			t.Fatalf("segment %v: expect 1 worker signaled, got %v", i, len(signaled))
+		}
+		for w := range signaled {
+			assigned[w]++
+		}
+		for _, w := range all {
+			w.pendingSegments = w.pendingSegments[:len(w.pendingSegments)-1]
+		}
+	}
+	for _, w := range all {
+		expect := numSegments / 4
+		if w == flaky {
+			expect = 0
+		}
+		if assigned[w] != expect {
+			t.Errorf("worker %v: expect signaled %v times, got %v", w.contract.ID[0], expect, assigned[w])
+		}
+	}
+
+	// Every sector is offered to a ready worker even if all workers are busy or flaky
+	uc := newSegment(len(all))
+	if signaled := assign(0, uc); len(signaled) != len(all) {
+		t.Errorf("expect all %v workers signaled, got %v", len(all), len(signaled))
+	}
+}
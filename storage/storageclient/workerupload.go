@@ -7,6 +7,7 @@ package storageclient
 import (
 	"time"
 
+	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/storage"
 )
 
@@ -76,14 +77,7 @@ func (w *worker) isReady(uc *unfinishedUploadSegment) bool {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	uploadAbility := false
-	if storage.ENV == storage.EnvTest {
-		uploadAbility = true
-	}
-	if meta, ok := w.client.contractManager.RetrieveActiveContract(w.contract.ID); ok {
-		uploadAbility = meta.Status.UploadAbility
-	}
-
+	uploadAbility := w.client.contractUploadAbility(w.contract.ID)
 	onCoolDown := w.onUploadCoolDown()
 	uploadTerminated := w.uploadTerminated
 
@@ -96,6 +90,14 @@ func (w *worker) isReady(uc *unfinishedUploadSegment) bool {
 	return true
 }
 
+// contractUploadAbility returns whether the active contract is able to upload
+func (client *StorageClient) contractUploadAbility(id storage.ContractID) bool {
+	if meta, ok := client.contractManager.RetrieveActiveContract(id); ok {
+		return meta.Status.UploadAbility
+	}
+	return storage.ENV == storage.EnvTest
+}
+
 // Signal worker by sending uploadChan and then worker will retrieve sector index to upload sector
 func (w *worker) signalUploadChan(uc *unfinishedUploadSegment) {
 	select {
@@ -106,6 +108,12 @@ func (w *worker) signalUploadChan(uc *unfinishedUploadSegment) {
 
 // upload will perform some upload work
 func (w *worker) upload(uc *unfinishedUploadSegment, sectorIndex uint64) error {
+	// wait for the upload bandwidth before holding the connection
+	if err := w.client.uploadLimiter.wait(uint64(len(uc.physicalSegmentData[sectorIndex])), w.client.tm.StopChan()); err != nil {
+		w.uploadFailed(uc, sectorIndex)
+		return err
+	}
+
 	sp, hostInfo, err := w.checkConnection()
 	defer sp.RevisionOrRenewingDone()
 
@@ -116,20 +124,44 @@ func (w *worker) upload(uc *unfinishedUploadSegment, sectorIndex uint64) error {
 	}
 
 	// upload segment to host
+	start := time.Now()
 	root, err := w.client.Append(sp, uc.physicalSegmentData[sectorIndex], hostInfo)
 	if err != nil {
 		w.client.log.Error("Worker failed to upload", "err", err)
 		w.uploadFailed(uc, sectorIndex)
 		return err
 	}
+
+	// confirm the sector is stored by the host, and add it to the storage clientFile
+	err = w.commitUploadedSector(uc, sectorIndex, root, func(root common.Hash) ([]byte, error) {
+		return w.client.Download(sp, root, 0, uint32(storage.SectorSize), hostInfo)
+	})
+	if err != nil {
+		w.uploadFailed(uc, sectorIndex)
+		return err
+	}
 	w.mu.Lock()
 	w.uploadConsecutiveFailures = 0
+	w.uploadHealth.record(true, time.Since(start))
 	w.mu.Unlock()
+	w.client.uploadBreaker.recordResult(false, time.Now())
+	return nil
+}
+
+// commitUploadedSector confirms the sector uploaded based on the upload confirmation policy,
+// and then adds the sector to the file and counts the sector as completed
+func (w *worker) commitUploadedSector(uc *unfinishedUploadSegment, sectorIndex uint64, root common.Hash, download sectorDownloader) error {
+	w.client.lock.Lock()
+	policy := w.client.persist.UploadConfirmPolicy
+	w.client.lock.Unlock()
+
+	if err := confirmUploadedSector(policy, root, download); err != nil {
+		w.client.log.Error("Worker failed to confirm the uploaded sector", "err", err)
+		return err
+	}
 	// Add sector to storage clientFile
-	err = uc.fileEntry.AddSector(w.contract.EnodeID, root, int(uc.index), int(sectorIndex))
-	if err != nil {
+	if err := uc.fileEntry.AddSectorOfKeyGeneration(w.contract.EnodeID, root, int(uc.index), int(sectorIndex), uc.keyGeneration); err != nil {
 		w.client.log.Error("Worker failed to add new sector in dxfile", "err", err)
-		w.uploadFailed(uc, sectorIndex)
 		return err
 	}
 	// Upload is complete. Update the state of the Segment and the storage client's memory
@@ -139,11 +171,10 @@ func (w *worker) upload(uc *unfinishedUploadSegment, sectorIndex uint64) error {
 	uc.sectorsUploadingNum--
 	uc.sectorsCompletedNum++
 	uc.physicalSegmentData[sectorIndex] = nil
-	uc.memoryReleased += uint64(releaseSize)
+	releaseMemory := uc.releaseMemory(uint64(releaseSize))
 	uc.mu.Unlock()
-	w.client.memoryManager.Return(uint64(releaseSize))
+	w.client.memoryManager.Return(releaseMemory)
 	w.client.cleanupUploadSegment(uc)
-
 	return nil
 }
 
@@ -176,11 +207,11 @@ func (w *worker) preProcessUploadSegment(uc *unfinishedUploadSegment) (*unfinish
 	isNeedUpload := uc.sectorsAllNeedNum > uc.sectorsCompletedNum+uc.sectorsUploadingNum
 
 	// If the segment does not need help from this worker, release the segment
-	if isComplete || !candidateHost || !uploadAbility || onCoolDown {
+	if isComplete || uc.cancelled || !candidateHost || !uploadAbility || onCoolDown {
 		// This worker no longer needs to track this segment
 		uc.mu.Unlock()
 		w.dropSegment(uc)
-		w.client.log.Info("Worker will drop a segment due to it's status: complete/notCandidate/uploadInAbility/onCoolDown")
+		w.client.log.Info("Worker will drop a segment due to it's status: complete/cancelled/notCandidate/uploadInAbility/onCoolDown")
 		return nil, 0
 	}
 
@@ -224,7 +255,9 @@ func (w *worker) uploadFailed(uc *unfinishedUploadSegment, sectorIndex uint64) {
 		w.mu.Lock()
 		w.uploadRecentFailure = time.Now()
 		w.uploadConsecutiveFailures++
+		w.uploadHealth.record(false, 0)
 		w.mu.Unlock()
+		w.client.uploadBreaker.recordResult(true, time.Now())
 	}
 
 	// Unregister the sector from the segment and hunt for a replacement
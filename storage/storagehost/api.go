@@ -7,11 +7,14 @@ package storagehost
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/DxChainNetwork/godx/accounts"
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/unit"
 	"github.com/DxChainNetwork/godx/storage"
+	sm "github.com/DxChainNetwork/godx/storage/storagehost/storagemanager"
 )
 
 // HostPrivateAPI is the api for private usage
@@ -31,6 +34,11 @@ func (h *HostPrivateAPI) Version() string {
 	return Version
 }
 
+// Capabilities return the features supported by the storage host
+func (h *HostPrivateAPI) Capabilities() storage.Capabilities {
+	return h.storageHost.Capabilities()
+}
+
 // SectorSize return the sector size as a basic storage unit of the storage system.
 func (h *HostPrivateAPI) SectorSize() uint64 {
 	return storage.SectorSize
@@ -58,6 +66,23 @@ func (h *HostPrivateAPI) Announce() string {
 	return fmt.Sprintf("Announcement transaction: %v", hash.Hex())
 }
 
+// Drain stops accepting new contracts and uploads, waits for the in-flight negotiations and
+// submits the due storage proofs, so that the host could be shut down cleanly
+func (h *HostPrivateAPI) Drain() string {
+	if err := h.storageHost.Drain(); err != nil {
+		return fmt.Sprintf("failed to drain the storage host: %v", err)
+	}
+	return "the storage host has been drained and is ready to shut down"
+}
+
+// Undrain accepts the new contracts and uploads again after the storage host is drained
+func (h *HostPrivateAPI) Undrain() string {
+	if err := h.storageHost.Undrain(); err != nil {
+		return fmt.Sprintf("failed to undrain the storage host: %v", err)
+	}
+	return "the storage host accepts new contracts and uploads again"
+}
+
 // Folders return all the folders
 func (h *HostPrivateAPI) Folders() []storage.HostFolder {
 	return h.storageHost.StorageManager.Folders()
@@ -80,6 +105,10 @@ func (h *HostPrivateAPI) GetHostConfig() storage.HostIntConfigForDisplay {
 		MaxReviseBatchSize:     unit.FormatStorage(config.MaxReviseBatchSize, false),
 		WindowSize:             unit.FormatTime(config.WindowSize),
 		PaymentAddress:         config.PaymentAddress.String(),
+		RevisionBatchWindow:    config.RevisionBatchWindow.String(),
+		ProofSubmissionMargin:  unit.FormatTime(config.ProofSubmissionMargin),
+		ReadVerificationRate:   strconv.FormatFloat(config.ReadVerificationRate, 'f', -1, 64),
+		FolderSelection:        config.FolderSelection,
 		Deposit:                unit.FormatCurrency(config.Deposit, "/byte/block"),
 		DepositBudget:          unit.FormatCurrency(config.DepositBudget, "/contract"),
 		MaxDeposit:             unit.FormatCurrency(config.MaxDeposit),
@@ -130,6 +159,20 @@ func (h *HostPrivateAPI) GetProofWindow() string {
 	return unit.FormatTime(storage.ProofWindowSize)
 }
 
+// PreflightStorageProof builds the storage proof of the storage contract and verifies it locally,
+// to check the data of the storage contract is intact before the proof window opens
+func (h *HostPrivateAPI) PreflightStorageProof(contractID common.Hash) (string, error) {
+	if err := h.storageHost.PreflightStorageProof(contractID); err != nil {
+		return "", err
+	}
+	return "storage proof preflight passed", nil
+}
+
+// ContractStorageUsage return the number of sectors and bytes stored for the storage contract
+func (h *HostPrivateAPI) ContractStorageUsage(contractID common.Hash) (ContractStorageUsage, error) {
+	return h.storageHost.ContractStorageUsage(contractID)
+}
+
 // AddStorageFolder add a storage folder with a specified size
 func (h *HostPrivateAPI) AddStorageFolder(path string, sizeStr string) (string, error) {
 	size, err := unit.ParseStorage(sizeStr)
@@ -165,6 +208,12 @@ func (h *HostPrivateAPI) DeleteFolder(folderPath string) (string, error) {
 	return "successfully delete the storage folder", nil
 }
 
+// VerifyFolderConsistency cross check the stored sector count of the folder against the usage
+// bitmap and the sector index, and repair the folder if they diverge
+func (h *HostPrivateAPI) VerifyFolderConsistency(folderPath string) (storage.HostFolderConsistency, error) {
+	return h.storageHost.StorageManager.VerifyFolderConsistency(folderPath)
+}
+
 // hostSetterCallbacks is the mapping from the field name to the setter function
 var hostSetterCallbacks = map[string]func(*HostPrivateAPI, string) error{
 	"acceptingContracts":     (*HostPrivateAPI).setAcceptingContracts,
@@ -172,6 +221,10 @@ var hostSetterCallbacks = map[string]func(*HostPrivateAPI, string) error{
 	"maxDuration":            (*HostPrivateAPI).setMaxDuration,
 	"maxReviseBatchSize":     (*HostPrivateAPI).setMaxReviseBatchSize,
 	"paymentAddress":         (*HostPrivateAPI).setPaymentAddress,
+	"revisionBatchWindow":    (*HostPrivateAPI).setRevisionBatchWindow,
+	"proofSubmissionMargin":  (*HostPrivateAPI).setProofSubmissionMargin,
+	"readVerificationRate":   (*HostPrivateAPI).setReadVerificationRate,
+	"folderSelection":        (*HostPrivateAPI).setFolderSelection,
 	"deposit":                (*HostPrivateAPI).setDeposit,
 	"depositBudget":          (*HostPrivateAPI).setDepositBudget,
 	"maxDeposit":             (*HostPrivateAPI).setMaxDeposit,
@@ -212,6 +265,13 @@ func (h *HostPrivateAPI) SetConfig(config map[string]string) (string, error) {
 	if err = h.storageHost.syncConfig(); err != nil {
 		return "", err
 	}
+	// apply the read verification rate and the folder selection strategy to the storage manager
+	if h.storageHost.StorageManager != nil {
+		h.storageHost.StorageManager.SetReadVerificationRate(h.storageHost.config.ReadVerificationRate)
+		if err = h.storageHost.StorageManager.SetFolderSelection(h.storageHost.config.FolderSelection); err != nil {
+			return "", err
+		}
+	}
 	return `Successfully set the host config. Next please use 
 
 	shost.announce()
@@ -240,12 +300,16 @@ func (h *HostPrivateAPI) setMaxDownloadBatchSize(valStr string) error {
 	return nil
 }
 
-// setMaxDuration set host MaxDuration to value
+// setMaxDuration set host MaxDuration to value. The contracts of the max duration must not
+// exceed the max contract duration allowed on chain
 func (h *HostPrivateAPI) setMaxDuration(str string) error {
 	val, err := unit.ParseTime(str)
 	if err != nil {
 		return fmt.Errorf("invalid time string: %v", err)
 	}
+	if err = checkContractDuration(val, h.storageHost.config.WindowSize, h.storageHost.maxContractDuration()); err != nil {
+		return err
+	}
 	h.storageHost.config.MaxDuration = val
 	return nil
 }
@@ -260,6 +324,57 @@ func (h *HostPrivateAPI) setMaxReviseBatchSize(str string) error {
 	return nil
 }
 
+// setRevisionBatchWindow set host RevisionBatchWindow to value
+func (h *HostPrivateAPI) setRevisionBatchWindow(str string) error {
+	val, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("invalid duration string: %v", err)
+	}
+	if val < 0 {
+		return fmt.Errorf("negative duration: %v", val)
+	}
+	h.storageHost.config.RevisionBatchWindow = val
+	return nil
+}
+
+// setProofSubmissionMargin set host ProofSubmissionMargin to value. The margin must leave
+// room in the proof window for the retries
+func (h *HostPrivateAPI) setProofSubmissionMargin(str string) error {
+	val, err := unit.ParseTime(str)
+	if err != nil {
+		return fmt.Errorf("invalid time string: %v", err)
+	}
+	if maxMargin := maxProofSubmissionMargin(h.storageHost.config.WindowSize); val > maxMargin {
+		return fmt.Errorf("margin too large: %v blocks, the window of %v blocks allows at most %v blocks", val, h.storageHost.config.WindowSize, maxMargin)
+	}
+	h.storageHost.config.ProofSubmissionMargin = val
+	return nil
+}
+
+// setReadVerificationRate set host ReadVerificationRate to value. The rate must be
+// between 0 and 1
+func (h *HostPrivateAPI) setReadVerificationRate(str string) error {
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return fmt.Errorf("invalid float string: %v", err)
+	}
+	if val < 0 || val > 1 {
+		return fmt.Errorf("rate out of range: %v, expect between 0 and 1", val)
+	}
+	h.storageHost.config.ReadVerificationRate = val
+	return nil
+}
+
+// setFolderSelection set host FolderSelection to the strategy of selecting the storage folder
+// to store a new sector
+func (h *HostPrivateAPI) setFolderSelection(str string) error {
+	if err := sm.CheckFolderSelection(str); err != nil {
+		return err
+	}
+	h.storageHost.config.FolderSelection = str
+	return nil
+}
+
 // setPaymentAddress configure the account address used to sign the storage contract,
 // which has and can only be the address of the local wallet.
 func (h *HostPrivateAPI) setPaymentAddress(addrStr string) error {
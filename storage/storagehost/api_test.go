@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/unit"
@@ -37,11 +38,51 @@ func TestHostPrivateAPI_SetConfig(t *testing.T) {
 			storage.HostIntConfig{MaxDuration: uint64(mustParseTime("1b"))},
 			nil,
 		},
+		"maxDuration at max contract duration": {
+			map[string]string{"maxDuration": "43788h"},
+			storage.HostIntConfig{MaxDuration: uint64(mustParseTime("43788h"))},
+			nil,
+		},
 		"maxReviseBatchSize": {
 			map[string]string{"maxReviseBatchSize": "1kb"},
 			storage.HostIntConfig{MaxReviseBatchSize: uint64(mustParseStorage("1kb"))},
 			nil,
 		},
+		"revisionBatchWindow": {
+			map[string]string{"revisionBatchWindow": "50ms"},
+			storage.HostIntConfig{RevisionBatchWindow: 50 * time.Millisecond},
+			nil,
+		},
+		"negative revisionBatchWindow": {
+			map[string]string{"revisionBatchWindow": "-50ms"},
+			storage.HostIntConfig{},
+			errors.New("negative duration"),
+		},
+		"proofSubmissionMargin exceeds window": {
+			map[string]string{"proofSubmissionMargin": "13h"},
+			storage.HostIntConfig{},
+			errors.New("margin too large"),
+		},
+		"readVerificationRate": {
+			map[string]string{"readVerificationRate": "0.5"},
+			storage.HostIntConfig{ReadVerificationRate: 0.5},
+			nil,
+		},
+		"readVerificationRate out of range": {
+			map[string]string{"readVerificationRate": "1.5"},
+			storage.HostIntConfig{},
+			errors.New("rate out of range"),
+		},
+		"folderSelection": {
+			map[string]string{"folderSelection": "roundrobin"},
+			storage.HostIntConfig{FolderSelection: "roundrobin"},
+			nil,
+		},
+		"folderSelection unknown": {
+			map[string]string{"folderSelection": "random"},
+			storage.HostIntConfig{},
+			errors.New("unknown folder selection strategy"),
+		},
 		"paymentAddress": {
 			map[string]string{"paymentAddress": "0x1"},
 			storage.HostIntConfig{},
@@ -149,7 +190,9 @@ func TestHostPrivateAPI_SetConfig(t *testing.T) {
 	dir := tempDir(t.Name())
 	for key, test := range tests {
 		// Create a new storage host api and apply the test config
-		h := NewHostPrivateAPI(&StorageHost{persistDir: dir})
+		// The proof window of the host is the default
+		h := NewHostPrivateAPI(&StorageHost{persistDir: dir, config: storage.HostIntConfig{WindowSize: uint64(storage.ProofWindowSize)}})
+		test.expect.WindowSize = uint64(storage.ProofWindowSize)
 		_, err := h.SetConfig(test.config)
 		// errors should be as expected
 		if (err == nil) != (test.err == nil) {
@@ -8,10 +8,12 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/DxChainNetwork/godx/accounts"
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/core/vm"
 	"github.com/DxChainNetwork/godx/crypto"
 	"github.com/DxChainNetwork/godx/log"
 	"github.com/DxChainNetwork/godx/p2p"
@@ -28,12 +30,18 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 			_ = sp.SendHostAckMsg()
 			h.ethBackend.CheckAndUpdateConnection(sp.PeerNode())
 		} else if hostNegotiateErr != nil {
-			_ = sp.SendHostNegotiateErrorMsg()
+			_ = sp.SendHostNegotiateErrorMsg(hostNegotiateErr)
 		}
 	}()
 
+	if err := h.startNegotiation(); err != nil {
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrUnavailable, err)
+		return
+	}
+	defer h.finishNegotiation()
+
 	if !h.externalConfig().AcceptingContracts {
-		hostNegotiateErr = errors.New("host is not accepting new contracts")
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrRejected, errors.New("host is not accepting new contracts"))
 		return
 	}
 
@@ -45,15 +53,17 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 	}
 
 	sc := req.StorageContract
+
 	clientPK, err := crypto.SigToPub(sc.RLPHash().Bytes(), req.Sign)
 	if err != nil {
-		hostNegotiateErr = fmt.Errorf("failed to recover the public key from the signature: %s", err.Error())
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, fmt.Errorf("failed to recover the public key from the signature: %s", err.Error()))
 		return
 	}
 
 	// Check host balance >= storage contract cost
 	hostAddress := sc.ValidProofOutputs[1].Address
-	stateDB, err := h.ethBackend.GetBlockChain().State()
+	blockChain := h.ethBackend.GetBlockChain()
+	stateDB, err := blockChain.State()
 	if err != nil {
 		hostNegotiateErr = fmt.Errorf("failed to get the state db: %s", err.Error())
 		return
@@ -61,7 +71,15 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 
 	// check the storage host balance
 	if stateDB.GetBalance(hostAddress).Cmp(sc.HostCollateral.Value) < 0 {
-		hostNegotiateErr = fmt.Errorf("insufficient host balance")
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInsufficientFunds, fmt.Errorf("insufficient host balance"))
+		return
+	}
+
+	// check the host collateral against the collateral floor of the next block, so that the host
+	// does not sign the storage contract which will be rejected on chain
+	nextBlock := new(big.Int).Add(blockChain.CurrentBlock().Number(), big.NewInt(1))
+	if err := vm.CheckHostCollateral(sc.ClientCollateral.Value, sc.HostCollateral.Value, blockChain.Config().MinHostCollateral(nextBlock)); err != nil {
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrRejected, err)
 		return
 	}
 
@@ -94,13 +112,13 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 		oldContractID := req.OldContractID
 		err = verifyRenewedContract(h, &sc, clientPK, hostPK, oldContractID)
 		if err != nil {
-			hostNegotiateErr = fmt.Errorf("storage host failed to verify the renewed storage contract: %s", err.Error())
+			hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, fmt.Errorf("storage host failed to verify the renewed storage contract: %s", err.Error()))
 			return
 		}
 	} else {
 		err = verifyStorageContract(h, &sc, clientPK, hostPK)
 		if err != nil {
-			hostNegotiateErr = fmt.Errorf("storage host failed to verify the storage contract: %s", err.Error())
+			hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, fmt.Errorf("storage host failed to verify the storage contract: %s", err.Error()))
 			return
 		}
 	}
@@ -120,7 +138,7 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 	}
 
 	if msg.Code == storage.ClientNegotiateErrorMsg {
-		clientNegotiateErr = storage.ErrClientNegotiate
+		clientNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrClientNegotiate)
 		return
 	}
 
@@ -187,7 +205,7 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 	if msg.Code == storage.ClientCommitSuccessMsg {
 		if req.Renew {
 			h.lock.RLock()
-			oldSo, err := getStorageResponsibility(h.db, req.OldContractID)
+			oldSo, err := h.loadStorageResponsibility(req.OldContractID)
 			h.lock.RUnlock()
 
 			if err == nil {
@@ -201,7 +219,7 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 		}
 
 		if err := finalizeStorageResponsibility(h, so); err != nil {
-			_ = sp.SendHostCommitFailedMsg()
+			_ = sp.SendHostCommitFailedMsg(err)
 
 			// wait for client ack msg
 			msg, err = sp.HostWaitContractResp()
@@ -215,10 +233,10 @@ func ContractCreateHandler(h *StorageHost, sp storage.Peer, contractCreateReqMsg
 			return
 		}
 	} else if msg.Code == storage.ClientCommitFailedMsg {
-		clientCommitErr = storage.ErrClientCommit
+		clientCommitErr = storage.DecodeNegotiationError(msg, storage.ErrClientCommit)
 		return
 	} else if msg.Code == storage.ClientNegotiateErrorMsg {
-		clientNegotiateErr = storage.ErrClientNegotiate
+		clientNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrClientNegotiate)
 		return
 	}
 
@@ -387,7 +405,7 @@ func verifyRenewedContract(h *StorageHost, sc *types.StorageContract, clientPK *
 	lockedStorageDeposit := h.financialMetrics.LockedStorageDeposit
 	hostAddress := crypto.PubkeyToAddress(*hostPK)
 	config := h.config
-	so, err := getStorageResponsibility(h.db, oldContractID)
+	so, err := h.loadStorageResponsibility(oldContractID)
 	if err != nil {
 		h.lock.RUnlock()
 		return fmt.Errorf("failed to get storage responsibility in verifyRenewedContract,error: %v", err)
@@ -478,3 +496,11 @@ func rollbackPeerStatic(h *StorageHost, sp storage.Peer) {
 	delete(h.clientToContract, sp.PeerNode().String())
 	h.lock.Unlock()
 }
+
+// newHostNegotiationError creates the negotiation error with the code to be sent to the storage
+// client, so that the client knows why the negotiation failed. The error detail is only logged
+// locally, and not sent to the client
+func newHostNegotiationError(code storage.NegotiationErrorCode, err error) *storage.NegotiationError {
+	log.Debug("storage host failed the negotiation", "code", code, "err", err)
+	return storage.NewNegotiationError(code, storage.ErrHostNegotiate.Error(), err.Error())
+}
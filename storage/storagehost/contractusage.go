@@ -0,0 +1,42 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// ContractStorageUsage is the storage used by the data of a storage contract
+type ContractStorageUsage struct {
+	ContractID common.Hash `json:"contractID"`
+
+	// Sectors is the number of sectors stored for the contract, and StoredBytes is the
+	// disk space taken by the sectors
+	Sectors     uint64 `json:"sectors"`
+	StoredBytes uint64 `json:"storedBytes"`
+
+	// FileSize is the size of the data recorded in the latest revision of the contract
+	FileSize uint64 `json:"fileSize"`
+}
+
+// ContractStorageUsage return the storage used by the data of the storage contract. The usage
+// is counted from the sector roots recorded in the storage responsibility of the contract, so
+// the other contracts are not scanned
+func (h *StorageHost) ContractStorageUsage(contractID common.Hash) (ContractStorageUsage, error) {
+	h.lock.RLock()
+	so, err := h.loadStorageResponsibility(contractID)
+	h.lock.RUnlock()
+	if err != nil {
+		return ContractStorageUsage{}, err
+	}
+	sectors := uint64(len(so.SectorRoots))
+	return ContractStorageUsage{
+		ContractID:  contractID,
+		Sectors:     sectors,
+		StoredBytes: sectors * storage.SectorSize,
+		FileSize:    so.fileSize(),
+	}, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestStorageHost_ContractStorageUsage test the usage reported for a storage contract matches
+// the sectors added under the contract, and is not affected by the other contracts
+func TestStorageHost_ContractStorageUsage(t *testing.T) {
+	h := newTestStorageHost(t)
+	defer h.db.Close()
+
+	so, other := newTestRevisionResponsibility(1), newTestRevisionResponsibility(2)
+	other.SectorRoots = []common.Hash{{0xff}}
+	for _, s := range []StorageResponsibility{so, other} {
+		if err := h.storeStorageResponsibility(s.id(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	usage, err := h.ContractStorageUsage(so.id())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Sectors != 0 || usage.StoredBytes != 0 {
+		t.Errorf("expect no usage of the new contract, got %+v", usage)
+	}
+
+	// add sectors under the contract
+	for numSectors := uint64(1); numSectors <= 3; numSectors++ {
+		so.SectorRoots = append(so.SectorRoots, common.Hash{byte(numSectors)})
+		so = reviseTestResponsibility(so, numSectors)
+		so.StorageContractRevisions[len(so.StorageContractRevisions)-1].NewFileSize = numSectors * storage.SectorSize
+		if err = h.storeStorageResponsibility(so.id(), so); err != nil {
+			t.Fatal(err)
+		}
+		usage, err = h.ContractStorageUsage(so.id())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := ContractStorageUsage{
+			ContractID:  so.id(),
+			Sectors:     numSectors,
+			StoredBytes: numSectors * storage.SectorSize,
+			FileSize:    numSectors * storage.SectorSize,
+		}
+		if usage != expect {
+			t.Errorf("%v sectors: expect usage %+v, got %+v", numSectors, expect, usage)
+		}
+	}
+
+	if _, err = h.ContractStorageUsage(common.Hash{}); err == nil {
+		t.Errorf("usage reported for an unknown contract")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/ethdb"
 	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 // openDB opens the db specified by path. If the db file not exist, create a new one
@@ -27,10 +29,67 @@ func putStorageResponsibility(db ethdb.Database, storageContractID common.Hash,
 	return scdb.StoreWithPrefix(storageContractID, data, prefixStorageResponsibility)
 }
 
+// putStorageResponsibilities storage the storage responsibilities to DB in one synced write,
+// so that the storage responsibilities are durable after return
+func putStorageResponsibilities(db *ethdb.LDBDatabase, sos map[common.Hash]StorageResponsibility) error {
+	batch := new(leveldb.Batch)
+	for id, so := range sos {
+		data, err := rlp.EncodeToBytes(so)
+		if err != nil {
+			return err
+		}
+		key, err := ethdb.MakeKey(prefixStorageResponsibility, id)
+		if err != nil {
+			return err
+		}
+		batch.Put(key, data)
+	}
+	return db.LDB().Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+// forEachStorageResponsibility calls fn with each storage responsibility stored in DB
+func forEachStorageResponsibility(db *ethdb.LDBDatabase, fn func(so StorageResponsibility)) error {
+	iter := db.NewIteratorWithPrefix([]byte(prefixStorageResponsibility))
+	defer iter.Release()
+	for iter.Next() {
+		var so StorageResponsibility
+		if err := rlp.DecodeBytes(iter.Value(), &so); err != nil {
+			return err
+		}
+		fn(so)
+	}
+	return iter.Error()
+}
+
+// loadStorageResponsibility get the latest storageResponsibility, including the one not yet
+// written to DB by the revision batcher
+func (h *StorageHost) loadStorageResponsibility(storageContractID common.Hash) (StorageResponsibility, error) {
+	if so, exist := h.revisionBatcher.get(storageContractID); exist {
+		return so, nil
+	}
+	return getStorageResponsibility(h.db, storageContractID)
+}
+
+// storeStorageResponsibility storage the storageResponsibility to DB. If a revision of the
+// storage responsibility is waiting in the revision batcher, the storage responsibility is
+// added to the batch instead, so that it is not overwritten by the earlier revision. The batch
+// is flushed right away and waited for, so that the storage responsibility is durable on return
+func (h *StorageHost) storeStorageResponsibility(storageContractID common.Hash, so StorageResponsibility) error {
+	h.proofWindows.update(so)
+	if _, exist := h.revisionBatcher.get(storageContractID); exist {
+		batch := h.revisionBatcher.add(storageContractID, so, h.config.RevisionBatchWindow)
+		h.revisionBatcher.flush(batch)
+		return batch.wait()
+	}
+	return putStorageResponsibility(h.db, storageContractID, so)
+}
+
 func (h *StorageHost) deleteStorageResponsibilities(soids []common.Hash) error {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 	for _, soid := range soids {
+		h.revisionBatcher.discard(soid)
+		h.proofWindows.remove(soid)
 		err := deleteStorageResponsibility(h.db, soid)
 		if err != nil {
 			return err
@@ -44,7 +103,7 @@ func (h *StorageHost) deleteStorageResponsibilities(soids []common.Hash) error {
 func (h *StorageHost) GetStorageResponsibility(storageContractID common.Hash) (StorageResponsibility, error) {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
-	return getStorageResponsibility(h.db, storageContractID)
+	return h.loadStorageResponsibility(storageContractID)
 }
 
 //deleteStorageResponsibility delete storageResponsibility from DB
@@ -12,6 +12,7 @@ import (
 	"github.com/DxChainNetwork/godx/core/types"
 	"github.com/DxChainNetwork/godx/crypto/merkle"
 	"github.com/DxChainNetwork/godx/storage"
+	sm "github.com/DxChainNetwork/godx/storage/storagehost/storagemanager"
 )
 
 const (
@@ -29,8 +30,9 @@ const (
 
 const (
 	// storage responsibility related constants
-	postponedExecution    = 3  //Total length of time to start a test task
-	confirmedBufferHeight = 40 //signing transaction not confirmed maximum time
+	postponedExecution     = 3  //Total length of time to start a test task
+	proofSubmissionRetries = 2  //number of retries reserved before the proof window end
+	confirmedBufferHeight  = 40 //signing transaction not confirmed maximum time
 
 	//prefixStorageResponsibility db prefix for StorageResponsibility
 	prefixStorageResponsibility = "StorageResponsibility-"
@@ -40,6 +42,10 @@ const (
 
 	//Total time to sign the contract
 	postponedExecutionBuffer = 12 * unit.BlocksPerHour
+
+	// upcomingProofHorizon is the number of blocks ahead that the storage proofs whose proof
+	// window opens within are reported as upcoming in the host health
+	upcomingProofHorizon = unit.BlocksPerDay
 )
 
 var (
@@ -73,10 +79,14 @@ func calculateSectorHeight() uint64 {
 // it is the first time use the host service, or cannot find the setting file
 func defaultConfig() storage.HostIntConfig {
 	return storage.HostIntConfig{
-		MaxDownloadBatchSize: uint64(storage.DefaultMaxDownloadBatchSize),
-		MaxDuration:          uint64(storage.DefaultMaxDuration),
-		MaxReviseBatchSize:   uint64(storage.DefaultMaxReviseBatchSize),
-		WindowSize:           uint64(storage.ProofWindowSize),
+		MaxDownloadBatchSize:  uint64(storage.DefaultMaxDownloadBatchSize),
+		MaxDuration:           uint64(storage.DefaultMaxDuration),
+		MaxReviseBatchSize:    uint64(storage.DefaultMaxReviseBatchSize),
+		WindowSize:            uint64(storage.ProofWindowSize),
+		RevisionBatchWindow:   storage.DefaultRevisionBatchWindow,
+		ProofSubmissionMargin: storage.DefaultProofSubmissionMargin,
+		ReadVerificationRate:  storage.DefaultReadVerificationRate,
+		FolderSelection:       sm.FolderSelectionMostFree,
 
 		Deposit:       storage.DefaultDeposit,
 		DepositBudget: storage.DefaultDepositBudget,
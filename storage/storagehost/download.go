@@ -18,6 +18,7 @@ import (
 	"github.com/DxChainNetwork/godx/log"
 	"github.com/DxChainNetwork/godx/p2p"
 	"github.com/DxChainNetwork/godx/storage"
+	"github.com/DxChainNetwork/godx/storage/storagehost/storagemanager"
 )
 
 // DownloadHandler handles the download negotiation
@@ -29,7 +30,7 @@ func DownloadHandler(h *StorageHost, sp storage.Peer, downloadReqMsg p2p.Msg) {
 			_ = sp.SendHostAckMsg()
 			h.ethBackend.CheckAndUpdateConnection(sp.PeerNode())
 		} else if hostNegotiateErr != nil {
-			_ = sp.SendHostNegotiateErrorMsg()
+			_ = sp.SendHostNegotiateErrorMsg(hostNegotiateErr)
 		}
 	}()
 
@@ -43,19 +44,19 @@ func DownloadHandler(h *StorageHost, sp storage.Peer, downloadReqMsg p2p.Msg) {
 
 	// get storage responsibility
 	h.lock.RLock()
-	so, err := getStorageResponsibility(h.db, req.StorageContractID)
+	so, err := h.loadStorageResponsibility(req.StorageContractID)
 	snapshotSo := so
 	h.lock.RUnlock()
 
 	// it is totally fine not getting the storage responsibility
 	if err != nil {
-		hostNegotiateErr = err
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrContractNotFound, err)
 		return
 	}
 
 	// check whether the contract is empty
 	if reflect.DeepEqual(so.OriginStorageContract, types.StorageContract{}) {
-		hostNegotiateErr = errors.New("no contract locked")
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrContractNotFound, errors.New("no contract locked"))
 		return
 	}
 
@@ -77,7 +78,7 @@ func DownloadHandler(h *StorageHost, sp storage.Peer, downloadReqMsg p2p.Msg) {
 		err = errors.New("the number of missed proof values not match the old")
 	}
 	if err != nil {
-		hostNegotiateErr = fmt.Errorf("download request validation failed: %s", err.Error())
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, fmt.Errorf("download request validation failed: %s", err.Error()))
 		return
 	}
 
@@ -114,7 +115,7 @@ func DownloadHandler(h *StorageHost, sp storage.Peer, downloadReqMsg p2p.Msg) {
 	totalCost := settings.BaseRPCPrice.Add(bandwidthCost).Add(sectorAccessCost)
 	err = verifyPaymentRevision(currentRevision, newRevision, h.blockHeight, totalCost.BigIntPtr())
 	if err != nil {
-		hostNegotiateErr = fmt.Errorf("failed to verify the payment revision: %s", err.Error())
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, fmt.Errorf("failed to verify the payment revision: %s", err.Error()))
 		return
 	}
 
@@ -141,6 +142,10 @@ func DownloadHandler(h *StorageHost, sp storage.Peer, downloadReqMsg p2p.Msg) {
 
 	// fetch the requested data from host local storage
 	sectorData, err := h.ReadSector(sec.MerkleRoot)
+	if err == storagemanager.ErrSectorLost {
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrSectorLost, err)
+		return
+	}
 	if err != nil {
 		hostNegotiateErr = fmt.Errorf("host failed read sector: %s", err.Error())
 		return
@@ -182,7 +187,7 @@ func DownloadHandler(h *StorageHost, sp storage.Peer, downloadReqMsg p2p.Msg) {
 	if msg.Code == storage.ClientCommitSuccessMsg {
 		err = h.modifyStorageResponsibility(so, nil, nil, nil)
 		if err != nil {
-			_ = sp.SendHostCommitFailedMsg()
+			_ = sp.SendHostCommitFailedMsg(err)
 
 			// wait for client ack msg
 			msg, err = sp.HostWaitContractResp()
@@ -196,10 +201,10 @@ func DownloadHandler(h *StorageHost, sp storage.Peer, downloadReqMsg p2p.Msg) {
 			return
 		}
 	} else if msg.Code == storage.ClientCommitFailedMsg {
-		clientCommitErr = storage.ErrClientCommit
+		clientCommitErr = storage.DecodeNegotiationError(msg, storage.ErrClientCommit)
 		return
 	} else if msg.Code == storage.ClientNegotiateErrorMsg {
-		clientNegotiateErr = storage.ErrClientNegotiate
+		clientNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrClientNegotiate)
 		return
 	}
 
@@ -0,0 +1,128 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+)
+
+var (
+	// errHostDraining is the error returned for the new contract create and upload negotiations
+	// when the host is draining before shutdown
+	errHostDraining = errors.New("host is draining before shutdown")
+
+	// errHostNotDrained is the error returned for undraining the host which is not drained, or
+	// whose drain is still in progress
+	errHostNotDrained = errors.New("host is not drained")
+)
+
+// Drain prepares the storage host for a clean shutdown. After Drain is called, the host stops
+// accepting new contracts and uploads, waits for the in-flight negotiations to finish, writes
+// the revisions batched, and submits the storage proofs whose proof window is already open. The
+// storage proofs which cannot be submitted before the shutdown are returned as the error. Drain
+// shall be followed by Close, or by Undrain to accept the contracts and uploads again
+func (h *StorageHost) Drain() error {
+	h.lock.Lock()
+	if h.draining {
+		h.lock.Unlock()
+		return errHostDraining
+	}
+	h.draining = true
+	h.lock.Unlock()
+
+	// wait for the in-flight negotiations. No new negotiations are started once draining
+	h.negotiations.Wait()
+
+	// the revisions of the negotiations finished are written before the shutdown
+	errBatch := h.revisionBatcher.close()
+	if errBatch != nil {
+		errBatch = fmt.Errorf("failed to write the revisions batched: %v", errBatch)
+	}
+	errProofs := h.submitDueStorageProofs()
+
+	h.lock.Lock()
+	h.drained = true
+	h.lock.Unlock()
+	return common.ErrCompose(errBatch, errProofs)
+}
+
+// Undrain cancels the drain finished, and the host accepts new contracts and uploads again
+func (h *StorageHost) Undrain() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.drained {
+		return errHostNotDrained
+	}
+	h.draining, h.drained = false, false
+	return nil
+}
+
+// startNegotiation registers a new contract create or upload negotiation which Drain waits for.
+// If the host is draining, errHostDraining is returned and the negotiation shall be rejected
+func (h *StorageHost) startNegotiation() error {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if h.draining {
+		return errHostDraining
+	}
+	h.negotiations.Add(1)
+	return nil
+}
+
+// finishNegotiation marks a negotiation registered by startNegotiation as finished
+func (h *StorageHost) finishNegotiation() {
+	h.negotiations.Done()
+}
+
+// submitDueStorageProofs submits the storage proofs of the storage responsibilities whose proof
+// window is open and the proof is not confirmed yet, without waiting for the proof submission
+// height. The storage proofs whose proof window opens soon or is closed without the proof confirmed
+// cannot be submitted before the shutdown, which are returned as the error
+func (h *StorageHost) submitDueStorageProofs() error {
+	h.lock.RLock()
+	sos := h.storageResponsibilities()
+	h.lock.RUnlock()
+
+	var errs []error
+	for _, so := range sos {
+		if err := h.submitDueStorageProof(so.id()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return common.ErrCompose(errs...)
+}
+
+// submitDueStorageProof submits the storage proof of the storage responsibility if it is due
+func (h *StorageHost) submitDueStorageProof(soid common.Hash) error {
+	h.checkAndLockStorageResponsibility(soid)
+	defer h.checkAndUnlockStorageResponsibility(soid)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	so, err := h.loadStorageResponsibility(soid)
+	if err != nil {
+		return err
+	}
+	if so.ResponsibilityStatus != responsibilityUnresolved || !so.CreateContractConfirmed || so.StorageProofConfirmed || len(so.SectorRoots) == 0 {
+		return nil
+	}
+	if h.blockHeight < so.expiration() {
+		if h.blockHeight+postponedExecutionBuffer >= so.expiration() {
+			return fmt.Errorf("the proof window of %v opens soon at %v, the storage proof cannot be submitted before shutdown", soid.String(), so.expiration())
+		}
+		return nil
+	}
+	if h.blockHeight > so.proofDeadline() {
+		return fmt.Errorf("the proof window of %v closed at %v without the storage proof confirmed", soid.String(), so.proofDeadline())
+	}
+	if err = h.submitStorageProofOnce(so); err != nil {
+		return fmt.Errorf("failed to submit the storage proof of %v: %v", soid.String(), err)
+	}
+	return nil
+}
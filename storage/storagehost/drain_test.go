@@ -0,0 +1,160 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/types"
+)
+
+// TestStorageHost_Drain test that draining the host waits for the in-flight negotiation and
+// submits the storage proof whose window is open but not yet scheduled, before the host shuts down
+func TestStorageHost_Drain(t *testing.T) {
+	h := newTestStorageHost(t)
+	defer h.db.Close()
+	h.blockHeight = 1000
+	h.config.ProofSubmissionMargin = 10
+
+	// the proof window is open, and the proof is scheduled after the shutdown
+	windowStart := h.blockHeight - 1
+	windowEnd := windowStart + h.config.WindowSize
+	so := StorageResponsibility{
+		SectorRoots: []common.Hash{{1}},
+		OriginStorageContract: types.StorageContract{
+			WindowStart: windowStart,
+			WindowEnd:   windowEnd,
+		},
+		StorageContractRevisions: []types.StorageContractRevision{
+			{NewWindowStart: windowStart, NewWindowEnd: windowEnd},
+		},
+		CreateContractConfirmed: true,
+	}
+	if h.blockHeight >= so.proofSubmissionHeight(h.config.ProofSubmissionMargin) {
+		t.Fatalf("the proof shall not be scheduled at the current height %v", h.blockHeight)
+	}
+	if err := h.storeStorageResponsibility(so.id(), so); err != nil {
+		t.Fatal(err)
+	}
+	h.checkAndLockStorageResponsibility(so.id())
+	h.checkAndUnlockStorageResponsibility(so.id())
+
+	var (
+		events []string
+		mu     sync.Mutex
+	)
+	record := func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}
+	h.submitProof = func(proved StorageResponsibility) error {
+		if proved.id() != so.id() {
+			t.Errorf("unexpected storage proof submitted for %v", proved.id())
+		}
+		record("proof")
+		return nil
+	}
+
+	// an in-flight upload negotiation
+	if err := h.startNegotiation(); err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan error)
+	go func() {
+		drained <- h.Drain()
+	}()
+
+	// new negotiations are rejected once draining
+	for i := 0; h.startNegotiation() != errHostDraining; i++ {
+		if i == 100 {
+			t.Fatal("new negotiation accepted while draining")
+		}
+		h.finishNegotiation()
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("drain finished with the negotiation in-flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	record("operation")
+	h.finishNegotiation()
+
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain not finished")
+	}
+	if expect := []string{"operation", "proof"}; !reflect.DeepEqual(events, expect) {
+		t.Fatalf("expect events %v before shutdown, got %v", expect, events)
+	}
+	if !heightTasksContain(t, h.db, so.proofDeadline(), so.id()) {
+		t.Errorf("proof check not queued at the proof deadline %v", so.proofDeadline())
+	}
+	if err := h.Drain(); err != errHostDraining {
+		t.Errorf("expect error %v draining twice, got %v", errHostDraining, err)
+	}
+
+	// the new negotiations are accepted again after undraining
+	if err := h.Undrain(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.startNegotiation(); err != nil {
+		t.Errorf("new negotiation rejected after undraining: %v", err)
+	}
+	h.finishNegotiation()
+	if err := h.Undrain(); err != errHostNotDrained {
+		t.Errorf("expect error %v undraining twice, got %v", errHostNotDrained, err)
+	}
+}
+
+// TestStorageHost_DrainProofOutsideWindow test the storage proofs which cannot be submitted before
+// the shutdown are returned as the error of the drain
+func TestStorageHost_DrainProofOutsideWindow(t *testing.T) {
+	h := newTestStorageHost(t)
+	defer h.db.Close()
+	h.blockHeight = 1000
+	h.submitProof = func(StorageResponsibility) error {
+		t.Error("the storage proof outside the window is submitted")
+		return nil
+	}
+
+	tests := []struct {
+		windowStart uint64
+		expectErr   bool
+	}{
+		// the proof window opens soon
+		{h.blockHeight + 1, true},
+		// the proof window opens long after
+		{h.blockHeight + postponedExecutionBuffer + 1, false},
+		// the proof window closed
+		{h.blockHeight - h.config.WindowSize - 1, true},
+	}
+	for i, test := range tests {
+		windowEnd := test.windowStart + h.config.WindowSize
+		so := StorageResponsibility{
+			SectorRoots: []common.Hash{{byte(i + 1)}},
+			OriginStorageContract: types.StorageContract{
+				WindowStart: test.windowStart,
+				WindowEnd:   windowEnd,
+			},
+			CreateContractConfirmed: true,
+		}
+		if err := h.storeStorageResponsibility(so.id(), so); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.submitDueStorageProof(so.id()); (err != nil) != test.expectErr {
+			t.Errorf("window start %v: expect error %v, got %v", test.windowStart, test.expectErr, err)
+		}
+	}
+}
@@ -71,13 +71,13 @@ func (h *StorageHost) applyBlockHashesStorageResponsibility(blocks []common.Hash
 
 		//Traverse all contract transactions and modify storage responsibility status
 		for _, id := range ContractCreateIDsApply {
-			so, errGet := getStorageResponsibility(h.db, id)
+			so, errGet := h.loadStorageResponsibility(id)
 			//This transaction is not involved by the local node, so it should be skipped
 			if errGet != nil {
 				continue
 			}
 			so.CreateContractConfirmed = true
-			errPut := putStorageResponsibility(h.db, so.id(), so)
+			errPut := h.storeStorageResponsibility(so.id(), so)
 			if errPut != nil {
 				h.log.Error("Failed to put storage responsibility", "err", errPut)
 				continue
@@ -86,7 +86,7 @@ func (h *StorageHost) applyBlockHashesStorageResponsibility(blocks []common.Hash
 
 		//Traverse all revision transactions and modify storage responsibility status
 		for key, value := range revisionIDsApply {
-			so, errGet := getStorageResponsibility(h.db, key)
+			so, errGet := h.loadStorageResponsibility(key)
 			//This transaction is not involved by the local node, so it should be skipped
 			if errGet != nil {
 				continue
@@ -99,7 +99,7 @@ func (h *StorageHost) applyBlockHashesStorageResponsibility(blocks []common.Hash
 			if value == so.StorageContractRevisions[len(so.StorageContractRevisions)-1].NewRevisionNumber {
 				so.StorageRevisionConfirmed = true
 			}
-			errPut := putStorageResponsibility(h.db, so.id(), so)
+			errPut := h.storeStorageResponsibility(so.id(), so)
 			if errPut != nil {
 				h.log.Error("Failed to put storage responsibility", "err", errPut)
 				continue
@@ -108,13 +108,13 @@ func (h *StorageHost) applyBlockHashesStorageResponsibility(blocks []common.Hash
 
 		//Traverse all storageProof transactions and modify storage responsibility status
 		for _, id := range storageProofIDsApply {
-			so, errGet := getStorageResponsibility(h.db, id)
+			so, errGet := h.loadStorageResponsibility(id)
 			//This transaction is not involved by the local node, so it should be skipped
 			if errGet != nil {
 				continue
 			}
 			so.StorageProofConfirmed = true
-			errPut := putStorageResponsibility(h.db, so.id(), so)
+			errPut := h.storeStorageResponsibility(so.id(), so)
 			if errPut != nil {
 				h.log.Error("Failed to put storage responsibility", "err", errPut)
 				continue
@@ -163,13 +163,13 @@ func (h *StorageHost) revertedBlockHashesStorageResponsibility(blocks []common.H
 
 		//Traverse all ContractCreate transactions and modify storage responsibility status
 		for _, id := range ContractCreateIDs {
-			so, errGet := getStorageResponsibility(h.db, id)
+			so, errGet := h.loadStorageResponsibility(id)
 			//This transaction is not involved by the local node, so it should be skipped
 			if errGet != nil {
 				continue
 			}
 			so.CreateContractConfirmed = false
-			errPut := putStorageResponsibility(h.db, so.id(), so)
+			errPut := h.storeStorageResponsibility(so.id(), so)
 			if errPut != nil {
 				h.log.Error("Failed to put storage responsibility", "err", errPut)
 				continue
@@ -178,13 +178,13 @@ func (h *StorageHost) revertedBlockHashesStorageResponsibility(blocks []common.H
 
 		//Traverse all revision transactions and modify storage responsibility status
 		for key := range revisionIDs {
-			so, errGet := getStorageResponsibility(h.db, key)
+			so, errGet := h.loadStorageResponsibility(key)
 			//This transaction is not involved by the local node, so it should be skipped
 			if errGet != nil {
 				continue
 			}
 			so.StorageRevisionConfirmed = false
-			errPut := putStorageResponsibility(h.db, so.id(), so)
+			errPut := h.storeStorageResponsibility(so.id(), so)
 			if errPut != nil {
 				h.log.Error("Failed to put storage responsibility", "err", errPut)
 				continue
@@ -193,13 +193,13 @@ func (h *StorageHost) revertedBlockHashesStorageResponsibility(blocks []common.H
 
 		//Traverse all storageProof transactions and modify storage responsibility status
 		for _, id := range storageProofIDs {
-			so, errGet := getStorageResponsibility(h.db, id)
+			so, errGet := h.loadStorageResponsibility(id)
 			//This transaction is not involved by the local node, so it should be skipped
 			if errGet != nil {
 				continue
 			}
 			so.StorageProofConfirmed = false
-			errPut := putStorageResponsibility(h.db, so.id(), so)
+			errPut := h.storeStorageResponsibility(so.id(), so)
 			if errPut != nil {
 				h.log.Error("Failed to put storage responsibility", "err", errPut)
 				continue
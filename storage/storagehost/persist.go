@@ -31,14 +31,26 @@ func (h *StorageHost) syncConfig() error {
 
 // loadConfig load host config from the file.
 func (h *StorageHost) loadConfig() error {
-	// load and create a persist from JSON file
-	persist := new(persistence)
+	// load and create a persist from JSON file. The config is decoded over the default, so that
+	// the fields missing in the file saved by the previous version are defaulted
+	persist := &persistence{Config: defaultConfig()}
 	// if it is loaded the file causing the error, directly return the error info
 	// and not do any modification to the host
 	if err := common.LoadDxJSON(storageHostMeta, filepath.Join(h.persistDir, HostSettingFile), persist); err != nil {
 		return err
 	}
 	h.loadPersistence(persist)
+	// the proof window and the max duration in the file are not validated before
+	if err := checkContractDuration(h.config.MaxDuration, h.config.WindowSize, h.maxContractDuration()); err != nil {
+		h.log.Warn("Invalid contract duration in the host setting, use the default instead", "err", err)
+		config := defaultConfig()
+		h.config.MaxDuration, h.config.WindowSize = config.MaxDuration, config.WindowSize
+	}
+	// the read verification rate in the file is not validated either
+	if rate := h.config.ReadVerificationRate; rate < 0 || rate > 1 {
+		h.log.Warn("Invalid read verification rate in the host setting, use the default instead", "rate", rate)
+		h.config.ReadVerificationRate = storage.DefaultReadVerificationRate
+	}
 	return nil
 }
 
@@ -0,0 +1,63 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/vm"
+)
+
+var (
+	// errStorageProofPreflight is the error returned if the storage proof built by the host does
+	// not pass the local verification, indicating the data stored is corrupted
+	errStorageProofPreflight = errors.New("storage proof does not pass the local verification")
+
+	// errNothingToProve is the error returned if the storage contract has no data to prove
+	errNothingToProve = errors.New("storage contract has no data to prove")
+)
+
+// PreflightStorageProof builds the storage proof of the storage contract and verifies it locally
+// against the file merkle root of the latest revision, so that the corrupted data is discovered
+// before the proof is submitted. The segment challenged is computed from the trigger block of the
+// proof window. If the trigger block is not available yet, the segment challenged by the latest
+// block is proved instead
+func (h *StorageHost) PreflightStorageProof(contractID common.Hash) error {
+	h.lock.RLock()
+	so, err := h.loadStorageResponsibility(contractID)
+	blockHeight := h.blockHeight
+	h.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	if len(so.StorageContractRevisions) == 0 || len(so.SectorRoots) == 0 {
+		return errNothingToProve
+	}
+	scrv := so.StorageContractRevisions[len(so.StorageContractRevisions)-1]
+	if scrv.NewFileSize == 0 {
+		return errNothingToProve
+	}
+
+	triggerHeight := scrv.NewWindowStart - 1
+	if triggerHeight > blockHeight {
+		triggerHeight = blockHeight
+	}
+	segmentIndex, err := h.storageProofSegmentAt(scrv, so.segmentSize(), triggerHeight)
+	if err != nil {
+		return fmt.Errorf("failed to get the storage proof segment: %v", err)
+	}
+	sp, err := h.buildStorageProof(so, segmentIndex)
+	if err != nil {
+		h.log.Error("Storage proof preflight failed, the data shall be restored", "id", contractID, "segment", segmentIndex, "err", err)
+		return err
+	}
+	if err = vm.CheckStorageProofSegment(sp.Segment, sp.HashSet, scrv.NewFileSize, so.segmentSize(), segmentIndex, scrv.NewFileMerkleRoot); err != nil {
+		h.log.Error("Storage proof preflight failed, the data shall be restored", "id", contractID, "segment", segmentIndex, "err", err)
+		return errStorageProofPreflight
+	}
+	return nil
+}
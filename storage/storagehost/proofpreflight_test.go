@@ -0,0 +1,190 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"crypto/rand"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/core/vm"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// preflightHostBackend is the host backend returning a block for each block number
+type preflightHostBackend struct {
+	mockHostBackend
+}
+
+func (b *preflightHostBackend) GetBlockByNumber(number uint64) (*types.Block, error) {
+	return types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number)}), nil
+}
+
+// TestStorageHost_PreflightStorageProof test the storage proof preflight of a storage contract
+// near its proof window passes with the intact data, and fails with the corrupted data
+func TestStorageHost_PreflightStorageProof(t *testing.T) {
+	h := newTestStorageHost(t)
+	if err := h.StorageManager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		h.StorageManager.Close()
+		h.db.Close()
+	}()
+	h.ethBackend = &preflightHostBackend{}
+	h.blockHeight = 1000
+
+	folderPath := filepath.Join(h.persistDir, "folder")
+	numSectors := uint64(8)
+	if err := h.StorageManager.AddStorageFolder(folderPath, numSectors*storage.SectorSize); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, storage.SectorSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	root := merkle.Sha256MerkleTreeRoot(data)
+	if err := h.StorageManager.AddSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// the proof window opens within the next few blocks
+	windowStart := h.blockHeight + 5
+	windowEnd := windowStart + h.config.WindowSize
+	so := StorageResponsibility{
+		SectorRoots: []common.Hash{root},
+		OriginStorageContract: types.StorageContract{
+			FileSize:    storage.SectorSize,
+			WindowStart: windowStart,
+			WindowEnd:   windowEnd,
+		},
+		StorageContractRevisions: []types.StorageContractRevision{
+			{
+				NewFileSize:       storage.SectorSize,
+				NewFileMerkleRoot: merkle.Sha256CachedTreeRoot2([]common.Hash{root}),
+				NewWindowStart:    windowStart,
+				NewWindowEnd:      windowEnd,
+			},
+		},
+		CreateContractConfirmed: true,
+	}
+	so.StorageContractRevisions[0].ParentID = so.id()
+	if err := h.storeStorageResponsibility(so.id(), so); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.PreflightStorageProof(so.id()); err != nil {
+		t.Fatalf("preflight with intact data: %v", err)
+	}
+
+	// corrupt the sector data stored in the folder. Since the sector is stored at a random slot,
+	// all slots are overwritten
+	f, err := os.OpenFile(filepath.Join(folderPath, "dxstorage.dat"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := make([]byte, storage.SectorSize)
+	if _, err = rand.Read(garbage); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i != numSectors && err == nil; i++ {
+		_, err = f.WriteAt(garbage, int64(i*storage.SectorSize))
+	}
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.PreflightStorageProof(so.id()); err == nil {
+		t.Fatalf("preflight with corrupted data passed")
+	}
+}
+
+// TestStorageHost_BuildStorageProof_SegmentSize test the storage proof of the storage contract
+// declaring a segment size other than the default is built from the sector trees stored, and is
+// verified against the file merkle root with the segment size
+func TestStorageHost_BuildStorageProof_SegmentSize(t *testing.T) {
+	const segmentSize = 1024
+	h := newTestStorageHost(t)
+	if err := h.StorageManager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		h.StorageManager.Close()
+		h.db.Close()
+	}()
+	h.ethBackend = &preflightHostBackend{}
+	h.blockHeight = 1000
+
+	numSectors := uint64(3)
+	if err := h.StorageManager.AddStorageFolder(filepath.Join(h.persistDir, "folder"), numSectors*storage.SectorSize); err != nil {
+		t.Fatal(err)
+	}
+	var roots []common.Hash
+	for i := uint64(0); i != numSectors; i++ {
+		data := make([]byte, storage.SectorSize)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+		root := merkle.Sha256MerkleTreeRoot(data)
+		if err := h.StorageManager.AddSector(root, data); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+
+	windowStart := h.blockHeight + 5
+	windowEnd := windowStart + h.config.WindowSize
+	fileSize := numSectors * storage.SectorSize
+	fileRoot := merkle.Sha256CachedTreeRoot2(roots)
+	so := StorageResponsibility{
+		SectorRoots: roots,
+		OriginStorageContract: types.StorageContract{
+			FileSize:    fileSize,
+			WindowStart: windowStart,
+			WindowEnd:   windowEnd,
+			SegmentSize: segmentSize,
+		},
+		StorageContractRevisions: []types.StorageContractRevision{
+			{
+				NewFileSize:       fileSize,
+				NewFileMerkleRoot: fileRoot,
+				NewWindowStart:    windowStart,
+				NewWindowEnd:      windowEnd,
+			},
+		},
+		CreateContractConfirmed: true,
+	}
+	so.StorageContractRevisions[0].ParentID = so.id()
+
+	numSegments := fileSize / segmentSize
+	for _, segmentIndex := range []uint64{0, 1, storage.SectorSize/segmentSize + 7, numSegments - 1} {
+		sp, err := h.buildStorageProof(so, segmentIndex)
+		if err != nil {
+			t.Fatalf("segment %v: failed to build the storage proof: %v", segmentIndex, err)
+		}
+		if len(sp.Segment) != segmentSize {
+			t.Errorf("segment %v: segment length %v not of the segment size", segmentIndex, len(sp.Segment))
+		}
+		if err = vm.CheckStorageProofSegment(sp.Segment, sp.HashSet, fileSize, segmentSize, segmentIndex, fileRoot); err != nil {
+			t.Errorf("segment %v: storage proof not verified: %v", segmentIndex, err)
+		}
+		if vm.VerifyStorageProof(sp.Segment, sp.HashSet, fileSize, storage.SegmentSize, segmentIndex, fileRoot) {
+			t.Errorf("segment %v: storage proof verified with the default segment size", segmentIndex)
+		}
+	}
+
+	// the segment challenged is selected and proved with the segment size in the preflight
+	if err := h.storeStorageResponsibility(so.id(), so); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.PreflightStorageProof(so.id()); err != nil {
+		t.Fatalf("preflight of the segment size %v: %v", segmentSize, err)
+	}
+}
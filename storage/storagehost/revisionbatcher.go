@@ -0,0 +1,146 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/log"
+)
+
+// revisionBatch is a set of storage responsibilities written to the database in one
+// durable write
+type revisionBatch struct {
+	sos  map[common.Hash]StorageResponsibility
+	done chan struct{}
+	err  error
+}
+
+// wait blocks until the batch is durably written, and returns the error of the write
+func (batch *revisionBatch) wait() error {
+	<-batch.done
+	return batch.err
+}
+
+// revisionBatcher batches the persistence of the revised storage responsibilities over a
+// window. Multiple revisions of the same contract within the window are coalesced, and only
+// the latest one is written. All storage responsibilities in the batch are written in one
+// synced database write, so that the callers waiting for the batch know the revision is
+// durable when the wait returns.
+type revisionBatcher struct {
+	write func(sos map[common.Hash]StorageResponsibility) error
+
+	// current is the batch collecting the storage responsibilities, and flushing
+	// is the batch being written to the database
+	current  *revisionBatch
+	flushing *revisionBatch
+
+	mu      sync.Mutex
+	flushMu sync.Mutex
+}
+
+// newRevisionBatcher creates a revisionBatcher writing the batches with the write function
+func newRevisionBatcher(write func(sos map[common.Hash]StorageResponsibility) error) *revisionBatcher {
+	return &revisionBatcher{
+		write: write,
+	}
+}
+
+// add adds the storage responsibility to the batch collecting, and returns the batch. The
+// batch is written after the window since the batch is created. A zero window writes the
+// batch as soon as possible, and the storage responsibilities added in the meantime are
+// written together
+func (rb *revisionBatcher) add(id common.Hash, so StorageResponsibility, window time.Duration) *revisionBatch {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.current == nil {
+		batch := &revisionBatch{
+			sos:  make(map[common.Hash]StorageResponsibility),
+			done: make(chan struct{}),
+		}
+		rb.current = batch
+		go func() {
+			if window > 0 {
+				<-time.After(window)
+			}
+			rb.flush(batch)
+		}()
+	}
+	rb.current.sos[id] = so
+	return rb.current
+}
+
+// get returns the latest storage responsibility not yet written to the database
+func (rb *revisionBatcher) get(id common.Hash) (StorageResponsibility, bool) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	for _, batch := range []*revisionBatch{rb.current, rb.flushing} {
+		if batch == nil {
+			continue
+		}
+		if so, exist := batch.sos[id]; exist {
+			return so, true
+		}
+	}
+	return StorageResponsibility{}, false
+}
+
+// discard removes the storage responsibility from the batch collecting, and waits for
+// the batch being written. It is called before the storage responsibility is deleted from
+// the database, so that the deletion is not overwritten by the batch
+func (rb *revisionBatcher) discard(id common.Hash) {
+	rb.mu.Lock()
+	if rb.current != nil {
+		delete(rb.current.sos, id)
+	}
+	flushing := rb.flushing
+	rb.mu.Unlock()
+
+	if flushing != nil {
+		<-flushing.done
+	}
+}
+
+// flush writes the batch to the database. Batches are written one at a time in the order
+// they are created, so that a revision is never overwritten by an earlier one
+func (rb *revisionBatcher) flush(batch *revisionBatch) {
+	rb.flushMu.Lock()
+	defer rb.flushMu.Unlock()
+
+	rb.mu.Lock()
+	// the batch has already been written
+	if rb.current != batch {
+		rb.mu.Unlock()
+		return
+	}
+	rb.current, rb.flushing = nil, batch
+	rb.mu.Unlock()
+
+	if batch.err = rb.write(batch.sos); batch.err != nil {
+		log.Error("failed to write the storage responsibility batch", "size", len(batch.sos), "err", batch.err)
+	}
+
+	rb.mu.Lock()
+	rb.flushing = nil
+	rb.mu.Unlock()
+	close(batch.done)
+}
+
+// close writes the batch collecting immediately
+func (rb *revisionBatcher) close() error {
+	rb.mu.Lock()
+	batch := rb.current
+	rb.mu.Unlock()
+
+	if batch == nil {
+		return nil
+	}
+	rb.flush(batch)
+	return batch.wait()
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/types"
+)
+
+// TestRevisionBatcher_Coalesce test the revisions added within the window are written in one
+// write, and only the latest revision of the same contract is written
+func TestRevisionBatcher_Coalesce(t *testing.T) {
+	h := newTestStorageHost(t)
+	defer h.db.Close()
+
+	var writes []map[common.Hash]StorageResponsibility
+	h.revisionBatcher = newRevisionBatcher(func(sos map[common.Hash]StorageResponsibility) error {
+		writes = append(writes, sos)
+		return putStorageResponsibilities(h.db, sos)
+	})
+
+	so1, so2 := newTestRevisionResponsibility(1), newTestRevisionResponsibility(2)
+	for _, so := range []StorageResponsibility{so1, so2} {
+		if err := putStorageResponsibility(h.db, so.id(), so); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	window := 200 * time.Millisecond
+	var batch *revisionBatch
+	for revisionNumber := uint64(1); revisionNumber <= 3; revisionNumber++ {
+		batch = h.revisionBatcher.add(so1.id(), reviseTestResponsibility(so1, revisionNumber), window)
+	}
+	if h.revisionBatcher.add(so2.id(), reviseTestResponsibility(so2, 1), window) != batch {
+		t.Fatal("revisions within the window are expected in the same batch")
+	}
+
+	// before the batch is written, the latest revision is loaded while the database keeps the old one
+	checkTestRevisionNumber(t, h.loadStorageResponsibility, so1.id(), 3)
+	checkTestRevisionNumber(t, func(id common.Hash) (StorageResponsibility, error) {
+		return getStorageResponsibility(h.db, id)
+	}, so1.id(), 0)
+
+	if err := batch.wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(writes) != 1 || len(writes[0]) != 2 {
+		t.Fatalf("expect one write of two storage responsibilities, got %v writes", len(writes))
+	}
+	checkTestRevisionNumber(t, func(id common.Hash) (StorageResponsibility, error) {
+		return getStorageResponsibility(h.db, id)
+	}, so1.id(), 3)
+	checkTestRevisionNumber(t, func(id common.Hash) (StorageResponsibility, error) {
+		return getStorageResponsibility(h.db, id)
+	}, so2.id(), 1)
+}
+
+// TestStorageHost_StoreBatchedStorageResponsibility test the storage responsibility stored while
+// its revision is waiting in the batch is durable on return, without waiting for the window
+func TestStorageHost_StoreBatchedStorageResponsibility(t *testing.T) {
+	h := newTestStorageHost(t)
+	defer h.db.Close()
+	h.config.RevisionBatchWindow = time.Hour
+
+	so := newTestRevisionResponsibility(1)
+	if err := putStorageResponsibility(h.db, so.id(), so); err != nil {
+		t.Fatal(err)
+	}
+	h.revisionBatcher.add(so.id(), reviseTestResponsibility(so, 1), h.config.RevisionBatchWindow)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.storeStorageResponsibility(so.id(), reviseTestResponsibility(so, 2))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("storing the storage responsibility waits for the batch window")
+	}
+	checkTestRevisionNumber(t, func(id common.Hash) (StorageResponsibility, error) {
+		return getStorageResponsibility(h.db, id)
+	}, so.id(), 2)
+	if _, exist := h.revisionBatcher.get(so.id()); exist {
+		t.Error("the storage responsibility stored is still waiting in the batch")
+	}
+}
+
+// TestStorageHost_ModifyStorageResponsibility_Recovery test the revisions modified concurrently
+// are durable once acknowledged, and the latest acknowledged revision is recovered after the
+// database is reopened. The revision not yet written when the database closes is not acknowledged.
+func TestStorageHost_ModifyStorageResponsibility_Recovery(t *testing.T) {
+	h := newTestStorageHost(t)
+	h.config.RevisionBatchWindow = 50 * time.Millisecond
+
+	numContracts := 5
+	var sos []StorageResponsibility
+	for i := 0; i < numContracts; i++ {
+		so := newTestRevisionResponsibility(uint64(i))
+		if err := putStorageResponsibility(h.db, so.id(), so); err != nil {
+			t.Fatal(err)
+		}
+		sos = append(sos, so)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numContracts)
+	for _, so := range sos {
+		wg.Add(1)
+		go func(so StorageResponsibility) {
+			defer wg.Done()
+			errs <- h.modifyStorageResponsibility(reviseTestResponsibility(so, 1), nil, nil, nil)
+		}(so)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("failed to modify the storage responsibility: %v", err)
+		}
+	}
+
+	// the revision added but not written before the database closes is not acknowledged
+	batch := h.revisionBatcher.add(sos[0].id(), reviseTestResponsibility(sos[0], 2), time.Hour)
+	h.db.Close()
+	if err := h.revisionBatcher.close(); err == nil {
+		t.Fatal("revision written to the closed database is expected to fail")
+	}
+	if err := batch.wait(); err == nil {
+		t.Fatal("revision not written is expected not to be acknowledged")
+	}
+
+	// reopen the database and recover the latest acknowledged revisions
+	db, err := openDB(filepath.Join(h.persistDir, databaseFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, so := range sos {
+		checkTestRevisionNumber(t, func(id common.Hash) (StorageResponsibility, error) {
+			return getStorageResponsibility(db, id)
+		}, so.id(), 1)
+	}
+}
+
+// newTestRevisionResponsibility creates a storage responsibility for revision test, which
+// is distinguished by the index
+func newTestRevisionResponsibility(index uint64) StorageResponsibility {
+	return StorageResponsibility{
+		OriginStorageContract: types.StorageContract{
+			WindowStart:    1000000,
+			WindowEnd:      1440000 + index,
+			RevisionNumber: 0,
+		},
+		StorageContractRevisions: []types.StorageContractRevision{{
+			NewWindowStart:    1000000,
+			NewWindowEnd:      1440000 + index,
+			NewRevisionNumber: 0,
+		}},
+	}
+}
+
+// reviseTestResponsibility returns the storage responsibility with a new revision
+func reviseTestResponsibility(so StorageResponsibility, revisionNumber uint64) StorageResponsibility {
+	revision := so.StorageContractRevisions[len(so.StorageContractRevisions)-1]
+	revision.NewRevisionNumber = revisionNumber
+	so.StorageContractRevisions = append(append([]types.StorageContractRevision{}, so.StorageContractRevisions...), revision)
+	return so
+}
+
+// checkTestRevisionNumber checks the latest revision number of the storage responsibility loaded
+func checkTestRevisionNumber(t *testing.T, load func(common.Hash) (StorageResponsibility, error), id common.Hash, expect uint64) {
+	so, err := load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := so.StorageContractRevisions[len(so.StorageContractRevisions)-1].NewRevisionNumber
+	if got != expect {
+		t.Errorf("storage responsibility %x: expect revision number %v, got %v", id, expect, got)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"errors"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+var (
+	// errSectorRootMismatch is returned if the sector data uploaded does not hash to the
+	// sector root declared by the client
+	errSectorRootMismatch = errors.New("sector data does not match the declared sector root")
+
+	// errSectorRootCount is returned if the number of sector roots declared by the client does
+	// not match the number of sectors appended
+	errSectorRootCount = errors.New("number of declared sector roots does not match the sectors appended")
+
+	// errVirtualSectorRoot is returned if the data of a virtual append is not a merkle root
+	errVirtualSectorRoot = errors.New("virtual sector data is not a merkle root")
+
+	// errVirtualSectorNotFound is returned if the sector appended virtually is not stored for
+	// the contract
+	errVirtualSectorNotFound = errors.New("virtual sector is not stored for the contract")
+
+	// errDeleteSectorRoot is returned if the data of a delete action is not a merkle root
+	errDeleteSectorRoot = errors.New("deleted sector data is not a merkle root")
+
+	// errDeleteSectorNotFound is returned if the sector deleted is not stored for the contract
+	errDeleteSectorNotFound = errors.New("deleted sector is not stored for the contract")
+
+	// errDeleteWithAppend is returned if the sectors are deleted and appended in the same request
+	errDeleteWithAppend = errors.New("sectors cannot be deleted and appended in the same request")
+)
+
+// verifySectorRoots verifies the data of each sector appended hashes to the Merkle root declared
+// by the client. The request of the legacy client declares no roots and is not verified
+func verifySectorRoots(req storage.UploadRequest) error {
+	if len(req.SectorRoots) == 0 {
+		return nil
+	}
+	var appended int
+	for _, action := range req.Actions {
+		if action.Type != storage.UploadActionAppend {
+			continue
+		}
+		if appended >= len(req.SectorRoots) {
+			return errSectorRootCount
+		}
+		if merkle.Sha256MerkleTreeRoot(action.Data) != req.SectorRoots[appended] {
+			return errSectorRootMismatch
+		}
+		appended++
+	}
+	if appended != len(req.SectorRoots) {
+		return errSectorRootCount
+	}
+	return nil
+}
+
+// verifyVirtualSectors verifies each sector appended virtually is already stored for the
+// contract. The sectors stored for the other contracts are not appended, so that a client
+// could not get the sectors of the others without uploading them
+func verifyVirtualSectors(req storage.UploadRequest, sectorRoots []common.Hash) error {
+	var stored map[common.Hash]struct{}
+	for _, action := range req.Actions {
+		if action.Type != storage.UploadActionAppendVirtual {
+			continue
+		}
+		if len(action.Data) != common.HashLength {
+			return errVirtualSectorRoot
+		}
+		if stored == nil {
+			stored = make(map[common.Hash]struct{}, len(sectorRoots))
+			for _, root := range sectorRoots {
+				stored[root] = struct{}{}
+			}
+		}
+		if _, exist := stored[action.SectorRoot()]; !exist {
+			return errVirtualSectorNotFound
+		}
+	}
+	return nil
+}
+
+// verifyDeleteSectors verifies each sector deleted is stored for the contract. A sector stored
+// multiple times could be deleted as many times as it is stored. The delete actions cannot be
+// mixed with the appends, since the sectors moved by the deletes are not covered by the diff
+// proof of the appends
+func verifyDeleteSectors(req storage.UploadRequest, sectorRoots []common.Hash) error {
+	var deletes, appends int
+	for _, action := range req.Actions {
+		if action.Type != storage.UploadActionDelete {
+			appends++
+			continue
+		}
+		if len(action.Data) != common.HashLength {
+			return errDeleteSectorRoot
+		}
+		deletes++
+	}
+	if deletes == 0 {
+		return nil
+	}
+	if appends != 0 {
+		return errDeleteWithAppend
+	}
+	roots := append([]common.Hash(nil), sectorRoots...)
+	for _, action := range req.Actions {
+		var found bool
+		if roots, found = storage.RemoveSectorRoot(roots, action.SectorRoot()); !found {
+			return errDeleteSectorNotFound
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestVerifySectorRoots test the upload is rejected if the data sent by the client does not
+// match the declared sector root
+func TestVerifySectorRoots(t *testing.T) {
+	data := make([][]byte, 2)
+	roots := make([]common.Hash, 2)
+	for i := range data {
+		data[i] = make([]byte, storage.SectorSize)
+		rand.Read(data[i])
+		roots[i] = merkle.Sha256MerkleTreeRoot(data[i])
+	}
+	actions := []storage.UploadAction{
+		{Type: storage.UploadActionAppend, Data: data[0]},
+		{Type: storage.UploadActionAppend, Data: data[1]},
+	}
+
+	tests := []struct {
+		roots  []common.Hash
+		expect error
+	}{
+		{roots, nil},
+		{nil, nil},
+		{[]common.Hash{roots[1], roots[0]}, errSectorRootMismatch},
+		{[]common.Hash{roots[0], {}}, errSectorRootMismatch},
+		{roots[:1], errSectorRootCount},
+		{append(roots, roots[0]), errSectorRootCount},
+	}
+	for i, test := range tests {
+		req := storage.UploadRequest{Actions: actions, SectorRoots: test.roots}
+		if err := verifySectorRoots(req); err != test.expect {
+			t.Errorf("test %d: expect %v, got %v", i, test.expect, err)
+		}
+	}
+}
+
+// TestVerifyVirtualSectors test the virtual sector is appended only if the sector is already
+// stored for the contract
+func TestVerifyVirtualSectors(t *testing.T) {
+	data := make([]byte, storage.SectorSize)
+	rand.Read(data)
+	stored := []common.Hash{merkle.Sha256MerkleTreeRoot(data), {1}}
+
+	tests := []struct {
+		actions []storage.UploadAction
+		expect  error
+	}{
+		{[]storage.UploadAction{{Type: storage.UploadActionAppend, Data: data}}, nil},
+		{[]storage.UploadAction{{Type: storage.UploadActionAppendVirtual, Data: stored[0].Bytes()}}, nil},
+		{[]storage.UploadAction{
+			{Type: storage.UploadActionAppendVirtual, Data: stored[1].Bytes()},
+			{Type: storage.UploadActionAppendVirtual, Data: stored[1].Bytes()},
+		}, nil},
+		{[]storage.UploadAction{{Type: storage.UploadActionAppendVirtual, Data: common.Hash{2}.Bytes()}}, errVirtualSectorNotFound},
+		{[]storage.UploadAction{{Type: storage.UploadActionAppendVirtual, Data: data}}, errVirtualSectorRoot},
+		{[]storage.UploadAction{{Type: storage.UploadActionAppendVirtual, Data: stored[0].Bytes()[:16]}}, errVirtualSectorRoot},
+	}
+	for i, test := range tests {
+		req := storage.UploadRequest{Actions: test.actions}
+		if err := verifyVirtualSectors(req, stored); err != test.expect {
+			t.Errorf("test %d: expect %v, got %v", i, test.expect, err)
+		}
+	}
+
+	// the virtual sectors do not declare the sector roots
+	req := storage.UploadRequest{
+		Actions: []storage.UploadAction{
+			{Type: storage.UploadActionAppendVirtual, Data: stored[1].Bytes()},
+			{Type: storage.UploadActionAppend, Data: data},
+		},
+		SectorRoots: stored[:1],
+	}
+	if err := verifySectorRoots(req); err != nil {
+		t.Errorf("sector roots with virtual sectors rejected: %v", err)
+	}
+}
+
+// TestVerifyDeleteSectors test the sector is deleted only if it is stored for the contract, and
+// the deletes are not mixed with the appends
+func TestVerifyDeleteSectors(t *testing.T) {
+	data := make([]byte, storage.SectorSize)
+	rand.Read(data)
+	stored := []common.Hash{{1}, {2}, {2}}
+
+	tests := []struct {
+		actions []storage.UploadAction
+		expect  error
+	}{
+		{[]storage.UploadAction{{Type: storage.UploadActionAppend, Data: data}}, nil},
+		{[]storage.UploadAction{{Type: storage.UploadActionDelete, Data: stored[0].Bytes()}}, nil},
+		{[]storage.UploadAction{
+			{Type: storage.UploadActionDelete, Data: stored[1].Bytes()},
+			{Type: storage.UploadActionDelete, Data: stored[2].Bytes()},
+		}, nil},
+		{[]storage.UploadAction{
+			{Type: storage.UploadActionDelete, Data: stored[0].Bytes()},
+			{Type: storage.UploadActionDelete, Data: stored[0].Bytes()},
+		}, errDeleteSectorNotFound},
+		{[]storage.UploadAction{{Type: storage.UploadActionDelete, Data: common.Hash{3}.Bytes()}}, errDeleteSectorNotFound},
+		{[]storage.UploadAction{{Type: storage.UploadActionDelete, Data: data}}, errDeleteSectorRoot},
+		{[]storage.UploadAction{
+			{Type: storage.UploadActionDelete, Data: stored[0].Bytes()},
+			{Type: storage.UploadActionAppend, Data: data},
+		}, errDeleteWithAppend},
+	}
+	for i, test := range tests {
+		req := storage.UploadRequest{Actions: test.actions}
+		if err := verifyDeleteSectors(req, stored); err != test.expect {
+			t.Errorf("test %d: expect %v, got %v", i, test.expect, err)
+		}
+	}
+
+	// the last root is moved to the position of the root deleted
+	roots, found := storage.RemoveSectorRoot([]common.Hash{{1}, {2}, {3}}, common.Hash{1})
+	if !found || len(roots) != 2 || roots[0] != (common.Hash{3}) || roots[1] != (common.Hash{2}) {
+		t.Errorf("unexpected roots after the delete: %v", roots)
+	}
+}
+
+// TestUploadRequest_LegacyDecode test the upload request of the legacy client without the
+// declared sector roots is still decoded
+func TestUploadRequest_LegacyDecode(t *testing.T) {
+	legacy := struct {
+		StorageContractID    common.Hash
+		Actions              []storage.UploadAction
+		NewRevisionNumber    uint64
+		NewValidProofValues  []*big.Int
+		NewMissedProofValues []*big.Int
+	}{
+		StorageContractID:    common.Hash{1},
+		Actions:              []storage.UploadAction{{Type: storage.UploadActionAppend, Data: []byte{1, 2, 3}}},
+		NewRevisionNumber:    2,
+		NewValidProofValues:  []*big.Int{big.NewInt(1)},
+		NewMissedProofValues: []*big.Int{big.NewInt(2)},
+	}
+	b, err := rlp.EncodeToBytes(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req storage.UploadRequest
+	if err := rlp.DecodeBytes(b, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.StorageContractID != legacy.StorageContractID || len(req.SectorRoots) != 0 {
+		t.Errorf("unexpected legacy request decoded: %+v", req)
+	}
+	if err := verifySectorRoots(req); err != nil {
+		t.Errorf("legacy request rejected: %v", err)
+	}
+}
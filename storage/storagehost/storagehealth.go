@@ -0,0 +1,97 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"sync"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// Health returns the health summary of the storage host, including the storage folders, the
+// free sector slots, the number of storage proofs due within upcomingProofHorizon blocks and
+// the number of unfinished wal transactions of the storage manager. The storage proofs due are
+// counted with the proof window index, without loading the storage responsibilities
+func (h *StorageHost) Health() storage.HostHealth {
+	h.lock.RLock()
+	blockHeight := h.blockHeight
+	h.lock.RUnlock()
+
+	return storage.HostHealth{
+		Folders:        h.StorageManager.Folders(),
+		FreeSectors:    h.StorageManager.AvailableSpace().FreeSectors,
+		UpcomingProofs: h.proofWindows.upcoming(blockHeight),
+		WalDepth:       h.StorageManager.WalDepth(),
+	}
+}
+
+// proofPending return whether the storage proof of the storage responsibility is still to be
+// submitted
+func (so *StorageResponsibility) proofPending() bool {
+	return so.ResponsibilityStatus == responsibilityUnresolved && so.CreateContractConfirmed && !so.StorageProofConfirmed && len(so.SectorRoots) != 0
+}
+
+// proofWindow is the proof window of a storage responsibility whose storage proof is pending
+type proofWindow struct {
+	start    uint64
+	deadline uint64
+}
+
+// proofWindowIndex indexes the proof windows of the storage responsibilities whose storage
+// proofs are pending, which is updated as the storage responsibilities are stored
+type proofWindowIndex struct {
+	windows map[common.Hash]proofWindow
+	mu      sync.Mutex
+}
+
+// newProofWindowIndex creates an empty proofWindowIndex
+func newProofWindowIndex() *proofWindowIndex {
+	return &proofWindowIndex{
+		windows: make(map[common.Hash]proofWindow),
+	}
+}
+
+// update indexes the proof window of the storage responsibility if its storage proof is pending,
+// otherwise removes it from the index
+func (idx *proofWindowIndex) update(so StorageResponsibility) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !so.proofPending() {
+		delete(idx.windows, so.id())
+		return
+	}
+	idx.windows[so.id()] = proofWindow{start: so.expiration(), deadline: so.proofDeadline()}
+}
+
+// remove removes the storage responsibility from the index
+func (idx *proofWindowIndex) remove(soid common.Hash) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.windows, soid)
+}
+
+// upcoming returns the number of pending storage proofs whose proof window is open or opens
+// within upcomingProofHorizon blocks
+func (idx *proofWindowIndex) upcoming(blockHeight uint64) uint64 {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var count uint64
+	for _, window := range idx.windows {
+		if blockHeight+upcomingProofHorizon >= window.start && blockHeight <= window.deadline {
+			count++
+		}
+	}
+	return count
+}
+
+// loadProofWindows builds the proof window index from the storage responsibilities in DB, which
+// is called once when the host is created
+func (h *StorageHost) loadProofWindows() error {
+	return forEachStorageResponsibility(h.db, h.proofWindows.update)
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagehost
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/core/types"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestStorageHost_Health test the host health reflects the folders, the free sector slots and
+// the storage proofs due within the horizon
+func TestStorageHost_Health(t *testing.T) {
+	h := newTestStorageHost(t)
+	if err := h.StorageManager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	h.blockHeight = 1000
+
+	folderPath := filepath.Join(h.persistDir, "folder")
+	numSectors := uint64(16)
+	if err := h.StorageManager.AddStorageFolder(folderPath, numSectors*storage.SectorSize); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		windowStart       uint64
+		proofConfirmed    bool
+		expectProofReport bool
+	}{
+		// proof window open
+		{h.blockHeight - 1, false, true},
+		// proof window opens within the horizon
+		{h.blockHeight + upcomingProofHorizon, false, true},
+		// proof window opens beyond the horizon
+		{h.blockHeight + upcomingProofHorizon + 1, false, false},
+		// proof already confirmed
+		{h.blockHeight - 1, true, false},
+	}
+	var expectUpcoming uint64
+	for i, test := range tests {
+		windowEnd := test.windowStart + h.config.WindowSize
+		so := StorageResponsibility{
+			SectorRoots: []common.Hash{{byte(i + 1)}},
+			OriginStorageContract: types.StorageContract{
+				FileSize:    uint64(i),
+				WindowStart: test.windowStart,
+				WindowEnd:   windowEnd,
+			},
+			StorageContractRevisions: []types.StorageContractRevision{
+				{NewWindowStart: test.windowStart, NewWindowEnd: windowEnd},
+			},
+			CreateContractConfirmed: true,
+			StorageProofConfirmed:   test.proofConfirmed,
+		}
+		if err := h.storeStorageResponsibility(so.id(), so); err != nil {
+			t.Fatal(err)
+		}
+		if test.expectProofReport {
+			expectUpcoming++
+		}
+	}
+
+	health := h.Health()
+	if len(health.Folders) != 1 || health.Folders[0].Path != folderPath || health.Folders[0].TotalSectors != numSectors {
+		t.Errorf("unexpected folders %+v", health.Folders)
+	}
+	if health.FreeSectors != numSectors {
+		t.Errorf("expect %v free sectors, got %v", numSectors, health.FreeSectors)
+	}
+	if health.UpcomingProofs != expectUpcoming {
+		t.Errorf("expect %v upcoming proofs, got %v", expectUpcoming, health.UpcomingProofs)
+	}
+	if health.WalDepth != 0 {
+		t.Errorf("expect wal depth 0, got %v", health.WalDepth)
+	}
+
+	// the proof window index is rebuilt from DB after restart
+	h.StorageManager.Close()
+	h.db.Close()
+	h2, err := New(h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.db.Close()
+	if upcoming := h2.proofWindows.upcoming(h.blockHeight); upcoming != expectUpcoming {
+		t.Errorf("expect %v upcoming proofs after restart, got %v", expectUpcoming, upcoming)
+	}
+}
@@ -41,10 +41,27 @@ type StorageHost struct {
 	lockedStorageResponsibility map[common.Hash]*TryMutex
 	clientToContract            map[string]common.Hash
 
+	// submitProof submits the storage proof of the storage responsibility
+	submitProof func(so StorageResponsibility) error
+
+	// proofsInFlight is the block height the storage proof of each storage responsibility is
+	// submitted at, which is not confirmed yet
+	proofsInFlight map[common.Hash]uint64
+
+	// draining is set by Drain, and drained is set once the drain finishes. negotiations tracks
+	// the in-flight contract create and upload negotiations Drain waits for
+	draining     bool
+	drained      bool
+	negotiations sync.WaitGroup
+
+	// proofWindows indexes the proof windows of the pending storage proofs for the health summary
+	proofWindows *proofWindowIndex
+
 	// things for log and persistence
-	db         *ethdb.LDBDatabase
-	persistDir string
-	log        log.Logger
+	db              *ethdb.LDBDatabase
+	revisionBatcher *revisionBatcher
+	persistDir      string
+	log             log.Logger
 
 	// things for thread safety
 	lock sync.RWMutex
@@ -109,6 +126,8 @@ func New(persistDir string) (*StorageHost, error) {
 		persistDir:                  persistDir,
 		lockedStorageResponsibility: make(map[common.Hash]*TryMutex),
 		clientToContract:            make(map[string]common.Hash),
+		proofsInFlight:              make(map[common.Hash]uint64),
+		proofWindows:                newProofWindowIndex(),
 	}
 
 	var err error
@@ -124,6 +143,14 @@ func New(persistDir string) (*StorageHost, error) {
 	if h.db, err = openDB(filepath.Join(persistDir, databaseFile)); err != nil {
 		return nil, err
 	}
+	h.revisionBatcher = newRevisionBatcher(func(sos map[common.Hash]StorageResponsibility) error {
+		return putStorageResponsibilities(h.db, sos)
+	})
+	h.submitProof = h.submitStorageProof
+	// index the proof windows of the storage responsibilities stored
+	if err = h.loadProofWindows(); err != nil {
+		return nil, err
+	}
 
 	return &h, nil
 }
@@ -139,6 +166,10 @@ func (h *StorageHost) Start(eth storage.HostBackend) (err error) {
 	if err = h.load(); err != nil {
 		return err
 	}
+	h.StorageManager.SetReadVerificationRate(h.getInternalConfig().ReadVerificationRate)
+	if err = h.StorageManager.SetFolderSelection(h.getInternalConfig().FolderSelection); err != nil {
+		return err
+	}
 	// start the storage manager
 	if err = h.StorageManager.Start(); err != nil {
 		return err
@@ -165,6 +196,10 @@ func (h *StorageHost) Close() error {
 	newErr := h.StorageManager.Close()
 	err = common.ErrCompose(err, newErr)
 
+	// write the pending revisions before closing the database
+	newErr = h.revisionBatcher.close()
+	err = common.ErrCompose(err, newErr)
+
 	h.db.Close()
 
 	newErr = h.syncConfig()
@@ -295,10 +330,43 @@ func (h *StorageHost) setMaxDuration(val uint64) error {
 	h.lock.Lock()
 	defer h.lock.Unlock()
 
+	if err := checkContractDuration(val, h.config.WindowSize, h.maxContractDuration()); err != nil {
+		return err
+	}
 	h.config.MaxDuration = val
 	return h.syncConfig()
 }
 
+// checkContractDuration checks the proof window is not empty, and the contracts of the max
+// duration together with the proof window do not exceed the max contract duration allowed on
+// chain. The zero maxContractDuration means the duration is not bounded on chain
+func checkContractDuration(maxDuration, windowSize, maxContractDuration uint64) error {
+	if windowSize == 0 {
+		return errors.New("empty proof window")
+	}
+	if maxContractDuration == 0 {
+		return nil
+	}
+	if windowSize > maxContractDuration || maxDuration > maxContractDuration-windowSize {
+		return fmt.Errorf("duration too long: %v blocks with the window of %v blocks exceeds the max contract duration of %v blocks", maxDuration, windowSize, maxContractDuration)
+	}
+	return nil
+}
+
+// maxContractDuration returns the max contract duration allowed on chain once the storage duration
+// fork is scheduled, so that the host does not advertise a duration rejected after the fork. Zero is
+// returned if the fork is not scheduled
+func (h *StorageHost) maxContractDuration() uint64 {
+	if h.ethBackend == nil || h.ethBackend.GetBlockChain() == nil {
+		return 0
+	}
+	config := h.ethBackend.GetBlockChain().Config()
+	if config.StorageDurationBlock == nil {
+		return 0
+	}
+	return config.MaxContractDuration(config.StorageDurationBlock)
+}
+
 // setMaxReviseBatchSize set the MaxReviseBatchSize
 func (h *StorageHost) setMaxReviseBatchSize(val uint64) error {
 	h.lock.Lock()
@@ -415,13 +483,13 @@ func (h *StorageHost) externalConfig() storage.HostExtConfig {
 	totalStorageSpace = storage.SectorSize * hs.TotalSectors
 	remainingStorageSpace = storage.SectorSize * hs.FreeSectors
 
-	acceptingContracts := h.config.AcceptingContracts
+	acceptingContracts := h.config.AcceptingContracts && !h.draining
 	MaxDeposit := h.config.MaxDeposit
 	paymentAddress := h.config.PaymentAddress
 
 	if paymentAddress == (common.Address{}) {
 		acceptingContracts = false
-		return storage.HostExtConfig{AcceptingContracts: false}
+		return storage.HostExtConfig{AcceptingContracts: false, Capabilities: h.Capabilities()}
 	}
 
 	account := accounts.Account{Address: paymentAddress}
@@ -467,5 +535,11 @@ func (h *StorageHost) externalConfig() storage.HostExtConfig {
 		StoragePrice:           h.config.StoragePrice,
 		UploadBandwidthPrice:   h.config.UploadBandwidthPrice,
 		Version:                storage.ConfigVersion,
+		Capabilities:           h.Capabilities(),
 	}
 }
+
+// Capabilities returns the features supported by the storage host
+func (h *StorageHost) Capabilities() storage.Capabilities {
+	return storage.LocalCapabilities()
+}
@@ -5,6 +5,7 @@
 package storagehost
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/params"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/davecgh/go-spew/spew"
 )
@@ -90,3 +92,104 @@ func checkHostConfigFile(path string, expect storage.HostIntConfig) error {
 	}
 	return nil
 }
+
+// TestStorageHost_LoadLegacyConfig test the config fields missing in the file saved by the
+// previous version are loaded as the default
+func TestStorageHost_LoadLegacyConfig(t *testing.T) {
+	h := newTestStorageHost(t)
+	h.StorageManager.Start()
+	h.StorageManager.Close()
+	h.db.Close()
+
+	path := filepath.Join(h.persistDir, HostSettingFile)
+	saveLegacyHostConfig(t, path, h.extractPersistence(), "proofSubmissionMargin", "readVerificationRate")
+
+	h2, err := New(h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.db.Close()
+	if err = h2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if h2.config.ProofSubmissionMargin != storage.DefaultProofSubmissionMargin {
+		t.Errorf("expect proof submission margin %v, got %v", storage.DefaultProofSubmissionMargin, h2.config.ProofSubmissionMargin)
+	}
+	if h2.config.ReadVerificationRate != storage.DefaultReadVerificationRate {
+		t.Errorf("expect read verification rate %v, got %v", storage.DefaultReadVerificationRate, h2.config.ReadVerificationRate)
+	}
+}
+
+// TestStorageHost_LoadInvalidReadVerificationRate test the read verification rate out of range in
+// the file is loaded as the default
+func TestStorageHost_LoadInvalidReadVerificationRate(t *testing.T) {
+	h := newTestStorageHost(t)
+	h.StorageManager.Start()
+	h.StorageManager.Close()
+	h.db.Close()
+
+	h.config.ReadVerificationRate = 1.5
+	if err := h.syncConfig(); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := New(h.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.db.Close()
+	if err = h2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if h2.config.ReadVerificationRate != storage.DefaultReadVerificationRate {
+		t.Errorf("expect read verification rate %v, got %v", storage.DefaultReadVerificationRate, h2.config.ReadVerificationRate)
+	}
+}
+
+// saveLegacyHostConfig saves the host persistence without the config fields, which mimics the
+// file saved by the previous version
+func saveLegacyHostConfig(t *testing.T, path string, persist *persistence, fields ...string) {
+	data, err := json.Marshal(persist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy map[string]interface{}
+	if err = json.Unmarshal(data, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	config := legacy["config"].(map[string]interface{})
+	for _, field := range fields {
+		if _, exist := config[field]; !exist {
+			t.Fatalf("field %v not in the config", field)
+		}
+		delete(config, field)
+	}
+	if err = common.SaveDxJSON(storageHostMeta, path, legacy); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCheckContractDuration test the max duration together with the proof window is bounded by the
+// max contract duration on chain, and is not bounded before the storage duration fork is scheduled
+func TestCheckContractDuration(t *testing.T) {
+	windowSize := uint64(storage.ProofWindowSize)
+	maxContractDuration := params.DefaultMaxContractDuration
+	tests := []struct {
+		name                string
+		maxDuration         uint64
+		windowSize          uint64
+		maxContractDuration uint64
+		expectErr           bool
+	}{
+		{"empty proof window", 1, 0, maxContractDuration, true},
+		{"at max contract duration", maxContractDuration - windowSize, windowSize, maxContractDuration, false},
+		{"exceeds max contract duration", maxContractDuration - windowSize + 1, windowSize, maxContractDuration, true},
+		{"proof window exceeds max contract duration", 0, maxContractDuration + 1, maxContractDuration, true},
+		{"not bounded on chain", maxContractDuration, windowSize, 0, false},
+	}
+	for _, test := range tests {
+		err := checkContractDuration(test.maxDuration, test.windowSize, test.maxContractDuration)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%v: expect error %v, got %v", test.name, test.expectErr, err)
+		}
+	}
+}
@@ -79,7 +79,7 @@ func (sm *storageManager) createAddSectorBatchUpdate(roots []common.Hash) (updat
 		ids: make([]sectorID, 0, len(roots)),
 	}
 	for _, root := range roots {
-		id := sm.calculateSectorID(root)
+		id := sm.lookupSectorID(root)
 		update.ids = append(update.ids, id)
 	}
 	return
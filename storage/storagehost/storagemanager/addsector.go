@@ -5,8 +5,11 @@
 package storagemanager
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/writeaheadlog"
@@ -15,6 +18,14 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
+const (
+	// states of an add sector request, used to decide between the worker and the caller
+	// whether the request finished or was abandoned
+	addSectorPending int32 = iota
+	addSectorFinished
+	addSectorAbandoned
+)
+
 type (
 	// addSectorUpdate is the update to add a sector
 	addSectorUpdate struct {
@@ -36,6 +47,10 @@ type (
 
 		// physical is the flag for whether this update is to add a physical sector or not
 		physical bool
+
+		// ctx is the context of the add sector request. The update is reverted if the
+		// context is done before the update is applied. It is nil for recovered updates
+		ctx context.Context
 	}
 
 	// addSectorInitPersist is the initial persist part for add sector update
@@ -62,16 +77,75 @@ type (
 )
 
 // AddSector add the sector to host manager
-// whether the data has merkle root root is not validated here, and assumed valid
+// whether the data has merkle root root is not validated here, and assumed valid.
+// The request is abandoned with ErrAddSectorTimeout if not finished within the add sector timeout
 func (sm *storageManager) AddSector(root common.Hash, data []byte) (err error) {
-	sm.lock.Lock()
-	defer sm.lock.Unlock()
+	ctx := context.Background()
+	if timeout := time.Duration(atomic.LoadInt64(&sm.addSectorTimeout)); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return sm.AddSectorContext(ctx, root, data)
+}
+
+// AddSectorContext add the sector to host manager, and abandon the request with ErrAddSectorTimeout
+// if the context is done first. The partial update of the abandoned request is reverted in the
+// background, so the caller is free to try another host without waiting for a stuck disk.
+// If the sector is committed after the request has been abandoned, the sector is deleted again,
+// so that no orphan sector is left in the storage manager
+func (sm *storageManager) AddSectorContext(ctx context.Context, root common.Hash, data []byte) (err error) {
 	// validate the add sector request
 	if err = validateAddSector(root, data); err != nil {
 		return fmt.Errorf("validation failed: %v", err)
 	}
+	if err = sm.tm.Add(); err != nil {
+		return errStopped
+	}
+	// state decides whether the result is delivered to the caller or the request is
+	// abandoned. Whichever of the worker and the caller changes it first wins
+	var state int32
+	done := make(chan error, 1)
+	go func() {
+		defer sm.tm.Done()
+		err := sm.addSector(ctx, root, data)
+		if err == nil && !atomic.CompareAndSwapInt32(&state, addSectorPending, addSectorFinished) {
+			// The request has been abandoned by the caller. Undo the committed sector
+			if delErr := sm.DeleteSector(root); delErr != nil {
+				sm.log.Warn("cannot delete the sector of the abandoned add sector request", "root", root, "err", delErr)
+			}
+			err = ErrAddSectorTimeout
+		}
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		return
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&state, addSectorPending, addSectorAbandoned) {
+			return ErrAddSectorTimeout
+		}
+		// The worker has already committed the sector, deliver the result
+		return <-done
+	}
+}
+
+// SetAddSectorTimeout set the timeout of the AddSector requests. 0 means no timeout
+func (sm *storageManager) SetAddSectorTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&sm.addSectorTimeout, int64(timeout))
+}
+
+// addSector add the sector to host manager within the context
+func (sm *storageManager) addSector(ctx context.Context, root common.Hash, data []byte) (err error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	// The request might have been abandoned while waiting for the lock
+	if ctx.Err() != nil {
+		return ErrAddSectorTimeout
+	}
 	// create the update
 	update := sm.createAddSectorUpdate(root, data)
+	update.ctx = ctx
 	// record the add sector intent
 	if err = update.recordIntent(sm); err != nil {
 		return
@@ -80,6 +154,9 @@ func (sm *storageManager) AddSector(root common.Hash, data []byte) (err error) {
 	if err = sm.prepareProcessReleaseUpdate(update, targetNormal); err != nil {
 		if upErr := err.(*updateError); !upErr.isNil() {
 			sm.logError(update, upErr)
+			if upErr.prepareErr == ErrAddSectorTimeout || upErr.processErr == ErrAddSectorTimeout {
+				err = ErrAddSectorTimeout
+			}
 		} else {
 			err = nil
 		}
@@ -88,6 +165,11 @@ func (sm *storageManager) AddSector(root common.Hash, data []byte) (err error) {
 	return
 }
 
+// abandoned returns whether the add sector request has been abandoned
+func (update *addSectorUpdate) abandoned() bool {
+	return update.ctx != nil && update.ctx.Err() != nil
+}
+
 // validateAddSector validate the input of add sector request
 // It checks whether the input data size is larger than the sector size
 func validateAddSector(root common.Hash, data []byte) (err error) {
@@ -99,7 +181,7 @@ func validateAddSector(root common.Hash, data []byte) (err error) {
 
 // createAddSectorUpdate create a addSectorUpdate
 func (sm *storageManager) createAddSectorUpdate(root common.Hash, data []byte) (update *addSectorUpdate) {
-	sectorID := sm.calculateSectorID(root)
+	sectorID := sm.lookupSectorID(root)
 	// copy the data
 	dataCpy := make([]byte, storage.SectorSize)
 	copy(dataCpy, data)
@@ -158,6 +240,9 @@ func (update *addSectorUpdate) prepare(manager *storageManager, target uint8) (e
 		if update.physical && manager.disruptor.disrupt("physical prepare normal stop") {
 			return errStopped
 		}
+		if err == nil && update.abandoned() {
+			return ErrAddSectorTimeout
+		}
 	case targetRecoverCommitted:
 		err = update.prepareCommitted(manager)
 	default:
@@ -229,7 +314,7 @@ func (update *addSectorUpdate) release(manager *storageManager, upErr *updateErr
 	if update.physical {
 		// Need to delete the sector and folder id to sector mapping
 		if update.sector != nil {
-			batch.Delete(makeSectorKey(update.sector.id))
+			batch = manager.db.deleteSectorToBatch(batch, update.sector.id)
 		}
 		// Need to delete the mapping from folder id to sector id
 		if update.folder != nil {
@@ -272,7 +357,7 @@ func (update *addSectorUpdate) prepareNormal(manager *storageManager) (err error
 	var op writeaheadlog.Operation
 	if existErr != nil && existErr != leveldb.ErrNotFound {
 		// something unexpect error happened, return the error
-		return
+		return existErr
 	} else if existErr == nil {
 		// entry is found in database. This shall be a virtual sector update. Update the database
 		// entry and there is no need to access the folder.
@@ -293,7 +378,7 @@ func (update *addSectorUpdate) prepareNormal(manager *storageManager) (err error
 		update.physical = true
 		var sf *storageFolder
 		var index uint64
-		sf, index, err = manager.folders.selectFolderToAddWithRetry(maxFolderSelectionRetries)
+		sf, index, err = manager.folders.selectFolderToAddWithRetry(manager.folderSelectionStrategy(), maxFolderSelectionRetries)
 		if err != nil {
 			// If there is error, it can only be errAllFoldersFullOrUsed.
 			// In this case, return the err
@@ -314,6 +399,9 @@ func (update *addSectorUpdate) prepareNormal(manager *storageManager) (err error
 		if err != nil {
 			return
 		}
+		// store the sector tree along with the sector, so that the proofs of the sector
+		// do not need to hash the whole sector
+		update.batch = manager.db.saveSectorTreeToBatch(update.batch, update.id, buildSectorTree(update.data))
 		update.batch, err = manager.db.saveStorageFolderToBatch(update.batch, sf)
 		if err != nil {
 			return
@@ -330,6 +418,7 @@ func (update *addSectorUpdate) prepareNormal(manager *storageManager) (err error
 		err = update.txn.InitErr
 		return
 	}
+	manager.disruptor.disrupt("add sector wal append")
 	err = <-update.txn.Append([]writeaheadlog.Operation{op})
 	if err != nil {
 		return
@@ -379,11 +468,19 @@ func (update *addSectorUpdate) processNormal(manager *storageManager) (err error
 		return
 	}
 	if update.physical {
-		_, err = update.folder.dataFile.WriteAt(update.data, int64(update.sector.index*storage.SectorSize))
+		var offset int64
+		if offset, err = sectorOffset(update.sector.index); err != nil {
+			return
+		}
+		_, err = update.folder.dataFile.WriteAt(update.data, offset)
 		if err != nil {
 			return
 		}
 	}
+	// The database is not yet updated, so the abandoned request can still be reverted
+	if update.abandoned() {
+		return ErrAddSectorTimeout
+	}
 	if err = manager.db.writeBatch(update.batch); err != nil {
 		return
 	}
@@ -6,11 +6,11 @@ package storagemanager
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"testing"
 	"time"
 
@@ -96,6 +96,94 @@ func TestDisruptedPhysicalAddSector(t *testing.T) {
 	}
 }
 
+// TestAddSectorTimeout test the add sector request is abandoned when the wal write is stuck,
+// and the partial update is reverted cleanly
+func TestAddSectorTimeout(t *testing.T) {
+	d := newDisruptor().register("add sector wal append", func() bool {
+		time.Sleep(500 * time.Millisecond)
+		return false
+	})
+	sm := newTestStorageManager(t, "", d)
+	path := randomFolderPath(t, "")
+	size := uint64(1 << 25)
+	if err := sm.AddStorageFolder(path, size); err != nil {
+		t.Fatal(err)
+	}
+	data := randomBytes(storage.SectorSize)
+	root := merkle.Sha256MerkleTreeRoot(data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sm.AddSectorContext(ctx, root, data); err != ErrAddSectorTimeout {
+		t.Fatalf("expect error %v, got %v", ErrAddSectorTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("add sector not abandoned on timeout, returned after %v", elapsed)
+	}
+	// wait for the abandoned update to be reverted
+	sm.lock.Lock()
+	sm.lock.Unlock()
+	id := sm.calculateSectorID(root)
+	if err := checkSectorNotExist(id, sm); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFoldersHasExpectedSectors(sm, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the storage manager is still able to add the sector afterwards
+	delete(*d, "add sector wal append")
+	if err := sm.AddSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSectorExist(root, sm, data, 1); err != nil {
+		t.Fatal(err)
+	}
+	sm.shutdown(t, time.Second)
+	if err := checkWalTxnNum(filepath.Join(sm.persistDir, walFileName), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddSectorTimeoutAfterCommit test the sector committed after the add sector request is
+// abandoned is deleted again, so that no orphan sector is left
+func TestAddSectorTimeoutAfterCommit(t *testing.T) {
+	d := newDisruptor().register("physical process normal", func() bool {
+		time.Sleep(300 * time.Millisecond)
+		return false
+	})
+	sm := newTestStorageManager(t, "", d)
+	path := randomFolderPath(t, "")
+	size := uint64(1 << 25)
+	if err := sm.AddStorageFolder(path, size); err != nil {
+		t.Fatal(err)
+	}
+	data := randomBytes(storage.SectorSize)
+	root := merkle.Sha256MerkleTreeRoot(data)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := sm.AddSectorContext(ctx, root, data); err != ErrAddSectorTimeout {
+		t.Fatalf("expect error %v, got %v", ErrAddSectorTimeout, err)
+	}
+	// wait for the committed sector to be deleted
+	id := sm.calculateSectorID(root)
+	var err error
+	for i := 0; i != 20; i++ {
+		time.Sleep(50 * time.Millisecond)
+		if err = checkSectorNotExist(id, sm); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFoldersHasExpectedSectors(sm, 0); err != nil {
+		t.Fatal(err)
+	}
+	sm.shutdown(t, time.Second)
+}
+
 // TestDisruptedVirtualAddSector test the case of disrupted during add virtual sectors
 func TestDisruptedVirtualAddSector(t *testing.T) {
 	tests := []struct {
@@ -238,7 +326,10 @@ func TestAddSectorsStopRecoverVirtual(t *testing.T) {
 	}
 }
 
-// TestAddSectorConcurrent test the scenario of multiple goroutines add sector at the same time
+// TestAddSectorConcurrent test the scenario of multiple goroutines add sector at the same time.
+// Some goroutines add the same root concurrently (one physical add followed by virtual adds),
+// while the others add unique roots. After all goroutines finish, the sector count of each
+// root and the stored sectors of the folders shall be deterministic.
 func TestAddSectorConcurrent(t *testing.T) {
 	sm := newTestStorageManager(t, "", newDisruptor())
 	size := uint64(1 << 25)
@@ -249,114 +340,63 @@ func TestAddSectorConcurrent(t *testing.T) {
 			t.Fatalf("test %v: %v", "", err)
 		}
 	}
-	// create 24 valid sectors, with a mix of virtual and invalid sectors
-	var numSectors, numVirtual, numTotal uint32
-	var wg sync.WaitGroup
+	// 4 shared roots each added 5 times, and 20 unique roots each added once.
+	// This sums up to 24 physical sectors, which is exactly the capacity of the folders.
+	numShared, addsPerShared, numUnique := 4, 5, 20
 	type expectSector struct {
 		count uint64
 		data  []byte
 	}
 	expect := make(map[common.Hash]expectSector)
-	var expectLock sync.Mutex
-	errChan := make(chan error, 1)
-	stopChan := time.After(20 * time.Second)
-	for atomic.LoadUint32(&numSectors) < 24 {
-		time.Sleep(100 * time.Millisecond)
-		// fatal err if timeout
-		select {
-		case <-stopChan:
-			t.Fatalf("After 10 seconds, still not complete")
-		case err := <-errChan:
-			t.Fatalf("error happened %v", err)
-		default:
-		}
-		// increment numSectors when a sector is successfully added
+	var roots []common.Hash
+	for i := 0; i != numShared+numUnique; i++ {
+		data := randomBytes(storage.SectorSize)
+		root := merkle.Sha256MerkleTreeRoot(data)
+		count := uint64(1)
+		if i < numShared {
+			count = uint64(addsPerShared)
+		}
+		expect[root] = expectSector{count: count, data: data}
+		for j := uint64(0); j != count; j++ {
+			roots = append(roots, root)
+		}
+	}
+	// All goroutines wait for the start signal to maximize the contention
+	start := make(chan struct{})
+	errChan := make(chan error, len(roots))
+	var wg sync.WaitGroup
+	for _, root := range roots {
 		wg.Add(1)
-		go func() {
-			atomic.AddUint32(&numTotal, 1)
+		go func(root common.Hash) {
 			defer wg.Done()
-
-			// The possibility of adding a virtual is 25% when numSectors is not 0
-			virtual := atomic.LoadUint32(&numSectors) > 0 && (randomUint32()%4 == 0)
-			if virtual {
-				atomic.AddUint32(&numVirtual, 1)
-				var rt common.Hash
-				var data []byte
-				expectLock.Lock()
-				for sectorRoot, sector := range expect {
-					rt = sectorRoot
-					data = sector.data
-					count := sector.count + 1
-					expect[sectorRoot] = expectSector{
-						count: count,
-						data:  data,
-					}
-					break
-				}
-				expectLock.Unlock()
-				if err := sm.AddSector(rt, data); err != nil {
-					errChan <- fmt.Errorf("add virtual sector cause an error: %v", err)
-				}
-			} else {
-				// create a random sector
-				data := randomBytes(storage.SectorSize)
-				root := merkle.Sha256MerkleTreeRoot(data)
-				expectLock.Lock()
-				if _, exist := expect[root]; exist {
-					// The root exist. Thus unlock and return
-					expectLock.Unlock()
-					return
-				}
-				expectLock.Unlock()
-				if err := sm.AddSector(root, data); err != nil {
-					upErr, isUpErr := err.(*updateError)
-					if !isUpErr {
-						errChan <- err
-						return
-					}
-					if upErr.isNil() || upErr.prepareErr == errAllFoldersFullOrUsed {
-						// Currently busy
-						return
-					}
-					// unexpected error
-					if !upErr.isNil() {
-						errChan <- err
-						return
-					}
-				}
-				// There is no error. Save the data to expect
-				expectLock.Lock()
-				expect[root] = expectSector{
-					count: 1,
-					data:  data,
-				}
-				expectLock.Unlock()
-				atomic.AddUint32(&numSectors, 1)
+			<-start
+			if err := sm.AddSector(root, expect[root].data); err != nil {
+				errChan <- fmt.Errorf("add sector %x: %v", root, err)
 			}
-		}()
-		<-time.After(50 * time.Millisecond)
+		}(root)
 	}
+	close(start)
 	waitChan := make(chan struct{})
 	go func() {
 		wg.Wait()
 		close(waitChan)
 	}()
 	select {
-	case err := <-errChan:
-		t.Fatal(err)
 	case <-waitChan:
 	case <-time.After(60 * time.Second):
 		t.Fatalf("time out")
 	}
-
+	close(errChan)
+	for err := range errChan {
+		t.Fatal(err)
+	}
 	// Check the result
-	t.Logf("after %v tries, added %v virtual sectors, got %v sectors", numTotal, numVirtual, numSectors)
 	for rt, expect := range expect {
 		if err := checkSectorExist(rt, sm, expect.data, expect.count); err != nil {
 			t.Fatal(err)
 		}
 	}
-	if err := checkFoldersHasExpectedSectors(sm, 24); err != nil {
+	if err := checkFoldersHasExpectedSectors(sm, numShared+numUnique); err != nil {
 		t.Fatal(err)
 	}
 	sm.shutdown(t, 1*time.Second)
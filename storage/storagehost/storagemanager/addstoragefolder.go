@@ -84,12 +84,6 @@ func (sm *storageManager) validateAddStorageFolder(path string, size uint64) (er
 		err = fmt.Errorf("size too large")
 		return
 	}
-	// check whether the folder path already exists
-	_, err = os.Stat(path)
-	if !os.IsNotExist(err) {
-		err = fmt.Errorf("folder already exists: %v", path)
-		return
-	}
 	// check whether the folders has exceed limit
 	if size := sm.folders.size(); size >= maxNumFolders {
 		err = fmt.Errorf("too many folders to manager")
@@ -110,6 +104,48 @@ func (sm *storageManager) validateAddStorageFolder(path string, size uint64) (er
 		err = fmt.Errorf("folder already exist in memory")
 		return
 	}
+	// check whether the folder path already exists. A partial folder left by an interrupted
+	// attempt is cleaned when the recorded intent is reverted on start up, so any existing
+	// path here is not created by the storage manager and must not be touched.
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		err = fmt.Errorf("folder already exists: %v", path)
+		return
+	}
+	return nil
+}
+
+// isPartialFolder checks whether the path is a directory containing nothing but the data file
+func isPartialFolder(path string) bool {
+	dir, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		if name != dataFileName {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanPartialFolder removes the data file in the path, and then remove the directory if it is
+// empty. Files not existing are not regarded as error. It shall only be called on the folder
+// created by a recorded add storage folder intent.
+func cleanPartialFolder(path string) (err error) {
+	if err = os.Remove(filepath.Join(path, dataFileName)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if !isPartialFolder(path) {
+		return nil
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return
+	}
 	return nil
 }
 
@@ -247,7 +283,7 @@ func (update *addStorageFolderUpdate) release(manager *storageManager, upErr *up
 	// file, which might be useful to other programs. So delete the file only if the processErr
 	// is not os.ErrExist
 	if upErr.processErr != os.ErrExist {
-		if newErr := os.Remove(filepath.Join(update.path, dataFileName)); newErr != nil {
+		if newErr := cleanPartialFolder(update.path); newErr != nil {
 			err = common.ErrCompose(err, newErr)
 		}
 	}
@@ -319,6 +355,9 @@ func (update *addStorageFolderUpdate) processNormal(manager *storageManager) (er
 	if err = update.folder.dataFile.Truncate(int64(update.size)); err != nil {
 		return err
 	}
+	if manager.disruptor.disrupt("add folder process normal stop") {
+		return errStopped
+	}
 	// write the batch to database
 	if err = manager.db.writeBatch(update.batch); err != nil {
 		return err
@@ -340,8 +379,13 @@ func decodeAddStorageFolderUpdate(txn *writeaheadlog.Transaction) (update *addSt
 	return
 }
 
-// prepareCommitted is the function called in prepare stage as preparing committed updates
+// prepareCommitted is the function called in prepare stage as preparing committed updates.
+// If the folder is not loaded, the previous attempt stopped before the folder is saved to
+// database, and only the partial folder on disk is left to be cleaned in release.
 func (update *addStorageFolderUpdate) prepareCommitted(manager *storageManager) (err error) {
+	if !manager.folders.exist(update.path) {
+		return nil
+	}
 	update.folder, err = manager.folders.get(update.path)
 	if err != nil {
 		return err
@@ -5,6 +5,7 @@
 package storagemanager
 
 import (
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -107,6 +108,85 @@ func TestAddStorageFolderRecover(t *testing.T) {
 	}
 }
 
+// TestAddStorageFolderRetryAfterCrash test the scenario that the storage manager crashed after
+// creating the data file but before saving the folder. After restart, the partial folder shall
+// be cleaned, and retrying adding the folder at the same path shall succeed.
+func TestAddStorageFolderRetryAfterCrash(t *testing.T) {
+	d := newDisruptor().register("add folder process normal stop", func() bool {
+		return true
+	})
+	sm := newTestStorageManager(t, "", d)
+	path := randomFolderPath(t, "")
+	size := uint64(1 << 25)
+	if err := sm.AddStorageFolder(path, size); err != nil {
+		t.Fatal(err)
+	}
+	// the data file is created before crash
+	if _, err := os.Stat(filepath.Join(path, dataFileName)); err != nil {
+		t.Fatalf("data file not created before crash: %v", err)
+	}
+	sm.shutdown(t, time.Second)
+	// restart the storage manager
+	newsm, err := New(sm.persistDir)
+	if err != nil {
+		t.Fatalf("cannot create a new sm: %v", err)
+	}
+	newSM := newsm.(*storageManager)
+	if err = newSM.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// wait for 100ms for the update to complete
+	<-time.After(100 * time.Millisecond)
+	if newSM.folders.exist(path) {
+		t.Fatalf("folders exist path %v", path)
+	}
+	exist, err := newSM.db.hasStorageFolder(path)
+	if err != nil {
+		t.Fatalf("database check folder exist: %v", err)
+	}
+	if exist {
+		t.Fatalf("database has folder")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("partial folder not cleaned %v: %v", path, err)
+	}
+	// retry shall succeed
+	if err = newSM.AddStorageFolder(path, size); err != nil {
+		t.Fatalf("retry add storage folder: %v", err)
+	}
+	if !newSM.folders.exist(path) {
+		t.Fatalf("folder not exist in memory after retry")
+	}
+	if _, err := os.Stat(filepath.Join(path, dataFileName)); err != nil {
+		t.Fatalf("data file not exist after retry: %v", err)
+	}
+}
+
+// TestAddStorageFolderStalePartialFolder test adding a folder at a path only containing a data file
+// not created by a recorded intent shall fail, and the existing file shall not be touched
+func TestAddStorageFolderStalePartialFolder(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	size := uint64(1 << 25)
+	path := randomFolderPath(t, "stale")
+	if err := os.MkdirAll(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	dataFile := filepath.Join(path, dataFileName)
+	if err := ioutil.WriteFile(dataFile, []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.AddStorageFolder(path, size); err == nil {
+		t.Fatalf("adding folder at an existing path shall fail")
+	}
+	b, err := ioutil.ReadFile(dataFile)
+	if err != nil {
+		t.Fatalf("data file shall be kept: %v", err)
+	}
+	if string(b) != "stale" {
+		t.Fatalf("data file shall not be modified. Got %s", b)
+	}
+}
+
 // TestAddStorageFolderExhaustive exhaustively test the add storage folder
 func TestAddStorageFolderExhaustive(t *testing.T) {
 	d := newDisruptor()
@@ -92,6 +92,38 @@ func (db *database) getOrCreateSectorSalt() (salt sectorSalt, err error) {
 	return
 }
 
+// saveSectorSaltToBatch append the save sector salt operation to the batch
+func (db *database) saveSectorSaltToBatch(batch *leveldb.Batch, salt sectorSalt) (newBatch *leveldb.Batch) {
+	batch.Put(makeKey(sectorSaltKey), salt[:])
+	return batch
+}
+
+// getRotatingSectorSalt return the new sector salt of the rotation in progress. If no
+// rotation is in progress, exist is false
+func (db *database) getRotatingSectorSalt() (salt sectorSalt, exist bool, err error) {
+	b, err := db.lvl.Get(makeKey(rotatingSectorSaltKey), nil)
+	if err == leveldb.ErrNotFound {
+		return salt, false, nil
+	}
+	if err != nil {
+		return
+	}
+	copy(salt[:], b)
+	return salt, true, nil
+}
+
+// saveRotatingSectorSaltToBatch append the save rotating sector salt operation to the batch
+func (db *database) saveRotatingSectorSaltToBatch(batch *leveldb.Batch, salt sectorSalt) (newBatch *leveldb.Batch) {
+	batch.Put(makeKey(rotatingSectorSaltKey), salt[:])
+	return batch
+}
+
+// deleteRotatingSectorSaltToBatch append the delete rotating sector salt operation to the batch
+func (db *database) deleteRotatingSectorSaltToBatch(batch *leveldb.Batch) (newBatch *leveldb.Batch) {
+	batch.Delete(makeKey(rotatingSectorSaltKey))
+	return batch
+}
+
 // randomFolderID create a random folder id that does not exist in database.
 // After the function execution, the folderID is already stored in database to avoid other
 // randomFolderID calls to use the same id
@@ -333,8 +365,26 @@ func (db *database) saveSectorToBatch(batch *leveldb.Batch, sector *sector, fold
 }
 
 // deleteSectorToBatch add the delete sector to the batch
+// The sector tree of the sector is deleted as well
 func (db *database) deleteSectorToBatch(batch *leveldb.Batch, id sectorID) (newBatch *leveldb.Batch) {
 	batch.Delete(makeSectorKey(id))
+	batch.Delete(makeSectorTreeKey(id))
+	return batch
+}
+
+// getSectorTree get the sector tree of the sector with the specified id. If the sector tree
+// is not stored, return leveldb.ErrNotFound
+func (db *database) getSectorTree(id sectorID) (tree sectorTree, err error) {
+	b, err := db.lvl.Get(makeSectorTreeKey(id), nil)
+	if err != nil {
+		return
+	}
+	return decodeSectorTree(b)
+}
+
+// saveSectorTreeToBatch append the save sector tree operation to the batch
+func (db *database) saveSectorTreeToBatch(batch *leveldb.Batch, id sectorID, tree sectorTree) (newBatch *leveldb.Batch) {
+	batch.Put(makeSectorTreeKey(id), tree.encode())
 	return batch
 }
 
@@ -362,6 +412,12 @@ func makeSectorKey(sectorID sectorID) (key []byte) {
 	return
 }
 
+// makeSectorTreeKey make the key of the sector tree
+func makeSectorTreeKey(sectorID sectorID) (key []byte) {
+	key = makeKey(prefixSectorTree, common.Bytes2Hex(sectorID[:]))
+	return
+}
+
 // makeFolderSectorPrefix make the prefix of folder id
 func makeFolderSectorPrefix(id folderID) (prefix []byte) {
 	s := prefixFolderSector
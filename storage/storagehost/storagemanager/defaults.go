@@ -4,13 +4,21 @@
 
 package storagemanager
 
+import (
+	"time"
+
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+)
+
 const (
 	// database related keys and prefixes
-	prefixFolder         = "storageFolder"
-	prefixFolderSector   = "folderToSector"
-	prefixFolderIDToPath = "folderIDToPath"
-	sectorSaltKey        = "sectorSalt"
-	prefixSector         = "sector"
+	prefixFolder          = "storageFolder"
+	prefixFolderSector    = "folderToSector"
+	prefixFolderIDToPath  = "folderIDToPath"
+	sectorSaltKey         = "sectorSalt"
+	rotatingSectorSaltKey = "rotatingSectorSalt"
+	prefixSector          = "sector"
+	prefixSectorTree      = "sectorTree"
 )
 
 const (
@@ -30,6 +38,9 @@ const (
 	opNameExpandFolder   = "expand folder"
 	opNameShrinkFolder   = "shrink folder"
 	opNameRelocateSector = "relocate sector"
+
+	opNameRotateSectorSalt = "rotate sector salt"
+	opNameRotateSector     = "rotate sector"
 )
 
 const (
@@ -63,6 +74,15 @@ const (
 	maxNumFolders = 1 << 16
 )
 
+const (
+	// sectorTreeHeight is the height of the subtrees whose roots are stored in the sector tree.
+	// Each subtree covers 64 merkle leaves, so the sector tree of a 4MiB sector is 1024 hashes
+	sectorTreeHeight = 6
+
+	// sectorTreeChunkSize is the size of the sector data covered by one sector tree entry
+	sectorTreeChunkSize = uint64(merkle.LeafSize) << sectorTreeHeight
+)
+
 const (
 	// bitVectorGranularity is the granularity of one bitVector.
 	// Since bitVector is of type uint64, and each bit represents a single sector,
@@ -77,4 +97,24 @@ const (
 	// maxFolderSelectionRetries is the max retry numbers used for selecting a folder to put a
 	// sector
 	maxFolderSelectionRetries = 3
+
+	// defaultFolderSelection is the default strategy of selecting a folder to put a sector
+	defaultFolderSelection = FolderSelectionMostFree
+)
+
+const (
+	// maxParallelFolderLoads is the maximum number of storage folders opened in parallel
+	// when the storage manager starts
+	maxParallelFolderLoads = 8
+)
+
+const (
+	// defaultAddSectorTimeout is the default timeout of the AddSector requests
+	defaultAddSectorTimeout = 2 * time.Minute
+)
+
+const (
+	// rotateSaltBatchSize is the maximum number of sectors moved to the ids of the new salt
+	// with one update, during which the storage manager is locked
+	rotateSaltBatchSize = 64
 )
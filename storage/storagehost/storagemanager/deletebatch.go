@@ -93,7 +93,7 @@ func (sm *storageManager) createDeleteSectorBatchUpdate(roots []common.Hash) (up
 		ids: make([]sectorID, 0, len(roots)),
 	}
 	for _, root := range roots {
-		id := sm.calculateSectorID(root)
+		id := sm.lookupSectorID(root)
 		update.ids = append(update.ids, id)
 	}
 	return
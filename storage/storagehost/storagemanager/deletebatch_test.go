@@ -59,6 +59,59 @@ func TestDeleteSectorBatchNormal(t *testing.T) {
 	}
 }
 
+// TestDeleteSectorTwice test adding a sector twice and deleting it twice. The first deletion
+// decrements the count, and the second deletion frees the slot in the folder.
+func TestDeleteSectorTwice(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	path := randomFolderPath(t, "")
+	size := uint64(1 << 25)
+	if err := sm.AddStorageFolder(path, size); err != nil {
+		t.Fatal(err)
+	}
+	data := randomBytes(storage.SectorSize)
+	root := merkle.Sha256MerkleTreeRoot(data)
+	for i := 0; i != 2; i++ {
+		if err := sm.AddSector(root, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := sm.db.getSector(sm.calculateSectorID(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first deletion only decrements the count
+	if err := sm.DeleteSector(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSectorExist(root, sm, data, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFoldersHasExpectedSectors(sm, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The second deletion removes the sector and frees the slot
+	if err := sm.DeleteSector(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSectorNotExist(sm.calculateSectorID(root), sm); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFoldersHasExpectedSectors(sm, 0); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := sm.folders.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sf.usage[s.index/bitVectorGranularity].isFree(s.index % bitVectorGranularity) {
+		t.Errorf("sector slot %v not freed after deletion", s.index)
+	}
+	sm.shutdown(t, 10*time.Second)
+	if err := checkWalTxnNum(filepath.Join(sm.persistDir, walFileName), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestDeleteSectorBatchStop test
 func TestDeleteSectorBatchStop(t *testing.T) {
 	tests := []struct {
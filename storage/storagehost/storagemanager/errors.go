@@ -15,6 +15,18 @@ var (
 	// ErrNotFound is the error that happens when a sector data is not found
 	ErrNotFound = errors.New("not found")
 
+	// ErrSectorLost is the error that happens when a sector data is lost because the
+	// data file of the storage folder is truncated
+	ErrSectorLost = errors.New("sector data lost")
+
+	// ErrSectorCorrupted is the error that happens when the sector data read does not match
+	// the sector root
+	ErrSectorCorrupted = errors.New("sector data corrupted")
+
+	// ErrAddSectorTimeout is the error that the add sector request is abandoned because the
+	// request is not finished before timeout or cancellation
+	ErrAddSectorTimeout = errors.New("add sector timed out")
+
 	// errStopped is the error that during update, an error happened
 	errStopped = errors.New("storage manager has been stopped")
 
@@ -27,9 +39,19 @@ var (
 	// errFolderAlreadyFull is the error trying to add a sector to an already full folder
 	errFolderAlreadyFull = errors.New("folder already full")
 
+	// errSectorSlotOutOfRange is the error that the sector slot index is beyond the slot
+	// capacity of the folder
+	errSectorSlotOutOfRange = errors.New("sector slot out of range")
+
+	// errFolderNotOpened is the error that the data file of the folder failed to open on startup
+	errFolderNotOpened = errors.New("folder data file not opened")
+
 	// errAllFoldersFullOrUsed is the error happened when all folders are full or in use
 	errAllFoldersFullOrUsed = errors.New("all folders are full or in use")
 
+	// errInvalidSectorTree is the error that the stored sector tree cannot be decoded
+	errInvalidSectorTree = errors.New("invalid sector tree")
+
 	// errDisrupted is the error that is disrupted during test
 	errDisrupted = errors.New("disrupted")
 )
@@ -0,0 +1,116 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// VerifyFolderConsistency cross check the stored sector count of the folder against the number
+// of used slots in the usage bitmap and the sectors indexed to the folder. The index is regarded
+// as the source of truth: if any divergence is found, the usage bitmap and the stored sector
+// count are rebuilt from the index, and the stale index entries are removed
+func (sm *storageManager) VerifyFolderConsistency(folderPath string) (report storage.HostFolderConsistency, err error) {
+	if folderPath, err = absolutePath(folderPath); err != nil {
+		return
+	}
+	if err = sm.tm.Add(); err != nil {
+		return report, errStopped
+	}
+	defer sm.tm.Done()
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sf, err := sm.folders.get(folderPath)
+	if err != nil {
+		return
+	}
+	report.Path = sf.path
+	report.StoredSectors = sf.storedSectors
+	report.UsedSlots = sf.numUsedSlots()
+
+	// collect the slots of the sectors indexed to the folder
+	indexed := make(map[uint64]struct{})
+	var staleIDs []sectorID
+	for _, id := range sm.db.getAllSectorsIDsFromFolder(sf.id) {
+		s, getErr := sm.db.getSector(id)
+		if getErr == leveldb.ErrNotFound {
+			staleIDs = append(staleIDs, id)
+			continue
+		}
+		if getErr != nil {
+			return report, fmt.Errorf("cannot get sector %x: %v", id, getErr)
+		}
+		if s.folderID != sf.id || s.index >= sf.numSectors {
+			staleIDs = append(staleIDs, id)
+			continue
+		}
+		indexed[s.index] = struct{}{}
+	}
+	report.IndexedSectors = uint64(len(indexed))
+	report.StaleEntries = uint64(len(staleIDs))
+	for index := uint64(0); index != sf.numSectors; index++ {
+		_, isIndexed := indexed[index]
+		isUsed := !sf.usage[index/bitVectorGranularity].isFree(index % bitVectorGranularity)
+		if isUsed && !isIndexed {
+			report.LeakedSlots++
+		} else if !isUsed && isIndexed {
+			report.MissingSlots++
+		}
+	}
+	if report.StoredSectors == report.IndexedSectors && report.LeakedSlots == 0 && report.MissingSlots == 0 && report.StaleEntries == 0 {
+		return
+	}
+	sm.log.Warn("storage folder inconsistent", "path", sf.path, "stored sectors", report.StoredSectors,
+		"used slots", report.UsedSlots, "indexed sectors", report.IndexedSectors, "leaked slots",
+		report.LeakedSlots, "missing slots", report.MissingSlots, "stale entries", report.StaleEntries)
+
+	// rebuild the folder from the index and save to database
+	prevUsage, prevStoredSectors, prevLostSectors := sf.usage, sf.storedSectors, sf.lostSectors
+	sf.rebuildUsage(indexed)
+	batch := sm.db.newBatch()
+	if batch, err = sm.db.saveStorageFolderToBatch(batch, sf); err == nil {
+		for _, id := range staleIDs {
+			batch = sm.db.deleteFolderSectorToBatch(batch, sf.id, id)
+		}
+		err = sm.db.writeBatch(batch)
+	}
+	if err != nil {
+		sf.usage, sf.storedSectors, sf.lostSectors = prevUsage, prevStoredSectors, prevLostSectors
+		return report, fmt.Errorf("cannot save the repaired folder: %v", err)
+	}
+	report.Repaired = true
+	return
+}
+
+// numUsedSlots returns the number of used slots in the usage bitmap
+func (sf *storageFolder) numUsedSlots() (num uint64) {
+	for index := uint64(0); index != sf.numSectors; index++ {
+		if !sf.usage[index/bitVectorGranularity].isFree(index % bitVectorGranularity) {
+			num++
+		}
+	}
+	return
+}
+
+// rebuildUsage rebuild the usage bitmap and the stored sector count with the indexes of the
+// stored sectors. The lost sectors no longer stored are removed
+func (sf *storageFolder) rebuildUsage(indexes map[uint64]struct{}) {
+	usage := make([]bitVector, len(sf.usage))
+	for index := range indexes {
+		usage[index/bitVectorGranularity].setUsage(index % bitVectorGranularity)
+	}
+	lostSectors := make(map[uint64]struct{})
+	for index := range sf.lostSectors {
+		if _, exist := indexes[index]; exist {
+			lostSectors[index] = struct{}{}
+		}
+	}
+	sf.usage, sf.storedSectors, sf.lostSectors = usage, uint64(len(indexes)), lostSectors
+}
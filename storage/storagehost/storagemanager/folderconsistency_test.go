@@ -0,0 +1,91 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestVerifyFolderConsistency test the corrupted stored sector count and usage bitmap are
+// detected and repaired from the sector index
+func TestVerifyFolderConsistency(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	defer sm.shutdown(t, time.Second)
+	path := randomFolderPath(t, "")
+	if err := sm.AddStorageFolder(path, uint64(1<<25)); err != nil {
+		t.Fatal(err)
+	}
+	numSectors := 3
+	for i := 0; i != numSectors; i++ {
+		data := randomBytes(storage.SectorSize)
+		if err := sm.AddSector(merkle.Sha256MerkleTreeRoot(data), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a consistent folder is not repaired
+	report, err := sm.VerifyFolderConsistency(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Repaired || report.StoredSectors != uint64(numSectors) || report.IndexedSectors != uint64(numSectors) {
+		t.Fatalf("unexpected report of consistent folder: %+v", report)
+	}
+
+	// corrupt the stored sector count, and leak a slot in the usage bitmap
+	sf, err := sm.folders.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaked, err := sf.freeSectorIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf.usage[leaked/bitVectorGranularity].setUsage(leaked % bitVectorGranularity)
+	sf.storedSectors += 5
+
+	report, err = sm.VerifyFolderConsistency(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := storage.HostFolderConsistency{
+		Path:           sf.path,
+		StoredSectors:  uint64(numSectors + 5),
+		UsedSlots:      uint64(numSectors + 1),
+		IndexedSectors: uint64(numSectors),
+		LeakedSlots:    1,
+		Repaired:       true,
+	}
+	if report != expect {
+		t.Fatalf("unexpected report\n\texpect %+v\n\tgot %+v", expect, report)
+	}
+	if sf.storedSectors != uint64(numSectors) || sf.numUsedSlots() != uint64(numSectors) {
+		t.Errorf("folder not repaired: stored sectors %v, used slots %v", sf.storedSectors, sf.numUsedSlots())
+	}
+	if !sf.usage[leaked/bitVectorGranularity].isFree(leaked % bitVectorGranularity) {
+		t.Errorf("leaked slot %v not freed", leaked)
+	}
+
+	// the repair is saved to database
+	saved, err := sm.db.loadStorageFolder(sf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.storedSectors != uint64(numSectors) || saved.numUsedSlots() != uint64(numSectors) {
+		t.Errorf("repair not saved: stored sectors %v, used slots %v", saved.storedSectors, saved.numUsedSlots())
+	}
+
+	// the repaired folder is consistent
+	if report, err = sm.VerifyFolderConsistency(path); err != nil {
+		t.Fatal(err)
+	}
+	if report.Repaired {
+		t.Errorf("repaired folder still inconsistent: %+v", report)
+	}
+}
@@ -7,29 +7,31 @@ package storagemanager
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/log"
 )
 
 // folderManager is the map from folder id to storage folder
 type folderManager struct {
 	sfs map[string]*storageFolder
+
+	// lastSelected is the path of the folder last selected to add a sector
+	lastSelected string
 }
 
-// loadFolderManager creates a new storage folders from database and open the data files
+// loadFolderManager creates a new storage folders from database and open the data files.
+// The folders failed to open are marked as unavailable, and the other folders are still served
 func loadFolderManager(db *database) (fm *folderManager, err error) {
 	// load the folders from database
 	folders, err := db.loadAllStorageFolders()
 	if err != nil {
 		return
 	}
-	for _, sf := range folders {
-		// load the folder data file
-		if err = sf.load(); err != nil {
-			err = fmt.Errorf("load folder %v: %v", sf.path, err)
-			return
-		}
+	if loadErr := loadFolders(db, folders); loadErr != nil {
+		log.Warn("storage folders unavailable", "err", loadErr)
 	}
 	fm = &folderManager{
 		sfs: folders,
@@ -37,9 +39,59 @@ func loadFolderManager(db *database) (fm *folderManager, err error) {
 	return
 }
 
+// loadFolders open the data files of the folders in parallel with at most
+// maxParallelFolderLoads workers. The errors of all folders are composed and returned
+func loadFolders(db *database, folders map[string]*storageFolder) (fullErr error) {
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	sem := make(chan struct{}, maxParallelFolderLoads)
+	for _, sf := range folders {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(sf *storageFolder) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := loadFolder(db, sf); err != nil {
+				errLock.Lock()
+				fullErr = common.ErrCompose(fullErr, err)
+				errLock.Unlock()
+			}
+		}(sf)
+	}
+	wg.Wait()
+	return
+}
+
+// loadFolder open the data file of a single folder. If the data file is truncated, the
+// lost sectors are saved to database
+func loadFolder(db *database, sf *storageFolder) (err error) {
+	// load the folder data file
+	numLost, err := sf.load()
+	if err != nil {
+		sf.status = folderUnavailable
+		return fmt.Errorf("load folder %v: %v", sf.path, err)
+	}
+	if numLost == 0 {
+		return
+	}
+	// the data file is truncated. Save the lost sectors so that they are still
+	// reported after the data file size is recovered
+	log.Warn("storage folder data file truncated", "path", sf.path, "lost sectors", numLost)
+	if err = db.saveStorageFolder(sf); err != nil {
+		return fmt.Errorf("save folder %v: %v", sf.path, err)
+	}
+	return
+}
+
 // close close all files in the storage folders
 func (fm *folderManager) close() (err error) {
 	for _, sf := range fm.sfs {
+		// the data file of the unavailable folder might not be opened
+		if sf.dataFile == nil {
+			continue
+		}
 		err = common.ErrCompose(err, sf.dataFile.Close())
 	}
 	return
@@ -94,14 +146,11 @@ func (fm *folderManager) addFolder(sf *storageFolder) (err error) {
 	return nil
 }
 
-// selectFolderToAdd select a folder to add sector. return a storageFolder, the
-// index to insert, and error that happened during execution
-func (fm *folderManager) selectFolderToAdd() (sf *storageFolder, index uint64, err error) {
-	// Loop over the folder manager to check availability
-	for _, sf = range fm.sfs {
-		if sf.status == folderUnavailable {
-			continue
-		}
+// selectFolderToAdd select a folder to add sector with the folder selection strategy.
+// return a storageFolder, the index to insert, and error that happened during execution
+func (fm *folderManager) selectFolderToAdd(strategy string) (sf *storageFolder, index uint64, err error) {
+	// Loop over the candidate folders to check availability
+	for _, sf = range fm.folderCandidates(strategy) {
 		index, err = sf.freeSectorIndex()
 		if err == errFolderAlreadyFull {
 			continue
@@ -109,6 +158,7 @@ func (fm *folderManager) selectFolderToAdd() (sf *storageFolder, index uint64, e
 			return nil, 0, err
 		}
 		// return the storage folder, the index, and nil error
+		fm.lastSelected = sf.path
 		return
 	}
 
@@ -117,9 +167,9 @@ func (fm *folderManager) selectFolderToAdd() (sf *storageFolder, index uint64, e
 }
 
 // selectFolderToAddWithRetry execute selectFolderToAdd retryTimes, If no error, return
-func (fm *folderManager) selectFolderToAddWithRetry(retryTimes int) (sf *storageFolder, index uint64, err error) {
+func (fm *folderManager) selectFolderToAddWithRetry(strategy string, retryTimes int) (sf *storageFolder, index uint64, err error) {
 	for i := 0; i != retryTimes; i++ {
-		sf, index, err = fm.selectFolderToAdd()
+		sf, index, err = fm.selectFolderToAdd(strategy)
 		if err == nil {
 			return
 		}
@@ -0,0 +1,81 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// FolderSelectionMostFree adds the sector to the folder with the most free sector slots,
+	// which balances the sectors evenly across the folders
+	FolderSelectionMostFree = "mostfree"
+
+	// FolderSelectionFirstFit adds the sector to the first folder with a free sector slot in
+	// the order of the folder path, which fills the folders one by one
+	FolderSelectionFirstFit = "firstfit"
+
+	// FolderSelectionRoundRobin adds the sectors to the folders in turn in the order of the
+	// folder path
+	FolderSelectionRoundRobin = "roundrobin"
+)
+
+// CheckFolderSelection checks whether the folder selection strategy is supported
+func CheckFolderSelection(strategy string) error {
+	switch strategy {
+	case FolderSelectionMostFree, FolderSelectionFirstFit, FolderSelectionRoundRobin:
+		return nil
+	default:
+		return fmt.Errorf("unknown folder selection strategy %v, expect %v, %v or %v", strategy,
+			FolderSelectionMostFree, FolderSelectionFirstFit, FolderSelectionRoundRobin)
+	}
+}
+
+// SetFolderSelection set the strategy of selecting the folder to add a new sector. Empty
+// strategy means the default strategy
+func (sm *storageManager) SetFolderSelection(strategy string) error {
+	if strategy == "" {
+		strategy = defaultFolderSelection
+	}
+	if err := CheckFolderSelection(strategy); err != nil {
+		return err
+	}
+	sm.folderSelection.Store(strategy)
+	return nil
+}
+
+// folderSelectionStrategy returns the folder selection strategy of the storage manager
+func (sm *storageManager) folderSelectionStrategy() string {
+	if strategy, ok := sm.folderSelection.Load().(string); ok {
+		return strategy
+	}
+	return defaultFolderSelection
+}
+
+// folderCandidates returns the available folders with free sector slots in the order
+// they shall be tried by the strategy
+func (fm *folderManager) folderCandidates(strategy string) (candidates []*storageFolder) {
+	for _, sf := range fm.sfs {
+		if sf.status == folderUnavailable || sf.storedSectors >= sf.numSectors {
+			continue
+		}
+		candidates = append(candidates, sf)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].path < candidates[j].path })
+
+	switch strategy {
+	case FolderSelectionFirstFit:
+	case FolderSelectionRoundRobin:
+		// start from the folder next to the one last selected
+		next := sort.Search(len(candidates), func(i int) bool { return candidates[i].path > fm.lastSelected })
+		candidates = append(candidates[next:], candidates[:next]...)
+	default:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].numSectors-candidates[i].storedSectors > candidates[j].numSectors-candidates[j].storedSectors
+		})
+	}
+	return
+}
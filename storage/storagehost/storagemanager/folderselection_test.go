@@ -0,0 +1,85 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"testing"
+)
+
+// TestSelectFolderToAdd test the sector lands in the expected folder with each folder
+// selection strategy given folders with differing free space
+func TestSelectFolderToAdd(t *testing.T) {
+	tests := []struct {
+		strategy string
+		expects  []string
+	}{
+		{FolderSelectionMostFree, []string{"/b", "/b", "/b"}},
+		{FolderSelectionFirstFit, []string{"/a", "/a", "/a"}},
+		{FolderSelectionRoundRobin, []string{"/a", "/b", "/c", "/a"}},
+	}
+	for _, test := range tests {
+		fm := newSelectionTestFolderManager(t)
+		for i, expect := range test.expects {
+			sf, index, err := fm.selectFolderToAdd(test.strategy)
+			if err != nil {
+				t.Fatalf("%v: selection %d: %v", test.strategy, i, err)
+			}
+			if sf.path != expect {
+				t.Errorf("%v: selection %d: expect folder %v, got %v", test.strategy, i, expect, sf.path)
+			}
+			if err = sf.setUsedSectorSlot(index); err != nil {
+				t.Fatalf("%v: selection %d: %v", test.strategy, i, err)
+			}
+		}
+	}
+}
+
+// TestSelectFolderToAddAllFull test no folder is selected if all available folders are full
+func TestSelectFolderToAddAllFull(t *testing.T) {
+	fm := &folderManager{sfs: make(map[string]*storageFolder)}
+	fm.sfs["/a"] = newSelectionTestFolder(t, "/a", 64, 64, folderAvailable)
+	fm.sfs["/b"] = newSelectionTestFolder(t, "/b", 64, 0, folderUnavailable)
+	for _, strategy := range []string{FolderSelectionMostFree, FolderSelectionFirstFit, FolderSelectionRoundRobin} {
+		if _, _, err := fm.selectFolderToAdd(strategy); err != errAllFoldersFullOrUsed {
+			t.Errorf("%v: expect error %v, got %v", strategy, errAllFoldersFullOrUsed, err)
+		}
+	}
+	if err := CheckFolderSelection("random"); err == nil {
+		t.Errorf("unknown strategy shall not be accepted")
+	}
+}
+
+// newSelectionTestFolderManager returns a folder manager with folders of differing free space,
+// along with a full folder and an unavailable folder which shall never be selected
+func newSelectionTestFolderManager(t *testing.T) (fm *folderManager) {
+	fm = &folderManager{sfs: make(map[string]*storageFolder)}
+	folders := []*storageFolder{
+		newSelectionTestFolder(t, "/a", 64, 60, folderAvailable),
+		newSelectionTestFolder(t, "/b", 128, 0, folderAvailable),
+		newSelectionTestFolder(t, "/c", 64, 10, folderAvailable),
+		newSelectionTestFolder(t, "/0", 256, 0, folderUnavailable),
+		newSelectionTestFolder(t, "/1", 64, 64, folderAvailable),
+	}
+	for _, sf := range folders {
+		fm.sfs[sf.path] = sf
+	}
+	return
+}
+
+// newSelectionTestFolder returns a storage folder with the first stored sector slots used
+func newSelectionTestFolder(t *testing.T, path string, numSectors, stored uint64, status uint32) (sf *storageFolder) {
+	sf = &storageFolder{
+		path:       path,
+		status:     status,
+		numSectors: numSectors,
+		usage:      emptyUsage(numSectorsToSize(numSectors)),
+	}
+	for i := uint64(0); i != stored; i++ {
+		if err := sf.setUsedSectorSlot(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return
+}
@@ -8,17 +8,43 @@ import (
 	"fmt"
 
 	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
 	"github.com/DxChainNetwork/godx/storage"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
-//ReadSector read the sector data
+//ReadSector read the sector data. A random fraction of the reads specified by the read
+// verification rate are verified against the sector root. If the data is corrupted, the
+// sector is no longer served and the storage folder is scrubbed
 func (sm *storageManager) ReadSector(root common.Hash) (data []byte, err error) {
+	data, folderPath, index, err := sm.readSector(root)
+	if err != nil {
+		return nil, err
+	}
+	if sm.shouldVerifyRead() && merkle.Sha256MerkleTreeRoot(data) != root {
+		sm.scrubCorruptedSector(root, folderPath, index)
+		return nil, ErrSectorCorrupted
+	}
+	return data, nil
+}
+
+// readSector read the sector data, and returns the folder path and the index the sector
+// is located at
+func (sm *storageManager) readSector(root common.Hash) (data []byte, folderPath string, index uint64, err error) {
+	return sm.readSectorRange(root, 0, storage.SectorSize)
+}
+
+// readSectorRange read the sector data of length starting from the offset within the sector,
+// and returns the folder path and the index the sector is located at
+func (sm *storageManager) readSectorRange(root common.Hash, off, length uint64) (data []byte, folderPath string, index uint64, err error) {
+	if off+length > storage.SectorSize {
+		return nil, "", 0, fmt.Errorf("read range [%v, %v) beyond the sector size %v", off, off+length, storage.SectorSize)
+	}
 	sm.lock.RLock()
 	defer sm.lock.RUnlock()
 
 	// calculate the sector id
-	id := sm.calculateSectorID(root)
+	id := sm.lookupSectorID(root)
 	// get the sector from database
 	var s *sector
 	s, err = sm.db.getSector(id)
@@ -30,27 +56,34 @@ func (sm *storageManager) ReadSector(root common.Hash) (data []byte, err error)
 	}
 	folderID, index := s.folderID, s.index
 	// get the folder path
-	folderPath, err := sm.db.getFolderPath(folderID)
+	folderPath, err = sm.db.getFolderPath(folderID)
 	if err != nil {
-		return nil, fmt.Errorf("db data might be corrupted: %v", err)
+		return nil, "", 0, fmt.Errorf("db data might be corrupted: %v", err)
 	}
 	// Get the folder from memory
 	folder, err := sm.folders.get(folderPath)
 	if err != nil {
-		return nil, fmt.Errorf("check folder in memory: %v", err)
+		return nil, "", 0, fmt.Errorf("check folder in memory: %v", err)
 	}
 	if folder.status == folderUnavailable {
-		return nil, fmt.Errorf("folder status unavailable")
+		return nil, "", 0, fmt.Errorf("folder status unavailable")
+	}
+	if folder.isSectorLost(index) {
+		return nil, "", 0, ErrSectorLost
 	}
 
 	// Read the data from folder
-	data = make([]byte, storage.SectorSize)
-	n, err := folder.dataFile.ReadAt(data, int64(index*storage.SectorSize))
-	if uint64(n) != storage.SectorSize {
-		return nil, fmt.Errorf("cannot read the sector: read %v bytes, expect %v bytes", n, storage.SectorSize)
+	offset, err := sectorOffset(index)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	data = make([]byte, length)
+	n, err := folder.dataFile.ReadAt(data, offset+int64(off))
+	if uint64(n) != length {
+		return nil, "", 0, fmt.Errorf("cannot read the sector: read %v bytes, expect %v bytes", n, length)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot read the sector: %v", err)
+		return nil, "", 0, fmt.Errorf("cannot read the sector: %v", err)
 	}
 	return
 }
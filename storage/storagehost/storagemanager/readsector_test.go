@@ -0,0 +1,54 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestReadSector test reading the sector written, reading the sector not exist, and reading
+// the sector from an unavailable folder
+func TestReadSector(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	defer sm.shutdown(t, time.Second)
+	path := randomFolderPath(t, "")
+	if err := sm.AddStorageFolder(path, uint64(1<<25)); err != nil {
+		t.Fatal(err)
+	}
+	data := randomBytes(storage.SectorSize)
+	root := merkle.Sha256MerkleTreeRoot(data)
+	if err := sm.AddSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+	read, err := sm.ReadSector(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Errorf("sector data read not equal to the data written")
+	}
+
+	// read a sector not exist
+	notExist := merkle.Sha256MerkleTreeRoot(randomBytes(storage.SectorSize))
+	if _, err = sm.ReadSector(notExist); err != ErrNotFound {
+		t.Errorf("reading the sector not exist expect %v, got %v", ErrNotFound, err)
+	}
+
+	// read a sector from the unavailable folder
+	sf, err := sm.folders.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf.status = folderUnavailable
+	if _, err = sm.ReadSector(root); err == nil {
+		t.Errorf("sector read from the unavailable folder")
+	}
+	sf.status = folderAvailable
+}
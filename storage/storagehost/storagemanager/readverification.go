@@ -0,0 +1,76 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/DxChainNetwork/godx/common"
+)
+
+// SetReadVerificationRate set the fraction of the reads verified against the sector root.
+// 0 means no read is verified, and 1 means all reads are verified
+func (sm *storageManager) SetReadVerificationRate(rate float64) {
+	atomic.StoreUint64(&sm.readVerificationRate, math.Float64bits(rate))
+}
+
+// shouldVerifyRead randomly decides whether the read shall be verified by the read
+// verification rate
+func (sm *storageManager) shouldVerifyRead() bool {
+	rate := math.Float64frombits(atomic.LoadUint64(&sm.readVerificationRate))
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	// use the 53 bits of the random number as the mantissa of a float in [0, 1)
+	return float64(randomUint64()>>11)/(1<<53) < rate
+}
+
+// scrubCorruptedSector mark the corrupted sector as lost so that it is no longer served, and
+// scrub the storage folder by verifying the folder consistency
+func (sm *storageManager) scrubCorruptedSector(root common.Hash, folderPath string, index uint64) {
+	sm.log.Warn("sector data corrupted", "root", root, "folder", folderPath, "index", index)
+	if err := sm.markSectorCorrupted(root, folderPath, index); err != nil {
+		sm.log.Warn("cannot mark the corrupted sector as lost", "root", root, "err", err)
+	}
+	if _, err := sm.VerifyFolderConsistency(folderPath); err != nil {
+		sm.log.Warn("cannot scrub the storage folder", "folder", folderPath, "err", err)
+	}
+}
+
+// markSectorCorrupted mark the corrupted sector located at the folder index as lost, and save
+// the folder to database
+func (sm *storageManager) markSectorCorrupted(root common.Hash, folderPath string, index uint64) (err error) {
+	if err = sm.tm.Add(); err != nil {
+		return errStopped
+	}
+	defer sm.tm.Done()
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sf, err := sm.folders.get(folderPath)
+	if err != nil {
+		return
+	}
+	// the sector might have been relocated or deleted since it was read
+	s, err := sm.db.getSector(sm.lookupSectorID(root))
+	if err != nil {
+		return
+	}
+	if s.folderID != sf.id || s.index != index || sf.isSectorLost(index) {
+		return nil
+	}
+	sf.markSectorLost(index)
+	if err = sm.db.saveStorageFolder(sf); err != nil {
+		delete(sf.lostSectors, index)
+		return fmt.Errorf("cannot save the storage folder: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestReadVerification test the corrupted sector is detected within a few reads with a high
+// read verification rate, after which the sector is marked as lost and no longer served
+func TestReadVerification(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	defer sm.shutdown(t, time.Second)
+	path := randomFolderPath(t, "")
+	if err := sm.AddStorageFolder(path, uint64(1<<25)); err != nil {
+		t.Fatal(err)
+	}
+	var roots []common.Hash
+	var datas [][]byte
+	for i := 0; i != 2; i++ {
+		data := randomBytes(storage.SectorSize)
+		root := merkle.Sha256MerkleTreeRoot(data)
+		if err := sm.AddSector(root, data); err != nil {
+			t.Fatal(err)
+		}
+		roots, datas = append(roots, root), append(datas, data)
+	}
+
+	// corrupt the data of the first sector on disk
+	corrupted := roots[0]
+	s, err := sm.db.getSector(sm.calculateSectorID(corrupted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := sm.folders.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sf.dataFile.WriteAt(randomBytes(64), int64(s.index*storage.SectorSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reads are not verified with zero rate
+	sm.SetReadVerificationRate(0)
+	if _, err = sm.ReadSector(corrupted); err != nil {
+		t.Fatalf("read not expected to be verified: %v", err)
+	}
+
+	// the corruption is detected within a few reads
+	sm.SetReadVerificationRate(0.9)
+	var numReads int
+	for numReads = 1; numReads <= 20; numReads++ {
+		if _, err = sm.ReadSector(corrupted); err != nil {
+			break
+		}
+	}
+	if err != ErrSectorCorrupted {
+		t.Fatalf("corruption not detected after %v reads: %v", numReads-1, err)
+	}
+	if _, err = sm.ReadSector(corrupted); err != ErrSectorLost {
+		t.Errorf("corrupted sector expected to be lost, got %v", err)
+	}
+	saved, err := sm.db.loadStorageFolder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.isSectorLost(s.index) {
+		t.Errorf("corrupted sector not saved as lost")
+	}
+
+	// the intact sector is still served
+	sm.SetReadVerificationRate(1)
+	data, err := sm.ReadSector(roots[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, datas[1]) {
+		t.Errorf("intact sector data not expected")
+	}
+}
@@ -0,0 +1,464 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/common/writeaheadlog"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/rlp"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+type (
+	// rotateSectorSaltUpdate is the update to move a batch of sectors to the ids derived with
+	// the new sector salt
+	rotateSectorSaltUpdate struct {
+		// newSalt is the new sector salt the sectors are moved to
+		newSalt sectorSalt
+
+		// sectors is the sectors to be moved to the new ids
+		sectors []*rotateSector
+
+		// stopped is whether the update is stopped, and is to be resumed on the next start
+		stopped bool
+
+		txn   *writeaheadlog.Transaction
+		batch *leveldb.Batch
+	}
+
+	// rotateSector is a sector with both the id derived with the old salt and the new salt
+	rotateSector struct {
+		*sector
+		newID sectorID
+	}
+
+	// rotateSaltInitPersist is the persist recorded in record intent
+	rotateSaltInitPersist struct {
+		NewSalt sectorSalt
+	}
+
+	// rotateSectorPersist is the persist for appended operations for moving a sector to the
+	// new id
+	rotateSectorPersist struct {
+		ID       sectorID
+		NewID    sectorID
+		FolderID folderID
+		Index    uint64
+		Count    uint64
+	}
+
+	// rotateCandidate is a sector read to derive its id with the new salt. err is the error
+	// reading the sector data, which is reported only if the sector is not changed since read
+	rotateCandidate struct {
+		id       sectorID
+		folderID folderID
+		index    uint64
+		newID    sectorID
+		err      error
+	}
+)
+
+// RotateSectorSalt changes the sector salt to newSalt, and re-derives the ids of all sectors
+// with the new salt. The sectors are moved to the new ids in batches, and the sector data is read
+// outside the storage manager lock, so that the sectors are served during the rotation with the
+// id derived with either salt. The sector roots are recovered from the sector data, thus the
+// rotation fails if any sector data is lost or does not match its id. The rotation failed or
+// interrupted is left in progress, which is resumed by rotating to the same salt again, or
+// when the storage manager restarts
+func (sm *storageManager) RotateSectorSalt(newSalt [32]byte) (err error) {
+	if err = sm.tm.Add(); err != nil {
+		return errStopped
+	}
+	defer sm.tm.Done()
+
+	return sm.rotateSectorSalt(newSalt, rotateSaltBatchSize)
+}
+
+// rotateSectorSalt rotates the sector salt to newSalt, moving at most batchSize sectors with
+// one update
+func (sm *storageManager) rotateSectorSalt(newSalt sectorSalt, batchSize int) (err error) {
+	sm.rotateLock.Lock()
+	defer sm.rotateLock.Unlock()
+
+	oldSalt, done, err := sm.beginSaltRotation(newSalt)
+	if done || err != nil {
+		return err
+	}
+	ids := sm.allSectorIDs()
+	// the sectors relocated since read are read again in the next round
+	for len(ids) != 0 {
+		var relocated []sectorID
+		for start := 0; start < len(ids); start += batchSize {
+			if sm.stopped() {
+				return errStopped
+			}
+			end := start + batchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			candidates := sm.readRotateCandidates(oldSalt, newSalt, ids[start:end])
+			moved, stopped, err := sm.rotateSectorBatch(newSalt, candidates)
+			if err != nil || stopped {
+				return err
+			}
+			relocated = append(relocated, moved...)
+		}
+		ids = relocated
+	}
+	return sm.finishSaltRotation(newSalt)
+}
+
+// beginSaltRotation records the rotation to newSalt in progress, and returns the old salt. The
+// rotation in progress is resumed only with the same salt. done is true if the sector salt is
+// already newSalt
+func (sm *storageManager) beginSaltRotation(newSalt sectorSalt) (oldSalt sectorSalt, done bool, err error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	oldSalt = sm.sectorSalt
+	if sm.rotatingSalt != nil {
+		if *sm.rotatingSalt != newSalt {
+			return oldSalt, false, errors.New("the rotation to another sector salt is in progress")
+		}
+		return oldSalt, false, nil
+	}
+	if newSalt == sm.sectorSalt {
+		return oldSalt, true, nil
+	}
+	if err = sm.db.writeBatch(sm.db.saveRotatingSectorSaltToBatch(sm.db.newBatch(), newSalt)); err != nil {
+		return oldSalt, false, fmt.Errorf("cannot save the rotating sector salt: %v", err)
+	}
+	sm.rotatingSalt = &newSalt
+	return oldSalt, false, nil
+}
+
+// finishSaltRotation saves newSalt as the sector salt after all sectors are moved to the new ids
+func (sm *storageManager) finishSaltRotation(newSalt sectorSalt) (err error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	batch := sm.db.saveSectorSaltToBatch(sm.db.newBatch(), newSalt)
+	batch = sm.db.deleteRotatingSectorSaltToBatch(batch)
+	if err = sm.db.writeBatch(batch); err != nil {
+		return fmt.Errorf("cannot save the sector salt: %v", err)
+	}
+	sm.sectorSalt = newSalt
+	sm.rotatingSalt = nil
+	return
+}
+
+// allSectorIDs returns the ids of the sectors indexed to all folders
+func (sm *storageManager) allSectorIDs() (ids []sectorID) {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+
+	for _, sf := range sm.folders.sfs {
+		ids = append(ids, sm.db.getAllSectorsIDsFromFolder(sf.id)...)
+	}
+	return
+}
+
+// readRotateCandidates reads the sectors with the ids and derives their ids with the new salt.
+// The sector data is read without the storage manager lock held. The sectors deleted, and
+// the sectors already moved to the new ids are not returned
+func (sm *storageManager) readRotateCandidates(oldSalt, newSalt sectorSalt, ids []sectorID) (candidates []*rotateCandidate) {
+	type location struct {
+		candidate *rotateCandidate
+		sf        *storageFolder
+	}
+	var locations []location
+	sm.lock.RLock()
+	folders := make(map[folderID]*storageFolder)
+	for _, sf := range sm.folders.sfs {
+		folders[sf.id] = sf
+	}
+	for _, id := range ids {
+		s, err := sm.db.getSector(id)
+		if err != nil {
+			continue
+		}
+		c := &rotateCandidate{id: id, folderID: s.folderID, index: s.index}
+		sf, exist := folders[s.folderID]
+		switch {
+		case !exist || sf.status == folderUnavailable || sf.dataFile == nil:
+			c.err = fmt.Errorf("folder of sector %x unavailable", id)
+		case sf.isSectorLost(s.index):
+			c.err = fmt.Errorf("sector %x: %v", id, ErrSectorLost)
+		}
+		locations = append(locations, location{c, sf})
+	}
+	sm.lock.RUnlock()
+
+	data := make([]byte, storage.SectorSize)
+	for _, loc := range locations {
+		c := loc.candidate
+		if c.err != nil {
+			candidates = append(candidates, c)
+			continue
+		}
+		offset, err := sectorOffset(c.index)
+		if err != nil {
+			c.err = fmt.Errorf("sector %x: %v", c.id, err)
+			candidates = append(candidates, c)
+			continue
+		}
+		if _, err = loc.sf.dataFile.ReadAt(data, offset); err != nil {
+			c.err = fmt.Errorf("cannot read sector %x: %v", c.id, err)
+			candidates = append(candidates, c)
+			continue
+		}
+		root := merkle.Sha256MerkleTreeRoot(data)
+		switch c.id {
+		case calculateSectorIDWithSalt(newSalt, root):
+			// moved to the new id before the rotation is interrupted
+			continue
+		case calculateSectorIDWithSalt(oldSalt, root):
+			c.newID = calculateSectorIDWithSalt(newSalt, root)
+		default:
+			c.err = fmt.Errorf("sector %x data does not match its id", c.id)
+		}
+		candidates = append(candidates, c)
+	}
+	return
+}
+
+// rotateSectorBatch moves the sectors read to the new ids with one update. The sectors deleted
+// since read are skipped, and the ids of the sectors relocated since read are returned to be
+// read again. stopped is true if the update is stopped
+func (sm *storageManager) rotateSectorBatch(newSalt sectorSalt, candidates []*rotateCandidate) (relocated []sectorID, stopped bool, err error) {
+	if len(candidates) == 0 {
+		return
+	}
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	update := &rotateSectorSaltUpdate{newSalt: newSalt}
+	for _, c := range candidates {
+		s, err := sm.db.getSector(c.id)
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot get sector %x: %v", c.id, err)
+		}
+		if s.folderID != c.folderID || s.index != c.index {
+			relocated = append(relocated, c.id)
+			continue
+		}
+		if c.err != nil {
+			return nil, false, c.err
+		}
+		update.sectors = append(update.sectors, &rotateSector{
+			sector: s,
+			newID:  c.newID,
+		})
+	}
+	if len(update.sectors) == 0 {
+		return
+	}
+	// record the intent, prepare, process and release the update
+	if err = update.recordIntent(sm); err != nil {
+		return
+	}
+	if upErr := sm.prepareProcessReleaseUpdate(update, targetNormal); !upErr.isNil() {
+		sm.logError(update, upErr)
+		return nil, false, upErr
+	}
+	return relocated, update.stopped, nil
+}
+
+// str defines the string representation of the update
+func (update *rotateSectorSaltUpdate) str() (s string) {
+	return fmt.Sprintf("Rotate sector salt of %v sectors", len(update.sectors))
+}
+
+// recordIntent record the intent of the rotateSectorSaltUpdate
+func (update *rotateSectorSaltUpdate) recordIntent(manager *storageManager) (err error) {
+	persist := rotateSaltInitPersist{
+		NewSalt: update.newSalt,
+	}
+	b, err := rlp.EncodeToBytes(persist)
+	if err != nil {
+		return
+	}
+	op := writeaheadlog.Operation{
+		Name: opNameRotateSectorSalt,
+		Data: b,
+	}
+	update.txn, err = manager.wal.NewTransaction([]writeaheadlog.Operation{op})
+	if err != nil {
+		update.txn = nil
+		return fmt.Errorf("cannot create transaction: %v", err)
+	}
+	return
+}
+
+// prepare prepares for the rotateSectorSaltUpdate at specified target
+func (update *rotateSectorSaltUpdate) prepare(manager *storageManager, target uint8) (err error) {
+	update.batch = manager.db.newBatch()
+	switch target {
+	case targetNormal:
+		err = update.prepareNormal(manager)
+	case targetRecoverCommitted:
+		err = update.prepareCommitted(manager)
+	default:
+		err = errors.New("invalid target")
+	}
+	if manager.disruptor.disrupt("rotate salt prepare stop") {
+		return errStopped
+	}
+	return
+}
+
+// process process for the rotateSectorSaltUpdate at specified target
+func (update *rotateSectorSaltUpdate) process(manager *storageManager, target uint8) (err error) {
+	switch target {
+	case targetNormal:
+		err = update.processNormal(manager)
+	case targetRecoverCommitted:
+		err = update.processCommitted(manager)
+	default:
+		err = errors.New("invalid target")
+	}
+	return
+}
+
+// prepareNormal writes the sectors with new ids to the batch, and append the operations to
+// the wal
+func (update *rotateSectorSaltUpdate) prepareNormal(manager *storageManager) (err error) {
+	if <-update.txn.InitComplete; update.txn.InitErr != nil {
+		return fmt.Errorf("wal init error: %v", update.txn.InitErr)
+	}
+	ops := make([]writeaheadlog.Operation, 0, len(update.sectors))
+	for _, s := range update.sectors {
+		persist := rotateSectorPersist{
+			ID:       s.id,
+			NewID:    s.newID,
+			FolderID: s.folderID,
+			Index:    s.index,
+			Count:    s.count,
+		}
+		b, err := rlp.EncodeToBytes(persist)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, writeaheadlog.Operation{
+			Name: opNameRotateSector,
+			Data: b,
+		})
+	}
+	if len(ops) != 0 {
+		if err = <-update.txn.Append(ops); err != nil {
+			return err
+		}
+	}
+	return update.prepareBatch(manager)
+}
+
+// prepareBatch writes the sector and folder to sector entries, and the sector trees with the
+// new ids to the batch
+func (update *rotateSectorSaltUpdate) prepareBatch(manager *storageManager) (err error) {
+	for _, s := range update.sectors {
+		update.batch = manager.db.deleteSectorToBatch(update.batch, s.id)
+		update.batch = manager.db.deleteFolderSectorToBatch(update.batch, s.folderID, s.id)
+		moved := &sector{
+			id:       s.newID,
+			folderID: s.folderID,
+			index:    s.index,
+			count:    s.count,
+		}
+		if update.batch, err = manager.db.saveSectorToBatch(update.batch, moved, true); err != nil {
+			return err
+		}
+		// the sector tree is rebuilt on the next proof if it is not stored
+		if tree, err := manager.db.getSectorTree(s.id); err == nil {
+			update.batch = manager.db.saveSectorTreeToBatch(update.batch, s.newID, tree)
+		}
+	}
+	return
+}
+
+// processNormal commit the transaction and write the batch. Since the batch is written
+// atomically, the sectors in the batch are either all with the old ids or all with the new ids
+func (update *rotateSectorSaltUpdate) processNormal(manager *storageManager) (err error) {
+	if err = <-update.txn.Commit(); err != nil {
+		return err
+	}
+	if manager.disruptor.disrupt("rotate salt process stop") {
+		return errStopped
+	}
+	return manager.db.writeBatch(update.batch)
+}
+
+// release release the rotateSectorSaltUpdate. Since nothing is written to the database before
+// the batch is written, the transaction is released directly on errors. If the storage manager
+// is stopped, the committed transaction is kept to be resumed on the next start
+func (update *rotateSectorSaltUpdate) release(manager *storageManager, upErr *updateError) (err error) {
+	if upErr != nil && upErr.hasErrStopped() {
+		upErr.processErr = nil
+		upErr.prepareErr = nil
+		update.stopped = true
+		return
+	}
+	if upErr != nil && upErr.prepareErr != nil {
+		if <-update.txn.InitComplete; update.txn.InitErr != nil {
+			return update.txn.InitErr
+		}
+		err = <-update.txn.Commit()
+	}
+	newErr := update.txn.Release()
+	return common.ErrCompose(err, newErr)
+}
+
+// decodeRotateSectorSaltUpdate decode the transaction to a rotateSectorSaltUpdate
+func decodeRotateSectorSaltUpdate(txn *writeaheadlog.Transaction) (update *rotateSectorSaltUpdate, err error) {
+	if len(txn.Operations) == 0 {
+		return nil, fmt.Errorf("transaction have operation length 0")
+	}
+	var initPersist rotateSaltInitPersist
+	if err = rlp.DecodeBytes(txn.Operations[0].Data, &initPersist); err != nil {
+		return nil, fmt.Errorf("cannot decode init persist: %v", err)
+	}
+	update = &rotateSectorSaltUpdate{
+		newSalt: initPersist.NewSalt,
+		txn:     txn,
+	}
+	return
+}
+
+// prepareCommitted decodes the sectors from the appended operations and prepares the batch
+// to resume the rotation
+func (update *rotateSectorSaltUpdate) prepareCommitted(manager *storageManager) (err error) {
+	for _, op := range update.txn.Operations[1:] {
+		if op.Name != opNameRotateSector {
+			return fmt.Errorf("unknown opName for %v: %v", opNameRotateSectorSalt, op.Name)
+		}
+		var persist rotateSectorPersist
+		if err = rlp.DecodeBytes(op.Data, &persist); err != nil {
+			return fmt.Errorf("cannot decode appended persist: %v", err)
+		}
+		update.sectors = append(update.sectors, &rotateSector{
+			sector: &sector{
+				id:       persist.ID,
+				folderID: persist.FolderID,
+				index:    persist.Index,
+				count:    persist.Count,
+			},
+			newID: persist.NewID,
+		})
+	}
+	return update.prepareBatch(manager)
+}
+
+// processCommitted resumes moving the sectors. The batch written before the storage manager
+// stopped is written again, which has no effect since no other update is processed in between
+func (update *rotateSectorSaltUpdate) processCommitted(manager *storageManager) (err error) {
+	return manager.db.writeBatch(update.batch)
+}
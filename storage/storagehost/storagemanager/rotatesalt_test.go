@@ -0,0 +1,259 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// TestRotateSectorSalt test rotating the sector salt, all sectors remain readable under the
+// new ids and the sectors with old ids are removed
+func TestRotateSectorSalt(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	roots, data, counts := addRotateTestSectors(t, sm)
+	oldIDs := make([]sectorID, 0, len(roots))
+	for _, root := range roots {
+		oldIDs = append(oldIDs, sm.calculateSectorID(root))
+	}
+
+	var newSalt [32]byte
+	copy(newSalt[:], randomBytes(32))
+	if err := sm.RotateSectorSalt(newSalt); err != nil {
+		t.Fatal(err)
+	}
+	if sm.sectorSalt != sectorSalt(newSalt) {
+		t.Fatalf("sector salt not rotated")
+	}
+	for _, id := range oldIDs {
+		if err := checkSectorNotExist(id, sm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checkRotatedSectors(sm, roots, data, counts); err != nil {
+		t.Fatal(err)
+	}
+	sm.shutdown(t, 10*time.Second)
+	if err := checkWalTxnNum(filepath.Join(sm.persistDir, walFileName), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new salt is persisted
+	newsm, err := New(sm.persistDir)
+	if err != nil {
+		t.Fatalf("cannot create a new sm: %v", err)
+	}
+	newSM := newsm.(*storageManager)
+	if err := newSM.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if newSM.sectorSalt != sectorSalt(newSalt) {
+		t.Fatalf("rotated sector salt not persisted")
+	}
+	if err := checkRotatedSectors(newSM, roots, data, counts); err != nil {
+		t.Fatal(err)
+	}
+	newSM.shutdown(t, time.Second)
+}
+
+// TestRotateSectorSaltStop test an interrupted rotation is resumed on restart
+func TestRotateSectorSaltStop(t *testing.T) {
+	tests := []struct {
+		keyWord string
+		numTxn  int
+	}{
+		{"rotate salt prepare stop", 0},
+		{"rotate salt process stop", 1},
+	}
+	for _, test := range tests {
+		d := newDisruptor().register(test.keyWord, func() bool { return true })
+		sm := newTestStorageManager(t, test.keyWord, d)
+		roots, data, counts := addRotateTestSectors(t, sm)
+		prevSalt := sm.sectorSalt
+
+		var newSalt [32]byte
+		copy(newSalt[:], randomBytes(32))
+		if err := sm.RotateSectorSalt(newSalt); err != nil {
+			t.Fatal(err)
+		}
+		sm.shutdown(t, time.Second)
+		if err := checkWalTxnNum(filepath.Join(sm.persistDir, walFileName), test.numTxn); err != nil {
+			t.Fatal(err)
+		}
+		newsm, err := New(sm.persistDir)
+		if err != nil {
+			t.Fatalf("cannot create a new sm: %v", err)
+		}
+		newSM := newsm.(*storageManager)
+		if err := newSM.Start(); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for the updates to complete
+		<-time.After(300 * time.Millisecond)
+		newSM.lock.RLock()
+		salt, rotating := newSM.sectorSalt, newSM.rotatingSalt
+		newSM.lock.RUnlock()
+		if salt != sectorSalt(newSalt) || salt == prevSalt || rotating != nil {
+			t.Fatalf("%v: the rotation is not resumed after restart", test.keyWord)
+		}
+		if err := checkRotatedSectors(newSM, roots, data, counts); err != nil {
+			t.Fatalf("%v: %v", test.keyWord, err)
+		}
+		newSM.shutdown(t, time.Second)
+		if err := checkWalTxnNum(filepath.Join(sm.persistDir, walFileName), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestRotateSectorSaltInBatches test the sectors are served and added during the rotation in
+// batches, and the rotation interrupted is resumed only with the same salt
+func TestRotateSectorSaltInBatches(t *testing.T) {
+	var numBatches int
+	d := newDisruptor().register("rotate salt prepare stop", func() bool {
+		numBatches++
+		return numBatches == 2
+	})
+	sm := newTestStorageManager(t, "", d)
+	roots, data, counts := addRotateTestSectors(t, sm)
+	prevSalt := sm.sectorSalt
+
+	var newSalt [32]byte
+	copy(newSalt[:], randomBytes(32))
+	if err := sm.rotateSectorSalt(newSalt, 1); err != nil {
+		t.Fatal(err)
+	}
+	// One of the sectors is moved to the new id, and the rotation is in progress
+	if sm.sectorSalt != prevSalt || sm.rotatingSalt == nil || *sm.rotatingSalt != sectorSalt(newSalt) {
+		t.Fatalf("the rotation is not in progress")
+	}
+	var numMoved int
+	for _, root := range roots {
+		if exist, err := sm.db.hasSector(calculateSectorIDWithSalt(newSalt, root)); err != nil {
+			t.Fatal(err)
+		} else if exist {
+			numMoved++
+		}
+	}
+	if numMoved != 1 {
+		t.Fatalf("expect 1 sector moved, got %v", numMoved)
+	}
+	for i, root := range roots {
+		b, err := sm.ReadSector(root)
+		if err != nil {
+			t.Fatalf("cannot read sector during the rotation: %v", err)
+		}
+		if !bytes.Equal(b, data[i]) {
+			t.Fatalf("sector %x data not expected", root)
+		}
+	}
+	// The sector added during the rotation is stored with the new id
+	b := randomBytes(storage.SectorSize)
+	root := merkle.Sha256MerkleTreeRoot(b)
+	if err := sm.AddSector(root, b); err != nil {
+		t.Fatal(err)
+	}
+	if exist, err := sm.db.hasSector(calculateSectorIDWithSalt(newSalt, root)); err != nil || !exist {
+		t.Fatalf("the sector added is not stored with the new id: %v", err)
+	}
+	roots, data, counts = append(roots, root), append(data, b), append(counts, 1)
+
+	var otherSalt [32]byte
+	copy(otherSalt[:], randomBytes(32))
+	if err := sm.RotateSectorSalt(otherSalt); err == nil {
+		t.Fatal("the rotation to another salt is not rejected")
+	}
+	if err := sm.rotateSectorSalt(newSalt, 1); err != nil {
+		t.Fatal(err)
+	}
+	if sm.sectorSalt != sectorSalt(newSalt) || sm.rotatingSalt != nil {
+		t.Fatalf("the rotation is not resumed")
+	}
+	if err := checkRotatedSectors(sm, roots, data, counts); err != nil {
+		t.Fatal(err)
+	}
+	sm.shutdown(t, time.Second)
+}
+
+// TestRotateSectorSaltSectorTree test the sector trees are moved to the new ids
+func TestRotateSectorSaltSectorTree(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	roots, _, _ := addRotateTestSectors(t, sm)
+	trees := make([]sectorTree, 0, len(roots))
+	for _, root := range roots {
+		tree, err := sm.loadSectorTree(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trees = append(trees, tree)
+	}
+	oldIDs := make([]sectorID, 0, len(roots))
+	for _, root := range roots {
+		oldIDs = append(oldIDs, sm.calculateSectorID(root))
+	}
+
+	var newSalt [32]byte
+	copy(newSalt[:], randomBytes(32))
+	if err := sm.RotateSectorSalt(newSalt); err != nil {
+		t.Fatal(err)
+	}
+	for i, root := range roots {
+		tree, err := sm.db.getSectorTree(sm.calculateSectorID(root))
+		if err != nil {
+			t.Fatalf("sector tree not moved: %v", err)
+		}
+		if tree.root() != trees[i].root() {
+			t.Fatalf("sector tree not expected")
+		}
+		if _, err = sm.db.getSectorTree(oldIDs[i]); err != leveldb.ErrNotFound {
+			t.Fatalf("sector tree with the old id not deleted: %v", err)
+		}
+	}
+	sm.shutdown(t, time.Second)
+}
+
+// addRotateTestSectors add a virtual sector twice and a physical sector to a new folder
+func addRotateTestSectors(t *testing.T, sm *storageManager) (roots []common.Hash, data [][]byte, counts []uint64) {
+	path := randomFolderPath(t, "")
+	if err := sm.AddStorageFolder(path, uint64(1<<25)); err != nil {
+		t.Fatal(err)
+	}
+	for _, count := range []uint64{2, 1} {
+		b := randomBytes(storage.SectorSize)
+		root := merkle.Sha256MerkleTreeRoot(b)
+		for i := uint64(0); i != count; i++ {
+			if err := sm.AddSector(root, b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		roots, data, counts = append(roots, root), append(data, b), append(counts, count)
+	}
+	return
+}
+
+// checkRotatedSectors checks the sectors are readable with the current sector salt
+func checkRotatedSectors(sm *storageManager, roots []common.Hash, data [][]byte, counts []uint64) error {
+	for i, root := range roots {
+		if err := checkSectorExist(root, sm, data[i], counts[i]); err != nil {
+			return err
+		}
+		b, err := sm.ReadSector(root)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(b, data[i]) {
+			return fmt.Errorf("sector %x data not expected", root)
+		}
+	}
+	return checkFoldersHasExpectedSectors(sm, len(roots))
+}
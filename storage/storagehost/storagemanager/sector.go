@@ -40,8 +40,31 @@ type (
 
 // calculateSectorID hash the sector salt and the merkle root to get the sector id
 func (sm *storageManager) calculateSectorID(root common.Hash) (id sectorID) {
+	return calculateSectorIDWithSalt(sm.sectorSalt, root)
+}
+
+// lookupSectorID return the id of the sector with the merkle root. During a sector salt rotation,
+// the sector stored is found with the id derived with either salt, and the sector not stored is
+// given the id derived with the new salt. The storage manager lock must be held
+func (sm *storageManager) lookupSectorID(root common.Hash) (id sectorID) {
+	if sm.rotatingSalt == nil {
+		return sm.calculateSectorID(root)
+	}
+	newID := calculateSectorIDWithSalt(*sm.rotatingSalt, root)
+	if exist, err := sm.db.hasSector(newID); err == nil && exist {
+		return newID
+	}
+	oldID := sm.calculateSectorID(root)
+	if exist, err := sm.db.hasSector(oldID); err == nil && exist {
+		return oldID
+	}
+	return newID
+}
+
+// calculateSectorIDWithSalt hash the given salt and the merkle root to get the sector id
+func calculateSectorIDWithSalt(salt sectorSalt, root common.Hash) (id sectorID) {
 	hasher := sha3.NewLegacyKeccak256()
-	hasher.Write(sm.sectorSalt[:])
+	hasher.Write(salt[:])
 	hasher.Write(root[:])
 	hasher.Sum(id[:0])
 	return id
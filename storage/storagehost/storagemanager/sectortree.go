@@ -0,0 +1,145 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"fmt"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// sectorTree is the precomputed merkle roots of the chunks of sectorTreeChunkSize of a sector,
+// which are the nodes of the sector merkle tree at sectorTreeHeight above the leaves. With the
+// sector tree, the proof of a segment only reads and hashes the chunk containing the segment
+// instead of the whole sector
+type sectorTree []common.Hash
+
+// buildSectorTree hash each chunk of the sector data to build the sector tree
+func buildSectorTree(data []byte) (tree sectorTree) {
+	tree = make(sectorTree, 0, storage.SectorSize/sectorTreeChunkSize)
+	for off := uint64(0); off < storage.SectorSize; off += sectorTreeChunkSize {
+		tree = append(tree, merkle.Sha256MerkleTreeRoot(data[off:off+sectorTreeChunkSize]))
+	}
+	return
+}
+
+// root returns the sector merkle root computed from the sector tree
+func (tree sectorTree) root() common.Hash {
+	return merkle.Sha256CachedTreeRoot(tree, sectorTreeHeight)
+}
+
+// encode encodes the sector tree as the concatenation of the hashes
+func (tree sectorTree) encode() []byte {
+	b := make([]byte, 0, len(tree)*common.HashLength)
+	for _, h := range tree {
+		b = append(b, h[:]...)
+	}
+	return b
+}
+
+// decodeSectorTree decodes the sector tree encoded by encode
+func decodeSectorTree(b []byte) (tree sectorTree, err error) {
+	if uint64(len(b)) != storage.SectorSize/sectorTreeChunkSize*common.HashLength {
+		return nil, errInvalidSectorTree
+	}
+	tree = make(sectorTree, 0, len(b)/common.HashLength)
+	for off := 0; off < len(b); off += common.HashLength {
+		tree = append(tree, common.BytesToHash(b[off:off+common.HashLength]))
+	}
+	return
+}
+
+// SectorSegmentProof returns the segment at segmentIndex of the sector, and the merkle proof
+// of the segment against the sector root. Only the chunk containing the segment is read and
+// hashed, which is verified against the stored sector tree. If the chunk does not match the
+// sector tree, the sector is no longer served and the storage folder is scrubbed
+func (sm *storageManager) SectorSegmentProof(root common.Hash, segmentIndex uint64) (segment []byte, hashSet []common.Hash, err error) {
+	if segmentIndex >= storage.SectorSize/merkle.LeafSize {
+		return nil, nil, fmt.Errorf("segment index %v out of range", segmentIndex)
+	}
+	tree, err := sm.loadSectorTree(root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// read the chunk containing the segment, and verify it against the sector tree
+	chunkIndex := segmentIndex >> sectorTreeHeight
+	chunk, folderPath, index, err := sm.readSectorRange(root, chunkIndex*sectorTreeChunkSize, sectorTreeChunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	if merkle.Sha256MerkleTreeRoot(chunk) != tree[chunkIndex] {
+		sm.scrubCorruptedSector(root, folderPath, index)
+		return nil, nil, ErrSectorCorrupted
+	}
+
+	// prove the segment within the chunk, then prove the chunk with the sector tree
+	segment, chunkHashSet, _, err := merkle.Sha256MerkleTreeProof(chunk, segmentIndex%(1<<sectorTreeHeight))
+	if err != nil {
+		return nil, nil, err
+	}
+	ct := merkle.NewSha256CachedTree(sectorTreeHeight)
+	if err = ct.SetStorageProofIndex(segmentIndex); err != nil {
+		return nil, nil, err
+	}
+	for _, h := range tree {
+		ct.Push(h)
+	}
+	return segment, ct.Prove(segment, chunkHashSet), nil
+}
+
+// loadSectorTree loads the sector tree of the sector, and validates it against the sector root.
+// The sector tree missing or corrupted is rebuilt from the sector data and stored again
+func (sm *storageManager) loadSectorTree(root common.Hash) (tree sectorTree, err error) {
+	sm.lock.RLock()
+	tree, err = sm.db.getSectorTree(sm.lookupSectorID(root))
+	sm.lock.RUnlock()
+
+	if err == nil && tree.root() == root {
+		return tree, nil
+	}
+	if err != nil && err != leveldb.ErrNotFound && err != errInvalidSectorTree {
+		return nil, err
+	}
+	if err == nil || err == errInvalidSectorTree {
+		sm.log.Warn("stored sector tree corrupted, rebuild from the sector data", "root", root)
+	}
+
+	// rebuild the sector tree from the sector data, which also verifies the data
+	data, folderPath, index, err := sm.readSector(root)
+	if err != nil {
+		return nil, err
+	}
+	tree = buildSectorTree(data)
+	if tree.root() != root {
+		sm.scrubCorruptedSector(root, folderPath, index)
+		return nil, ErrSectorCorrupted
+	}
+	if err = sm.saveSectorTree(root, tree); err != nil {
+		sm.log.Warn("cannot save the sector tree", "root", root, "err", err)
+	}
+	return tree, nil
+}
+
+// saveSectorTree saves the sector tree of the sector to database, if the sector is still stored
+func (sm *storageManager) saveSectorTree(root common.Hash, tree sectorTree) (err error) {
+	if err = sm.tm.Add(); err != nil {
+		return errStopped
+	}
+	defer sm.tm.Done()
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	id := sm.lookupSectorID(root)
+	// the sector might have been deleted since it was read
+	if exist, err := sm.db.hasSector(id); err != nil || !exist {
+		return err
+	}
+	return sm.db.writeBatch(sm.db.saveSectorTreeToBatch(sm.db.newBatch(), id, tree))
+}
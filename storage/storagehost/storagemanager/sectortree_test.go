@@ -0,0 +1,104 @@
+// Copyright 2019 DxChain, All rights reserved.
+// Use of this source code is governed by an Apache
+// License 2.0 that can be found in the LICENSE file.
+
+package storagemanager
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
+
+// TestSectorSegmentProof test the segment proof built with the sector tree stored at add time
+// only reads the chunk containing the segment, the corrupted sector tree is rebuilt, and the
+// corrupted chunk is detected
+func TestSectorSegmentProof(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	defer sm.shutdown(t, time.Second)
+	path := randomFolderPath(t, "")
+	if err := sm.AddStorageFolder(path, uint64(1<<25)); err != nil {
+		t.Fatal(err)
+	}
+	data := randomBytes(storage.SectorSize)
+	root := merkle.Sha256MerkleTreeRoot(data)
+	if err := sm.AddSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+	id := sm.calculateSectorID(root)
+	s, err := sm.db.getSector(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := sm.folders.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sector tree is stored at add time
+	tree, err := sm.db.getSectorTree(id)
+	if err != nil {
+		t.Fatalf("sector tree not stored: %v", err)
+	}
+	if tree.root() != root {
+		t.Fatalf("sector tree does not match the sector root")
+	}
+
+	numSegments := storage.SectorSize / merkle.LeafSize
+	segments := []uint64{0, 1, 1<<sectorTreeHeight + 3, numSegments - 1}
+	checkProofs := func() {
+		for _, segmentIndex := range segments {
+			segment, hashSet, err := sm.SectorSegmentProof(root, segmentIndex)
+			if err != nil {
+				t.Fatalf("segment %v: %v", segmentIndex, err)
+			}
+			expectSegment, expectHashSet, _, err := merkle.Sha256MerkleTreeProof(data, segmentIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(segment, expectSegment) || !reflect.DeepEqual(hashSet, expectHashSet) {
+				t.Fatalf("segment %v: proof not the same as hashing the whole sector", segmentIndex)
+			}
+			if !merkle.Sha256VerifyDataPiece(segment, hashSet, numSegments, segmentIndex, root) {
+				t.Fatalf("segment %v: proof not verified", segmentIndex)
+			}
+		}
+	}
+	checkProofs()
+
+	// the corrupted sector tree is detected, and rebuilt from the sector data
+	corruptedTree := append(sectorTree{}, tree...)
+	corruptedTree[1] = common.Hash{1}
+	if err = sm.db.writeBatch(sm.db.saveSectorTreeToBatch(sm.db.newBatch(), id, corruptedTree)); err != nil {
+		t.Fatal(err)
+	}
+	checkProofs()
+	if rebuilt, err := sm.db.getSectorTree(id); err != nil || !reflect.DeepEqual(rebuilt, tree) {
+		t.Fatalf("sector tree not rebuilt: %v", err)
+	}
+
+	// the proof only reads and hashes the chunk containing the segment, so the corruption out
+	// of the chunk is not touched
+	sectorOff := int64(s.index * storage.SectorSize)
+	if _, err = sf.dataFile.WriteAt(randomBytes(64), sectorOff+int64(sectorTreeChunkSize)*10); err != nil {
+		t.Fatal(err)
+	}
+	segments = []uint64{0, 1}
+	checkProofs()
+
+	// the corruption within the chunk is detected, and the sector is no longer served
+	if _, err = sf.dataFile.WriteAt(randomBytes(64), sectorOff+int64(sectorTreeChunkSize)-64); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = sm.SectorSegmentProof(root, 0); err != ErrSectorCorrupted {
+		t.Fatalf("expect error %v, got %v", ErrSectorCorrupted, err)
+	}
+	if _, err = sm.ReadSector(root); err != ErrSectorLost {
+		t.Errorf("corrupted sector expected to be lost, got %v", err)
+	}
+}
@@ -222,7 +222,7 @@ func (update *shrinkFolderUpdate) prepareNormal(manager *storageManager) (err er
 		}
 	}
 	// Finally, shrink the folder, and add to batch
-	update.targetFolder.usage = shrinkUsage(update.targetFolder.usage, update.prevNumSectors)
+	update.targetFolder.usage = shrinkUsage(update.targetFolder.usage, update.targetNumSectors)
 	update.batch, err = manager.db.saveStorageFolderToBatch(update.batch, update.targetFolder)
 	if err != nil {
 		return err
@@ -245,7 +245,7 @@ func (update *shrinkFolderUpdate) relocateSector(manager *storageManager, s *sec
 		// the s can be filled in
 		relocatedFolder = update.targetFolder
 	} else if err == errFolderAlreadyFull {
-		relocatedFolder, index, err = manager.folders.selectFolderToAdd()
+		relocatedFolder, index, err = manager.folders.selectFolderToAdd(manager.folderSelectionStrategy())
 		if err != nil {
 			return sectorRelocation{}, err
 		}
@@ -255,7 +255,8 @@ func (update *shrinkFolderUpdate) relocateSector(manager *storageManager, s *sec
 	if _, exist := update.folders[relocatedFolder.id]; !exist {
 		update.folders[relocatedFolder.id] = relocatedFolder
 	}
-	// Update the memory
+	// Update the memory. The lost sector is still lost after relocation
+	lost := update.targetFolder.isSectorLost(s.index)
 	if err = update.targetFolder.setFreeSectorSlot(s.index); err != nil {
 		return sectorRelocation{}, err
 	}
@@ -263,6 +264,9 @@ func (update *shrinkFolderUpdate) relocateSector(manager *storageManager, s *sec
 		_ = update.targetFolder.setFreeSectorSlot(s.index)
 		return sectorRelocation{}, err
 	}
+	if lost {
+		relocatedFolder.markSectorLost(index)
+	}
 	relocate = sectorRelocation{
 		ID: s.id,
 		PrevLocation: sectorLocation{
@@ -308,9 +312,16 @@ func (update *shrinkFolderUpdate) processNormal(manager *storageManager) (err er
 	// write the data from prevLocation to afterLocation
 	b := make([]byte, storage.SectorSize)
 	for _, relocate := range update.relocates {
+		// the lost sector has no data to move
+		if update.folders[relocate.NewLocation.FolderID].isSectorLost(relocate.NewLocation.Index) {
+			continue
+		}
 		// read data
-		prevIndex := relocate.PrevLocation.Index
-		n, err := update.targetFolder.dataFile.ReadAt(b, int64(prevIndex*storage.SectorSize))
+		prevOffset, err := sectorOffset(relocate.PrevLocation.Index)
+		if err != nil {
+			return err
+		}
+		n, err := update.targetFolder.dataFile.ReadAt(b, prevOffset)
 		if err != nil || uint64(n) != storage.SectorSize {
 			return fmt.Errorf("not read full sector")
 		}
@@ -319,8 +330,11 @@ func (update *shrinkFolderUpdate) processNormal(manager *storageManager) (err er
 		if !exist {
 			return fmt.Errorf("folder not in folders")
 		}
-		newIndex := relocate.NewLocation.Index
-		n, err = targetFolder.dataFile.WriteAt(b, int64(newIndex*storage.SectorSize))
+		newOffset, err := sectorOffset(relocate.NewLocation.Index)
+		if err != nil {
+			return err
+		}
+		n, err = targetFolder.dataFile.WriteAt(b, newOffset)
 		if err != nil || n != int(storage.SectorSize) {
 			return fmt.Errorf("not full write")
 		}
@@ -384,8 +398,8 @@ func (update *shrinkFolderUpdate) release(manager *storageManager, upErr *update
 		// the folder has been truncated. Only truncate the file to previous size, and
 		// revert the folder db info. The sectors can reside in new locations
 		update.targetFolder.numSectors = update.prevNumSectors
-		update.targetFolder.usage = expandUsage(update.targetFolder.usage, update.targetNumSectors)
-		newErr = update.targetFolder.dataFile.Truncate(int64(numSectorsToSize(update.targetNumSectors)))
+		update.targetFolder.usage = expandUsage(update.targetFolder.usage, update.prevNumSectors)
+		newErr = update.targetFolder.dataFile.Truncate(int64(numSectorsToSize(update.prevNumSectors)))
 		err = common.ErrCompose(err, newErr)
 		newErr = manager.db.saveStorageFolder(update.targetFolder)
 		err = common.ErrCompose(err, newErr)
@@ -417,8 +431,12 @@ func (update *shrinkFolderUpdate) revert(manager *storageManager, memoryOnly boo
 	for _, relocate := range update.relocates {
 		prevLocation := relocate.PrevLocation
 		newLocation := relocate.NewLocation
+		lost := update.folders[newLocation.FolderID].isSectorLost(newLocation.Index)
 		_ = update.folders[prevLocation.FolderID].setUsedSectorSlot(prevLocation.Index)
 		_ = update.folders[newLocation.FolderID].setFreeSectorSlot(newLocation.Index)
+		if lost {
+			update.folders[prevLocation.FolderID].markSectorLost(prevLocation.Index)
+		}
 		if !memoryOnly {
 			s := &sector{
 				id:       relocate.ID,
@@ -251,3 +251,74 @@ func TestShrinkStorageFolderStopped(t *testing.T) {
 		}
 	}
 }
+
+// TestShrinkFolderTail test shrinking a folder with sectors stored near the tail of the folder.
+// The sectors beyond the new size are relocated, and all sector data is still readable after
+// the shrink and after the storage manager restarts
+func TestShrinkFolderTail(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	// The folder spans multiple usage bit vectors, so that the usage shall also be shrunk
+	numSectorPerFolder := uint64(2 * bitVectorGranularity)
+	path := randomFolderPath(t, "")
+	if err := sm.AddStorageFolder(path, numSectorPerFolder*storage.SectorSize); err != nil {
+		t.Fatal(err)
+	}
+	// Insert sectors. The sectors are located at random slots, thus most of them are near the
+	// tail of the folder
+	numSectors := 16
+	type expect struct {
+		root common.Hash
+		data []byte
+	}
+	expects := make([]expect, 0, numSectors)
+	for i := 0; i != numSectors; i++ {
+		data := randomBytes(storage.SectorSize)
+		root := merkle.Sha256MerkleTreeRoot(data)
+		if err := sm.AddSector(root, data); err != nil {
+			t.Fatal(err)
+		}
+		expects = append(expects, expect{root: root, data: data})
+	}
+	// Create another folder to hold the sectors not fit in the shrunk folder
+	newPath := randomFolderPath(t, "")
+	if err := sm.AddStorageFolder(newPath, uint64(numSectors)*storage.SectorSize); err != nil {
+		t.Fatal(err)
+	}
+	newSize := 8 * storage.SectorSize
+	if err := sm.shrinkFolder(path, newSize); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range expects {
+		if err := checkSectorExist(expect.root, sm, expect.data, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checkFoldersHasExpectedSectors(sm, numSectors); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFolderSize(sm, path, newSize); err != nil {
+		t.Fatal(err)
+	}
+	sm.shutdown(t, time.Second)
+	if err := checkWalTxnNum(filepath.Join(sm.persistDir, walFileName), 0); err != nil {
+		t.Fatal(err)
+	}
+	// Restart the storage manager, and the sectors shall still be readable
+	newsm, err := New(sm.persistDir)
+	if err != nil {
+		t.Fatalf("cannot create a new sm: %v", err)
+	}
+	newSM := newsm.(*storageManager)
+	if err = newSM.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range expects {
+		if err := checkSectorExist(expect.root, newSM, expect.data, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checkFolderSize(newSM, path, newSize); err != nil {
+		t.Fatal(err)
+	}
+	newSM.shutdown(t, time.Second)
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/DxChainNetwork/godx/common/math"
 	"github.com/DxChainNetwork/godx/rlp"
@@ -43,6 +44,10 @@ type (
 
 		// dataFile is the file where all the data sectors locates
 		dataFile *os.File
+
+		// lostSectors is the set of the indexes of the stored sectors whose data is
+		// lost because the data file is truncated
+		lostSectors map[uint64]struct{}
 	}
 
 	// storageFolderPersist defines the persist data to be stored in database
@@ -53,6 +58,7 @@ type (
 		Usage         []bitVector
 		NumSectors    uint64
 		StoredSectors uint64
+		LostSectors   []uint64 `rlp:"tail"`
 	}
 
 	folderID uint32
@@ -67,6 +73,10 @@ func (sf *storageFolder) EncodeRLP(w io.Writer) (err error) {
 		NumSectors:    sf.numSectors,
 		StoredSectors: sf.storedSectors,
 	}
+	for index := range sf.lostSectors {
+		sfp.LostSectors = append(sfp.LostSectors, index)
+	}
+	sort.Slice(sfp.LostSectors, func(i, j int) bool { return sfp.LostSectors[i] < sfp.LostSectors[j] })
 	return rlp.Encode(w, sfp)
 }
 
@@ -78,12 +88,17 @@ func (sf *storageFolder) DecodeRLP(st *rlp.Stream) (err error) {
 		return
 	}
 	sf.id, sf.path, sf.usage, sf.numSectors, sf.storedSectors = folderID(sfp.ID), sfp.Path, sfp.Usage, sfp.NumSectors, sfp.StoredSectors
+	for _, index := range sfp.LostSectors {
+		sf.markSectorLost(index)
+	}
 	sf.status = folderAvailable
 	return
 }
 
-// load load the storage folder data file.
-func (sf *storageFolder) load() (err error) {
+// load load the storage folder data file. If the data file is shorter than expected, the
+// stored sectors beyond the end of the data file are marked as lost, and the folder continues
+// to serve the intact sectors. The number of sectors newly marked as lost is returned.
+func (sf *storageFolder) load() (numLost uint64, err error) {
 	datafilePath := filepath.Join(sf.path, dataFileName)
 	fileInfo, err := os.Stat(datafilePath)
 	if os.IsNotExist(err) {
@@ -91,10 +106,8 @@ func (sf *storageFolder) load() (err error) {
 		err = errors.New("data file not exist")
 		return
 	}
-	if fileInfo.Size() < int64(sf.numSectors)*int64(storage.SectorSize) {
-		sf.status = folderUnavailable
-		err = errors.New("file size too small")
-		return
+	if uint64(fileInfo.Size()) < numSectorsToSize(sf.numSectors) {
+		numLost = sf.markTruncatedSectorsLost(uint64(fileInfo.Size()) / storage.SectorSize)
 	}
 	if sf.dataFile, err = os.OpenFile(datafilePath, os.O_RDWR, 0600); err != nil {
 		sf.status = folderUnavailable
@@ -103,6 +116,35 @@ func (sf *storageFolder) load() (err error) {
 	return
 }
 
+// markTruncatedSectorsLost mark all stored sectors with index not smaller than
+// numIntactSectors as lost. Return the number of sectors newly marked as lost
+func (sf *storageFolder) markTruncatedSectorsLost(numIntactSectors uint64) (numLost uint64) {
+	for index := numIntactSectors; index < sf.numSectors; index++ {
+		if sf.usage[index/bitVectorGranularity].isFree(index % bitVectorGranularity) {
+			continue
+		}
+		if !sf.isSectorLost(index) {
+			sf.markSectorLost(index)
+			numLost++
+		}
+	}
+	return
+}
+
+// markSectorLost mark the sector at the index as lost
+func (sf *storageFolder) markSectorLost(index uint64) {
+	if sf.lostSectors == nil {
+		sf.lostSectors = make(map[uint64]struct{})
+	}
+	sf.lostSectors[index] = struct{}{}
+}
+
+// isSectorLost returns whether the sector at the index is lost
+func (sf *storageFolder) isSectorLost(index uint64) (lost bool) {
+	_, lost = sf.lostSectors[index]
+	return
+}
+
 // freeSectorIndex randomly find a free slot to insert the sector.
 // If cannot find such a slot, return errFolderAlreadyFull
 func (sf *storageFolder) freeSectorIndex() (index uint64, err error) {
@@ -141,6 +183,9 @@ func (sf *storageFolder) freeSectorIndex() (index uint64, err error) {
 // setFreeSectorSlot set the slot specified by the index to free.
 // If the slot is already freed, report an error
 func (sf *storageFolder) setFreeSectorSlot(index uint64) (err error) {
+	if err = sf.checkSectorSlot(index); err != nil {
+		return
+	}
 	usageIndex := index / bitVectorGranularity
 	bitIndex := index % bitVectorGranularity
 	if sf.usage[usageIndex].isFree(bitIndex) {
@@ -149,12 +194,21 @@ func (sf *storageFolder) setFreeSectorSlot(index uint64) (err error) {
 	}
 	sf.usage[usageIndex].clearUsage(bitIndex)
 	sf.storedSectors--
+	// the slot is no longer storing the lost sector
+	delete(sf.lostSectors, index)
 	return
 }
 
 // setUsedSectorSlot set the slot specified by the index to used
-// If the slot is already used, report an error
+// If the slot is already used, or beyond the number of sectors of the folder, report an error
 func (sf *storageFolder) setUsedSectorSlot(index uint64) (err error) {
+	if err = sf.checkSectorSlot(index); err != nil {
+		return
+	}
+	if index >= sf.numSectors {
+		err = fmt.Errorf("%v: index %d, number of sectors %d", errSectorSlotOutOfRange, index, sf.numSectors)
+		return
+	}
 	usageIndex := index / bitVectorGranularity
 	bitIndex := index % bitVectorGranularity
 	if !sf.usage[usageIndex].isFree(bitIndex) {
@@ -166,6 +220,28 @@ func (sf *storageFolder) setUsedSectorSlot(index uint64) (err error) {
 	return
 }
 
+// checkSectorSlot checks whether the index is within the slot capacity of the folder, which is
+// the number of slots tracked by usage. The capacity is checked instead of numSectors, since
+// during shrinking the slots beyond the target numSectors are still to be freed.
+func (sf *storageFolder) checkSectorSlot(index uint64) (err error) {
+	capacity := uint64(len(sf.usage)) * bitVectorGranularity
+	if index >= capacity || index >= maxSectorsPerFolder {
+		err = fmt.Errorf("%v: index %d, capacity %d", errSectorSlotOutOfRange, index, capacity)
+	}
+	return
+}
+
+// sectorOffset returns the offset of the sector slot at the index in the data file. Since the
+// index is bounded by maxSectorsPerFolder, the offset computed in uint64 fits in int64.
+func sectorOffset(index uint64) (offset int64, err error) {
+	if index >= maxSectorsPerFolder {
+		err = fmt.Errorf("%v: index %d, maximum %d", errSectorSlotOutOfRange, index, maxSectorsPerFolder)
+		return
+	}
+	offset = int64(index * storage.SectorSize)
+	return
+}
+
 // sizeToNumSectors convert the size to number of sectors
 func sizeToNumSectors(size uint64) (numSectors uint64) {
 	numSectors = size / storage.SectorSize
@@ -4,7 +4,19 @@
 
 package storagemanager
 
-import "testing"
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DxChainNetwork/godx/common"
+	"github.com/DxChainNetwork/godx/crypto/merkle"
+	"github.com/DxChainNetwork/godx/storage"
+)
 
 // TestFreeSectorIndex test the function of freeSectorIndex
 func TestFreeSectorIndex(t *testing.T) {
@@ -46,3 +58,205 @@ func TestFreeSectorIndex(t *testing.T) {
 		}
 	}
 }
+
+// TestTruncatedDataFile test the sectors beyond the end of a truncated data file are detected
+// as lost when the storage manager starts, while the intact sectors are still served
+func TestTruncatedDataFile(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	path := randomFolderPath(t, "")
+	numSectors := minSectorsPerFolder
+	if err := sm.AddStorageFolder(path, numSectorsToSize(numSectors)); err != nil {
+		t.Fatal(err)
+	}
+	sectors := make(map[common.Hash][]byte)
+	for i := uint64(0); i != numSectors; i++ {
+		data := randomBytes(storage.SectorSize)
+		root := merkle.Sha256MerkleTreeRoot(data)
+		if err := sm.AddSector(root, data); err != nil {
+			t.Fatal(err)
+		}
+		sectors[root] = data
+	}
+	sm.shutdown(t, time.Second)
+
+	// truncate the data file in the middle of a sector
+	numIntactSectors := numSectors / 2
+	dataFilePath := filepath.Join(path, dataFileName)
+	if err := os.Truncate(dataFilePath, int64(numSectorsToSize(numIntactSectors)+storage.SectorSize/2)); err != nil {
+		t.Fatal(err)
+	}
+
+	newsm, err := New(sm.persistDir)
+	if err != nil {
+		t.Fatalf("cannot create a new sm: %v", err)
+	}
+	newSM := newsm.(*storageManager)
+	if err = newSM.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer newSM.shutdown(t, time.Second)
+
+	var numLost uint64
+	for root, data := range sectors {
+		s, err := newSM.db.getSector(newSM.calculateSectorID(root))
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := newSM.ReadSector(root)
+		if s.index >= numIntactSectors {
+			if err != ErrSectorLost {
+				t.Errorf("sector at index %v: expect error %v, got %v", s.index, ErrSectorLost, err)
+			}
+			numLost++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("sector at index %v: %v", s.index, err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("sector at index %v: data not expected", s.index)
+		}
+	}
+	if numLost != numSectors-numIntactSectors {
+		t.Fatalf("expect %v lost sectors, got %v", numSectors-numIntactSectors, numLost)
+	}
+	folders := newSM.Folders()
+	if len(folders) != 1 {
+		t.Fatalf("expect 1 folder, got %v", len(folders))
+	}
+	if folders[0].LostSectors != numLost {
+		t.Errorf("folder lost sectors not expected. Expect %v, got %v", numLost, folders[0].LostSectors)
+	}
+	if folders[0].UsedSectors != numSectors {
+		t.Errorf("folder used sectors not expected. Expect %v, got %v", numSectors, folders[0].UsedSectors)
+	}
+}
+
+// TestLoadFoldersUnavailable test the storage manager still starts and serves the other
+// folders when the data file of a folder fails to open
+func TestLoadFoldersUnavailable(t *testing.T) {
+	sm := newTestStorageManager(t, "", newDisruptor())
+	numFolders := 4
+	var paths []string
+	for i := 0; i != numFolders; i++ {
+		path := randomFolderPath(t, "")
+		if err := sm.AddStorageFolder(path, numSectorsToSize(minSectorsPerFolder)); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	sectors := make(map[common.Hash][]byte)
+	for i := 0; i != numFolders*int(minSectorsPerFolder)/2; i++ {
+		data := randomBytes(storage.SectorSize)
+		root := merkle.Sha256MerkleTreeRoot(data)
+		if err := sm.AddSector(root, data); err != nil {
+			t.Fatal(err)
+		}
+		sectors[root] = data
+	}
+	badFolder, err := sm.folders.get(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	badFolderID := badFolder.id
+	sm.shutdown(t, time.Second)
+
+	// remove the data file of the first folder
+	if err := os.Remove(filepath.Join(paths[0], dataFileName)); err != nil {
+		t.Fatal(err)
+	}
+
+	newsm, err := New(sm.persistDir)
+	if err != nil {
+		t.Fatalf("cannot create a new sm: %v", err)
+	}
+	newSM := newsm.(*storageManager)
+	if err = newSM.Start(); err != nil {
+		t.Fatalf("storage manager failed to start: %v", err)
+	}
+	defer newSM.shutdown(t, time.Second)
+
+	if folders := newSM.Folders(); len(folders) != numFolders {
+		t.Fatalf("expect %v folders, got %v", numFolders, len(folders))
+	}
+	sf, err := newSM.folders.get(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.status != folderUnavailable {
+		t.Errorf("folder with data file removed shall be unavailable")
+	}
+	for root, data := range sectors {
+		s, err := newSM.db.getSector(newSM.calculateSectorID(root))
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := newSM.ReadSector(root)
+		if s.folderID == badFolderID {
+			if err == nil {
+				t.Errorf("sector in the unavailable folder shall not be read")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("sector in folder %v: %v", s.folderID, err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("sector in folder %v: data not expected", s.folderID)
+		}
+	}
+	// the new sectors are added to the available folders
+	data := randomBytes(storage.SectorSize)
+	if err = newSM.AddSector(merkle.Sha256MerkleTreeRoot(data), data); err != nil {
+		t.Fatal(err)
+	}
+	if err = newSM.ResizeFolder(paths[0], numSectorsToSize(minSectorsPerFolder*2)); err != errFolderNotOpened {
+		t.Errorf("resize unavailable folder: expect error %v, got %v", errFolderNotOpened, err)
+	}
+}
+
+// TestSectorSlotCapacity test the sector slots near the capacity of the folder are used and
+// freed correctly, and the slots past the capacity are rejected without overflow
+func TestSectorSlotCapacity(t *testing.T) {
+	numSectors := uint64(64*16 + 32)
+	sf := &storageFolder{
+		numSectors: numSectors,
+		usage:      emptyUsage(numSectorsToSize(numSectors)),
+	}
+	// the last slot of the folder could be used and freed
+	if err := sf.setUsedSectorSlot(numSectors - 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.setFreeSectorSlot(numSectors - 1); err != nil {
+		t.Fatal(err)
+	}
+	// the slots past the folder are rejected
+	for _, index := range []uint64{numSectors, 64 * 17, maxSectorsPerFolder, math.MaxUint64} {
+		if err := sf.setUsedSectorSlot(index); err == nil || !strings.Contains(err.Error(), errSectorSlotOutOfRange.Error()) {
+			t.Errorf("set used slot %d: expect out of range error, got %v", index, err)
+		}
+		if index < 64*17 {
+			continue
+		}
+		if err := sf.setFreeSectorSlot(index); err == nil || !strings.Contains(err.Error(), errSectorSlotOutOfRange.Error()) {
+			t.Errorf("set free slot %d: expect out of range error, got %v", index, err)
+		}
+	}
+	if sf.storedSectors != 0 {
+		t.Errorf("stored sectors changed by rejected slots: %v", sf.storedSectors)
+	}
+
+	// the offset of the last slot of the largest folder does not overflow
+	offset, err := sectorOffset(maxSectorsPerFolder - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset <= 0 || uint64(offset) != (maxSectorsPerFolder-1)*storage.SectorSize {
+		t.Errorf("offset of the last slot not expected: %v", offset)
+	}
+	for _, index := range []uint64{maxSectorsPerFolder, math.MaxUint64 / storage.SectorSize, math.MaxUint64} {
+		if _, err = sectorOffset(index); err == nil {
+			t.Errorf("offset of slot %d shall be rejected", index)
+		}
+	}
+}
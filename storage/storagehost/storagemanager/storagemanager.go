@@ -5,12 +5,15 @@
 package storagemanager
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/DxChainNetwork/godx/common"
 	"github.com/DxChainNetwork/godx/common/threadmanager"
@@ -28,22 +31,38 @@ type (
 		// Functions for download and storage responsibilities
 		AddSectorBatch(sectorRoots []common.Hash) error
 		AddSector(sectorRoot common.Hash, sectorData []byte) error
+		AddSectorContext(ctx context.Context, sectorRoot common.Hash, sectorData []byte) error
+		SetAddSectorTimeout(timeout time.Duration)
+		SetReadVerificationRate(rate float64)
+		SetFolderSelection(strategy string) error
 		DeleteSector(sectorRoot common.Hash) error
 		DeleteSectorBatch(sectorRoots []common.Hash) error
 		ReadSector(sectorRoot common.Hash) ([]byte, error)
+		SectorSegmentProof(sectorRoot common.Hash, segmentIndex uint64) ([]byte, []common.Hash, error)
 		// Functions from user calls
 		AddStorageFolder(path string, size uint64) error
 		DeleteFolder(folderPath string) error
 		ResizeFolder(folderPath string, size uint64) error
+		VerifyFolderConsistency(folderPath string) (storage.HostFolderConsistency, error)
+		RotateSectorSalt(newSalt [32]byte) error
 		// Status check
 		Folders() []storage.HostFolder
 		AvailableSpace() storage.HostSpace
+		WalDepth() int64
 	}
 
 	storageManager struct {
 		// sectorSalt is the salt used to generate the sector id with merkle root
 		sectorSalt sectorSalt
 
+		// rotatingSalt is the new sector salt of the rotation in progress, nil if no rotation
+		// is in progress. During the rotation, a sector is stored with the id derived with
+		// either salt
+		rotatingSalt *sectorSalt
+
+		// rotateLock makes the sector salt rotations mutually exclusive
+		rotateLock sync.Mutex
+
 		// database is the db that wraps leveldb. Folders and Sectors metadata info are
 		// stored in database
 		db *database
@@ -62,6 +81,16 @@ type (
 
 		// disruptor is used only for test
 		disruptor *disruptor
+
+		// addSectorTimeout is the timeout of the AddSector requests, accessed atomically
+		addSectorTimeout int64
+
+		// readVerificationRate is the bits of the fraction of the reads verified against
+		// the sector root, accessed atomically
+		readVerificationRate uint64
+
+		// folderSelection is the strategy of selecting the folder to add a new sector
+		folderSelection atomic.Value
 	}
 
 	sectorSalt [32]byte
@@ -84,6 +113,7 @@ func newStorageManager(persistDir string, d *disruptor) (sm *storageManager, err
 	// Only initialize the WAL in start
 	sm.tm = &threadmanager.ThreadManager{}
 	sm.disruptor = d
+	sm.addSectorTimeout = int64(defaultAddSectorTimeout)
 	return
 }
 
@@ -94,6 +124,13 @@ func (sm *storageManager) Start() (err error) {
 	if err != nil {
 		return fmt.Errorf("cannot get or create the sector salt: %v", err)
 	}
+	rotatingSalt, rotating, err := sm.db.getRotatingSectorSalt()
+	if err != nil {
+		return fmt.Errorf("cannot get the rotating sector salt: %v", err)
+	}
+	if rotating {
+		sm.rotatingSalt = &rotatingSalt
+	}
 	// load folders metadata from the db
 	if sm.folders, err = loadFolderManager(sm.db); err != nil {
 		return fmt.Errorf("cannot load folder manager: %v", err)
@@ -107,6 +144,7 @@ func (sm *storageManager) Start() (err error) {
 	}
 	// Create goroutines to process unfinished transactions
 	// The txn should be processed in reverse order (all recovered transactions are to be reverted)
+	var recovered sync.WaitGroup
 	for i := len(txns) - 1; i >= 0; i-- {
 		txn := txns[i]
 		// decode the update
@@ -125,10 +163,12 @@ func (sm *storageManager) Start() (err error) {
 			return nil
 		}
 		// This function shall be called with a background thread.
+		recovered.Add(1)
 		go func(up update) {
 			sm.lock.Lock()
 			defer func() {
 				sm.lock.Unlock()
+				recovered.Done()
 				sm.tm.Done()
 			}()
 			// Since the error has been handled in prepareProcessReleaseUpdate, it's safe not to
@@ -136,6 +176,19 @@ func (sm *storageManager) Start() (err error) {
 			_ = sm.prepareProcessReleaseUpdate(up, targetRecoverCommitted)
 		}(up)
 	}
+	// Resume the sector salt rotation interrupted after the unfinished transactions are processed
+	if rotating {
+		if err = sm.tm.Add(); err != nil {
+			return nil
+		}
+		go func() {
+			defer sm.tm.Done()
+			recovered.Wait()
+			if err := sm.rotateSectorSalt(rotatingSalt, rotateSaltBatchSize); err != nil && err != errStopped {
+				sm.log.Warn("cannot resume the sector salt rotation", "err", err)
+			}
+		}()
+	}
 	return nil
 }
 
@@ -178,6 +231,9 @@ func (sm *storageManager) ResizeFolder(folderPath string, size uint64) (err erro
 	if err != nil {
 		return err
 	}
+	if sf.dataFile == nil {
+		return errFolderNotOpened
+	}
 	targetNumSectors := sizeToNumSectors(size)
 	if targetNumSectors == sf.numSectors {
 		// No need to resize
@@ -205,6 +261,9 @@ func (sm *storageManager) DeleteFolder(folderPath string) (err error) {
 	if err != nil {
 		return err
 	}
+	if sf.dataFile == nil {
+		return errFolderNotOpened
+	}
 	if sf.numSectors == 0 {
 		return nil
 	}
@@ -246,6 +305,7 @@ func (sm *storageManager) Folders() []storage.HostFolder {
 			Path:         sf.path,
 			TotalSectors: sf.numSectors,
 			UsedSectors:  sf.storedSectors,
+			LostSectors:  uint64(len(sf.lostSectors)),
 		})
 	}
 	return folders
@@ -269,6 +329,11 @@ func (sm *storageManager) AvailableSpace() storage.HostSpace {
 	}
 }
 
+// WalDepth return the number of unfinished transactions in the wal
+func (sm *storageManager) WalDepth() int64 {
+	return sm.wal.NumUnfinishedTxns()
+}
+
 // stopped return whether the current storage manager is stopped
 func (sm *storageManager) stopped() bool {
 	select {
@@ -45,6 +45,8 @@ func decodeFromTransaction(txn *writeaheadlog.Transaction) (up update, err error
 		up, err = decodeExpandFolderUpdate(txn)
 	case opNameShrinkFolder:
 		up, err = decodeShrinkFolderUpdate(txn)
+	case opNameRotateSectorSalt:
+		up, err = decodeRotateSectorSaltUpdate(txn)
 	default:
 		err = errInvalidTransactionType
 	}
@@ -5,8 +5,9 @@
 package storagehost
 
 import (
-	"bytes"
+	"fmt"
 	"math/big"
+	"math/bits"
 	"reflect"
 
 	"github.com/DxChainNetwork/godx/accounts"
@@ -72,6 +73,11 @@ func (so *StorageResponsibility) id() (scid common.Hash) {
 	return so.OriginStorageContract.RLPHash()
 }
 
+// segmentSize returns the segment size of the storage proof declared by the storage contract
+func (so *StorageResponsibility) segmentSize() uint64 {
+	return so.OriginStorageContract.ProofSegmentSize()
+}
+
 //Check this storage responsibility
 func (so *StorageResponsibility) isSane() error {
 	if reflect.DeepEqual(so.OriginStorageContract, emptyStorageContract) {
@@ -122,6 +128,26 @@ func (so *StorageResponsibility) proofDeadline() uint64 {
 
 }
 
+// proofSubmissionHeight returns the block height to submit the storage proof, which is margin
+// blocks after the window start. The height is capped to reserve the blocks for the retries
+// before the window end, so that the proof is never first submitted at the window edge
+func (so *StorageResponsibility) proofSubmissionHeight(margin uint64) uint64 {
+	windowStart, windowEnd := so.expiration(), so.proofDeadline()
+	if maxMargin := maxProofSubmissionMargin(windowEnd - windowStart); margin > maxMargin {
+		margin = maxMargin
+	}
+	return windowStart + margin
+}
+
+// maxProofSubmissionMargin returns the max proof submission margin of the window size, which
+// leaves room for proofSubmissionRetries retries before the window end
+func maxProofSubmissionMargin(windowSize uint64) uint64 {
+	if windowSize <= postponedExecution*proofSubmissionRetries {
+		return 0
+	}
+	return windowSize - postponedExecution*proofSubmissionRetries
+}
+
 //Amount that can be obtained after fulfilling the responsibility
 func (so StorageResponsibility) value() common.BigInt {
 	return so.ContractCost.Add(so.PotentialDownloadRevenue).Add(so.PotentialStorageRevenue).Add(so.PotentialUploadRevenue).Add(so.RiskedStorageDeposit)
@@ -134,7 +160,7 @@ func (h *StorageHost) storageResponsibilities() (sos []StorageResponsibility) {
 		return nil
 	}
 	for i := range h.lockedStorageResponsibility {
-		so, err := getStorageResponsibility(h.db, i)
+		so, err := h.loadStorageResponsibility(i)
 		if err != nil {
 			h.log.Warn("Failed to get storage responsibility", "err", err)
 			continue
@@ -179,7 +205,7 @@ func (h *StorageHost) insertStorageResponsibility(so StorageResponsibility) erro
 					return err
 				}
 			}
-			errPut := putStorageResponsibility(h.db, so.id(), so)
+			errPut := h.storeStorageResponsibility(so.id(), so)
 			if errPut != nil {
 				return errPut
 			}
@@ -216,8 +242,9 @@ func (h *StorageHost) insertStorageResponsibility(so StorageResponsibility) erro
 	errRevisionDoubleTime := h.queueTaskItem(so.expiration()-postponedExecutionBuffer+postponedExecution, so.id())
 
 	//insert the check proof task in the task queue.
-	errProof := h.queueTaskItem(so.expiration()+postponedExecution, so.id())
-	errProofDoubleTime := h.queueTaskItem(so.expiration()+postponedExecution*2, so.id())
+	proofHeight := so.proofSubmissionHeight(h.config.ProofSubmissionMargin)
+	errProof := h.queueTaskItem(proofHeight, so.id())
+	errProofDoubleTime := h.queueTaskItem(proofHeight+postponedExecution, so.id())
 	err = common.ErrCompose(errContractCreate, errContractCreateDoubleTime, errRevision, errRevisionDoubleTime, errProof, errProofDoubleTime)
 	if err != nil {
 		h.log.Warn("Error with task item, redacting responsibility", "id", so.id())
@@ -229,6 +256,31 @@ func (h *StorageHost) insertStorageResponsibility(so StorageResponsibility) erro
 
 //the virtual sector will need to appear in 'sectorsRemoved' multiple times. Same with 'sectorsGained'。
 func (h *StorageHost) modifyStorageResponsibility(so StorageResponsibility, sectorsRemoved []common.Hash, sectorsGained []common.Hash, gainedSectorData [][]byte) error {
+	batch, oldso, err := h.applyStorageResponsibilityModification(so, sectorsGained, gainedSectorData)
+	if err != nil {
+		return err
+	}
+
+	// The revision shall not be acknowledged to the client until it is durably persisted.
+	// Wait for the batch without holding the locks, so that the revisions of other contracts
+	// are batched in the same write
+	if err = batch.wait(); err != nil {
+		h.revertStorageResponsibilityModification(so, oldso, sectorsGained)
+		return err
+	}
+
+	//Delete the deleted sector
+	for k := range sectorsRemoved {
+		//The error of restoring a sector doesn't make any sense to us.
+		h.DeleteSector(sectorsRemoved[k])
+	}
+	return nil
+}
+
+// applyStorageResponsibilityModification adds the gained sectors, updates the financial metrics
+// and adds the storage responsibility to the revision batch. Return the batch to wait and the
+// storage responsibility before modification
+func (h *StorageHost) applyStorageResponsibilityModification(so StorageResponsibility, sectorsGained []common.Hash, gainedSectorData [][]byte) (*revisionBatch, StorageResponsibility, error) {
 	// Lock the storage responsibility
 	h.checkAndLockStorageResponsibility(so.id())
 	defer h.checkAndUnlockStorageResponsibility(so.id())
@@ -238,20 +290,20 @@ func (h *StorageHost) modifyStorageResponsibility(so StorageResponsibility, sect
 
 	//Need enough time to submit revision
 	if so.expiration()-postponedExecutionBuffer <= h.blockHeight {
-		return errNotAllowed
+		return nil, StorageResponsibility{}, errNotAllowed
 	}
 
 	//sectorsGained and gainedSectorData must have the same length
 	if len(sectorsGained) != len(gainedSectorData) {
 		h.log.Warn("sectorsGained and gainedSectorData must have the same length", "sectorsGained length", len(sectorsGained), "gainedSectorDataLength", len(gainedSectorData))
-		return errInsaneRevision
+		return nil, StorageResponsibility{}, errInsaneRevision
 	}
 
 	for _, data := range gainedSectorData {
 		//No 4MB sector has no meaning
 		if uint64(len(data)) != storage.SectorSize {
 			h.log.Warn("No 4MB sector has no meaning,sector size", "length", len(data))
-			return errInsaneRevision
+			return nil, StorageResponsibility{}, errInsaneRevision
 		}
 	}
 
@@ -272,35 +324,42 @@ func (h *StorageHost) modifyStorageResponsibility(so StorageResponsibility, sect
 			//The error of restoring a sector doesn't make any sense to us.
 			h.DeleteSector(sectorsGained[j])
 		}
-		return err
+		return nil, StorageResponsibility{}, err
 	}
 
-	var oldso StorageResponsibility
-	var errOld error
-	errDBso := func() error {
-		//Get old storage responsibility, return error if not found
-		oldso, errOld = getStorageResponsibility(h.db, so.id())
-		if errOld != nil {
-			return errOld
-		}
-
-		return putStorageResponsibility(h.db, so.id(), so)
-	}()
-
-	if errDBso != nil {
+	//Get old storage responsibility, return error if not found
+	oldso, errOld := h.loadStorageResponsibility(so.id())
+	if errOld != nil {
 		//This operation is wrong, you need to restore the sector
 		for i := range sectorsGained {
 			//The error of restoring a sector doesn't make any sense to us.
 			h.DeleteSector(sectorsGained[i])
 		}
-		return errDBso
+		return nil, StorageResponsibility{}, errOld
 	}
-	//Delete the deleted sector
-	for k := range sectorsRemoved {
+	batch := h.revisionBatcher.add(so.id(), so, h.config.RevisionBatchWindow)
+	h.proofWindows.update(so)
+
+	h.updateModifiedFinancialMetrics(so, oldso)
+	return batch, oldso, nil
+}
+
+// revertStorageResponsibilityModification reverts the financial metrics and removes the gained
+// sectors after the modified storage responsibility failed to be persisted
+func (h *StorageHost) revertStorageResponsibilityModification(so, oldso StorageResponsibility, sectorsGained []common.Hash) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.updateModifiedFinancialMetrics(oldso, so)
+	for i := range sectorsGained {
 		//The error of restoring a sector doesn't make any sense to us.
-		h.DeleteSector(sectorsRemoved[k])
+		h.DeleteSector(sectorsGained[i])
 	}
+}
 
+// updateModifiedFinancialMetrics applies the cost of the storage responsibility so, and removes
+// the cost of the storage responsibility oldso
+func (h *StorageHost) updateModifiedFinancialMetrics(so, oldso StorageResponsibility) {
 	// Update the financial information for the storage responsibility - apply the cost
 	h.financialMetrics.PotentialContractCompensation = h.financialMetrics.PotentialContractCompensation.Add(so.ContractCost)
 	h.financialMetrics.LockedStorageDeposit = h.financialMetrics.LockedStorageDeposit.Add(so.LockedStorageDeposit)
@@ -319,7 +378,6 @@ func (h *StorageHost) modifyStorageResponsibility(so StorageResponsibility, sect
 	h.financialMetrics.RiskedStorageDeposit = h.financialMetrics.RiskedStorageDeposit.Sub(oldso.RiskedStorageDeposit)
 	h.financialMetrics.TransactionFeeExpenses = h.financialMetrics.TransactionFeeExpenses.Sub(oldso.TransactionFeeExpenses)
 
-	return nil
 }
 
 // rollbackStorageResponsibility will rollback storage responsibility after modify when receive error
@@ -360,12 +418,12 @@ func (h *StorageHost) rollbackStorageResponsibility(oldSo StorageResponsibility,
 	var errNew error
 	errDB := func() error {
 		//Get new storage responsibility, return error if not found
-		newSo, errNew = getStorageResponsibility(h.db, oldSo.id())
+		newSo, errNew = h.loadStorageResponsibility(oldSo.id())
 		if errNew != nil {
 			return errNew
 		}
 
-		return putStorageResponsibility(h.db, oldSo.id(), oldSo)
+		return h.storeStorageResponsibility(oldSo.id(), oldSo)
 	}()
 
 	if errDB != nil {
@@ -486,9 +544,10 @@ func (h *StorageHost) removeStorageResponsibility(so StorageResponsibility, sos
 	}
 
 	h.financialMetrics.ContractCount--
+	delete(h.proofsInFlight, so.id())
 	so.ResponsibilityStatus = sos
 	so.SectorRoots = []common.Hash{}
-	return putStorageResponsibility(h.db, so.id(), so)
+	return h.storeStorageResponsibility(so.id(), so)
 }
 
 func (h *StorageHost) resetFinancialMetrics() error {
@@ -539,7 +598,7 @@ func (h *StorageHost) handleTaskItem(soid common.Hash) {
 	defer h.lock.Unlock()
 
 	// Fetch the storage Responsibility associated with the storage responsibility id.
-	so, err := getStorageResponsibility(h.db, soid)
+	so, err := h.loadStorageResponsibility(soid)
 	if err != nil {
 		h.log.Warn("Could not get storage Responsibility", "err", err)
 		return
@@ -600,7 +659,7 @@ func (h *StorageHost) handleTaskItem(soid common.Hash) {
 	}
 
 	//If revision meets the condition, a proof transaction will be submitted.
-	if !so.StorageProofConfirmed && h.blockHeight >= so.expiration()+postponedExecution {
+	if !so.StorageProofConfirmed && h.blockHeight >= so.proofSubmissionHeight(h.config.ProofSubmissionMargin) {
 		if len(so.SectorRoots) == 0 {
 			h.log.Info("The sector is empty and no storage operation appears", "id", so.id().String())
 			err := h.removeStorageResponsibility(so, responsibilitySucceeded)
@@ -619,82 +678,14 @@ func (h *StorageHost) handleTaskItem(soid common.Hash) {
 			return
 		}
 
-		//The storage host side gets the index of the data containing the segment
-		scrv := so.StorageContractRevisions[len(so.StorageContractRevisions)-1]
-		segmentIndex, err := h.storageProofSegment(scrv)
-		if err != nil {
-			h.log.Warn("An error occurred while getting the storage certificate from the storage host", "err", err)
-			return
-		}
-
-		sectorIndex := segmentIndex / (storage.SectorSize / merkle.LeafSize)
-		sectorRoot := so.SectorRoots[sectorIndex]
-		sectorBytes, err := h.ReadSector(sectorRoot)
-		//No content can be read from the memory, indicating that the storage host is not storing.
-		if err != nil {
-			h.log.Warn("the storage host is not storing", "err", err)
-			return
-		}
-
-		//Build a storage certificate for this storage contract
-		sectorSegment := segmentIndex % (storage.SectorSize / merkle.LeafSize)
-		base, cachedHashSet := merkleProof(sectorBytes, sectorSegment)
-		// Using the sector, build a cached root.
-		log2SectorSize := uint64(0)
-		for 1<<log2SectorSize < (storage.SectorSize / merkle.LeafSize) {
-			log2SectorSize++
-		}
-		ct := merkle.NewSha256CachedTree(log2SectorSize)
-		err = ct.SetStorageProofIndex(segmentIndex)
-		if err != nil {
-			h.log.Warn("cannot call SetIndex on Tree ", "err", err)
-		}
-		for _, root := range so.SectorRoots {
-			ct.Push(root)
-		}
-		hashSet := ct.Prove(base, cachedHashSet)
-		sp := types.StorageProof{
-			ParentID: so.id(),
-			HashSet:  hashSet,
-		}
-		copy(sp.Segment[:], base)
-
-		//Here take the address of the storage host in the storage contract book
-		fromAddress := so.OriginStorageContract.ValidProofOutputs[1].Address
-		account := accounts.Account{Address: fromAddress}
-		wallet, err := h.am.Find(account)
-		if err != nil {
-			h.log.Warn("There was an error opening the wallet", "err", err)
-			return
-		}
-		spSign, err := wallet.SignHash(account, sp.RLPHash().Bytes())
-		if err != nil {
-			h.log.Warn("Error when sign data", "err", err)
-			return
-		}
-		sp.Signature = spSign
-
-		spBytes, err := rlp.EncodeToBytes(sp)
-		if err != nil {
-			h.log.Warn("Error when serializing proof", "err", err)
+		if err := h.submitStorageProofOnce(so); err != nil {
+			h.log.Warn("Error submitting the storage proof", "err", err)
 			return
 		}
-
-		//The host sends a storage proof transaction to the transaction pool.
-		if _, err := h.sendStorageProofTx(fromAddress, spBytes); err != nil {
-			h.log.Warn("Error sending a storage proof transaction", "err", err)
-			return
-		}
-
-		//Insert the check proof task in the task queue.
-		err = h.queueTaskItem(so.proofDeadline(), so.id())
-		if err != nil {
-			h.log.Warn("Error queuing task item", err)
-		}
 	}
 
 	// Save the storage Responsibility.
-	errDB := putStorageResponsibility(h.db, soid, so)
+	errDB := h.storeStorageResponsibility(soid, so)
 	if errDB != nil {
 		h.log.Warn("Error updating the storage Responsibility", errDB)
 	}
@@ -709,37 +700,135 @@ func (h *StorageHost) handleTaskItem(soid common.Hash) {
 
 }
 
-//merkleProof get the storage proof
-func merkleProof(b []byte, proofIndex uint64) (base []byte, hashSet []common.Hash) {
-	t := merkle.NewSha256MerkleTree()
-	//This error doesn't mean anything to us.
-	t.SetStorageProofIndex(proofIndex)
+// submitStorageProof builds the storage proof of the storage responsibility, signs it with the
+// host address in the storage contract and sends the storage proof transaction
+func (h *StorageHost) submitStorageProof(so StorageResponsibility) error {
+	//The storage host side gets the index of the data containing the segment
+	scrv := so.StorageContractRevisions[len(so.StorageContractRevisions)-1]
+	segmentIndex, err := h.storageProofSegment(scrv, so.segmentSize())
+	if err != nil {
+		return fmt.Errorf("failed to get the storage proof segment: %v", err)
+	}
+	sp, err := h.buildStorageProof(so, segmentIndex)
+	if err != nil {
+		return err
+	}
+
+	//Here take the address of the storage host in the storage contract book
+	fromAddress := so.OriginStorageContract.ValidProofOutputs[1].Address
+	account := accounts.Account{Address: fromAddress}
+	wallet, err := h.am.Find(account)
+	if err != nil {
+		return fmt.Errorf("failed to open the wallet: %v", err)
+	}
+	spSign, err := wallet.SignHash(account, sp.RLPHash().Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to sign the storage proof: %v", err)
+	}
+	sp.Signature = spSign
+
+	spBytes, err := rlp.EncodeToBytes(sp)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the storage proof: %v", err)
+	}
 
-	buf := bytes.NewBuffer(b)
-	for buf.Len() > 0 {
-		t.PushLeaf(buf.Next(merkle.LeafSize))
+	//The host sends a storage proof transaction to the transaction pool.
+	if _, err := h.sendStorageProofTx(fromAddress, spBytes); err != nil {
+		return fmt.Errorf("failed to send the storage proof transaction: %v", err)
 	}
+	return nil
+}
 
-	// Get the storage proof
-	_, proof, _, _ := t.ProofList()
-	if len(proof) == 0 {
-		//If there is no data, it will return a blank value
-		return nil, nil
+// buildStorageProof builds the unsigned storage proof of the segment at segmentIndex of the
+// storage responsibility from the sector data stored by the host. The segment of the segment size
+// declared by the storage contract is the subtree of the sector tree of merkle.LeafSize leaves,
+// so the proof within the sector is the proof of the first leaf of the segment above the subtree
+func (h *StorageHost) buildStorageProof(so StorageResponsibility, segmentIndex uint64) (types.StorageProof, error) {
+	segmentSize := so.segmentSize()
+	segmentsPerSector := storage.SectorSize / segmentSize
+	sectorIndex := segmentIndex / segmentsPerSector
+	if sectorIndex >= uint64(len(so.SectorRoots)) {
+		return types.StorageProof{}, fmt.Errorf("segment %v beyond the %v sectors stored", segmentIndex, len(so.SectorRoots))
+	}
+	sectorRoot := so.SectorRoots[sectorIndex]
+
+	//Build a storage certificate for this storage contract. The proof within the sector is
+	//built with the sector tree stored along with the sector data
+	sectorSegment := segmentIndex % segmentsPerSector
+	leavesPerSegment := segmentSize / merkle.LeafSize
+	base, cachedHashSet, err := h.SectorSegmentProof(sectorRoot, sectorSegment*leavesPerSegment)
+	//No content can be read from the memory, indicating that the storage host is not storing.
+	if err != nil {
+		return types.StorageProof{}, fmt.Errorf("the storage host is not storing: %v", err)
+	}
+	if segmentSize != storage.SegmentSize {
+		sector, err := h.ReadSector(sectorRoot)
+		if err != nil {
+			return types.StorageProof{}, fmt.Errorf("the storage host is not storing: %v", err)
+		}
+		base = sector[sectorSegment*segmentSize : (sectorSegment+1)*segmentSize]
+	}
+	// Using the sector, build a cached root.
+	ct := merkle.NewSha256CachedTree(uint64(bits.TrailingZeros64(segmentsPerSector)))
+	err = ct.SetStorageProofIndex(segmentIndex)
+	if err != nil {
+		h.log.Warn("cannot call SetIndex on Tree ", "err", err)
 	}
+	for _, root := range so.SectorRoots {
+		ct.Push(root)
+	}
+	hashSet := ct.Prove(base, cachedHashSet[bits.TrailingZeros64(leavesPerSegment):])
+	sp := types.StorageProof{
+		ParentID: so.id(),
+		Segment:  make([]byte, segmentSize),
+		HashSet:  hashSet,
+	}
+	copy(sp.Segment, base)
+	return sp, nil
+}
 
-	base = proof[0]
-	hashSet = make([]common.Hash, len(proof)-1)
-	for i, p := range proof[1:] {
-		copy(hashSet[i][:], p)
+// submitStorageProofOnce submits the storage proof of the storage responsibility and queues the
+// proof checks, unless the proof submitted before is still in flight, i.e. submitted less than
+// postponedExecution blocks ago. The proof in flight is retried by the checks queued once it is
+// not confirmed in time
+func (h *StorageHost) submitStorageProofOnce(so StorageResponsibility) error {
+	if submitHeight, exist := h.proofsInFlight[so.id()]; exist && h.blockHeight < submitHeight+postponedExecution {
+		h.log.Debug("Storage proof in flight, skip submitting", "id", so.id(), "submitHeight", submitHeight)
+		return nil
+	}
+	if err := h.submitProof(so); err != nil {
+		return err
 	}
+	h.proofsInFlight[so.id()] = h.blockHeight
+	h.queueStorageProofChecks(so)
+	return nil
+}
 
-	return base, hashSet
+// queueStorageProofChecks queues the tasks to retry the storage proof submitted if it is not
+// confirmed in time, and to check the proof at the proof deadline
+func (h *StorageHost) queueStorageProofChecks(so StorageResponsibility) {
+	//Retry if the proof is not confirmed in time, as long as the retry is within the window
+	if retryHeight := h.blockHeight + postponedExecution; retryHeight < so.proofDeadline() {
+		if err := h.queueTaskItem(retryHeight, so.id()); err != nil {
+			h.log.Warn("Error queuing task item", err)
+		}
+	}
+
+	//Insert the check proof task in the task queue.
+	if err := h.queueTaskItem(so.proofDeadline(), so.id()); err != nil {
+		h.log.Warn("Error queuing task item", err)
+	}
 }
 
 //If it exists, return the index of the segment in the storage contract that needs to be proved
-func (h *StorageHost) storageProofSegment(fc types.StorageContractRevision) (uint64, error) {
+func (h *StorageHost) storageProofSegment(fc types.StorageContractRevision, segmentSize uint64) (uint64, error) {
+	return h.storageProofSegmentAt(fc, segmentSize, fc.NewWindowStart-1)
+}
+
+// storageProofSegmentAt returns the index of the segment of segmentSize challenged by the block
+// at triggerHeight
+func (h *StorageHost) storageProofSegmentAt(fc types.StorageContractRevision, segmentSize, triggerHeight uint64) (uint64, error) {
 	fcid := fc.ParentID
-	triggerHeight := fc.NewWindowStart - 1
 
 	block, errGetHeight := h.ethBackend.GetBlockByNumber(triggerHeight)
 	if errGetHeight != nil {
@@ -748,19 +837,15 @@ func (h *StorageHost) storageProofSegment(fc types.StorageContractRevision) (uin
 
 	triggerID := block.Hash()
 	seed := crypto.Keccak256Hash(triggerID[:], fcid[:])
-	numSegments := int64(calculateLeaves(fc.NewFileSize))
+	numSegments := int64(calculateLeaves(fc.NewFileSize, segmentSize))
 	seedInt := new(big.Int).SetBytes(seed[:])
 	index := seedInt.Mod(seedInt, big.NewInt(numSegments)).Uint64()
 
 	return index, nil
 }
 
-func calculateLeaves(dataSize uint64) uint64 {
-	numSegments := dataSize / merkle.LeafSize
-	if dataSize == 0 || dataSize%merkle.LeafSize != 0 {
-		numSegments++
-	}
-	return numSegments
+func calculateLeaves(dataSize, segmentSize uint64) uint64 {
+	return common.NumSegments(dataSize, segmentSize)
 }
 
 // sendStorageContractRevisionTx send revision contract tx
@@ -159,3 +159,129 @@ func TestStoreHeight(t *testing.T) {
 		}
 	}
 }
+
+// TestStorageResponsibility_ProofSubmissionHeight test the proof is scheduled at the margin after
+// the window start, and never later than the height leaving room for the retries
+func TestStorageResponsibility_ProofSubmissionHeight(t *testing.T) {
+	windowStart, windowEnd := uint64(1000), uint64(1100)
+	so := StorageResponsibility{
+		OriginStorageContract: types.StorageContract{
+			WindowStart: windowStart,
+			WindowEnd:   windowEnd,
+		},
+	}
+	latest := windowEnd - postponedExecution*proofSubmissionRetries
+	tests := []struct {
+		margin uint64
+		expect uint64
+	}{
+		{0, windowStart},
+		{postponedExecution, windowStart + postponedExecution},
+		{50, windowStart + 50},
+		{latest - windowStart, latest},
+		{latest - windowStart + 1, latest},
+		{windowEnd - windowStart, latest},
+		{10000, latest},
+	}
+	for _, test := range tests {
+		height := so.proofSubmissionHeight(test.margin)
+		if height != test.expect {
+			t.Errorf("margin %v: expect proof submission height %v, got %v", test.margin, test.expect, height)
+		}
+		if height+postponedExecution*proofSubmissionRetries > windowEnd {
+			t.Errorf("margin %v: proof submission height %v leaves no room for retries before %v", test.margin, height, windowEnd)
+		}
+	}
+}
+
+// TestInsertStorageResponsibility_ProofSchedule test the proof tasks are queued within the safety
+// margin instead of the window end
+func TestInsertStorageResponsibility_ProofSchedule(t *testing.T) {
+	h := newTestStorageHost(t)
+	defer h.db.Close()
+	h.config.ProofSubmissionMargin = 10
+
+	windowStart := h.blockHeight + postponedExecutionBuffer + 100
+	windowEnd := windowStart + h.config.WindowSize
+	so := StorageResponsibility{
+		OriginStorageContract: types.StorageContract{
+			WindowStart: windowStart,
+			WindowEnd:   windowEnd,
+		},
+		StorageContractRevisions: []types.StorageContractRevision{
+			{NewWindowStart: windowStart, NewWindowEnd: windowEnd},
+		},
+	}
+	if err := h.insertStorageResponsibility(so); err != nil {
+		t.Fatal(err)
+	}
+	proofHeight := windowStart + h.config.ProofSubmissionMargin
+	for _, height := range []uint64{proofHeight, proofHeight + postponedExecution} {
+		if !heightTasksContain(t, h.db, height, so.id()) {
+			t.Errorf("proof task not queued at height %v", height)
+		}
+	}
+	if heightTasksContain(t, h.db, windowEnd, so.id()) {
+		t.Errorf("proof task shall not be queued at the window end %v", windowEnd)
+	}
+}
+
+// heightTasksContain checks whether the tasks queued at the height contain the id
+func heightTasksContain(t *testing.T, db ethdb.Database, height uint64, id common.Hash) bool {
+	data, err := getHeight(db, height)
+	if err != nil {
+		return false
+	}
+	for i := 0; i+common.HashLength <= len(data); i += common.HashLength {
+		if common.BytesToHash(data[i:i+common.HashLength]) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TestStorageHost_SubmitStorageProofOnce test the storage proof in flight is not submitted again,
+// and is retried once it is not confirmed in time
+func TestStorageHost_SubmitStorageProofOnce(t *testing.T) {
+	h := newTestStorageHost(t)
+	defer h.db.Close()
+	h.blockHeight = 1000
+
+	windowStart := h.blockHeight - 1
+	windowEnd := windowStart + h.config.WindowSize
+	so := StorageResponsibility{
+		SectorRoots: []common.Hash{{1}},
+		OriginStorageContract: types.StorageContract{
+			WindowStart: windowStart,
+			WindowEnd:   windowEnd,
+		},
+	}
+	var submitted int
+	h.submitProof = func(StorageResponsibility) error {
+		submitted++
+		return nil
+	}
+
+	for i := 0; i != 2; i++ {
+		if err := h.submitStorageProofOnce(so); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if submitted != 1 {
+		t.Fatalf("expect the proof submitted once, got %v", submitted)
+	}
+	h.blockHeight += postponedExecution - 1
+	if err := h.submitStorageProofOnce(so); err != nil {
+		t.Fatal(err)
+	}
+	if submitted != 1 {
+		t.Fatalf("the proof in flight is submitted again")
+	}
+	h.blockHeight++
+	if err := h.submitStorageProofOnce(so); err != nil {
+		t.Fatal(err)
+	}
+	if submitted != 2 {
+		t.Fatalf("the proof not confirmed in time is not retried")
+	}
+}
@@ -27,10 +27,16 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 			_ = sp.SendHostAckMsg()
 			h.ethBackend.CheckAndUpdateConnection(sp.PeerNode())
 		} else if hostNegotiateErr != nil {
-			_ = sp.SendHostNegotiateErrorMsg()
+			_ = sp.SendHostNegotiateErrorMsg(hostNegotiateErr)
 		}
 	}()
 
+	if err := h.startNegotiation(); err != nil {
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrUnavailable, err)
+		return
+	}
+	defer h.finishNegotiation()
+
 	// Read upload request
 	var uploadRequest storage.UploadRequest
 	if err := uploadReqMsg.Decode(&uploadRequest); err != nil {
@@ -40,13 +46,13 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 
 	// Get revision from storage responsibility
 	h.lock.RLock()
-	so, err := getStorageResponsibility(h.db, uploadRequest.StorageContractID)
+	so, err := h.loadStorageResponsibility(uploadRequest.StorageContractID)
 	snapshotSo := so
 	h.lock.RUnlock()
 
 	// it is normal not getting storage responsibility
 	if err != nil {
-		hostNegotiateErr = fmt.Errorf("failed to get storage responsibility: %s", err.Error())
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrContractNotFound, fmt.Errorf("failed to get storage responsibility: %s", err.Error()))
 		return
 	}
 
@@ -54,6 +60,21 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 	currentBlockHeight := h.blockHeight
 	currentRevision := so.StorageContractRevisions[len(so.StorageContractRevisions)-1]
 
+	// The sector data shall hash to the roots declared by the client, which are the keys the
+	// sectors are stored with
+	if err := verifySectorRoots(uploadRequest); err != nil {
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, err)
+		return
+	}
+	if err := verifyVirtualSectors(uploadRequest, so.SectorRoots); err != nil {
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrRejected, err)
+		return
+	}
+	if err := verifyDeleteSectors(uploadRequest, so.SectorRoots); err != nil {
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrRejected, err)
+		return
+	}
+
 	// Process each action
 	newRoots := append([]common.Hash(nil), so.SectorRoots...)
 	sectorsChanged := make(map[uint64]struct{})
@@ -61,6 +82,8 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 	var bandwidthRevenue common.BigInt
 	var sectorsGained []common.Hash
 	var gainedSectorData [][]byte
+	var sectorsRemoved []common.Hash
+	var removedSectorData [][]byte
 	for _, action := range uploadRequest.Actions {
 		switch action.Type {
 		case storage.UploadActionAppend:
@@ -74,8 +97,35 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 
 			// Update finances
 			bandwidthRevenue = bandwidthRevenue.Add(settings.UploadBandwidthPrice.MultUint64(storage.SectorSize))
+		case storage.UploadActionAppendVirtual:
+			// The sector is already stored for the contract, so it is read locally instead of
+			// being uploaded, and no upload bandwidth is charged
+			newRoot := action.SectorRoot()
+			data, err := h.ReadSector(newRoot)
+			if err != nil {
+				hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrRejected, fmt.Errorf("failed to read the virtual sector: %s", err.Error()))
+				return
+			}
+			newRoots = append(newRoots, newRoot)
+			sectorsGained = append(sectorsGained, newRoot)
+			gainedSectorData = append(gainedSectorData, data)
+
+			sectorsChanged[uint64(len(newRoots))-1] = struct{}{}
+		case storage.UploadActionDelete:
+			// The sector is removed after the revision is committed. The data is read so that
+			// the sector could be restored if the revision is rolled back. No upload bandwidth
+			// is charged, and the storage revenue already paid is not refunded
+			root := action.SectorRoot()
+			data, err := h.ReadSector(root)
+			if err != nil {
+				hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrRejected, fmt.Errorf("failed to read the deleted sector: %s", err.Error()))
+				return
+			}
+			newRoots, _ = storage.RemoveSectorRoot(newRoots, root)
+			sectorsRemoved = append(sectorsRemoved, root)
+			removedSectorData = append(removedSectorData, data)
 		default:
-			hostNegotiateErr = fmt.Errorf("unknown upload action type: %s", action.Type)
+			hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, fmt.Errorf("unknown upload action type: %s", action.Type))
 		}
 	}
 
@@ -97,8 +147,11 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 	newRevision := currentRevision
 	newRevision.NewRevisionNumber = uploadRequest.NewRevisionNumber
 	for _, action := range uploadRequest.Actions {
-		if action.Type == storage.UploadActionAppend {
+		switch action.Type {
+		case storage.UploadActionAppend, storage.UploadActionAppendVirtual:
 			newRevision.NewFileSize += storage.SectorSize
+		case storage.UploadActionDelete:
+			newRevision.NewFileSize -= storage.SectorSize
 		}
 	}
 	newRevision.NewFileMerkleRoot = newMerkleRoot
@@ -122,7 +175,7 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 
 	so.SectorRoots, newRoots = newRoots, so.SectorRoots
 	if err := VerifyRevision(&so, &newRevision, currentBlockHeight, newRevenue, newDeposit); err != nil {
-		hostNegotiateErr = fmt.Errorf("revision verification failed. contractID: %s, err: %s", newRevision.ParentID.String(), err.Error())
+		hostNegotiateErr = newHostNegotiationError(storage.NegotiationErrInvalidRequest, fmt.Errorf("revision verification failed. contractID: %s, err: %s", newRevision.ParentID.String(), err.Error()))
 		return
 	}
 	so.SectorRoots, newRoots = newRoots, so.SectorRoots
@@ -178,7 +231,7 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 	}
 
 	if msg.Code == storage.ClientNegotiateErrorMsg {
-		clientNegotiateErr = storage.ErrClientNegotiate
+		clientNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrClientNegotiate)
 		return
 	}
 
@@ -224,9 +277,9 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 	}
 
 	if msg.Code == storage.ClientCommitSuccessMsg {
-		err = h.modifyStorageResponsibility(so, nil, sectorsGained, gainedSectorData)
+		err = h.modifyStorageResponsibility(so, sectorsRemoved, sectorsGained, gainedSectorData)
 		if err != nil {
-			_ = sp.SendHostCommitFailedMsg()
+			_ = sp.SendHostCommitFailedMsg(err)
 
 			// wait for client ack msg
 			msg, err = sp.HostWaitContractResp()
@@ -240,10 +293,10 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 			return
 		}
 	} else if msg.Code == storage.ClientCommitFailedMsg {
-		clientCommitErr = storage.ErrClientCommit
+		clientCommitErr = storage.DecodeNegotiationError(msg, storage.ErrClientCommit)
 		return
 	} else if msg.Code == storage.ClientNegotiateErrorMsg {
-		clientNegotiateErr = storage.ErrClientNegotiate
+		clientNegotiateErr = storage.DecodeNegotiationError(msg, storage.ErrClientNegotiate)
 		return
 	}
 
@@ -260,7 +313,7 @@ func UploadHandler(h *StorageHost, sp storage.Peer, uploadReqMsg p2p.Msg) {
 	// send host 'ACK' msg to client
 	if err := sp.SendHostAckMsg(); err != nil {
 		log.Error("storage host failed to send host ack msg", "err", err)
-		_ = h.rollbackStorageResponsibility(snapshotSo, sectorsGained, nil, nil)
+		_ = h.rollbackStorageResponsibility(snapshotSo, sectorsGained, sectorsRemoved, removedSectorData)
 		h.ethBackend.CheckAndUpdateConnection(sp.PeerNode())
 	}
 }
@@ -48,7 +48,7 @@ const (
 	DxFileExt = ".dxfile"
 
 	// ConfigVersion is the version of host config
-	ConfigVersion = "1.0.1"
+	ConfigVersion = "1.0.2"
 )
 
 type (
@@ -61,6 +61,22 @@ type (
 		WindowSize           uint64         `json:"windowSize"`
 		PaymentAddress       common.Address `json:"paymentAddress"`
 
+		// RevisionBatchWindow is the window over which the revised storage responsibilities
+		// are batched into one durable write
+		RevisionBatchWindow time.Duration `json:"revisionBatchWindow"`
+
+		// ProofSubmissionMargin is the number of blocks after the window start the storage
+		// proof is submitted at, leaving the rest of the window for retries
+		ProofSubmissionMargin uint64 `json:"proofSubmissionMargin"`
+
+		// ReadVerificationRate is the fraction of the sector reads verified against the sector
+		// root, 0 meaning no read is verified and 1 meaning all reads are verified
+		ReadVerificationRate float64 `json:"readVerificationRate"`
+
+		// FolderSelection is the strategy of selecting the storage folder to store a new sector,
+		// which is mostfree, firstfit or roundrobin
+		FolderSelection string `json:"folderSelection"`
+
 		Deposit       common.BigInt `json:"deposit"`
 		DepositBudget common.BigInt `json:"depositBudget"`
 		MaxDeposit    common.BigInt `json:"maxDeposit"`
@@ -75,12 +91,16 @@ type (
 
 	// HostIntConfigForDisplay is the host internal config for displayed
 	HostIntConfigForDisplay struct {
-		AcceptingContracts   string `json:"acceptingContracts"`
-		MaxDownloadBatchSize string `json:"maxDownloadBatchSize"`
-		MaxDuration          string `json:"maxDuration"`
-		MaxReviseBatchSize   string `json:"maxReviseBatchSize"`
-		WindowSize           string `json:"windowSize"`
-		PaymentAddress       string `json:"paymentAddress"`
+		AcceptingContracts    string `json:"acceptingContracts"`
+		MaxDownloadBatchSize  string `json:"maxDownloadBatchSize"`
+		MaxDuration           string `json:"maxDuration"`
+		MaxReviseBatchSize    string `json:"maxReviseBatchSize"`
+		WindowSize            string `json:"windowSize"`
+		PaymentAddress        string `json:"paymentAddress"`
+		RevisionBatchWindow   string `json:"revisionBatchWindow"`
+		ProofSubmissionMargin string `json:"proofSubmissionMargin"`
+		ReadVerificationRate  string `json:"readVerificationRate"`
+		FolderSelection       string `json:"folderSelection"`
 
 		Deposit       string `json:"deposit"`
 		DepositBudget string `json:"depositBudget"`
@@ -118,6 +138,11 @@ type (
 		UploadBandwidthPrice   common.BigInt `json:"uploadBandwidthPrice"`
 
 		Version string `json:"version"`
+
+		// Capabilities is the capabilities negotiated between the storage host and
+		// the storage client requesting the config. It is not encoded for a legacy
+		// client, see HostConfigMsg
+		Capabilities Capabilities `json:"capabilities"`
 	}
 
 	// HostInfo storage storage host information
@@ -131,6 +156,11 @@ type (
 		FailedInteractionFactor     float64                 `json:"FailedInteractionFactor"`
 		LastInteractionTime         uint64                  `json:"lastInteractionTime"`
 		InteractionRecords          []HostInteractionRecord `json:"interactionRecords"`
+		InteractionBuckets          []HostInteractionBucket `json:"interactionBuckets"`
+
+		// StorageOverReports is the number of consecutive storage probes the host rejected
+		// while advertising enough remaining storage
+		StorageOverReports uint64 `json:"storageOverReports"`
 
 		// TODO: refactor this into an interface: host scans
 		AccumulatedUptime   float64       `json:"accumulated_uptime"`
@@ -148,6 +178,13 @@ type (
 		EnodeURL   string   `json:"enodeurl"`
 		NodePubKey []byte   `json:"nodepubkey"`
 
+		// EnodeURLChanges is the time of the recent enode URL changes of the host
+		EnodeURLChanges []time.Time `json:"enode_url_changes"`
+
+		// SuspiciousURLChange is set if the host changed its enode URL too often, which
+		// might be caused by identity spoofing
+		SuspiciousURLChange bool `json:"suspicious_url_change"`
+
 		Filtered bool `json:"filtered"`
 	}
 
@@ -169,6 +206,16 @@ type (
 		Success         bool      `json:"success"`
 	}
 
+	// HostInteractionBucket aggregates the interaction records within a time bucket, which are
+	// no longer kept in detail. The weights are the sums of the interaction weights
+	HostInteractionBucket struct {
+		Start         time.Time `json:"start"`
+		Successes     uint64    `json:"successes"`
+		Failures      uint64    `json:"failures"`
+		SuccessWeight float64   `json:"successWeight"`
+		FailedWeight  float64   `json:"failedWeight"`
+	}
+
 	// MarketPrice is the market price metrics from HostMarket
 	MarketPrice struct {
 		ContractPrice common.BigInt
@@ -209,12 +256,14 @@ type RentPayment struct {
 
 // ClientSetting defines the settings that client used to create contract with other peers,
 // where EnableIPViolation specifies if the host with same network IP addresses will be filtered
-// out or not
+// out or not, and RepairDownloadThreshold specifies the fraction of the redundant sectors a
+// segment shall lose before it is downloaded from the hosts for repair
 type ClientSetting struct {
-	RentPayment       RentPayment `json:"rentPayment"`
-	EnableIPViolation bool        `json:"enableIPViolation"`
-	MaxUploadSpeed    int64       `json:"maxUploadSpeed"`
-	MaxDownloadSpeed  int64       `json:"maxDownloadSpeed"`
+	RentPayment             RentPayment `json:"rentPayment"`
+	EnableIPViolation       bool        `json:"enableIPViolation"`
+	MaxUploadSpeed          int64       `json:"maxUploadSpeed"`
+	MaxDownloadSpeed        int64       `json:"maxDownloadSpeed"`
+	RepairDownloadThreshold float64     `json:"repairDownloadThreshold"`
 }
 
 type (
@@ -236,10 +285,11 @@ type (
 
 	// ClientSettingAPIDisplay is used for API Configurations Display
 	ClientSettingAPIDisplay struct {
-		RentPayment       RentPaymentAPIDisplay `json:"RentPayment Setting"`
-		EnableIPViolation string                `json:"IP Violation Check Status"`
-		MaxUploadSpeed    string                `json:"Max Upload Speed"`
-		MaxDownloadSpeed  string                `json:"Max Download Speed"`
+		RentPayment             RentPaymentAPIDisplay `json:"RentPayment Setting"`
+		EnableIPViolation       string                `json:"IP Violation Check Status"`
+		MaxUploadSpeed          string                `json:"Max Upload Speed"`
+		MaxDownloadSpeed        string                `json:"Max Download Speed"`
+		RepairDownloadThreshold string                `json:"Repair Download Threshold"`
 	}
 )
 
@@ -322,6 +372,11 @@ type (
 		DxPath      DxPath
 		ErasureCode erasurecode.ErasureCoder
 		Mode        int
+
+		// SegmentOrder is the order the segments of the new file are uploaded in, and
+		// SegmentPriority is the segment indexes to be uploaded first with the priority order
+		SegmentOrder    string
+		SegmentPriority []uint64
 	}
 
 	// UploadFileInfo provides information about a file
@@ -392,6 +447,7 @@ type (
 		Redundancy     uint32  `json:"redundancy"`
 		StoredOnDisk   bool    `json:"storedOnDisk"`
 		UploadProgress float64 `json:"uploadProgress"`
+		RenewalPolicy  string  `json:"renewalPolicy"`
 	}
 
 	// FileBriefInfo is the brief info about a DxFile
@@ -400,6 +456,40 @@ type (
 		Status         string  `json:"status"`
 		UploadProgress float64 `json:"uploadProgress"`
 	}
+
+	// DuplicateFiles is a group of DxFiles with identical content
+	DuplicateFiles struct {
+		Checksum common.Hash `json:"checksum"`
+		FileSize uint64      `json:"fileSize"`
+		Paths    []string    `json:"dxpaths"`
+	}
+
+	// FileOnHost is a DxFile with sectors stored on a host, together with the health of the
+	// file and the projected health if the sectors on the host are lost
+	FileOnHost struct {
+		Path            string `json:"dxpath"`
+		Health          uint32 `json:"health"`
+		ProjectedHealth uint32 `json:"projectedHealth"`
+	}
+
+	// RebalanceMigration is the relocation of a DxFile from the expensive hosts to the cheaper
+	// hosts, with the data re-uploaded and the storage cost saved per block
+	RebalanceMigration struct {
+		Path            string        `json:"dxpath"`
+		FromHosts       []enode.ID    `json:"fromHosts"`
+		ToHosts         []enode.ID    `json:"toHosts"`
+		Bytes           uint64        `json:"bytes"`
+		UploadCost      common.BigInt `json:"uploadCost"`
+		SavingsPerBlock common.BigInt `json:"savingsPerBlock"`
+	}
+
+	// RebalancePlan is the migrations of a rebalance run, and the projected savings in total
+	RebalancePlan struct {
+		Migrations      []RebalanceMigration `json:"migrations"`
+		Bytes           uint64               `json:"bytes"`
+		UploadCost      common.BigInt        `json:"uploadCost"`
+		SavingsPerBlock common.BigInt        `json:"savingsPerBlock"`
+	}
 )
 
 type (
@@ -408,6 +498,20 @@ type (
 		Path         string `json:"path"`
 		TotalSectors uint64 `json:"totalSectors"`
 		UsedSectors  uint64 `json:"usedSectors"`
+		LostSectors  uint64 `json:"lostSectors"`
+	}
+
+	// HostFolderConsistency is the result of cross checking the stored sector count of a host
+	// folder against the usage bitmap and the folder sector index
+	HostFolderConsistency struct {
+		Path           string `json:"path"`
+		StoredSectors  uint64 `json:"storedSectors"`
+		UsedSlots      uint64 `json:"usedSlots"`
+		IndexedSectors uint64 `json:"indexedSectors"`
+		LeakedSlots    uint64 `json:"leakedSlots"`
+		MissingSlots   uint64 `json:"missingSlots"`
+		StaleEntries   uint64 `json:"staleEntries"`
+		Repaired       bool   `json:"repaired"`
 	}
 
 	// HostSpace is the
@@ -416,6 +520,40 @@ type (
 		UsedSectors  uint64 `json:"usedSectors"`
 		FreeSectors  uint64 `json:"freeSectors"`
 	}
+
+	// HostHealth is the health summary of the storage host
+	HostHealth struct {
+		Folders        []HostFolder `json:"folders"`
+		FreeSectors    uint64       `json:"freeSectors"`
+		UpcomingProofs uint64       `json:"upcomingProofs"`
+		WalDepth       int64        `json:"walDepth"`
+	}
+)
+
+type (
+	// ClientHealth is the health summary of the storage client. The files are counted by the
+	// health band of the latest health sample
+	ClientHealth struct {
+		TotalContracts      uint64 `json:"totalContracts"`
+		UploadableContracts uint64 `json:"uploadableContracts"`
+		RenewableContracts  uint64 `json:"renewableContracts"`
+		CanceledContracts   uint64 `json:"canceledContracts"`
+
+		HealthyFiles       uint64 `json:"healthyFiles"`
+		RepairNeededFiles  uint64 `json:"repairNeededFiles"`
+		UnrecoverableFiles uint64 `json:"unrecoverableFiles"`
+
+		RepairBacklog   uint64 `json:"repairBacklog"`
+		MemoryLimit     uint64 `json:"memoryLimit"`
+		MemoryAvailable uint64 `json:"memoryAvailable"`
+	}
+
+	// StorageHealth is the overall storage health of the node, combining the health of the
+	// storage client and the storage host. The subsystem not enabled is nil
+	StorageHealth struct {
+		Client *ClientHealth `json:"client,omitempty"`
+		Host   *HostHealth   `json:"host,omitempty"`
+	}
 )
 
 const (
@@ -425,17 +563,19 @@ const (
 	// HashSize is 32 bits
 	HashSize = 32
 
-	// SegmentSize is the segment size is used when taking the Merkle root of a file.
-	SegmentSize = 64
+	// SegmentSize is the segment size is used when taking the Merkle root of a file, which
+	// is the default segment size of the storage contract
+	SegmentSize = types.DefaultSegmentSize
 )
 
 // ParsedAPI will parse the APIs saved in the Ethereum
 // and get the ones needed
 type ParsedAPI struct {
-	NetInfo   *ethapi.PublicNetAPI
-	Account   *ethapi.PrivateAccountAPI
-	EthInfo   *ethapi.PublicEthereumAPI
-	StorageTx *ethapi.PrivateStorageContractTxAPI
+	NetInfo    *ethapi.PublicNetAPI
+	Account    *ethapi.PrivateAccountAPI
+	EthInfo    *ethapi.PublicEthereumAPI
+	BlockChain *ethapi.PublicBlockChainAPI
+	StorageTx  *ethapi.PrivateStorageContractTxAPI
 }
 
 // FilterAPIs will filter the APIs saved in the Ethereum and
@@ -461,6 +601,12 @@ func FilterAPIs(apis []rpc.API, parseAPI *ParsedAPI) error {
 				return errors.New("failed to acquire eth information")
 			}
 			parseAPI.EthInfo = ethAPI
+		case reflect.TypeOf(&ethapi.PublicBlockChainAPI{}):
+			blockChainAPI := api.Service.(*ethapi.PublicBlockChainAPI)
+			if blockChainAPI == nil {
+				return errors.New("failed to acquire block chain information")
+			}
+			parseAPI.BlockChain = blockChainAPI
 		case reflect.TypeOf(&ethapi.PrivateStorageContractTxAPI{}):
 			storageTx := api.Service.(*ethapi.PrivateStorageContractTxAPI)
 			if storageTx == nil {